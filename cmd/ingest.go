@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/internal/importer"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+)
+
+// runIngest imports footage recorded elsewhere as recordings of a camera:
+// "cam-recorder ingest -camera 'Front Door' /mnt/old-nvr/ch1". It can run
+// while the recorder is running.
+func runIngest(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	cameraName := flags.String("camera", "", "Camera to file the footage under")
+	move := flags.Bool("move", false, "Remove the source files once imported")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 || *cameraName == "" {
+		return fmt.Errorf("usage: cam-recorder [-config config.yaml] ingest -camera name [-move] directory")
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	found := false
+	retention := cfg.Recording.RetentionDays
+	for _, cam := range cfg.Cameras {
+		if cam.Name == *cameraName {
+			found = true
+			if days, ok := config.CameraRetention(cfg.Cameras)[cam.Name]; ok {
+				retention = days
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("camera %q is not configured", *cameraName)
+	}
+
+	idx, err := index.Open(cfg.IndexPath())
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	result, err := importer.Run(ctx, idx, importer.Options{
+		Camera:    *cameraName,
+		Dir:       flags.Arg(0),
+		OutputDir: cfg.Recording.OutputDir,
+		Format:    cfg.Recording.Format,
+		Move:      *move,
+	})
+	if result == nil {
+		return err
+	}
+
+	for _, f := range result.Imported {
+		fmt.Printf("✓ %s → %s (%s, from %s)\n", f.Source, f.Filename, f.StartedAt.Local().Format(time.DateTime), f.TimeFrom)
+	}
+	for _, f := range result.Skipped {
+		fmt.Printf("- %s: %s\n", f.Source, f.Reason)
+	}
+	for _, f := range result.Failed {
+		fmt.Printf("✗ %s: %s\n", f.Source, f.Reason)
+	}
+	fmt.Printf("Imported %d, skipped %d, failed %d.\n", len(result.Imported), len(result.Skipped), len(result.Failed))
+	if n := result.Expiring(time.Now().AddDate(0, 0, -retention)); n > 0 {
+		fmt.Printf("Warning: %d imported files are older than the camera's retention (%d days) and will be removed by the next cleanup.\n", n, retention)
+	}
+	return err
+}
@@ -4,31 +4,116 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/lets-vibe/cam-recorder/internal/backup"
+	"github.com/lets-vibe/cam-recorder/internal/capture"
 	"github.com/lets-vibe/cam-recorder/internal/config"
-	"github.com/lets-vibe/cam-recorder/internal/recorder"
-	"github.com/lets-vibe/cam-recorder/internal/storage"
+	"github.com/lets-vibe/cam-recorder/internal/failover"
+	"github.com/lets-vibe/cam-recorder/internal/frigate"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/internal/integrity"
+	"github.com/lets-vibe/cam-recorder/internal/notify"
+	_ "github.com/lets-vibe/cam-recorder/internal/notify/email"
+	"github.com/lets-vibe/cam-recorder/internal/reconcile"
+	"github.com/lets-vibe/cam-recorder/internal/report"
+	"github.com/lets-vibe/cam-recorder/internal/scene"
+	"github.com/lets-vibe/cam-recorder/internal/snmp"
+	"github.com/lets-vibe/cam-recorder/internal/tiering"
 	"github.com/lets-vibe/cam-recorder/internal/web"
+	"github.com/lets-vibe/cam-recorder/pkg/command"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
 )
 
 var (
 	configPath = flag.String("config", "config.yaml", "Path to configuration file")
+	fakeFFmpeg = flag.Float64("fake-ffmpeg", 0, "Run without ffmpeg, using a stand-in that writes placeholder files this many times faster than real time")
 	version    = "1.0.0"
 )
 
 func main() {
+	command.RunFake()
 	flag.Parse()
 
+	if *fakeFFmpeg > 0 {
+		command.Set(&command.Fake{Speed: *fakeFFmpeg})
+	}
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "simulate" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := runSimulate(ctx, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "ingest" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := runIngest(ctx, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "restore" {
+		if err := runRestore(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if handled, err := runService(flag.Args()); handled {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(parent context.Context) error {
 	fmt.Printf("IP Camera Recorder v%s\n", version)
 	fmt.Println("=====================================")
 
+	restored, err := backup.ApplyStaged(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+	if restored != nil {
+		fmt.Printf("✓ Restored the backup taken on %s at %s\n", restored.Host, restored.CreatedAt.Local().Format(time.DateTime))
+	}
+
 	cfg, err := config.Load(*configPath)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Logging.File != "" {
+		logFile, err := os.OpenFile(cfg.Logging.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		defer logFile.Close()
+		log.SetOutput(io.MultiWriter(os.Stderr, logFile))
 	}
 
 	fmt.Printf("Cameras configured: %d\n", len(cfg.Cameras))
@@ -39,47 +124,391 @@ func main() {
 		}
 		fmt.Printf("  - %s (%s)\n", cam.Name, status)
 	}
+	ingestOwners := config.IngestOwners(cfg.Cameras)
+	for _, cam := range cfg.Cameras {
+		owner, ok := ingestOwners[cam.Name]
+		switch {
+		case !ok:
+		case cfg.Recording.DuplicateURLs == config.DuplicateURLsShare:
+			fmt.Printf("  - %s shares the stream of %s\n", cam.Name, owner)
+		default:
+			log.Printf("Warning: Cameras %s and %s use the same stream, which opens two connections to it; set recording.duplicate_urls to \"share\" to record both from one", owner, cam.Name)
+		}
+	}
 	fmt.Printf("Output directory: %s\n", cfg.Recording.OutputDir)
 	fmt.Printf("Segment duration: %v\n", cfg.Recording.SegmentDuration)
 	fmt.Printf("Retention: %d days\n", cfg.Recording.RetentionDays)
 	fmt.Println()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(parent)
 	defer cancel()
 
-	store := storage.NewManager(&cfg.Recording)
+	idx, err := index.Open(cfg.IndexPath())
+	if err != nil {
+		return fmt.Errorf("failed to open index: %w", err)
+	}
+	fmt.Println("✓ Index opened")
+
+	var runStates map[string]string
+	if cfg.Recording.Startup == config.StartupResume {
+		if runStates, err = idx.RunStates(); err != nil {
+			log.Printf("Warning: Failed to load previous run state, following config: %v", err)
+		}
+		for i, cam := range cfg.Cameras {
+			if state, ok := runStates[cam.Name]; ok {
+				cfg.Cameras[i].Enabled = state != index.RunStopped
+			}
+		}
+	}
+
+	// The recording options are shared by the managers below, which read
+	// them without a lock, so a config import saves changes to them for the
+	// next start instead.
+	recording := cfg.Recording.Options
+	store := storage.NewManager(&recording)
+	store.SetQuotas(config.CameraQuotas(cfg.Cameras))
+	store.SetRetention(config.CameraRetention(cfg.Cameras))
+	store.SetDeleteHook(func(path string) {
+		if err := idx.DeleteSegment(path); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	})
+	store.SetDeleteFailedHook(func(path string, err error) {
+		if err := idx.AddFailedDelete(path, err.Error()); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	})
 	if err := store.Start(ctx); err != nil {
-		log.Fatalf("Failed to start storage manager: %v", err)
+		return fmt.Errorf("failed to start storage manager: %w", err)
 	}
 	fmt.Println("✓ Storage manager started")
 
-	recManager := recorder.NewRecorderManager(&cfg.Recording)
+	notifier := notify.NewDispatcher()
+	if err := notifier.SetThrottle(cfg.Notifications.Throttle); err != nil {
+		return fmt.Errorf("invalid notifications.throttle: %w", err)
+	}
+	notifier.SetRoutes(cfg.Notifications.Routes)
+	notifier.SetCameraTags(config.CameraTags(cfg.Cameras))
+	if cfg.Notifications.Push.Enabled {
+		push, err := notify.NewWebPush(idx, cfg.Notifications.Push.Subject)
+		if err != nil {
+			return fmt.Errorf("failed to set up web push: %w", err)
+		}
+		notifier.Add(push)
+		fmt.Println("✓ Web push notifications enabled")
+	}
+	for _, pc := range cfg.Plugins.Notifiers {
+		n, err := pc.Notifier()
+		if err != nil {
+			return fmt.Errorf("failed to load notifier plugin %s: %w", pc.Name, err)
+		}
+		notifier.Add(n)
+		fmt.Printf("✓ Notifier plugin '%s' loaded\n", pc.Name)
+	}
+
+	recManager := recorder.NewRecorderManager(&recording)
+	recManager.SetTranscodeLimit(recorder.NewLimiter(cfg.Limits.MaxTranscodes), cfg.Limits.Overflow)
+	recManager.SetResourceLimits(recorder.ResourceLimits{
+		MaxCPUPercent: cfg.Limits.MaxCPUPercent,
+		MaxRSSBytes:   uint64(max(cfg.Limits.MaxRSSMB, 0)) << 20,
+	})
+	recManager.SetRetryPolicy(cfg.Recording.Retry)
+	recManager.SetAdaptiveSegments(cfg.Recording.Adaptive)
+	recManager.SetDualMode(cfg.Recording.DualMode)
+	recManager.SetOrigin(cfg.Instance.Origin())
+	recManager.SetStatusHook(func(camera string, prevState, state recorder.State, err error) {
+		var errMsg string
+		if err != nil {
+			errMsg = err.Error()
+		}
+		if err := idx.RecordStatus(camera, string(state), errMsg, time.Now()); err != nil {
+			log.Printf("Warning: Failed to record status for %s: %v", camera, err)
+		}
+
+		if state.IsDown() && !prevState.IsDown() {
+			notifier.Send(notify.Notification{
+				Kind:   notify.KindOffline,
+				Camera: camera,
+				Title:  camera + " is offline",
+				Body:   errMsg,
+				URL:    cfg.Server.BasePath + "/camera/" + url.PathEscape(camera),
+				Image:  cfg.Server.BasePath + "/snapshot/" + url.PathEscape(camera),
+			})
+		}
+	})
+	recManager.SetFailoverHook(func(camera string, failover bool, err error) {
+		title, label := camera+" is back on its main URL", "main"
+		if failover {
+			title, label = camera+" switched to its failover URL", "failover"
+		}
+		var body string
+		if err != nil {
+			body = err.Error()
+		}
+		now := time.Now()
+		if _, err := idx.AddEvent(index.Event{Camera: camera, Kind: "failover", Label: label, Source: "recorder", StartedAt: now, EndedAt: now}); err != nil {
+			log.Printf("Warning: Failed to record failover event for %s: %v", camera, err)
+		}
+		notifier.Send(notify.Notification{
+			Kind:   notify.KindFailover,
+			Camera: camera,
+			Title:  title,
+			Body:   body,
+			URL:    cfg.Server.BasePath + "/camera/" + url.PathEscape(camera),
+		})
+	})
+	var scenes *scene.Manager
+	if cfg.Recording.StaticScenes.Detect {
+		scenes = scene.NewManager(cfg.Recording.StaticScenes, &recording, idx, store, recManager.Limiter(), cfg.Decode.Detection)
+		scenes.Start(ctx)
+		fmt.Println("✓ Static scene detection enabled")
+	}
+	syncer := storage.NewSyncer(cfg.Disk.Fsync)
+	syncer.Start(ctx)
+	checksums := integrity.NewManager(cfg.Integrity, &recording, idx, notifier)
+	checksums.Start(ctx)
+	if cfg.Integrity.Checksums != "" {
+		fmt.Printf("✓ Segment checksums enabled (%s)\n", cfg.Integrity.Checksums)
+	}
+	tiers := tiering.NewManager(cfg.Recording.ColdTier, cfg.Recording.OutputDir, idx, recManager.Limiter())
+	tiers.SetHook(checksums.Enqueue)
+	tiers.SetKeyframes(config.CameraKeyframes(cfg.Cameras))
+	tiers.Start(ctx)
+	if tier := cfg.Recording.ColdTier; tier.AfterDays > 0 {
+		fmt.Printf("✓ Cold tier enabled (after %d days, %dp)\n", tier.AfterDays, tier.Height)
+	}
+	indexSegment := func(seg recorder.RecordingSegment) {
+		syncer.Add(seg.Path)
+		if err := idx.AddSegment(indexedSegment(seg)); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		checksums.Enqueue(indexedSegment(seg))
+		if cfg.Recording.ScrubProxies {
+			recManager.Scrub().Enqueue(seg.Path)
+		}
+		if scenes != nil {
+			scenes.Enqueue(seg.Path)
+		}
+		tiers.Wake(seg.CameraName)
+	}
+	recManager.SetSegmentHook(indexSegment)
+	recManager.Scrub().Start(ctx)
+	recManager.Retranscode().Start(ctx)
+	recManager.Playback().Start(ctx)
+	recManager.Start(ctx)
+	if cfg.Recording.DualMode.Enabled {
+		fmt.Printf("✓ Dual mode enabled (failed transcodes re-encoded up to %d times)\n", cfg.Recording.DualMode.MaxAttempts)
+	}
+
+	reconciler := reconcile.NewManager(cfg.Reconcile, &recording, idx, store, notifier, func() []string {
+		return slices.Collect(maps.Keys(recManager.GetAllRecorders()))
+	})
+	reconciler.Start(ctx)
+	if cfg.Reconcile.Interval > 0 {
+		fmt.Printf("✓ Index reconciliation enabled (every %v, orphans: %s)\n", cfg.Reconcile.Interval, cfg.Reconcile.Orphans)
+	}
+
+	captures := capture.NewManager(cfg.Capture, cfg.Recording.OutputDir, cfg.Recording.RetentionDays)
+	captures.Start(ctx)
+
+	reports := report.NewManager(cfg.Notifications.Reports, idx, store, recManager, notifier)
+	reports.Start(ctx)
+	if r := cfg.Notifications.Reports; r.Period == report.PeriodWeekly {
+		fmt.Printf("✓ Weekly reports enabled (%s at %s)\n", r.Weekday, r.At)
+	} else if r.Period == report.PeriodDaily {
+		fmt.Printf("✓ Daily reports enabled (at %s)\n", r.At)
+	}
+
+	disk := storage.NewDiskMonitor(cfg.Disk.DiskOptions, cfg.Recording.OutputDir)
+	store.SetDiskMonitor(disk)
+	var spool *recorder.Spool
+	if cfg.Disk.SpoolDir != "" {
+		spool = recorder.NewSpool(cfg.Disk.SpoolDir)
+		recManager.SetSpool(spool)
+	}
+	if buf := cfg.Disk.RAMBuffer; buf.Dir != "" {
+		recManager.SetBuffer(recorder.NewBuffer(buf.Dir, int64(buf.MaxSizeMB)<<20))
+		recManager.StartBufferFlush(ctx, buf.FlushInterval)
+		fmt.Printf("✓ RAM buffer enabled (%s, flushed every %s)\n", buf.Dir, buf.FlushInterval)
+	}
+	disk.SetStallHook(func(stalled bool, latency time.Duration, err error) {
+		detail := fmt.Sprintf("a test write took %s", latency.Round(time.Millisecond))
+		if err != nil {
+			detail = err.Error()
+		}
+
+		if !stalled {
+			log.Printf("Recordings disk recovered (%s)", detail)
+			spool.SetActive(false)
+			if moved, err := recManager.DrainSpool(); err != nil {
+				log.Printf("Warning: %v", err)
+			} else if moved > 0 {
+				log.Printf("Moved %d spooled segments back to %s", moved, cfg.Recording.OutputDir)
+			}
+			notifier.Send(notify.Notification{
+				Kind:  notify.KindStorage,
+				Title: "Recordings disk recovered",
+				Body:  detail,
+			})
+			return
+		}
+
+		log.Printf("Warning: Recordings disk is stalling: %s", detail)
+		body := detail
+		if spool != nil {
+			spool.SetActive(true)
+			body += "; new segments go to " + cfg.Disk.SpoolDir
+		}
+		notifier.Send(notify.Notification{
+			Kind:  notify.KindStorage,
+			Title: "Recordings disk is stalling",
+			Body:  body,
+		})
+	})
+	disk.Start(ctx)
+
+	healthDirs := []string{cfg.Recording.OutputDir, filepath.Dir(cfg.IndexPath())}
+	if cfg.Disk.SpoolDir != "" {
+		healthDirs = append(healthDirs, cfg.Disk.SpoolDir)
+	}
+	smart := storage.NewSMARTMonitor(cfg.Disk.SMARTInterval, healthDirs...)
+	store.SetSMARTMonitor(smart)
+	smart.SetHook(func(health storage.DiskHealth) {
+		problems := strings.Join(health.Warnings, ", ")
+		log.Printf("Warning: Disk %s (%s) reports: %s", health.Device, strings.Join(health.Dirs, ", "), problems)
+		notifier.Send(notify.Notification{
+			Kind:  notify.KindStorage,
+			Title: "Disk " + health.Device + " is failing",
+			Body:  problems + ". Replace it before recordings are lost.",
+		})
+	})
+	smart.Start(ctx)
+
+	recoverSegments := func() {
+		recovered, report := recorder.RecoverSegments(ctx, cfg.Recording.OutputDir)
+		for _, seg := range recovered {
+			indexSegment(seg)
+		}
+		store.SetRecoveryReport(report)
+		if unfinished := len(report.Recovered) + len(report.Failed); unfinished > 0 {
+			fmt.Printf("✓ Recovered %d of %d unfinished segments\n", len(report.Recovered), unfinished)
+		}
+	}
+	var pair *failover.Manager
+	if cfg.Failover.Role != "" {
+		// Cameras start on standby until the lease is held. The journal is on
+		// the shared storage, so the segments it lists are only recovered
+		// once this instance takes over; the peer may still be writing them.
+		recManager.SetStandby(true)
+		pair = failover.NewManager(cfg.Failover, cfg.Recording.OutputDir)
+		pair.SetHook(func(active bool) {
+			status := pair.Status()
+			title := status.Name + " stopped recording"
+			if active {
+				recoverSegments()
+				title = status.Name + " took over recording"
+			}
+			recManager.SetStandby(!active)
+			notifier.Send(notify.Notification{
+				Kind:  notify.KindFailover,
+				Title: title,
+				Body:  status.Error,
+			})
+		})
+		pair.Start(ctx)
+		fmt.Printf("✓ Failover enabled (%s)\n", cfg.Failover.Role)
+	} else {
+		recoverSegments()
+	}
+
+	var ingests *recorder.IngestManager
+	if cfg.Ingest.Shared {
+		ingests = recorder.NewIngestManager()
+		ingests.Start(ctx)
+		fmt.Println("✓ Shared camera ingest enabled")
+	}
 
 	for _, cam := range cfg.Cameras {
-		if err := recManager.AddCamera(ctx, cam.Name, cam.RTSPURL, cam.Enabled); err != nil {
+		opts := cam.Recorder()
+		opts.URL = ingests.InputURL(cam.Name, cam.RTSPURL)
+		if cfg.Recording.DuplicateURLs == config.DuplicateURLsShare {
+			opts.ShareWith = ingestOwners[cam.Name]
+		}
+		if err := recManager.AddCamera(ctx, opts); err != nil {
 			log.Printf("Warning: Failed to add camera %s: %v", cam.Name, err)
 		} else {
 			status := "added"
 			if cam.Enabled {
 				status = "started"
 			}
+			if runStates[cam.Name] == index.RunPaused {
+				if err := recManager.PauseCamera(cam.Name); err != nil {
+					log.Printf("Warning: Failed to pause camera %s: %v", cam.Name, err)
+				} else {
+					status = "started paused"
+				}
+			}
+			if _, ok := runStates[cam.Name]; ok {
+				status += " (resumed)"
+			}
 			fmt.Printf("✓ Camera '%s' %s\n", cam.Name, status)
 		}
 	}
 
-	server := web.NewServer(cfg, recManager, store)
-
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	server := web.NewServer(cfg, recManager, store, idx, notifier)
+	server.SetVersion(version)
+	server.SetSyncer(syncer)
+	server.SetReports(reports)
+	server.SetIngest(ingests)
+	server.SetFailover(pair)
+	server.SetIntegrity(checksums)
+	server.SetReconciler(reconciler)
+	server.SetTiering(tiers)
+	server.SetCapture(captures)
+	for _, pc := range cfg.Plugins.Detectors {
+		d, err := pc.Detector()
+		if err != nil {
+			return fmt.Errorf("failed to load detector plugin %s: %w", pc.Name, err)
+		}
+		server.AddDetector(d, pc.Cameras)
+		fmt.Printf("✓ Detector plugin '%s' loaded\n", pc.Name)
+	}
+	if cfg.SNMP.Enabled {
+		agent, err := snmp.NewAgent(cfg.SNMP, idx, server.SNMPValues)
+		if err != nil {
+			return fmt.Errorf("failed to set up the SNMP agent: %w", err)
+		}
+		if err := agent.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start the SNMP agent: %w", err)
+		}
+		fmt.Printf("✓ SNMP agent listening on %s\n", cfg.SNMP.Listen)
+	}
+	if cfg.Frigate.Enabled() {
+		frigate.NewSubscriber(cfg.Frigate, server.FrigateEvent).Start(ctx)
+		fmt.Printf("✓ Importing Frigate events from %s\n", config.StripCredentials(cfg.Frigate.Broker))
+	}
+	// Now that the server exists, also announce finished segments to it.
+	recManager.SetSegmentHook(func(seg recorder.RecordingSegment) {
+		indexSegment(seg)
+		server.SegmentFinished(indexedSegment(seg))
+	})
 
+	shutdownDone := make(chan struct{})
 	go func() {
-		<-sigCh
+		defer close(shutdownDone)
+		<-ctx.Done()
 		fmt.Println("\n=====================================")
 		fmt.Println("Shutting down...")
-		cancel()
 		server.Stop()
 		recManager.StopAll()
+		if moved, err := recManager.FlushBuffer(); err != nil {
+			log.Printf("Warning: %v", err)
+		} else if moved > 0 {
+			fmt.Printf("Flushed %d segments from the RAM buffer\n", moved)
+		}
+		syncer.Flush()
 		store.Stop()
+		idx.Close()
 	}()
 
 	fmt.Println()
@@ -91,5 +520,33 @@ func main() {
 		log.Printf("Server stopped: %v", err)
 	}
 
+	cancel()
+	<-shutdownDone
+
 	fmt.Println("Goodbye!")
+	return nil
+}
+
+func indexedSegment(seg recorder.RecordingSegment) index.Segment {
+	indexed := index.Segment{
+		Camera:    seg.CameraName,
+		Filename:  filepath.Base(seg.Path),
+		Path:      seg.Path,
+		StartedAt: seg.StartedAt,
+		EndedAt:   seg.EndedAt,
+		Size:      seg.Size,
+		Instance:  seg.Origin.Instance,
+		Site:      seg.Origin.Site,
+	}
+	if seg.Stats != nil {
+		indexed.Frames = seg.Stats.Frames
+		indexed.DroppedFrames = seg.Stats.DroppedFrames
+		indexed.MissedPackets = seg.Stats.MissedPackets
+		indexed.Discontinuities = seg.Stats.Discontinuities
+		indexed.Quality = seg.Stats.Rating()
+	}
+	if run := seg.Command; run != nil {
+		indexed.Command = &index.SegmentCommand{Args: run.Args, ExitCode: run.ExitCode, Status: run.Status}
+	}
+	return indexed
 }
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/backup"
+)
+
+// runRestore stages a backup taken through /api/system/backup, to be applied
+// the next time the recorder starts: "cam-recorder restore backup.tar.gz".
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: cam-recorder [-config config.yaml] restore backup.tar.gz")
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	manifest, err := backup.Stage(f, *configPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Staged the backup taken on %s at %s (v%s).\n", manifest.Host, manifest.CreatedAt.Local().Format(time.DateTime), manifest.Version)
+	fmt.Println("It replaces the config, index and uploaded images the next time the recorder starts.")
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package main
+
+func runService(args []string) (bool, error) {
+	return false, nil
+}
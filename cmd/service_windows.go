@@ -0,0 +1,153 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	serviceName        = "cam-recorder"
+	serviceDisplayName = "IP Camera Recorder"
+	serviceStopTimeout = 30 * time.Second
+)
+
+func runService(args []string) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return true, fmt.Errorf("failed to detect service mode: %w", err)
+	}
+	if isService {
+		return true, svc.Run(serviceName, &windowsService{})
+	}
+
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch args[0] {
+	case "install":
+		return true, installService()
+	case "uninstall":
+		return true, uninstallService()
+	}
+	return false, nil
+}
+
+type windowsService struct{}
+
+func (windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	// Services start in System32; resolve relative paths (config, web
+	// assets, recordings) against the executable's directory instead.
+	if exe, err := os.Executable(); err == nil {
+		os.Chdir(filepath.Dir(exe))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runErr = run(ctx)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case <-done:
+			if runErr != nil {
+				log.Print(runErr)
+				return true, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32(serviceStopTimeout / time.Millisecond)}
+				cancel()
+				select {
+				case <-done:
+				case <-time.After(serviceStopTimeout):
+				}
+				return false, 0
+			}
+		}
+	}
+}
+
+func installService() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+	cfgPath, err := filepath.Abs(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config path: %w", err)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: "Records IP camera RTSP streams to disk",
+		StartType:   mgr.StartAutomatic,
+	}, "-config", cfgPath)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	err = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 10 * time.Second},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+
+	fmt.Printf("Service %s installed (config: %s)\n", serviceName, cfgPath)
+	return nil
+}
+
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+
+	fmt.Printf("Service %s removed\n", serviceName)
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+)
+
+// runSimulate serves a synthetic camera, so the recorder can be tried out or
+// tested without one: "cam-recorder simulate [flags]".
+func runSimulate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	listen := flags.String("listen", "127.0.0.1:8554", "Address serving the stream as MPEG-TS over TCP")
+	httpAddr := flags.String("http", "127.0.0.1:8555", "Address serving the stream over HTTP, empty to disable")
+	pattern := flags.String("pattern", "testsrc2", "Test picture: testsrc, testsrc2, smptebars, smptehdbars, rgbtestsrc or mandelbrot")
+	size := flags.String("size", "1280x720", "Picture size")
+	framerate := flags.String("framerate", "15", "Frames per second")
+	duration := flags.Duration("duration", 0, "Stop after this long, 0 to run until interrupted")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	query := url.Values{"pattern": {*pattern}, "video_size": {*size}, "framerate": {*framerate}}
+	demoURL := "demo:?" + query.Encode()
+	if _, err := source.Parse(demoURL); err != nil {
+		return err
+	}
+
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", *listen, err)
+	}
+	tcpURL := "tcp://" + listener.Addr().String()
+
+	fmt.Printf("Simulated camera (%s, %s at %s fps)\n", *pattern, *size, *framerate)
+	fmt.Printf("  MPEG-TS over TCP: %s\n", tcpURL)
+
+	if *httpAddr != "" {
+		httpListener, err := net.Listen("tcp", *httpAddr)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("failed to listen on %s: %w", *httpAddr, err)
+		}
+		server := &http.Server{Handler: simulateHandler(listener.Addr().String())}
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		go func() {
+			if err := server.Serve(httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Warning: Simulator HTTP server stopped: %v", err)
+			}
+		}()
+		fmt.Printf("  HTTP:             http://%s/stream.ts\n", httpListener.Addr())
+	}
+
+	fmt.Printf("\nRecord it by adding to config.yaml:\n\n")
+	fmt.Printf("cameras:\n  - name: \"Simulated\"\n    rtsp_url: %q\n    enabled: true\n\n", tcpURL)
+	fmt.Println("Press Ctrl+C to stop")
+
+	recorder.ServeIngest(ctx, "Simulated", demoURL, listener)
+	return nil
+}
+
+// simulateHandler streams the relay at addr to HTTP clients, for players
+// that cannot open a raw TCP stream.
+func simulateHandler(addr string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stream.ts", func(w http.ResponseWriter, r *http.Request) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(r.Context(), "tcp", addr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer conn.Close()
+		go func() {
+			<-r.Context().Done()
+			conn.Close()
+		}()
+
+		w.Header().Set("Content-Type", "video/mp2t")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				if _, err := w.Write(buf[:n]); err != nil {
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) && r.Context().Err() == nil {
+					log.Printf("Warning: Simulator stream ended: %v", err)
+				}
+				return
+			}
+		}
+	})
+	return mux
+}
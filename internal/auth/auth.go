@@ -0,0 +1,116 @@
+// Package auth signs people in to the web UI with an OpenID Connect
+// provider or an LDAP directory, and maps the groups they are in to the
+// admin or viewer role.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Role is what a signed-in user may do: admins everything, viewers only
+// watch and search.
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"
+	RoleViewer Role = "viewer"
+
+	// DefaultSessionDuration is how long a sign-in lasts when
+	// session_duration is not set.
+	DefaultSessionDuration = 12 * time.Hour
+)
+
+// ErrInvalidCredentials is returned for a wrong user name or password.
+var ErrInvalidCredentials = errors.New("invalid user name or password")
+
+// Config turns on single sign-on. Users are given the admin role when they
+// are in one of AdminGroups, else the viewer role when they are in one of
+// ViewerGroups, else DefaultRole; with no DefaultRole they are refused.
+// Groups match group names case-insensitively, and also the common name of
+// group DNs such as LDAP's memberOf values.
+type Config struct {
+	OIDC            OIDCConfig    `mapstructure:"oidc" yaml:"oidc"`
+	LDAP            LDAPConfig    `mapstructure:"ldap" yaml:"ldap"`
+	AdminGroups     []string      `mapstructure:"admin_groups" yaml:"admin_groups,omitempty"`
+	ViewerGroups    []string      `mapstructure:"viewer_groups" yaml:"viewer_groups,omitempty"`
+	DefaultRole     Role          `mapstructure:"default_role" yaml:"default_role,omitempty"`
+	SessionDuration time.Duration `mapstructure:"session_duration" yaml:"session_duration"`
+}
+
+// Enabled reports whether a sign-in is required for the web UI.
+func (c Config) Enabled() bool {
+	return c.OIDC.Enabled() || c.LDAP.Enabled()
+}
+
+// Validate checks the providers and the role mapping.
+func (c Config) Validate() error {
+	if err := c.OIDC.Validate(); err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+	if err := c.LDAP.Validate(); err != nil {
+		return fmt.Errorf("ldap: %w", err)
+	}
+	switch c.DefaultRole {
+	case "", RoleAdmin, RoleViewer:
+	default:
+		return fmt.Errorf("default_role must be admin, viewer or empty")
+	}
+	if c.Enabled() && len(c.AdminGroups) == 0 && c.DefaultRole != RoleAdmin {
+		return fmt.Errorf("set admin_groups, or nobody can change anything")
+	}
+	if c.SessionDuration < 0 {
+		return fmt.Errorf("session_duration must not be negative")
+	}
+	return nil
+}
+
+// Role returns the role of a user in groups, or false when the user may not
+// sign in.
+func (c Config) Role(groups []string) (Role, bool) {
+	switch {
+	case matchGroups(c.AdminGroups, groups):
+		return RoleAdmin, true
+	case matchGroups(c.ViewerGroups, groups):
+		return RoleViewer, true
+	case c.DefaultRole != "":
+		return c.DefaultRole, true
+	default:
+		return "", false
+	}
+}
+
+func matchGroups(wanted, groups []string) bool {
+	for _, group := range groups {
+		name := commonName(group)
+		if slices.ContainsFunc(wanted, func(w string) bool {
+			return strings.EqualFold(w, group) || strings.EqualFold(w, name)
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// commonName returns the value of a DN's first RDN, such as nvr-admins for
+// cn=nvr-admins,ou=groups,dc=example,dc=com, or "" for other names.
+func commonName(dn string) string {
+	rdn, _, ok := strings.Cut(dn, ",")
+	if !ok {
+		return ""
+	}
+	attr, value, ok := strings.Cut(rdn, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(attr), "cn") {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+// Identity is who signed in, as the provider tells it.
+type Identity struct {
+	User   string
+	Groups []string
+}
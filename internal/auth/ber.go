@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER tags of the LDAP messages used (RFC 4511).
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	berSet         = 0x31
+
+	ldapBindRequest      = 0x60
+	ldapBindResponse     = 0x61
+	ldapUnbindRequest    = 0x42
+	ldapSearchRequest    = 0x63
+	ldapSearchEntry      = 0x64
+	ldapSearchDone       = 0x65
+	ldapExtendedRequest  = 0x77
+	ldapExtendedResponse = 0x78
+
+	// Context-specific tags: simple authentication in a bind request, and
+	// the request name of an extended request.
+	ldapSimpleAuth   = 0x80
+	ldapExtendedName = 0x80
+
+	// maxMessage bounds a message from the server.
+	maxMessage = 4 << 20
+)
+
+var errTruncated = errors.New("truncated LDAP message")
+
+func tlv(tag byte, parts ...[]byte) []byte {
+	var content []byte
+	for _, p := range parts {
+		content = append(content, p...)
+	}
+	b := []byte{tag}
+	n := len(content)
+	if n < 0x80 {
+		b = append(b, byte(n))
+	} else {
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		b = append(b, 0x80|byte(len(length)))
+		b = append(b, length...)
+	}
+	return append(b, content...)
+}
+
+func berString(tag byte, s string) []byte {
+	return tlv(tag, []byte(s))
+}
+
+func berInt(tag byte, n int) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		if n >= -0x80 && n < 0x80 {
+			break
+		}
+		n >>= 8
+	}
+	return tlv(tag, b)
+}
+
+func berBool(v bool) []byte {
+	if v {
+		return tlv(berBoolean, []byte{0xff})
+	}
+	return tlv(berBoolean, []byte{0})
+}
+
+// readTLV splits off the first value of b, returning its tag, its content
+// and what follows it.
+func readTLV(b []byte) (byte, []byte, []byte, error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errTruncated
+	}
+	tag, n, b := b[0], int(b[1]), b[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 4 || len(b) < size {
+			return 0, nil, nil, fmt.Errorf("invalid length")
+		}
+		n = 0
+		for _, c := range b[:size] {
+			n = n<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if n < 0 || len(b) < n {
+		return 0, nil, nil, errTruncated
+	}
+	return tag, b[:n], b[n:], nil
+}
+
+func readInt(b []byte) (int, []byte, error) {
+	tag, content, rest, err := readTLV(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	if (tag != berInteger && tag != berEnumerated) || len(content) == 0 || len(content) > 4 {
+		return 0, nil, fmt.Errorf("invalid integer")
+	}
+	n := int(int8(content[0]))
+	for _, c := range content[1:] {
+		n = n<<8 | int(c)
+	}
+	return n, rest, nil
+}
+
+func readString(b []byte) (string, []byte, error) {
+	tag, content, rest, err := readTLV(b)
+	if err != nil {
+		return "", nil, err
+	}
+	if tag != berOctetString {
+		return "", nil, fmt.Errorf("invalid string")
+	}
+	return string(content), rest, nil
+}
+
+// readMessage reads one BER value from r.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	n := int(header[1])
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 4 {
+			return nil, fmt.Errorf("invalid length")
+		}
+		length := make([]byte, size)
+		if _, err := io.ReadFull(r, length); err != nil {
+			return nil, err
+		}
+		header = append(header, length...)
+		n = 0
+		for _, c := range length {
+			n = n<<8 | int(c)
+		}
+	}
+	if n > maxMessage {
+		return nil, fmt.Errorf("LDAP message too large")
+	}
+	msg := make([]byte, len(header)+n)
+	copy(msg, header)
+	if _, err := io.ReadFull(r, msg[len(header):]); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Context-specific tags of search filter choices (RFC 4511).
+const (
+	filterAnd        = 0xa0
+	filterOr         = 0xa1
+	filterNot        = 0xa2
+	filterEquality   = 0xa3
+	filterSubstrings = 0xa4
+	filterGreater    = 0xa5
+	filterLess       = 0xa6
+	filterPresent    = 0x87
+	filterApprox     = 0xa8
+
+	substringInitial = 0x80
+	substringAny     = 0x81
+	substringFinal   = 0x82
+)
+
+const maxFilterNesting = 16
+
+// escapeFilter escapes a value for a search filter (RFC 4515), so a user
+// name cannot change the filter.
+func escapeFilter(s string) string {
+	var b strings.Builder
+	for i := range len(s) {
+		switch c := s[i]; c {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// compileFilter encodes a search filter in its string form, such as
+// (&(objectClass=person)(uid=jane)), for a search request.
+func compileFilter(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") {
+		s = "(" + s + ")"
+	}
+	b, rest, err := parseFilter(s, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", s, err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("invalid filter %q: unexpected %q", s, rest)
+	}
+	return b, nil
+}
+
+func parseFilter(s string, depth int) ([]byte, string, error) {
+	if depth > maxFilterNesting {
+		return nil, "", fmt.Errorf("nested too deeply")
+	}
+	if len(s) < 2 || s[0] != '(' {
+		return nil, "", fmt.Errorf("missing (")
+	}
+	s = s[1:]
+
+	switch s[0] {
+	case '&', '|', '!':
+		op := s[0]
+		s = s[1:]
+		var parts [][]byte
+		for strings.HasPrefix(s, "(") {
+			part, rest, err := parseFilter(s, depth+1)
+			if err != nil {
+				return nil, "", err
+			}
+			parts = append(parts, part)
+			s = rest
+		}
+		if !strings.HasPrefix(s, ")") {
+			return nil, "", fmt.Errorf("missing )")
+		}
+		switch {
+		case op == '!' && len(parts) != 1:
+			return nil, "", fmt.Errorf("! takes one filter")
+		case op == '!':
+			return tlv(filterNot, parts[0]), s[1:], nil
+		case op == '&':
+			return tlv(filterAnd, parts...), s[1:], nil
+		default:
+			return tlv(filterOr, parts...), s[1:], nil
+		}
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", fmt.Errorf("missing )")
+	}
+	item, rest := s[:end], s[end+1:]
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, "", fmt.Errorf("missing = in %q", item)
+	}
+	attr, raw := item[:eq], item[eq+1:]
+	tag := byte(filterEquality)
+	switch attr[len(attr)-1] {
+	case '~':
+		tag = filterApprox
+	case '>':
+		tag = filterGreater
+	case '<':
+		tag = filterLess
+	case ':':
+		return nil, "", fmt.Errorf("extensible matches are not supported")
+	}
+	if tag != filterEquality {
+		attr = attr[:len(attr)-1]
+	}
+	if attr == "" {
+		return nil, "", fmt.Errorf("missing attribute in %q", item)
+	}
+
+	if tag == filterEquality && raw == "*" {
+		return berString(filterPresent, attr), rest, nil
+	}
+	if tag == filterEquality && strings.Contains(raw, "*") {
+		pieces := strings.Split(raw, "*")
+		var subs [][]byte
+		for i, piece := range pieces {
+			if piece == "" {
+				continue
+			}
+			value, err := unescapeFilter(piece)
+			if err != nil {
+				return nil, "", err
+			}
+			switch i {
+			case 0:
+				subs = append(subs, berString(substringInitial, value))
+			case len(pieces) - 1:
+				subs = append(subs, berString(substringFinal, value))
+			default:
+				subs = append(subs, berString(substringAny, value))
+			}
+		}
+		return tlv(filterSubstrings, berString(berOctetString, attr), tlv(berSequence, subs...)), rest, nil
+	}
+	value, err := unescapeFilter(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	return tlv(tag, berString(berOctetString, attr), berString(berOctetString, value)), rest, nil
+}
+
+func unescapeFilter(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", fmt.Errorf("invalid escape in %q", s)
+		}
+		c, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in %q", s)
+		}
+		b.Write(c)
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,410 @@
+package auth
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ldapTimeout = 10 * time.Second
+
+	// startTLSOID names the StartTLS extended operation (RFC 4511).
+	startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+	ldapScopeSubtree      = 2
+	ldapNeverDerefAliases = 0
+	// ldapNoAttributes asks a search for the DNs alone.
+	ldapNoAttributes = "1.1"
+
+	defaultLDAPUserFilter     = "(uid={user})"
+	defaultLDAPGroupAttribute = "memberOf"
+)
+
+// LDAP result codes.
+const (
+	ldapSuccess            = 0
+	ldapSizeLimitExceeded  = 4
+	ldapInvalidCredentials = 49
+)
+
+// LDAPConfig signs users in with a user name and password checked against
+// an LDAP directory or Active Directory. The user is looked up under BaseDN
+// with UserFilter, bound as to check the password, and their groups read
+// from GroupAttribute or, for directories without memberOf, found with
+// GroupFilter.
+type LDAPConfig struct {
+	// URL is ldaps://host[:636], or ldap://host[:389] with StartTLS or on
+	// a trusted network.
+	URL                string `mapstructure:"url" yaml:"url,omitempty"`
+	StartTLS           bool   `mapstructure:"start_tls" yaml:"start_tls,omitempty"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify" yaml:"insecure_skip_verify,omitempty"`
+	// BindDN and BindPassword are the account the user is looked up with;
+	// empty searches anonymously.
+	BindDN       string `mapstructure:"bind_dn" yaml:"bind_dn,omitempty"`
+	BindPassword string `mapstructure:"bind_password" yaml:"bind_password,omitempty"`
+	BaseDN       string `mapstructure:"base_dn" yaml:"base_dn,omitempty"`
+	// UserFilter finds the user, with {user} the escaped user name; the
+	// default is (uid={user}), and (sAMAccountName={user}) suits Active
+	// Directory.
+	UserFilter     string `mapstructure:"user_filter" yaml:"user_filter,omitempty"`
+	GroupAttribute string `mapstructure:"group_attribute" yaml:"group_attribute,omitempty"`
+	// GroupFilter finds the user's groups under GroupBaseDN (default
+	// BaseDN), with {dn} the user's DN, such as (member={dn}).
+	GroupFilter string `mapstructure:"group_filter" yaml:"group_filter,omitempty"`
+	GroupBaseDN string `mapstructure:"group_base_dn" yaml:"group_base_dn,omitempty"`
+}
+
+// Enabled reports whether LDAP sign-in is set up.
+func (c LDAPConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// Validate checks the URL and filters.
+func (c LDAPConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return fmt.Errorf("url must be ldap://host or ldaps://host")
+	}
+	if u.Scheme == "ldaps" && c.StartTLS {
+		return fmt.Errorf("start_tls is for ldap:// URLs")
+	}
+	if c.BaseDN == "" {
+		return fmt.Errorf("base_dn is required")
+	}
+	if _, err := compileFilter(c.userFilter("x")); err != nil {
+		return fmt.Errorf("user_filter: %w", err)
+	}
+	if c.GroupFilter != "" {
+		if _, err := compileFilter(c.groupFilter("x", "x")); err != nil {
+			return fmt.Errorf("group_filter: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c LDAPConfig) userFilter(user string) string {
+	return strings.ReplaceAll(cmp.Or(c.UserFilter, defaultLDAPUserFilter), "{user}", escapeFilter(user))
+}
+
+func (c LDAPConfig) groupFilter(user, dn string) string {
+	r := strings.NewReplacer("{user}", escapeFilter(user), "{dn}", escapeFilter(dn))
+	return r.Replace(c.GroupFilter)
+}
+
+// Authenticate checks a user's password and returns their groups. A wrong
+// user name or password is ErrInvalidCredentials.
+func (c LDAPConfig) Authenticate(ctx context.Context, user, password string) (Identity, error) {
+	// An empty password would be an unauthenticated bind, which many
+	// directories accept for any DN.
+	if user == "" || password == "" {
+		return Identity{}, ErrInvalidCredentials
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to connect to LDAP: %w", err)
+	}
+	defer conn.close()
+
+	if c.BindDN != "" {
+		if err := conn.bind(c.BindDN, c.BindPassword); err != nil {
+			return Identity{}, fmt.Errorf("failed to bind as %s: %w", c.BindDN, err)
+		}
+	}
+	groupAttr := cmp.Or(c.GroupAttribute, defaultLDAPGroupAttribute)
+	entries, err := conn.search(c.BaseDN, c.userFilter(user), []string{groupAttr}, 2)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to look up %s: %w", user, err)
+	}
+	switch {
+	case len(entries) == 0:
+		return Identity{}, ErrInvalidCredentials
+	case len(entries) > 1:
+		return Identity{}, fmt.Errorf("user_filter matches several entries for %s", user)
+	}
+	entry := entries[0]
+
+	if err := conn.bind(entry.dn, password); err != nil {
+		if err == errLDAPInvalidCredentials {
+			return Identity{}, ErrInvalidCredentials
+		}
+		return Identity{}, fmt.Errorf("failed to bind as %s: %w", entry.dn, err)
+	}
+	id := Identity{User: user, Groups: entry.values(groupAttr)}
+
+	if c.GroupFilter != "" {
+		if c.BindDN != "" {
+			if err := conn.bind(c.BindDN, c.BindPassword); err != nil {
+				return Identity{}, fmt.Errorf("failed to bind as %s: %w", c.BindDN, err)
+			}
+		}
+		groups, err := conn.search(cmp.Or(c.GroupBaseDN, c.BaseDN), c.groupFilter(user, entry.dn), []string{ldapNoAttributes}, 0)
+		if err != nil {
+			return Identity{}, fmt.Errorf("failed to look up the groups of %s: %w", user, err)
+		}
+		for _, g := range groups {
+			id.Groups = append(id.Groups, g.dn)
+		}
+	}
+	return id, nil
+}
+
+func (c LDAPConfig) dial(ctx context.Context) (*ldapConn, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "389"
+		if u.Scheme == "ldaps" {
+			port = "636"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: c.InsecureSkipVerify}
+
+	ctx, cancel := context.WithTimeout(ctx, ldapTimeout)
+	defer cancel()
+	var d net.Dialer
+	raw, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	conn := &ldapConn{conn: raw}
+	if u.Scheme == "ldaps" {
+		conn.setTLS(tlsConfig)
+	}
+	conn.conn.SetDeadline(time.Now().Add(ldapTimeout))
+	if c.StartTLS {
+		if err := conn.startTLS(tlsConfig); err != nil {
+			conn.conn.Close()
+			return nil, fmt.Errorf("StartTLS failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+var errLDAPInvalidCredentials = errors.New("invalid credentials")
+
+// ldapConn is a connection to an LDAP server, making one request at a time.
+type ldapConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int
+}
+
+func (l *ldapConn) setTLS(cfg *tls.Config) {
+	l.conn = tls.Client(l.conn, cfg)
+	l.reader = bufio.NewReader(l.conn)
+}
+
+func (l *ldapConn) close() {
+	l.send(berString(ldapUnbindRequest, ""))
+	l.conn.Close()
+}
+
+// send writes a request and returns its message ID.
+func (l *ldapConn) send(op []byte) (int, error) {
+	if l.reader == nil {
+		l.reader = bufio.NewReader(l.conn)
+	}
+	l.nextID++
+	_, err := l.conn.Write(tlv(berSequence, berInt(berInteger, l.nextID), op))
+	return l.nextID, err
+}
+
+// receive reads the next message for request id, returning its operation
+// tag and content.
+func (l *ldapConn) receive(id int) (byte, []byte, error) {
+	for {
+		msg, err := readMessage(l.reader)
+		if err != nil {
+			return 0, nil, err
+		}
+		_, body, _, err := readTLV(msg)
+		if err != nil {
+			return 0, nil, err
+		}
+		msgID, body, err := readInt(body)
+		if err != nil {
+			return 0, nil, err
+		}
+		if msgID != id {
+			// Unsolicited notifications, such as a notice of disconnection.
+			if msgID == 0 {
+				return 0, nil, fmt.Errorf("the server closed the connection")
+			}
+			continue
+		}
+		tag, op, _, err := readTLV(body)
+		return tag, op, err
+	}
+}
+
+// ldapResult decodes an LDAPResult, returning an error unless it succeeded.
+func ldapResult(op []byte) (int, error) {
+	code, rest, err := readInt(op)
+	if err != nil {
+		return 0, err
+	}
+	if code == ldapSuccess {
+		return code, nil
+	}
+	_, rest, _ = readString(rest)
+	message, _, _ := readString(rest)
+	if code == ldapInvalidCredentials {
+		return code, errLDAPInvalidCredentials
+	}
+	if message != "" {
+		return code, fmt.Errorf("LDAP error %d: %s", code, message)
+	}
+	return code, fmt.Errorf("LDAP error %d", code)
+}
+
+func (l *ldapConn) startTLS(cfg *tls.Config) error {
+	id, err := l.send(tlv(ldapExtendedRequest, berString(ldapExtendedName, startTLSOID)))
+	if err != nil {
+		return err
+	}
+	tag, op, err := l.receive(id)
+	if err != nil {
+		return err
+	}
+	if tag != ldapExtendedResponse {
+		return fmt.Errorf("unexpected response 0x%02x", tag)
+	}
+	if _, err := ldapResult(op); err != nil {
+		return err
+	}
+	if l.reader.Buffered() > 0 {
+		return fmt.Errorf("unexpected data before the TLS handshake")
+	}
+	l.setTLS(cfg)
+	return nil
+}
+
+func (l *ldapConn) bind(dn, password string) error {
+	id, err := l.send(tlv(ldapBindRequest,
+		berInt(berInteger, 3),
+		berString(berOctetString, dn),
+		berString(ldapSimpleAuth, password),
+	))
+	if err != nil {
+		return err
+	}
+	tag, op, err := l.receive(id)
+	if err != nil {
+		return err
+	}
+	if tag != ldapBindResponse {
+		return fmt.Errorf("unexpected response 0x%02x", tag)
+	}
+	_, err = ldapResult(op)
+	return err
+}
+
+type ldapEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+// values returns the values of an attribute, whose names are
+// case-insensitive.
+func (e ldapEntry) values(attr string) []string {
+	return e.attributes[strings.ToLower(attr)]
+}
+
+// search finds the entries under base matching filter, at most sizeLimit
+// of them unless it is 0.
+func (l *ldapConn) search(base, filter string, attrs []string, sizeLimit int) ([]ldapEntry, error) {
+	compiled, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	var attrList []byte
+	for _, a := range attrs {
+		attrList = append(attrList, berString(berOctetString, a)...)
+	}
+	id, err := l.send(tlv(ldapSearchRequest,
+		berString(berOctetString, base),
+		berInt(berEnumerated, ldapScopeSubtree),
+		berInt(berEnumerated, ldapNeverDerefAliases),
+		berInt(berInteger, sizeLimit),
+		berInt(berInteger, int(ldapTimeout/time.Second)),
+		berBool(false),
+		compiled,
+		tlv(berSequence, attrList),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ldapEntry
+	for {
+		tag, op, err := l.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case ldapSearchEntry:
+			entry, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case ldapSearchDone:
+			if code, err := ldapResult(op); err != nil && code != ldapSizeLimitExceeded {
+				return nil, err
+			}
+			return entries, nil
+		default:
+			// Search result references to other servers are not followed.
+		}
+	}
+}
+
+func parseEntry(op []byte) (ldapEntry, error) {
+	dn, rest, err := readString(op)
+	if err != nil {
+		return ldapEntry{}, err
+	}
+	entry := ldapEntry{dn: dn, attributes: make(map[string][]string)}
+	_, attrs, _, err := readTLV(rest)
+	if err != nil {
+		return ldapEntry{}, err
+	}
+	for len(attrs) > 0 {
+		var attr []byte
+		if _, attr, attrs, err = readTLV(attrs); err != nil {
+			return ldapEntry{}, err
+		}
+		name, rest, err := readString(attr)
+		if err != nil {
+			return ldapEntry{}, err
+		}
+		_, vals, _, err := readTLV(rest)
+		if err != nil {
+			return ldapEntry{}, err
+		}
+		for len(vals) > 0 {
+			var value string
+			if value, vals, err = readString(vals); err != nil {
+				return ldapEntry{}, err
+			}
+			key := strings.ToLower(name)
+			entry.attributes[key] = append(entry.attributes[key], value)
+		}
+	}
+	return entry, nil
+}
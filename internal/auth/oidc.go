@@ -0,0 +1,579 @@
+package auth
+
+import (
+	"cmp"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// clockSkew is how far the provider's clock may be off when checking
+	// ID token times.
+	clockSkew = 2 * time.Minute
+
+	// keysRefresh is the least time between fetches of the provider's keys
+	// for an unknown key ID, as providers rotate them.
+	keysRefresh = time.Minute
+)
+
+var defaultScopes = []string{"openid", "profile", "email"}
+
+// OIDCConfig signs users in with an OpenID Connect provider, such as
+// Keycloak, Authentik, Entra ID or Google, using the authorization code
+// flow. The provider must list the recorder's callback,
+// <server URL>/auth/oidc/callback, as a redirect URI.
+type OIDCConfig struct {
+	// Issuer is the provider's URL, under which
+	// /.well-known/openid-configuration is found.
+	Issuer       string `mapstructure:"issuer" yaml:"issuer,omitempty"`
+	ClientID     string `mapstructure:"client_id" yaml:"client_id,omitempty"`
+	ClientSecret string `mapstructure:"client_secret" yaml:"client_secret,omitempty"`
+	// RedirectURL overrides the callback URL worked out from the request,
+	// for proxies that do not pass on the host and scheme.
+	RedirectURL string   `mapstructure:"redirect_url" yaml:"redirect_url,omitempty"`
+	Scopes      []string `mapstructure:"scopes" yaml:"scopes,omitempty"`
+	// UserClaim names the user (default preferred_username, falling back to
+	// email and sub), and GroupsClaim lists their groups (default groups).
+	UserClaim   string `mapstructure:"user_claim" yaml:"user_claim,omitempty"`
+	GroupsClaim string `mapstructure:"groups_claim" yaml:"groups_claim,omitempty"`
+	// Name is shown on the sign-in button.
+	Name string `mapstructure:"name" yaml:"name,omitempty"`
+}
+
+// Enabled reports whether OIDC sign-in is set up.
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// Validate checks the issuer, client and redirect URLs.
+func (c OIDCConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if u, err := url.Parse(c.Issuer); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("issuer must be an http(s) URL")
+	}
+	if c.ClientID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+	if c.RedirectURL != "" {
+		if u, err := url.Parse(c.RedirectURL); err != nil || !u.IsAbs() {
+			return fmt.Errorf("redirect_url must be an absolute URL")
+		}
+	}
+	return nil
+}
+
+// Login is the state of a sign-in in progress, kept by the browser until
+// the provider sends it back.
+type Login struct {
+	State    string    `json:"s"`
+	Nonce    string    `json:"n"`
+	Verifier string    `json:"v"`
+	Next     string    `json:"x,omitempty"`
+	Expires  time.Time `json:"e"`
+}
+
+// NewLogin starts a sign-in that returns to next.
+func NewLogin(next string, now time.Time) Login {
+	return Login{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: randomString(),
+		Next:     next,
+		Expires:  now.Add(10 * time.Minute),
+	}
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type providerMetadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Provider talks to an OpenID Connect provider. Its metadata and keys are
+// fetched when first needed, so the recorder starts while the provider is
+// down.
+type Provider struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu     sync.Mutex
+	meta   *providerMetadata
+	keys   map[string]crypto.PublicKey
+	keysAt time.Time
+}
+
+// NewProvider creates a provider for cfg.
+func NewProvider(cfg OIDCConfig) *Provider {
+	return &Provider{config: cfg, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Name is the provider's name for the sign-in button.
+func (p *Provider) Name() string {
+	if p.config.Name != "" {
+		return p.config.Name
+	}
+	if u, err := url.Parse(p.config.Issuer); err == nil {
+		return u.Host
+	}
+	return p.config.Issuer
+}
+
+// RedirectURL returns the configured callback URL, or fallback.
+func (p *Provider) RedirectURL(fallback string) string {
+	if p.config.RedirectURL != "" {
+		return p.config.RedirectURL
+	}
+	return fallback
+}
+
+// AuthURL returns the provider's sign-in page for login.
+func (p *Provider) AuthURL(ctx context.Context, login Login, redirectURL string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	challenge := sha256.Sum256([]byte(login.Verifier))
+
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", redirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", login.State)
+	q.Set("nonce", login.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems the code the provider sent back for login, and returns
+// who signed in from the verified ID token.
+func (p *Provider) Exchange(ctx context.Context, login Login, code, redirectURL string) (Identity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {login.Verifier},
+	}
+	basic := p.config.ClientSecret != "" &&
+		(len(meta.TokenAuthMethods) == 0 || slices.Contains(meta.TokenAuthMethods, "client_secret_basic"))
+	if !basic {
+		form.Set("client_id", p.config.ClientID)
+		if p.config.ClientSecret != "" {
+			form.Set("client_secret", p.config.ClientSecret)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	var tokens struct {
+		IDToken     string `json:"id_token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := p.fetchJSON(req, &tokens); err != nil {
+		return Identity{}, fmt.Errorf("failed to redeem the code: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return Identity{}, fmt.Errorf("the provider sent no ID token")
+	}
+
+	claims, err := p.verify(ctx, tokens.IDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if err := p.checkClaims(claims, meta.Issuer, login.Nonce); err != nil {
+		return Identity{}, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	groupsClaim := cmp.Or(p.config.GroupsClaim, "groups")
+	if _, ok := claims[groupsClaim]; !ok && meta.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		// Many providers leave groups out of the ID token.
+		info, err := p.userinfo(ctx, meta.UserinfoEndpoint, tokens.AccessToken)
+		if err != nil {
+			return Identity{}, err
+		}
+		if info["sub"] == claims["sub"] {
+			for key, value := range info {
+				if _, ok := claims[key]; !ok {
+					claims[key] = value
+				}
+			}
+		}
+	}
+
+	var id Identity
+	for _, claim := range []string{cmp.Or(p.config.UserClaim, "preferred_username"), "email", "sub"} {
+		if user, ok := claims[claim].(string); ok && user != "" {
+			id.User = user
+			break
+		}
+	}
+	if id.User == "" {
+		return Identity{}, fmt.Errorf("the ID token names no user")
+	}
+	switch groups := claims[groupsClaim].(type) {
+	case string:
+		id.Groups = []string{groups}
+	case []any:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	}
+	return id, nil
+}
+
+func (p *Provider) checkClaims(claims map[string]any, issuer, nonce string) error {
+	if claims["iss"] != issuer {
+		return fmt.Errorf("issued by %v, not %s", claims["iss"], issuer)
+	}
+	var audience []any
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = []any{aud}
+	case []any:
+		audience = aud
+	}
+	if !slices.Contains(audience, any(p.config.ClientID)) {
+		return fmt.Errorf("not issued to this client")
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return fmt.Errorf("expired")
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(clockSkew)) {
+		return fmt.Errorf("issued in the future; check the clocks")
+	}
+	if claims["nonce"] != nonce {
+		return fmt.Errorf("nonce does not match")
+	}
+	return nil
+}
+
+func (p *Provider) userinfo(ctx context.Context, endpoint, accessToken string) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	var info map[string]any
+	if err := p.fetchJSON(req, &info); err != nil {
+		return nil, fmt.Errorf("failed to fetch user info: %w", err)
+	}
+	return info, nil
+}
+
+func (p *Provider) metadata(ctx context.Context) (*providerMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	endpoint := strings.TrimRight(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta providerMetadata
+	if err := p.fetchJSON(req, &meta); err != nil {
+		return nil, fmt.Errorf("failed to discover the OIDC provider: %w", err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != strings.TrimRight(p.config.Issuer, "/") {
+		return nil, fmt.Errorf("the OIDC provider calls itself %s, not %s", meta.Issuer, p.config.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("the OIDC provider's configuration is incomplete")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+func (p *Provider) fetchJSON(req *http.Request, v any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error != "" {
+			return fmt.Errorf("%s: %s %s", resp.Status, oauthErr.Error, oauthErr.Description)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// verify checks the signature of a JWT against the provider's keys and
+// returns its claims.
+func (p *Provider) verify(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature")
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("malformed token")
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("malformed token: %w", err)
+	}
+	return nil
+}
+
+// key returns the provider's signing key kid, fetching the keys again if
+// it is not known.
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	find := func() (crypto.PublicKey, bool) {
+		if kid == "" && len(p.keys) == 1 {
+			for _, key := range p.keys {
+				return key, true
+			}
+		}
+		key, ok := p.keys[kid]
+		return key, ok
+	}
+	if key, ok := find(); ok {
+		return key, nil
+	}
+	if time.Since(p.keysAt) < keysRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.fetchJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch the OIDC provider's keys: %w", err)
+	}
+	p.keys = make(map[string]crypto.PublicKey)
+	p.keysAt = time.Now()
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			p.keys[k.Kid] = key
+		}
+	}
+	if key, ok := find(); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// jwk is a public key of a JSON Web Key Set (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid key")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31 {
+			return nil, fmt.Errorf("invalid key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+var errBadSignature = errors.New("bad signature")
+
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	digest := func(h hash.Hash) []byte {
+		h.Write(signed)
+		return h.Sum(nil)
+	}
+	var hashed []byte
+	var hashID crypto.Hash
+	switch alg[min(len(alg), 2):] {
+	case "256":
+		hashed, hashID = digest(sha256.New()), crypto.SHA256
+	case "384":
+		hashed, hashID = digest(sha512.New384()), crypto.SHA384
+	case "512":
+		hashed, hashID = digest(sha512.New()), crypto.SHA512
+	}
+
+	switch {
+	case strings.HasPrefix(alg, "RS") && hashed != nil:
+		k, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(k, hashID, hashed, sig) != nil {
+			return errBadSignature
+		}
+	case strings.HasPrefix(alg, "PS") && hashed != nil:
+		k, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPSS(k, hashID, hashed, sig, nil) != nil {
+			return errBadSignature
+		}
+	case strings.HasPrefix(alg, "ES") && hashed != nil:
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig)%2 != 0 {
+			return errBadSignature
+		}
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		if !ecdsa.Verify(k, hashed, r, s) {
+			return errBadSignature
+		}
+	case alg == "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(k, signed, sig) {
+			return errBadSignature
+		}
+	default:
+		// Including "none", which must never be accepted.
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+// Session is a signed-in user, kept in a signed cookie so that sessions
+// survive restarts without being stored.
+type Session struct {
+	User    string    `json:"u"`
+	Role    Role      `json:"r"`
+	Expires time.Time `json:"e"`
+}
+
+// Seal encodes v with an HMAC of key, for a cookie the browser cannot
+// change.
+func Seal(key []byte, v any) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	data := base64.RawURLEncoding.EncodeToString(payload)
+	return data + "." + sign(key, data), nil
+}
+
+// Open checks the HMAC of a value from Seal and decodes it into v.
+func Open(key []byte, token string, v any) error {
+	data, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(key, data))) {
+		return errInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return errInvalidToken
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// OpenSession returns the session of a cookie, if it is valid and has not
+// expired.
+func OpenSession(key []byte, token string, now time.Time) (Session, error) {
+	var sess Session
+	if err := Open(key, token, &sess); err != nil {
+		return Session{}, err
+	}
+	if sess.User == "" || !now.Before(sess.Expires) {
+		return Session{}, errInvalidToken
+	}
+	return sess, nil
+}
+
+func sign(key []byte, data string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,441 @@
+// Package backup archives the recorder's settings - the config file, the
+// SQLite index and uploaded images, but no video - and restores them, so the
+// recorder can move to a new machine without losing its events and settings.
+//
+// A restore is staged next to the config file and applied by ApplyStaged the
+// next time the recorder starts, as the index can't be swapped while open.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	Format = "cam-recorder-backup/1"
+
+	manifestName = "manifest.json"
+	configName   = "config.yaml"
+	indexName    = "index.db"
+	filesPrefix  = "files/"
+
+	// A backup is compressed, so the sizes its entries unpack to are
+	// capped on their own to keep a crafted one from filling the disk.
+	maxManifestSize = 1 << 20
+	maxConfigSize   = 1 << 20
+	maxUploadSize   = 10 << 20
+	maxIndexSize    = 4 << 30
+)
+
+// uploads are the files uploaded through the API that a backup carries,
+// relative to the output directory.
+var uploads = []string{
+	path.Join(storage.WatermarkDir, "logo.png"),
+	path.Join(storage.WatermarkDir, "logo.jpg"),
+	path.Join(storage.MapDir, "floorplan.png"),
+	path.Join(storage.MapDir, "floorplan.jpg"),
+}
+
+// Manifest describes a backup. Files lists the uploads it carries.
+type Manifest struct {
+	Format        string    `json:"format"`
+	CreatedAt     time.Time `json:"created_at"`
+	Version       string    `json:"version"`
+	Host          string    `json:"host,omitempty"`
+	ConfigVersion int       `json:"config_version"`
+	Files         []string  `json:"files"`
+}
+
+// Source is what a backup is taken of.
+type Source struct {
+	ConfigPath string
+	Index      *index.Index
+	OutputDir  string
+	Version    string
+}
+
+// Write writes a gzipped tarball of src to w.
+func Write(w io.Writer, src Source) error {
+	configData, err := os.ReadFile(src.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "cam-recorder-backup-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	snapshot := filepath.Join(tmpDir, indexName)
+	if err := src.Index.Backup(snapshot); err != nil {
+		return err
+	}
+
+	manifest := Manifest{
+		Format:        Format,
+		CreatedAt:     time.Now().UTC(),
+		Version:       src.Version,
+		ConfigVersion: config.CurrentVersion,
+		Files:         []string{},
+	}
+	manifest.Host, _ = os.Hostname()
+	for _, name := range uploads {
+		if _, err := os.Stat(filepath.Join(src.OutputDir, filepath.FromSlash(name))); err == nil {
+			manifest.Files = append(manifest.Files, name)
+		}
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeData(tw, manifestName, manifestData, manifest.CreatedAt); err != nil {
+		return err
+	}
+	if err := writeData(tw, configName, configData, manifest.CreatedAt); err != nil {
+		return err
+	}
+	if err := writeFile(tw, indexName, snapshot); err != nil {
+		return err
+	}
+	for _, name := range manifest.Files {
+		if err := writeFile(tw, filesPrefix+name, filepath.Join(src.OutputDir, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+func writeData(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: modTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func writeFile(tw *tar.Writer, name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", src, err)
+	}
+	header := &tar.Header{Name: name, Mode: 0600, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// StageDir is where a restore of the config at configPath is staged.
+func StageDir(configPath string) string {
+	return configPath + ".restore"
+}
+
+// Stage checks the backup read from r and unpacks it into StageDir, replacing
+// any restore staged before, to be applied by ApplyStaged.
+func Stage(r io.Reader, configPath string) (*Manifest, error) {
+	dir := StageDir(configPath)
+	tmpDir := dir + ".part"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return nil, fmt.Errorf("failed to clear %s: %w", tmpDir, err)
+	}
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", tmpDir, err)
+	}
+
+	manifest, err := extract(r, tmpDir)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, fmt.Errorf("failed to clear %s: %w", dir, err)
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, fmt.Errorf("failed to stage restore: %w", err)
+	}
+	return manifest, nil
+}
+
+// extract unpacks a backup into dir, accepting only the entries a backup
+// holds, and checks its config and index.
+func extract(r io.Reader, dir string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != manifestName {
+		return nil, fmt.Errorf("not a backup: %s must come first", manifestName)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(io.LimitReader(tr, maxManifestSize)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", manifestName, err)
+	}
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("unsupported backup format %q", manifest.Format)
+	}
+	for _, name := range manifest.Files {
+		if !slices.Contains(uploads, name) {
+			return nil, fmt.Errorf("unexpected file %s in backup", name)
+		}
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestName), manifestData, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", manifestName, err)
+	}
+
+	seen := make(map[string]bool)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		name := header.Name
+		upload, isUpload := strings.CutPrefix(name, filesPrefix)
+		switch {
+		case header.Typeflag != tar.TypeReg:
+			return nil, fmt.Errorf("unexpected entry %s in backup", name)
+		case name == configName || name == indexName:
+		case isUpload && slices.Contains(manifest.Files, upload):
+		default:
+			return nil, fmt.Errorf("unexpected entry %s in backup", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate entry %s in backup", name)
+		}
+		seen[name] = true
+		if header.Size > entryLimit(name) {
+			return nil, fmt.Errorf("entry %s in backup is too large", name)
+		}
+
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := copyTo(dst, tr); err != nil {
+			return nil, err
+		}
+	}
+
+	if !seen[configName] || !seen[indexName] {
+		return nil, fmt.Errorf("incomplete backup: %s and %s are required", configName, indexName)
+	}
+	for _, name := range manifest.Files {
+		if !seen[filesPrefix+name] {
+			return nil, fmt.Errorf("incomplete backup: %s is missing", name)
+		}
+	}
+	if _, err := parseConfig(filepath.Join(dir, configName)); err != nil {
+		return nil, fmt.Errorf("invalid config in backup: %w", err)
+	}
+	if err := checkIndex(filepath.Join(dir, indexName)); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// entryLimit is the most a backup entry may unpack to.
+func entryLimit(name string) int64 {
+	switch name {
+	case configName:
+		return maxConfigSize
+	case indexName:
+		return maxIndexSize
+	default:
+		return maxUploadSize
+	}
+}
+
+func parseConfig(p string) (*config.Config, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, err := config.Parse(f, "yaml")
+	if err != nil {
+		return nil, err
+	}
+	if err := config.ValidateCameras(cfg.Cameras); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// checkIndex makes sure the index in a backup is a SQLite database.
+func checkIndex(p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 16)
+	if _, err := io.ReadFull(f, magic); err != nil || string(magic) != "SQLite format 3\x00" {
+		return fmt.Errorf("invalid index in backup: not a SQLite database")
+	}
+	return nil
+}
+
+func copyTo(dst string, r io.Reader) error {
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	return nil
+}
+
+// ApplyStaged applies the restore staged for the config at configPath, if
+// any: the index and config it replaces are kept with a .pre-restore suffix.
+// It must run before the config is loaded and the index opened. Steps already
+// done are skipped, so an interrupted restore finishes on the next start.
+func ApplyStaged(configPath string) (*Manifest, error) {
+	dir := StageDir(configPath)
+	manifestData, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read staged restore: %w", err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to read staged restore: %w", err)
+	}
+
+	stagedConfig := filepath.Join(dir, configName)
+	cfgPath := stagedConfig
+	if _, err := os.Stat(stagedConfig); err != nil {
+		cfgPath = configPath
+	}
+	cfg, err := parseConfig(cfgPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid staged config: %w", err)
+	}
+	outputDir := cfg.Recording.OutputDir
+
+	for _, name := range uploads {
+		if slices.Contains(manifest.Files, name) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(outputDir, filepath.FromSlash(name))); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	for _, name := range manifest.Files {
+		if err := apply(filepath.Join(dir, filesPrefix, filepath.FromSlash(name)), filepath.Join(outputDir, filepath.FromSlash(name)), false); err != nil {
+			return nil, err
+		}
+	}
+
+	indexPath := cfg.IndexPath()
+	if _, err := os.Stat(filepath.Join(dir, indexName)); err == nil {
+		for _, suffix := range []string{"-wal", "-shm"} {
+			if err := os.Remove(indexPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("failed to remove %s: %w", indexPath+suffix, err)
+			}
+		}
+	}
+	if err := apply(filepath.Join(dir, indexName), indexPath, true); err != nil {
+		return nil, err
+	}
+	if err := apply(stagedConfig, configPath, true); err != nil {
+		return nil, err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to remove staged restore: %w", err)
+	}
+	return &manifest, nil
+}
+
+// apply moves the staged file src to dst unless it was moved already,
+// keeping dst as dst.pre-restore when keep is set.
+func apply(src, dst string, keep bool) error {
+	if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if keep {
+		if err := os.Rename(dst, dst+".pre-restore"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to keep %s: %w", dst, err)
+		}
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	// The staged files may be on another filesystem.
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer f.Close()
+	tmp := dst + ".part"
+	if err := copyTo(tmp, f); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace %s: %w", dst, err)
+	}
+	f.Close()
+	return os.Remove(src)
+}
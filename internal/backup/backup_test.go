@@ -0,0 +1,304 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// entry is a file of a crafted backup.
+type entry struct {
+	name     string
+	data     []byte
+	typeflag byte
+	linkname string
+}
+
+// testIndex is enough of a SQLite database for a backup to be accepted.
+var testIndex = []byte("SQLite format 3\x00 and the rest of the pages")
+
+// testLogo and testFloorPlan are uploads a backup may carry.
+var testLogo, testFloorPlan = uploads[0], uploads[2]
+
+func testConfig(outputDir string) []byte {
+	return []byte(`cameras:
+  - name: Front Door
+    rtsp_url: rtsp://camera.local/stream
+recording:
+  output_dir: ` + outputDir + `
+`)
+}
+
+func manifestEntry(t *testing.T, format string, files ...string) entry {
+	t.Helper()
+	if files == nil {
+		files = []string{}
+	}
+	data, err := json.Marshal(Manifest{Format: format, CreatedAt: time.Now(), Host: "old-box", Files: files})
+	if err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	return entry{name: manifestName, data: data}
+}
+
+// validEntries are the entries of a good backup of a recorder recording
+// into outputDir, with a watermark logo.
+func validEntries(t *testing.T, outputDir string) []entry {
+	return []entry{
+		manifestEntry(t, Format, testLogo),
+		{name: configName, data: testConfig(outputDir)},
+		{name: indexName, data: testIndex},
+		{name: filesPrefix + testLogo, data: []byte("logo")},
+	}
+}
+
+func archive(t *testing.T, entries []entry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0600, Size: int64(len(e.data)), Typeflag: e.typeflag, Linkname: e.linkname}
+		if e.typeflag == 0 {
+			header.Typeflag = tar.TypeReg
+		} else {
+			header.Size = 0
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("header %s: %v", e.name, err)
+		}
+		if header.Size > 0 {
+			if _, err := tw.Write(e.data); err != nil {
+				t.Fatalf("write %s: %v", e.name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	return &buf
+}
+
+// with returns the valid entries with the entry of the same name replaced,
+// or added at the end.
+func with(entries []entry, e entry) []entry {
+	out := make([]entry, 0, len(entries)+1)
+	replaced := false
+	for _, old := range entries {
+		if old.name == e.name && !replaced {
+			out = append(out, e)
+			replaced = true
+			continue
+		}
+		out = append(out, old)
+	}
+	if !replaced {
+		out = append(out, e)
+	}
+	return out
+}
+
+func without(entries []entry, name string) []entry {
+	var out []entry
+	for _, e := range entries {
+		if e.name != name {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func TestStage(t *testing.T) {
+	outputDir := t.TempDir()
+	valid := validEntries(t, outputDir)
+	tests := []struct {
+		name    string
+		entries []entry
+		// wantErr is part of the error, or empty if the backup is staged.
+		wantErr string
+	}{
+		{"valid", valid, ""},
+		{"without uploads", []entry{manifestEntry(t, Format), valid[1], valid[2]}, ""},
+		{"manifest not first", append(valid[1:2:2], valid[0], valid[2]), "must come first"},
+		{"unsupported format", with(valid, manifestEntry(t, "cam-recorder-backup/99", testLogo)), "unsupported backup format"},
+		{"traversal", with(valid, entry{name: "../escaped", data: []byte("x")}), "unexpected entry"},
+		{"traversal in files", with(valid, entry{name: filesPrefix + "../../escaped", data: []byte("x")}), "unexpected entry"},
+		{"absolute path", with(valid, entry{name: "/tmp/escaped", data: []byte("x")}), "unexpected entry"},
+		{"traversal in manifest", with(valid, manifestEntry(t, Format, "../../escaped")), "unexpected file"},
+		{"symlink", with(valid, entry{name: configName, typeflag: tar.TypeSymlink, linkname: "/etc/passwd"}), "unexpected entry"},
+		{"hard link", with(valid, entry{name: indexName, typeflag: tar.TypeLink, linkname: configName}), "unexpected entry"},
+		{"directory", with(valid, entry{name: filesPrefix, typeflag: tar.TypeDir}), "unexpected entry"},
+		{"not in the whitelist", with(valid, entry{name: "notes.txt", data: []byte("x")}), "unexpected entry"},
+		{"upload not in the whitelist", with(valid, manifestEntry(t, Format, path.Join(storage.WatermarkDir, "logo.svg"))), "unexpected file"},
+		{"upload not in the manifest", with(valid, entry{name: filesPrefix + testFloorPlan, data: []byte("x")}), "unexpected entry"},
+		{"duplicate", append(valid, valid[1]), "duplicate entry"},
+		{"oversized config", with(valid, entry{name: configName, data: bytes.Repeat([]byte("#"), maxConfigSize+1)}), "too large"},
+		{"oversized upload", with(valid, entry{name: filesPrefix + testLogo, data: make([]byte, maxUploadSize+1)}), "too large"},
+		{"oversized manifest", with(valid, entry{name: manifestName, data: append([]byte(`{"format":"`), make([]byte, maxManifestSize)...)}), "failed to read"},
+		{"missing index", without(valid, indexName), "incomplete backup"},
+		{"missing upload", without(valid, filesPrefix+testLogo), "incomplete backup"},
+		{"index not SQLite", with(valid, entry{name: indexName, data: []byte("not a database")}), "not a SQLite database"},
+		{"invalid config", with(valid, entry{name: configName, data: []byte("cameras:\n  - name: Front Door\n")}), "invalid config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			configPath := filepath.Join(root, "conf", "config.yaml")
+			// A restore staged before must survive a bad backup.
+			previous := filepath.Join(StageDir(configPath), "previous")
+			if err := os.MkdirAll(filepath.Dir(previous), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(previous, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			manifest, err := Stage(archive(t, tt.entries), configPath)
+			if _, statErr := os.Stat(StageDir(configPath) + ".part"); statErr == nil {
+				t.Error("the partial stage was left behind")
+			}
+			if _, statErr := os.Stat(filepath.Join(root, "escaped")); statErr == nil {
+				t.Error("an entry was written outside the stage")
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Stage = %v, want an error with %q", err, tt.wantErr)
+				}
+				if _, err := os.Stat(previous); err != nil {
+					t.Errorf("the restore staged before is gone: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Stage: %v", err)
+			}
+			if manifest.Host != "old-box" {
+				t.Errorf("manifest host %q, want old-box", manifest.Host)
+			}
+			if _, err := os.Stat(previous); err == nil {
+				t.Error("the restore staged before was not replaced")
+			}
+			for _, name := range append([]string{manifestName, configName, indexName}, manifestFiles(manifest)...) {
+				if _, err := os.Stat(filepath.Join(StageDir(configPath), filepath.FromSlash(name))); err != nil {
+					t.Errorf("%s was not staged: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func manifestFiles(m *Manifest) []string {
+	var names []string
+	for _, name := range m.Files {
+		names = append(names, filesPrefix+name)
+	}
+	return names
+}
+
+func TestApplyStaged(t *testing.T) {
+	tests := []struct {
+		name string
+		// interrupt applies the staged index before ApplyStaged, as a restore
+		// interrupted after removing the old WAL and moving it leaves things.
+		interrupt bool
+	}{
+		{"fresh", false},
+		{"interrupted", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			outputDir := filepath.Join(root, "recordings")
+			configPath := filepath.Join(root, "config.yaml")
+			indexPath := filepath.Join(outputDir, indexName)
+			oldConfig := testConfig(outputDir)
+			oldConfig = append(oldConfig, "# before the restore\n"...)
+			writeFiles(t, map[string]string{
+				configPath:         string(oldConfig),
+				indexPath:          "old index",
+				indexPath + "-wal": "old wal",
+				filepath.Join(outputDir, filepath.FromSlash(testFloorPlan)): "old floor plan",
+			})
+
+			if _, err := Stage(archive(t, validEntries(t, outputDir)), configPath); err != nil {
+				t.Fatalf("Stage: %v", err)
+			}
+			if tt.interrupt {
+				if err := os.Remove(indexPath + "-wal"); err != nil {
+					t.Fatal(err)
+				}
+				if err := apply(filepath.Join(StageDir(configPath), indexName), indexPath, true); err != nil {
+					t.Fatalf("apply: %v", err)
+				}
+			}
+
+			manifest, err := ApplyStaged(configPath)
+			if err != nil {
+				t.Fatalf("ApplyStaged: %v", err)
+			}
+			if manifest == nil || manifest.Host != "old-box" {
+				t.Fatalf("ApplyStaged returned %+v, want the staged manifest", manifest)
+			}
+
+			wantFiles(t, map[string]string{
+				configPath:                  string(testConfig(outputDir)),
+				configPath + ".pre-restore": string(oldConfig),
+				indexPath:                   string(testIndex),
+				indexPath + ".pre-restore":  "old index",
+				filepath.Join(outputDir, filepath.FromSlash(testLogo)): "logo",
+				indexPath + "-wal": "",
+				filepath.Join(outputDir, filepath.FromSlash(testFloorPlan)): "",
+				StageDir(configPath): "",
+			})
+
+			// Nothing is left to apply on the next start.
+			if manifest, err := ApplyStaged(configPath); manifest != nil || err != nil {
+				t.Errorf("second ApplyStaged = %v, %v, want nothing", manifest, err)
+			}
+		})
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for p, data := range files {
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// wantFiles checks the content of files, where an empty one must not exist.
+func wantFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for p, want := range files {
+		data, err := os.ReadFile(p)
+		if want == "" {
+			if _, err := os.Stat(p); err == nil {
+				t.Errorf("%s is still there", p)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", p, err)
+		} else if string(data) != want {
+			t.Errorf("%s = %q, want %q", p, data, want)
+		}
+	}
+}
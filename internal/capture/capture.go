@@ -0,0 +1,247 @@
+// Package capture records short bursts of a camera on demand, at the full
+// quality of its stream, with a set of stills taken from them. A burst reads
+// the camera's stream on its own, so it is taken whatever the camera's
+// recording mode, schedule or transcoding.
+package capture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/command"
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	// MaxDuration bounds how long a burst may record.
+	MaxDuration = 2 * time.Minute
+	// MaxSnapshots bounds the stills taken from a burst.
+	MaxSnapshots = 30
+
+	timeLayout    = "20060102_150405"
+	pruneInterval = time.Hour
+	// connectTimeout is how long a burst may take to connect on top of its
+	// duration.
+	connectTimeout = 30 * time.Second
+)
+
+// ErrBusy is returned while a burst of the camera is being recorded.
+var ErrBusy = errors.New("a burst of the camera is already being recorded")
+
+// Config sets what a burst records when the request does not say.
+type Config struct {
+	Duration  time.Duration `mapstructure:"duration" yaml:"duration"`
+	Snapshots int           `mapstructure:"snapshots" yaml:"snapshots"`
+	// RetentionDays is how long bursts are kept; 0 keeps them as long as
+	// the recordings.
+	RetentionDays int `mapstructure:"retention_days" yaml:"retention_days"`
+}
+
+// Validate checks the duration and the number of stills against their bounds.
+func (c Config) Validate() error {
+	if c.Duration < time.Second || c.Duration > MaxDuration {
+		return fmt.Errorf("duration must be between 1s and %s", MaxDuration)
+	}
+	if c.Snapshots < 0 || c.Snapshots > MaxSnapshots {
+		return fmt.Errorf("snapshots must be between 0 and %d", MaxSnapshots)
+	}
+	if c.RetentionDays < 0 {
+		return fmt.Errorf("retention_days must not be negative")
+	}
+	return nil
+}
+
+// Burst is a recorded burst: its clip and stills, by filename.
+type Burst struct {
+	Camera    string    `json:"camera"`
+	StartedAt time.Time `json:"started_at"`
+	Clip      string    `json:"clip"`
+	Snapshots []string  `json:"snapshots"`
+}
+
+type Manager struct {
+	config Config
+	dir    string
+	// retentionDays is the recording retention, for RetentionDays 0.
+	retentionDays int
+
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+// NewManager returns a manager keeping bursts below outputDir, hidden from
+// the recordings.
+func NewManager(cfg Config, outputDir string, retentionDays int) *Manager {
+	return &Manager{
+		config:        cfg,
+		dir:           filepath.Join(outputDir, storage.CaptureDir),
+		retentionDays: retentionDays,
+		busy:          make(map[string]bool),
+	}
+}
+
+func (m *Manager) Config() Config {
+	return m.config
+}
+
+// Start removes bursts past their retention every hour until ctx is done.
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+		for {
+			m.prune(time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Capture records d of the camera's stream from input into a clip and takes
+// snapshots stills spread over it. It returns ErrBusy while another burst of
+// the camera is being recorded.
+func (m *Manager) Capture(ctx context.Context, camera, input string, d time.Duration, snapshots int) (*Burst, error) {
+	m.mu.Lock()
+	if m.busy[camera] {
+		m.mu.Unlock()
+		return nil, ErrBusy
+	}
+	m.busy[camera] = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.busy, camera)
+		m.mu.Unlock()
+	}()
+
+	dir := filepath.Join(m.dir, storage.CameraDirName(camera))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+
+	startedAt := time.Now()
+	name := storage.CameraDirName(camera) + "_" + startedAt.Format(timeLayout)
+	burst := &Burst{
+		Camera:    camera,
+		StartedAt: startedAt,
+		Clip:      name + ".mp4",
+		Snapshots: []string{},
+	}
+	clip := filepath.Join(dir, burst.Clip)
+	log.Printf("[%s] Capturing a %s burst", camera, d)
+	if err := record(ctx, input, clip, startedAt, d); err != nil {
+		return nil, err
+	}
+	for i := range snapshots {
+		offset := d * time.Duration(2*i+1) / time.Duration(2*snapshots)
+		filename := fmt.Sprintf("%s_%02d.jpg", name, i+1)
+		if err := still(ctx, clip, filepath.Join(dir, filename), offset); err != nil {
+			log.Printf("Warning: [%s] Failed to take a still of burst %s: %v", camera, burst.Clip, err)
+			continue
+		}
+		burst.Snapshots = append(burst.Snapshots, filename)
+	}
+	return burst, nil
+}
+
+// record copies the stream into out. Local devices have no stream to copy
+// and are encoded at a high quality instead.
+func record(ctx context.Context, input, out string, startedAt time.Time, d time.Duration) error {
+	src, err := source.Parse(input)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d+connectTimeout)
+	defer cancel()
+
+	args := []string{"-v", "error"}
+	args = append(args, src.InputArgs()...)
+	args = append(args, src.NetworkArgs()...)
+	args = append(args, "-fflags", "+genpts", "-t", fmt.Sprintf("%.3f", d.Seconds()))
+	if src.IsLocal() {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "18", "-pix_fmt", "yuv420p")
+	} else {
+		args = append(args, "-c:v", "copy")
+	}
+	args = append(args,
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-metadata", "creation_time="+startedAt.UTC().Format(time.RFC3339Nano),
+		"-movflags", "+faststart",
+		"-y", out,
+	)
+
+	if output, err := command.Context(ctx, "ffmpeg", args...).CombinedOutput(); err != nil {
+		os.Remove(out)
+		line := strings.ReplaceAll(lastLine(output), input, source.Redact(input))
+		return fmt.Errorf("ffmpeg: %w: %s", err, line)
+	}
+	return nil
+}
+
+// still saves the full-resolution frame at offset in clip as a JPEG.
+func still(ctx context.Context, clip, out string, offset time.Duration) error {
+	output, err := command.Context(ctx, "ffmpeg",
+		"-ss", fmt.Sprintf("%.3f", offset.Seconds()),
+		"-i", clip,
+		"-frames:v", "1",
+		"-q:v", "2",
+		"-y", out,
+	).CombinedOutput()
+	if err != nil {
+		os.Remove(out)
+		return fmt.Errorf("ffmpeg: %w: %s", err, lastLine(output))
+	}
+	return nil
+}
+
+// FilePath returns the path of a clip or still of the camera's bursts.
+func (m *Manager) FilePath(camera, filename string) (string, error) {
+	cam := storage.CameraDirName(camera)
+	if filename != filepath.Base(filename) || !strings.HasPrefix(filename, cam+"_") {
+		return "", fmt.Errorf("invalid capture file")
+	}
+	path := filepath.Join(m.dir, cam, filename)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// prune removes the bursts older than their retention.
+func (m *Manager) prune(now time.Time) {
+	days := m.config.RetentionDays
+	if days == 0 {
+		days = m.retentionDays
+	}
+	cutoff := now.AddDate(0, 0, -days)
+
+	filepath.WalkDir(m.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil {
+				log.Printf("Warning: Failed to remove capture %s: %v", path, err)
+			}
+		}
+		return nil
+	})
+}
+
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return lines[len(lines)-1]
+}
@@ -1,59 +1,850 @@
 package config
 
 import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/lets-vibe/cam-recorder/internal/auth"
+	"github.com/lets-vibe/cam-recorder/internal/capture"
+	"github.com/lets-vibe/cam-recorder/internal/export"
+	"github.com/lets-vibe/cam-recorder/internal/frigate"
+	"github.com/lets-vibe/cam-recorder/internal/i18n"
+	"github.com/lets-vibe/cam-recorder/internal/integrity"
+	"github.com/lets-vibe/cam-recorder/internal/notify"
+	"github.com/lets-vibe/cam-recorder/internal/power"
+	"github.com/lets-vibe/cam-recorder/internal/reconcile"
+	"github.com/lets-vibe/cam-recorder/internal/report"
+	"github.com/lets-vibe/cam-recorder/internal/snmp"
+	"github.com/lets-vibe/cam-recorder/internal/tags"
+	"github.com/lets-vibe/cam-recorder/pkg/camera"
+	"github.com/lets-vibe/cam-recorder/pkg/plugin"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/schedule"
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	ModeContinuous = "continuous"
+	ModeEvents     = "events"
+
+	// StartupConfig starts the cameras marked enabled in the config;
+	// StartupResume restores the running, stopped or paused state each
+	// camera was left in by the API or dashboard.
+	StartupConfig = "config"
+	StartupResume = "resume"
+
+	// DuplicateURLsWarn only warns about cameras with the same stream;
+	// DuplicateURLsShare also records the later ones from the first one's
+	// connection.
+	DuplicateURLsWarn  = "warn"
+	DuplicateURLsShare = "share"
 )
 
 type Config struct {
-	Cameras   []CameraConfig  `mapstructure:"cameras"`
-	Recording RecordingConfig `mapstructure:"recording"`
-	Server    ServerConfig    `mapstructure:"server"`
-	Logging   LoggingConfig   `mapstructure:"logging"`
+	// Version is the schema version of the file; see Migrate.
+	Version       int                 `mapstructure:"version" yaml:"version"`
+	Instance      InstanceConfig      `mapstructure:"instance" yaml:"instance,omitempty"`
+	Cameras       []CameraConfig      `mapstructure:"cameras" yaml:"cameras"`
+	Recording     RecordingConfig     `mapstructure:"recording" yaml:"recording"`
+	Server        ServerConfig        `mapstructure:"server" yaml:"server"`
+	Logging       LoggingConfig       `mapstructure:"logging" yaml:"logging"`
+	Index         IndexConfig         `mapstructure:"index" yaml:"index"`
+	Clock         ClockConfig         `mapstructure:"clock" yaml:"clock"`
+	Notifications NotificationsConfig `mapstructure:"notifications" yaml:"notifications"`
+	Events        EventsConfig        `mapstructure:"events" yaml:"events"`
+	API           APIConfig           `mapstructure:"api" yaml:"api"`
+	Auth          auth.Config         `mapstructure:"auth" yaml:"auth"`
+	Limits        LimitsConfig        `mapstructure:"limits" yaml:"limits"`
+	Timelapse     TimelapseConfig     `mapstructure:"timelapse" yaml:"timelapse"`
+	Security      SecurityConfig      `mapstructure:"security" yaml:"security"`
+	Disk          DiskConfig          `mapstructure:"disk" yaml:"disk"`
+	Kiosk         KioskConfig         `mapstructure:"kiosk" yaml:"kiosk"`
+	Ingest        IngestConfig        `mapstructure:"ingest" yaml:"ingest"`
+	Plugins       PluginsConfig       `mapstructure:"plugins" yaml:"plugins,omitempty"`
+	Watermark     WatermarkConfig     `mapstructure:"watermark" yaml:"watermark"`
+	Export        ExportConfig        `mapstructure:"export" yaml:"export,omitempty"`
+	Integrity     integrity.Config    `mapstructure:"integrity" yaml:"integrity"`
+	Reconcile     reconcile.Config    `mapstructure:"reconcile" yaml:"reconcile"`
+	Capture       capture.Config      `mapstructure:"capture" yaml:"capture"`
+	Replay        ReplayConfig        `mapstructure:"replay" yaml:"replay"`
+	Decode        DecodeConfig        `mapstructure:"decode" yaml:"decode"`
+	Failover      FailoverConfig      `mapstructure:"failover" yaml:"failover"`
+	Restream      RestreamConfig      `mapstructure:"restream" yaml:"restream"`
+	SNMP          snmp.AgentConfig    `mapstructure:"snmp" yaml:"snmp"`
+	Frigate       frigate.Config      `mapstructure:"frigate" yaml:"frigate"`
+	Discovery     DiscoveryConfig     `mapstructure:"discovery" yaml:"discovery,omitempty"`
+	Debug         DebugConfig         `mapstructure:"debug" yaml:"debug"`
+
+	path string
 }
 
 type CameraConfig struct {
-	Name    string `mapstructure:"name"`
-	RTSPURL string `mapstructure:"rtsp_url"`
-	Enabled bool   `mapstructure:"enabled"`
+	Name    string `mapstructure:"name" yaml:"name"`
+	RTSPURL string `mapstructure:"rtsp_url" yaml:"rtsp_url"`
+	// FailoverURL is recorded from while RTSPURL fails, such as the camera's
+	// second network interface or a relay.
+	FailoverURL      string          `mapstructure:"failover_url" yaml:"failover_url,omitempty"`
+	Enabled          bool            `mapstructure:"enabled" yaml:"enabled"`
+	ONVIFURL         string          `mapstructure:"onvif_url" yaml:"onvif_url,omitempty"`
+	ONVIFEvents      bool            `mapstructure:"onvif_events" yaml:"onvif_events,omitempty"`
+	Mode             string          `mapstructure:"mode" yaml:"mode,omitempty"`
+	Schedule         []schedule.Spec `mapstructure:"schedule" yaml:"schedule,omitempty"`
+	DisableLiveAudio bool            `mapstructure:"disable_live_audio" yaml:"disable_live_audio,omitempty"`
+	Timelapse        time.Duration   `mapstructure:"timelapse_interval" yaml:"timelapse_interval,omitempty"`
+	AudioEvents      AudioEvents     `mapstructure:"audio_events" yaml:"audio_events,omitempty"`
+	MotionEvents     MotionEvents    `mapstructure:"motion_events" yaml:"motion_events,omitempty"`
+	// Tags are free-form key=value labels, such as location=garage, that
+	// filter the status, recordings and live views and route notifications.
+	Tags map[string]string `mapstructure:"tags" yaml:"tags,omitempty"`
+	// Position places the camera on the /map page.
+	Position *Position `mapstructure:"position" yaml:"position,omitempty"`
+	// MaxSizeGB caps the space the camera's recordings take, removing its
+	// oldest first. Zero means no cap.
+	MaxSizeGB float64 `mapstructure:"max_size_gb" yaml:"max_size_gb,omitempty"`
+	// Keyframes keeps only the keyframes of the camera's recordings, for
+	// years of coarse footage in little space.
+	Keyframes KeyframesConfig `mapstructure:"keyframes" yaml:"keyframes,omitempty"`
+	// MaxViewers overrides limits.max_viewers_per_camera for the camera.
+	MaxViewers int `mapstructure:"max_viewers" yaml:"max_viewers,omitempty"`
+	// Power switches the camera off and on, by hand or when it hangs.
+	Power power.Config `mapstructure:"power" yaml:"power,omitempty"`
+	// Forward pushes the live stream to analytics or a streaming service
+	// while the camera runs, to rtsp://, rtp://, udp:// (MPEG-TS) or
+	// rtmp:// URLs.
+	Forward []string `mapstructure:"forward" yaml:"forward,omitempty"`
+}
+
+// KeyframesConfig re-encodes a camera's segments older than AfterDays to
+// their keyframes only, about one picture every few seconds. Zero AfterDays
+// keeps only keyframes from the start instead of the full video. A nonzero
+// RetentionDays keeps the camera's recordings that long instead of
+// recording.retention_days.
+type KeyframesConfig struct {
+	Enabled       bool `mapstructure:"enabled" yaml:"enabled"`
+	AfterDays     int  `mapstructure:"after_days" yaml:"after_days"`
+	RetentionDays int  `mapstructure:"retention_days" yaml:"retention_days,omitempty"`
+}
+
+// Validate checks that the keyframes are kept past when they are made.
+func (k KeyframesConfig) Validate() error {
+	if k.AfterDays < 0 {
+		return fmt.Errorf("keyframes.after_days must not be negative")
+	}
+	if k.RetentionDays < 0 {
+		return fmt.Errorf("keyframes.retention_days must not be negative")
+	}
+	if k.Enabled && k.RetentionDays > 0 && k.RetentionDays <= k.AfterDays {
+		return fmt.Errorf("keyframes.retention_days must be more than keyframes.after_days")
+	}
+	return nil
+}
+
+// Position is where a camera is: Lat/Lon on the site plot, and X/Y on the
+// uploaded floor plan as fractions of its width and height from the top
+// left. Zero pairs are unset.
+type Position struct {
+	Lat float64 `mapstructure:"lat" yaml:"lat,omitempty" json:"lat,omitempty"`
+	Lon float64 `mapstructure:"lon" yaml:"lon,omitempty" json:"lon,omitempty"`
+	X   float64 `mapstructure:"x" yaml:"x,omitempty" json:"x,omitempty"`
+	Y   float64 `mapstructure:"y" yaml:"y,omitempty" json:"y,omitempty"`
+}
+
+// Geo reports whether the position has coordinates.
+func (p *Position) Geo() bool {
+	return p != nil && (p.Lat != 0 || p.Lon != 0)
+}
+
+// OnPlan reports whether the position is on the floor plan.
+func (p *Position) OnPlan() bool {
+	return p != nil && (p.X != 0 || p.Y != 0)
+}
+
+// Validate checks that the position is on the globe and the floor plan.
+func (p *Position) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 {
+		return fmt.Errorf("position: lat must be within ±90 and lon within ±180")
+	}
+	if p.X < 0 || p.X > 1 || p.Y < 0 || p.Y > 1 {
+		return fmt.Errorf("position: x and y must be between 0 and 1")
+	}
+	return nil
+}
+
+// DefaultAudioThreshold is the level, in dBFS, above which a noise raises an
+// audio event when audio_events.threshold is not set.
+const DefaultAudioThreshold = -20
+
+// AudioEvents raises "audio" events for noises from the camera's microphone
+// louder than Threshold dBFS and lasting at least MinDuration, such as
+// breaking glass or shouting.
+type AudioEvents struct {
+	Enabled     bool          `mapstructure:"enabled" yaml:"enabled"`
+	Threshold   float64       `mapstructure:"threshold" yaml:"threshold,omitempty"`
+	MinDuration time.Duration `mapstructure:"min_duration" yaml:"min_duration,omitempty"`
+}
+
+// MotionEvents raises "motion" events when the camera's picture changes
+// inside one of the Zones, or anywhere without zones. Sensitivity goes from
+// 1 to 100; zero means camera.DefaultMotionSensitivity. Schedules override
+// both at set times of the week.
+type MotionEvents struct {
+	Enabled     bool                    `mapstructure:"enabled" yaml:"enabled" json:"enabled"`
+	Sensitivity int                     `mapstructure:"sensitivity" yaml:"sensitivity,omitempty" json:"sensitivity,omitempty"`
+	Zones       []camera.MotionZone     `mapstructure:"zones" yaml:"zones,omitempty" json:"zones"`
+	Schedules   []camera.MotionSchedule `mapstructure:"schedules" yaml:"schedules,omitempty" json:"schedules"`
+}
+
+// Validate checks the sensitivity and zones.
+func (m MotionEvents) Validate() error {
+	if m.Sensitivity < 0 || m.Sensitivity > 100 {
+		return fmt.Errorf("motion_events.sensitivity must be between 1 and 100")
+	}
+	for _, zone := range m.Zones {
+		if err := zone.Validate(); err != nil {
+			return fmt.Errorf("motion_events: %w", err)
+		}
+	}
+	for i, s := range m.Schedules {
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("motion_events.schedules %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Recorder returns what the recorder needs to know about the camera.
+func (c CameraConfig) Recorder() recorder.CameraOptions {
+	opts := recorder.CameraOptions{
+		Name:        c.Name,
+		URL:         c.RTSPURL,
+		FailoverURL: c.FailoverURL,
+		Enabled:     c.Enabled,
+		Schedule:    c.Schedule,
+		EventsOnly:  c.Mode == ModeEvents,
+	}
+	if c.Power.Enabled() {
+		opts.PowerCycle = c.Power.Cycle
+		opts.RecoverAfter = c.Power.RecoverAfter
+	}
+	return opts
+}
+
+// MotionTarget returns what the motion monitor needs to watch the camera at
+// url, decoding with hwaccel.
+func (c CameraConfig) MotionTarget(url string, hwaccel recorder.HWAccel) camera.MotionTarget {
+	return camera.MotionTarget{
+		Name:          c.Name,
+		URL:           url,
+		HWAccel:       hwaccel.Type,
+		HWAccelDevice: hwaccel.Device,
+		Sensitivity:   c.MotionEvents.Sensitivity,
+		Zones:         c.MotionEvents.Zones,
+		Schedules:     c.MotionEvents.Schedules,
+	}
+}
+
+// AudioTarget returns what the audio monitor needs to listen to the camera
+// at url.
+func (c CameraConfig) AudioTarget(url string) camera.AudioTarget {
+	threshold := c.AudioEvents.Threshold
+	if threshold == 0 {
+		threshold = DefaultAudioThreshold
+	}
+	return camera.AudioTarget{
+		Name:        c.Name,
+		URL:         url,
+		Threshold:   threshold,
+		MinDuration: c.AudioEvents.MinDuration,
+	}
 }
 
 type RecordingConfig struct {
-	SegmentDuration time.Duration `mapstructure:"segment_duration"`
-	RetentionDays   int           `mapstructure:"retention_days"`
-	OutputDir       string        `mapstructure:"output_dir"`
-	Format          string        `mapstructure:"format"`
+	storage.Options `mapstructure:",squash" yaml:",inline"`
+	ScrubProxies    bool                      `mapstructure:"scrub_proxies" yaml:"scrub_proxies"`
+	Startup         string                    `mapstructure:"startup" yaml:"startup"`
+	DuplicateURLs   string                    `mapstructure:"duplicate_urls" yaml:"duplicate_urls"`
+	ColdTier        ColdTierConfig            `mapstructure:"cold_tier" yaml:"cold_tier"`
+	StaticScenes    StaticScenesConfig        `mapstructure:"static_scenes" yaml:"static_scenes"`
+	Retry           recorder.RetryPolicy      `mapstructure:"retry" yaml:"retry"`
+	Adaptive        recorder.AdaptiveSegments `mapstructure:"adaptive_segments" yaml:"adaptive_segments"`
+	DualMode        recorder.DualMode         `mapstructure:"dual_mode" yaml:"dual_mode"`
+}
+
+// ColdTierConfig re-encodes segments older than AfterDays at a lower
+// resolution and quality to free space while keeping them until retention
+// removes them. Zero AfterDays turns it off.
+type ColdTierConfig struct {
+	AfterDays int `mapstructure:"after_days" yaml:"after_days"`
+	Height    int `mapstructure:"height" yaml:"height"`
+	CRF       int `mapstructure:"crf" yaml:"crf"`
+}
+
+// StaticScenesConfig marks segments in which the picture barely changes, such
+// as a quiet night, so they can be removed after RetentionDays instead of the
+// recording retention. With KeepThumbnail a still of each removed segment is
+// kept until the recording retention ends. Zero RetentionDays only marks them.
+type StaticScenesConfig struct {
+	Detect        bool    `mapstructure:"detect" yaml:"detect"`
+	Threshold     float64 `mapstructure:"threshold" yaml:"threshold"`
+	RetentionDays int     `mapstructure:"retention_days" yaml:"retention_days"`
+	KeepThumbnail bool    `mapstructure:"keep_thumbnail" yaml:"keep_thumbnail"`
 }
 
 type ServerConfig struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
+	Host         string       `mapstructure:"host" yaml:"host"`
+	Port         int          `mapstructure:"port" yaml:"port"`
+	BasePath     string       `mapstructure:"base_path" yaml:"base_path,omitempty"`
+	Language     string       `mapstructure:"language" yaml:"language,omitempty"`
+	CORS         CORSConfig   `mapstructure:"cors" yaml:"cors,omitempty"`
+	AllowedCIDRs NetworkRules `mapstructure:"allowed_cidrs" yaml:"allowed_cidrs,omitempty"`
+	DeniedCIDRs  NetworkRules `mapstructure:"denied_cidrs" yaml:"denied_cidrs,omitempty"`
+	// AccessLog logs every request, as AccessLogText or AccessLogJSON;
+	// empty turns it off.
+	AccessLog string `mapstructure:"access_log" yaml:"access_log,omitempty"`
+	// RequestIDs tags every request with an X-Request-ID, kept from a
+	// trusted proxy or made up, and writes it to the access log.
+	RequestIDs bool `mapstructure:"request_ids" yaml:"request_ids"`
+	// Gzip compresses JSON, HTML and other text responses.
+	Gzip bool `mapstructure:"gzip" yaml:"gzip"`
+	// SecurityHeaders sends nosniff, a same-origin referrer policy and,
+	// outside live streams, SAMEORIGIN framing.
+	SecurityHeaders bool `mapstructure:"security_headers" yaml:"security_headers"`
+}
+
+// Access log formats.
+const (
+	AccessLogText = "text"
+	AccessLogJSON = "json"
+)
+
+// NetworkRules lists networks (CIDRs or single addresses) per area of the web
+// server, so for example live streams can be reachable from anywhere while the
+// dashboard and API stay on the LAN.
+type NetworkRules struct {
+	Dashboard []string `mapstructure:"dashboard" yaml:"dashboard,omitempty"`
+	API       []string `mapstructure:"api" yaml:"api,omitempty"`
+	Live      []string `mapstructure:"live" yaml:"live,omitempty"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string      `mapstructure:"allowed_origins" yaml:"allowed_origins,omitempty"`
+	AllowCredentials bool          `mapstructure:"allow_credentials" yaml:"allow_credentials,omitempty"`
+	MaxAge           time.Duration `mapstructure:"max_age" yaml:"max_age,omitempty"`
 }
 
 type LoggingConfig struct {
-	Level string `mapstructure:"level"`
+	Level string `mapstructure:"level" yaml:"level"`
+	File  string `mapstructure:"file" yaml:"file,omitempty"`
+}
+
+// InstanceConfig identifies this recorder in the metadata of its segments
+// and in the index, so footage gathered from several recorders can be
+// traced back to the one that recorded it.
+type InstanceConfig struct {
+	// ID defaults to the host name, which in a container changes with it.
+	ID   string `mapstructure:"id" yaml:"id,omitempty"`
+	Site string `mapstructure:"site" yaml:"site,omitempty"`
+}
+
+// Origin is what segments are tagged with.
+func (c InstanceConfig) Origin() recorder.Origin {
+	id := c.ID
+	if id == "" {
+		id, _ = os.Hostname()
+	}
+	return recorder.Origin{Instance: id, Site: c.Site}
+}
+
+func (c InstanceConfig) validate() error {
+	for name, value := range map[string]string{"id": c.ID, "site": c.Site} {
+		if len(value) > 128 {
+			return fmt.Errorf("%s must be at most 128 characters", name)
+		}
+		if strings.ContainsFunc(value, unicode.IsControl) {
+			return fmt.Errorf("%s must not contain control characters", name)
+		}
+	}
+	return nil
+}
+
+type IndexConfig struct {
+	Path string `mapstructure:"path" yaml:"path"`
+}
+
+type NotificationsConfig struct {
+	Push     PushConfig      `mapstructure:"push" yaml:"push"`
+	Throttle notify.Throttle `mapstructure:"throttle" yaml:"throttle"`
+	Routes   []notify.Route  `mapstructure:"routes" yaml:"routes,omitempty"`
+	Reports  report.Schedule `mapstructure:"reports" yaml:"reports"`
+}
+
+type PushConfig struct {
+	Enabled bool   `mapstructure:"enabled" yaml:"enabled"`
+	Subject string `mapstructure:"subject" yaml:"subject"`
+}
+
+type EventsConfig struct {
+	RecordDuration time.Duration `mapstructure:"record_duration" yaml:"record_duration"`
+	Token          string        `mapstructure:"token" yaml:"token,omitempty"`
+}
+
+type TimelapseConfig struct {
+	OutputDir     string `mapstructure:"output_dir" yaml:"output_dir"`
+	FPS           int    `mapstructure:"fps" yaml:"fps"`
+	Weekly        bool   `mapstructure:"weekly" yaml:"weekly"`
+	RetentionDays int    `mapstructure:"retention_days" yaml:"retention_days"`
+}
+
+type LimitsConfig struct {
+	MaxTranscodes        int     `mapstructure:"max_transcodes" yaml:"max_transcodes"`
+	Overflow             string  `mapstructure:"overflow" yaml:"overflow"`
+	MaxPreviewsPerCamera int     `mapstructure:"max_previews_per_camera" yaml:"max_previews_per_camera"`
+	MaxCPUPercent        float64 `mapstructure:"max_cpu_percent" yaml:"max_cpu_percent"`
+	MaxRSSMB             int     `mapstructure:"max_rss_mb" yaml:"max_rss_mb"`
+	// MaxViewersPerCamera caps the people watching a camera live at once,
+	// and MaxStreamsPerUser the live streams one user or address has open.
+	// Zero means no cap.
+	MaxViewersPerCamera int `mapstructure:"max_viewers_per_camera" yaml:"max_viewers_per_camera"`
+	MaxStreamsPerUser   int `mapstructure:"max_streams_per_user" yaml:"max_streams_per_user"`
+	// LiveWriteTimeout drops a live viewer whose connection takes longer
+	// than this to accept a frame. LiveIdleTimeout ends a live view that has
+	// had no frame to send for this long; zero waits for the camera forever.
+	LiveWriteTimeout time.Duration `mapstructure:"live_write_timeout" yaml:"live_write_timeout"`
+	LiveIdleTimeout  time.Duration `mapstructure:"live_idle_timeout" yaml:"live_idle_timeout"`
+}
+
+type SecurityConfig struct {
+	RateLimit       int           `mapstructure:"rate_limit" yaml:"rate_limit"`
+	RateBurst       int           `mapstructure:"rate_burst" yaml:"rate_burst"`
+	MaxAuthFailures int           `mapstructure:"max_auth_failures" yaml:"max_auth_failures"`
+	FailureWindow   time.Duration `mapstructure:"failure_window" yaml:"failure_window"`
+	LockoutDuration time.Duration `mapstructure:"lockout_duration" yaml:"lockout_duration"`
+	TrustedProxies  []string      `mapstructure:"trusted_proxies" yaml:"trusted_proxies,omitempty"`
+}
+
+// DiskConfig controls write-latency sampling of the recordings disk. A probe
+// slower than StallThreshold counts as a stall; StallCount stalls in a row
+// raise a storage alert and, with SpoolDir set, send new segments there until
+// the disk recovers.
+type DiskConfig struct {
+	storage.DiskOptions `mapstructure:",squash" yaml:",inline"`
+	SpoolDir            string              `mapstructure:"spool_dir" yaml:"spool_dir,omitempty"`
+	SMARTInterval       time.Duration       `mapstructure:"smart_interval" yaml:"smart_interval"`
+	RAMBuffer           RAMBufferConfig     `mapstructure:"ram_buffer" yaml:"ram_buffer"`
+	Fsync               storage.SyncOptions `mapstructure:"fsync" yaml:"fsync"`
+}
+
+// RAMBufferConfig spares flash storage such as SD cards the steady trickle
+// of writes of recording. With Dir set, usually on a tmpfs, segments are
+// recorded there and moved to the recordings directory every FlushInterval.
+// Once the buffer holds MaxSizeMB, segments are recorded straight to the
+// recordings directory and a flush starts at once.
+type RAMBufferConfig struct {
+	Dir           string        `mapstructure:"dir" yaml:"dir,omitempty"`
+	FlushInterval time.Duration `mapstructure:"flush_interval" yaml:"flush_interval"`
+	MaxSizeMB     int           `mapstructure:"max_size_mb" yaml:"max_size_mb"`
+}
+
+// KioskConfig serves a live-only camera grid at /kiosk for wall displays.
+// With a token set the page and its streams require ?token=; without one
+// anyone who can reach the server may watch.
+type KioskConfig struct {
+	Enabled bool     `mapstructure:"enabled" yaml:"enabled"`
+	Token   string   `mapstructure:"token" yaml:"token,omitempty"`
+	Cameras []string `mapstructure:"cameras" yaml:"cameras,omitempty"`
+	Columns int      `mapstructure:"columns" yaml:"columns,omitempty"`
+}
+
+// IngestConfig controls the shared camera connection. With Shared set,
+// recording, previews and detectors read one relayed stream per camera.
+type IngestConfig struct {
+	Shared bool `mapstructure:"shared" yaml:"shared"`
+}
+
+// ReplayConfig keeps the last Buffer of every enabled camera for
+// /api/replay; zero turns the buffer off. Each camera needs a connection of
+// its own for it unless ingest.shared is on.
+type ReplayConfig struct {
+	Buffer time.Duration `mapstructure:"buffer" yaml:"buffer"`
+}
+
+// DecodeConfig picks hardware decoding, separately from encoding, for the
+// pipelines that decode camera video only to look at it: live MJPEG previews,
+// and detection (detector plugins and static scene analysis). The HLS view
+// passes camera video through without decoding it.
+type DecodeConfig struct {
+	Preview   recorder.HWAccel `mapstructure:"preview" yaml:"preview"`
+	Detection recorder.HWAccel `mapstructure:"detection" yaml:"detection"`
+}
+
+// Failover roles. Both instances of a pair record the same cameras to shared
+// storage, but only the one holding the lease does at a time.
+const (
+	FailoverActive  = "active"
+	FailoverStandby = "standby"
+)
+
+// FailoverConfig pairs this instance with another recording the same cameras
+// to the same recordings directory. An empty Role turns failover off. The
+// standby polls the Peer's /api/failover as a heartbeat and takes over once
+// the peer has not answered as active for TakeoverAfter and its lease on the
+// recordings directory has gone unrenewed as long.
+type FailoverConfig struct {
+	Role string `mapstructure:"role" yaml:"role,omitempty"`
+	// Name identifies the instance in the lease; empty uses the host name.
+	Name string `mapstructure:"name" yaml:"name,omitempty"`
+	// Peer is the base URL of the other instance, with credentials in it if
+	// a proxy in front of it asks for them.
+	Peer              string        `mapstructure:"peer" yaml:"peer,omitempty"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval" yaml:"heartbeat_interval"`
+	TakeoverAfter     time.Duration `mapstructure:"takeover_after" yaml:"takeover_after"`
+}
+
+// RestreamConfig republishes every enabled camera over RTSP at
+// rtsp://host<Listen>/<camera>, so other NVRs and analytics read the recorder
+// instead of cameras that allow only one client. With Username set readers
+// must log in with it and Password.
+type RestreamConfig struct {
+	Enabled  bool   `mapstructure:"enabled" yaml:"enabled"`
+	Listen   string `mapstructure:"listen" yaml:"listen"`
+	Username string `mapstructure:"username" yaml:"username,omitempty"`
+	Password string `mapstructure:"password" yaml:"password,omitempty"`
+}
+
+// DiscoveryConfig tunes how cameras are found. RTSPPaths is a JSON file of
+// vendor and model RTSP paths that extends the built-in database; see
+// camera.LoadPathDB.
+type DiscoveryConfig struct {
+	RTSPPaths string `mapstructure:"rtsp_paths" yaml:"rtsp_paths,omitempty"`
+}
+
+// DebugConfig helps track down leaks in long-running instances. Pprof serves
+// Go's profiler at /debug/pprof/, which like /api/debug/runtime requires one
+// of api.keys. Every LeakCheckInterval the goroutines are counted by what
+// started them, and groups that keep growing are logged; zero turns that off.
+type DebugConfig struct {
+	Pprof             bool          `mapstructure:"pprof" yaml:"pprof"`
+	LeakCheckInterval time.Duration `mapstructure:"leak_check_interval" yaml:"leak_check_interval"`
+}
+
+// WatermarkConfig is stamped onto exports and shared clips that ask for a
+// watermark; the recordings themselves are never changed. Without Logo, a
+// logo uploaded through the API is used.
+type WatermarkConfig struct {
+	Text     string `mapstructure:"text" yaml:"text,omitempty"`
+	Logo     string `mapstructure:"logo" yaml:"logo,omitempty"`
+	Position string `mapstructure:"position" yaml:"position"`
+	FontSize int    `mapstructure:"font_size" yaml:"font_size"`
+}
+
+// ExportConfig sets what /api/export adds for other surveillance software
+// by default; the request can ask for either with metadata= and sidecar=.
+type ExportConfig struct {
+	// Site names the installation in embedded metadata and sidecars.
+	Site string `mapstructure:"site" yaml:"site,omitempty"`
+	// Metadata embeds the creation time, camera, site and location into
+	// copies of the exported files.
+	Metadata bool `mapstructure:"metadata" yaml:"metadata,omitempty"`
+	// Sidecars are the formats ("json", "xml") of a metadata file written
+	// next to each exported clip.
+	Sidecars []string `mapstructure:"sidecars" yaml:"sidecars,omitempty"`
+}
+
+// PluginsConfig enables notifier and detector plugins. See package plugin.
+type PluginsConfig struct {
+	Notifiers []PluginConfig `mapstructure:"notifiers" yaml:"notifiers,omitempty"`
+	Detectors []PluginConfig `mapstructure:"detectors" yaml:"detectors,omitempty"`
+}
+
+// PluginConfig sets up one plugin: a compiled-in one by its type, or an
+// external program by its exec path.
+type PluginConfig struct {
+	Name    string         `mapstructure:"name" yaml:"name"`
+	Type    string         `mapstructure:"type" yaml:"type,omitempty"`
+	Exec    string         `mapstructure:"exec" yaml:"exec,omitempty"`
+	Args    []string       `mapstructure:"args" yaml:"args,omitempty"`
+	Cameras []string       `mapstructure:"cameras" yaml:"cameras,omitempty"`
+	Config  map[string]any `mapstructure:"config" yaml:"config,omitempty"`
+}
+
+func validateThrottle(t notify.Throttle, notifiers []PluginConfig) error {
+	if t.DedupeWindow < 0 {
+		return fmt.Errorf("notifications.throttle.dedupe_window must not be negative")
+	}
+	for kind, interval := range t.MinInterval {
+		if !notify.ValidKind(kind) {
+			return fmt.Errorf("notifications.throttle.min_interval: unknown kind %q", kind)
+		}
+		if interval < 0 {
+			return fmt.Errorf("notifications.throttle.min_interval.%s must not be negative", kind)
+		}
+	}
+
+	channels := notificationChannels(notifiers)
+	for i, q := range t.QuietHours {
+		for _, channel := range q.Channels {
+			if !slices.Contains(channels, channel) {
+				return fmt.Errorf("notifications.throttle.quiet_hours %d: unknown channel %q", i+1, channel)
+			}
+		}
+		for _, kind := range q.Kinds {
+			if !notify.ValidKind(kind) {
+				return fmt.Errorf("notifications.throttle.quiet_hours %d: unknown kind %q", i+1, kind)
+			}
+		}
+		if _, err := schedule.Parse([]schedule.Spec{q.Spec}); err != nil {
+			return fmt.Errorf("notifications.throttle.quiet_hours %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validateRoutes(routes []notify.Route, notifiers []PluginConfig) error {
+	channels := notificationChannels(notifiers)
+	for i, r := range routes {
+		if len(r.Channels) == 0 {
+			return fmt.Errorf("notifications.routes %d: channels are required", i+1)
+		}
+		for _, channel := range r.Channels {
+			if !slices.Contains(channels, channel) {
+				return fmt.Errorf("notifications.routes %d: unknown channel %q", i+1, channel)
+			}
+		}
+		if err := tags.Validate(r.Tags); err != nil {
+			return fmt.Errorf("notifications.routes %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validateReports(r report.Schedule, notifiers []PluginConfig) error {
+	if err := r.Validate(); err != nil {
+		return fmt.Errorf("notifications.reports: %w", err)
+	}
+	channels := notificationChannels(notifiers)
+	for _, channel := range r.Channels {
+		if !slices.Contains(channels, channel) {
+			return fmt.Errorf("notifications.reports: unknown channel %q", channel)
+		}
+	}
+	return nil
+}
+
+// notificationChannels lists the notifier names: web push and the plugins.
+func notificationChannels(notifiers []PluginConfig) []string {
+	channels := []string{"webpush"}
+	for _, p := range notifiers {
+		channels = append(channels, p.Name)
+	}
+	return channels
+}
+
+// Notifier creates the notifier plugin.
+func (p PluginConfig) Notifier() (plugin.Notifier, error) {
+	if p.Exec != "" {
+		return plugin.NewExecNotifier(p.execOptions()), nil
+	}
+	return plugin.NewNotifier(p.Type, p.Name, p.Config)
+}
+
+// Detector creates the detector plugin.
+func (p PluginConfig) Detector() (plugin.Detector, error) {
+	if p.Exec != "" {
+		return plugin.NewExecDetector(p.execOptions()), nil
+	}
+	return plugin.NewDetector(p.Type, p.Name, p.Config)
+}
+
+func (p PluginConfig) execOptions() plugin.ExecOptions {
+	return plugin.ExecOptions{Name: p.Name, Command: p.Exec, Args: p.Args, Config: p.Config}
+}
+
+type APIConfig struct {
+	Keys []string `mapstructure:"keys" yaml:"keys,omitempty"`
+}
+
+type ClockConfig struct {
+	CheckInterval time.Duration `mapstructure:"check_interval" yaml:"check_interval"`
+	MaxDrift      time.Duration `mapstructure:"max_drift" yaml:"max_drift"`
+	// Timeout bounds each way of reading a camera's clock, ONVIF and RTSP.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
+}
+
+func (c ClockConfig) Validate() error {
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	return nil
 }
 
 func Load(configPath string) (*Config, error) {
 	v := viper.New()
 
-	v.SetConfigFile(configPath)
 	v.SetConfigType("yaml")
 
+	setDefaults(v)
+
+	data, err := migrateFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	cfg, err := unmarshal(v)
+	if err != nil {
+		return nil, err
+	}
+	cfg.path = configPath
+
+	return cfg, nil
+}
+
+func Parse(r io.Reader, configType string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigType(configType)
+
+	setDefaults(v)
+
+	if configType == "yaml" {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+		if data, _, err = Migrate(data); err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	if err := v.ReadConfig(r); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	return unmarshal(v)
+}
+
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("version", CurrentVersion)
 	v.SetDefault("cameras", []CameraConfig{})
 	v.SetDefault("recording.segment_duration", "5m")
 	v.SetDefault("recording.retention_days", 7)
 	v.SetDefault("recording.output_dir", "./recordings")
 	v.SetDefault("recording.format", "mp4")
+	v.SetDefault("recording.align_to_clock", false)
+	v.SetDefault("recording.scrub_proxies", true)
+	v.SetDefault("recording.startup", StartupConfig)
+	v.SetDefault("recording.duplicate_urls", DuplicateURLsWarn)
+	v.SetDefault("recording.cold_tier.after_days", 0)
+	v.SetDefault("recording.cold_tier.height", 480)
+	v.SetDefault("recording.cold_tier.crf", 32)
+	v.SetDefault("recording.static_scenes.detect", false)
+	v.SetDefault("recording.static_scenes.threshold", 0.02)
+	v.SetDefault("recording.static_scenes.retention_days", 0)
+	v.SetDefault("recording.static_scenes.keep_thumbnail", true)
+	v.SetDefault("recording.retry.initial_delay", recorder.DefaultRetryPolicy.InitialDelay)
+	v.SetDefault("recording.retry.max_delay", recorder.DefaultRetryPolicy.MaxDelay)
+	v.SetDefault("recording.retry.multiplier", recorder.DefaultRetryPolicy.Multiplier)
+	v.SetDefault("recording.retry.jitter", recorder.DefaultRetryPolicy.Jitter)
+	v.SetDefault("recording.retry.max_retry_window", recorder.DefaultRetryPolicy.MaxRetryWindow)
+	v.SetDefault("recording.retry.probe_interval", recorder.DefaultRetryPolicy.ProbeInterval)
+	v.SetDefault("recording.adaptive_segments.enabled", false)
+	v.SetDefault("recording.adaptive_segments.min_duration", recorder.DefaultAdaptiveSegments.MinDuration)
+	v.SetDefault("recording.adaptive_segments.max_duration", recorder.DefaultAdaptiveSegments.MaxDuration)
+	v.SetDefault("recording.adaptive_segments.window", recorder.DefaultAdaptiveSegments.Window)
+	v.SetDefault("recording.adaptive_segments.busy_events", recorder.DefaultAdaptiveSegments.BusyEvents)
+	v.SetDefault("recording.dual_mode.enabled", false)
+	v.SetDefault("recording.dual_mode.max_attempts", recorder.DefaultDualMode.MaxAttempts)
+	v.SetDefault("recording.dual_mode.retry_delay", recorder.DefaultDualMode.RetryDelay)
+	v.SetDefault("ingest.shared", false)
+	v.SetDefault("replay.buffer", 0)
+	v.SetDefault("failover.heartbeat_interval", 5*time.Second)
+	v.SetDefault("failover.takeover_after", 30*time.Second)
+	v.SetDefault("restream.enabled", false)
+	v.SetDefault("restream.listen", ":8554")
+	v.SetDefault("snmp.enabled", false)
+	v.SetDefault("snmp.listen", ":161")
+	v.SetDefault("frigate.topic_prefix", "frigate")
+	v.SetDefault("frigate.client_id", "cam-recorder")
+	v.SetDefault("debug.pprof", false)
+	v.SetDefault("debug.leak_check_interval", 10*time.Minute)
+	v.SetDefault("integrity.check_at", "03:00")
+	v.SetDefault("reconcile.interval", 24*time.Hour)
+	v.SetDefault("reconcile.orphans", reconcile.OrphansAdopt)
+	v.SetDefault("capture.duration", 10*time.Second)
+	v.SetDefault("capture.snapshots", 5)
+	v.SetDefault("capture.retention_days", 0)
+	v.SetDefault("watermark.position", recorder.WatermarkBottomRight)
+	v.SetDefault("watermark.font_size", 24)
 	v.SetDefault("server.host", "0.0.0.0")
 	v.SetDefault("server.port", 8080)
+	v.SetDefault("server.cors.max_age", "10m")
+	v.SetDefault("server.request_ids", true)
+	v.SetDefault("server.gzip", true)
+	v.SetDefault("server.security_headers", false)
 	v.SetDefault("logging.level", "info")
+	v.SetDefault("index.path", "")
+	v.SetDefault("clock.check_interval", "1h")
+	v.SetDefault("clock.max_drift", "5s")
+	v.SetDefault("clock.timeout", "10s")
+	v.SetDefault("notifications.push.enabled", false)
+	v.SetDefault("notifications.push.subject", "mailto:admin@localhost")
+	v.SetDefault("notifications.throttle.dedupe_window", 10*time.Minute)
+	v.SetDefault("notifications.throttle.min_interval.offline", 5*time.Minute)
+	v.SetDefault("notifications.reports.at", "08:00")
+	v.SetDefault("notifications.reports.weekday", "mon")
+	v.SetDefault("events.record_duration", "1m")
+	v.SetDefault("limits.max_transcodes", 0)
+	v.SetDefault("timelapse.output_dir", "./timelapse")
+	v.SetDefault("timelapse.fps", 24)
+	v.SetDefault("timelapse.weekly", true)
+	v.SetDefault("timelapse.retention_days", 0)
+	v.SetDefault("limits.overflow", "copy")
+	v.SetDefault("limits.max_previews_per_camera", 2)
+	v.SetDefault("limits.max_cpu_percent", 0)
+	v.SetDefault("limits.max_rss_mb", 0)
+	v.SetDefault("limits.max_viewers_per_camera", 0)
+	v.SetDefault("limits.max_streams_per_user", 0)
+	v.SetDefault("limits.live_write_timeout", 10*time.Second)
+	v.SetDefault("limits.live_idle_timeout", time.Minute)
+	v.SetDefault("auth.session_duration", auth.DefaultSessionDuration)
+	v.SetDefault("security.rate_limit", 300)
+	v.SetDefault("security.rate_burst", 60)
+	v.SetDefault("security.max_auth_failures", 5)
+	v.SetDefault("security.failure_window", "15m")
+	v.SetDefault("security.lockout_duration", "15m")
+	v.SetDefault("disk.sample_interval", "30s")
+	v.SetDefault("disk.stall_threshold", "2s")
+	v.SetDefault("disk.stall_count", 3)
+	v.SetDefault("disk.smart_interval", 0)
+	v.SetDefault("disk.ram_buffer.flush_interval", 15*time.Minute)
+	v.SetDefault("disk.ram_buffer.max_size_mb", 256)
+	v.SetDefault("disk.fsync.policy", storage.SyncOff)
+	v.SetDefault("disk.fsync.interval", time.Minute)
+	v.SetDefault("disk.fsync.dirs", false)
+}
 
-	if err := v.ReadInConfig(); err != nil {
-		return nil, err
-	}
-
+func unmarshal(v *viper.Viper) (*Config, error) {
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, err
@@ -65,5 +856,656 @@ func Load(configPath string) (*Config, error) {
 		}
 	}
 
+	cfg.Server.BasePath = normalizeBasePath(cfg.Server.BasePath)
+
+	for name, list := range map[string][]string{
+		"server.allowed_cidrs.dashboard": cfg.Server.AllowedCIDRs.Dashboard,
+		"server.allowed_cidrs.api":       cfg.Server.AllowedCIDRs.API,
+		"server.allowed_cidrs.live":      cfg.Server.AllowedCIDRs.Live,
+		"server.denied_cidrs.dashboard":  cfg.Server.DeniedCIDRs.Dashboard,
+		"server.denied_cidrs.api":        cfg.Server.DeniedCIDRs.API,
+		"server.denied_cidrs.live":       cfg.Server.DeniedCIDRs.Live,
+	} {
+		if _, err := ParseCIDRs(list); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+
+	if cfg.Server.Language != "" {
+		if _, ok := i18n.Lookup(cfg.Server.Language); !ok {
+			return nil, fmt.Errorf("unsupported server.language %q", cfg.Server.Language)
+		}
+	}
+	switch cfg.Server.AccessLog {
+	case "", AccessLogText, AccessLogJSON:
+	default:
+		return nil, fmt.Errorf("invalid server.access_log %q: must be %q or %q", cfg.Server.AccessLog, AccessLogText, AccessLogJSON)
+	}
+
+	if err := validatePlugins("plugins.notifiers", cfg.Plugins.Notifiers, plugin.Notifiers()); err != nil {
+		return nil, err
+	}
+	if err := validatePlugins("plugins.detectors", cfg.Plugins.Detectors, plugin.Detectors()); err != nil {
+		return nil, err
+	}
+	if err := validateRoutes(cfg.Notifications.Routes, cfg.Plugins.Notifiers); err != nil {
+		return nil, err
+	}
+	if err := validateThrottle(cfg.Notifications.Throttle, cfg.Plugins.Notifiers); err != nil {
+		return nil, err
+	}
+	if err := validateReports(cfg.Notifications.Reports, cfg.Plugins.Notifiers); err != nil {
+		return nil, err
+	}
+
+	if cfg.Kiosk.Columns < 0 {
+		return nil, fmt.Errorf("kiosk.columns must not be negative")
+	}
+
+	if cfg.Recording.Startup != StartupConfig && cfg.Recording.Startup != StartupResume {
+		return nil, fmt.Errorf("recording.startup must be %q or %q, got %q", StartupConfig, StartupResume, cfg.Recording.Startup)
+	}
+
+	if cfg.Recording.DuplicateURLs != DuplicateURLsWarn && cfg.Recording.DuplicateURLs != DuplicateURLsShare {
+		return nil, fmt.Errorf("recording.duplicate_urls must be %q or %q, got %q", DuplicateURLsWarn, DuplicateURLsShare, cfg.Recording.DuplicateURLs)
+	}
+
+	tier := cfg.Recording.ColdTier
+	if tier.AfterDays < 0 {
+		return nil, fmt.Errorf("recording.cold_tier.after_days must not be negative")
+	}
+	if tier.AfterDays > 0 && tier.AfterDays >= cfg.Recording.RetentionDays {
+		return nil, fmt.Errorf("recording.cold_tier.after_days must be less than recording.retention_days")
+	}
+	if tier.Height < 2 || tier.Height%2 != 0 {
+		return nil, fmt.Errorf("recording.cold_tier.height must be a positive even number")
+	}
+	if tier.CRF < 0 || tier.CRF > 51 {
+		return nil, fmt.Errorf("recording.cold_tier.crf must be between 0 and 51")
+	}
+
+	static := cfg.Recording.StaticScenes
+	if static.Threshold <= 0 || static.Threshold >= 1 {
+		return nil, fmt.Errorf("recording.static_scenes.threshold must be between 0 and 1")
+	}
+	if static.RetentionDays < 0 || (static.RetentionDays > 0 && static.RetentionDays >= cfg.Recording.RetentionDays) {
+		return nil, fmt.Errorf("recording.static_scenes.retention_days must be less than recording.retention_days")
+	}
+
+	retry := cfg.Recording.Retry
+	if retry.InitialDelay < time.Second {
+		return nil, fmt.Errorf("recording.retry.initial_delay must be at least 1s")
+	}
+	if retry.MaxDelay < retry.InitialDelay {
+		return nil, fmt.Errorf("recording.retry.max_delay must not be less than recording.retry.initial_delay")
+	}
+	if retry.Multiplier < 1 {
+		return nil, fmt.Errorf("recording.retry.multiplier must be at least 1")
+	}
+	if retry.Jitter < 0 || retry.Jitter >= 1 {
+		return nil, fmt.Errorf("recording.retry.jitter must be between 0 and 1")
+	}
+	if retry.MaxRetryWindow < 0 {
+		return nil, fmt.Errorf("recording.retry.max_retry_window must not be negative")
+	}
+	if retry.ProbeInterval < time.Second {
+		return nil, fmt.Errorf("recording.retry.probe_interval must be at least 1s")
+	}
+
+	if adaptive := cfg.Recording.Adaptive; adaptive.Enabled {
+		if adaptive.MinDuration < 10*time.Second {
+			return nil, fmt.Errorf("recording.adaptive_segments.min_duration must be at least 10s")
+		}
+		if adaptive.MinDuration > cfg.Recording.SegmentDuration || adaptive.MaxDuration < cfg.Recording.SegmentDuration {
+			return nil, fmt.Errorf("recording.segment_duration must be between recording.adaptive_segments.min_duration and max_duration")
+		}
+		if adaptive.Window < time.Minute {
+			return nil, fmt.Errorf("recording.adaptive_segments.window must be at least 1m")
+		}
+		if adaptive.BusyEvents < 1 {
+			return nil, fmt.Errorf("recording.adaptive_segments.busy_events must be at least 1")
+		}
+	}
+
+	if dual := cfg.Recording.DualMode; dual.Enabled {
+		if dual.MaxAttempts < 1 {
+			return nil, fmt.Errorf("recording.dual_mode.max_attempts must be at least 1")
+		}
+		if dual.RetryDelay < time.Second {
+			return nil, fmt.Errorf("recording.dual_mode.retry_delay must be at least 1s")
+		}
+	}
+
+	if cfg.Replay.Buffer < 0 || cfg.Replay.Buffer > time.Hour {
+		return nil, fmt.Errorf("replay.buffer must be between 0 and 1h")
+	}
+
+	if cfg.Debug.LeakCheckInterval != 0 && cfg.Debug.LeakCheckInterval < time.Minute {
+		return nil, fmt.Errorf("debug.leak_check_interval must be 0 or at least 1m")
+	}
+	if cfg.Debug.Pprof && len(cfg.API.Keys) == 0 {
+		return nil, fmt.Errorf("debug.pprof requires api.keys")
+	}
+
+	if cfg.Restream.Enabled {
+		if _, _, err := net.SplitHostPort(cfg.Restream.Listen); err != nil {
+			return nil, fmt.Errorf("invalid restream.listen %q: %w", cfg.Restream.Listen, err)
+		}
+		if (cfg.Restream.Username == "") != (cfg.Restream.Password == "") {
+			return nil, fmt.Errorf("restream.username and restream.password must be set together")
+		}
+	}
+
+	if err := cfg.SNMP.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid snmp: %w", err)
+	}
+
+	if err := cfg.Frigate.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid frigate: %w", err)
+	}
+
+	if err := cfg.Instance.validate(); err != nil {
+		return nil, fmt.Errorf("invalid instance: %w", err)
+	}
+
+	if err := cfg.Auth.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid auth: %w", err)
+	}
+
+	if err := cfg.Integrity.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid integrity: %w", err)
+	}
+
+	if err := cfg.Reconcile.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid reconcile: %w", err)
+	}
+
+	if err := cfg.Capture.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid capture: %w", err)
+	}
+
+	if err := cfg.Clock.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid clock: %w", err)
+	}
+
+	if _, err := camera.LoadPathDB(cfg.Discovery.RTSPPaths); err != nil {
+		return nil, fmt.Errorf("invalid discovery.rtsp_paths: %w", err)
+	}
+
+	for name, hwaccel := range map[string]recorder.HWAccel{
+		"decode.preview":   cfg.Decode.Preview,
+		"decode.detection": cfg.Decode.Detection,
+	} {
+		if !recorder.ValidHWAccel(hwaccel.Type) {
+			return nil, fmt.Errorf("unsupported %s.hwaccel %q", name, hwaccel.Type)
+		}
+	}
+
+	if !recorder.ValidWatermarkPosition(cfg.Watermark.Position) {
+		return nil, fmt.Errorf("watermark.position must be top-left, top-right, bottom-left or bottom-right, got %q", cfg.Watermark.Position)
+	}
+	if cfg.Watermark.FontSize <= 0 {
+		return nil, fmt.Errorf("watermark.font_size must be positive")
+	}
+	for _, format := range cfg.Export.Sidecars {
+		if !export.ValidSidecar(format) {
+			return nil, fmt.Errorf("export.sidecars must be \"json\" or \"xml\", got %q", format)
+		}
+	}
+
+	if cfg.Limits.Overflow != "copy" && cfg.Limits.Overflow != "queue" {
+		return nil, fmt.Errorf("limits.overflow must be \"copy\" or \"queue\", got %q", cfg.Limits.Overflow)
+	}
+	if cfg.Limits.MaxViewersPerCamera < 0 || cfg.Limits.MaxStreamsPerUser < 0 {
+		return nil, fmt.Errorf("limits.max_viewers_per_camera and limits.max_streams_per_user must not be negative")
+	}
+	if cfg.Limits.LiveWriteTimeout < time.Second {
+		return nil, fmt.Errorf("limits.live_write_timeout must be at least 1s")
+	}
+	if cfg.Limits.LiveIdleTimeout < 0 {
+		return nil, fmt.Errorf("limits.live_idle_timeout must not be negative")
+	}
+
+	if buf := cfg.Disk.RAMBuffer; buf.Dir != "" {
+		if buf.FlushInterval < time.Minute {
+			return nil, fmt.Errorf("disk.ram_buffer.flush_interval must be at least 1m")
+		}
+		if buf.MaxSizeMB <= 0 {
+			return nil, fmt.Errorf("disk.ram_buffer.max_size_mb must be positive")
+		}
+	}
+
+	if !storage.ValidSyncPolicy(cfg.Disk.Fsync.Policy) {
+		return nil, fmt.Errorf("disk.fsync.policy must be off, segment, periodic or close")
+	}
+	if cfg.Disk.Fsync.Policy == storage.SyncPeriodic && cfg.Disk.Fsync.Interval < time.Second {
+		return nil, fmt.Errorf("disk.fsync.interval must be at least 1s")
+	}
+
+	if err := validateFailover(&cfg); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
+
+func validateFailover(cfg *Config) error {
+	f := cfg.Failover
+	switch f.Role {
+	case "":
+		return nil
+	case FailoverActive, FailoverStandby:
+	default:
+		return fmt.Errorf("failover.role must be %q or %q, got %q", FailoverActive, FailoverStandby, f.Role)
+	}
+
+	if f.Role == FailoverStandby && f.Peer == "" {
+		return fmt.Errorf("failover.peer is required on the standby")
+	}
+	if f.Peer != "" {
+		if u, err := url.Parse(f.Peer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("failover.peer must be an http or https URL")
+		}
+	}
+	if f.HeartbeatInterval < time.Second {
+		return fmt.Errorf("failover.heartbeat_interval must be at least 1s")
+	}
+	if f.TakeoverAfter < 3*f.HeartbeatInterval {
+		return fmt.Errorf("failover.takeover_after must be at least 3 heartbeat intervals")
+	}
+	// Both instances would otherwise open the same SQLite file on shared
+	// storage, which SQLite does not support.
+	out, err := filepath.Abs(cfg.Recording.OutputDir)
+	if err != nil {
+		return err
+	}
+	idx, err := filepath.Abs(cfg.IndexPath())
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(out, idx); err == nil && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("failover needs index.path on a local disk, outside recording.output_dir")
+	}
+	return nil
+}
+
+// normalizeBasePath turns "cams", "/cams/" or "/cams" into "/cams", and "/"
+// into "" so it can be prepended to absolute paths.
+func normalizeBasePath(p string) string {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// ParseCIDRs parses networks in CIDR notation; a bare address matches only
+// itself.
+func ParseCIDRs(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+func (c *Config) IndexPath() string {
+	if c.Index.Path != "" {
+		return c.Index.Path
+	}
+	return filepath.Join(c.Recording.OutputDir, "index.db")
+}
+
+// Path returns the file the config was loaded from, or "".
+func (c *Config) Path() string {
+	return c.path
+}
+
+func (c *Config) Save() error {
+	if c.path == "" {
+		return fmt.Errorf("config has no file path")
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, c); err != nil {
+		return err
+	}
+
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace config: %w", err)
+	}
+
+	return nil
+}
+
+func Encode(w io.Writer, cfg *Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	return enc.Close()
+}
+
+func (c *Config) Sanitized(includeSecrets bool) Config {
+	out := *c
+	out.Cameras = make([]CameraConfig, len(c.Cameras))
+	copy(out.Cameras, c.Cameras)
+
+	if !includeSecrets {
+		for i := range out.Cameras {
+			out.Cameras[i].RTSPURL = StripCredentials(out.Cameras[i].RTSPURL)
+			out.Cameras[i].FailoverURL = StripCredentials(out.Cameras[i].FailoverURL)
+			if forward := out.Cameras[i].Forward; len(forward) > 0 {
+				out.Cameras[i].Forward = make([]string, len(forward))
+				for j, u := range forward {
+					out.Cameras[i].Forward[j] = StripForwardSecrets(u)
+				}
+			}
+			// Smart plug webhooks often hold tokens.
+			out.Cameras[i].Power.Community = ""
+			out.Cameras[i].Power.OffURL = ""
+			out.Cameras[i].Power.OnURL = ""
+		}
+		out.Events.Token = ""
+		out.API.Keys = nil
+		out.Auth.OIDC.ClientSecret = ""
+		out.Auth.LDAP.BindPassword = ""
+		out.Kiosk.Token = ""
+		out.Frigate.Broker = StripCredentials(out.Frigate.Broker)
+		out.Failover.Peer = StripCredentials(out.Failover.Peer)
+		out.Restream.Password = ""
+		out.SNMP.Community = ""
+		out.SNMP.Users = nil
+		// Plugin settings often hold webhook URLs and tokens.
+		out.Plugins.Notifiers = withoutPluginConfig(c.Plugins.Notifiers)
+		out.Plugins.Detectors = withoutPluginConfig(c.Plugins.Detectors)
+	}
+
+	return out
+}
+
+func withoutPluginConfig(plugins []PluginConfig) []PluginConfig {
+	if plugins == nil {
+		return nil
+	}
+	out := make([]PluginConfig, len(plugins))
+	for i, p := range plugins {
+		p.Config = nil
+		out[i] = p
+	}
+	return out
+}
+
+// StripForwardSecrets removes the credentials and the RTMP stream key from
+// a forward URL.
+func StripForwardSecrets(rawURL string) string {
+	rawURL = StripCredentials(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if app, _, ok := source.CutStreamKey(u); ok {
+		u.Path, u.RawPath = app, ""
+		return u.String()
+	}
+	return rawURL
+}
+
+func StripCredentials(rawURL string) string {
+	schemeEnd := strings.Index(rawURL, "://")
+	if schemeEnd == -1 {
+		return rawURL
+	}
+
+	rest := rawURL[schemeEnd+3:]
+	hostEnd := strings.IndexAny(rest, "/?#")
+	if hostEnd == -1 {
+		hostEnd = len(rest)
+	}
+
+	atIdx := strings.LastIndex(rest[:hostEnd], "@")
+	if atIdx == -1 {
+		return rawURL
+	}
+
+	return rawURL[:schemeEnd+3] + rest[atIdx+1:]
+}
+
+func ValidateCameras(cameras []CameraConfig) error {
+	seen := make(map[string]bool)
+	for i, cam := range cameras {
+		if strings.TrimSpace(cam.Name) == "" {
+			return fmt.Errorf("camera %d: name is required", i+1)
+		}
+		if strings.TrimSpace(cam.RTSPURL) == "" {
+			return fmt.Errorf("camera %s: rtsp_url is required", cam.Name)
+		}
+		if _, err := source.Parse(cam.RTSPURL); err != nil {
+			return fmt.Errorf("camera %s: %w", cam.Name, err)
+		}
+		if cam.FailoverURL != "" {
+			if _, err := source.Parse(cam.FailoverURL); err != nil {
+				return fmt.Errorf("camera %s: failover_url: %w", cam.Name, err)
+			}
+			if cam.FailoverURL == cam.RTSPURL {
+				return fmt.Errorf("camera %s: failover_url must differ from rtsp_url", cam.Name)
+			}
+		}
+		if seen[cam.Name] {
+			return fmt.Errorf("camera %s: duplicate name", cam.Name)
+		}
+		if cam.Mode != "" && cam.Mode != ModeContinuous && cam.Mode != ModeEvents {
+			return fmt.Errorf("camera %s: mode must be %q or %q", cam.Name, ModeContinuous, ModeEvents)
+		}
+		if _, err := schedule.Parse(cam.Schedule); err != nil {
+			return fmt.Errorf("camera %s: %w", cam.Name, err)
+		}
+		if cam.AudioEvents.Threshold > 0 {
+			return fmt.Errorf("camera %s: audio_events.threshold is in dBFS and must not be above 0", cam.Name)
+		}
+		if cam.AudioEvents.MinDuration < 0 {
+			return fmt.Errorf("camera %s: audio_events.min_duration must not be negative", cam.Name)
+		}
+		if err := cam.MotionEvents.Validate(); err != nil {
+			return fmt.Errorf("camera %s: %w", cam.Name, err)
+		}
+		if err := tags.Validate(cam.Tags); err != nil {
+			return fmt.Errorf("camera %s: %w", cam.Name, err)
+		}
+		if err := cam.Position.Validate(); err != nil {
+			return fmt.Errorf("camera %s: %w", cam.Name, err)
+		}
+		if cam.MaxSizeGB < 0 {
+			return fmt.Errorf("camera %s: max_size_gb must not be negative", cam.Name)
+		}
+		if cam.MaxViewers < 0 {
+			return fmt.Errorf("camera %s: max_viewers must not be negative", cam.Name)
+		}
+		if err := cam.Keyframes.Validate(); err != nil {
+			return fmt.Errorf("camera %s: %w", cam.Name, err)
+		}
+		for _, u := range cam.Forward {
+			if err := recorder.ValidForwardURL(u); err != nil {
+				return fmt.Errorf("camera %s: forward: %w", cam.Name, err)
+			}
+		}
+		if err := cam.Power.Validate(); err != nil {
+			return fmt.Errorf("camera %s: %w", cam.Name, err)
+		}
+		seen[cam.Name] = true
+	}
+	return nil
+}
+
+// IngestOwners maps each camera whose stream is already used by an earlier
+// camera to that camera's name. URLs differing only in credentials, host
+// case or an explicit default RTSP port are the same stream.
+func IngestOwners(cameras []CameraConfig) map[string]string {
+	owners := make(map[string]string)
+	first := make(map[string]string)
+	for _, cam := range cameras {
+		key := streamKey(cam.RTSPURL)
+		if owner, ok := first[key]; ok {
+			owners[cam.Name] = owner
+			continue
+		}
+		first[key] = cam.Name
+	}
+	return owners
+}
+
+// CameraTags maps each camera with tags to its tags.
+func CameraTags(cameras []CameraConfig) map[string]map[string]string {
+	byCamera := make(map[string]map[string]string)
+	for _, cam := range cameras {
+		if len(cam.Tags) > 0 {
+			byCamera[cam.Name] = cam.Tags
+		}
+	}
+	return byCamera
+}
+
+// CameraQuotas maps each camera with a max_size_gb to its quota in bytes.
+func CameraQuotas(cameras []CameraConfig) map[string]int64 {
+	quotas := make(map[string]int64)
+	for _, cam := range cameras {
+		if cam.MaxSizeGB > 0 {
+			quotas[cam.Name] = int64(cam.MaxSizeGB * (1 << 30))
+		}
+	}
+	return quotas
+}
+
+// CameraKeyframes maps each camera keeping keyframes to its settings.
+func CameraKeyframes(cameras []CameraConfig) map[string]KeyframesConfig {
+	byCamera := make(map[string]KeyframesConfig)
+	for _, cam := range cameras {
+		if cam.Keyframes.Enabled {
+			byCamera[cam.Name] = cam.Keyframes
+		}
+	}
+	return byCamera
+}
+
+// CameraRetention maps each camera keeping keyframes for its own retention
+// to that retention in days.
+func CameraRetention(cameras []CameraConfig) map[string]int {
+	days := make(map[string]int)
+	for _, cam := range cameras {
+		if cam.Keyframes.Enabled && cam.Keyframes.RetentionDays > 0 {
+			days[cam.Name] = cam.Keyframes.RetentionDays
+		}
+	}
+	return days
+}
+
+func streamKey(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	if port == "" && scheme == "rtsp" {
+		port = "554"
+	}
+	return scheme + "://" + net.JoinHostPort(strings.ToLower(u.Hostname()), port) + u.EscapedPath() + "?" + u.RawQuery
+}
+
+func validatePlugins(section string, plugins []PluginConfig, registered []string) error {
+	seen := make(map[string]bool)
+	for i, p := range plugins {
+		switch {
+		case strings.TrimSpace(p.Name) == "":
+			return fmt.Errorf("%s[%d]: name is required", section, i)
+		case seen[p.Name]:
+			return fmt.Errorf("%s: duplicate name %q", section, p.Name)
+		case section == "plugins.notifiers" && p.Name == "webpush":
+			return fmt.Errorf("%s: name %q is reserved for push notifications", section, p.Name)
+		case (p.Type == "") == (p.Exec == ""):
+			return fmt.Errorf("%s %s: set either type or exec", section, p.Name)
+		case p.Type != "" && !slices.Contains(registered, p.Type):
+			return fmt.Errorf("%s %s: unknown type %q (available: %s)", section, p.Name, p.Type, strings.Join(registered, ", "))
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
+
+func ParseCamerasCSV(r io.Reader) ([]CameraConfig, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var cameras []CameraConfig
+	line := 0
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		line++
+
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "name") {
+			continue
+		}
+
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected name,url[,enabled[,tags]]", line)
+		}
+
+		cam := CameraConfig{
+			Name:    strings.TrimSpace(record[0]),
+			RTSPURL: strings.TrimSpace(record[1]),
+			Enabled: true,
+		}
+
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			enabled, err := strconv.ParseBool(strings.TrimSpace(record[2]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid enabled value %q", line, record[2])
+			}
+			cam.Enabled = enabled
+		}
+
+		if len(record) > 3 && strings.TrimSpace(record[3]) != "" {
+			cam.Tags = make(map[string]string)
+			for pair := range strings.SplitSeq(record[3], ";") {
+				key, value, _ := strings.Cut(pair, "=")
+				key = strings.ToLower(strings.TrimSpace(key))
+				if key == "" {
+					continue
+				}
+				cam.Tags[key] = strings.TrimSpace(value)
+			}
+		}
+
+		cameras = append(cameras, cam)
+	}
+
+	return cameras, nil
+}
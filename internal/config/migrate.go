@@ -0,0 +1,177 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// CurrentVersion is the schema version of the config files this build reads
+// and writes.
+const CurrentVersion = 1
+
+const versionKey = "version"
+
+// A migration upgrades a config file from the previous version to version.
+// It edits the YAML tree, so comments survive, and reports whether it
+// changed anything. A file no migration changed only gets its version line
+// updated, keeping its layout too.
+type migration struct {
+	version int
+	apply   func(root *yaml.Node) (bool, error)
+}
+
+// migrations upgrade config files one version at a time. Append only: a
+// released version must keep upgrading the files written by it.
+var migrations = []migration{
+	// Files written before versioning have no version field; their schema is
+	// that of version 1.
+	{version: 1, apply: func(*yaml.Node) (bool, error) { return false, nil }},
+}
+
+var versionLine = regexp.MustCompile(`(?m)^version:[^\n#]*`)
+
+// Migrate upgrades a YAML config file to CurrentVersion. It returns the file
+// unchanged, with its version, when it is current already.
+func Migrate(data []byte) ([]byte, int, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		// Empty file: nothing but defaults, which are always current.
+		return data, CurrentVersion, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, 0, fmt.Errorf("config must be a mapping, not a %s", nodeKind(root))
+	}
+
+	version := 0
+	if node := mappingValue(root, versionKey); node != nil {
+		v, err := strconv.Atoi(node.Value)
+		if err != nil || v < 1 {
+			return nil, 0, fmt.Errorf("invalid config version %q", node.Value)
+		}
+		version = v
+	}
+	if version > CurrentVersion {
+		return nil, version, fmt.Errorf("config version %d is newer than this recorder supports (%d); upgrade the recorder", version, CurrentVersion)
+	}
+	if version == CurrentVersion {
+		return data, version, nil
+	}
+
+	changed := false
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		c, err := m.apply(root)
+		if err != nil {
+			return nil, version, fmt.Errorf("failed to migrate config to version %d: %w", m.version, err)
+		}
+		changed = changed || c
+	}
+
+	line := fmt.Sprintf("version: %d", CurrentVersion)
+	if !changed {
+		if version == 0 {
+			return append([]byte(line+"\n"), data...), version, nil
+		}
+		return versionLine.ReplaceAll(data, []byte(line)), version, nil
+	}
+
+	setVersion(root, CurrentVersion)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, version, fmt.Errorf("failed to encode migrated config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, version, fmt.Errorf("failed to encode migrated config: %w", err)
+	}
+	return buf.Bytes(), version, nil
+}
+
+// migrateFile upgrades the config file at path in place, keeping the
+// original next to it as <path>.v<version>.bak. It returns the contents to
+// load, which are upgraded even if the file cannot be written.
+func migrateFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	migrated, from, err := Migrate(data)
+	if err != nil {
+		return nil, err
+	}
+	if from == CurrentVersion {
+		return data, nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if _, err := os.Stat(backup); os.IsNotExist(err) {
+		if err := os.WriteFile(backup, data, 0600); err != nil {
+			log.Printf("Warning: Failed to back up %s before upgrading it, using the upgrade without saving it: %v", path, err)
+			return migrated, nil
+		}
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, migrated, 0600); err != nil {
+		log.Printf("Warning: Failed to save the upgraded %s: %v", path, err)
+		return migrated, nil
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		log.Printf("Warning: Failed to save the upgraded %s: %v", path, err)
+		return migrated, nil
+	}
+	log.Printf("Upgraded %s from config version %d to %d; the original is in %s", path, from, CurrentVersion, backup)
+	return migrated, nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setVersion sets the version field, adding it at the top of the file.
+func setVersion(root *yaml.Node, version int) {
+	value := strconv.Itoa(version)
+	if node := mappingValue(root, versionKey); node != nil {
+		node.Value = value
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: versionKey}
+	val := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: value}
+	// A comment heading the file stays at the top.
+	if len(root.Content) > 0 && root.Content[0].HeadComment != "" {
+		key.HeadComment = root.Content[0].HeadComment
+		root.Content[0].HeadComment = ""
+	}
+	root.Content = append([]*yaml.Node{key, val}, root.Content...)
+}
+
+func nodeKind(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		return "list"
+	case yaml.ScalarNode:
+		return "value"
+	}
+	return "document"
+}
@@ -0,0 +1,290 @@
+package export
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	ManifestFormat = "cam-recorder-export/1"
+
+	manifestName  = "manifest.json"
+	signatureName = "manifest.json.sig"
+	publicKeyName = "signing-key.pub"
+	checksumsName = "SHA256SUMS"
+
+	signingKeySetting = "export.signing_private_key"
+)
+
+type Exporter struct {
+	Name      string `json:"name,omitempty"`
+	Address   string `json:"address"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+type Software struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Host    string `json:"host,omitempty"`
+	// Instance is the ID of the recorder that made the export.
+	Instance string `json:"instance,omitempty"`
+}
+
+type File struct {
+	Name      string    `json:"name"`
+	Camera    string    `json:"camera"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	// Instance and Site are the recorder that recorded the file, when
+	// known.
+	Instance string `json:"instance,omitempty"`
+	Site     string `json:"site,omitempty"`
+}
+
+// Manifest describes an export for chain-of-custody purposes. When signed,
+// the Ed25519 signature covers the exact bytes of manifest.json, which in
+// turn pins every file by its SHA-256.
+type Manifest struct {
+	Format    string    `json:"format"`
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Exporter  Exporter  `json:"exporter"`
+	Software  Software  `json:"software"`
+	Cameras   []string  `json:"cameras"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Files     []File    `json:"files"`
+	Signed    bool      `json:"signed"`
+	PublicKey string    `json:"public_key,omitempty"`
+	// Watermark is the text stamped onto the files, which then differ from
+	// the originals on the recorder.
+	Watermark   string `json:"watermark,omitempty"`
+	Watermarked bool   `json:"watermarked"`
+	// Metadata is set when the files carry embedded metadata (creation time,
+	// camera, site and location) and so also differ from the originals.
+	Metadata bool   `json:"metadata"`
+	Site     string `json:"site,omitempty"`
+	// Sidecars are the metadata files written next to the clips.
+	Sidecars []File `json:"sidecars,omitempty"`
+}
+
+func NewManifest(exporter Exporter, version string, cameras []string, from, to time.Time) *Manifest {
+	id := make([]byte, 8)
+	rand.Read(id)
+	host, _ := os.Hostname()
+
+	return &Manifest{
+		Format:    ManifestFormat,
+		ID:        time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(id),
+		CreatedAt: time.Now().UTC(),
+		Exporter:  exporter,
+		Software:  Software{Name: "cam-recorder", Version: version, Host: host},
+		Cameras:   cameras,
+		From:      from,
+		To:        to,
+		Files:     []File{},
+	}
+}
+
+// A Stamper makes the copy of a segment that goes into the archive in place
+// of the original, and returns its path and a function removing it.
+type Stamper func(seg index.Segment) (path string, done func(), err error)
+
+// Chain returns a stamper applying each stamper to the copy the one before
+// made, such as a watermark and then embedded metadata. Nil stampers are
+// skipped.
+func Chain(stampers ...Stamper) Stamper {
+	var chain []Stamper
+	for _, stamp := range stampers {
+		if stamp != nil {
+			chain = append(chain, stamp)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return func(seg index.Segment) (string, func(), error) {
+		var dones []func()
+		done := func() {
+			for i := len(dones) - 1; i >= 0; i-- {
+				dones[i]()
+			}
+		}
+		for _, stamp := range chain {
+			p, d, err := stamp(seg)
+			if err != nil {
+				done()
+				return "", nil, err
+			}
+			dones = append(dones, d)
+			seg.Path = p
+		}
+		return seg.Path, done, nil
+	}
+}
+
+// Options are the optional parts of an export.
+type Options struct {
+	// Signer signs the manifest.
+	Signer ed25519.PrivateKey
+	// Stamp makes the copies archived instead of the originals.
+	Stamp Stamper
+	// Sidecars are the formats (SidecarJSON, SidecarXML) of the metadata
+	// file written next to each clip.
+	Sidecars []string
+	// Locations of the cameras, for the sidecars.
+	Locations map[string]Location
+}
+
+type zipEntry struct {
+	name string
+	data []byte
+}
+
+// Write streams the segments into a ZIP archive, hashing each file as it is
+// copied, and finishes with the manifest, a sha256sum-compatible checksum
+// list and, with a signer, the manifest signature and public key. With a
+// stamper, the stamped copies are archived instead of the originals.
+func Write(w io.Writer, m *Manifest, segments []index.Segment, opts Options) error {
+	zw := zip.NewWriter(w)
+
+	var sums strings.Builder
+	for _, seg := range segments {
+		name := path.Join(storage.CameraDirName(seg.Camera), seg.Filename)
+		file, err := addSegment(zw, name, seg, opts.Stamp)
+		if err != nil {
+			return err
+		}
+		file.Camera = seg.Camera
+		file.StartedAt = seg.StartedAt
+		file.EndedAt = seg.EndedAt
+		file.Instance, file.Site = seg.Instance, seg.Site
+		m.Files = append(m.Files, file)
+		fmt.Fprintf(&sums, "%s  %s\n", file.SHA256, name)
+
+		for _, format := range opts.Sidecars {
+			sidecar, err := addSidecar(zw, m, file, format, opts.Locations[seg.Camera])
+			if err != nil {
+				return err
+			}
+			m.Sidecars = append(m.Sidecars, sidecar)
+			fmt.Fprintf(&sums, "%s  %s\n", sidecar.SHA256, sidecar.Name)
+		}
+	}
+
+	signer := opts.Signer
+	if signer != nil {
+		m.Signed = true
+		m.PublicKey = base64.StdEncoding.EncodeToString(signer.Public().(ed25519.PublicKey))
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	manifest = append(manifest, '\n')
+
+	entries := []zipEntry{
+		{manifestName, manifest},
+		{checksumsName, []byte(sums.String())},
+	}
+	if signer != nil {
+		sig := base64.StdEncoding.EncodeToString(ed25519.Sign(signer, manifest))
+		entries = append(entries,
+			zipEntry{signatureName, []byte(sig + "\n")},
+			zipEntry{publicKeyName, []byte(m.PublicKey + "\n")},
+		)
+	}
+
+	for _, entry := range entries {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: m.CreatedAt})
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", entry.name, err)
+		}
+		if _, err := fw.Write(entry.data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", entry.name, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+func addSegment(zw *zip.Writer, name string, seg index.Segment, stamp Stamper) (File, error) {
+	if stamp == nil {
+		return addFile(zw, name, seg.Path)
+	}
+	stamped, done, err := stamp(seg)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to stamp %s: %w", name, err)
+	}
+	defer done()
+	return addFile(zw, name, stamped)
+}
+
+func addFile(zw *zip.Writer, name, srcPath string) (File, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return File{}, fmt.Errorf("failed to stat %s: %w", name, err)
+	}
+
+	// Video is already compressed; storing it keeps exports fast.
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: info.ModTime()})
+	if err != nil {
+		return File{}, fmt.Errorf("failed to add %s: %w", name, err)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(fw, hash), src)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to copy %s: %w", name, err)
+	}
+
+	return File{Name: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// SigningKey returns the instance's export signing key, generating and
+// storing it in the index on first use.
+func SigningKey(idx *index.Index) (ed25519.PrivateKey, error) {
+	stored, ok, err := idx.Setting(signingKeySetting)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		seed, err := base64.StdEncoding.DecodeString(stored)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid stored export signing key")
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate export signing key: %w", err)
+	}
+	if err := idx.SetSetting(signingKeySetting, base64.StdEncoding.EncodeToString(key.Seed())); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
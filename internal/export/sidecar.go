@@ -0,0 +1,119 @@
+package export
+
+import (
+	"archive/zip"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// Sidecar formats.
+const (
+	SidecarJSON = "json"
+	SidecarXML  = "xml"
+
+	ClipFormat = "cam-recorder-clip/1"
+)
+
+// ValidSidecar reports whether format names a sidecar format.
+func ValidSidecar(format string) bool {
+	return format == SidecarJSON || format == SidecarXML
+}
+
+// Location is where a camera is.
+type Location struct {
+	Lat float64 `json:"lat" xml:"lat,attr"`
+	Lon float64 `json:"lon" xml:"lon,attr"`
+}
+
+// Clip is the sidecar of an exported clip: what a video management system
+// needs to file it under the right camera and time without parsing the
+// file name.
+type Clip struct {
+	XMLName xml.Name `json:"-" xml:"Clip"`
+	Format  string   `json:"format" xml:"format,attr"`
+	File    string   `json:"file" xml:"File"`
+	Camera  string   `json:"camera" xml:"Camera"`
+	Site    string   `json:"site,omitempty" xml:"Site,omitempty"`
+	// Instance is the recorder that recorded the clip, when known.
+	Instance string    `json:"instance,omitempty" xml:"Instance,omitempty"`
+	Location *Location `json:"location,omitempty" xml:"Location,omitempty"`
+	// StartTime and EndTime are in UTC, LocalStartTime in the recorder's
+	// time zone with its UTC offset.
+	StartTime       time.Time `json:"start_time" xml:"StartTime"`
+	EndTime         time.Time `json:"end_time" xml:"EndTime"`
+	LocalStartTime  string    `json:"local_start_time" xml:"LocalStartTime"`
+	DurationSeconds float64   `json:"duration_seconds" xml:"DurationSeconds"`
+	Size            int64     `json:"size" xml:"Size"`
+	SHA256          string    `json:"sha256" xml:"SHA256"`
+	Recorder        Software  `json:"recorder" xml:"Recorder"`
+	ExportID        string    `json:"export_id" xml:"ExportID"`
+}
+
+func newClip(m *Manifest, file File, loc Location) Clip {
+	clip := Clip{
+		Format:          ClipFormat,
+		File:            path.Base(file.Name),
+		Camera:          file.Camera,
+		Site:            cmp.Or(file.Site, m.Site),
+		Instance:        file.Instance,
+		StartTime:       file.StartedAt.UTC(),
+		EndTime:         file.EndedAt.UTC(),
+		LocalStartTime:  file.StartedAt.Local().Format(time.RFC3339Nano),
+		DurationSeconds: file.EndedAt.Sub(file.StartedAt).Seconds(),
+		Size:            file.Size,
+		SHA256:          file.SHA256,
+		Recorder:        m.Software,
+		ExportID:        m.ID,
+	}
+	if loc.Lat != 0 || loc.Lon != 0 {
+		clip.Location = &loc
+	}
+	return clip
+}
+
+func encodeClip(clip Clip, format string) ([]byte, error) {
+	switch format {
+	case SidecarJSON:
+		data, err := json.MarshalIndent(clip, "", "  ")
+		return append(data, '\n'), err
+	case SidecarXML:
+		data, err := xml.MarshalIndent(clip, "", "  ")
+		return append([]byte(xml.Header), append(data, '\n')...), err
+	}
+	return nil, fmt.Errorf("unknown sidecar format %q", format)
+}
+
+// addSidecar writes the sidecar of an archived clip next to it, named after
+// the clip with the format as extension.
+func addSidecar(zw *zip.Writer, m *Manifest, file File, format string, loc Location) (File, error) {
+	name := strings.TrimSuffix(file.Name, path.Ext(file.Name)) + "." + format
+	data, err := encodeClip(newClip(m, file, loc), format)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: m.CreatedAt})
+	if err != nil {
+		return File{}, fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := fw.Write(data); err != nil {
+		return File{}, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	sum := sha256.Sum256(data)
+	return File{
+		Name:      name,
+		Camera:    file.Camera,
+		StartedAt: file.StartedAt,
+		EndedAt:   file.EndedAt,
+		Size:      int64(len(data)),
+		SHA256:    hex.EncodeToString(sum[:]),
+	}, nil
+}
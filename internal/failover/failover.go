@@ -0,0 +1,403 @@
+// Package failover runs one instance of an active/standby pair. The pair
+// records the same cameras to shared storage, and a lease file there decides
+// which of them records: the holder renews it every heartbeat, and the other
+// only takes it once it has gone unrenewed for the takeover delay and the
+// peer no longer answers as active.
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const leaseFile = "lease.json"
+
+// errNotResponding is returned while a lease file operation is stuck, as on
+// a network mount whose server went away.
+var errNotResponding = errors.New("the recordings directory is not responding")
+
+// Lease records which instance records to the shared recordings directory.
+type Lease struct {
+	Owner      string    `json:"owner"`
+	Host       string    `json:"host"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	RenewedAt  time.Time `json:"renewed_at"`
+	// ReleasedAt is set when the owner shut down cleanly.
+	ReleasedAt time.Time `json:"released_at,omitzero"`
+}
+
+// Status is what an instance reports at /api/failover, which is also the
+// heartbeat its peer polls.
+type Status struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Active bool   `json:"active"`
+	// Since is when the instance last became active or went on standby.
+	Since time.Time `json:"since"`
+	Lease *Lease    `json:"lease,omitempty"`
+	// PeerSeen is when the peer last answered, and PeerActive whether it
+	// was recording then.
+	PeerSeen   time.Time `json:"peer_seen,omitzero"`
+	PeerActive bool      `json:"peer_active"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type Manager struct {
+	config config.FailoverConfig
+	path   string
+	name   string
+	host   string
+	client *http.Client
+	hook   func(active bool)
+
+	mu     sync.Mutex
+	status Status
+
+	// busy is set while a lease file operation runs, so a stuck mount does
+	// not pile up goroutines.
+	busy atomic.Bool
+
+	// Touched only by the loop.
+	renewed      time.Time
+	lease        Lease
+	leaseChanged time.Time
+	peerActiveAt time.Time
+}
+
+func NewManager(cfg config.FailoverConfig, outputDir string) *Manager {
+	host, _ := os.Hostname()
+	name := cfg.Name
+	if name == "" {
+		name = host
+	}
+	return &Manager{
+		config: cfg,
+		path:   filepath.Join(outputDir, storage.FailoverDir, leaseFile),
+		name:   name,
+		host:   host,
+		client: &http.Client{Timeout: cfg.HeartbeatInterval},
+		status: Status{Name: name, Role: cfg.Role, Since: time.Now()},
+	}
+}
+
+// SetHook sets the function called when the instance becomes active or goes
+// on standby. It runs on the manager's goroutine, before the next heartbeat.
+func (m *Manager) SetHook(hook func(active bool)) {
+	m.hook = hook
+}
+
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+func (m *Manager) Active() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status.Active
+}
+
+// Start runs the heartbeat until ctx is done, then releases the lease so the
+// peer can take over without waiting out the takeover delay.
+func (m *Manager) Start(ctx context.Context) {
+	m.peerActiveAt = time.Now()
+	go func() {
+		ticker := time.NewTicker(m.config.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			m.tick(ctx)
+			select {
+			case <-ctx.Done():
+				m.release()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (m *Manager) tick(ctx context.Context) {
+	now := time.Now()
+	if m.config.Peer != "" {
+		peer, err := m.checkPeer(ctx)
+		m.mu.Lock()
+		if err == nil {
+			m.status.PeerSeen = now
+			m.status.PeerActive = peer.Active
+		}
+		m.mu.Unlock()
+		if err == nil && peer.Active {
+			m.peerActiveAt = now
+		}
+	}
+
+	lease, err := m.readLease()
+	if err != nil {
+		m.setError(err)
+		m.fenceIfStale(now)
+		return
+	}
+	if lease.Owner != m.lease.Owner || !lease.RenewedAt.Equal(m.lease.RenewedAt) {
+		m.lease = lease
+		m.leaseChanged = now
+	}
+	// Expiry is judged by when this instance saw the lease last change, so
+	// the clocks of the pair need not agree.
+	released := !lease.ReleasedAt.IsZero()
+	held := lease.Owner != "" && lease.Owner != m.name && !released && now.Sub(m.leaseChanged) < m.config.TakeoverAfter
+
+	if m.Active() {
+		if held {
+			m.setActive(ctx, false, fmt.Sprintf("%s holds the lease", lease.Owner))
+			return
+		}
+		if err := m.writeLease(lease, now); err != nil {
+			m.setError(err)
+			m.fenceIfStale(now)
+			return
+		}
+		m.setError(nil)
+		return
+	}
+
+	if held {
+		m.setError(nil)
+		return
+	}
+	// The standby also waits for the peer to stop answering as active, so a
+	// peer that is only slow to renew is not taken over from. A lease the
+	// peer released on shutdown is taken at once.
+	waitForPeer := now.Sub(m.peerActiveAt) < m.config.TakeoverAfter
+	if released {
+		waitForPeer = m.peerActiveAt.Equal(now)
+	}
+	ownLease := lease.Owner == m.name && !released
+	if !ownLease && m.config.Role == config.FailoverStandby && waitForPeer {
+		m.setError(nil)
+		return
+	}
+	if err := m.acquire(ctx, lease, now); err != nil {
+		m.setError(err)
+		return
+	}
+	m.setError(nil)
+	m.setActive(ctx, true, "acquired the lease")
+}
+
+// acquire writes the lease and, after giving a peer writing at the same time
+// the chance to finish, reads it back to check this instance won.
+func (m *Manager) acquire(ctx context.Context, lease Lease, now time.Time) error {
+	if err := m.writeLease(lease, now); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(m.config.HeartbeatInterval / 2):
+	}
+
+	got, err := m.readLease()
+	if err != nil {
+		return err
+	}
+	if got.Owner != m.name {
+		return fmt.Errorf("%s took the lease first", got.Owner)
+	}
+	return nil
+}
+
+// fenceIfStale steps down once the lease has gone unrenewed for half the
+// takeover delay, well before the peer may take it.
+func (m *Manager) fenceIfStale(now time.Time) {
+	if m.Active() && now.Sub(m.renewed) > m.config.TakeoverAfter/2 {
+		m.setActive(context.Background(), false, "could not renew the lease")
+	}
+}
+
+func (m *Manager) setActive(ctx context.Context, active bool, reason string) {
+	m.mu.Lock()
+	m.status.Active = active
+	m.status.Since = time.Now()
+	m.mu.Unlock()
+
+	if active {
+		log.Printf("Failover: %s is now active (%s)", m.name, reason)
+	} else {
+		log.Printf("Warning: Failover: %s is now on standby (%s)", m.name, reason)
+	}
+	if m.hook != nil && ctx.Err() == nil {
+		m.hook(active)
+	}
+}
+
+func (m *Manager) setError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		m.status.Error = ""
+		return
+	}
+	if m.status.Error != err.Error() {
+		log.Printf("Warning: Failover: %v", err)
+	}
+	m.status.Error = err.Error()
+}
+
+// release marks the lease released if this instance holds it.
+func (m *Manager) release() {
+	if !m.Active() {
+		return
+	}
+	err := m.withTimeout(func() error {
+		lease, err := m.readLeaseFile()
+		if err != nil || lease.Owner != m.name {
+			return err
+		}
+		lease.ReleasedAt = time.Now()
+		return writeFile(m.path, lease)
+	})
+	if err != nil {
+		log.Printf("Warning: Failover: Failed to release the lease: %v", err)
+	}
+}
+
+func (m *Manager) readLease() (Lease, error) {
+	var lease Lease
+	err := m.withTimeout(func() error {
+		var err error
+		lease, err = m.readLeaseFile()
+		return err
+	})
+	return lease, err
+}
+
+// readLeaseFile returns the zero Lease when there is no lease file.
+func (m *Manager) readLeaseFile() (Lease, error) {
+	var lease Lease
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return lease, nil
+	}
+	if err != nil {
+		return lease, fmt.Errorf("failed to read lease: %w", err)
+	}
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return Lease{}, fmt.Errorf("failed to parse lease: %w", err)
+	}
+	return lease, nil
+}
+
+// writeLease renews lease under this instance's name, starting a new one
+// when lease is the zero Lease.
+func (m *Manager) writeLease(lease Lease, now time.Time) error {
+	if lease.Owner != m.name || !lease.ReleasedAt.IsZero() {
+		lease = Lease{Owner: m.name, Host: m.host, AcquiredAt: now}
+	}
+	lease.RenewedAt = now
+
+	err := m.withTimeout(func() error {
+		return writeFile(m.path, lease)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write lease: %w", err)
+	}
+	m.renewed = now
+	m.lease = lease
+	m.leaseChanged = now
+
+	m.mu.Lock()
+	m.status.Lease = &lease
+	m.mu.Unlock()
+	return nil
+}
+
+// writeFile replaces path with lease in one rename, so the peer never reads
+// half a lease.
+func writeFile(path string, lease Lease) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(lease, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// withTimeout runs a lease file operation for at most a heartbeat interval.
+func (m *Manager) withTimeout(fn func() error) error {
+	if !m.busy.CompareAndSwap(false, true) {
+		return errNotResponding
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer m.busy.Store(false)
+		done <- fn()
+	}()
+
+	timer := time.NewTimer(m.config.HeartbeatInterval)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errNotResponding
+	}
+}
+
+func (m *Manager) checkPeer(ctx context.Context) (Status, error) {
+	var peer Status
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(m.config.Peer, "/")+"/api/failover", nil)
+	if err != nil {
+		return peer, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return peer, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return peer, fmt.Errorf("peer returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&peer); err != nil {
+		return peer, fmt.Errorf("failed to parse peer status: %w", err)
+	}
+	return peer, nil
+}
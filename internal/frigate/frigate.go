@@ -0,0 +1,264 @@
+// Package frigate imports the detections of a Frigate NVR as recorder
+// events, so detection can run elsewhere while footage and search stay here.
+// Events arrive from Frigate's MQTT topic, or from Home Assistant relaying
+// them to the recorder's webhook.
+package frigate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	retryMin = 5 * time.Second
+	retryMax = 5 * time.Minute
+)
+
+// Config subscribes to a Frigate's events over MQTT. Cameras maps Frigate
+// camera names to recorder cameras; unmapped names are matched to cameras of
+// the same name, ignoring case, spaces and underscores. Labels and MinScore
+// leave out detections of other objects and weaker detections.
+type Config struct {
+	// Broker is the MQTT broker's URL, mqtt:// or mqtts://, with optional
+	// credentials.
+	Broker      string            `mapstructure:"broker" yaml:"broker,omitempty"`
+	TopicPrefix string            `mapstructure:"topic_prefix" yaml:"topic_prefix"`
+	ClientID    string            `mapstructure:"client_id" yaml:"client_id"`
+	Cameras     map[string]string `mapstructure:"cameras" yaml:"cameras,omitempty"`
+	Labels      []string          `mapstructure:"labels" yaml:"labels,omitempty"`
+	MinScore    float64           `mapstructure:"min_score" yaml:"min_score,omitempty"`
+}
+
+// Enabled reports whether a broker is set.
+func (c Config) Enabled() bool {
+	return c.Broker != ""
+}
+
+// Validate checks the broker URL and score.
+func (c Config) Validate() error {
+	if c.MinScore < 0 || c.MinScore > 1 {
+		return fmt.Errorf("min_score must be between 0 and 1")
+	}
+	if !c.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(c.Broker)
+	if err != nil {
+		return fmt.Errorf("broker: %w", err)
+	}
+	switch u.Scheme {
+	case "mqtt", "mqtts", "tcp", "ssl", "tls":
+	default:
+		return fmt.Errorf("broker must be an mqtt:// or mqtts:// URL")
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("broker has no host")
+	}
+	if c.TopicPrefix == "" || strings.ContainsAny(c.TopicPrefix, "#+") {
+		return fmt.Errorf("topic_prefix must be set and must not hold wildcards")
+	}
+	return nil
+}
+
+// Camera returns the recorder camera, out of names, that a Frigate camera
+// is.
+func (c Config) Camera(frigateCamera string, names []string) (string, bool) {
+	if name, ok := c.Cameras[frigateCamera]; ok {
+		return name, slices.Contains(names, name)
+	}
+	key := func(s string) string {
+		return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(s))
+	}
+	for _, name := range names {
+		if key(name) == key(frigateCamera) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Wanted reports whether a detection passes the label and score filters.
+func (c Config) Wanted(d Detection) bool {
+	if len(c.Labels) > 0 && !slices.Contains(c.Labels, d.Label) {
+		return false
+	}
+	return d.TopScore >= c.MinScore
+}
+
+// Message is an event Frigate publishes on <prefix>/events: Type is "new",
+// "update" or "end", and After the tracked object as it is now.
+type Message struct {
+	Type   string    `json:"type"`
+	Before Detection `json:"before"`
+	After  Detection `json:"after"`
+}
+
+// Detection is an object Frigate tracks.
+type Detection struct {
+	ID            string   `json:"id"`
+	Camera        string   `json:"camera"`
+	Label         string   `json:"label"`
+	SubLabel      SubLabel `json:"sub_label"`
+	TopScore      float64  `json:"top_score"`
+	StartTime     float64  `json:"start_time"`
+	EndTime       *float64 `json:"end_time"`
+	FalsePositive bool     `json:"false_positive"`
+	EnteredZones  []string `json:"entered_zones"`
+}
+
+// SubLabel is a recognized face or plate: a string in older Frigates, a
+// [name, score] pair in newer ones.
+type SubLabel string
+
+func (s *SubLabel) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case string:
+		*s = SubLabel(v)
+	case []any:
+		if len(v) > 0 {
+			if name, ok := v[0].(string); ok {
+				*s = SubLabel(name)
+			}
+		}
+	}
+	return nil
+}
+
+// Started is when Frigate first saw the object.
+func (d Detection) Started() time.Time {
+	return unixTime(d.StartTime)
+}
+
+// Ended is when Frigate lost the object, or zero while it is tracked.
+func (d Detection) Ended() time.Time {
+	if d.EndTime == nil {
+		return time.Time{}
+	}
+	return unixTime(*d.EndTime)
+}
+
+// Description reads like "person: Alice (87%) in driveway".
+func (d Detection) Description() string {
+	desc := d.Label
+	if d.SubLabel != "" {
+		desc += ": " + string(d.SubLabel)
+	}
+	if d.TopScore > 0 {
+		desc += fmt.Sprintf(" (%d%%)", int(math.Round(d.TopScore*100)))
+	}
+	if len(d.EnteredZones) > 0 {
+		desc += " in " + strings.Join(d.EnteredZones, ", ")
+	}
+	return desc
+}
+
+func unixTime(seconds float64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// ParseMessage decodes an event message.
+func ParseMessage(payload []byte) (Message, error) {
+	var m Message
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return Message{}, fmt.Errorf("invalid Frigate event: %w", err)
+	}
+	if m.After.ID == "" || m.After.Camera == "" {
+		return Message{}, fmt.Errorf("invalid Frigate event: no object ID or camera")
+	}
+	return m, nil
+}
+
+// Subscriber receives Frigate's events over MQTT, reconnecting with backoff
+// when the broker goes away.
+type Subscriber struct {
+	config  Config
+	handler func(Message)
+}
+
+func NewSubscriber(cfg Config, handler func(Message)) *Subscriber {
+	return &Subscriber{config: cfg, handler: handler}
+}
+
+// Start subscribes until ctx is done.
+func (s *Subscriber) Start(ctx context.Context) {
+	go func() {
+		delay := retryMin
+		for {
+			started := time.Now()
+			err := s.run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if time.Since(started) > retryMax {
+				delay = retryMin
+			}
+			log.Printf("Warning: Frigate MQTT connection failed: %v, retrying in %s", err, delay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, retryMax)
+		}
+	}()
+}
+
+func (s *Subscriber) run(ctx context.Context) error {
+	conn, err := dialMQTT(ctx, s.config.Broker, s.config.ClientID)
+	if err != nil {
+		return err
+	}
+	topic := strings.TrimSuffix(s.config.TopicPrefix, "/") + "/events"
+	if err := conn.subscribe(topic); err != nil {
+		conn.close()
+		return err
+	}
+	log.Printf("Subscribed to Frigate events on %s", topic)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(mqttKeepAlive / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				conn.close()
+				return
+			case <-done:
+				conn.close()
+				return
+			case <-ticker.C:
+				conn.ping()
+			}
+		}
+	}()
+
+	for {
+		_, payload, err := conn.readPublish()
+		if err != nil {
+			return err
+		}
+		m, err := ParseMessage(payload)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		s.handler(m)
+	}
+}
@@ -0,0 +1,224 @@
+package frigate
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types, shifted into the high nibble.
+const (
+	mqttConnect     = 0x10
+	mqttConnAck     = 0x20
+	mqttPublish     = 0x30
+	mqttPubAck      = 0x40
+	mqttSubscribe   = 0x82
+	mqttSubAck      = 0x90
+	mqttPingReq     = 0xc0
+	mqttDisconnect  = 0xe0
+	mqttKeepAlive   = 60 * time.Second
+	mqttDialTimeout = 10 * time.Second
+	// maxPacket bounds a packet from the broker; Frigate events are a few
+	// kilobytes.
+	maxPacket = 1 << 20
+)
+
+var connectErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client ID rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttConn is a subscribe-only MQTT 3.1.1 client connection: it receives
+// publishes at QoS 0 or 1 and keeps itself alive, and does nothing else.
+type mqttConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	wmu  sync.Mutex
+}
+
+// dialMQTT connects to the broker at rawURL, mqtt:// or mqtts:// with
+// optional credentials, as clientID.
+func dialMQTT(ctx context.Context, rawURL, clientID string) (*mqttConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: mqttDialTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "mqtt", "tcp":
+		conn, err = dialer.DialContext(ctx, "tcp", hostPort(u, "1883"))
+	case "mqtts", "ssl", "tls":
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: u.Hostname()}}).DialContext(ctx, "tcp", hostPort(u, "8883"))
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &mqttConn{conn: conn, r: bufio.NewReader(conn)}
+
+	flags := byte(0x02) // clean session
+	payload := mqttString(clientID)
+	if u.User != nil {
+		flags |= 0x80
+		payload = append(payload, mqttString(u.User.Username())...)
+		if password, ok := u.User.Password(); ok {
+			flags |= 0x40
+			payload = append(payload, mqttString(password)...)
+		}
+	}
+	header := append(mqttString("MQTT"), 4, flags, 0, 0)
+	binary.BigEndian.PutUint16(header[len(header)-2:], uint16(mqttKeepAlive/time.Second))
+
+	conn.SetDeadline(time.Now().Add(mqttDialTimeout))
+	if err := c.write(mqttConnect, append(header, payload...)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	kind, body, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if kind != mqttConnAck || len(body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected reply to connect")
+	}
+	if code := body[1]; code != 0 {
+		conn.Close()
+		if msg, ok := connectErrors[code]; ok {
+			return nil, fmt.Errorf("broker refused the connection: %s", msg)
+		}
+		return nil, fmt.Errorf("broker refused the connection: code %d", code)
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// subscribe asks for topic at QoS 0; the reply is checked by readPublish.
+func (c *mqttConn) subscribe(topic string) error {
+	body := append([]byte{0, 1}, mqttString(topic)...)
+	return c.write(mqttSubscribe, append(body, 0))
+}
+
+// readPublish returns the next message, answering the broker's other
+// packets on the way.
+func (c *mqttConn) readPublish() (string, []byte, error) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(mqttKeepAlive * 3 / 2))
+		kind, body, err := c.read()
+		if err != nil {
+			return "", nil, err
+		}
+		switch kind & 0xf0 {
+		case mqttPublish:
+			if len(body) < 2 {
+				return "", nil, fmt.Errorf("malformed publish")
+			}
+			n := int(binary.BigEndian.Uint16(body))
+			if len(body) < 2+n {
+				return "", nil, fmt.Errorf("malformed publish")
+			}
+			topic, rest := string(body[2:2+n]), body[2+n:]
+			if qos := kind >> 1 & 3; qos > 0 {
+				if len(rest) < 2 {
+					return "", nil, fmt.Errorf("malformed publish")
+				}
+				if err := c.write(mqttPubAck, rest[:2]); err != nil {
+					return "", nil, err
+				}
+				rest = rest[2:]
+			}
+			return topic, rest, nil
+		case mqttSubAck:
+			if len(body) == 3 && body[2] == 0x80 {
+				return "", nil, fmt.Errorf("broker refused the subscription")
+			}
+		}
+	}
+}
+
+func (c *mqttConn) ping() error {
+	return c.write(mqttPingReq, nil)
+}
+
+func (c *mqttConn) close() {
+	c.write(mqttDisconnect, nil)
+	c.conn.Close()
+}
+
+func (c *mqttConn) write(kind byte, body []byte) error {
+	packet := []byte{kind}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(mqttDialTimeout))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+func (c *mqttConn) read() (byte, []byte, error) {
+	kind, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("malformed packet length")
+		}
+	}
+	if n > maxPacket {
+		return 0, nil, fmt.Errorf("packet too large")
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return kind, body, nil
+}
+
+func mqttString(s string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,83 @@
+// Package i18n translates the web UI. Messages are keyed by their English
+// text, which is also what a language pack falls back to for anything it
+// does not translate.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const Default = "en"
+
+type Language struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	messages map[string]string
+}
+
+var languages = map[string]*Language{
+	"en": {Code: "en", Name: "English", messages: map[string]string{}},
+	"th": {Code: "th", Name: "ไทย", messages: thai},
+}
+
+func Lookup(code string) (*Language, bool) {
+	lang, ok := languages[strings.ToLower(code)]
+	return lang, ok
+}
+
+// Get returns the language for code, or the default one.
+func Get(code string) *Language {
+	if lang, ok := Lookup(code); ok {
+		return lang
+	}
+	return languages[Default]
+}
+
+func Supported() []*Language {
+	list := make([]*Language, 0, len(languages))
+	for _, lang := range languages {
+		list = append(list, lang)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// T translates key and formats it with args like fmt.Sprintf.
+func (l *Language) T(key string, args ...any) string {
+	msg, ok := l.messages[key]
+	if !ok {
+		msg = key
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Messages returns the translations of the language, for scripts in the page.
+func (l *Language) Messages() map[string]string {
+	return l.messages
+}
+
+// Match picks the supported language the browser prefers most from an
+// Accept-Language header, or the default when none is supported.
+func Match(acceptLanguage string) string {
+	best, bestQ := Default, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		base, _, _ := strings.Cut(tag, "-")
+		if _, ok := Lookup(base); ok && q > bestQ {
+			best, bestQ = strings.ToLower(base), q
+		}
+	}
+	return best
+}
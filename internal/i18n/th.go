@@ -0,0 +1,360 @@
+package i18n
+
+var thai = map[string]string{
+	// Pages
+	"%d days":                                "%d วัน",
+	"%d of %d":                               "%d จาก %d",
+	"%d new recordings, click to refresh":    "มีไฟล์บันทึกใหม่ %d ไฟล์ คลิกเพื่อรีเฟรช",
+	"%d watching":                            "กำลังดู %d คน",
+	"%dx · keyframes":                        "%dx · เฉพาะคีย์เฟรม",
+	"%s (%d files)":                          "%s (%d ไฟล์)",
+	"%s (%d recordings)":                     "%s (%d ไฟล์บันทึก)",
+	"%s (live)":                              "%s (สด)",
+	"%s - Camera Recorder":                   "%s - เครื่องบันทึกกล้อง",
+	"%s live view":                           "ภาพสดจาก %s",
+	"%s of %s (%d files)":                    "%s จาก %s (%d ไฟล์)",
+	"A zone needs at least 3 points":         "โซนต้องมีอย่างน้อย 3 จุด",
+	"Add Camera":                             "เพิ่มกล้อง",
+	"Alarm":                                  "สัญญาณเตือน",
+	"All Cameras":                            "กล้องทั้งหมด",
+	"All Events":                             "ทุกเหตุการณ์",
+	"All Tags":                               "ทุกแท็ก",
+	"All days":                               "ทุกวัน",
+	"Always":                                 "ตลอดเวลา",
+	"Archived":                               "เก็บถาวร",
+	"Are you sure you want to delete %s?":    "ต้องการลบ %s ใช่หรือไม่?",
+	"Ask the camera for its brand and model": "ถามยี่ห้อและรุ่นจากกล้อง",
+	"Audio":                                  "เสียง",
+	"Automatic":                              "อัตโนมัติ",
+	"Average bitrate":                        "บิตเรตเฉลี่ย",
+	"Bitrate":                                "บิตเรต",
+	"Brand":                                  "ยี่ห้อ",
+	"Camera Disabled":                        "ปิดใช้งานกล้อง",
+	"Camera Recorder":                        "เครื่องบันทึกกล้อง",
+	"Camera:":                                "กล้อง:",
+	"Cameras:":                               "กล้อง:",
+	"Capture Burst":                          "บันทึกภาพต่อเนื่อง",
+	"Channel":                                "ช่อง",
+	"Checked %s":                             "ตรวจเมื่อ %s",
+	"Click the picture to draw a zone, then finish it. Only motion inside zones raises events; without zones the whole picture counts.": "คลิกบนภาพเพื่อวาดโซน แล้วกดจบโซน เฉพาะการเคลื่อนไหวในโซนเท่านั้นที่จะสร้างเหตุการณ์ หากไม่มีโซนจะนับทั้งภาพ",
+	"Columns:":                            "จำนวนคอลัมน์:",
+	"Connecting":                          "กำลังเชื่อมต่อ",
+	"Connecting...":                       "กำลังเชื่อมต่อ...",
+	"Controls":                            "การควบคุม",
+	"Current live viewers, including you": "ผู้ที่กำลังดูภาพสด รวมถึงคุณ",
+	"Custom":                              "กำหนดเอง",
+	"Custom path":                         "พาธกำหนดเอง",
+	"Dark":                                "มืด",
+	"Day %s":                              "วันที่ %s",
+	"Degraded":                            "คุณภาพลดลง",
+	"Delete":                              "ลบ",
+	"Details":                             "รายละเอียด",
+	"Detect":                              "ตรวจหา",
+	"Detect motion in the picture":        "ตรวจจับการเคลื่อนไหวในภาพ",
+	"Detected %s, which has no known paths; all of them will be tried.": "พบ %s ซึ่งไม่มีพาธที่รู้จัก จะลองทุกพาธ",
+	"Detected %s.":                       "พบ %s",
+	"Detecting...":                       "กำลังตรวจหา...",
+	"Disabled":                           "ปิดใช้งาน",
+	"Display":                            "การแสดงผล",
+	"Download":                           "ดาวน์โหลด",
+	"Downtime":                           "เวลาที่ออฟไลน์",
+	"Drag cameras to reorder them.":      "ลากกล้องเพื่อจัดลำดับใหม่",
+	"Enable Alerts":                      "เปิดการแจ้งเตือน",
+	"Enter a name for the camera first.": "กรุณาตั้งชื่อกล้องก่อน",
+	"Enter the camera's address and credentials, then test which stream paths answer.": "กรอกที่อยู่และข้อมูลเข้าสู่ระบบของกล้อง แล้วทดสอบว่าพาธสตรีมใดตอบกลับ",
+	"Error":     "ข้อผิดพลาด",
+	"Error: %s": "ข้อผิดพลาด: %s",
+	"Events":    "เหตุการณ์",
+	"Every day": "ทุกวัน",
+	"Extra watermark text, e.g. a case number (optional):": "ข้อความลายน้ำเพิ่มเติม เช่น เลขคดี (ไม่บังคับ):",
+	"Failed":                                              "ล้มเหลว",
+	"Failed to create link: %s":                           "สร้างลิงก์ไม่สำเร็จ: %s",
+	"Failed to delete recording: %s":                      "ลบไฟล์บันทึกไม่สำเร็จ: %s",
+	"Failed to enable alerts: %s":                         "เปิดการแจ้งเตือนไม่สำเร็จ: %s",
+	"Failed to load recordings: %s":                       "โหลดรายการบันทึกไม่สำเร็จ: %s",
+	"Failed to load statistics":                           "โหลดสถิติไม่สำเร็จ",
+	"Failed to pause camera: %s":                          "หยุดกล้องชั่วคราวไม่สำเร็จ: %s",
+	"Failed to power-cycle camera: %s":                    "ปิดแล้วเปิดกล้องใหม่ไม่สำเร็จ: %s",
+	"Failed to resume camera: %s":                         "บันทึกต่อไม่สำเร็จ: %s",
+	"Failed to save preferences: %s":                      "บันทึกการตั้งค่าไม่สำเร็จ: %s",
+	"Failed to start camera: %s":                          "เริ่มกล้องไม่สำเร็จ: %s",
+	"Failed to start live video: %s":                      "เริ่มวิดีโอสดไม่สำเร็จ: %s",
+	"Failed to stop camera: %s":                           "หยุดกล้องไม่สำเร็จ: %s",
+	"Fast review unavailable, playing the full recording": "ไม่สามารถดูแบบเร่งได้ กำลังเล่นไฟล์บันทึกเต็ม",
+	"File Count:":                                         "จำนวนไฟล์:",
+	"File:":                                               "ไฟล์:",
+	"Finish zone":                                         "จบโซน",
+	"Firmware %s":                                         "เฟิร์มแวร์ %s",
+	"Floor Plan":                                          "ผังชั้น",
+	"Frames or packets were lost while recording":         "มีเฟรมหรือแพ็กเก็ตสูญหายระหว่างบันทึก",
+	"Full video":                                          "วิดีโอเต็ม",
+	"Go Back":                                             "ย้อนกลับ",
+	"IP Camera Recorder":                                  "เครื่องบันทึกกล้อง IP",
+	"IP address":                                          "ที่อยู่ IP",
+	"Idle (outside schedule)":                             "ว่าง (นอกตารางเวลา)",
+	"Intrusion":                                           "การบุกรุก",
+	"Keyframes":                                           "เฉพาะคีย์เฟรม",
+	"Language:":                                           "ภาษา:",
+	"Last 60 seconds":                                     "60 วินาทีล่าสุด",
+	"Last %d days":                                        "%d วันล่าสุด",
+	"Latest %d events only.":                              "แสดงเฉพาะ %d เหตุการณ์ล่าสุด",
+	"Light":                                               "สว่าง",
+	"Line crossing":                                       "ข้ามเส้น",
+	"Link expires:":                                       "ลิงก์หมดอายุ:",
+	"Link valid for (e.g. 24h, 72h):":                     "ลิงก์ใช้ได้นาน (เช่น 24h, 72h):",
+	"Live View":                                           "ภาพสด",
+	"Loading...":                                          "กำลังโหลด...",
+	"Low latency":                                         "หน่วงต่ำ",
+	"Main stream":                                         "สตรีมหลัก",
+	"Make Default":                                        "ตั้งเป็นค่าเริ่มต้น",
+	"Map":                                                 "แผนที่",
+	"Maximum views (0 = unlimited):":                      "จำนวนครั้งที่ดูได้สูงสุด (0 = ไม่จำกัด):",
+	"Motion":                                              "การเคลื่อนไหว",
+	"Motion Detection":                                    "ตรวจจับการเคลื่อนไหว",
+	"Motion events":                                       "เหตุการณ์การเคลื่อนไหว",
+	"Motion settings saved":                               "บันทึกการตั้งค่าการเคลื่อนไหวแล้ว",
+	"Mute":                                                "ปิดเสียง",
+	"Name":                                                "ชื่อ",
+	"Newer":                                               "ใหม่กว่า",
+	"No camera data":                                      "ไม่มีข้อมูลกล้อง",
+	"No cameras configured.":                              "ยังไม่ได้ตั้งค่ากล้อง",
+	"No cameras configured. Edit config.yaml to add cameras.": "ยังไม่ได้ตั้งค่ากล้อง แก้ไข config.yaml เพื่อเพิ่มกล้อง",
+	"No cameras placed yet.":                                  "ยังไม่ได้วางกล้องบนแผนที่",
+	"No events on this day.":                                  "ไม่มีเหตุการณ์ในวันนี้",
+	"No matching cameras.":                                    "ไม่มีกล้องที่ตรงกับแท็กนี้",
+	"No recording found":                                      "ไม่พบการบันทึก",
+	"No recordings found.":                                    "ไม่พบไฟล์บันทึก",
+	"No time-lapse videos yet. Set timelapse_interval on a camera; videos are built after each day ends.": "ยังไม่มีวิดีโอไทม์แลปส์ ตั้งค่า timelapse_interval ให้กล้อง วิดีโอจะถูกสร้างหลังสิ้นสุดแต่ละวัน",
+	"Not on the map:":              "ไม่อยู่บนแผนที่:",
+	"Note:":                        "หมายเหตุ:",
+	"Older":                        "เก่ากว่า",
+	"Online":                       "ออนไลน์",
+	"Only the keyframes were kept": "เก็บไว้เฉพาะคีย์เฟรม",
+	"Open in OpenStreetMap:":       "เปิดใน OpenStreetMap:",
+	"Open the recordings page with this camera and search": "เปิดหน้าไฟล์บันทึกด้วยกล้องและคำค้นหานี้",
+	"Page %d of %d":          "หน้า %d จาก %d",
+	"Password":               "รหัสผ่าน",
+	"Pause":                  "หยุดชั่วคราว",
+	"Paused":                 "หยุดชั่วคราว",
+	"Per Camera":             "แยกตามกล้อง",
+	"Per day":                "ต่อวัน",
+	"Place a camera...":      "วางกล้อง...",
+	"Play":                   "เล่น",
+	"Play Recording":         "เล่นไฟล์บันทึก",
+	"Poor":                   "คุณภาพต่ำ",
+	"Port":                   "พอร์ต",
+	"Power Cycle":            "ปิดแล้วเปิดใหม่",
+	"Preparing fast review…": "กำลังเตรียมการดูแบบเร่ง…",
+	"Push notifications are not supported in this browser": "เบราว์เซอร์นี้ไม่รองรับการแจ้งเตือนแบบพุช",
+	"Quality:":                          "คุณภาพ:",
+	"Queued (transcode limit)":          "รอคิว (เกินขีดจำกัดการแปลงไฟล์)",
+	"RTSP URL:":                         "URL ของ RTSP:",
+	"Re-encoded to save space":          "เข้ารหัสใหม่ด้วยคุณภาพต่ำลงเพื่อประหยัดพื้นที่",
+	"Record at full quality now":        "บันทึกวิดีโอคุณภาพเต็มทันที",
+	"Recorded":                          "บันทึกแล้ว",
+	"Recorded hours":                    "ชั่วโมงที่บันทึก",
+	"Recording":                         "กำลังบันทึก",
+	"Recording deleted":                 "ลบไฟล์บันทึกแล้ว",
+	"Recordings":                        "ไฟล์บันทึก",
+	"Refresh":                           "รีเฟรช",
+	"Remove":                            "ลบ",
+	"Remove Floor Plan":                 "ลบผังชั้น",
+	"Remove the floor plan?":            "ลบผังชั้นหรือไม่?",
+	"Replace Floor Plan":                "เปลี่ยนผังชั้น",
+	"Resume":                            "บันทึกต่อ",
+	"Retention:":                        "เก็บไว้:",
+	"Retrying":                          "กำลังลองใหม่",
+	"Save":                              "บันทึก",
+	"Search recordings...":              "ค้นหาไฟล์บันทึก...",
+	"Sensitivity":                       "ความไว",
+	"Serial %s":                         "ซีเรียล %s",
+	"Settings for":                      "การตั้งค่าสำหรับ",
+	"Share Link":                        "แชร์ลิงก์",
+	"Share link (copied to clipboard):": "ลิงก์แชร์ (คัดลอกไปยังคลิปบอร์ดแล้ว):",
+	"Shared %s":                         "แชร์ %s",
+	"Sign In":                           "เข้าสู่ระบบ",
+	"Sign Out":                          "ออกจากระบบ",
+	"Sign in with %s":                   "เข้าสู่ระบบด้วย %s",
+	"Site":                              "พื้นที่",
+	"Speed:":                            "ความเร็ว:",
+	"Stamp the watermark on the shared video?": "ใส่ลายน้ำบนวิดีโอที่แชร์หรือไม่?",
+	"Standby":                       "สแตนด์บาย",
+	"Static":                        "ภาพนิ่ง",
+	"Start":                         "เริ่ม",
+	"Start Recording":               "เริ่มบันทึก",
+	"Statistics":                    "สถิติ",
+	"Status":                        "สถานะ",
+	"Status:":                       "สถานะ:",
+	"Stop":                          "หยุด",
+	"Stop Recording":                "หยุดบันทึก",
+	"Stopped":                       "หยุดแล้ว",
+	"Show recordings from this day": "แสดงไฟล์บันทึกของวันที่เลือก",
+	"Storage":                       "พื้นที่จัดเก็บ",
+	"Storage used":                  "พื้นที่ที่ใช้",
+	"Storage:":                      "พื้นที่จัดเก็บ:",
+	"Sub stream":                    "สตรีมรอง",
+	"Switch %s off and on again?":   "ปิดแล้วเปิด %s ใหม่หรือไม่?",
+	"System":                        "ตามระบบ",
+	"System Status":                 "สถานะระบบ",
+	"Tag:":                          "แท็ก:",
+	"Tamper":                        "การรบกวนกล้อง",
+	"Test":                          "ทดสอบ",
+	"Testing...":                    "กำลังทดสอบ...",
+	"The picture barely changed":    "ภาพแทบไม่เปลี่ยนแปลง",
+	"Theme:":                        "ธีม:",
+	"Then click the floor plan":     "แล้วคลิกบนผังชั้น",
+	"This schedule uses the camera's own zones until you draw some.": "ตารางเวลานี้ใช้โซนของกล้องจนกว่าคุณจะวาดโซนเอง",
+	"Time-lapse":         "ไทม์แลปส์",
+	"Total Size:":        "ขนาดรวม:",
+	"Trigger":            "สั่งบันทึก",
+	"Try all":            "ลองทั้งหมด",
+	"Undo point":         "ย้อนจุด",
+	"Unknown vendor":     "ไม่ทราบผู้ผลิต",
+	"Unmute":             "เปิดเสียง",
+	"Upload Floor Plan":  "อัปโหลดผังชั้น",
+	"Uptime:":            "เวลาทำงาน:",
+	"Username":           "ชื่อผู้ใช้",
+	"Video + audio":      "วิดีโอ + เสียง",
+	"Views:":             "จำนวนการดู:",
+	"Waiting for camera": "รอให้กล้องตอบสนอง",
+	"Week of %s":         "สัปดาห์ของ %s",
+	"Works":              "ใช้งานได้",
+	"Your browser does not support the video tag.": "เบราว์เซอร์ของคุณไม่รองรับการเล่นวิดีโอ",
+	"Zone %d":                         "โซน %d",
+	"Zone name":                       "ชื่อโซน",
+	"daily":                           "รายวัน",
+	"down for %.1fh":                  "ออฟไลน์ %.1f ชม.",
+	"max %s":                          "สูงสุด %s",
+	"recorded %.1fh, median is %.1fh": "บันทึก %.1f ชม. ค่ามัธยฐานคือ %.1f ชม.",
+	"used %.1fx the median storage":   "ใช้พื้นที่ %.1f เท่าของค่ามัธยฐาน",
+	"weekly":                          "รายสัปดาห์",
+
+	// API messages
+	"%s has too many viewers, try again later":          "มีผู้ชม %s มากเกินไป โปรดลองใหม่ภายหลัง",
+	"%s is not allowed to use the recorder":             "%s ไม่ได้รับอนุญาตให้ใช้เครื่องบันทึก",
+	"A burst of the camera is already being captured":   "กำลังบันทึกภาพต่อเนื่องของกล้องนี้อยู่แล้ว",
+	"A reconciliation is already running":               "กำลังตรวจสอบความสอดคล้องของดัชนีอยู่แล้ว",
+	"An import is already running":                      "กำลังนำเข้าอยู่แล้ว",
+	"An integrity check is already running":             "กำลังตรวจสอบความสมบูรณ์อยู่แล้ว",
+	"Backup staged; restart the recorder to restore it": "เตรียมข้อมูลสำรองแล้ว รีสตาร์ตเครื่องบันทึกเพื่อกู้คืน",
+	"Burst captured":                                     "บันทึกภาพต่อเนื่องแล้ว",
+	"Camera added":                                       "เพิ่มกล้องแล้ว",
+	"Camera not found":                                   "ไม่พบกล้อง",
+	"Camera not found: %s":                               "ไม่พบกล้อง: %s",
+	"Camera power-cycled":                                "ปิดแล้วเปิดกล้องใหม่แล้ว",
+	"Camera started":                                     "เริ่มกล้องแล้ว",
+	"Camera stopped":                                     "หยุดกล้องแล้ว",
+	"Camera updated":                                     "อัปเดตกล้องแล้ว",
+	"Cameras imported":                                   "นำเข้ากล้องแล้ว",
+	"Capture is not available":                           "ไม่สามารถบันทึกภาพต่อเนื่องได้",
+	"Config imported":                                    "นำเข้าการตั้งค่าแล้ว",
+	"Event ignored":                                      "ไม่สนใจเหตุการณ์นี้",
+	"Event recorded":                                     "บันทึกเหตุการณ์แล้ว",
+	"Failed to capture a burst: %s":                      "บันทึกภาพต่อเนื่องไม่สำเร็จ: %s",
+	"Failed to generate thumbnail: %v":                   "สร้างภาพตัวอย่างไม่สำเร็จ: %v",
+	"Failed to power-cycle the camera: %s":               "ปิดแล้วเปิดกล้องใหม่ไม่สำเร็จ: %s",
+	"Failover is not configured":                         "ไม่ได้ตั้งค่าการสำรองระบบ",
+	"File deleted":                                       "ลบไฟล์แล้ว",
+	"File not found":                                     "ไม่พบไฟล์",
+	"Floor plan removed":                                 "ลบผังชั้นแล้ว",
+	"Floor plan uploaded":                                "อัปโหลดผังชั้นแล้ว",
+	"Import started":                                     "เริ่มนำเข้าแล้ว",
+	"Integrity check started":                            "เริ่มตรวจสอบความสมบูรณ์แล้ว",
+	"Integrity checks are not available":                 "ไม่มีระบบตรวจสอบความสมบูรณ์",
+	"Invalid user name or password":                      "ชื่อผู้ใช้หรือรหัสผ่านไม่ถูกต้อง",
+	"Live stream not running":                            "ไม่มีการสตรีมสด",
+	"Logo removed":                                       "ลบโลโก้แล้ว",
+	"Logo uploaded":                                      "อัปโหลดโลโก้แล้ว",
+	"No floor plan uploaded":                             "ยังไม่ได้อัปโหลดผังชั้น",
+	"No logo uploaded":                                   "ยังไม่ได้อัปโหลดโลโก้",
+	"No recording covers that time":                      "ไม่มีไฟล์บันทึกในช่วงเวลานั้น",
+	"No recordings in that range":                        "ไม่มีไฟล์บันทึกในช่วงนั้น",
+	"No snapshot available":                              "ไม่มีภาพนิ่ง",
+	"No watermark text or logo is configured":            "ยังไม่ได้ตั้งค่าข้อความหรือโลโก้ลายน้ำ",
+	"Not found":                                          "ไม่พบ",
+	"Only admins can do this":                            "เฉพาะผู้ดูแลระบบเท่านั้นที่ทำได้",
+	"Only recordings can be watermarked":                 "ใส่ลายน้ำได้เฉพาะไฟล์บันทึก",
+	"Push notifications are disabled":                    "ปิดการแจ้งเตือนแบบพุชอยู่",
+	"Reconciliation is not available":                    "ไม่มีระบบตรวจสอบความสอดคล้องของดัชนี",
+	"Reconciliation started":                             "เริ่มตรวจสอบความสอดคล้องของดัชนีแล้ว",
+	"Recording cannot be played: %v":                     "ไม่สามารถเล่นไฟล์บันทึกได้: %v",
+	"Recording paused":                                   "หยุดบันทึกชั่วคราวแล้ว",
+	"Recording resumed":                                  "บันทึกต่อแล้ว",
+	"Recording triggered":                                "สั่งบันทึกแล้ว",
+	"Replay unavailable: %v":                             "ไม่สามารถดึงภาพย้อนหลังได้: %v",
+	"Report sent":                                        "ส่งรายงานแล้ว",
+	"Reports are not available":                          "ไม่มีระบบรายงาน",
+	"Scrub proxy unavailable: %v":                        "ไม่สามารถดูแบบเร่งได้: %v",
+	"Share not found or already revoked":                 "ไม่พบลิงก์แชร์หรือถูกยกเลิกแล้ว",
+	"Share revoked":                                      "ยกเลิกลิงก์แชร์แล้ว",
+	"Sign-in failed, see the server log":                 "เข้าสู่ระบบไม่สำเร็จ ดูรายละเอียดในบันทึกของเซิร์ฟเวอร์",
+	"Streaming not supported":                            "ไม่รองรับการสตรีม",
+	"Subscribed":                                         "สมัครรับการแจ้งเตือนแล้ว",
+	"Test notification sent":                             "ส่งการแจ้งเตือนทดสอบแล้ว",
+	"The camera has no power control":                    "กล้องนี้ไม่มีการควบคุมไฟ",
+	"The identity provider cannot be reached":            "ติดต่อผู้ให้บริการยืนยันตัวตนไม่ได้",
+	"The identity provider refused the sign-in: %s":      "ผู้ให้บริการยืนยันตัวตนปฏิเสธการเข้าสู่ระบบ: %s",
+	"The replay buffer is disabled":                      "ปิดบัฟเฟอร์ภาพย้อนหลังอยู่",
+	"The sign-in expired, please try again":              "การเข้าสู่ระบบหมดเวลา โปรดลองอีกครั้ง",
+	"This link is invalid, expired or has been revoked.": "ลิงก์นี้ไม่ถูกต้อง หมดอายุ หรือถูกยกเลิกแล้ว",
+	"Thumbnail generation is busy":                       "ระบบสร้างภาพตัวอย่างไม่ว่าง",
+	"Too many live streams open, close some first":       "เปิดภาพสดไว้มากเกินไป โปรดปิดบางรายการก่อน",
+	"Unknown share":                                      "ไม่รู้จักลิงก์แชร์นี้",
+	"Unsubscribed":                                       "ยกเลิกการรับการแจ้งเตือนแล้ว",
+	"View limit reached":                                 "ครบจำนวนการดูแล้ว",
+	"Watermarked copy unavailable":                       "ไม่สามารถสร้างสำเนาที่มีลายน้ำได้",
+	"Watermarked exports are limited to %d recordings":   "การส่งออกแบบมีลายน้ำจำกัดไว้ที่ %d ไฟล์",
+	"a benchmark is already running":                     "กำลังทดสอบความเร็วดิสก์อยู่แล้ว",
+	"a camera named %s already exists":                   "มีกล้องชื่อ %s อยู่แล้ว",
+	"at is required as an RFC3339 time":                  "ต้องระบุ at เป็นเวลาแบบ RFC3339",
+	"camera %s not found":                                "ไม่พบกล้อง %s",
+	"camera added but not saved: %v":                     "เพิ่มกล้องแล้วแต่บันทึกไม่สำเร็จ: %v",
+	"camera could not be identified: %v":                 "ไม่สามารถระบุกล้องได้: %v",
+	"camera is required":                                 "ต้องระบุ camera",
+	"camera or cameras is required":                      "ต้องระบุ camera หรือ cameras",
+	"camera unreachable":                                 "ติดต่อกล้องไม่ได้",
+	"camera updated but not saved: %v":                   "อัปเดตกล้องแล้วแต่บันทึกไม่สำเร็จ: %v",
+	"cameras applied but not saved: %v":                  "ใช้การตั้งค่ากล้องแล้วแต่บันทึกไม่สำเร็จ: %v",
+	"channel must be between 1 and 256":                  "ช่องต้องอยู่ระหว่าง 1 ถึง 256",
+	"config applied but not saved: %v":                   "ใช้การตั้งค่าแล้วแต่บันทึกไม่สำเร็จ: %v",
+	"config has no file path":                            "การตั้งค่าไม่มีไฟล์",
+	"connection refused":                                 "กล้องปฏิเสธการเชื่อมต่อ",
+	"days must be between 1 and %d":                      "days ต้องอยู่ระหว่าง 1 ถึง %d",
+	"duration must be between 1s and %s":                 "duration ต้องอยู่ระหว่าง 1s ถึง %s",
+	"failed to read request body":                        "อ่านข้อมูลคำขอไม่สำเร็จ",
+	"floor plan must be a PNG or JPEG image":             "ผังชั้นต้องเป็นรูปภาพ PNG หรือ JPEG",
+	"floor plan must be at most %d MB":                   "ผังชั้นต้องมีขนาดไม่เกิน %d MB",
+	"from is required as an RFC3339 time":                "ต้องระบุ from เป็นเวลาแบบ RFC3339",
+	"give between 1 and %d paths":                        "ระบุพาธระหว่าง 1 ถึง %d รายการ",
+	"grid_columns must be between 0 (automatic) and %d":  "grid_columns ต้องอยู่ระหว่าง 0 (อัตโนมัติ) ถึง %d",
+	"host must be an IP address or host name":            "host ต้องเป็นที่อยู่ IP หรือชื่อโฮสต์",
+	"invalid API key":                                    "API key ไม่ถูกต้อง",
+	"invalid duration %q":                                "ระยะเวลา %q ไม่ถูกต้อง",
+	"invalid event token":                                "โทเค็นเหตุการณ์ไม่ถูกต้อง",
+	"invalid kiosk token":                                "โทเค็นคีออสก์ไม่ถูกต้อง",
+	"invalid expires_in %q":                              "expires_in %q ไม่ถูกต้อง",
+	"invalid since duration":                             "ระยะเวลา since ไม่ถูกต้อง",
+	"logo must be a PNG or JPEG image":                   "โลโก้ต้องเป็นภาพ PNG หรือ JPEG",
+	"logo must be at most %d MB":                         "โลโก้ต้องมีขนาดไม่เกิน %d MB",
+	"max_views must not be negative":                     "max_views ต้องไม่ติดลบ",
+	"no API keys configured":                             "ยังไม่ได้ตั้งค่า API key",
+	"no answer from the camera":                          "กล้องไม่ตอบสนอง",
+	"no changes requested":                               "ไม่มีการเปลี่ยนแปลง",
+	"no ffmpeg command was recorded for this recording":  "ไม่มีคำสั่ง ffmpeg ที่บันทึกไว้สำหรับไฟล์นี้",
+	"no stream on this path":                             "ไม่มีสตรีมที่พาธนี้",
+	"period must be daily or weekly":                     "period ต้องเป็น daily หรือ weekly",
+	"port must be between 1 and 65535":                   "port ต้องอยู่ระหว่าง 1 ถึง 65535",
+	"rate limit exceeded":                                "ส่งคำขอเกินขีดจำกัด",
+	"seconds must be between 1 and %d":                   "seconds ต้องอยู่ระหว่าง 1 ถึง %d",
+	"sidecar must be json or xml":                        "sidecar ต้องเป็น json หรือ xml",
+	"sign in required":                                   "ต้องเข้าสู่ระบบ",
+	"size_mb must be between 1 and 1024":                 "size_mb ต้องอยู่ระหว่าง 1 ถึง 1024",
+	"snapshots must be between 0 and %d":                 "snapshots ต้องอยู่ระหว่าง 0 ถึง %d",
+	"stream could not be read":                           "อ่านสตรีมไม่ได้",
+	"theme must be dark, light or system":                "theme ต้องเป็น dark, light หรือ system",
+	"to is required as an RFC3339 time after from":       "ต้องระบุ to เป็นเวลาแบบ RFC3339 ที่อยู่หลัง from",
+	"too many failed attempts, try again later":          "ลองผิดหลายครั้งเกินไป โปรดลองใหม่ภายหลัง",
+	"unknown camera vendor %s":                           "ไม่รู้จักยี่ห้อกล้อง %s",
+	"unsupported language %q":                            "ไม่รองรับภาษา %q",
+	"wrong username or password":                         "ชื่อผู้ใช้หรือรหัสผ่านไม่ถูกต้อง",
+}
@@ -0,0 +1,103 @@
+package ical
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	utcFormat      = "20060102T150405Z"
+	floatingFormat = "20060102T150405"
+	maxLineOctets  = 75
+)
+
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	// Floating events are written without a time zone so calendar apps
+	// show them at the same wall-clock time wherever they are viewed.
+	Floating bool
+	RRule    string
+}
+
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	stamp := time.Now().UTC().Format(utcFormat)
+
+	writeLine(&buf, "BEGIN:VCALENDAR")
+	writeLine(&buf, "VERSION:2.0")
+	writeLine(&buf, "PRODID:-//cam-recorder//EN")
+	writeLine(&buf, "CALSCALE:GREGORIAN")
+	writeLine(&buf, "METHOD:PUBLISH")
+	if c.Name != "" {
+		writeLine(&buf, "X-WR-CALNAME:"+escape(c.Name))
+	}
+
+	for _, ev := range c.Events {
+		writeLine(&buf, "BEGIN:VEVENT")
+		writeLine(&buf, "UID:"+ev.UID)
+		writeLine(&buf, "DTSTAMP:"+stamp)
+		writeLine(&buf, "DTSTART:"+formatTime(ev.Start, ev.Floating))
+		writeLine(&buf, "DTEND:"+formatTime(ev.End, ev.Floating))
+		if ev.RRule != "" {
+			writeLine(&buf, "RRULE:"+ev.RRule)
+		}
+		writeLine(&buf, "SUMMARY:"+escape(ev.Summary))
+		if ev.Description != "" {
+			writeLine(&buf, "DESCRIPTION:"+escape(ev.Description))
+		}
+		if ev.URL != "" {
+			writeLine(&buf, "URL:"+ev.URL)
+		}
+		writeLine(&buf, "END:VEVENT")
+	}
+
+	writeLine(&buf, "END:VCALENDAR")
+
+	return buf.WriteTo(w)
+}
+
+func formatTime(t time.Time, floating bool) string {
+	if floating {
+		return t.Format(floatingFormat)
+	}
+	return t.UTC().Format(utcFormat)
+}
+
+func escape(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(text)
+}
+
+func writeLine(buf *bytes.Buffer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut])
+		buf.WriteString("\r\n ")
+		line = line[cut:]
+		limit = maxLineOctets - 1
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
@@ -0,0 +1,354 @@
+// Package importer registers video files recorded elsewhere, such as by an
+// NVR being replaced, as segments of a camera, so they show up in search,
+// playback and retention like the camera's own recordings.
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// Where the start of an imported file was taken from.
+const (
+	TimeFromMetadata = "metadata"
+	TimeFromFilename = "filename"
+	TimeFromModified = "modified"
+)
+
+var videoExtensions = []string{".mp4", ".m4v", ".mov", ".mkv", ".avi", ".ts", ".flv"}
+
+// filenameTime matches a date and time in a file name, such as
+// 20250101_120000, 2025-01-01_12-00-00 or 2025-01-01T12.00.00.
+var filenameTime = regexp.MustCompile(`(\d{4})[-_.]?(\d{2})[-_.]?(\d{2})[-_T ]?(\d{2})[-_.:]?(\d{2})[-_.:]?(\d{2})`)
+
+type Options struct {
+	// Camera is the configured camera the files are filed under.
+	Camera string
+	// Dir is searched for video files, including its subdirectories.
+	Dir string
+	// OutputDir and Format are the recordings directory and container.
+	// Files in another container are remuxed into Format.
+	OutputDir string
+	Format    string
+	// Move removes the source files once imported rather than copying them.
+	Move bool
+}
+
+// File is the outcome for one source file.
+type File struct {
+	Source    string    `json:"source"`
+	Filename  string    `json:"filename,omitempty"`
+	StartedAt time.Time `json:"started_at,omitzero"`
+	EndedAt   time.Time `json:"ended_at,omitzero"`
+	TimeFrom  string    `json:"time_from,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+type Result struct {
+	Imported []File `json:"imported"`
+	Skipped  []File `json:"skipped"`
+	Failed   []File `json:"failed"`
+}
+
+// Run imports every video file under opts.Dir. Files already indexed for the
+// camera with the same start and end are skipped, so an interrupted import
+// can be run again.
+func Run(ctx context.Context, idx *index.Index, opts Options) (*Result, error) {
+	if err := Check(opts); err != nil {
+		return nil, err
+	}
+	sources, err := findVideos(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(opts.OutputDir, storage.CameraDirName(opts.Camera))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create camera directory: %w", err)
+	}
+
+	result := &Result{Imported: []File{}, Skipped: []File{}, Failed: []File{}}
+	for _, src := range sources {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		file, err := importFile(ctx, idx, opts, dir, src)
+		switch {
+		case err != nil:
+			file.Reason = err.Error()
+			result.Failed = append(result.Failed, file)
+		case file.Reason != "":
+			result.Skipped = append(result.Skipped, file)
+		default:
+			result.Imported = append(result.Imported, file)
+		}
+	}
+	return result, nil
+}
+
+// Check refuses a directory that cannot be read, or the recordings directory,
+// where the imported files would be found again.
+func Check(opts Options) error {
+	dir := opts.Dir
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open import directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	out, err := filepath.Abs(opts.OutputDir)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(out, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("cannot import from inside the recordings directory")
+	}
+	return nil
+}
+
+func findVideos(dir string) ([]string, error) {
+	var videos []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if IsVideo(path) {
+			videos = append(videos, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list import directory: %w", err)
+	}
+	slices.Sort(videos)
+	return videos, nil
+}
+
+func importFile(ctx context.Context, idx *index.Index, opts Options, dir, src string) (File, error) {
+	file := File{Source: src}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return file, err
+	}
+	probe, err := recorder.Probe(ctx, src)
+	if err != nil {
+		return file, err
+	}
+	file.StartedAt, file.TimeFrom = startTime(src, probe, info.ModTime())
+	file.EndedAt = file.StartedAt.Add(probe.Duration)
+
+	if dup, err := indexed(idx, opts.Camera, file.StartedAt, file.EndedAt); err != nil {
+		return file, err
+	} else if dup != "" {
+		file.Filename = dup
+		file.Reason = "already imported"
+		return file, nil
+	}
+
+	name, err := storage.ClaimName(dir, storage.SegmentFilename(opts.Camera, file.StartedAt, opts.Format))
+	if err != nil {
+		return file, err
+	}
+	dst := filepath.Join(dir, name)
+	if strings.EqualFold(filepath.Ext(src), "."+opts.Format) {
+		err = transfer(src, dst, opts.Move)
+	} else if err = recorder.Remux(ctx, src, dst, file.StartedAt); err == nil && opts.Move {
+		os.Remove(src)
+	}
+	if err != nil {
+		os.Remove(dst)
+		return file, err
+	}
+	// Retention goes by modification time, which for recordings is when
+	// they ended.
+	os.Chtimes(dst, file.EndedAt, file.EndedAt)
+
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return file, err
+	}
+	err = idx.AddSegment(index.Segment{
+		Camera:    opts.Camera,
+		Filename:  name,
+		Path:      dst,
+		StartedAt: file.StartedAt,
+		EndedAt:   file.EndedAt,
+		Size:      dstInfo.Size(),
+		Instance:  probe.Origin.Instance,
+		Site:      probe.Origin.Site,
+	})
+	if err != nil {
+		return file, err
+	}
+	file.Filename = name
+	return file, nil
+}
+
+// IsVideo reports whether name has the extension of a video file.
+func IsVideo(name string) bool {
+	return slices.Contains(videoExtensions, strings.ToLower(filepath.Ext(name)))
+}
+
+// Adopt indexes a file already in a camera's directory but missing from the
+// index, such as one left behind by a crash between writing and indexing,
+// under camera.
+func Adopt(ctx context.Context, idx *index.Index, camera, path string) (File, error) {
+	file := File{Source: path, Filename: filepath.Base(path)}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return file, err
+	}
+	probe, err := recorder.Probe(ctx, path)
+	if err != nil {
+		return file, err
+	}
+	file.StartedAt, file.TimeFrom = startTime(path, probe, info.ModTime())
+	file.EndedAt = file.StartedAt.Add(probe.Duration)
+
+	err = idx.AddSegment(index.Segment{
+		Camera:    camera,
+		Filename:  file.Filename,
+		Path:      path,
+		StartedAt: file.StartedAt,
+		EndedAt:   file.EndedAt,
+		Size:      info.Size(),
+		Instance:  probe.Origin.Instance,
+		Site:      probe.Origin.Site,
+	})
+	return file, err
+}
+
+// startTime works out when a file started recording: from its creation_time
+// tag, a date and time in its name, or else its modification time less its
+// duration. NVRs that never set the clock write tags from 1970, so times
+// before 2000 or in the future are ignored.
+func startTime(path string, probe recorder.FileProbe, modTime time.Time) (time.Time, string) {
+	now := time.Now()
+	plausible := func(t time.Time) bool {
+		return t.Year() >= 2000 && t.Before(now.Add(24*time.Hour))
+	}
+
+	if plausible(probe.CreationTime) {
+		return probe.CreationTime, TimeFromMetadata
+	}
+	if t, ok := nameTime(filepath.Base(path)); ok && plausible(t) {
+		return t, TimeFromFilename
+	}
+	return modTime.Add(-probe.Duration), TimeFromModified
+}
+
+// nameTime parses the first date and time in a file name as local time.
+func nameTime(name string) (time.Time, bool) {
+	m := filenameTime.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	var n [6]int
+	for i := range n {
+		n[i], _ = strconv.Atoi(m[i+1])
+	}
+	t := time.Date(n[0], time.Month(n[1]), n[2], n[3], n[4], n[5], 0, time.Local)
+	// time.Date normalizes out-of-range fields; a match that changed was not
+	// a date.
+	if t.Month() != time.Month(n[1]) || t.Day() != n[2] || t.Hour() != n[3] || t.Minute() != n[4] || t.Second() != n[5] {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// indexed returns the name of a segment of the camera indexed with the same
+// start and end, or "".
+func indexed(idx *index.Index, camera string, startedAt, endedAt time.Time) (string, error) {
+	segments, err := idx.FindSegments(camera, startedAt, startedAt, 0)
+	if err != nil {
+		return "", err
+	}
+	for _, seg := range segments {
+		if seg.StartedAt.UnixMilli() == startedAt.UnixMilli() && seg.EndedAt.UnixMilli() == endedAt.UnixMilli() {
+			return seg.Filename, nil
+		}
+	}
+	return "", nil
+}
+
+// transfer moves or copies src over the placeholder at dst.
+func transfer(src, dst string, move bool) error {
+	if move {
+		if err := os.Rename(src, dst); err == nil {
+			return nil
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to copy: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if move {
+		in.Close()
+		if err := os.Remove(src); err != nil {
+			log.Printf("Warning: Failed to remove imported file %s: %v", src, err)
+		}
+	}
+	return nil
+}
+
+// Expiring counts the imported files that ended before cutoff, which the
+// next retention cleanup removes.
+func (r *Result) Expiring(cutoff time.Time) int {
+	n := 0
+	for _, f := range r.Imported {
+		if f.EndedAt.Before(cutoff) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+package index
+
+import (
+	"fmt"
+	"time"
+)
+
+// AuditEntry is a security-relevant event. Live-view sessions also fill in
+// the viewer, camera, end time and bytes sent.
+type AuditEntry struct {
+	ID      int64     `json:"id"`
+	At      time.Time `json:"at"`
+	Kind    string    `json:"kind"`
+	IP      string    `json:"ip,omitempty"`
+	User    string    `json:"user,omitempty"`
+	Camera  string    `json:"camera,omitempty"`
+	EndedAt time.Time `json:"ended_at,omitzero"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+func (i *Index) AddAudit(entry AuditEntry) error {
+	var endedAt int64
+	if !entry.EndedAt.IsZero() {
+		endedAt = entry.EndedAt.UnixMilli()
+	}
+
+	_, err := i.db.Exec(
+		"INSERT INTO audit_log (at, kind, ip, user, camera, ended_at, bytes, detail) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.At.UnixMilli(), entry.Kind, entry.IP, entry.User, entry.Camera, endedAt, entry.Bytes, entry.Detail,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+func (i *Index) FindAudit(kind, camera string, from, to time.Time, limit int) ([]AuditEntry, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	query := "SELECT id, at, kind, ip, user, camera, ended_at, bytes, detail FROM audit_log WHERE at >= ? AND at <= ?"
+	args := []interface{}{from.UnixMilli(), to.UnixMilli()}
+	if kind != "" {
+		query += " AND kind = ?"
+		args = append(args, kind)
+	}
+	if camera != "" {
+		query += " AND camera = ?"
+		args = append(args, camera)
+	}
+	query += " ORDER BY at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := i.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var at, endedAt int64
+		if err := rows.Scan(&entry.ID, &at, &entry.Kind, &entry.IP, &entry.User, &entry.Camera, &endedAt, &entry.Bytes, &entry.Detail); err != nil {
+			return nil, err
+		}
+		entry.At = time.UnixMilli(at)
+		if endedAt > 0 {
+			entry.EndedAt = time.UnixMilli(endedAt)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
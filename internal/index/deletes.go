@@ -0,0 +1,61 @@
+package index
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// FailedDelete is a recording that was due to be removed but could not be,
+// such as one held open by a player on Windows, waiting to be retried.
+type FailedDelete struct {
+	Path     string    `json:"path"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// AddFailedDelete records a failed attempt to remove the file at path.
+func (i *Index) AddFailedDelete(path, reason string) error {
+	_, err := i.db.Exec(
+		`INSERT INTO failed_deletes (path, error, failed_at) VALUES (?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET
+			error = excluded.error,
+			attempts = attempts + 1,
+			failed_at = excluded.failed_at`,
+		filepath.Clean(path), reason, time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record failed delete: %w", err)
+	}
+	return nil
+}
+
+// FailedDeletes returns the removals waiting to be retried, oldest first.
+func (i *Index) FailedDeletes() ([]FailedDelete, error) {
+	rows, err := i.db.Query("SELECT path, error, attempts, failed_at FROM failed_deletes ORDER BY failed_at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query failed deletes: %w", err)
+	}
+	defer rows.Close()
+
+	deletes := []FailedDelete{}
+	for rows.Next() {
+		var d FailedDelete
+		var failedAt int64
+		if err := rows.Scan(&d.Path, &d.Error, &d.Attempts, &failedAt); err != nil {
+			return nil, err
+		}
+		d.FailedAt = time.UnixMilli(failedAt)
+		deletes = append(deletes, d)
+	}
+	return deletes, rows.Err()
+}
+
+// RemoveFailedDelete forgets the failed removal of path once it succeeded.
+func (i *Index) RemoveFailedDelete(path string) error {
+	if _, err := i.db.Exec("DELETE FROM failed_deletes WHERE path = ?", filepath.Clean(path)); err != nil {
+		return fmt.Errorf("failed to remove failed delete: %w", err)
+	}
+	return nil
+}
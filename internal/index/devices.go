@@ -0,0 +1,58 @@
+package index
+
+import (
+	"fmt"
+	"time"
+)
+
+// Device is the hardware last identified behind a camera.
+type Device struct {
+	Camera       string
+	Source       string
+	Manufacturer string
+	Model        string
+	Firmware     string
+	Serial       string
+	HardwareID   string
+	HTTPServer   string
+	CheckedAt    time.Time
+}
+
+func (i *Index) SetDevice(d Device) error {
+	_, err := i.db.Exec(
+		`INSERT INTO devices (camera, source, manufacturer, model, firmware, serial, hardware_id, http_server, checked_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(camera) DO UPDATE SET source = excluded.source, manufacturer = excluded.manufacturer,
+			model = excluded.model, firmware = excluded.firmware, serial = excluded.serial,
+			hardware_id = excluded.hardware_id, http_server = excluded.http_server, checked_at = excluded.checked_at`,
+		d.Camera, d.Source, d.Manufacturer, d.Model, d.Firmware, d.Serial, d.HardwareID, d.HTTPServer, d.CheckedAt.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save device for %s: %w", d.Camera, err)
+	}
+	return nil
+}
+
+func (i *Index) Devices() ([]Device, error) {
+	rows, err := i.db.Query(
+		`SELECT camera, source, manufacturer, model, firmware, serial, hardware_id, http_server, checked_at
+		FROM devices ORDER BY camera`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query devices: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []Device
+	for rows.Next() {
+		var d Device
+		var checkedAt int64
+		if err := rows.Scan(&d.Camera, &d.Source, &d.Manufacturer, &d.Model, &d.Firmware, &d.Serial, &d.HardwareID, &d.HTTPServer, &checkedAt); err != nil {
+			return nil, err
+		}
+		d.CheckedAt = time.UnixMilli(checkedAt)
+		devices = append(devices, d)
+	}
+
+	return devices, rows.Err()
+}
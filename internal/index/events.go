@@ -0,0 +1,106 @@
+package index
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Event struct {
+	ID        int64     `json:"id"`
+	Camera    string    `json:"camera"`
+	Kind      string    `json:"kind"`
+	Label     string    `json:"label,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+}
+
+type EventQuery struct {
+	Camera  string
+	Cameras []string
+	Kind    string
+	Label   string
+	From    time.Time
+	To      time.Time
+	Limit   int
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (i *Index) AddEvent(ev Event) (int64, error) {
+	if ev.EndedAt.Before(ev.StartedAt) {
+		ev.EndedAt = ev.StartedAt
+	}
+
+	res, err := i.db.Exec(
+		"INSERT INTO events (camera, kind, label, source, started_at, ended_at) VALUES (?, ?, ?, ?, ?, ?)",
+		ev.Camera, ev.Kind, ev.Label, ev.Source, ev.StartedAt.UnixMilli(), ev.EndedAt.UnixMilli(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record event: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+func (i *Index) ExtendEvent(id int64, endedAt time.Time) error {
+	_, err := i.db.Exec(
+		"UPDATE events SET ended_at = MAX(ended_at, ?) WHERE id = ?",
+		endedAt.UnixMilli(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to extend event: %w", err)
+	}
+	return nil
+}
+
+func (i *Index) FindEvents(q EventQuery) ([]Event, error) {
+	if q.Limit <= 0 {
+		q.Limit = 1000
+	}
+
+	query := `SELECT id, camera, kind, label, source, started_at, ended_at FROM events
+		WHERE ended_at >= ? AND started_at <= ?`
+	args := []interface{}{q.From.UnixMilli(), q.To.UnixMilli()}
+	if q.Camera != "" {
+		query += " AND camera = ?"
+		args = append(args, q.Camera)
+	}
+	if len(q.Cameras) > 0 {
+		query += " AND camera IN (" + strings.TrimSuffix(strings.Repeat("?,", len(q.Cameras)), ",") + ")"
+		for _, cam := range q.Cameras {
+			args = append(args, cam)
+		}
+	}
+	if q.Kind != "" {
+		query += " AND kind = ?"
+		args = append(args, q.Kind)
+	}
+	if q.Label != "" {
+		// LIKE is case-insensitive for ASCII, so "person" matches "Person".
+		query += ` AND label LIKE ? ESCAPE '\'`
+		args = append(args, "%"+likeEscaper.Replace(q.Label)+"%")
+	}
+	query += " ORDER BY started_at DESC, id DESC LIMIT ?"
+	args = append(args, q.Limit)
+
+	rows, err := i.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var ev Event
+		var startedAt, endedAt int64
+		if err := rows.Scan(&ev.ID, &ev.Camera, &ev.Kind, &ev.Label, &ev.Source, &startedAt, &endedAt); err != nil {
+			return nil, err
+		}
+		ev.StartedAt = time.UnixMilli(startedAt)
+		ev.EndedAt = time.UnixMilli(endedAt)
+		events = append(events, ev)
+	}
+
+	return events, rows.Err()
+}
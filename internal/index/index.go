@@ -0,0 +1,186 @@
+package index
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+var migrations = []string{
+	`CREATE TABLE status_history (
+		id     INTEGER PRIMARY KEY AUTOINCREMENT,
+		camera TEXT    NOT NULL,
+		state  TEXT    NOT NULL,
+		error  TEXT    NOT NULL DEFAULT '',
+		at     INTEGER NOT NULL
+	);
+	CREATE INDEX idx_status_history_camera_at ON status_history(camera, at);`,
+	`CREATE TABLE segments (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		camera     TEXT    NOT NULL,
+		path       TEXT    NOT NULL UNIQUE,
+		started_at INTEGER NOT NULL,
+		ended_at   INTEGER NOT NULL,
+		size       INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX idx_segments_camera_time ON segments(camera, started_at, ended_at);`,
+	`CREATE TABLE settings (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+	CREATE TABLE push_subscriptions (
+		endpoint   TEXT PRIMARY KEY,
+		p256dh     TEXT    NOT NULL,
+		auth       TEXT    NOT NULL,
+		created_at INTEGER NOT NULL
+	);`,
+	`CREATE TABLE events (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		camera     TEXT    NOT NULL,
+		kind       TEXT    NOT NULL,
+		label      TEXT    NOT NULL DEFAULT '',
+		source     TEXT    NOT NULL DEFAULT '',
+		started_at INTEGER NOT NULL,
+		ended_at   INTEGER NOT NULL
+	);
+	CREATE INDEX idx_events_time ON events(started_at);
+	CREATE INDEX idx_events_camera_time ON events(camera, started_at);`,
+	`CREATE TABLE shares (
+		id         TEXT    PRIMARY KEY,
+		kind       TEXT    NOT NULL,
+		camera     TEXT    NOT NULL,
+		filename   TEXT    NOT NULL DEFAULT '',
+		note       TEXT    NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		max_views  INTEGER NOT NULL DEFAULT 0,
+		views      INTEGER NOT NULL DEFAULT 0,
+		revoked_at INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE audit_log (
+		id     INTEGER PRIMARY KEY AUTOINCREMENT,
+		at     INTEGER NOT NULL,
+		kind   TEXT    NOT NULL,
+		ip     TEXT    NOT NULL DEFAULT '',
+		detail TEXT    NOT NULL DEFAULT ''
+	);
+	CREATE INDEX idx_audit_log_at ON audit_log(at);`,
+	`ALTER TABLE audit_log ADD COLUMN user TEXT NOT NULL DEFAULT '';
+	ALTER TABLE audit_log ADD COLUMN camera TEXT NOT NULL DEFAULT '';
+	ALTER TABLE audit_log ADD COLUMN ended_at INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE audit_log ADD COLUMN bytes INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE run_state (
+		camera     TEXT    PRIMARY KEY,
+		state      TEXT    NOT NULL,
+		updated_at INTEGER NOT NULL
+	);`,
+	`CREATE TABLE preferences (
+		user       TEXT    PRIMARY KEY,
+		data       TEXT    NOT NULL,
+		updated_at INTEGER NOT NULL
+	);`,
+	`ALTER TABLE segments ADD COLUMN frames INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE segments ADD COLUMN dropped_frames INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE segments ADD COLUMN missed_packets INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE segments ADD COLUMN discontinuities INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE segments ADD COLUMN quality TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_segments_quality ON segments(quality);`,
+	`ALTER TABLE shares ADD COLUMN watermark INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE shares ADD COLUMN watermark_text TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE segments ADD COLUMN tier TEXT NOT NULL DEFAULT 'hot';
+	CREATE INDEX idx_segments_tier_time ON segments(tier, ended_at);`,
+	`ALTER TABLE segments ADD COLUMN activity REAL NOT NULL DEFAULT -1;
+	ALTER TABLE segments ADD COLUMN static INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX idx_segments_static_time ON segments(static, ended_at);`,
+	`ALTER TABLE segments ADD COLUMN sha256 TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE devices (
+		camera       TEXT    PRIMARY KEY,
+		source       TEXT    NOT NULL DEFAULT '',
+		manufacturer TEXT    NOT NULL DEFAULT '',
+		model        TEXT    NOT NULL DEFAULT '',
+		firmware     TEXT    NOT NULL DEFAULT '',
+		serial       TEXT    NOT NULL DEFAULT '',
+		hardware_id  TEXT    NOT NULL DEFAULT '',
+		http_server  TEXT    NOT NULL DEFAULT '',
+		checked_at   INTEGER NOT NULL
+	);`,
+	`ALTER TABLE segments ADD COLUMN ffmpeg_args TEXT NOT NULL DEFAULT '';
+	ALTER TABLE segments ADD COLUMN ffmpeg_exit_code INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE segments ADD COLUMN ffmpeg_status TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE segments ADD COLUMN instance TEXT NOT NULL DEFAULT '';
+	ALTER TABLE segments ADD COLUMN site TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_segments_instance ON segments(instance);`,
+	`ALTER TABLE segments ADD COLUMN missing_since INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE failed_deletes (
+		path      TEXT    PRIMARY KEY,
+		error     TEXT    NOT NULL DEFAULT '',
+		attempts  INTEGER NOT NULL DEFAULT 1,
+		failed_at INTEGER NOT NULL
+	);`,
+}
+
+type Index struct {
+	db *sql.DB
+}
+
+func Open(path string) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create index directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	idx := &Index{db: db}
+	if err := idx.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+func (i *Index) migrate() error {
+	var version int
+	if err := i.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read index schema version: %w", err)
+	}
+
+	for v := version; v < len(migrations); v++ {
+		tx, err := i.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration: %w", err)
+		}
+		if _, err := tx.Exec(migrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply index migration %d: %w", v+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", v+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to update index schema version: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Backup writes a consistent copy of the index to path, which must not exist.
+func (i *Index) Backup(path string) error {
+	if _, err := i.db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to back up index: %w", err)
+	}
+	return nil
+}
+
+func (i *Index) Close() error {
+	return i.db.Close()
+}
@@ -0,0 +1,108 @@
+package index
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTest opens an index in a temporary directory for the rest of the test.
+func openTest(t *testing.T) *Index {
+	t.Helper()
+	idx, err := Open(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { idx.Close() })
+	return idx
+}
+
+// createAtVersion creates a database at path with only the first version
+// migrations applied, as an earlier release left it.
+func createAtVersion(t *testing.T, path string, version int) {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	for v := range version {
+		if _, err := db.Exec(migrations[v]); err != nil {
+			t.Fatalf("migration %d: %v", v+1, err)
+		}
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		t.Fatalf("user_version: %v", err)
+	}
+	// A segment recorded before the later columns existed.
+	if version >= 2 {
+		_, err := db.Exec("INSERT INTO segments (camera, path, started_at, ended_at, size) VALUES (?, ?, ?, ?, ?)",
+			"Front Door", "/rec/front_door/old.mp4", 1000, 61000, 1234)
+		if err != nil {
+			t.Fatalf("insert segment: %v", err)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	for version := range len(migrations) + 1 {
+		t.Run(fmt.Sprintf("from version %d", version), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "index.db")
+			if version > 0 {
+				createAtVersion(t, path, version)
+			}
+
+			idx, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer idx.Close()
+
+			var got int
+			if err := idx.db.QueryRow("PRAGMA user_version").Scan(&got); err != nil {
+				t.Fatalf("user_version: %v", err)
+			}
+			if got != len(migrations) {
+				t.Errorf("user_version = %d, want %d", got, len(migrations))
+			}
+
+			segments, err := idx.SegmentsByPath([]string{"/rec/front_door/old.mp4"})
+			if err != nil {
+				t.Fatalf("SegmentsByPath: %v", err)
+			}
+			seg, ok := segments["/rec/front_door/old.mp4"]
+			if ok != (version >= 2) {
+				t.Fatalf("earlier segment kept = %v, want %v", ok, version >= 2)
+			}
+			if ok {
+				if seg.Size != 1234 || seg.Duration() != time.Minute {
+					t.Errorf("segment %+v lost its fields", seg)
+				}
+				if seg.Tier != TierHot || seg.Activity != -1 || seg.SHA256 != "" || !seg.MissingSince.IsZero() {
+					t.Errorf("segment %+v did not get the defaults of the new columns", seg)
+				}
+			}
+
+			// Every table the later migrations added is usable.
+			if err := idx.AddShare(Share{ID: "s", Kind: ShareLive, Camera: "Front Door", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+				t.Errorf("AddShare: %v", err)
+			}
+			if err := idx.AddFailedDelete("/rec/front_door/gone.mp4", "busy"); err != nil {
+				t.Errorf("AddFailedDelete: %v", err)
+			}
+		})
+	}
+}
+
+func TestMigrateAgainIsNoop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.db")
+	for range 2 {
+		idx, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		idx.Close()
+	}
+}
@@ -0,0 +1,65 @@
+package index
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ThemeDark   = "dark"
+	ThemeLight  = "light"
+	ThemeSystem = "system"
+)
+
+// Preferences are the dashboard settings of one user, kept on the server so
+// they follow the user across devices.
+type Preferences struct {
+	Theme            string   `json:"theme"`
+	Language         string   `json:"language"`
+	CameraOrder      []string `json:"camera_order"`
+	GridColumns      int      `json:"grid_columns"`
+	RecordingsCamera string   `json:"recordings_camera"`
+	RecordingsFilter string   `json:"recordings_filter"`
+}
+
+func DefaultPreferences() Preferences {
+	return Preferences{Theme: ThemeDark, CameraOrder: []string{}}
+}
+
+// Preferences returns the saved preferences of user, or the defaults.
+func (i *Index) Preferences(user string) (Preferences, error) {
+	prefs := DefaultPreferences()
+
+	var data string
+	err := i.db.QueryRow("SELECT data FROM preferences WHERE user = ?", user).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return prefs, nil
+	}
+	if err != nil {
+		return prefs, fmt.Errorf("failed to read preferences: %w", err)
+	}
+	if err := json.Unmarshal([]byte(data), &prefs); err != nil {
+		return DefaultPreferences(), fmt.Errorf("failed to decode preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+func (i *Index) SetPreferences(user string, prefs Preferences, at time.Time) error {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return fmt.Errorf("failed to encode preferences: %w", err)
+	}
+
+	_, err = i.db.Exec(
+		`INSERT INTO preferences (user, data, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(user) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		user, string(data), at.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+	return nil
+}
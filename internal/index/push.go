@@ -0,0 +1,53 @@
+package index
+
+import (
+	"fmt"
+	"time"
+)
+
+type PushSubscription struct {
+	Endpoint  string    `json:"endpoint"`
+	P256dh    string    `json:"p256dh"`
+	Auth      string    `json:"auth"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (i *Index) AddPushSubscription(sub PushSubscription) error {
+	_, err := i.db.Exec(
+		`INSERT INTO push_subscriptions (endpoint, p256dh, auth, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(endpoint) DO UPDATE SET p256dh = excluded.p256dh, auth = excluded.auth`,
+		sub.Endpoint, sub.P256dh, sub.Auth, sub.CreatedAt.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save push subscription: %w", err)
+	}
+	return nil
+}
+
+func (i *Index) DeletePushSubscription(endpoint string) error {
+	if _, err := i.db.Exec("DELETE FROM push_subscriptions WHERE endpoint = ?", endpoint); err != nil {
+		return fmt.Errorf("failed to delete push subscription: %w", err)
+	}
+	return nil
+}
+
+func (i *Index) PushSubscriptions() ([]PushSubscription, error) {
+	rows, err := i.db.Query("SELECT endpoint, p256dh, auth, created_at FROM push_subscriptions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query push subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []PushSubscription
+	for rows.Next() {
+		var sub PushSubscription
+		var createdAt int64
+		if err := rows.Scan(&sub.Endpoint, &sub.P256dh, &sub.Auth, &createdAt); err != nil {
+			return nil, err
+		}
+		sub.CreatedAt = time.UnixMilli(createdAt)
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
@@ -0,0 +1,45 @@
+package index
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	RunRunning = "running"
+	RunStopped = "stopped"
+	RunPaused  = "paused"
+)
+
+// SetRunState remembers how a camera was last left by a manual start, stop,
+// pause or resume so it can be restored after a restart.
+func (i *Index) SetRunState(camera, state string, at time.Time) error {
+	_, err := i.db.Exec(
+		`INSERT INTO run_state (camera, state, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(camera) DO UPDATE SET state = excluded.state, updated_at = excluded.updated_at`,
+		camera, state, at.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save run state for %s: %w", camera, err)
+	}
+	return nil
+}
+
+func (i *Index) RunStates() (map[string]string, error) {
+	rows, err := i.db.Query("SELECT camera, state FROM run_state")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query run state: %w", err)
+	}
+	defer rows.Close()
+
+	states := make(map[string]string)
+	for rows.Next() {
+		var camera, state string
+		if err := rows.Scan(&camera, &state); err != nil {
+			return nil, err
+		}
+		states[camera] = state
+	}
+
+	return states, rows.Err()
+}
@@ -0,0 +1,354 @@
+package index
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Storage tiers. Segments are recorded into the hot tier and moved to the
+// cold tier when re-encoded at a lower bitrate to save space, or to the
+// keyframes tier when only their keyframes are kept.
+const (
+	TierHot       = "hot"
+	TierCold      = "cold"
+	TierKeyframes = "keyframes"
+)
+
+type Segment struct {
+	Camera    string    `json:"camera"`
+	Filename  string    `json:"filename"`
+	Path      string    `json:"path"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Size      int64     `json:"size"`
+
+	// Stream loss while recording, and its rating: "good", "degraded",
+	// "poor", or empty if unknown.
+	Frames          int    `json:"frames"`
+	DroppedFrames   int    `json:"dropped_frames"`
+	MissedPackets   int    `json:"missed_packets"`
+	Discontinuities int    `json:"discontinuities"`
+	Quality         string `json:"quality,omitempty"`
+
+	Tier string `json:"tier"`
+
+	// Activity is the largest scene change between frames, from 0 for a
+	// still picture to 1, or -1 if not analyzed. Static marks segments
+	// whose activity stayed below the threshold.
+	Activity float64 `json:"activity"`
+	Static   bool    `json:"static"`
+
+	// SHA256 is the hex checksum of the file, or empty until it is first
+	// downloaded.
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Instance and Site are the recorder the segment was recorded by, or
+	// empty for segments indexed before they were tagged.
+	Instance string `json:"instance,omitempty"`
+	Site     string `json:"site,omitempty"`
+
+	// MissingSince is when the file was found gone from disk while still
+	// indexed, or zero.
+	MissingSince time.Time `json:"missing_since,omitzero"`
+
+	// Command is stored by AddSegment but not read back with the segment;
+	// see SegmentCommand.
+	Command *SegmentCommand `json:"-"`
+}
+
+// SegmentCommand is the ffmpeg command line a segment was recorded with,
+// credentials redacted, and how ffmpeg exited.
+type SegmentCommand struct {
+	Args     []string `json:"args"`
+	ExitCode int      `json:"exit_code"`
+	Status   string   `json:"status"`
+}
+
+func (s Segment) Duration() time.Duration {
+	return s.EndedAt.Sub(s.StartedAt)
+}
+
+func (i *Index) AddSegment(seg Segment) error {
+	var command []byte
+	var exitCode int
+	var status string
+	if seg.Command != nil {
+		var err error
+		if command, err = json.Marshal(seg.Command.Args); err != nil {
+			return fmt.Errorf("failed to encode ffmpeg command: %w", err)
+		}
+		exitCode, status = seg.Command.ExitCode, seg.Command.Status
+	}
+
+	// A segment indexed again without a command or origin keeps the one it
+	// had.
+	_, err := i.db.Exec(
+		`INSERT INTO segments (camera, path, started_at, ended_at, size,
+			frames, dropped_frames, missed_packets, discontinuities, quality,
+			ffmpeg_args, ffmpeg_exit_code, ffmpeg_status, instance, site)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET
+			camera = excluded.camera,
+			started_at = excluded.started_at,
+			ended_at = excluded.ended_at,
+			size = excluded.size,
+			frames = excluded.frames,
+			dropped_frames = excluded.dropped_frames,
+			missed_packets = excluded.missed_packets,
+			discontinuities = excluded.discontinuities,
+			quality = excluded.quality,
+			sha256 = '',
+			missing_since = 0,
+			ffmpeg_args = CASE WHEN excluded.ffmpeg_args = '' THEN ffmpeg_args ELSE excluded.ffmpeg_args END,
+			ffmpeg_exit_code = CASE WHEN excluded.ffmpeg_args = '' THEN ffmpeg_exit_code ELSE excluded.ffmpeg_exit_code END,
+			ffmpeg_status = CASE WHEN excluded.ffmpeg_args = '' THEN ffmpeg_status ELSE excluded.ffmpeg_status END,
+			instance = CASE WHEN excluded.instance = '' THEN instance ELSE excluded.instance END,
+			site = CASE WHEN excluded.instance = '' THEN site ELSE excluded.site END`,
+		seg.Camera, filepath.Clean(seg.Path), seg.StartedAt.UnixMilli(), seg.EndedAt.UnixMilli(), seg.Size,
+		seg.Frames, seg.DroppedFrames, seg.MissedPackets, seg.Discontinuities, seg.Quality,
+		string(command), exitCode, status, seg.Instance, seg.Site,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to index segment: %w", err)
+	}
+	return nil
+}
+
+// SegmentCommand returns the ffmpeg command the segment at path was
+// recorded with, or false when the segment is not indexed or was not
+// recorded by the recorder, such as imported ones.
+func (i *Index) SegmentCommand(path string) (SegmentCommand, bool, error) {
+	var args string
+	var command SegmentCommand
+	err := i.db.QueryRow(
+		"SELECT ffmpeg_args, ffmpeg_exit_code, ffmpeg_status FROM segments WHERE path = ?",
+		filepath.Clean(path),
+	).Scan(&args, &command.ExitCode, &command.Status)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && args == "") {
+		return SegmentCommand{}, false, nil
+	}
+	if err != nil {
+		return SegmentCommand{}, false, fmt.Errorf("failed to query segment command: %w", err)
+	}
+	if err := json.Unmarshal([]byte(args), &command.Args); err != nil {
+		return SegmentCommand{}, false, fmt.Errorf("failed to decode ffmpeg command: %w", err)
+	}
+	return command, true, nil
+}
+
+func (i *Index) DeleteSegment(path string) error {
+	if _, err := i.db.Exec("DELETE FROM segments WHERE path = ?", filepath.Clean(path)); err != nil {
+		return fmt.Errorf("failed to remove segment from index: %w", err)
+	}
+	return nil
+}
+
+func (i *Index) FindSegments(camera string, from, to time.Time, limit int) ([]Segment, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	query := "SELECT " + segmentColumns + ` FROM segments
+		WHERE ended_at >= ? AND started_at <= ?`
+	args := []interface{}{from.UnixMilli(), to.UnixMilli()}
+	if camera != "" {
+		query += " AND camera = ?"
+		args = append(args, camera)
+	}
+	query += " ORDER BY started_at ASC LIMIT ?"
+	args = append(args, limit)
+
+	return i.querySegments(query, args...)
+}
+
+func (i *Index) SegmentsByPath(paths []string) (map[string]Segment, error) {
+	result := make(map[string]Segment, len(paths))
+	if len(paths) == 0 {
+		return result, nil
+	}
+
+	const batchSize = 500
+	for start := 0; start < len(paths); start += batchSize {
+		end := start + batchSize
+		if end > len(paths) {
+			end = len(paths)
+		}
+
+		batch := paths[start:end]
+		args := make([]interface{}, len(batch))
+		for j, p := range batch {
+			args[j] = filepath.Clean(p)
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		segments, err := i.querySegments(
+			"SELECT "+segmentColumns+" FROM segments WHERE path IN ("+placeholders+")",
+			args...,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, seg := range segments {
+			result[seg.Path] = seg
+		}
+	}
+
+	return result, nil
+}
+
+// HotSegmentsBefore returns up to limit segments still in the hot tier that
+// ended before t, oldest first.
+func (i *Index) HotSegmentsBefore(t time.Time, limit int) ([]Segment, error) {
+	return i.querySegments(
+		"SELECT "+segmentColumns+` FROM segments
+		WHERE tier = ? AND ended_at < ?
+		ORDER BY ended_at ASC LIMIT ?`,
+		TierHot, t.UnixMilli(), limit,
+	)
+}
+
+// ArchivableSegmentsBefore returns up to limit segments of camera that ended
+// before t and still hold more than their keyframes, oldest first.
+func (i *Index) ArchivableSegmentsBefore(camera string, t time.Time, limit int) ([]Segment, error) {
+	return i.querySegments(
+		"SELECT "+segmentColumns+` FROM segments
+		WHERE camera = ? AND tier != ? AND missing_since = 0 AND ended_at < ?
+		ORDER BY ended_at ASC LIMIT ?`,
+		camera, TierKeyframes, t.UnixMilli(), limit,
+	)
+}
+
+// SetSegmentTier records that the segment at path moved to tier and now
+// takes size bytes.
+func (i *Index) SetSegmentTier(path, tier string, size int64) error {
+	_, err := i.db.Exec("UPDATE segments SET tier = ?, size = ?, sha256 = '' WHERE path = ?", tier, size, filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("failed to update segment tier: %w", err)
+	}
+	return nil
+}
+
+// SetSegmentChecksum stores the checksum of the segment at path, unless the
+// segment no longer takes size bytes.
+func (i *Index) SetSegmentChecksum(path, sum string, size int64) error {
+	_, err := i.db.Exec("UPDATE segments SET sha256 = ? WHERE path = ? AND size = ?", sum, filepath.Clean(path), size)
+	if err != nil {
+		return fmt.Errorf("failed to update segment checksum: %w", err)
+	}
+	return nil
+}
+
+// SegmentsAfter returns up to limit segments whose path sorts after the
+// given one, in path order, for walking the whole index in batches.
+func (i *Index) SegmentsAfter(path string, limit int) ([]Segment, error) {
+	return i.querySegments(
+		"SELECT "+segmentColumns+" FROM segments WHERE path > ? ORDER BY path LIMIT ?",
+		path, limit,
+	)
+}
+
+// SetSegmentMissing records since when the file of the segment at path has
+// been gone from disk; a zero time clears it.
+func (i *Index) SetSegmentMissing(path string, since time.Time) error {
+	var ms int64
+	if !since.IsZero() {
+		ms = since.UnixMilli()
+	}
+	_, err := i.db.Exec("UPDATE segments SET missing_since = ? WHERE path = ?", ms, filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("failed to update segment: %w", err)
+	}
+	return nil
+}
+
+// SetSegmentActivity stores the scene analysis of the segment at path.
+func (i *Index) SetSegmentActivity(path string, activity float64, static bool) error {
+	_, err := i.db.Exec("UPDATE segments SET activity = ?, static = ? WHERE path = ?", activity, static, filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("failed to update segment activity: %w", err)
+	}
+	return nil
+}
+
+// UnanalyzedSegments returns up to limit segments ended since t without a
+// scene analysis, newest first.
+func (i *Index) UnanalyzedSegments(since time.Time, limit int) ([]Segment, error) {
+	return i.querySegments(
+		"SELECT "+segmentColumns+` FROM segments
+		WHERE activity < 0 AND ended_at >= ?
+		ORDER BY ended_at DESC LIMIT ?`,
+		since.UnixMilli(), limit,
+	)
+}
+
+// StaticSegmentsBefore returns up to limit static segments that ended
+// before t, oldest first.
+func (i *Index) StaticSegmentsBefore(t time.Time, limit int) ([]Segment, error) {
+	return i.querySegments(
+		"SELECT "+segmentColumns+` FROM segments
+		WHERE static = 1 AND ended_at < ?
+		ORDER BY ended_at ASC LIMIT ?`,
+		t.UnixMilli(), limit,
+	)
+}
+
+type TierUsage struct {
+	Segments int   `json:"segments"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// TierUsage counts the indexed segments and their size in each tier.
+func (i *Index) TierUsage() (map[string]TierUsage, error) {
+	rows, err := i.db.Query("SELECT tier, COUNT(*), COALESCE(SUM(size), 0) FROM segments GROUP BY tier")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tier usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := map[string]TierUsage{TierHot: {}, TierCold: {}}
+	for rows.Next() {
+		var tier string
+		var u TierUsage
+		if err := rows.Scan(&tier, &u.Segments, &u.Bytes); err != nil {
+			return nil, err
+		}
+		usage[tier] = u
+	}
+	return usage, rows.Err()
+}
+
+const segmentColumns = "camera, path, started_at, ended_at, size, frames, dropped_frames, missed_packets, discontinuities, quality, tier, activity, static, sha256, instance, site, missing_since"
+
+func (i *Index) querySegments(query string, args ...interface{}) ([]Segment, error) {
+	rows, err := i.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segments: %w", err)
+	}
+	defer rows.Close()
+
+	segments := []Segment{}
+	for rows.Next() {
+		var seg Segment
+		var startedAt, endedAt, missingSince int64
+		err := rows.Scan(&seg.Camera, &seg.Path, &startedAt, &endedAt, &seg.Size,
+			&seg.Frames, &seg.DroppedFrames, &seg.MissedPackets, &seg.Discontinuities, &seg.Quality, &seg.Tier,
+			&seg.Activity, &seg.Static, &seg.SHA256, &seg.Instance, &seg.Site, &missingSince)
+		if err != nil {
+			return nil, err
+		}
+		seg.Filename = filepath.Base(seg.Path)
+		seg.StartedAt = time.UnixMilli(startedAt)
+		seg.EndedAt = time.UnixMilli(endedAt)
+		if missingSince > 0 {
+			seg.MissingSince = time.UnixMilli(missingSince)
+		}
+		segments = append(segments, seg)
+	}
+
+	return segments, rows.Err()
+}
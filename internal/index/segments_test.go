@@ -0,0 +1,92 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func addTestSegment(t *testing.T, idx *Index, path string, size int64) {
+	t.Helper()
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	err := idx.AddSegment(Segment{Camera: "Front Door", Path: path, StartedAt: start, EndedAt: start.Add(time.Minute), Size: size})
+	if err != nil {
+		t.Fatalf("AddSegment: %v", err)
+	}
+}
+
+func TestSegmentsByPath(t *testing.T) {
+	idx := openTest(t)
+	// More than one batch of segments.
+	var all []string
+	for n := range 1200 {
+		path := fmt.Sprintf("/rec/front_door/%04d.mp4", n)
+		addTestSegment(t, idx, path, int64(n))
+		all = append(all, path)
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{"none", nil, nil},
+		{"one", []string{"/rec/front_door/0007.mp4"}, []string{"/rec/front_door/0007.mp4"}},
+		{"unclean path", []string{"/rec/./front_door//0007.mp4"}, []string{"/rec/front_door/0007.mp4"}},
+		{"not indexed", []string{"/rec/front_door/missing.mp4", "/rec/front_door/0001.mp4"}, []string{"/rec/front_door/0001.mp4"}},
+		{"several batches", all, all},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idx.SegmentsByPath(tt.paths)
+			if err != nil {
+				t.Fatalf("SegmentsByPath: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d segments, want %d", len(got), len(tt.want))
+			}
+			for _, path := range tt.want {
+				if seg, ok := got[path]; !ok || seg.Path != path {
+					t.Errorf("%s missing from %d results", path, len(got))
+				}
+			}
+		})
+	}
+}
+
+func TestSetSegmentChecksum(t *testing.T) {
+	const path = "/rec/front_door/a.mp4"
+	tests := []struct {
+		name string
+		path string
+		size int64
+		// reindex indexes the segment again after its checksum is set.
+		reindex bool
+		want    string
+	}{
+		{"same size", path, 100, false, "abc"},
+		{"unclean path", "/rec/front_door/../front_door/a.mp4", 100, false, "abc"},
+		{"size changed since hashing", path, 99, false, ""},
+		{"indexed again", path, 100, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := openTest(t)
+			addTestSegment(t, idx, path, 100)
+			if err := idx.SetSegmentChecksum(tt.path, "abc", tt.size); err != nil {
+				t.Fatalf("SetSegmentChecksum: %v", err)
+			}
+			if tt.reindex {
+				addTestSegment(t, idx, path, 100)
+			}
+
+			segments, err := idx.SegmentsByPath([]string{path})
+			if err != nil {
+				t.Fatalf("SegmentsByPath: %v", err)
+			}
+			if got := segments[path].SHA256; got != tt.want {
+				t.Errorf("checksum %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package index
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+func (i *Index) Setting(key string) (string, bool, error) {
+	var value string
+	err := i.db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read setting %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+func (i *Index) SetSetting(key, value string) error {
+	_, err := i.db.Exec(
+		"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = excluded.value",
+		key, value,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save setting %s: %w", key, err)
+	}
+	return nil
+}
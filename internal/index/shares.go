@@ -0,0 +1,111 @@
+package index
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	ShareRecording = "recording"
+	ShareLive      = "live"
+)
+
+type Share struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Camera    string    `json:"camera"`
+	Filename  string    `json:"filename,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	MaxViews  int       `json:"max_views"`
+	Views     int       `json:"views"`
+	RevokedAt time.Time `json:"revoked_at,omitzero"`
+	// Watermark stamps the shared recording, with WatermarkText added to
+	// the configured text.
+	Watermark     bool   `json:"watermark,omitempty"`
+	WatermarkText string `json:"watermark_text,omitempty"`
+}
+
+func (s Share) Active(now time.Time) bool {
+	return s.RevokedAt.IsZero() && now.Before(s.ExpiresAt) && (s.MaxViews == 0 || s.Views < s.MaxViews)
+}
+
+const shareColumns = "id, kind, camera, filename, note, created_at, expires_at, max_views, views, revoked_at, watermark, watermark_text"
+
+func (i *Index) AddShare(share Share) error {
+	_, err := i.db.Exec(
+		"INSERT INTO shares ("+shareColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0, 0, ?, ?)",
+		share.ID, share.Kind, share.Camera, share.Filename, share.Note,
+		share.CreatedAt.UnixMilli(), share.ExpiresAt.UnixMilli(), share.MaxViews,
+		share.Watermark, share.WatermarkText,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save share: %w", err)
+	}
+	return nil
+}
+
+func (i *Index) Share(id string) (Share, bool, error) {
+	shares, err := i.queryShares("SELECT "+shareColumns+" FROM shares WHERE id = ?", id)
+	if err != nil || len(shares) == 0 {
+		return Share{}, false, err
+	}
+	return shares[0], true, nil
+}
+
+func (i *Index) Shares() ([]Share, error) {
+	return i.queryShares("SELECT " + shareColumns + " FROM shares ORDER BY created_at DESC")
+}
+
+func (i *Index) RevokeShare(id string, at time.Time) (bool, error) {
+	res, err := i.db.Exec("UPDATE shares SET revoked_at = ? WHERE id = ? AND revoked_at = 0", at.UnixMilli(), id)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke share: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CountShareView records a view if the share is still usable, checking the
+// view limit in the same statement so concurrent viewers cannot overshoot it.
+func (i *Index) CountShareView(id string, now time.Time) (bool, error) {
+	res, err := i.db.Exec(
+		`UPDATE shares SET views = views + 1
+		WHERE id = ? AND revoked_at = 0 AND expires_at > ? AND (max_views = 0 OR views < max_views)`,
+		id, now.UnixMilli(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to count share view: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (i *Index) queryShares(query string, args ...interface{}) ([]Share, error) {
+	rows, err := i.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []Share{}
+	for rows.Next() {
+		var share Share
+		var createdAt, expiresAt, revokedAt int64
+		err := rows.Scan(&share.ID, &share.Kind, &share.Camera, &share.Filename, &share.Note,
+			&createdAt, &expiresAt, &share.MaxViews, &share.Views, &revokedAt,
+			&share.Watermark, &share.WatermarkText)
+		if err != nil {
+			return nil, err
+		}
+		share.CreatedAt = time.UnixMilli(createdAt)
+		share.ExpiresAt = time.UnixMilli(expiresAt)
+		if revokedAt != 0 {
+			share.RevokedAt = time.UnixMilli(revokedAt)
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
@@ -0,0 +1,76 @@
+package index
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountShareView(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		maxViews int
+		expires  time.Duration
+		revoked  bool
+		views    int
+		// counted is how many of the views are counted, and active whether
+		// the share can be viewed after them.
+		counted int
+		active  bool
+	}{
+		{"unlimited", 0, time.Hour, false, 5, 5, true},
+		{"below the limit", 3, time.Hour, false, 2, 2, true},
+		{"limited", 3, time.Hour, false, 5, 3, false},
+		{"single view", 1, time.Hour, false, 2, 1, false},
+		{"expired", 3, -time.Minute, false, 2, 0, false},
+		{"revoked", 3, time.Hour, true, 2, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := openTest(t)
+			share := Share{ID: "abc", Kind: ShareRecording, Camera: "Front Door", Filename: "a.mp4",
+				CreatedAt: now, ExpiresAt: now.Add(tt.expires), MaxViews: tt.maxViews}
+			if err := idx.AddShare(share); err != nil {
+				t.Fatalf("AddShare: %v", err)
+			}
+			if tt.revoked {
+				if _, err := idx.RevokeShare(share.ID, now); err != nil {
+					t.Fatalf("RevokeShare: %v", err)
+				}
+			}
+
+			counted := 0
+			for range tt.views {
+				ok, err := idx.CountShareView(share.ID, now)
+				if err != nil {
+					t.Fatalf("CountShareView: %v", err)
+				}
+				if ok {
+					counted++
+				}
+			}
+			if counted != tt.counted {
+				t.Errorf("counted %d views, want %d", counted, tt.counted)
+			}
+
+			got, ok, err := idx.Share(share.ID)
+			if err != nil || !ok {
+				t.Fatalf("Share: %v, %v", ok, err)
+			}
+			if got.Views != tt.counted {
+				t.Errorf("share has %d views, want %d", got.Views, tt.counted)
+			}
+			if got.Active(now) != tt.active {
+				t.Errorf("Active = %v after %d views, want %v", got.Active(now), got.Views, tt.active)
+			}
+		})
+	}
+}
+
+func TestCountShareViewUnknown(t *testing.T) {
+	idx := openTest(t)
+	ok, err := idx.CountShareView("missing", time.Now())
+	if err != nil || ok {
+		t.Errorf("CountShareView = %v, %v, want false", ok, err)
+	}
+}
@@ -0,0 +1,172 @@
+package index
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type DayStats struct {
+	Day           string         `json:"day,omitempty"`
+	Segments      int            `json:"segments"`
+	RecordedHours float64        `json:"recorded_hours"`
+	Bytes         int64          `json:"bytes"`
+	AvgBitrate    float64        `json:"avg_bitrate_kbps"`
+	Events        map[string]int `json:"events"`
+	DowntimeHours float64        `json:"downtime_hours"`
+}
+
+// DailyStats aggregates the recordings, events and downtime of a camera for
+// each of the last days calendar days, oldest first, in now's time zone.
+// Segments and events count towards the day they started on.
+func (i *Index) DailyStats(camera string, days int, now time.Time) ([]DayStats, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	starts := make([]time.Time, days+1)
+	stats := make([]DayStats, days)
+	for d := 0; d <= days; d++ {
+		starts[d] = today.AddDate(0, 0, d-days+1)
+		if d < days {
+			stats[d] = DayStats{Day: starts[d].Format("2006-01-02"), Events: map[string]int{}}
+		}
+	}
+	from, to := starts[0], starts[days]
+
+	dayOf := func(t time.Time) int {
+		for d := days - 1; d >= 0; d-- {
+			if !t.Before(starts[d]) {
+				return d
+			}
+		}
+		return 0
+	}
+
+	rows, err := i.db.Query(
+		`SELECT started_at, ended_at, size FROM segments
+		WHERE camera = ? AND started_at >= ? AND started_at < ?`,
+		camera, from.UnixMilli(), to.UnixMilli(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segments: %w", err)
+	}
+	recorded := make([]time.Duration, days)
+	for rows.Next() {
+		var startedAt, endedAt, size int64
+		if err := rows.Scan(&startedAt, &endedAt, &size); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d := dayOf(time.UnixMilli(startedAt))
+		stats[d].Segments++
+		stats[d].Bytes += size
+		recorded[d] += time.Duration(max(endedAt-startedAt, 0)) * time.Millisecond
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = i.db.Query(
+		`SELECT kind, started_at FROM events
+		WHERE camera = ? AND started_at >= ? AND started_at < ?`,
+		camera, from.UnixMilli(), to.UnixMilli(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	for rows.Next() {
+		var kind string
+		var startedAt int64
+		if err := rows.Scan(&kind, &startedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats[dayOf(time.UnixMilli(startedAt))].Events[kind]++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	downtime, err := i.dailyDowntime(camera, starts, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for d := range stats {
+		stats[d].RecordedHours = recorded[d].Hours()
+		stats[d].DowntimeHours = downtime[d].Hours()
+		if secs := recorded[d].Seconds(); secs > 0 {
+			stats[d].AvgBitrate = float64(stats[d].Bytes) * 8 / 1000 / secs
+		}
+	}
+	return stats, nil
+}
+
+// dailyDowntime sums the time spent down, retrying, failed or waiting for
+// the camera within each day bounded by starts, up to now.
+func (i *Index) dailyDowntime(camera string, starts []time.Time, now time.Time) ([]time.Duration, error) {
+	days := len(starts) - 1
+	downtime := make([]time.Duration, days)
+	end := starts[days]
+	if now.Before(end) {
+		end = now
+	}
+
+	state := ""
+	var at int64
+	err := i.db.QueryRow(
+		`SELECT state, at FROM status_history
+		WHERE camera = ? AND at < ?
+		ORDER BY at DESC, id DESC LIMIT 1`,
+		camera, starts[0].UnixMilli(),
+	).Scan(&state, &at)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to query status history: %w", err)
+	}
+
+	rows, err := i.db.Query(
+		`SELECT state, at FROM status_history
+		WHERE camera = ? AND at >= ? AND at <= ?
+		ORDER BY at ASC, id ASC`,
+		camera, starts[0].UnixMilli(), end.UnixMilli(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query status history: %w", err)
+	}
+	defer rows.Close()
+
+	cursor := starts[0]
+	d := 0
+	account := func(until time.Time) {
+		down := state == StateDown || state == StateRetrying || state == StateFailed || state == StateCircuitOpen
+		for cursor.Before(until) && d < days {
+			next := starts[d+1]
+			if until.Before(next) {
+				next = until
+			}
+			if down {
+				downtime[d] += next.Sub(cursor)
+			}
+			cursor = next
+			if !cursor.Before(starts[d+1]) {
+				d++
+			}
+		}
+	}
+
+	for rows.Next() {
+		var next string
+		if err := rows.Scan(&next, &at); err != nil {
+			return nil, err
+		}
+		account(time.UnixMilli(at))
+		state = next
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	account(end)
+
+	return downtime, nil
+}
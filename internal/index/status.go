@@ -0,0 +1,127 @@
+package index
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	StateUp        = "up"
+	StateDown      = "down"
+	StateStopped   = "stopped"
+	StateRecording = "recording"
+	StateRetrying  = "retrying"
+	StateFailed    = "failed"
+	// StateCircuitOpen is recorded while a camera is no longer retried.
+	StateCircuitOpen = "circuit_open"
+)
+
+type StatusEntry struct {
+	Camera string    `json:"camera"`
+	State  string    `json:"state"`
+	Error  string    `json:"error,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+func (i *Index) RecordStatus(camera, state, errMsg string, at time.Time) error {
+	_, err := i.db.Exec(
+		"INSERT INTO status_history (camera, state, error, at) VALUES (?, ?, ?, ?)",
+		camera, state, errMsg, at.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record status: %w", err)
+	}
+	return nil
+}
+
+func (i *Index) StatusHistory(camera string, since time.Time, limit int) ([]StatusEntry, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := i.db.Query(
+		`SELECT camera, state, error, at FROM status_history
+		WHERE camera = ? AND at >= ?
+		ORDER BY at DESC, id DESC LIMIT ?`,
+		camera, since.UnixMilli(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query status history: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []StatusEntry{}
+	for rows.Next() {
+		var entry StatusEntry
+		var at int64
+		if err := rows.Scan(&entry.Camera, &entry.State, &entry.Error, &at); err != nil {
+			return nil, err
+		}
+		entry.At = time.UnixMilli(at)
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (i *Index) Uptime(camera string, window time.Duration, now time.Time) (float64, bool, error) {
+	start := now.Add(-window)
+
+	state := ""
+	var at int64
+	err := i.db.QueryRow(
+		`SELECT state, at FROM status_history
+		WHERE camera = ? AND at < ?
+		ORDER BY at DESC, id DESC LIMIT 1`,
+		camera, start.UnixMilli(),
+	).Scan(&state, &at)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, fmt.Errorf("failed to query status history: %w", err)
+	}
+
+	rows, err := i.db.Query(
+		`SELECT state, at FROM status_history
+		WHERE camera = ? AND at >= ? AND at <= ?
+		ORDER BY at ASC, id ASC`,
+		camera, start.UnixMilli(), now.UnixMilli(),
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to query status history: %w", err)
+	}
+	defer rows.Close()
+
+	var up, observed time.Duration
+	cursor := start
+
+	account := func(until time.Time) {
+		span := until.Sub(cursor)
+		switch state {
+		case StateUp, StateRecording:
+			up += span
+			observed += span
+		case StateDown, StateRetrying, StateFailed, StateCircuitOpen:
+			observed += span
+		}
+		cursor = until
+	}
+
+	for rows.Next() {
+		var next string
+		if err := rows.Scan(&next, &at); err != nil {
+			return 0, false, err
+		}
+		account(time.UnixMilli(at))
+		state = next
+	}
+	if err := rows.Err(); err != nil {
+		return 0, false, err
+	}
+	account(now)
+
+	if observed == 0 {
+		return 0, false, nil
+	}
+	return float64(up) / float64(observed) * 100, true, nil
+}
@@ -0,0 +1,508 @@
+// Package integrity writes a SHA-256 checksum for every finished segment,
+// in a sidecar next to it or in a list per camera and day, and verifies the
+// recordings against them on a schedule to catch bit rot and tampering.
+//
+// Both kinds of file are in sha256sum format, so they can also be checked
+// by hand with sha256sum -c from the camera directory.
+package integrity
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/internal/notify"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// Checksum modes.
+const (
+	ChecksumsSidecar = "sidecar"
+	ChecksumsDaily   = "daily"
+)
+
+const (
+	queueSize = 256
+	// Segments younger than this may still be waiting in the queue, so the
+	// check does not add their checksum itself.
+	settleTime = 5 * time.Minute
+	// maxListed bounds the files a report and its notification name.
+	maxListed = 20
+
+	lastCheckSetting = "integrity.last_check"
+)
+
+// Config enables checksums and their scheduled check.
+type Config struct {
+	// Checksums is "sidecar" for a .sha256 file next to every segment,
+	// "daily" for one per camera and day, or empty for none.
+	Checksums string `mapstructure:"checksums" yaml:"checksums,omitempty"`
+	// CheckAt is the time of day (HH:MM) the recordings are verified every
+	// day; empty turns the check off.
+	CheckAt string `mapstructure:"check_at" yaml:"check_at,omitempty"`
+}
+
+// Validate checks the mode and the time of the check.
+func (c Config) Validate() error {
+	switch c.Checksums {
+	case "", ChecksumsSidecar, ChecksumsDaily:
+	default:
+		return fmt.Errorf("checksums must be sidecar or daily, got %q", c.Checksums)
+	}
+	if c.CheckAt != "" {
+		if _, err := time.Parse("15:04", c.CheckAt); err != nil {
+			return fmt.Errorf("check_at must be HH:MM, got %q", c.CheckAt)
+		}
+	}
+	return nil
+}
+
+// next returns the first time the check is due after t.
+func (c Config) next(t time.Time) time.Time {
+	at, _ := time.Parse("15:04", c.CheckAt)
+	due := time.Date(t.Year(), t.Month(), t.Day(), at.Hour(), at.Minute(), 0, 0, t.Location())
+	if !due.After(t) {
+		due = due.AddDate(0, 0, 1)
+	}
+	return due
+}
+
+// Problem is a recording that failed the check.
+type Problem struct {
+	Camera   string `json:"camera"`
+	Filename string `json:"filename"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+	// Error is why the file could not be read.
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the outcome of a check.
+type Report struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Checked files matched their checksum or not; Bytes is how much was
+	// read doing so.
+	Checked int   `json:"checked"`
+	Bytes   int64 `json:"bytes"`
+	// Changed files no longer match their checksum. Missing ones are still
+	// indexed but gone from disk.
+	Changed      []Problem `json:"changed"`
+	Missing      []Problem `json:"missing"`
+	ChangedCount int       `json:"changed_count"`
+	MissingCount int       `json:"missing_count"`
+	// Added counts segments that had no checksum yet, such as imported ones
+	// or those recorded before checksums were turned on, and now have one.
+	Added int    `json:"added"`
+	Error string `json:"error,omitempty"`
+}
+
+// OK reports whether every file matched.
+func (r *Report) OK() bool {
+	return r.ChangedCount == 0 && r.MissingCount == 0 && r.Error == ""
+}
+
+type Manager struct {
+	config    Config
+	outputDir string
+	format    string
+	index     *index.Index
+	notifier  *notify.Dispatcher
+	queue     chan index.Segment
+
+	// mu serializes writing checksum files.
+	mu      sync.Mutex
+	running atomic.Bool
+}
+
+func NewManager(cfg Config, opts *storage.Options, idx *index.Index, notifier *notify.Dispatcher) *Manager {
+	return &Manager{
+		config:    cfg,
+		outputDir: opts.OutputDir,
+		format:    opts.Format,
+		index:     idx,
+		notifier:  notifier,
+		queue:     make(chan index.Segment, queueSize),
+	}
+}
+
+func (m *Manager) Config() Config {
+	return m.config
+}
+
+// Enqueue schedules writing the checksum of a finished or re-encoded
+// segment. When the queue is full the segment is skipped, and the next
+// check adds its checksum.
+func (m *Manager) Enqueue(seg index.Segment) {
+	if m.config.Checksums == "" {
+		return
+	}
+	select {
+	case m.queue <- seg:
+	default:
+		log.Printf("Warning: [%s] Checksum queue is full, skipping %s until the next integrity check", seg.Camera, seg.Filename)
+	}
+}
+
+func (m *Manager) Start(ctx context.Context) {
+	if m.config.Checksums == "" {
+		return
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case seg := <-m.queue:
+				if err := m.record(seg.Path); err != nil && ctx.Err() == nil {
+					log.Printf("Warning: [%s] Failed to write the checksum of %s: %v", seg.Camera, seg.Filename, err)
+				}
+			}
+		}
+	}()
+
+	if m.config.CheckAt == "" {
+		return
+	}
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(m.config.next(time.Now())))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			m.Check(ctx)
+		}
+	}()
+}
+
+// record hashes the segment at path, stores the checksum in the index and
+// writes it to the segment's checksum file.
+func (m *Manager) record(path string) error {
+	sum, size, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	if err := m.index.SetSegmentChecksum(path, sum, size); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := filepath.Base(path)
+	if m.config.Checksums == ChecksumsDaily {
+		return setSum(m.dailyPath(path), name, sum)
+	}
+	return writeSums(path+storage.ChecksumExt, map[string]string{name: sum})
+}
+
+// dailyPath returns the list of the camera and day of the segment at path,
+// e.g. Front_Door_20260220.sha256, dated by the segment's modification time.
+func (m *Manager) dailyPath(path string) string {
+	day := time.Now()
+	if info, err := os.Stat(path); err == nil {
+		day = info.ModTime()
+	}
+	dir := filepath.Dir(path)
+	return filepath.Join(dir, filepath.Base(dir)+"_"+day.Format("20060102")+storage.ChecksumExt)
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// readSums parses a sha256sum file into file names and checksums. Later
+// lines for the same name win.
+func readSums(path string) (map[string]string, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	sums := make(map[string]string)
+	var order []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			// sha256sum's binary mode marks names with *.
+			sum, name, ok = strings.Cut(scanner.Text(), " *")
+		}
+		if !ok || len(sum) != sha256.Size*2 {
+			continue
+		}
+		if _, seen := sums[name]; !seen {
+			order = append(order, name)
+		}
+		sums[name] = strings.ToLower(sum)
+	}
+	return sums, order, scanner.Err()
+}
+
+// setSum adds or replaces the checksum of name in the list at path.
+func setSum(path, name, sum string) error {
+	sums, order, err := readSums(path)
+	if os.IsNotExist(err) {
+		sums, err = make(map[string]string), nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := sums[name]; !ok {
+		order = append(order, name)
+	}
+	sums[name] = sum
+	return writeSums(path, sums, order...)
+}
+
+// writeSums replaces the list at path, in order or sorted by name.
+func writeSums(path string, sums map[string]string, order ...string) error {
+	if len(order) == 0 {
+		for name := range sums {
+			order = append(order, name)
+		}
+		slices.Sort(order)
+	}
+	var b strings.Builder
+	for _, name := range order {
+		fmt.Fprintf(&b, "%s  %s\n", sums[name], name)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Running reports whether a check is under way.
+func (m *Manager) Running() bool {
+	return m.running.Load()
+}
+
+// LastReport returns the report of the last check, or nil before the first.
+func (m *Manager) LastReport() *Report {
+	value, ok, err := m.index.Setting(lastCheckSetting)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if !ok {
+		return nil
+	}
+	var r Report
+	if err := json.Unmarshal([]byte(value), &r); err != nil {
+		return nil
+	}
+	return &r
+}
+
+// Check verifies every recording that has a checksum, adds the missing
+// checksums of settled segments and notifies about files that changed or
+// went missing. It returns nil if a check is already running.
+func (m *Manager) Check(ctx context.Context) *Report {
+	if !m.running.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer m.running.Store(false)
+
+	r := &Report{StartedAt: time.Now(), Changed: []Problem{}, Missing: []Problem{}}
+	if err := m.check(ctx, r); err != nil {
+		r.Error = err.Error()
+	}
+	r.FinishedAt = time.Now()
+
+	if data, err := json.Marshal(r); err == nil {
+		if err := m.index.SetSetting(lastCheckSetting, string(data)); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	log.Printf("Integrity check: %d files (%s) checked, %d changed, %d missing, %d checksums added in %s",
+		r.Checked, storage.FormatBytes(r.Bytes), r.ChangedCount, r.MissingCount, r.Added,
+		r.FinishedAt.Sub(r.StartedAt).Round(time.Second))
+	if r.ChangedCount > 0 || r.MissingCount > 0 {
+		m.notifier.Send(notify.Notification{
+			Kind:  notify.KindStorage,
+			Title: "Recordings failed the integrity check",
+			Body:  r.summary(),
+		})
+	}
+	return r
+}
+
+func (r *Report) summary() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("%d changed and %d missing of %d checked recordings.", r.ChangedCount, r.MissingCount, r.Checked))
+	for _, p := range r.Changed {
+		lines = append(lines, "Changed: "+p.Camera+"/"+p.Filename)
+	}
+	for _, p := range r.Missing {
+		lines = append(lines, "Missing: "+p.Camera+"/"+p.Filename)
+	}
+	if listed := len(r.Changed) + len(r.Missing); listed < r.ChangedCount+r.MissingCount {
+		lines = append(lines, fmt.Sprintf("and %d more", r.ChangedCount+r.MissingCount-listed))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *Manager) check(ctx context.Context, r *Report) error {
+	dirs, err := os.ReadDir(m.outputDir)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") {
+			continue
+		}
+		if err := m.checkDir(ctx, filepath.Join(m.outputDir, dir.Name()), r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) checkDir(ctx context.Context, dir string, r *Report) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	expected := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), storage.ChecksumExt) {
+			continue
+		}
+		sums, _, err := readSums(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			log.Printf("Warning: Failed to read %s: %v", entry.Name(), err)
+			continue
+		}
+		for name, sum := range sums {
+			// Names are relative to the list; anything else is not ours.
+			if name == filepath.Base(name) {
+				expected[name] = sum
+			}
+		}
+	}
+
+	var listed []string
+	for name := range expected {
+		listed = append(listed, filepath.Join(dir, name))
+	}
+	indexed, err := m.index.SegmentsByPath(listed)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, name)
+		sum, size, err := hashFile(path)
+		if os.IsNotExist(err) {
+			// Removed by retention or by hand unless still indexed.
+			if seg, ok := indexed[filepath.Clean(path)]; ok {
+				r.addMissing(Problem{Camera: seg.Camera, Filename: name, Expected: expected[name]})
+			}
+			continue
+		}
+		if err != nil {
+			log.Printf("Warning: Integrity check: %v", err)
+			r.addChanged(Problem{Camera: m.camera(indexed, path), Filename: name, Expected: expected[name], Error: err.Error()})
+			continue
+		}
+		r.Checked++
+		r.Bytes += size
+		if sum != expected[name] {
+			p := Problem{Camera: m.camera(indexed, path), Filename: name, Expected: expected[name], Actual: sum}
+			log.Printf("Warning: [%s] %s no longer matches its checksum", p.Camera, name)
+			r.addChanged(p)
+		}
+	}
+
+	// Settled segments without a checksum get one now.
+	if m.config.Checksums == "" {
+		return nil
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, "."+m.format) {
+			continue
+		}
+		if _, ok := expected[name]; ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < settleTime {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := m.record(filepath.Join(dir, name)); err != nil {
+			log.Printf("Warning: Failed to write the checksum of %s: %v", name, err)
+			continue
+		}
+		r.Added++
+	}
+	return nil
+}
+
+// camera names the camera of a file, from the index or its directory.
+func (m *Manager) camera(indexed map[string]index.Segment, path string) string {
+	if seg, ok := indexed[filepath.Clean(path)]; ok {
+		return seg.Camera
+	}
+	return filepath.Base(filepath.Dir(path))
+}
+
+func (r *Report) addChanged(p Problem) {
+	r.ChangedCount++
+	if len(r.Changed) < maxListed {
+		r.Changed = append(r.Changed, p)
+	}
+}
+
+func (r *Report) addMissing(p Problem) {
+	r.MissingCount++
+	if len(r.Missing) < maxListed {
+		r.Missing = append(r.Missing, p)
+	}
+}
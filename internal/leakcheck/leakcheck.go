@@ -0,0 +1,183 @@
+// Package leakcheck watches the process's goroutines, grouped by the
+// function that started them, and reports groups that keep growing: the
+// sign of a streamer or recorder loop that starts goroutines it never ends.
+package leakcheck
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Checks in a row a group must not shrink over to be suspected.
+	window = 6
+	// Goroutines a group must have gained over the window.
+	minGrowth = 10
+)
+
+// Group is the goroutines started by one function.
+type Group struct {
+	Creator string `json:"creator"`
+	Count   int    `json:"count"`
+	// Growth is how many the group gained over the last checks.
+	Growth    int  `json:"growth"`
+	Suspected bool `json:"suspected"`
+	// Stack is one of the group's goroutines, kept for suspected groups.
+	Stack string `json:"stack,omitempty"`
+}
+
+// Detector counts goroutines every interval. A group is suspected of leaking
+// once it has grown by minGrowth without shrinking over window checks; a
+// warning is logged when it first is.
+type Detector struct {
+	interval time.Duration
+
+	mu        sync.Mutex
+	history   map[string][]int
+	groups    []Group
+	checkedAt time.Time
+}
+
+func NewDetector(interval time.Duration) *Detector {
+	return &Detector{
+		interval: interval,
+		history:  make(map[string][]int),
+	}
+}
+
+func (d *Detector) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		d.Check()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.Check()
+			}
+		}
+	}()
+}
+
+// Check counts the goroutines now and returns the groups, largest first.
+func (d *Detector) Check() []Group {
+	counts, stacks := snapshot()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	previous := make(map[string]bool)
+	for _, g := range d.groups {
+		previous[g.Creator] = g.Suspected
+	}
+
+	groups := make([]Group, 0, len(counts))
+	for creator, count := range counts {
+		history := append(d.history[creator], count)
+		if len(history) > window {
+			history = history[len(history)-window:]
+		}
+		d.history[creator] = history
+
+		g := Group{Creator: creator, Count: count, Growth: count - history[0]}
+		if len(history) == window && g.Growth >= minGrowth && sort.IntsAreSorted(history) {
+			g.Suspected = true
+			g.Stack = stacks[creator]
+			if !previous[creator] {
+				log.Printf("Warning: Goroutines started by %s grew from %d to %d over %s, possible leak",
+					creator, history[0], count, time.Duration(window-1)*d.interval)
+			}
+		}
+		groups = append(groups, g)
+	}
+	for creator := range d.history {
+		if _, ok := counts[creator]; !ok {
+			delete(d.history, creator)
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Creator < groups[j].Creator
+	})
+	d.groups = groups
+	d.checkedAt = time.Now()
+	return groups
+}
+
+// Groups returns the groups of the last check and when it ran.
+func (d *Detector) Groups() ([]Group, time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.groups, d.checkedAt
+}
+
+// Suspected returns how many groups the last check suspected of leaking.
+func (d *Detector) Suspected() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, g := range d.groups {
+		if g.Suspected {
+			n++
+		}
+	}
+	return n
+}
+
+// snapshot counts every goroutine by the function that started it, keeping
+// one stack per group.
+func snapshot() (map[string]int, map[string]string) {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	counts := make(map[string]int)
+	stacks := make(map[string]string)
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		creator := creatorOf(stack)
+		if creator == "" {
+			continue
+		}
+		counts[creator]++
+		if _, ok := stacks[creator]; !ok {
+			stacks[creator] = stack
+		}
+	}
+	return counts, stacks
+}
+
+// creatorOf returns the function named by a stack's "created by" line, or
+// the function at the top of stacks without one, like main's.
+func creatorOf(stack string) string {
+	lines := strings.Split(strings.TrimSpace(stack), "\n")
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "goroutine ") {
+		return ""
+	}
+	for _, line := range lines {
+		if creator, ok := strings.CutPrefix(line, "created by "); ok {
+			creator, _, _ = strings.Cut(creator, " in goroutine ")
+			return creator
+		}
+	}
+	if i := strings.LastIndex(lines[1], "("); i > 0 {
+		return lines[1][:i]
+	}
+	return lines[1]
+}
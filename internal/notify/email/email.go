@@ -0,0 +1,160 @@
+// Package email is a compiled-in notifier that sends notifications, and the
+// scheduled reports, as plain-text mail over SMTP. Enable it with a notifier
+// plugin of type "email".
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/plugin"
+)
+
+const (
+	SecurityStartTLS = "starttls"
+	SecurityTLS      = "tls"
+	SecurityNone     = "none"
+)
+
+func init() {
+	plugin.RegisterNotifier("email", func(name string, cfg plugin.Config) (plugin.Notifier, error) {
+		var opts Options
+		if err := cfg.Decode(&opts); err != nil {
+			return nil, err
+		}
+		return New(name, opts)
+	})
+}
+
+// Options are the settings of an email notifier. Port defaults to 587 with
+// STARTTLS, 465 with implicit TLS and 25 without encryption. Username and
+// Password are only sent when Username is set, and never in the clear.
+type Options struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Security string   `json:"security"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+type Notifier struct {
+	name string
+	opts Options
+}
+
+func New(name string, opts Options) (*Notifier, error) {
+	if opts.Host == "" {
+		return nil, fmt.Errorf("email notifier %s: host is required", name)
+	}
+	if opts.From == "" || len(opts.To) == 0 {
+		return nil, fmt.Errorf("email notifier %s: from and to are required", name)
+	}
+	switch opts.Security {
+	case "":
+		opts.Security = SecurityStartTLS
+	case SecurityStartTLS, SecurityTLS, SecurityNone:
+	default:
+		return nil, fmt.Errorf("email notifier %s: security must be starttls, tls or none", name)
+	}
+	if opts.Port == 0 {
+		opts.Port = map[string]int{SecurityStartTLS: 587, SecurityTLS: 465, SecurityNone: 25}[opts.Security]
+	}
+	return &Notifier{name: name, opts: opts}, nil
+}
+
+func (n *Notifier) Name() string {
+	return n.name
+}
+
+func (n *Notifier) Notify(ctx context.Context, note plugin.Notification) error {
+	addr := net.JoinHostPort(n.opts.Host, strconv.Itoa(n.opts.Port))
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	var conn net.Conn
+	var err error
+	if n.opts.Security == SecurityTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: n.opts.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, n.opts.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to talk to %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if n.opts.Security == SecurityStartTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: n.opts.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if n.opts.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.opts.Username, n.opts.Password, n.opts.Host)); err != nil {
+			return fmt.Errorf("failed to log in: %w", err)
+		}
+	}
+	if err := client.Mail(n.opts.From); err != nil {
+		return fmt.Errorf("sender refused: %w", err)
+	}
+	for _, to := range n.opts.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s refused: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.message(note)); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message refused: %w", err)
+	}
+	return client.Quit()
+}
+
+// message formats a notification as a plain-text mail.
+func (n *Notifier) message(note plugin.Notification) []byte {
+	var b strings.Builder
+	header := func(name, value string) {
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", n.opts.From)
+	header("To", strings.Join(n.opts.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", note.Title))
+	header("Date", note.Time.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	header("X-Cam-Recorder-Kind", note.Kind)
+	b.WriteString("\r\n")
+
+	body := note.Body
+	if note.URL != "" {
+		body += "\n\n" + note.URL
+	}
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		// A lone dot ends the message in SMTP; the data writer escapes it,
+		// but lines must end in CRLF.
+		b.WriteString(strings.TrimRight(line, "\r") + "\r\n")
+	}
+	return []byte(b.String())
+}
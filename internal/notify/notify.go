@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/plugin"
+)
+
+const (
+	KindOffline  = "offline"
+	KindOnline   = "online"
+	KindMotion   = "motion"
+	KindStorage  = "storage"
+	KindFailover = "failover"
+	KindReport   = "report"
+	KindTest     = "test"
+)
+
+// Notifications and notifiers are defined by the plugin package so that
+// plugins can implement them.
+type (
+	Notification = plugin.Notification
+	Notifier     = plugin.Notifier
+)
+
+type Dispatcher struct {
+	notifiers  []Notifier
+	throttle   Throttle
+	quiet      []quietWindow
+	routes     []Route
+	cameraTags map[string]map[string]string
+	sent       map[string]time.Time
+	lastOfKind map[string]time.Time
+	dropped    map[string]int
+	mu         sync.RWMutex
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		sent:       make(map[string]time.Time),
+		lastOfKind: make(map[string]time.Time),
+		dropped:    make(map[string]int),
+	}
+}
+
+func (d *Dispatcher) Add(n Notifier) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notifiers = append(d.notifiers, n)
+}
+
+func (d *Dispatcher) Notifier(name string) (Notifier, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, n := range d.notifiers {
+		if n.Name() == name {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+func (d *Dispatcher) Send(n Notification) {
+	d.SendTo(n, nil)
+}
+
+// SendTo sends n to the named channels only, or to every channel when none
+// are named.
+func (d *Dispatcher) SendTo(n Notification, channels []string) {
+	now := time.Now()
+	if n.Time.IsZero() {
+		n.Time = now
+	}
+	if n.Camera != "" && n.Tags == nil {
+		n.Tags = d.tagsOf(n.Camera)
+	}
+	n, ok := d.admit(n, now)
+	if !ok {
+		return
+	}
+
+	d.mu.RLock()
+	notifiers := make([]Notifier, len(d.notifiers))
+	copy(notifiers, d.notifiers)
+	d.mu.RUnlock()
+
+	for _, notifier := range notifiers {
+		if len(channels) > 0 && !slices.Contains(channels, notifier.Name()) {
+			continue
+		}
+		if !d.routedTo(notifier.Name(), n) || d.quietFor(notifier.Name(), n.Kind, now) {
+			continue
+		}
+		go func(notifier Notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if err := notifier.Notify(ctx, n); err != nil {
+				log.Printf("Warning: %s notification failed: %v", notifier.Name(), err)
+			}
+		}(notifier)
+	}
+}
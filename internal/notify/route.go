@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/lets-vibe/cam-recorder/internal/tags"
+)
+
+// Route sends the Channels (notifier names) only notifications about
+// cameras whose tags match Tags. A channel named by several routes gets the
+// notifications matching any of them; a channel named by none gets
+// everything. Notifications about no camera in particular, such as storage
+// alerts, go to every channel.
+type Route struct {
+	Channels []string      `mapstructure:"channels" yaml:"channels"`
+	Tags     tags.Selector `mapstructure:"tags" yaml:"tags"`
+}
+
+// SetRoutes replaces the notification routes.
+func (d *Dispatcher) SetRoutes(routes []Route) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.routes = slices.Clone(routes)
+}
+
+// SetCameraTags tells the dispatcher the tags of every camera, to route
+// their notifications and pass the tags on to notifiers.
+func (d *Dispatcher) SetCameraTags(cameraTags map[string]map[string]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cameraTags = maps.Clone(cameraTags)
+}
+
+func (d *Dispatcher) tagsOf(camera string) map[string]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return maps.Clone(d.cameraTags[camera])
+}
+
+// routedTo reports whether n goes to the channel.
+func (d *Dispatcher) routedTo(channel string, n Notification) bool {
+	if n.Camera == "" || n.Kind == KindTest {
+		return true
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	routed := false
+	for _, r := range d.routes {
+		if !slices.Contains(r.Channels, channel) {
+			continue
+		}
+		if r.Tags.Match(n.Tags) {
+			return true
+		}
+		routed = true
+	}
+	return !routed
+}
@@ -0,0 +1,147 @@
+package notify
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/schedule"
+)
+
+// Throttle keeps a flapping camera from flooding the notifiers. A
+// notification identical to one sent within DedupeWindow is dropped, as is
+// one sent sooner than MinInterval after the last of its kind for the same
+// camera; the next one let through says how many were dropped. QuietHours
+// hold back notifications from some channels at set times. Test
+// notifications and reports are never throttled, but reports do keep quiet
+// hours.
+type Throttle struct {
+	DedupeWindow time.Duration            `mapstructure:"dedupe_window" yaml:"dedupe_window"`
+	MinInterval  map[string]time.Duration `mapstructure:"min_interval" yaml:"min_interval,omitempty"`
+	QuietHours   []QuietHours             `mapstructure:"quiet_hours" yaml:"quiet_hours,omitempty"`
+}
+
+// QuietHours silences the Channels (notifier names; all when empty) for the
+// Kinds of notification (all when empty) during a weekly window.
+type QuietHours struct {
+	Channels      []string `mapstructure:"channels" yaml:"channels,omitempty"`
+	Kinds         []string `mapstructure:"kinds" yaml:"kinds,omitempty"`
+	schedule.Spec `mapstructure:",squash" yaml:",inline"`
+}
+
+// ValidKind reports whether kind is a kind of notification the recorder
+// sends.
+func ValidKind(kind string) bool {
+	switch kind {
+	case KindOffline, KindOnline, KindMotion, KindStorage, KindFailover, KindReport:
+		return true
+	}
+	return false
+}
+
+type quietWindow struct {
+	QuietHours
+	schedule *schedule.Schedule
+}
+
+func (q quietWindow) silences(channel, kind string, t time.Time) bool {
+	if len(q.Channels) > 0 && !slices.Contains(q.Channels, channel) {
+		return false
+	}
+	if len(q.Kinds) > 0 && !slices.Contains(q.Kinds, kind) {
+		return false
+	}
+	return q.schedule.Active(t)
+}
+
+// SetThrottle replaces the throttling rules. What was already sent still
+// counts against the new ones.
+func (d *Dispatcher) SetThrottle(t Throttle) error {
+	var quiet []quietWindow
+	for i, q := range t.QuietHours {
+		sched, err := schedule.Parse([]schedule.Spec{q.Spec})
+		if err != nil {
+			return fmt.Errorf("quiet hours %d: %w", i+1, err)
+		}
+		quiet = append(quiet, quietWindow{QuietHours: q, schedule: sched})
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.throttle = t
+	d.quiet = quiet
+	return nil
+}
+
+// admit applies deduplication and the minimum interval to n, returning it
+// with the count of dropped notifications added to its body.
+func (d *Dispatcher) admit(n Notification, now time.Time) (Notification, bool) {
+	if n.Kind == KindTest || n.Kind == KindReport {
+		return n, true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.forget(now)
+
+	key := n.Kind + "\x00" + n.Camera
+	exact := key + "\x00" + n.Title + "\x00" + n.Body
+	if last, ok := d.sent[exact]; ok && now.Sub(last) < d.throttle.DedupeWindow {
+		d.dropped[key]++
+		return n, false
+	}
+	if last, ok := d.lastOfKind[key]; ok && now.Sub(last) < d.throttle.MinInterval[n.Kind] {
+		d.dropped[key]++
+		return n, false
+	}
+
+	d.sent[exact] = now
+	d.lastOfKind[key] = now
+	if dropped := d.dropped[key]; dropped > 0 {
+		delete(d.dropped, key)
+		note := fmt.Sprintf("%d similar notifications were held back", dropped)
+		if dropped == 1 {
+			note = "1 similar notification was held back"
+		}
+		if n.Body == "" {
+			n.Body = note
+		} else {
+			n.Body += " (" + note + ")"
+		}
+	}
+	return n, true
+}
+
+// forget drops sent times that no longer hold anything back.
+func (d *Dispatcher) forget(now time.Time) {
+	longest := d.throttle.DedupeWindow
+	for _, interval := range d.throttle.MinInterval {
+		longest = max(longest, interval)
+	}
+	for key, at := range d.sent {
+		if now.Sub(at) >= longest {
+			delete(d.sent, key)
+		}
+	}
+	for key, at := range d.lastOfKind {
+		if now.Sub(at) >= longest {
+			delete(d.lastOfKind, key)
+		}
+	}
+}
+
+func (d *Dispatcher) quietFor(channel, kind string, now time.Time) bool {
+	if kind == KindTest {
+		return false
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, q := range d.quiet {
+		if q.silences(channel, kind, now) {
+			return true
+		}
+	}
+	return false
+}
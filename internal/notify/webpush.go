@@ -0,0 +1,277 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+)
+
+const (
+	vapidKeySetting = "webpush.vapid_private_key"
+	pushRecordSize  = 4096
+)
+
+var b64 = base64.RawURLEncoding
+
+type WebPush struct {
+	index   *index.Index
+	subject string
+	key     *ecdsa.PrivateKey
+	client  *http.Client
+}
+
+func NewWebPush(idx *index.Index, subject string) (*WebPush, error) {
+	key, err := loadVAPIDKey(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebPush{
+		index:   idx,
+		subject: subject,
+		key:     key,
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+func loadVAPIDKey(idx *index.Index) (*ecdsa.PrivateKey, error) {
+	stored, ok, err := idx.Setting(vapidKeySetting)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		raw, err := b64.DecodeString(stored)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored VAPID key: %w", err)
+		}
+		return ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate VAPID key: %w", err)
+	}
+
+	raw, err := key.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode VAPID key: %w", err)
+	}
+	if err := idx.SetSetting(vapidKeySetting, b64.EncodeToString(raw)); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (w *WebPush) Name() string {
+	return "webpush"
+}
+
+func (w *WebPush) PublicKey() string {
+	raw, err := w.key.PublicKey.Bytes()
+	if err != nil {
+		return ""
+	}
+	return b64.EncodeToString(raw)
+}
+
+func (w *WebPush) Subscribe(sub index.PushSubscription) error {
+	if _, err := url.ParseRequestURI(sub.Endpoint); err != nil {
+		return fmt.Errorf("invalid push endpoint")
+	}
+	if _, err := b64.DecodeString(sub.P256dh); err != nil {
+		return fmt.Errorf("invalid p256dh key")
+	}
+	if _, err := b64.DecodeString(sub.Auth); err != nil {
+		return fmt.Errorf("invalid auth secret")
+	}
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now()
+	}
+	return w.index.AddPushSubscription(sub)
+}
+
+func (w *WebPush) Unsubscribe(endpoint string) error {
+	return w.index.DeletePushSubscription(endpoint)
+}
+
+func (w *WebPush) Notify(ctx context.Context, n Notification) error {
+	subs, err := w.index.PushSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	var lastErr error
+	for _, sub := range subs {
+		if err := w.send(ctx, sub, payload); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (w *WebPush) send(ctx context.Context, sub index.PushSubscription, payload []byte) error {
+	body, err := encryptPayload(sub, payload)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid push endpoint: %w", err)
+	}
+
+	token, err := w.vapidToken(endpoint.Scheme + "://" + endpoint.Host)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create push request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", token, w.PublicKey()))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push request failed: %w", err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return w.index.DeletePushSubscription(sub.Endpoint)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (w *WebPush) vapidToken(audience string) (string, error) {
+	header := b64.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": audience,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": w.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := header + "." + b64.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	r, s, err := ecdsa.Sign(rand.Reader, w.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return signingInput + "." + b64.EncodeToString(sig), nil
+}
+
+func encryptPayload(sub index.PushSubscription, payload []byte) ([]byte, error) {
+	uaPublicRaw, err := b64.DecodeString(sub.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := b64.DecodeString(sub.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+
+	curve := ecdh.P256()
+	uaPublic, err := curve.NewPublicKey(uaPublicRaw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	asPrivate, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublicRaw := asPrivate.PublicKey().Bytes()
+
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := "WebPush: info\x00" + string(uaPublicRaw) + string(asPublicRaw)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	if len(plaintext)+gcm.Overhead() > pushRecordSize {
+		return nil, fmt.Errorf("push payload too large")
+	}
+
+	var body bytes.Buffer
+	body.Write(salt)
+	binary.Write(&body, binary.BigEndian, uint32(pushRecordSize))
+	body.WriteByte(byte(len(asPublicRaw)))
+	body.Write(asPublicRaw)
+	body.Write(gcm.Seal(nil, nonce, plaintext, nil))
+
+	return body.Bytes(), nil
+}
@@ -0,0 +1,219 @@
+// Package power switches cameras off and on, for cameras that hang until
+// they are rebooted: by a Wake-on-LAN magic packet, by turning their PoE
+// switch port off and on over SNMP, or by calling a smart plug's webhooks.
+package power
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/snmp"
+)
+
+const (
+	TypeWOL     = "wol"
+	TypeSNMP    = "snmp"
+	TypeWebhook = "webhook"
+
+	// DefaultOffTime is how long a camera stays off when OffTime is not set.
+	DefaultOffTime = 10 * time.Second
+
+	// pethPsePortAdminEnable is the POWER-ETHERNET-MIB object that turns PoE
+	// on (1) or off (2) for a port of a PSE group.
+	pethPsePortAdminEnable = "1.3.6.1.2.1.105.1.1.1.3"
+)
+
+var webhookClient = &http.Client{Timeout: 15 * time.Second}
+
+// Config is how a camera's power is switched. An empty Type has no power
+// control. A camera failing for RecoverAfter, since it started failing or
+// was last power-cycled, is power-cycled by the recorder; zero leaves it to
+// the power cycle button.
+type Config struct {
+	Type string `mapstructure:"type" yaml:"type"`
+	// MAC is the camera's address for Wake-on-LAN, sent to Broadcast
+	// (default 255.255.255.255:9). It can only switch a camera on.
+	MAC       string `mapstructure:"mac" yaml:"mac,omitempty"`
+	Broadcast string `mapstructure:"broadcast" yaml:"broadcast,omitempty"`
+	// Switch is the PoE switch's SNMP address and Port the camera's port on
+	// it, in PSE group Group (default 1). OID replaces the standard
+	// POWER-ETHERNET-MIB object for switches with their own; it is set to 2
+	// to switch off and 1 to switch on.
+	Switch    string `mapstructure:"switch" yaml:"switch,omitempty"`
+	Community string `mapstructure:"community" yaml:"community,omitempty"`
+	Group     int    `mapstructure:"group" yaml:"group,omitempty"`
+	Port      int    `mapstructure:"port" yaml:"port,omitempty"`
+	OID       string `mapstructure:"oid" yaml:"oid,omitempty"`
+	// OffURL and OnURL are the smart plug's webhooks, called with Method
+	// (default POST).
+	OffURL string `mapstructure:"off_url" yaml:"off_url,omitempty"`
+	OnURL  string `mapstructure:"on_url" yaml:"on_url,omitempty"`
+	Method string `mapstructure:"method" yaml:"method,omitempty"`
+
+	OffTime      time.Duration `mapstructure:"off_time" yaml:"off_time,omitempty"`
+	RecoverAfter time.Duration `mapstructure:"recover_after" yaml:"recover_after,omitempty"`
+}
+
+// Enabled reports whether the camera's power can be switched.
+func (c Config) Enabled() bool {
+	return c.Type != ""
+}
+
+// Validate checks that the settings of the type are there.
+func (c Config) Validate() error {
+	switch c.Type {
+	case "":
+		return nil
+	case TypeWOL:
+		if _, err := net.ParseMAC(c.MAC); err != nil {
+			return fmt.Errorf("power.mac: %w", err)
+		}
+		if c.Broadcast != "" {
+			if _, err := net.ResolveUDPAddr("udp", c.broadcast()); err != nil {
+				return fmt.Errorf("power.broadcast: %w", err)
+			}
+		}
+	case TypeSNMP:
+		if c.Switch == "" {
+			return fmt.Errorf("power.switch is required")
+		}
+		if c.OID == "" && c.Port <= 0 {
+			return fmt.Errorf("power.port or power.oid is required")
+		}
+		if _, err := c.oid(); err != nil {
+			return fmt.Errorf("power.oid: %w", err)
+		}
+	case TypeWebhook:
+		for _, raw := range []string{c.OffURL, c.OnURL} {
+			if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("power.off_url and power.on_url must be http(s) URLs")
+			}
+		}
+	default:
+		return fmt.Errorf("power.type must be %s, %s or %s", TypeWOL, TypeSNMP, TypeWebhook)
+	}
+	if c.OffTime < 0 || c.RecoverAfter < 0 {
+		return fmt.Errorf("power.off_time and power.recover_after must not be negative")
+	}
+	return nil
+}
+
+// Cycle switches the camera off, waits OffTime and switches it on again.
+// Wake-on-LAN only sends the magic packet.
+func (c Config) Cycle(ctx context.Context) error {
+	if c.Type == TypeWOL {
+		return c.set(ctx, true)
+	}
+	if err := c.set(ctx, false); err != nil {
+		return fmt.Errorf("failed to switch off: %w", err)
+	}
+	offTime := c.OffTime
+	if offTime == 0 {
+		offTime = DefaultOffTime
+	}
+	select {
+	case <-ctx.Done():
+		// Never leave the camera off.
+		ctx = context.WithoutCancel(ctx)
+	case <-time.After(offTime):
+	}
+	if err := c.set(ctx, true); err != nil {
+		return fmt.Errorf("failed to switch on: %w", err)
+	}
+	return nil
+}
+
+func (c Config) set(ctx context.Context, on bool) error {
+	switch c.Type {
+	case TypeWOL:
+		return c.wake(ctx)
+	case TypeSNMP:
+		oid, err := c.oid()
+		if err != nil {
+			return err
+		}
+		community := c.Community
+		if community == "" {
+			community = "private"
+		}
+		value := 2
+		if on {
+			value = 1
+		}
+		return snmp.Set(ctx, c.Switch, community, oid, value)
+	case TypeWebhook:
+		target := c.OffURL
+		if on {
+			target = c.OnURL
+		}
+		return c.call(ctx, target)
+	default:
+		return fmt.Errorf("no power control")
+	}
+}
+
+// wake broadcasts a magic packet: six 0xff bytes and the MAC sixteen times.
+func (c Config) wake(ctx context.Context) error {
+	mac, err := net.ParseMAC(c.MAC)
+	if err != nil {
+		return err
+	}
+	packet := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	for range 16 {
+		packet = append(packet, mac...)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", c.broadcast())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(packet)
+	return err
+}
+
+func (c Config) broadcast() string {
+	if c.Broadcast == "" {
+		return "255.255.255.255:9"
+	}
+	if _, _, err := net.SplitHostPort(c.Broadcast); err != nil {
+		return net.JoinHostPort(c.Broadcast, "9")
+	}
+	return c.Broadcast
+}
+
+func (c Config) oid() (snmp.OID, error) {
+	if c.OID != "" {
+		return snmp.ParseOID(c.OID)
+	}
+	group := c.Group
+	if group == 0 {
+		group = 1
+	}
+	return snmp.ParseOID(fmt.Sprintf("%s.%d.%d", pethPsePortAdminEnable, group, c.Port))
+}
+
+func (c Config) call(ctx context.Context, target string) error {
+	method := strings.ToUpper(c.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+// Package reconcile keeps the index and the recordings on disk in step over
+// years of running. It periodically flags indexed segments whose file is
+// gone, adopts or reports recordings on disk the index does not know, and
+// retries removals that failed, such as of files held open by a player.
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/importer"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/internal/notify"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// What happens to recordings on disk that are not indexed.
+const (
+	OrphansAdopt  = "adopt"
+	OrphansReport = "report"
+)
+
+const (
+	// Files younger than this may still be being recorded or waiting to be
+	// indexed, so they are not orphans yet.
+	settleTime = 10 * time.Minute
+	// firstRun is how long after starting the first run waits, so it does
+	// not add to the load of starting every camera.
+	firstRun  = 10 * time.Minute
+	batchSize = 500
+	// maxListed bounds the files a report and its notification name.
+	maxListed = 20
+
+	lastRunSetting = "reconcile.last_run"
+)
+
+// Config schedules the reconciliation.
+type Config struct {
+	// Interval is how often the index and the disk are compared; 0 turns
+	// it off.
+	Interval time.Duration `mapstructure:"interval" yaml:"interval"`
+	// Orphans is "adopt" to index recordings found on disk but not in the
+	// index, or "report" to only list them.
+	Orphans string `mapstructure:"orphans" yaml:"orphans"`
+}
+
+// Validate checks the interval and the orphan policy.
+func (c Config) Validate() error {
+	if c.Interval < 0 || (c.Interval > 0 && c.Interval < time.Minute) {
+		return fmt.Errorf("interval must be 0 or at least 1m")
+	}
+	switch c.Orphans {
+	case OrphansAdopt, OrphansReport:
+	default:
+		return fmt.Errorf("orphans must be adopt or report, got %q", c.Orphans)
+	}
+	return nil
+}
+
+// File is a recording the reconciliation found out of step.
+type File struct {
+	Camera string `json:"camera,omitempty"`
+	Path   string `json:"path"`
+	// Error is why an orphan was not adopted or a removal failed again.
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Checked counts the indexed segments compared with the disk.
+	Checked int `json:"checked"`
+	// Missing segments are indexed but gone from disk, and flagged so;
+	// Flagged counts those first found this run. Found were flagged and
+	// are back. Dropped were gone past the retention, when retention would
+	// have removed them anyway, so their index entries were removed.
+	Missing      []File `json:"missing"`
+	MissingCount int    `json:"missing_count"`
+	Flagged      int    `json:"flagged"`
+	Found        int    `json:"found"`
+	Dropped      int    `json:"dropped"`
+	// Orphans are recordings on disk the index does not know and that were
+	// not adopted; Adopted counts the ones indexed.
+	Orphans     []File `json:"orphans"`
+	OrphanCount int    `json:"orphan_count"`
+	Adopted     int    `json:"adopted"`
+	// Deleted counts failed removals that succeeded on retry; Failing ones
+	// failed again.
+	Deleted      int    `json:"deleted"`
+	Failing      []File `json:"failing"`
+	FailingCount int    `json:"failing_count"`
+	Error        string `json:"error,omitempty"`
+}
+
+type Manager struct {
+	config   Config
+	opts     *storage.Options
+	index    *index.Index
+	store    *storage.Manager
+	notifier *notify.Dispatcher
+	cameras  func() []string
+
+	running atomic.Bool
+}
+
+// NewManager returns a reconciler of the recordings below opts.OutputDir.
+// cameras lists the configured cameras, which orphans are adopted under.
+func NewManager(cfg Config, opts *storage.Options, idx *index.Index, store *storage.Manager, notifier *notify.Dispatcher, cameras func() []string) *Manager {
+	return &Manager{
+		config:   cfg,
+		opts:     opts,
+		index:    idx,
+		store:    store,
+		notifier: notifier,
+		cameras:  cameras,
+	}
+}
+
+func (m *Manager) Config() Config {
+	return m.config
+}
+
+// Start runs the reconciliation every interval until ctx is done.
+func (m *Manager) Start(ctx context.Context) {
+	if m.config.Interval == 0 {
+		return
+	}
+	go func() {
+		timer := time.NewTimer(firstRun)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			m.Run(ctx)
+			timer.Reset(m.config.Interval)
+		}
+	}()
+}
+
+// Running reports whether a run is under way.
+func (m *Manager) Running() bool {
+	return m.running.Load()
+}
+
+// LastReport returns the report of the last run, or nil before the first.
+func (m *Manager) LastReport() *Report {
+	value, ok, err := m.index.Setting(lastRunSetting)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if !ok {
+		return nil
+	}
+	var r Report
+	if err := json.Unmarshal([]byte(value), &r); err != nil {
+		return nil
+	}
+	return &r
+}
+
+// Run retries failed removals, compares the index with the disk and
+// notifies about what it could not put right. It returns nil if a run is
+// already under way.
+func (m *Manager) Run(ctx context.Context) *Report {
+	if !m.running.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer m.running.Store(false)
+
+	r := &Report{StartedAt: time.Now(), Missing: []File{}, Orphans: []File{}, Failing: []File{}}
+	if err := m.run(ctx, r); err != nil {
+		r.Error = err.Error()
+	}
+	r.FinishedAt = time.Now()
+
+	if data, err := json.Marshal(r); err == nil {
+		if err := m.index.SetSetting(lastRunSetting, string(data)); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	log.Printf("Reconciliation: %d segments checked, %d missing (%d new), %d back, %d dropped, %d adopted, %d orphans, %d deleted, %d deletes failing in %s",
+		r.Checked, r.MissingCount, r.Flagged, r.Found, r.Dropped, r.Adopted, r.OrphanCount, r.Deleted, r.FailingCount,
+		r.FinishedAt.Sub(r.StartedAt).Round(time.Second))
+	if r.Flagged > 0 || r.OrphanCount > 0 || r.FailingCount > 0 {
+		m.notifier.Send(notify.Notification{
+			Kind:  notify.KindStorage,
+			Title: "Recordings and index are out of step",
+			Body:  r.summary(),
+		})
+	}
+	return r
+}
+
+func (r *Report) summary() string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("%d recordings missing from disk (%d new), %d not indexed, %d failing to delete.",
+		r.MissingCount, r.Flagged, r.OrphanCount, r.FailingCount))
+	for _, f := range r.Missing {
+		lines = append(lines, "Missing: "+f.Path)
+	}
+	for _, f := range r.Orphans {
+		lines = append(lines, "Not indexed: "+f.Path)
+	}
+	for _, f := range r.Failing {
+		lines = append(lines, "Failing to delete: "+f.Path)
+	}
+	if listed := len(r.Missing) + len(r.Orphans) + len(r.Failing); listed < r.MissingCount+r.OrphanCount+r.FailingCount {
+		lines = append(lines, fmt.Sprintf("and %d more", r.MissingCount+r.OrphanCount+r.FailingCount-listed))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *Manager) run(ctx context.Context, r *Report) error {
+	failing, err := m.retryDeletes(ctx, r)
+	if err != nil {
+		return err
+	}
+	if err := m.checkIndex(ctx, r); err != nil {
+		return err
+	}
+	return m.findOrphans(ctx, r, failing)
+}
+
+// retryDeletes removes the recordings whose removal failed before, and
+// returns the ones that still fail.
+func (m *Manager) retryDeletes(ctx context.Context, r *Report) (map[string]bool, error) {
+	deletes, err := m.index.FailedDeletes()
+	if err != nil {
+		return nil, err
+	}
+	failing := make(map[string]bool)
+	for _, d := range deletes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := m.store.RemoveSegment(d.Path); err != nil {
+			failing[d.Path] = true
+			if err := m.index.AddFailedDelete(d.Path, err.Error()); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+			log.Printf("Warning: Failed again to delete %s (attempt %d): %v", d.Path, d.Attempts+1, err)
+			r.addFailing(File{Path: d.Path, Error: err.Error()})
+			continue
+		}
+		if err := m.index.RemoveFailedDelete(d.Path); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		r.Deleted++
+	}
+	return failing, nil
+}
+
+// checkIndex flags the indexed segments whose file is gone, and clears the
+// flag of those that are back, such as after a disk was remounted.
+func (m *Manager) checkIndex(ctx context.Context, r *Report) error {
+	now := time.Now()
+	after := ""
+	for {
+		segments, err := m.index.SegmentsAfter(after, batchSize)
+		if err != nil {
+			return err
+		}
+		for _, seg := range segments {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			after = seg.Path
+			r.Checked++
+
+			_, err := os.Stat(seg.Path)
+			switch {
+			case err == nil:
+				if !seg.MissingSince.IsZero() {
+					if err := m.index.SetSegmentMissing(seg.Path, time.Time{}); err != nil {
+						return err
+					}
+					r.Found++
+				}
+			case !os.IsNotExist(err):
+				log.Printf("Warning: Reconciliation: %v", err)
+			case seg.EndedAt.Before(m.store.RetentionCutoff(storage.CameraDirName(seg.Camera), now)):
+				if err := m.index.DeleteSegment(seg.Path); err != nil {
+					return err
+				}
+				r.Dropped++
+			default:
+				if seg.MissingSince.IsZero() {
+					if err := m.index.SetSegmentMissing(seg.Path, time.Now()); err != nil {
+						return err
+					}
+					log.Printf("Warning: [%s] %s is indexed but missing from disk", seg.Camera, seg.Filename)
+					r.Flagged++
+				}
+				r.addMissing(File{Camera: seg.Camera, Path: seg.Path})
+			}
+		}
+		if len(segments) < batchSize {
+			return nil
+		}
+	}
+}
+
+// findOrphans looks for settled recordings in the camera directories that
+// are not indexed, and adopts them under the camera of their directory.
+// Recordings past the retention are left to it, and those whose removal
+// failed to the retry.
+func (m *Manager) findOrphans(ctx context.Context, r *Report, failing map[string]bool) error {
+	cameras := make(map[string]string)
+	for _, name := range m.cameras() {
+		cameras[storage.CameraDirName(name)] = name
+	}
+	now := time.Now()
+	dirs, err := os.ReadDir(m.opts.OutputDir)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(m.opts.OutputDir, dir.Name()))
+		if err != nil {
+			log.Printf("Warning: Reconciliation: %v", err)
+			continue
+		}
+
+		cutoff := m.store.RetentionCutoff(dir.Name(), now)
+		var paths []string
+		for _, entry := range entries {
+			if entry.IsDir() || !importer.IsVideo(entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < settleTime || info.ModTime().Before(cutoff) {
+				continue
+			}
+			path := filepath.Join(m.opts.OutputDir, dir.Name(), entry.Name())
+			if !failing[path] {
+				paths = append(paths, path)
+			}
+		}
+		indexed, err := m.index.SegmentsByPath(paths)
+		if err != nil {
+			return err
+		}
+
+		camera, known := cameras[dir.Name()]
+		slices.Sort(paths)
+		for _, path := range paths {
+			if _, ok := indexed[filepath.Clean(path)]; ok {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			orphan := File{Camera: camera, Path: path}
+			switch {
+			case !known:
+				orphan.Error = "no camera records to this directory"
+			case m.config.Orphans == OrphansAdopt:
+				if _, err := importer.Adopt(ctx, m.index, camera, path); err != nil {
+					orphan.Error = err.Error()
+				} else {
+					log.Printf("[%s] Adopted %s, which was missing from the index", camera, filepath.Base(path))
+					r.Adopted++
+					continue
+				}
+			}
+			log.Printf("Warning: %s is not indexed", path)
+			r.addOrphan(orphan)
+		}
+	}
+	return nil
+}
+
+func (r *Report) addMissing(f File) {
+	r.MissingCount++
+	if len(r.Missing) < maxListed {
+		r.Missing = append(r.Missing, f)
+	}
+}
+
+func (r *Report) addOrphan(f File) {
+	r.OrphanCount++
+	if len(r.Orphans) < maxListed {
+		r.Orphans = append(r.Orphans, f)
+	}
+}
+
+func (r *Report) addFailing(f File) {
+	r.FailingCount++
+	if len(r.Failing) < maxListed {
+		r.Failing = append(r.Failing, f)
+	}
+}
@@ -0,0 +1,275 @@
+// Package report sends admins a daily or weekly summary of storage use,
+// camera uptime, events and current problems through the notification
+// channels, so a healthy recorder can be left alone.
+package report
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/internal/notify"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	PeriodDaily  = "daily"
+	PeriodWeekly = "weekly"
+
+	// lastSentSetting keeps when the last scheduled report went out, so a
+	// report due while the recorder was stopped is sent when it starts.
+	lastSentSetting = "report.last_sent"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Schedule says when reports go out: every day At, or every week on Weekday
+// At, covering the calendar days since the last one. Channels (notifier
+// names) limit which notifiers get them; empty means all.
+type Schedule struct {
+	Period   string   `mapstructure:"period" yaml:"period,omitempty"`
+	At       string   `mapstructure:"at" yaml:"at"`
+	Weekday  string   `mapstructure:"weekday" yaml:"weekday"`
+	Channels []string `mapstructure:"channels" yaml:"channels,omitempty"`
+}
+
+// Validate checks the period, time and weekday.
+func (s Schedule) Validate() error {
+	switch s.Period {
+	case "", PeriodDaily, PeriodWeekly:
+	default:
+		return fmt.Errorf("period must be daily or weekly, got %q", s.Period)
+	}
+	if _, err := time.Parse("15:04", s.At); err != nil {
+		return fmt.Errorf("at must be HH:MM, got %q", s.At)
+	}
+	if _, ok := weekdays[strings.ToLower(s.Weekday)]; !ok && s.Period == PeriodWeekly {
+		return fmt.Errorf("invalid weekday %q", s.Weekday)
+	}
+	return nil
+}
+
+// last returns the latest time a report was due at or before t.
+func (s Schedule) last(t time.Time) time.Time {
+	at, _ := time.Parse("15:04", s.At)
+	due := time.Date(t.Year(), t.Month(), t.Day(), at.Hour(), at.Minute(), 0, 0, t.Location())
+	if due.After(t) {
+		due = due.AddDate(0, 0, -1)
+	}
+	if s.Period == PeriodWeekly {
+		back := (int(due.Weekday()) - int(weekdays[strings.ToLower(s.Weekday)]) + 7) % 7
+		due = due.AddDate(0, 0, -back)
+	}
+	return due
+}
+
+// next returns the first time a report is due after t.
+func (s Schedule) next(t time.Time) time.Time {
+	if s.Period == PeriodWeekly {
+		return s.last(t).AddDate(0, 0, 7)
+	}
+	return s.last(t).AddDate(0, 0, 1)
+}
+
+// Report sums up the calendar days From up to To.
+type Report struct {
+	Period   string         `json:"period"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Storage  StorageSummary `json:"storage"`
+	Cameras  []Camera       `json:"cameras"`
+	Problems []string       `json:"problems"`
+}
+
+type StorageSummary struct {
+	TotalSize     int64  `json:"total_size_bytes"`
+	TotalSizeHR   string `json:"total_size_human"`
+	FileCount     int    `json:"file_count"`
+	RetentionDays int    `json:"retention_days"`
+}
+
+// Camera is what one camera did during the report's days. Uptime is the
+// percentage of the days it was not down; Size is what it has stored now.
+type Camera struct {
+	Name          string         `json:"name"`
+	Uptime        float64        `json:"uptime"`
+	DowntimeHours float64        `json:"downtime_hours"`
+	RecordedHours float64        `json:"recorded_hours"`
+	Segments      int            `json:"segments"`
+	Bytes         int64          `json:"bytes"`
+	Size          int64          `json:"size"`
+	Events        map[string]int `json:"events"`
+	State         string         `json:"state"`
+}
+
+type Manager struct {
+	schedule  Schedule
+	index     *index.Index
+	storage   *storage.Manager
+	recorders *recorder.RecorderManager
+	notifier  *notify.Dispatcher
+}
+
+func NewManager(schedule Schedule, idx *index.Index, store *storage.Manager, recorders *recorder.RecorderManager, notifier *notify.Dispatcher) *Manager {
+	return &Manager{
+		schedule:  schedule,
+		index:     idx,
+		storage:   store,
+		recorders: recorders,
+		notifier:  notifier,
+	}
+}
+
+// Start sends the scheduled reports until ctx ends. A report missed while
+// the recorder was stopped goes out right away, once.
+func (m *Manager) Start(ctx context.Context) {
+	if m.schedule.Period == "" {
+		return
+	}
+	go func() {
+		for {
+			now := time.Now()
+			due := m.schedule.last(now)
+			if last := m.lastSent(); last.IsZero() {
+				// The first start only remembers the schedule.
+				m.setLastSent(due)
+			} else if last.Before(due) {
+				if err := m.Send(m.schedule.Period, now); err != nil {
+					log.Printf("Warning: Failed to send the %s report: %v", m.schedule.Period, err)
+				}
+				m.setLastSent(due)
+			}
+
+			timer := time.NewTimer(time.Until(m.schedule.next(now)))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+func (m *Manager) lastSent() time.Time {
+	value, _, err := m.index.Setting(lastSentSetting)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
+
+func (m *Manager) setLastSent(t time.Time) {
+	if err := m.index.SetSetting(lastSentSetting, t.Format(time.RFC3339)); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// Send builds the report of the period ending at the start of now's day and
+// sends it to the report channels.
+func (m *Manager) Send(period string, now time.Time) error {
+	r, err := m.Build(period, now)
+	if err != nil {
+		return err
+	}
+	m.notifier.SendTo(r.Notification(), m.schedule.Channels)
+	return nil
+}
+
+// Build reports on the last day, or the last seven days for a weekly
+// report, before now's day. Problems are the ones at the time of building.
+func (m *Manager) Build(period string, now time.Time) (*Report, error) {
+	days := 1
+	if period == PeriodWeekly {
+		days = 7
+	} else {
+		period = PeriodDaily
+	}
+
+	stats, err := m.storage.GetStats()
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[string]int64, len(stats.Cameras))
+	for _, cam := range stats.Cameras {
+		sizes[cam.Name] = cam.Size
+	}
+
+	status := m.recorders.GetStatus()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	r := &Report{
+		Period: period,
+		From:   today.AddDate(0, 0, -days),
+		To:     today,
+		Storage: StorageSummary{
+			TotalSize:     stats.TotalSize,
+			TotalSizeHR:   stats.TotalSizeHR,
+			FileCount:     stats.FileCount,
+			RetentionDays: stats.RetentionDays,
+		},
+		Cameras:  []Camera{},
+		Problems: []string{},
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(status)) {
+		// Asking for one more day includes today, which is left out as it
+		// is not over yet.
+		daily, err := m.index.DailyStats(name, days+1, now)
+		if err != nil {
+			return nil, err
+		}
+		daily = daily[:days]
+
+		cam := Camera{Name: name, Size: sizes[storage.CameraDirName(name)], Events: map[string]int{}, State: string(status[name].State)}
+		for _, day := range daily {
+			cam.DowntimeHours += day.DowntimeHours
+			cam.RecordedHours += day.RecordedHours
+			cam.Segments += day.Segments
+			cam.Bytes += day.Bytes
+			for kind, n := range day.Events {
+				cam.Events[kind] += n
+			}
+		}
+		cam.Uptime = max(0, 100*(1-cam.DowntimeHours/float64(24*days)))
+		r.Cameras = append(r.Cameras, cam)
+
+		switch st := status[name]; st.State {
+		case recorder.StateRetrying, recorder.StateFailed, recorder.StateCircuitOpen:
+			problem := fmt.Sprintf("%s is %s", name, st.State)
+			if st.LastError != "" {
+				problem += ": " + st.LastError
+			}
+			r.Problems = append(r.Problems, problem)
+		}
+		if st := status[name]; st.Failover != nil {
+			r.Problems = append(r.Problems, fmt.Sprintf("%s records from its failover URL since %s", name, st.Failover.Since.Format("Jan 2 15:04")))
+		}
+	}
+	if stats.WriteLatency != nil && stats.WriteLatency.Stalled {
+		r.Problems = append(r.Problems, "The recordings disk is stalling")
+	}
+	for _, disk := range stats.DiskHealth {
+		if len(disk.Warnings) > 0 {
+			r.Problems = append(r.Problems, fmt.Sprintf("Disk %s reports: %s", disk.Device, strings.Join(disk.Warnings, ", ")))
+		}
+	}
+	if stats.Recovery != nil && len(stats.Recovery.Failed) > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("%d segments could not be recovered after the last crash", len(stats.Recovery.Failed)))
+	}
+	return r, nil
+}
@@ -0,0 +1,77 @@
+package report
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/lets-vibe/cam-recorder/internal/notify"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// Title names the report and says at a glance whether anything is wrong.
+func (r *Report) Title() string {
+	name := "Daily report"
+	if r.Period == PeriodWeekly {
+		name = "Weekly report"
+	}
+	switch len(r.Problems) {
+	case 0:
+		return name + ": all healthy"
+	case 1:
+		return name + ": 1 problem"
+	default:
+		return fmt.Sprintf("%s: %d problems", name, len(r.Problems))
+	}
+}
+
+// Text formats the report as plain text, for mail and chat channels.
+func (r *Report) Text() string {
+	var b strings.Builder
+	last := r.To.AddDate(0, 0, -1)
+	if r.From.Equal(last) {
+		fmt.Fprintf(&b, "Report for %s\n\n", r.From.Format("Mon Jan 2, 2006"))
+	} else {
+		fmt.Fprintf(&b, "Report for %s to %s\n\n", r.From.Format("Mon Jan 2"), last.Format("Mon Jan 2, 2006"))
+	}
+
+	fmt.Fprintf(&b, "Storage: %s in %d files", r.Storage.TotalSizeHR, r.Storage.FileCount)
+	if r.Storage.RetentionDays > 0 {
+		fmt.Fprintf(&b, ", kept for %d days", r.Storage.RetentionDays)
+	}
+	b.WriteString("\n")
+
+	if len(r.Cameras) > 0 {
+		b.WriteString("\nCameras:\n")
+	}
+	for _, cam := range r.Cameras {
+		fmt.Fprintf(&b, "- %s: %.1f%% up, %.1fh recorded (%s), %s stored, now %s\n",
+			cam.Name, cam.Uptime, cam.RecordedHours, storage.FormatBytes(cam.Bytes), storage.FormatBytes(cam.Size), cam.State)
+		if len(cam.Events) > 0 {
+			var events []string
+			for _, kind := range slices.Sorted(maps.Keys(cam.Events)) {
+				events = append(events, fmt.Sprintf("%d %s", cam.Events[kind], kind))
+			}
+			fmt.Fprintf(&b, "  events: %s\n", strings.Join(events, ", "))
+		}
+	}
+
+	if len(r.Problems) > 0 {
+		b.WriteString("\nProblems:\n")
+		for _, problem := range r.Problems {
+			fmt.Fprintf(&b, "- %s\n", problem)
+		}
+	} else {
+		b.WriteString("\nNo problems.\n")
+	}
+	return b.String()
+}
+
+func (r *Report) Notification() notify.Notification {
+	return notify.Notification{
+		Kind:  notify.KindReport,
+		Title: r.Title(),
+		Body:  r.Text(),
+	}
+}
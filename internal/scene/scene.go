@@ -0,0 +1,198 @@
+// Package scene finds segments in which nothing happens and removes them
+// ahead of the recording retention, optionally keeping a still of each.
+package scene
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	queueSize      = 64
+	pruneInterval  = time.Hour
+	batchSize      = 100
+	thumbnailWidth = 640
+)
+
+type Manager struct {
+	config  config.StaticScenesConfig
+	opts    *storage.Options
+	index   *index.Index
+	store   *storage.Manager
+	limiter *recorder.Limiter
+	hwaccel recorder.HWAccel
+	queue   chan string
+	// failed keeps segments that could not be analyzed from being retried
+	// every hour until the next restart.
+	failed map[string]bool
+}
+
+func NewManager(cfg config.StaticScenesConfig, opts *storage.Options, idx *index.Index, store *storage.Manager, limiter *recorder.Limiter, hwaccel recorder.HWAccel) *Manager {
+	return &Manager{
+		config:  cfg,
+		opts:    opts,
+		index:   idx,
+		store:   store,
+		limiter: limiter,
+		hwaccel: hwaccel,
+		queue:   make(chan string, queueSize),
+		failed:  make(map[string]bool),
+	}
+}
+
+// Enqueue schedules the analysis of a finished segment. When the queue is
+// full the segment is skipped; the hourly pass picks it up later.
+func (m *Manager) Enqueue(segmentPath string) {
+	select {
+	case m.queue <- segmentPath:
+	default:
+	}
+}
+
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case path := <-m.queue:
+				if err := m.analyze(ctx, path); err != nil && ctx.Err() == nil {
+					log.Printf("Warning: Failed to analyze %s for activity: %v", filepath.Base(path), err)
+				}
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+
+		for {
+			m.catchUp(ctx)
+			m.prune(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (m *Manager) analyze(ctx context.Context, path string) error {
+	if !m.limiter.Acquire(ctx, nil) {
+		return ctx.Err()
+	}
+	activity, err := recorder.SceneActivity(ctx, path, m.hwaccel)
+	m.limiter.Release()
+	if err != nil {
+		return err
+	}
+	return m.index.SetSegmentActivity(path, activity, activity < m.config.Threshold)
+}
+
+// catchUp analyzes segments recorded while the queue was full or the
+// recorder was down, within the recording retention.
+func (m *Manager) catchUp(ctx context.Context) {
+	since := time.Now().AddDate(0, 0, -m.opts.RetentionDays)
+	segments, err := m.index.UnanalyzedSegments(since, batchSize+len(m.failed))
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	for _, seg := range segments {
+		if ctx.Err() != nil {
+			return
+		}
+		if m.failed[seg.Path] {
+			continue
+		}
+		if err := m.analyze(ctx, seg.Path); err != nil && ctx.Err() == nil {
+			log.Printf("Warning: [%s] Failed to analyze %s for activity: %v", seg.Camera, seg.Filename, err)
+			m.failed[seg.Path] = true
+		}
+	}
+}
+
+// prune removes static segments older than the static retention and the
+// stills whose segments have reached the recording retention.
+func (m *Manager) prune(ctx context.Context) {
+	if m.config.RetentionDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -m.config.RetentionDays)
+		var removed int
+		for ctx.Err() == nil {
+			segments, err := m.index.StaticSegmentsBefore(cutoff, batchSize)
+			if err != nil {
+				log.Printf("Warning: %v", err)
+				break
+			}
+			progress := false
+			for _, seg := range segments {
+				if m.config.KeepThumbnail {
+					m.keepThumbnail(ctx, seg)
+				}
+				if err := m.store.DeleteFile(seg.Camera, seg.Filename); err != nil {
+					// Gone already, or outside the camera directory.
+					if err := m.index.DeleteSegment(seg.Path); err != nil {
+						log.Printf("Warning: %v", err)
+						continue
+					}
+				} else {
+					removed++
+				}
+				progress = true
+			}
+			if len(segments) < batchSize || !progress {
+				break
+			}
+		}
+		if removed > 0 {
+			log.Printf("Static scenes: removed %d segments", removed)
+		}
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -m.opts.RetentionDays)
+	filepath.WalkDir(filepath.Join(m.opts.OutputDir, storage.StaticDir), func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".jpg") {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// keepThumbnail saves a still from the middle of the segment, dated like
+// the segment so it expires with the recording retention.
+func (m *Manager) keepThumbnail(ctx context.Context, seg index.Segment) {
+	if !m.limiter.Acquire(ctx, nil) {
+		return
+	}
+	frame, err := recorder.Thumbnail(ctx, seg.Path, seg.Duration()/2, thumbnailWidth)
+	m.limiter.Release()
+	if err != nil {
+		log.Printf("Warning: [%s] Failed to keep a still of %s: %v", seg.Camera, seg.Filename, err)
+		return
+	}
+
+	out := storage.StaticThumbnailPath(m.opts.OutputDir, seg.Camera, seg.Filename)
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	if err := os.WriteFile(out, frame, 0644); err != nil {
+		log.Printf("Warning: [%s] Failed to keep a still of %s: %v", seg.Camera, seg.Filename, err)
+		return
+	}
+	os.Chtimes(out, seg.EndedAt, seg.EndedAt)
+}
@@ -0,0 +1,325 @@
+package snmp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultBaseOID is where the recorder's objects go when base_oid is
+	// not set: a branch of the Net-SNMP experimental arc, free for local use.
+	DefaultBaseOID = "1.3.6.1.4.1.8072.9999.9999.1"
+
+	// maxBulkVarbinds caps the varbinds of a GetBulk response.
+	maxBulkVarbinds = 100
+
+	engineIDSetting    = "snmp.engine_id"
+	engineBootsSetting = "snmp.engine_boots"
+)
+
+var sysObjects = OID{1, 3, 6, 1, 2, 1, 1}
+
+// AgentConfig sets up the read-only SNMP agent. Community allows SNMP v1
+// and v2c requests with it, and Users SNMP v3 requests with the user-based
+// security model; either can be left out to allow only the other.
+type AgentConfig struct {
+	Enabled   bool   `mapstructure:"enabled" yaml:"enabled"`
+	Listen    string `mapstructure:"listen" yaml:"listen"`
+	Community string `mapstructure:"community" yaml:"community,omitempty"`
+	Users     []User `mapstructure:"users" yaml:"users,omitempty"`
+	// BaseOID is where the recorder's objects are served; see
+	// DefaultBaseOID.
+	BaseOID  string `mapstructure:"base_oid" yaml:"base_oid,omitempty"`
+	Contact  string `mapstructure:"contact" yaml:"contact,omitempty"`
+	Location string `mapstructure:"location" yaml:"location,omitempty"`
+}
+
+// Validate checks the address, base OID and users.
+func (c AgentConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if _, err := net.ResolveUDPAddr("udp", c.Listen); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	if c.BaseOID != "" {
+		if _, err := ParseOID(c.BaseOID); err != nil {
+			return fmt.Errorf("base_oid: %w", err)
+		}
+	}
+	if c.Community == "" && len(c.Users) == 0 {
+		return fmt.Errorf("set a community or users")
+	}
+	for _, u := range c.Users {
+		if err := u.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Settings keeps the engine ID and boot count across restarts, as SNMP v3
+// requires.
+type Settings interface {
+	Setting(key string) (string, bool, error)
+	SetSetting(key, value string) error
+}
+
+// Agent answers Get, GetNext and GetBulk requests for the system group and
+// for the objects its values function returns under the base OID. Set
+// requests are refused.
+type Agent struct {
+	config   AgentConfig
+	base     OID
+	values   func() []Varbind
+	started  time.Time
+	engineID []byte
+	boots    int
+	users    map[string]*localUser
+	stats    usmStats
+	salt     uint64
+}
+
+// NewAgent creates an agent serving values, whose OIDs are relative to the
+// base OID. It loads the engine ID, or makes one, and counts a boot.
+func NewAgent(cfg AgentConfig, settings Settings, values func() []Varbind) (*Agent, error) {
+	if cfg.BaseOID == "" {
+		cfg.BaseOID = DefaultBaseOID
+	}
+	base, err := ParseOID(cfg.BaseOID)
+	if err != nil {
+		return nil, err
+	}
+	a := &Agent{
+		config:  cfg,
+		base:    base,
+		values:  values,
+		started: time.Now(),
+		users:   make(map[string]*localUser),
+	}
+
+	value, ok, err := settings.Setting(engineIDSetting)
+	if err != nil {
+		return nil, err
+	}
+	if a.engineID, err = hex.DecodeString(value); !ok || err != nil || len(a.engineID) < 5 {
+		// An enterprise-specific ID of random octets (RFC 3411).
+		a.engineID = append([]byte{0x80, 0x00, 0x1f, 0x88, 0x05}, make([]byte, 8)...)
+		rand.Read(a.engineID[5:])
+		if err := settings.SetSetting(engineIDSetting, hex.EncodeToString(a.engineID)); err != nil {
+			return nil, err
+		}
+	}
+	value, _, err = settings.Setting(engineBootsSetting)
+	if err != nil {
+		return nil, err
+	}
+	a.boots, _ = strconv.Atoi(value)
+	a.boots++
+	if err := settings.SetSetting(engineBootsSetting, strconv.Itoa(a.boots)); err != nil {
+		return nil, err
+	}
+
+	for _, u := range cfg.Users {
+		a.users[u.Name] = u.localize(a.engineID)
+	}
+	var salt [8]byte
+	rand.Read(salt[:])
+	for _, c := range salt {
+		a.salt = a.salt<<8 | uint64(c)
+	}
+	return a, nil
+}
+
+// Start listens for requests until ctx is done.
+func (a *Agent) Start(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", a.config.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", a.config.Listen, err)
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Warning: SNMP agent stopped: %v", err)
+				}
+				return
+			}
+			resp, err := a.handle(buf[:n])
+			if err != nil {
+				log.Printf("SNMP: Ignored a request from %s: %v", addr, err)
+				continue
+			}
+			if resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return nil
+}
+
+// handle answers a request, or returns nil to drop it.
+func (a *Agent) handle(packet []byte) ([]byte, error) {
+	tag, body, _, err := readTLV(packet)
+	if err != nil {
+		return nil, err
+	}
+	if tag != tagSequence {
+		return nil, fmt.Errorf("not an SNMP message")
+	}
+	version, _, err := readInt(body)
+	if err != nil {
+		return nil, err
+	}
+	switch version {
+	case 0, Version2c:
+		return a.handleCommunity(packet)
+	case version3:
+		return a.handleUSM(packet)
+	default:
+		return nil, fmt.Errorf("unsupported SNMP version %d", version)
+	}
+}
+
+func (a *Agent) handleCommunity(packet []byte) ([]byte, error) {
+	req, err := Unmarshal(packet)
+	if err != nil {
+		return nil, err
+	}
+	if a.config.Community == "" || req.Community != a.config.Community {
+		// Wrong communities go unanswered, as they should.
+		return nil, nil
+	}
+	resp := req
+	resp.PDU = a.respond(req.PDU, req.Version == 0)
+	return resp.Marshal()
+}
+
+// respond answers a request PDU from the current values. v1 reports
+// missing objects with an error status instead of exceptions.
+func (a *Agent) respond(req PDU, v1 bool) PDU {
+	resp := PDU{Type: Response, RequestID: req.RequestID}
+	if req.Type == GetBulkRequest && v1 {
+		resp.ErrorStatus = GenErr
+		resp.Varbinds = req.Varbinds
+		return resp
+	}
+	mib := a.snapshot()
+	fail := func(status, index int) PDU {
+		resp.ErrorStatus, resp.ErrorIndex, resp.Varbinds = status, index, req.Varbinds
+		return resp
+	}
+
+	switch req.Type {
+	case GetRequest:
+		for i, vb := range req.Varbinds {
+			j, found := slices.BinarySearchFunc(mib, vb.OID, func(v Varbind, oid OID) int { return compareOID(v.OID, oid) })
+			if !found {
+				if v1 {
+					return fail(NoSuchName, i+1)
+				}
+				resp.Varbinds = append(resp.Varbinds, Varbind{OID: vb.OID, Value: NoSuchObject})
+				continue
+			}
+			resp.Varbinds = append(resp.Varbinds, mib[j])
+		}
+	case GetNextRequest:
+		for i, vb := range req.Varbinds {
+			next, ok := nextVarbind(mib, vb.OID)
+			if !ok && v1 {
+				return fail(NoSuchName, i+1)
+			}
+			resp.Varbinds = append(resp.Varbinds, next)
+		}
+	case GetBulkRequest:
+		nonRepeaters := min(max(req.ErrorStatus, 0), len(req.Varbinds))
+		repetitions := max(req.ErrorIndex, 0)
+		for _, vb := range req.Varbinds[:nonRepeaters] {
+			next, _ := nextVarbind(mib, vb.OID)
+			resp.Varbinds = append(resp.Varbinds, next)
+		}
+		repeaters := slices.Clone(req.Varbinds[nonRepeaters:])
+		for range repetitions {
+			if len(repeaters) == 0 || len(resp.Varbinds)+len(repeaters) > maxBulkVarbinds {
+				break
+			}
+			done := true
+			for i, vb := range repeaters {
+				next, ok := nextVarbind(mib, vb.OID)
+				resp.Varbinds = append(resp.Varbinds, next)
+				repeaters[i] = next
+				done = done && !ok
+			}
+			if done {
+				break
+			}
+		}
+	case SetRequest:
+		if v1 {
+			return fail(NoSuchName, 1)
+		}
+		return fail(NotWritable, 1)
+	default:
+		return fail(GenErr, 0)
+	}
+	return resp
+}
+
+// nextVarbind returns the first object after oid, or endOfMibView.
+func nextVarbind(mib []Varbind, oid OID) (Varbind, bool) {
+	i, found := slices.BinarySearchFunc(mib, oid, func(v Varbind, oid OID) int { return compareOID(v.OID, oid) })
+	if found {
+		i++
+	}
+	if i >= len(mib) {
+		return Varbind{OID: oid, Value: EndOfMibView}, false
+	}
+	return mib[i], true
+}
+
+// snapshot returns the system group and the recorder's objects, sorted.
+func (a *Agent) snapshot() []Varbind {
+	host, _ := os.Hostname()
+	sys := func(n uint32, value any) Varbind {
+		return Varbind{OID: append(slices.Clone(sysObjects), n, 0), Value: value}
+	}
+	mib := []Varbind{
+		sys(1, "cam-recorder, an IP camera recorder"),
+		sys(2, a.base),
+		sys(3, TimeTicks(time.Since(a.started)/(10*time.Millisecond))),
+		sys(4, a.config.Contact),
+		sys(5, host),
+		sys(6, a.config.Location),
+	}
+	for _, vb := range a.values() {
+		mib = append(mib, Varbind{OID: append(slices.Clone(a.base), vb.OID...), Value: vb.Value})
+	}
+	slices.SortFunc(mib, func(x, y Varbind) int { return compareOID(x.OID, y.OID) })
+	return mib
+}
+
+func compareOID(x, y OID) int {
+	for i := range min(len(x), len(y)) {
+		if x[i] != y[i] {
+			if x[i] < y[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(x) - len(y)
+}
@@ -0,0 +1,72 @@
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+const (
+	requestTimeout = 3 * time.Second
+	requestRetries = 3
+)
+
+// Set sets oid to the integer value on the agent at addr (host, or
+// host:port with 161 the default), retrying lost packets.
+func Set(ctx context.Context, addr, community string, oid OID, value int) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "161")
+	}
+	req := Message{
+		Version:   Version2c,
+		Community: community,
+		PDU: PDU{
+			Type:      SetRequest,
+			RequestID: rand.Int32(),
+			Varbinds:  []Varbind{{OID: oid, Value: value}},
+		},
+	}
+	packet, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 65535)
+	for range requestRetries {
+		if _, err := conn.Write(packet); err != nil {
+			return fmt.Errorf("failed to send to %s: %w", addr, err)
+		}
+		deadline := time.Now().Add(requestTimeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				break
+			}
+			resp, err := Unmarshal(buf[:n])
+			if err != nil || resp.PDU.Type != Response || resp.PDU.RequestID != req.PDU.RequestID {
+				continue
+			}
+			if resp.PDU.ErrorStatus != NoError {
+				return fmt.Errorf("%s refused to set %s: error status %d", addr, oid, resp.PDU.ErrorStatus)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no answer from %s", addr)
+}
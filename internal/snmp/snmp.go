@@ -0,0 +1,426 @@
+// Package snmp speaks just enough SNMP for the recorder: a client that sets
+// a PoE switch port, and a read-only agent answering v1, v2c and v3 (USM)
+// requests about the recorder's health. Messages are BER-encoded by hand.
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BER tags of the values and PDUs used.
+const (
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagOID         = 0x06
+	tagSequence    = 0x30
+	tagCounter32   = 0x41
+	tagGauge32     = 0x42
+	tagTimeTicks   = 0x43
+	tagCounter64   = 0x46
+
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+
+	GetRequest     = 0xa0
+	GetNextRequest = 0xa1
+	Response       = 0xa2
+	SetRequest     = 0xa3
+	GetBulkRequest = 0xa5
+)
+
+// Version2c is the version number of SNMP v2c in messages.
+const Version2c = 1
+
+// Error statuses of a Response.
+const (
+	NoError     = 0
+	TooBig      = 1
+	NoSuchName  = 2
+	BadValue    = 3
+	ReadOnly    = 4
+	GenErr      = 5
+	NoAccess    = 6
+	NotWritable = 17
+)
+
+var errTruncated = errors.New("truncated message")
+
+// OID is an object identifier such as 1.3.6.1.2.1.1.1.0.
+type OID []uint32
+
+// ParseOID parses an OID in dotted form, with or without a leading dot.
+func ParseOID(s string) (OID, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	oid := make(OID, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		oid[i] = uint32(n)
+	}
+	if oid[0] > 2 || oid[1] >= 40 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	return oid, nil
+}
+
+func (o OID) String() string {
+	parts := make([]string, len(o))
+	for i, n := range o {
+		parts[i] = strconv.FormatUint(uint64(n), 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Typed values besides int (INTEGER), string and []byte (OCTET STRING), OID
+// and nil (NULL).
+type (
+	Counter32 uint32
+	Gauge32   uint32
+	TimeTicks uint32
+	Counter64 uint64
+	// Exception is noSuchObject, noSuchInstance or endOfMibView in place of
+	// a value.
+	Exception byte
+)
+
+const (
+	NoSuchObject   Exception = tagNoSuchObject
+	NoSuchInstance Exception = tagNoSuchInstance
+	EndOfMibView   Exception = tagEndOfMibView
+)
+
+type Varbind struct {
+	OID   OID
+	Value any
+}
+
+type PDU struct {
+	Type      byte
+	RequestID int32
+	// ErrorStatus and ErrorIndex are NonRepeaters and MaxRepetitions in a
+	// GetBulkRequest.
+	ErrorStatus int
+	ErrorIndex  int
+	Varbinds    []Varbind
+}
+
+type Message struct {
+	Version   int
+	Community string
+	PDU       PDU
+}
+
+// Marshal encodes the message.
+func (m Message) Marshal() ([]byte, error) {
+	var varbinds []byte
+	for _, vb := range m.PDU.Varbinds {
+		value, err := encodeValue(vb.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", vb.OID, err)
+		}
+		varbinds = append(varbinds, tlv(tagSequence, append(encodeOID(vb.OID), value...))...)
+	}
+	pdu := encodeInt(int64(m.PDU.RequestID))
+	pdu = append(pdu, encodeInt(int64(m.PDU.ErrorStatus))...)
+	pdu = append(pdu, encodeInt(int64(m.PDU.ErrorIndex))...)
+	pdu = append(pdu, tlv(tagSequence, varbinds)...)
+
+	msg := encodeInt(int64(m.Version))
+	msg = append(msg, tlv(tagOctetString, []byte(m.Community))...)
+	msg = append(msg, tlv(m.PDU.Type, pdu)...)
+	return tlv(tagSequence, msg), nil
+}
+
+// Unmarshal decodes a message.
+func Unmarshal(b []byte) (Message, error) {
+	var m Message
+	tag, body, _, err := readTLV(b)
+	if err != nil {
+		return m, err
+	}
+	if tag != tagSequence {
+		return m, fmt.Errorf("not an SNMP message")
+	}
+	version, body, err := readInt(body)
+	if err != nil {
+		return m, err
+	}
+	m.Version = int(version)
+	tag, community, body, err := readTLV(body)
+	if err != nil {
+		return m, err
+	}
+	if tag != tagOctetString {
+		return m, fmt.Errorf("invalid community")
+	}
+	m.Community = string(community)
+
+	tag, pdu, _, err := readTLV(body)
+	if err != nil {
+		return m, err
+	}
+	m.PDU.Type = tag
+	id, pdu, err := readInt(pdu)
+	if err != nil {
+		return m, err
+	}
+	status, pdu, err := readInt(pdu)
+	if err != nil {
+		return m, err
+	}
+	index, pdu, err := readInt(pdu)
+	if err != nil {
+		return m, err
+	}
+	m.PDU.RequestID, m.PDU.ErrorStatus, m.PDU.ErrorIndex = int32(id), int(status), int(index)
+
+	tag, varbinds, _, err := readTLV(pdu)
+	if err != nil {
+		return m, err
+	}
+	if tag != tagSequence {
+		return m, fmt.Errorf("invalid varbind list")
+	}
+	for len(varbinds) > 0 {
+		var vb []byte
+		tag, vb, varbinds, err = readTLV(varbinds)
+		if err != nil {
+			return m, err
+		}
+		if tag != tagSequence {
+			return m, fmt.Errorf("invalid varbind")
+		}
+		tag, oid, rest, err := readTLV(vb)
+		if err != nil {
+			return m, err
+		}
+		if tag != tagOID {
+			return m, fmt.Errorf("invalid varbind name")
+		}
+		name, err := decodeOID(oid)
+		if err != nil {
+			return m, err
+		}
+		tag, content, _, err := readTLV(rest)
+		if err != nil {
+			return m, err
+		}
+		value, err := decodeValue(tag, content)
+		if err != nil {
+			return m, err
+		}
+		m.PDU.Varbinds = append(m.PDU.Varbinds, Varbind{OID: name, Value: value})
+	}
+	return m, nil
+}
+
+func tlv(tag byte, content []byte) []byte {
+	b := []byte{tag}
+	n := len(content)
+	switch {
+	case n < 0x80:
+		b = append(b, byte(n))
+	default:
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		b = append(b, 0x80|byte(len(length)))
+		b = append(b, length...)
+	}
+	return append(b, content...)
+}
+
+// readTLV splits off the first value of b, returning its tag, its content
+// and what follows it.
+func readTLV(b []byte) (byte, []byte, []byte, error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errTruncated
+	}
+	tag, n, b := b[0], int(b[1]), b[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 4 || len(b) < size {
+			return 0, nil, nil, fmt.Errorf("invalid length")
+		}
+		n = 0
+		for _, c := range b[:size] {
+			n = n<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if n < 0 || len(b) < n {
+		return 0, nil, nil, errTruncated
+	}
+	return tag, b[:n], b[n:], nil
+}
+
+func readInt(b []byte) (int64, []byte, error) {
+	tag, content, rest, err := readTLV(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	if tag != tagInteger || len(content) == 0 || len(content) > 8 {
+		return 0, nil, fmt.Errorf("invalid integer")
+	}
+	return decodeInt(content), rest, nil
+}
+
+func encodeInt(n int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		if (n >= -0x80 && n < 0x80) || len(b) == 8 {
+			break
+		}
+		n >>= 8
+	}
+	return tlv(tagInteger, b)
+}
+
+func decodeInt(b []byte) int64 {
+	n := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		n = n<<8 | int64(c)
+	}
+	return n
+}
+
+func encodeUint(tag byte, n uint64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+		if n == 0 {
+			break
+		}
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return tlv(tag, b)
+}
+
+func decodeUint(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+func encodeOID(oid OID) []byte {
+	if len(oid) < 2 {
+		return tlv(tagOID, []byte{0})
+	}
+	b := appendBase128(nil, oid[0]*40+oid[1])
+	for _, n := range oid[2:] {
+		b = appendBase128(b, n)
+	}
+	return tlv(tagOID, b)
+}
+
+func appendBase128(b []byte, n uint32) []byte {
+	var digits []byte
+	for {
+		digits = append([]byte{byte(n & 0x7f)}, digits...)
+		n >>= 7
+		if n == 0 {
+			break
+		}
+	}
+	for i := range len(digits) - 1 {
+		digits[i] |= 0x80
+	}
+	return append(b, digits...)
+}
+
+func decodeOID(b []byte) (OID, error) {
+	var oid OID
+	var n uint32
+	for i, c := range b {
+		n = n<<7 | uint32(c&0x7f)
+		if c&0x80 != 0 {
+			if i == len(b)-1 {
+				return nil, fmt.Errorf("invalid OID")
+			}
+			continue
+		}
+		if oid == nil {
+			first := min(n/40, 2)
+			oid = OID{first, n - first*40}
+		} else {
+			oid = append(oid, n)
+		}
+		n = 0
+	}
+	if oid == nil {
+		return nil, fmt.Errorf("invalid OID")
+	}
+	return oid, nil
+}
+
+func encodeValue(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return []byte{tagNull, 0}, nil
+	case int:
+		return encodeInt(int64(v)), nil
+	case string:
+		return tlv(tagOctetString, []byte(v)), nil
+	case []byte:
+		return tlv(tagOctetString, v), nil
+	case OID:
+		return encodeOID(v), nil
+	case Counter32:
+		return encodeUint(tagCounter32, uint64(v)), nil
+	case Gauge32:
+		return encodeUint(tagGauge32, uint64(v)), nil
+	case TimeTicks:
+		return encodeUint(tagTimeTicks, uint64(v)), nil
+	case Counter64:
+		return encodeUint(tagCounter64, uint64(v)), nil
+	case Exception:
+		return []byte{byte(v), 0}, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+func decodeValue(tag byte, b []byte) (any, error) {
+	switch tag {
+	case tagNull:
+		return nil, nil
+	case tagInteger:
+		if len(b) == 0 || len(b) > 8 {
+			return nil, fmt.Errorf("invalid integer")
+		}
+		return int(decodeInt(b)), nil
+	case tagOctetString:
+		return append([]byte(nil), b...), nil
+	case tagOID:
+		return decodeOID(b)
+	case tagCounter32:
+		return Counter32(decodeUint(b)), nil
+	case tagGauge32:
+		return Gauge32(decodeUint(b)), nil
+	case tagTimeTicks:
+		return TimeTicks(decodeUint(b)), nil
+	case tagCounter64:
+		return Counter64(decodeUint(b)), nil
+	case tagNoSuchObject, tagNoSuchInstance, tagEndOfMibView:
+		return Exception(tag), nil
+	default:
+		return nil, fmt.Errorf("unsupported value type 0x%02x", tag)
+	}
+}
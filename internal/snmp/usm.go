@@ -0,0 +1,411 @@
+package snmp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"time"
+)
+
+const (
+	version3         = 3
+	securityModelUSM = 3
+	reportPDU        = 0xa8
+
+	flagAuth       = 0x01
+	flagPriv       = 0x02
+	flagReportable = 0x04
+
+	// timeWindow is how far a request's engine time may be off (RFC 3414).
+	timeWindow = 150
+	maxMsgSize = 65507
+)
+
+// usmStats OIDs, reported to managers whose requests fail security checks.
+var (
+	usmStatsUnsupportedSecLevels = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 1, 0}
+	usmStatsNotInTimeWindows     = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 2, 0}
+	usmStatsUnknownUserNames     = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 3, 0}
+	usmStatsUnknownEngineIDs     = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 4, 0}
+	usmStatsWrongDigests         = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 5, 0}
+	usmStatsDecryptionErrors     = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 6, 0}
+)
+
+type usmStats map[string]Counter32
+
+// User is an SNMP v3 user. AuthProtocol is md5, sha (the default) or
+// sha256; PrivProtocol is aes (AES-128) or empty for authentication only.
+// Without an AuthPassword the user needs neither.
+type User struct {
+	Name         string `mapstructure:"name" yaml:"name"`
+	AuthProtocol string `mapstructure:"auth_protocol" yaml:"auth_protocol,omitempty"`
+	AuthPassword string `mapstructure:"auth_password" yaml:"auth_password,omitempty"`
+	PrivProtocol string `mapstructure:"priv_protocol" yaml:"priv_protocol,omitempty"`
+	PrivPassword string `mapstructure:"priv_password" yaml:"priv_password,omitempty"`
+}
+
+// Validate checks the protocols and that passwords are long enough.
+func (u User) Validate() error {
+	if u.Name == "" {
+		return fmt.Errorf("users: name is required")
+	}
+	if _, _, ok := authProtocol(u.AuthProtocol); !ok {
+		return fmt.Errorf("user %s: auth_protocol must be md5, sha or sha256", u.Name)
+	}
+	if u.AuthPassword != "" && len(u.AuthPassword) < 8 {
+		return fmt.Errorf("user %s: auth_password must be at least 8 characters", u.Name)
+	}
+	switch u.PrivProtocol {
+	case "":
+	case "aes":
+		if u.AuthPassword == "" {
+			return fmt.Errorf("user %s: privacy needs an auth_password", u.Name)
+		}
+		if len(u.PrivPassword) < 8 {
+			return fmt.Errorf("user %s: priv_password must be at least 8 characters", u.Name)
+		}
+	default:
+		return fmt.Errorf("user %s: priv_protocol must be aes", u.Name)
+	}
+	return nil
+}
+
+func authProtocol(name string) (func() hash.Hash, int, bool) {
+	switch name {
+	case "md5":
+		return md5.New, 12, true
+	case "", "sha":
+		return sha1.New, 12, true
+	case "sha256":
+		return sha256.New, 24, true
+	default:
+		return nil, 0, false
+	}
+}
+
+// localUser is a user with keys localized to the agent's engine.
+type localUser struct {
+	name    string
+	hash    func() hash.Hash
+	macLen  int
+	authKey []byte
+	privKey []byte
+}
+
+func (u User) localize(engineID []byte) *localUser {
+	h, macLen, _ := authProtocol(u.AuthProtocol)
+	l := &localUser{name: u.Name, hash: h, macLen: macLen}
+	if u.AuthPassword != "" {
+		l.authKey = localizeKey(h, u.AuthPassword, engineID)
+	}
+	if u.PrivProtocol != "" {
+		l.privKey = localizeKey(h, u.PrivPassword, engineID)[:16]
+	}
+	return l
+}
+
+func (l *localUser) flags() byte {
+	var flags byte
+	if l.authKey != nil {
+		flags |= flagAuth
+	}
+	if l.privKey != nil {
+		flags |= flagPriv
+	}
+	return flags
+}
+
+// localizeKey turns a password into a key for one engine (RFC 3414 A.2).
+func localizeKey(h func() hash.Hash, password string, engineID []byte) []byte {
+	d := h()
+	buf := make([]byte, 64)
+	for i := 0; i < 1<<20; i += len(buf) {
+		for j := range buf {
+			buf[j] = password[(i+j)%len(password)]
+		}
+		d.Write(buf)
+	}
+	ku := d.Sum(nil)
+	d = h()
+	d.Write(ku)
+	d.Write(engineID)
+	d.Write(ku)
+	return d.Sum(nil)
+}
+
+func (l *localUser) mac(msg []byte) []byte {
+	m := hmac.New(l.hash, l.authKey)
+	m.Write(msg)
+	return m.Sum(nil)[:l.macLen]
+}
+
+// crypt encrypts or decrypts a scoped PDU with AES-128 in CFB mode (RFC
+// 3826).
+func (l *localUser) crypt(data []byte, boots, engineTime int, salt []byte, encrypt bool) []byte {
+	block, _ := aes.NewCipher(l.privKey)
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv[0:], uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(engineTime))
+	copy(iv[8:], salt)
+	out := make([]byte, len(data))
+	if encrypt {
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(out, data)
+	} else {
+		cipher.NewCFBDecrypter(block, iv).XORKeyStream(out, data)
+	}
+	return out
+}
+
+// v3Message is an SNMP v3 message with the user-based security model.
+type v3Message struct {
+	id          int
+	maxSize     int
+	flags       byte
+	engineID    []byte
+	boots       int
+	engineTime  int
+	user        string
+	authParams  []byte
+	privParams  []byte
+	data        []byte // the scoped PDU, or its ciphertext with flagPriv
+	authOffset  int    // where authParams are in the raw message
+	contextName []byte
+	pdu         PDU
+}
+
+func parseV3(packet []byte) (*v3Message, error) {
+	m := &v3Message{}
+	_, body, _, err := readTLV(packet)
+	if err != nil {
+		return nil, err
+	}
+	if _, body, err = readInt(body); err != nil {
+		return nil, err
+	}
+
+	tag, header, body, err := readTLV(body)
+	if err != nil || tag != tagSequence {
+		return nil, fmt.Errorf("invalid header")
+	}
+	id, header, err := readInt(header)
+	if err != nil {
+		return nil, err
+	}
+	maxSize, header, err := readInt(header)
+	if err != nil {
+		return nil, err
+	}
+	tag, flags, header, err := readTLV(header)
+	if err != nil || tag != tagOctetString || len(flags) != 1 {
+		return nil, fmt.Errorf("invalid flags")
+	}
+	model, _, err := readInt(header)
+	if err != nil {
+		return nil, err
+	}
+	if model != securityModelUSM {
+		return nil, fmt.Errorf("unsupported security model %d", model)
+	}
+	m.id, m.maxSize, m.flags = int(id), int(maxSize), flags[0]
+
+	tag, params, body, err := readTLV(body)
+	if err != nil || tag != tagOctetString {
+		return nil, fmt.Errorf("invalid security parameters")
+	}
+	_, params, _, err = readTLV(params)
+	if err != nil {
+		return nil, err
+	}
+	var fields [6][]byte
+	for i := range fields {
+		if i == 1 || i == 2 {
+			var n int64
+			if n, params, err = readInt(params); err != nil {
+				return nil, err
+			}
+			if i == 1 {
+				m.boots = int(n)
+			} else {
+				m.engineTime = int(n)
+			}
+			continue
+		}
+		if tag, fields[i], params, err = readTLV(params); err != nil || tag != tagOctetString {
+			return nil, fmt.Errorf("invalid security parameters")
+		}
+	}
+	m.engineID, m.user, m.authParams, m.privParams = fields[0], string(fields[3]), fields[4], fields[5]
+	// The fields are slices of packet, so their capacity tells where they
+	// start.
+	m.authOffset = cap(packet) - cap(m.authParams)
+
+	tag, content, rest, err := readTLV(body)
+	if err != nil {
+		return nil, err
+	}
+	if (tag == tagOctetString) != (m.flags&flagPriv != 0) {
+		return nil, fmt.Errorf("invalid data")
+	}
+	if tag == tagOctetString {
+		m.data = content
+	} else {
+		m.data = body[:len(body)-len(rest)]
+	}
+	return m, nil
+}
+
+// parseScopedPDU decodes the plaintext scoped PDU in m.data.
+func (m *v3Message) parseScopedPDU() error {
+	tag, scoped, _, err := readTLV(m.data)
+	if err != nil || tag != tagSequence {
+		return fmt.Errorf("invalid scoped PDU")
+	}
+	if _, _, scoped, err = readTLV(scoped); err != nil {
+		return err
+	}
+	if _, m.contextName, scoped, err = readTLV(scoped); err != nil {
+		return err
+	}
+	// Decode the PDU as the tail of a v2c message.
+	wrapped := append(encodeInt(Version2c), tlv(tagOctetString, nil)...)
+	msg, err := Unmarshal(tlv(tagSequence, append(wrapped, scoped...)))
+	if err != nil {
+		return err
+	}
+	m.pdu = msg.PDU
+	return nil
+}
+
+// marshal encodes the message, encrypting and authenticating it with the
+// user's keys when the flags ask for it.
+func (m *v3Message) marshal(u *localUser, salt uint64) ([]byte, error) {
+	scoped, err := Message{PDU: m.pdu}.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	// Take the PDU back out of the v2c framing.
+	_, body, _, _ := readTLV(scoped)
+	_, _, body, _ = readTLV(body)
+	_, _, pdu, _ := readTLV(body)
+	scopedPDU := tlv(tagSequence, append(append(tlv(tagOctetString, m.engineID), tlv(tagOctetString, m.contextName)...), pdu...))
+
+	var authParams, privParams []byte
+	data := scopedPDU
+	if m.flags&flagPriv != 0 {
+		privParams = binary.BigEndian.AppendUint64(nil, salt)
+		data = tlv(tagOctetString, u.crypt(scopedPDU, m.boots, m.engineTime, privParams, true))
+	}
+	if m.flags&flagAuth != 0 {
+		authParams = make([]byte, u.macLen)
+	}
+
+	params := tlv(tagOctetString, m.engineID)
+	params = append(params, encodeInt(int64(m.boots))...)
+	params = append(params, encodeInt(int64(m.engineTime))...)
+	params = append(params, tlv(tagOctetString, []byte(m.user))...)
+	params = append(params, tlv(tagOctetString, authParams)...)
+	privTLV := tlv(tagOctetString, privParams)
+	params = append(params, privTLV...)
+
+	header := encodeInt(int64(m.id))
+	header = append(header, encodeInt(maxMsgSize)...)
+	header = append(header, tlv(tagOctetString, []byte{m.flags})...)
+	header = append(header, encodeInt(securityModelUSM)...)
+
+	msg := encodeInt(version3)
+	msg = append(msg, tlv(tagSequence, header)...)
+	msg = append(msg, tlv(tagOctetString, tlv(tagSequence, params))...)
+	msg = append(msg, data...)
+	msg = tlv(tagSequence, msg)
+
+	if m.flags&flagAuth != 0 {
+		offset := len(msg) - len(data) - len(privTLV) - len(authParams)
+		copy(msg[offset:], u.mac(msg))
+	}
+	return msg, nil
+}
+
+// handleUSM checks an SNMP v3 request's user, time and digest, and answers
+// it or reports why not (RFC 3414).
+func (a *Agent) handleUSM(packet []byte) ([]byte, error) {
+	req, err := parseV3(packet)
+	if err != nil {
+		return nil, err
+	}
+	engineTime := int(time.Since(a.started).Seconds())
+	resp := &v3Message{
+		id:         req.id,
+		engineID:   a.engineID,
+		boots:      a.boots,
+		engineTime: engineTime,
+		user:       req.user,
+	}
+	report := func(oid OID, u *localUser) ([]byte, error) {
+		if req.flags&flagReportable == 0 {
+			return nil, nil
+		}
+		a.stats[oid.String()]++
+		resp.flags = 0
+		if u != nil {
+			resp.flags = req.flags & flagAuth
+		}
+		resp.pdu = PDU{Type: reportPDU, Varbinds: []Varbind{{OID: oid, Value: a.stats[oid.String()]}}}
+		if req.flags&flagPriv == 0 && req.parseScopedPDU() == nil {
+			resp.pdu.RequestID = req.pdu.RequestID
+		}
+		return resp.marshal(u, 0)
+	}
+	if a.stats == nil {
+		a.stats = make(usmStats)
+	}
+
+	if string(req.engineID) != string(a.engineID) {
+		// Discovery: tell the manager the engine ID, boots and time.
+		return report(usmStatsUnknownEngineIDs, nil)
+	}
+	u, ok := a.users[req.user]
+	if !ok {
+		return report(usmStatsUnknownUserNames, nil)
+	}
+	if req.flags&(flagAuth|flagPriv) != u.flags() {
+		return report(usmStatsUnsupportedSecLevels, nil)
+	}
+	if req.flags&flagAuth != 0 {
+		if len(req.authParams) != u.macLen {
+			return report(usmStatsWrongDigests, nil)
+		}
+		signed := make([]byte, len(packet))
+		copy(signed, packet)
+		clear(signed[req.authOffset : req.authOffset+u.macLen])
+		if !hmac.Equal(u.mac(signed), req.authParams) {
+			return report(usmStatsWrongDigests, nil)
+		}
+		if req.boots != a.boots || req.engineTime < engineTime-timeWindow || req.engineTime > engineTime+timeWindow {
+			return report(usmStatsNotInTimeWindows, u)
+		}
+	}
+	if req.flags&flagPriv != 0 {
+		if len(req.privParams) != 8 {
+			return report(usmStatsDecryptionErrors, nil)
+		}
+		req.data = u.crypt(req.data, req.boots, req.engineTime, req.privParams, false)
+	}
+	if err := req.parseScopedPDU(); err != nil {
+		if req.flags&flagPriv != 0 {
+			return report(usmStatsDecryptionErrors, nil)
+		}
+		return nil, err
+	}
+
+	resp.flags = req.flags &^ flagReportable
+	resp.contextName = req.contextName
+	resp.pdu = a.respond(req.pdu, false)
+	a.salt++
+	return resp.marshal(u, a.salt)
+}
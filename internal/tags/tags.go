@@ -0,0 +1,105 @@
+// Package tags matches cameras by their free-form key=value tags, such as
+// location=garage or priority=high.
+package tags
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Selector matches tags holding each of its keys with the given value, or
+// with any value when the value is empty. An empty Selector matches
+// everything. Keys and values are compared case-insensitively.
+type Selector map[string]string
+
+// Parse reads selectors written as "key=value" or "key". Each value may hold
+// several separated by commas; all of them must match.
+func Parse(values []string) (Selector, error) {
+	sel := Selector{}
+	for _, value := range values {
+		for term := range strings.SplitSeq(value, ",") {
+			term = strings.TrimSpace(term)
+			if term == "" {
+				continue
+			}
+			key, val, _ := strings.Cut(term, "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			if key == "" {
+				return nil, fmt.Errorf("invalid tag %q: key is empty", term)
+			}
+			sel[key] = strings.TrimSpace(val)
+		}
+	}
+	return sel, nil
+}
+
+// Match reports whether tags satisfy the selector.
+func (s Selector) Match(tags map[string]string) bool {
+	for key, want := range s {
+		got, ok := lookup(tags, key)
+		if !ok || (want != "" && !strings.EqualFold(got, want)) {
+			return false
+		}
+	}
+	return true
+}
+
+// String writes the selector the way Parse reads it, sorted by key.
+func (s Selector) String() string {
+	terms := make([]string, 0, len(s))
+	for _, key := range slices.Sorted(maps.Keys(s)) {
+		if s[key] == "" {
+			terms = append(terms, key)
+		} else {
+			terms = append(terms, key+"="+s[key])
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+// Validate checks that tags can be selected: keys must be non-empty and hold
+// neither "=" nor ",", and values must not hold ",".
+func Validate(tags map[string]string) error {
+	for key, value := range tags {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("tag keys must not be empty")
+		}
+		if strings.ContainsAny(key, "=,") {
+			return fmt.Errorf("tag %q: keys must not contain '=' or ','", key)
+		}
+		if strings.Contains(value, ",") {
+			return fmt.Errorf("tag %s: values must not contain ','", key)
+		}
+	}
+	return nil
+}
+
+// Collect lists the distinct tags of all, sorted and written as "key=value",
+// or "key" when the value is empty.
+func Collect(all ...map[string]string) []string {
+	seen := make(map[string]bool)
+	for _, tags := range all {
+		for key, value := range tags {
+			term := strings.ToLower(key)
+			if value != "" {
+				term += "=" + value
+			}
+			seen[term] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(seen))
+}
+
+func lookup(tags map[string]string, key string) (string, bool) {
+	if value, ok := tags[key]; ok {
+		return value, true
+	}
+	for k, value := range tags {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return "", false
+}
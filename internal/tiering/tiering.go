@@ -0,0 +1,263 @@
+// Package tiering moves old recordings to the cold tier by re-encoding them
+// at a lower resolution and quality in place, and archives the recordings of
+// cameras keeping keyframes by re-encoding them to their keyframes only.
+package tiering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	checkInterval = time.Hour
+	batchSize     = 50
+)
+
+// errMissing is returned for indexed segments whose file is gone.
+var errMissing = errors.New("segment file is missing")
+
+type Manager struct {
+	config    config.ColdTierConfig
+	outputDir string
+	index     *index.Index
+	limiter   *recorder.Limiter
+	hook      func(index.Segment)
+	keyframes atomic.Pointer[map[string]config.KeyframesConfig]
+	wake      chan struct{}
+	// failed keeps segments that could not be re-encoded from being retried
+	// every round until the next restart.
+	failed map[string]bool
+}
+
+func NewManager(cfg config.ColdTierConfig, outputDir string, idx *index.Index, limiter *recorder.Limiter) *Manager {
+	return &Manager{
+		config:    cfg,
+		outputDir: outputDir,
+		index:     idx,
+		limiter:   limiter,
+		wake:      make(chan struct{}, 1),
+		failed:    make(map[string]bool),
+	}
+}
+
+// SetKeyframes sets the cameras, by name, whose segments are archived as
+// their keyframes only.
+func (m *Manager) SetKeyframes(keyframes map[string]config.KeyframesConfig) {
+	m.keyframes.Store(&keyframes)
+}
+
+// Wake has the manager look for segments to move without waiting for the
+// next check if camera keeps only keyframes from the start, for when it
+// finished a segment.
+func (m *Manager) Wake(camera string) {
+	keyframes := m.keyframes.Load()
+	if keyframes == nil {
+		return
+	}
+	if cfg, ok := (*keyframes)[camera]; !ok || cfg.AfterDays > 0 {
+		return
+	}
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SetHook has the manager call hook with every segment it re-encoded, such
+// as to update its checksum.
+func (m *Manager) SetHook(hook func(index.Segment)) {
+	m.hook = hook
+}
+
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			m.run(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-m.wake:
+			}
+		}
+	}()
+}
+
+// run archives the segments of cameras keeping keyframes, then moves every
+// segment older than the cold tier cutoff, one at a time so recording keeps
+// priority for the transcode slots.
+func (m *Manager) run(ctx context.Context) {
+	if keyframes := m.keyframes.Load(); keyframes != nil {
+		for camera, cfg := range *keyframes {
+			m.archive(ctx, camera, cfg)
+		}
+	}
+	if m.config.AfterDays == 0 {
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -m.config.AfterDays)
+	var moved int
+	var saved int64
+
+	for ctx.Err() == nil {
+		segments, err := m.index.HotSegmentsBefore(cutoff, batchSize+len(m.failed))
+		if err != nil {
+			log.Printf("Warning: Failed to find segments for the cold tier: %v", err)
+			return
+		}
+
+		var pending []index.Segment
+		for _, seg := range segments {
+			if !m.failed[seg.Path] {
+				pending = append(pending, seg)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		for _, seg := range pending {
+			if ctx.Err() != nil {
+				break
+			}
+			size, err := m.reencode(ctx, seg, index.TierCold)
+			if errors.Is(err, errMissing) {
+				continue
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Warning: [%s] Failed to move %s to the cold tier: %v", seg.Camera, seg.Filename, err)
+					m.failed[seg.Path] = true
+				}
+				continue
+			}
+			moved++
+			saved += seg.Size - size
+		}
+	}
+
+	if moved > 0 {
+		log.Printf("Cold tier: re-encoded %d segments, saving %.1f MB", moved, float64(saved)/(1<<20))
+	}
+}
+
+// archive re-encodes the segments of camera older than its keyframes cutoff
+// to their keyframes only.
+func (m *Manager) archive(ctx context.Context, camera string, cfg config.KeyframesConfig) {
+	cutoff := time.Now().AddDate(0, 0, -cfg.AfterDays)
+	var archived int
+	var saved int64
+
+	for ctx.Err() == nil {
+		segments, err := m.index.ArchivableSegmentsBefore(camera, cutoff, batchSize+len(m.failed))
+		if err != nil {
+			log.Printf("Warning: [%s] Failed to find segments to keep the keyframes of: %v", camera, err)
+			return
+		}
+
+		var pending []index.Segment
+		for _, seg := range segments {
+			if !m.failed[seg.Path] {
+				pending = append(pending, seg)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		for _, seg := range pending {
+			if ctx.Err() != nil {
+				break
+			}
+			size, err := m.reencode(ctx, seg, index.TierKeyframes)
+			if errors.Is(err, errMissing) {
+				continue
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Warning: [%s] Failed to keep the keyframes of %s: %v", seg.Camera, seg.Filename, err)
+					m.failed[seg.Path] = true
+				}
+				continue
+			}
+			archived++
+			saved += seg.Size - size
+		}
+	}
+
+	if archived > 0 {
+		log.Printf("[%s] Keyframes: re-encoded %d segments, saving %.1f MB", camera, archived, float64(saved)/(1<<20))
+	}
+}
+
+// reencode re-encodes the segment for tier and swaps it in, keeping the
+// original if the copy is not smaller. The file's modification time is kept,
+// so retention still counts from when it was recorded.
+func (m *Manager) reencode(ctx context.Context, seg index.Segment, tier string) (int64, error) {
+	info, err := os.Stat(seg.Path)
+	if os.IsNotExist(err) {
+		// Deleted outside the recorder.
+		if err := m.index.DeleteSegment(seg.Path); err != nil {
+			return 0, err
+		}
+		return 0, errMissing
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if !m.limiter.Acquire(ctx, nil) {
+		return 0, ctx.Err()
+	}
+	defer m.limiter.Release()
+
+	tmp := filepath.Join(m.outputDir, storage.TierDir, fmt.Sprintf("%s_%s_%s", tier, storage.CameraDirName(seg.Camera), seg.Filename))
+	if tier == index.TierKeyframes {
+		err = recorder.Keyframes(ctx, seg.Path, tmp)
+	} else {
+		err = recorder.Downscale(ctx, seg.Path, tmp, m.config.Height, m.config.CRF)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+
+	tmpInfo, err := os.Stat(tmp)
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if tmpInfo.Size() < size {
+		if err := os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+			return 0, fmt.Errorf("failed to keep modification time: %w", err)
+		}
+		if err := os.Rename(tmp, seg.Path); err != nil {
+			return 0, fmt.Errorf("failed to replace segment: %w", err)
+		}
+		size = tmpInfo.Size()
+	}
+
+	if err := m.index.SetSegmentTier(seg.Path, tier, size); err != nil {
+		return 0, err
+	}
+	if m.hook != nil {
+		seg.Tier, seg.Size = tier, size
+		m.hook(seg)
+	}
+	return size, nil
+}
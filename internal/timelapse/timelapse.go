@@ -0,0 +1,427 @@
+package timelapse
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/pkg/command"
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	PeriodDaily  = "daily"
+	PeriodWeekly = "weekly"
+
+	framesDir      = "frames"
+	dayLayout      = "2006-01-02"
+	frameLayout    = "150405"
+	captureTimeout = 30 * time.Second
+	buildInterval  = 10 * time.Minute
+)
+
+type Target struct {
+	Name     string
+	RTSPURL  string
+	Interval time.Duration
+}
+
+type Video struct {
+	Camera    string    `json:"camera"`
+	Filename  string    `json:"filename"`
+	Period    string    `json:"period"`
+	Start     time.Time `json:"start"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Manager struct {
+	config   *config.TimelapseConfig
+	targets  func() []Target
+	mu       sync.Mutex
+	captured map[string]time.Time
+	busy     map[string]bool
+}
+
+func NewManager(cfg *config.TimelapseConfig, targets func() []Target) *Manager {
+	return &Manager{
+		config:   cfg,
+		targets:  targets,
+		captured: make(map[string]time.Time),
+		busy:     make(map[string]bool),
+	}
+}
+
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			m.captureDue(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(buildInterval)
+		defer ticker.Stop()
+
+		for {
+			m.buildPending(ctx, time.Now())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (m *Manager) captureDue(ctx context.Context) {
+	now := time.Now()
+	for _, target := range m.targets() {
+		if target.Interval <= 0 {
+			continue
+		}
+
+		m.mu.Lock()
+		due := !m.busy[target.Name] && now.Sub(m.captured[target.Name]) >= target.Interval
+		if due {
+			m.busy[target.Name] = true
+			m.captured[target.Name] = now
+		}
+		m.mu.Unlock()
+		if !due {
+			continue
+		}
+
+		go func(target Target) {
+			defer func() {
+				m.mu.Lock()
+				delete(m.busy, target.Name)
+				m.mu.Unlock()
+			}()
+			if err := m.Capture(ctx, target, now); err != nil {
+				log.Printf("[%s] Time-lapse capture failed: %v", target.Name, err)
+			}
+		}(target)
+	}
+}
+
+// Capture grabs a single full-resolution frame into the camera's frames
+// directory for the day.
+func (m *Manager) Capture(ctx context.Context, target Target, at time.Time) error {
+	dir := filepath.Join(m.cameraDir(target.Name), framesDir, at.Format(dayLayout))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create frames directory: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, captureTimeout)
+	defer cancel()
+
+	out := filepath.Join(dir, at.Format(frameLayout)+".jpg")
+	args := source.InputArgs(target.RTSPURL)
+	args = append(args, "-frames:v", "1", "-q:v", "2", "-y", out)
+	output, err := command.Context(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		os.Remove(out)
+		return fmt.Errorf("ffmpeg: %w: %s", err, lastLine(output))
+	}
+	return nil
+}
+
+func (m *Manager) buildPending(ctx context.Context, now time.Time) {
+	for _, cam := range m.cameraDirs() {
+		if err := m.buildCamera(ctx, cam, now); err != nil {
+			log.Printf("[%s] Time-lapse build failed: %v", cam, err)
+		}
+	}
+	m.cleanup(now)
+}
+
+func (m *Manager) buildCamera(ctx context.Context, cam string, now time.Time) error {
+	camDir := filepath.Join(m.config.OutputDir, cam)
+	days, err := m.frameDays(cam)
+	if err != nil {
+		return err
+	}
+
+	today := now.Format(dayLayout)
+	thisWeek := weekStart(now)
+	weeks := make(map[time.Time][]string)
+
+	for _, day := range days {
+		if day >= today {
+			continue
+		}
+		date, err := time.ParseInLocation(dayLayout, day, now.Location())
+		if err != nil {
+			continue
+		}
+
+		daily := filepath.Join(camDir, videoName(cam, PeriodDaily, date))
+		if !exists(daily) {
+			if err := m.render(ctx, daily, []string{day}, cam); err != nil {
+				return err
+			}
+		}
+
+		if week := weekStart(date); week.Before(thisWeek) {
+			weeks[week] = append(weeks[week], day)
+		}
+	}
+
+	if !m.config.Weekly {
+		return nil
+	}
+	for week, weekDays := range weeks {
+		weekly := filepath.Join(camDir, videoName(cam, PeriodWeekly, week))
+		if exists(weekly) {
+			continue
+		}
+		if err := m.render(ctx, weekly, weekDays, cam); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// render stitches the frames of the given days into an MP4 at the configured
+// frame rate, writing to a temporary file first so a half-built video is
+// never listed.
+func (m *Manager) render(ctx context.Context, out string, days []string, cam string) error {
+	var frames []string
+	for _, day := range days {
+		matches, _ := filepath.Glob(filepath.Join(m.config.OutputDir, cam, framesDir, day, "*.jpg"))
+		frames = append(frames, matches...)
+	}
+	if len(frames) == 0 {
+		return nil
+	}
+	sort.Strings(frames)
+
+	fps := max(m.config.FPS, 1)
+	var list strings.Builder
+	for _, frame := range frames {
+		abs, _ := filepath.Abs(frame)
+		fmt.Fprintf(&list, "file '%s'\nduration %.6f\n", strings.ReplaceAll(filepath.ToSlash(abs), "'", `'\''`), 1/float64(fps))
+	}
+	// The concat demuxer ignores the duration of the last entry unless the
+	// file is listed once more.
+	abs, _ := filepath.Abs(frames[len(frames)-1])
+	fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(filepath.ToSlash(abs), "'", `'\''`))
+
+	listPath := out + ".txt"
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write frame list: %w", err)
+	}
+	defer os.Remove(listPath)
+
+	tmp := strings.TrimSuffix(out, ".mp4") + ".part.mp4"
+	cmd := command.Context(ctx, "ffmpeg",
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listPath,
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		"-r", fmt.Sprintf("%d", fps),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "23",
+		"-pix_fmt", "yuv420p",
+		"-movflags", "+faststart",
+		"-y",
+		tmp,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("ffmpeg: %w: %s", err, lastLine(output))
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		return fmt.Errorf("failed to finalize %s: %w", filepath.Base(out), err)
+	}
+
+	log.Printf("[%s] Time-lapse %s built from %d frames", cam, filepath.Base(out), len(frames))
+	return nil
+}
+
+// cleanup drops frames once every video that needs them exists, and videos
+// older than the retention period.
+func (m *Manager) cleanup(now time.Time) {
+	thisWeek := weekStart(now)
+	for _, cam := range m.cameraDirs() {
+		days, err := m.frameDays(cam)
+		if err != nil {
+			continue
+		}
+		for _, day := range days {
+			date, err := time.ParseInLocation(dayLayout, day, now.Location())
+			if err != nil {
+				continue
+			}
+			camDir := filepath.Join(m.config.OutputDir, cam)
+			done := exists(filepath.Join(camDir, videoName(cam, PeriodDaily, date)))
+			if m.config.Weekly {
+				week := weekStart(date)
+				done = done && week.Before(thisWeek) && exists(filepath.Join(camDir, videoName(cam, PeriodWeekly, week)))
+			}
+			if done {
+				os.RemoveAll(filepath.Join(camDir, framesDir, day))
+			}
+		}
+	}
+
+	if m.config.RetentionDays <= 0 {
+		return
+	}
+	cutoff := now.AddDate(0, 0, -m.config.RetentionDays)
+	videos, err := m.List("")
+	if err != nil {
+		return
+	}
+	for _, v := range videos {
+		if v.CreatedAt.Before(cutoff) {
+			os.Remove(filepath.Join(m.config.OutputDir, storage.CameraDirName(v.Camera), v.Filename))
+		}
+	}
+}
+
+// List returns the built videos, newest first, optionally for one camera.
+func (m *Manager) List(camera string) ([]Video, error) {
+	var videos []Video
+	for _, cam := range m.cameraDirs() {
+		if camera != "" && cam != storage.CameraDirName(camera) {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(m.config.OutputDir, cam))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			period, start, ok := parseVideoName(cam, entry.Name())
+			if !ok {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			videos = append(videos, Video{
+				Camera:    strings.ReplaceAll(cam, "_", " "),
+				Filename:  entry.Name(),
+				Period:    period,
+				Start:     start,
+				Size:      info.Size(),
+				CreatedAt: info.ModTime(),
+			})
+		}
+	}
+
+	sort.Slice(videos, func(i, j int) bool {
+		if !videos[i].Start.Equal(videos[j].Start) {
+			return videos[i].Start.After(videos[j].Start)
+		}
+		return videos[i].Period < videos[j].Period
+	})
+	return videos, nil
+}
+
+func (m *Manager) FilePath(camera, filename string) (string, error) {
+	cam := storage.CameraDirName(camera)
+	if _, _, ok := parseVideoName(cam, filename); !ok {
+		return "", fmt.Errorf("invalid time-lapse file")
+	}
+	path := filepath.Join(m.config.OutputDir, cam, filename)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (m *Manager) cameraDir(name string) string {
+	return filepath.Join(m.config.OutputDir, storage.CameraDirName(name))
+}
+
+func (m *Manager) cameraDirs() []string {
+	entries, err := os.ReadDir(m.config.OutputDir)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	return dirs
+}
+
+func (m *Manager) frameDays(cam string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(m.config.OutputDir, cam, framesDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var days []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			days = append(days, entry.Name())
+		}
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+func videoName(cam, period string, start time.Time) string {
+	return fmt.Sprintf("%s_%s_%s.mp4", cam, period, start.Format(dayLayout))
+}
+
+func parseVideoName(cam, name string) (string, time.Time, bool) {
+	rest, ok := strings.CutPrefix(name, cam+"_")
+	if !ok {
+		return "", time.Time{}, false
+	}
+	rest, ok = strings.CutSuffix(rest, ".mp4")
+	if !ok {
+		return "", time.Time{}, false
+	}
+	period, day, ok := strings.Cut(rest, "_")
+	if !ok || (period != PeriodDaily && period != PeriodWeekly) {
+		return "", time.Time{}, false
+	}
+	start, err := time.ParseInLocation(dayLayout, day, time.Local)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return period, start, true
+}
+
+func weekStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return lines[len(lines)-1]
+}
@@ -0,0 +1,92 @@
+package web
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+)
+
+type accessArea int
+
+const (
+	areaDashboard accessArea = iota
+	areaAPI
+	areaLive
+)
+
+type networkList struct {
+	allowed []netip.Prefix
+	denied  []netip.Prefix
+}
+
+// permits reports whether addr may reach the area: a denied network always
+// wins, and a non-empty allowlist admits only its own networks.
+func (l networkList) permits(addr netip.Addr) bool {
+	for _, prefix := range l.denied {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(l.allowed) == 0 {
+		return true
+	}
+	for _, prefix := range l.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type accessRules map[accessArea]networkList
+
+// newAccessRules builds the per-area network lists. The config has already
+// been validated on load, so parse errors cannot occur here.
+func newAccessRules(cfg config.ServerConfig) accessRules {
+	parse := func(list []string) []netip.Prefix {
+		prefixes, _ := config.ParseCIDRs(list)
+		return prefixes
+	}
+
+	return accessRules{
+		areaDashboard: {allowed: parse(cfg.AllowedCIDRs.Dashboard), denied: parse(cfg.DeniedCIDRs.Dashboard)},
+		areaAPI:       {allowed: parse(cfg.AllowedCIDRs.API), denied: parse(cfg.DeniedCIDRs.API)},
+		areaLive:      {allowed: parse(cfg.AllowedCIDRs.Live), denied: parse(cfg.DeniedCIDRs.Live)},
+	}
+}
+
+// pathArea classifies a request. Live covers the streams and share links that
+// are commonly exposed to the internet; the JSON API, metrics and profiler
+// form the API area, and everything else (pages, playback, downloads) is the dashboard.
+func pathArea(path string) accessArea {
+	switch {
+	case strings.HasPrefix(path, "/live/"), strings.HasPrefix(path, "/snapshot/"), strings.HasPrefix(path, "/s/"), path == "/kiosk", strings.HasPrefix(path, "/kiosk/"):
+		return areaLive
+	case strings.HasPrefix(path, "/api/"), path == "/metrics", strings.HasPrefix(path, "/debug/"):
+		return areaAPI
+	default:
+		return areaDashboard
+	}
+}
+
+func (s *Server) accessMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules := s.access[pathArea(c.Request.URL.Path)]
+		if len(rules.allowed) == 0 && len(rules.denied) == 0 {
+			c.Next()
+			return
+		}
+
+		addr, err := netip.ParseAddr(c.ClientIP())
+		if err != nil || !rules.permits(addr.Unmap()) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Next()
+	}
+}
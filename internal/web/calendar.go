@@ -0,0 +1,176 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/ical"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/schedule"
+)
+
+var icalDays = map[time.Weekday]string{
+	time.Sunday:    "SU",
+	time.Monday:    "MO",
+	time.Tuesday:   "TU",
+	time.Wednesday: "WE",
+	time.Thursday:  "TH",
+	time.Friday:    "FR",
+	time.Saturday:  "SA",
+}
+
+func (s *Server) queryEvents(c *gin.Context, defaultWindow time.Duration) ([]index.Event, error) {
+	now := time.Now()
+
+	from, err := parseTimeParam(c, "from", now.Add(-defaultWindow))
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseTimeParam(c, "to", now)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil {
+		limit = 1000
+	}
+
+	return s.index.FindEvents(index.EventQuery{
+		Camera: c.Query("camera"),
+		Kind:   c.Query("kind"),
+		From:   from,
+		To:     to,
+		Limit:  limit,
+	})
+}
+
+func (s *Server) handleEvents(c *gin.Context) {
+	events, err := s.queryEvents(c, 24*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"count":  len(events),
+	})
+}
+
+func (s *Server) handleEventsICS(c *gin.Context) {
+	events, err := s.queryEvents(c, 30*24*time.Hour)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	base := baseURL(c) + s.basePath
+	cal := ical.Calendar{Name: "Camera Events"}
+	for _, ev := range events {
+		summary := ev.Camera + ": " + ev.Kind
+		if ev.Label != "" {
+			summary = fmt.Sprintf("%s: %s (%s)", ev.Camera, ev.Label, ev.Kind)
+		}
+
+		var description string
+		if ev.Source != "" {
+			description = "Source: " + ev.Source
+		}
+
+		end := ev.EndedAt
+		if !end.After(ev.StartedAt) {
+			end = ev.StartedAt.Add(time.Minute)
+		}
+
+		cal.Events = append(cal.Events, ical.Event{
+			UID:         fmt.Sprintf("event-%d@%s", ev.ID, c.Request.Host),
+			Summary:     summary,
+			Description: description,
+			URL:         base + "/camera/" + url.PathEscape(ev.Camera),
+			Start:       ev.StartedAt,
+			End:         end,
+		})
+	}
+
+	writeCalendar(c, "events.ics", &cal)
+}
+
+func (s *Server) handleScheduleICS(c *gin.Context) {
+	cameraFilter := c.Query("camera")
+	base := baseURL(c) + s.basePath
+	today := time.Now()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+
+	cal := ical.Calendar{Name: "Recording Schedule"}
+	for _, cam := range s.cameras() {
+		if !cam.Enabled || (cameraFilter != "" && cam.Name != cameraFilter) {
+			continue
+		}
+
+		sched, err := schedule.Parse(cam.Schedule)
+		if err != nil || sched == nil {
+			continue
+		}
+
+		for i, w := range sched.Windows {
+			var days []string
+			var first time.Time
+			for offset := 6; offset >= 0; offset-- {
+				day := today.AddDate(0, 0, -offset)
+				if containsWeekday(w.Days, day.Weekday()) && first.IsZero() {
+					first = day
+				}
+			}
+			for _, d := range w.Days {
+				days = append(days, icalDays[d])
+			}
+
+			start, end := w.Occurrence(first)
+			cal.Events = append(cal.Events, ical.Event{
+				UID:      fmt.Sprintf("schedule-%s-%d@%s", strings.ReplaceAll(cam.Name, " ", "_"), i+1, c.Request.Host),
+				Summary:  "Recording: " + cam.Name,
+				URL:      base + "/camera/" + url.PathEscape(cam.Name),
+				Start:    start,
+				End:      end,
+				Floating: true,
+				RRule:    "FREQ=WEEKLY;BYDAY=" + strings.Join(days, ","),
+			})
+		}
+	}
+
+	writeCalendar(c, "schedule.ics", &cal)
+}
+
+func containsWeekday(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func writeCalendar(c *gin.Context, filename string, cal *ical.Calendar) {
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	c.Header("Content-Disposition", "inline; filename="+filename)
+	c.Status(http.StatusOK)
+	cal.WriteTo(c.Writer)
+}
+
+func baseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
@@ -0,0 +1,113 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/capture"
+)
+
+// SetCapture gives the server the capture manager, to record bursts on
+// demand.
+func (s *Server) SetCapture(m *capture.Manager) {
+	s.capture = m
+}
+
+type captureRequest struct {
+	Duration  string `json:"duration"`
+	Snapshots *int   `json:"snapshots"`
+}
+
+// handleCameraCapture records a burst of the camera's stream at full quality
+// now, whatever its recording mode, and answers with the URLs of the clip
+// and its stills once it is done. The body is optional.
+func (s *Server) handleCameraCapture(c *gin.Context) {
+	cameraName := c.Param("name")
+	if s.capture == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Capture is not available")})
+		return
+	}
+	cam, ok := s.findCamera(cameraName)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
+		return
+	}
+
+	var req captureRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cfg := s.capture.Config()
+	duration := cfg.Duration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d < time.Second || d > capture.MaxDuration {
+			c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "duration must be between 1s and %s", capture.MaxDuration)})
+			return
+		}
+		duration = d
+	}
+	snapshots := cfg.Snapshots
+	if req.Snapshots != nil {
+		if *req.Snapshots < 0 || *req.Snapshots > capture.MaxSnapshots {
+			c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "snapshots must be between 0 and %d", capture.MaxSnapshots)})
+			return
+		}
+		snapshots = *req.Snapshots
+	}
+
+	burst, err := s.capture.Capture(c.Request.Context(), cameraName, s.streamURL(cam), duration, snapshots)
+	if errors.Is(err, capture.ErrBusy) {
+		c.JSON(http.StatusConflict, gin.H{"error": s.tr(c, "A burst of the camera is already being captured")})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": s.tr(c, "Failed to capture a burst: %s", err.Error())})
+		return
+	}
+
+	snapshotURLs := []string{}
+	for _, filename := range burst.Snapshots {
+		snapshotURLs = append(snapshotURLs, s.captureURL(cameraName, filename))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":          s.tr(c, "Burst captured"),
+		"camera":           cameraName,
+		"started_at":       burst.StartedAt,
+		"duration_seconds": duration.Seconds(),
+		"clip":             burst.Clip,
+		"clip_url":         s.captureURL(cameraName, burst.Clip),
+		"snapshots":        burst.Snapshots,
+		"snapshot_urls":    snapshotURLs,
+	})
+}
+
+func (s *Server) captureURL(camera, filename string) string {
+	return s.url(fmt.Sprintf("/captures/%s/%s", url.PathEscape(camera), url.PathEscape(filename)))
+}
+
+// handleCaptureFile serves a clip or still of a burst.
+func (s *Server) handleCaptureFile(c *gin.Context) {
+	if s.capture == nil {
+		c.String(http.StatusNotFound, s.tr(c, "File not found"))
+		return
+	}
+	filename := c.Param("filename")
+	path, err := s.capture.FilePath(c.Param("camera"), filename)
+	if err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "File not found"))
+		return
+	}
+
+	if c.Query("download") != "" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	}
+	c.File(path)
+}
@@ -0,0 +1,445 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/internal/tags"
+)
+
+const maxImportSize = 1 << 20
+
+func (s *Server) handleConfigExport(c *gin.Context) {
+	includeSecrets, _ := strconv.ParseBool(c.DefaultQuery("secrets", "false"))
+
+	s.cfgMu.RLock()
+	exported := s.config.Sanitized(includeSecrets)
+	s.cfgMu.RUnlock()
+
+	var buf bytes.Buffer
+	if err := config.Encode(&buf, &exported); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=config.yaml")
+	c.Data(http.StatusOK, "application/yaml", buf.Bytes())
+}
+
+func (s *Server) handleConfigImport(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "failed to read request body")})
+		return
+	}
+
+	imported, err := config.Parse(bytes.NewReader(body), "yaml")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := config.ValidateCameras(imported.Cameras); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.cfgMu.Lock()
+	previous := s.config.Cameras
+	cameras := preserveCredentials(imported.Cameras, previous)
+
+	var ignored []string
+	if imported.Recording.OutputDir != s.config.Recording.OutputDir {
+		ignored = append(ignored, "recording.output_dir")
+	}
+	// Recorders and storage keep the recording options they started with;
+	// these are saved for the next start.
+	if imported.Recording.SegmentDuration != s.config.Recording.SegmentDuration {
+		ignored = append(ignored, "recording.segment_duration")
+	}
+	if imported.Recording.RetentionDays != s.config.Recording.RetentionDays {
+		ignored = append(ignored, "recording.retention_days")
+	}
+	if imported.Recording.Format != s.config.Recording.Format {
+		ignored = append(ignored, "recording.format")
+	}
+	if imported.Recording.AlignToClock != s.config.Recording.AlignToClock {
+		ignored = append(ignored, "recording.align_to_clock")
+	}
+	if imported.Recording.DuplicateURLs != s.config.Recording.DuplicateURLs {
+		ignored = append(ignored, "recording.duplicate_urls")
+	}
+	if imported.Recording.ColdTier != s.config.Recording.ColdTier {
+		ignored = append(ignored, "recording.cold_tier")
+	}
+	if imported.Recording.StaticScenes != s.config.Recording.StaticScenes {
+		ignored = append(ignored, "recording.static_scenes")
+	}
+	if imported.Notifications.Push != s.config.Notifications.Push {
+		ignored = append(ignored, "notifications.push")
+	}
+	if !reflect.DeepEqual(imported.Notifications.Reports, s.config.Notifications.Reports) {
+		ignored = append(ignored, "notifications.reports")
+	}
+	if !reflect.DeepEqual(imported.Server, s.config.Server) {
+		ignored = append(ignored, "server")
+	}
+	if !reflect.DeepEqual(imported.Kiosk, s.config.Kiosk) {
+		ignored = append(ignored, "kiosk")
+	}
+	if imported.Ingest != s.config.Ingest {
+		ignored = append(ignored, "ingest")
+	}
+	if !reflect.DeepEqual(imported.Plugins, s.config.Plugins) {
+		ignored = append(ignored, "plugins")
+	}
+	if imported.Replay != s.config.Replay {
+		ignored = append(ignored, "replay")
+	}
+	if imported.Decode != s.config.Decode {
+		ignored = append(ignored, "decode")
+	}
+
+	s.config.Cameras = cameras
+	s.config.Recording.SegmentDuration = imported.Recording.SegmentDuration
+	s.config.Recording.RetentionDays = imported.Recording.RetentionDays
+	s.config.Recording.Format = imported.Recording.Format
+	s.config.Recording.AlignToClock = imported.Recording.AlignToClock
+	s.config.Recording.Retry = imported.Recording.Retry
+	s.config.Recording.Adaptive = imported.Recording.Adaptive
+	s.config.Recording.DualMode = imported.Recording.DualMode
+	s.config.Notifications.Throttle = imported.Notifications.Throttle
+	s.config.Notifications.Routes = imported.Notifications.Routes
+	s.config.Logging = imported.Logging
+	s.config.Watermark = imported.Watermark
+	s.config.Instance = imported.Instance
+	saveErr := s.config.Save()
+	s.cfgMu.Unlock()
+
+	s.recorder.SetRetryPolicy(imported.Recording.Retry)
+	s.recorder.SetAdaptiveSegments(imported.Recording.Adaptive)
+	s.recorder.SetDualMode(imported.Recording.DualMode)
+	s.recorder.SetOrigin(imported.Instance.Origin())
+	if err := s.notifier.SetThrottle(imported.Notifications.Throttle); err != nil {
+		log.Printf("Warning: Failed to apply imported notification throttle: %v", err)
+	}
+	s.notifier.SetRoutes(imported.Notifications.Routes)
+	s.reconcileCameras(previous, cameras)
+
+	if saveErr != nil {
+		log.Printf("Warning: Failed to persist imported config: %v", saveErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s.tr(c, "config applied but not saved: %v", saveErr)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": s.tr(c, "Config imported"),
+		"cameras": len(cameras),
+		"ignored": ignored,
+	})
+}
+
+func (s *Server) handleCamerasImport(c *gin.Context) {
+	imported, err := config.ParseCamerasCSV(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	replace, _ := strconv.ParseBool(c.DefaultQuery("replace", "false"))
+
+	s.cfgMu.Lock()
+	previous := s.config.Cameras
+
+	var cameras []config.CameraConfig
+	if replace {
+		cameras = imported
+	} else {
+		cameras = mergeCameras(previous, imported)
+	}
+	cameras = preserveCredentials(cameras, previous)
+
+	if err := config.ValidateCameras(cameras); err != nil {
+		s.cfgMu.Unlock()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.config.Cameras = cameras
+	saveErr := s.config.Save()
+	s.cfgMu.Unlock()
+
+	s.reconcileCameras(previous, cameras)
+
+	if saveErr != nil {
+		log.Printf("Warning: Failed to persist imported cameras: %v", saveErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s.tr(c, "cameras applied but not saved: %v", saveErr)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  s.tr(c, "Cameras imported"),
+		"imported": len(imported),
+		"cameras":  len(cameras),
+	})
+}
+
+type cameraUpdateRequest struct {
+	Enabled          *bool `json:"enabled"`
+	DisableLiveAudio *bool `json:"disable_live_audio"`
+	// Tags, when present, replace the camera's tags; {} removes them all.
+	Tags *map[string]string `json:"tags"`
+	// Position, when present, replaces the camera's position on the map; {}
+	// removes it.
+	Position *config.Position `json:"position"`
+	// MotionEvents, when present, replaces the camera's motion detection
+	// settings and zones.
+	MotionEvents *config.MotionEvents `json:"motion_events"`
+}
+
+func (s *Server) handleCameraUpdate(c *gin.Context) {
+	cameraName := c.Param("name")
+
+	var req cameraUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Enabled == nil && req.DisableLiveAudio == nil && req.Tags == nil && req.Position == nil && req.MotionEvents == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "no changes requested")})
+		return
+	}
+	var newTags map[string]string
+	if req.Tags != nil {
+		if err := tags.Validate(*req.Tags); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for key, value := range *req.Tags {
+			if newTags == nil {
+				newTags = make(map[string]string)
+			}
+			newTags[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+
+	var newPosition *config.Position
+	if req.Position != nil {
+		if err := req.Position.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if *req.Position != (config.Position{}) {
+			newPosition = req.Position
+		}
+	}
+	if req.MotionEvents != nil {
+		if err := req.MotionEvents.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	s.cfgMu.Lock()
+	idx := -1
+	for i := range s.config.Cameras {
+		if s.config.Cameras[i].Name == cameraName {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		s.cfgMu.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
+		return
+	}
+
+	previous := s.config.Cameras
+	cameras := make([]config.CameraConfig, len(previous))
+	copy(cameras, previous)
+	if req.Enabled != nil {
+		cameras[idx].Enabled = *req.Enabled
+	}
+	if req.DisableLiveAudio != nil {
+		cameras[idx].DisableLiveAudio = *req.DisableLiveAudio
+	}
+	if req.Tags != nil {
+		cameras[idx].Tags = newTags
+	}
+	if req.Position != nil {
+		cameras[idx].Position = newPosition
+	}
+	if req.MotionEvents != nil {
+		cameras[idx].MotionEvents = *req.MotionEvents
+	}
+
+	s.config.Cameras = cameras
+	saveErr := s.config.Save()
+	s.cfgMu.Unlock()
+
+	s.reconcileCameras(previous, cameras)
+	if req.MotionEvents != nil {
+		s.motion.Refresh()
+	}
+
+	if saveErr != nil {
+		log.Printf("Warning: Failed to persist camera %s: %v", cameraName, saveErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s.tr(c, "camera updated but not saved: %v", saveErr)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            s.tr(c, "Camera updated"),
+		"camera":             cameraName,
+		"enabled":            cameras[idx].Enabled,
+		"disable_live_audio": cameras[idx].DisableLiveAudio,
+		"tags":               cameras[idx].Tags,
+		"position":           cameras[idx].Position,
+		"motion_events":      cameras[idx].MotionEvents,
+	})
+}
+
+func (s *Server) reconcileCameras(previous, current []config.CameraConfig) {
+	ctx := s.appContext()
+	s.cfgMu.RLock()
+	shareIngest := s.config.Recording.DuplicateURLs == config.DuplicateURLsShare
+	s.cfgMu.RUnlock()
+	ingestOwners := config.IngestOwners(current)
+	s.notifier.SetCameraTags(config.CameraTags(current))
+	s.storage.SetQuotas(config.CameraQuotas(current))
+	s.storage.SetRetention(config.CameraRetention(current))
+	if s.tiers != nil {
+		s.tiers.SetKeyframes(config.CameraKeyframes(current))
+	}
+
+	prevByName := make(map[string]config.CameraConfig, len(previous))
+	for _, cam := range previous {
+		prevByName[cam.Name] = cam
+	}
+	currByName := make(map[string]config.CameraConfig, len(current))
+	for _, cam := range current {
+		currByName[cam.Name] = cam
+	}
+
+	for _, cam := range previous {
+		if next, ok := currByName[cam.Name]; !ok || next.RTSPURL != cam.RTSPURL || next.FailoverURL != cam.FailoverURL {
+			s.mjpeg.Stop(cam.Name)
+			s.hls.Stop(cam.Name)
+			s.recorder.RemoveCamera(cam.Name)
+			s.ingest.Remove(cam.Name)
+		}
+	}
+
+	for _, cam := range current {
+		prev, existed := prevByName[cam.Name]
+		if existed && prev.RTSPURL == cam.RTSPURL && prev.FailoverURL == cam.FailoverURL {
+			if err := s.recorder.ConfigureCamera(cam.Recorder()); err != nil {
+				log.Printf("Warning: Failed to configure camera %s: %v", cam.Name, err)
+			}
+			if prev.Enabled == cam.Enabled {
+				continue
+			}
+			if cam.Enabled {
+				if err := s.recorder.StartCamera(ctx, cam.Name); err != nil {
+					log.Printf("Warning: Failed to start camera %s: %v", cam.Name, err)
+				}
+				s.mjpeg.Start(ctx, cam.Name, s.streamURL(cam))
+				s.rememberRunState(cam.Name, index.RunRunning)
+			} else {
+				s.recorder.StopCamera(cam.Name)
+				s.mjpeg.Stop(cam.Name)
+				s.hls.Stop(cam.Name)
+				s.rememberRunState(cam.Name, index.RunStopped)
+			}
+			continue
+		}
+
+		opts := cam.Recorder()
+		opts.URL = s.streamURL(cam)
+		if owner, ok := ingestOwners[cam.Name]; ok {
+			if shareIngest {
+				opts.ShareWith = owner
+			} else {
+				log.Printf("Warning: Cameras %s and %s use the same stream", owner, cam.Name)
+			}
+		}
+		if err := s.recorder.AddCamera(ctx, opts); err != nil {
+			log.Printf("Warning: Failed to add camera %s: %v", cam.Name, err)
+			continue
+		}
+		if cam.Enabled {
+			s.mjpeg.Start(ctx, cam.Name, s.streamURL(cam))
+		}
+	}
+}
+
+func mergeCameras(existing, imported []config.CameraConfig) []config.CameraConfig {
+	merged := make([]config.CameraConfig, len(existing))
+	copy(merged, existing)
+
+	index := make(map[string]int, len(merged))
+	for i, cam := range merged {
+		index[cam.Name] = i
+	}
+
+	for _, cam := range imported {
+		if i, ok := index[cam.Name]; ok {
+			merged[i] = cam
+			continue
+		}
+		index[cam.Name] = len(merged)
+		merged = append(merged, cam)
+	}
+
+	return merged
+}
+
+func preserveCredentials(cameras, existing []config.CameraConfig) []config.CameraConfig {
+	byName := make(map[string]config.CameraConfig, len(existing))
+	for _, cam := range existing {
+		byName[cam.Name] = cam
+	}
+
+	result := make([]config.CameraConfig, len(cameras))
+	for i, cam := range cameras {
+		if prev, ok := byName[cam.Name]; ok &&
+			cam.RTSPURL != prev.RTSPURL &&
+			cam.RTSPURL == config.StripCredentials(prev.RTSPURL) {
+			cam.RTSPURL = prev.RTSPURL
+		}
+		if prev, ok := byName[cam.Name]; ok &&
+			cam.FailoverURL != prev.FailoverURL &&
+			cam.FailoverURL == config.StripCredentials(prev.FailoverURL) {
+			cam.FailoverURL = prev.FailoverURL
+		}
+		if prev, ok := byName[cam.Name]; ok && len(cam.Forward) == len(prev.Forward) {
+			cam.Forward = slices.Clone(cam.Forward)
+			for j, u := range cam.Forward {
+				if u != prev.Forward[j] && u == config.StripForwardSecrets(prev.Forward[j]) {
+					cam.Forward[j] = prev.Forward[j]
+				}
+			}
+		}
+		// Exports leave out the power control's secrets.
+		if prev, ok := byName[cam.Name]; ok && cam.Power.Type == prev.Power.Type {
+			if cam.Power.Community == "" {
+				cam.Power.Community = prev.Power.Community
+			}
+			if cam.Power.OffURL == "" && cam.Power.OnURL == "" {
+				cam.Power.OffURL, cam.Power.OnURL = prev.Power.OffURL, prev.Power.OnURL
+			}
+		}
+		result[i] = cam
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/leakcheck"
+)
+
+// Goroutine groups listed by /api/debug/runtime besides suspected ones.
+const debugTopGroups = 20
+
+// setupDebugRoutes serves Go's profiler under /debug/pprof/ to API key
+// holders.
+func (s *Server) setupDebugRoutes() {
+	debug := s.Router.Group("/debug/pprof", s.requireAPIKey())
+	debug.GET("/*profile", func(c *gin.Context) {
+		switch c.Param("profile") {
+		case "/cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "/profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "/symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "/trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			// Index serves the named profiles, like /heap and /goroutine.
+			pprof.Index(c.Writer, c.Request)
+		}
+	})
+	debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+}
+
+// handleDebugRuntime reports the recorder's own memory and goroutines, with
+// the goroutine groups the leak check found.
+func (s *Server) handleDebugRuntime(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	resp := gin.H{
+		"goroutines":     runtime.NumGoroutine(),
+		"heap_alloc":     mem.HeapAlloc,
+		"heap_inuse":     mem.HeapInuse,
+		"heap_objects":   mem.HeapObjects,
+		"sys":            mem.Sys,
+		"gc_cycles":      mem.NumGC,
+		"gc_pause_total": time.Duration(mem.PauseTotalNs).String(),
+	}
+	if mem.LastGC > 0 {
+		resp["last_gc"] = time.Unix(0, int64(mem.LastGC))
+	}
+
+	if s.leaks != nil {
+		groups, checkedAt := s.leaks.Groups()
+		listed := []leakcheck.Group{}
+		for i, g := range groups {
+			if i < debugTopGroups || g.Suspected {
+				listed = append(listed, g)
+			}
+		}
+		resp["leak_check"] = gin.H{
+			"checked_at": checkedAt,
+			"suspected":  s.leaks.Suspected(),
+			"groups":     listed,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/camera"
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+)
+
+// newDeviceMonitor returns a device monitor seeded with the devices saved in
+// the index, saving every camera it identifies there.
+func (s *Server) newDeviceMonitor() *camera.DeviceMonitor {
+	monitor := camera.NewDeviceMonitor(s.clockTargets)
+
+	saved, err := s.index.Devices()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	devices := make([]camera.DeviceInfo, 0, len(saved))
+	for _, d := range saved {
+		devices = append(devices, camera.DeviceInfo{
+			Camera:       d.Camera,
+			Source:       d.Source,
+			Manufacturer: d.Manufacturer,
+			Model:        d.Model,
+			Firmware:     d.Firmware,
+			Serial:       d.Serial,
+			HardwareID:   d.HardwareID,
+			HTTPServer:   d.HTTPServer,
+			CheckedAt:    d.CheckedAt,
+		})
+	}
+	monitor.Load(devices)
+
+	monitor.SetHook(func(info camera.DeviceInfo) {
+		err := s.index.SetDevice(index.Device{
+			Camera:       info.Camera,
+			Source:       info.Source,
+			Manufacturer: info.Manufacturer,
+			Model:        info.Model,
+			Firmware:     info.Firmware,
+			Serial:       info.Serial,
+			HardwareID:   info.HardwareID,
+			HTTPServer:   info.HTTPServer,
+			CheckedAt:    info.CheckedAt,
+		})
+		if err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	})
+	return monitor
+}
+
+// handleDevices lists the vendor, model, firmware and serial of every camera,
+// for auditing which of them need a firmware update. Cameras not identified
+// yet are listed with only their name.
+func (s *Server) handleDevices(c *gin.Context) {
+	devices := []camera.DeviceInfo{}
+	for _, cam := range s.cameras() {
+		if source.IsLocal(cam.RTSPURL) {
+			continue
+		}
+		info, ok := s.devices.Info(cam.Name)
+		if !ok {
+			info = camera.DeviceInfo{Camera: cam.Name}
+		}
+		devices = append(devices, info)
+	}
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
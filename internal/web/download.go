@@ -0,0 +1,76 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveRecording sends a recording with the headers clients need to resume
+// an interrupted download and to verify it. Range and conditional requests
+// are answered from the ETag and Last-Modified.
+func (s *Server) serveRecording(c *gin.Context, filePath string) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "File not found"))
+		return
+	}
+
+	etag := fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+	if sum := s.recordingChecksum(filePath, info.Size()); sum != "" {
+		c.Header("X-Checksum-SHA256", sum)
+		etag = `"` + sum + `"`
+	}
+	c.Header("ETag", etag)
+	c.Header("Accept-Ranges", "bytes")
+	c.File(filePath)
+}
+
+// recordingChecksum returns the SHA-256 of the indexed segment at path,
+// hashing the file the first time it is asked for. It returns "" for files
+// the index does not know or whose size no longer matches it.
+func (s *Server) recordingChecksum(path string, size int64) string {
+	segments, err := s.index.SegmentsByPath([]string{path})
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return ""
+	}
+	seg, ok := segments[filepath.Clean(path)]
+	if !ok || seg.Size != size {
+		return ""
+	}
+	if seg.SHA256 != "" {
+		return seg.SHA256
+	}
+
+	sum, err := fileSHA256(path)
+	if err != nil {
+		log.Printf("Warning: Failed to hash %s: %v", path, err)
+		return ""
+	}
+	if err := s.index.SetSegmentChecksum(path, sum, size); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return sum
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
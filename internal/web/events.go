@@ -0,0 +1,189 @@
+package web
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/internal/notify"
+	"github.com/lets-vibe/cam-recorder/pkg/camera"
+)
+
+func (s *Server) eventTargets() []camera.EventTarget {
+	var targets []camera.EventTarget
+	for _, cam := range s.cameras() {
+		if cam.Enabled && cam.ONVIFEvents {
+			targets = append(targets, camera.EventTarget{
+				Name:     cam.Name,
+				RTSPURL:  cam.RTSPURL,
+				ONVIFURL: cam.ONVIFURL,
+			})
+		}
+	}
+	return targets
+}
+
+func (s *Server) audioTargets() []camera.AudioTarget {
+	var targets []camera.AudioTarget
+	for _, cam := range s.cameras() {
+		if cam.Enabled && cam.AudioEvents.Enabled {
+			targets = append(targets, cam.AudioTarget(s.streamURL(cam)))
+		}
+	}
+	return targets
+}
+
+func (s *Server) motionTargets() []camera.MotionTarget {
+	s.cfgMu.RLock()
+	hwaccel := s.config.Decode.Detection
+	s.cfgMu.RUnlock()
+
+	var targets []camera.MotionTarget
+	for _, cam := range s.cameras() {
+		if cam.Enabled && cam.MotionEvents.Enabled {
+			targets = append(targets, cam.MotionTarget(s.streamURL(cam), hwaccel))
+		}
+	}
+	return targets
+}
+
+// cameraEvent records an event the server picked up from a camera itself.
+func (s *Server) cameraEvent(ev camera.Event) {
+	if _, err := s.ingestEvent(ev); err != nil {
+		log.Printf("Warning: Failed to record %s event for %s: %v", ev.Kind, ev.Camera, err)
+	}
+}
+
+type openEvent struct {
+	id    int64
+	until time.Time
+}
+
+func (s *Server) ingestEvent(ev camera.Event) (int64, error) {
+	s.cfgMu.RLock()
+	recordFor := s.config.Events.RecordDuration
+	s.cfgMu.RUnlock()
+	if ev.Duration > 0 {
+		recordFor = ev.Duration
+	}
+
+	if err := s.recorder.Trigger(ev.Camera, time.Now().Add(recordFor)); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	key := ev.Camera + "\x00" + ev.Kind
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+
+	if open, ok := s.openEvents[key]; ok && ev.Time.Before(open.until) {
+		until := ev.Time.Add(recordFor)
+		if err := s.index.ExtendEvent(open.id, until); err != nil {
+			return 0, err
+		}
+		s.openEvents[key] = openEvent{id: open.id, until: until}
+		return open.id, nil
+	}
+
+	id, err := s.index.AddEvent(index.Event{
+		Camera:    ev.Camera,
+		Kind:      ev.Kind,
+		Label:     ev.Label,
+		Source:    ev.Source,
+		StartedAt: ev.Time,
+		EndedAt:   ev.Time.Add(recordFor),
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.openEvents[key] = openEvent{id: id, until: ev.Time.Add(recordFor)}
+
+	title := fmt.Sprintf("%s on %s", strings.ReplaceAll(ev.Kind, "_", " "), ev.Camera)
+	s.notifier.Send(notify.Notification{
+		Kind:   notify.KindMotion,
+		Camera: ev.Camera,
+		Title:  strings.ToUpper(title[:1]) + title[1:],
+		Body:   ev.Label,
+		URL:    s.url("/camera/" + url.PathEscape(ev.Camera)),
+		Image:  s.url("/snapshot/" + url.PathEscape(ev.Camera)),
+		Time:   ev.Time,
+	})
+
+	return id, nil
+}
+
+func (s *Server) eventToken() string {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.config.Events.Token
+}
+
+// checkEventToken checks the events.token of a pushed event, if one is set,
+// and answers 401 when it does not match.
+func (s *Server) checkEventToken(c *gin.Context) bool {
+	token := s.eventToken()
+	if token == "" {
+		return true
+	}
+	provided := c.GetHeader("X-Event-Token")
+	if provided == "" {
+		provided = c.Query("token")
+	}
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		s.authFailed(c, "invalid event token")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": s.tr(c, "invalid event token")})
+		return false
+	}
+	s.authSucceeded(c)
+	return true
+}
+
+func (s *Server) handleCameraEventPush(c *gin.Context) {
+	cameraName := c.Param("name")
+	if !s.checkEventToken(c) {
+		return
+	}
+
+	cam, ok := s.findCamera(cameraName)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
+		return
+	}
+
+	ev, active, err := camera.ParseEventPush(c.GetHeader("Content-Type"), c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !active {
+		c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Event ignored")})
+		return
+	}
+
+	ev.Camera = cam.Name
+	if kind := c.Query("kind"); kind != "" {
+		ev.Kind = camera.NormalizeEventKind(kind)
+	}
+	if label := c.Query("label"); label != "" {
+		ev.Label = label
+	}
+
+	id, err := s.ingestEvent(ev)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": s.tr(c, "Event recorded"),
+		"id":      id,
+		"camera":  ev.Camera,
+		"kind":    ev.Kind,
+	})
+}
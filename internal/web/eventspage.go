@@ -0,0 +1,101 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/camera"
+)
+
+const eventsPageLimit = 500
+
+// eventKinds are the kinds of event offered as filters on the events page,
+// with their labels.
+var eventKinds = []struct{ Kind, Label string }{
+	{camera.EventMotion, "Motion"},
+	{camera.EventLineCrossing, "Line crossing"},
+	{camera.EventIntrusion, "Intrusion"},
+	{camera.EventAudio, "Audio"},
+	{camera.EventTamper, "Tamper"},
+	{camera.EventAlarm, "Alarm"},
+	{camera.EventTrigger, "Trigger"},
+}
+
+// eventItem is an event on the events page with the first segment recorded
+// during it. PlayURL and ThumbnailURL are empty when none was.
+type eventItem struct {
+	index.Event
+	Time         time.Time
+	PlayURL      string
+	ThumbnailURL string
+}
+
+// handleEventsPage lists the events of a day, newest first, each with a
+// still from the moment it started and a link playing it from there.
+func (s *Server) handleEventsPage(c *gin.Context) {
+	cameraName := c.Query("camera")
+	kind := c.Query("kind")
+	date := c.Query("date")
+
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if parsed, err := time.ParseInLocation(time.DateOnly, date, time.Local); err == nil {
+		day = parsed
+	}
+
+	events, err := s.index.FindEvents(index.EventQuery{
+		Camera: cameraName,
+		Kind:   kind,
+		From:   day,
+		To:     day.AddDate(0, 0, 1),
+		Limit:  eventsPageLimit,
+	})
+	if err != nil {
+		s.html(c, http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]eventItem, 0, len(events))
+	for _, ev := range events {
+		item := eventItem{Event: ev, Time: ev.StartedAt.Local()}
+		segments, err := s.index.FindSegments(ev.Camera, ev.StartedAt, ev.EndedAt, 1)
+		if err != nil {
+			log.Printf("Warning: Failed to find the segment of event %d: %v", ev.ID, err)
+		}
+		if len(segments) > 0 {
+			seg := segments[0]
+			offset := max(ev.StartedAt.Sub(seg.StartedAt), 0).Seconds()
+			item.PlayURL = s.url(fmt.Sprintf("/play/%s/%s?t=%.1f", url.PathEscape(seg.Camera), url.PathEscape(seg.Filename), offset))
+			item.ThumbnailURL = s.thumbnailURL(seg, offset)
+		}
+		items = append(items, item)
+	}
+
+	s.html(c, http.StatusOK, "events.html", gin.H{
+		"pageTitle":    s.tr(c, "Events"),
+		"cameras":      s.cameras(),
+		"kinds":        eventKinds,
+		"events":       items,
+		"selectedCam":  cameraName,
+		"selectedKind": kind,
+		"date":         day.Format(time.DateOnly),
+		"prevDate":     day.AddDate(0, 0, -1).Format(time.DateOnly),
+		"nextDate":     nextEventsDay(day, now),
+		"limited":      len(events) == eventsPageLimit,
+	})
+}
+
+// nextEventsDay returns the day after day, or "" when day is today.
+func nextEventsDay(day, now time.Time) string {
+	next := day.AddDate(0, 0, 1)
+	if next.After(now) {
+		return ""
+	}
+	return next.Format(time.DateOnly)
+}
@@ -0,0 +1,202 @@
+package web
+
+import (
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/export"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+)
+
+const (
+	maxExportSegments = 10000
+	// Watermarking re-encodes every file, so watermarked exports are kept
+	// small enough to finish in reasonable time.
+	maxWatermarkSegments = 100
+)
+
+func (s *Server) SetVersion(version string) {
+	s.version = version
+}
+
+// handleExport bundles the recordings of one or more cameras in a time range
+// into a ZIP with a chain-of-custody manifest.
+func (s *Server) handleExport(c *gin.Context) {
+	cameras := c.QueryArray("camera")
+	if len(cameras) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "camera is required")})
+		return
+	}
+	locations := make(map[string]export.Location)
+	for _, name := range cameras {
+		cam, ok := s.findCamera(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found: %s", name)})
+			return
+		}
+		if cam.Position.Geo() {
+			locations[name] = export.Location{Lat: cam.Position.Lat, Lon: cam.Position.Lon}
+		}
+	}
+
+	s.cfgMu.RLock()
+	exportCfg := s.config.Export
+	origin := s.config.Instance.Origin()
+	s.cfgMu.RUnlock()
+	exportCfg.Site = cmp.Or(exportCfg.Site, origin.Site)
+
+	embed := exportCfg.Metadata
+	if v, ok := c.GetQuery("metadata"); ok {
+		embed, _ = strconv.ParseBool(v)
+	}
+	sidecars := exportCfg.Sidecars
+	if formats, ok := c.GetQueryArray("sidecar"); ok {
+		sidecars = nil
+		for _, format := range formats {
+			if format == "" {
+				continue
+			}
+			if !export.ValidSidecar(format) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "sidecar must be json or xml")})
+				return
+			}
+			sidecars = append(sidecars, format)
+		}
+	}
+
+	from, err := parseTimeParam(c, "from", time.Time{})
+	if err != nil || from.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "from is required as an RFC3339 time")})
+		return
+	}
+	to, err := parseTimeParam(c, "to", time.Time{})
+	if err != nil || to.IsZero() || to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "to is required as an RFC3339 time after from")})
+		return
+	}
+
+	var segments []index.Segment
+	for _, name := range cameras {
+		found, err := s.index.FindSegments(name, from, to, maxExportSegments)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		segments = append(segments, found...)
+	}
+	if len(segments) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "No recordings in that range")})
+		return
+	}
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].StartedAt.Before(segments[j].StartedAt)
+	})
+
+	var signer ed25519.PrivateKey
+	if sign, _ := strconv.ParseBool(c.Query("sign")); sign {
+		if signer, err = export.SigningKey(s.index); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	manifest := export.NewManifest(export.Exporter{
+		Name:      c.Query("exporter"),
+		Address:   c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}, s.version, cameras, from, to)
+	manifest.Site = exportCfg.Site
+	manifest.Software.Instance = origin.Instance
+
+	var stamp export.Stamper
+	if watermark, _ := strconv.ParseBool(c.Query("watermark")); watermark {
+		wm := s.watermark(c.Query("watermark_text"))
+		if !wm.Enabled() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "No watermark text or logo is configured")})
+			return
+		}
+		if len(segments) > maxWatermarkSegments {
+			c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "Watermarked exports are limited to %d recordings", maxWatermarkSegments)})
+			return
+		}
+		stamp = s.exportStamper(c.Request.Context(), wm)
+		manifest.Watermark = wm.Text
+		manifest.Watermarked = true
+	}
+	if embed {
+		stamp = export.Chain(stamp, s.metadataStamper(c.Request.Context(), exportCfg.Site, locations))
+		manifest.Metadata = true
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=export-%s.zip", manifest.ID))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent, so a failure can only cut the download short;
+	// the missing manifest makes a truncated archive easy to recognise.
+	if err := export.Write(c.Writer, manifest, segments, export.Options{
+		Signer:    signer,
+		Stamp:     stamp,
+		Sidecars:  sidecars,
+		Locations: locations,
+	}); err != nil {
+		log.Printf("Warning: Export %s failed: %v", manifest.ID, err)
+		return
+	}
+	log.Printf("Export %s: %d files for %v (%s to %s) by %s", manifest.ID, len(manifest.Files), cameras,
+		from.Format(time.RFC3339), to.Format(time.RFC3339), manifest.Exporter.Address)
+}
+
+// metadataStamper copies each exported segment into a temporary file with
+// its start time, camera, site and location embedded in the container.
+func (s *Server) metadataStamper(ctx context.Context, site string, locations map[string]export.Location) export.Stamper {
+	return func(seg index.Segment) (string, func(), error) {
+		dir, err := os.MkdirTemp("", "cam-export-")
+		if err != nil {
+			return "", nil, err
+		}
+		cleanup := func() { os.RemoveAll(dir) }
+
+		loc, geo := locations[seg.Camera]
+		meta := recorder.ClipMetadata{
+			CreationTime: seg.StartedAt,
+			Title:        seg.Camera,
+			Comment:      cmp.Or(seg.Site, site),
+			Lat:          loc.Lat,
+			Lon:          loc.Lon,
+			Geo:          geo,
+		}
+		out := filepath.Join(dir, seg.Filename)
+		if err := meta.WriteMetadata(ctx, seg.Path, out); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+		return out, cleanup, nil
+	}
+}
+
+func (s *Server) handleExportKey(c *gin.Context) {
+	key, err := export.SigningKey(s.index)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":  "ed25519",
+		"public_key": base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+	})
+}
@@ -0,0 +1,23 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/failover"
+)
+
+// SetFailover makes the instance report its side of a failover pair at
+// /api/failover, which is the heartbeat the peer polls.
+func (s *Server) SetFailover(m *failover.Manager) {
+	s.failover = m
+}
+
+func (s *Server) handleFailover(c *gin.Context) {
+	if s.failover == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Failover is not configured")})
+		return
+	}
+	c.JSON(http.StatusOK, s.failover.Status())
+}
@@ -0,0 +1,36 @@
+package web
+
+import (
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+)
+
+// forwardTargets lists the forward URLs of the cameras being recorded, read
+// through the shared ingest when it is on. Paused cameras and those held in
+// failover standby are not forwarded, and cameras with live audio disabled
+// are forwarded without it.
+func (s *Server) forwardTargets() []recorder.ForwardTarget {
+	var status map[string]recorder.RecorderStatus
+	var targets []recorder.ForwardTarget
+	for _, cam := range s.cameras() {
+		if !cam.Enabled || len(cam.Forward) == 0 {
+			continue
+		}
+		if status == nil {
+			status = s.recorder.GetStatus()
+		}
+		st, ok := status[cam.Name]
+		if !ok || !st.Running || st.Paused || st.State == recorder.StateStandby {
+			continue
+		}
+		input := s.streamURL(cam)
+		for _, output := range cam.Forward {
+			targets = append(targets, recorder.ForwardTarget{
+				Camera:  cam.Name,
+				Input:   input,
+				Output:  output,
+				NoAudio: cam.DisableLiveAudio,
+			})
+		}
+	}
+	return targets
+}
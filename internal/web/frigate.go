@@ -0,0 +1,137 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/frigate"
+	"github.com/lets-vibe/cam-recorder/pkg/camera"
+)
+
+// frigateForget drops Frigate objects whose end never arrived.
+const frigateForget = time.Hour
+
+// frigateObject is a Frigate object imported as the event id.
+type frigateObject struct {
+	id       int64
+	lastSeen time.Time
+}
+
+// FrigateEvent records a Frigate detection from MQTT.
+func (s *Server) FrigateEvent(m frigate.Message) {
+	if _, _, err := s.importFrigate(m); err != nil {
+		log.Printf("Warning: Failed to import Frigate event %s: %v", m.After.ID, err)
+	}
+}
+
+// importFrigate records a Frigate object as an event of its camera, of the
+// object's kind, such as person, the first time it passes the filters. While
+// Frigate tracks the object its event and recording are extended, and its end
+// closes the event. It returns the event, or false for a message ignored.
+func (s *Server) importFrigate(m frigate.Message) (int64, bool, error) {
+	s.cfgMu.RLock()
+	cfg := s.config.Frigate
+	recordFor := s.config.Events.RecordDuration
+	s.cfgMu.RUnlock()
+
+	d := m.After
+	now := time.Now()
+	s.frigateMu.Lock()
+	obj, tracked := s.frigateObjects[d.ID]
+	for id, o := range s.frigateObjects {
+		if now.Sub(o.lastSeen) > frigateForget {
+			delete(s.frigateObjects, id)
+		}
+	}
+	s.frigateMu.Unlock()
+
+	if !tracked {
+		if d.FalsePositive || !cfg.Wanted(d) {
+			return 0, false, nil
+		}
+		name, ok := s.frigateCamera(cfg, d.Camera)
+		if !ok {
+			return 0, false, fmt.Errorf("no camera matches Frigate camera %q", d.Camera)
+		}
+		started := d.Started()
+		if started.IsZero() {
+			started = now
+		}
+		id, err := s.ingestEvent(camera.Event{
+			Camera: name,
+			Kind:   camera.NormalizeEventKind(d.Label),
+			Label:  d.Description(),
+			Source: "frigate",
+			Time:   started,
+		})
+		if err != nil {
+			return 0, false, err
+		}
+		obj = frigateObject{id: id}
+	}
+
+	if ended := d.Ended(); m.Type == "end" || !ended.IsZero() {
+		if ended.IsZero() {
+			ended = now
+		}
+		s.frigateMu.Lock()
+		delete(s.frigateObjects, d.ID)
+		s.frigateMu.Unlock()
+		return obj.id, true, s.index.ExtendEvent(obj.id, ended)
+	}
+
+	obj.lastSeen = now
+	s.frigateMu.Lock()
+	s.frigateObjects[d.ID] = obj
+	s.frigateMu.Unlock()
+	if tracked {
+		if name, ok := s.frigateCamera(cfg, d.Camera); ok {
+			if err := s.recorder.Trigger(name, now.Add(recordFor)); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+		return obj.id, true, s.index.ExtendEvent(obj.id, now.Add(recordFor))
+	}
+	return obj.id, true, nil
+}
+
+func (s *Server) frigateCamera(cfg frigate.Config, frigateCamera string) (string, bool) {
+	var names []string
+	for _, cam := range s.cameras() {
+		names = append(names, cam.Name)
+	}
+	return cfg.Camera(frigateCamera, names)
+}
+
+// handleFrigateWebhook takes a Frigate event message posted by Home
+// Assistant or another relay, authenticated like camera event pushes.
+func (s *Server) handleFrigateWebhook(c *gin.Context) {
+	if !s.checkEventToken(c) {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m, err := frigate.ParseMessage(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, imported, err := s.importFrigate(m)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if !imported {
+		c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Event ignored")})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Event recorded"), "id": id})
+}
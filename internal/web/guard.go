@@ -0,0 +1,265 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+)
+
+const (
+	auditRateLimited = "rate_limited"
+	auditAuthFailure = "auth_failure"
+	auditLockout     = "lockout"
+
+	guardIdleTimeout = 30 * time.Minute
+)
+
+type ipBucket struct {
+	tokens  float64
+	last    time.Time
+	limited bool
+}
+
+type ipFailures struct {
+	times       []time.Time
+	lockedUntil time.Time
+}
+
+// guard applies per-IP rate limits to the API and share links and locks out
+// addresses that keep failing authentication.
+type guard struct {
+	rate        float64
+	burst       float64
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+	mu          sync.Mutex
+	buckets     map[string]*ipBucket
+	failures    map[string]*ipFailures
+}
+
+func newGuard(cfg config.SecurityConfig) *guard {
+	return &guard{
+		rate:        float64(cfg.RateLimit) / 60,
+		burst:       float64(max(cfg.RateBurst, 1)),
+		maxFailures: cfg.MaxAuthFailures,
+		window:      cfg.FailureWindow,
+		lockout:     cfg.LockoutDuration,
+		buckets:     make(map[string]*ipBucket),
+		failures:    make(map[string]*ipFailures),
+	}
+}
+
+// allow takes a token from the address's bucket. The second result is true
+// only for the first rejection after a run of allowed requests, so each
+// burst of excess traffic is audited once.
+func (g *guard) allow(ip string, now time.Time) (bool, bool) {
+	if g.rate <= 0 {
+		return true, false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b, ok := g.buckets[ip]
+	if !ok {
+		b = &ipBucket{tokens: g.burst, last: now}
+		g.buckets[ip] = b
+	}
+	b.tokens = math.Min(g.burst, b.tokens+now.Sub(b.last).Seconds()*g.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		first := !b.limited
+		b.limited = true
+		return false, first
+	}
+	b.tokens--
+	b.limited = false
+	return true, false
+}
+
+func (g *guard) lockedUntil(ip string, now time.Time) (time.Time, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f, ok := g.failures[ip]
+	if !ok || !now.Before(f.lockedUntil) {
+		return time.Time{}, false
+	}
+	return f.lockedUntil, true
+}
+
+// fail records an authentication failure and reports whether it locked the
+// address out.
+func (g *guard) fail(ip string, now time.Time) bool {
+	if g.maxFailures <= 0 {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f, ok := g.failures[ip]
+	if !ok {
+		f = &ipFailures{}
+		g.failures[ip] = f
+	}
+
+	recent := f.times[:0]
+	for _, t := range f.times {
+		if now.Sub(t) < g.window {
+			recent = append(recent, t)
+		}
+	}
+	f.times = append(recent, now)
+
+	if len(f.times) >= g.maxFailures {
+		f.times = nil
+		f.lockedUntil = now.Add(g.lockout)
+		return true
+	}
+	return false
+}
+
+// succeed forgets the address's failures, unless it is still locked out.
+func (g *guard) succeed(ip string, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f, ok := g.failures[ip]; ok && !now.Before(f.lockedUntil) {
+		delete(g.failures, ip)
+	}
+}
+
+func (g *guard) prune(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for ip, b := range g.buckets {
+		if now.Sub(b.last) > guardIdleTimeout {
+			delete(g.buckets, ip)
+		}
+	}
+	for ip, f := range g.failures {
+		if now.After(f.lockedUntil) && (len(f.times) == 0 || now.Sub(f.times[len(f.times)-1]) > g.window) {
+			delete(g.failures, ip)
+		}
+	}
+}
+
+func (s *Server) pruneGuard(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.guard.prune(now)
+		}
+	}
+}
+
+func guarded(path string) bool {
+	return strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/s/") || path == "/kiosk" || strings.HasPrefix(path, "/kiosk/") ||
+		strings.HasPrefix(path, "/auth/")
+}
+
+func (s *Server) guardMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !guarded(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		ip := c.ClientIP()
+		now := time.Now()
+
+		if until, locked := s.guard.lockedUntil(ip, now); locked {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(until.Sub(now).Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": s.tr(c, "too many failed attempts, try again later")})
+			return
+		}
+
+		allowed, first := s.guard.allow(ip, now)
+		if !allowed {
+			if first {
+				s.audit(auditRateLimited, ip, requestDetail(c))
+			}
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": s.tr(c, "rate limit exceeded")})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authFailed records a rejected credential (API key, event or kiosk token, or
+// share signature) and locks the address out after too many in a row.
+func (s *Server) authFailed(c *gin.Context, what string) {
+	ip := c.ClientIP()
+	detail := fmt.Sprintf("%s on %s", what, requestDetail(c))
+	s.audit(auditAuthFailure, ip, detail)
+
+	if s.guard.fail(ip, time.Now()) {
+		s.audit(auditLockout, ip, fmt.Sprintf("locked out for %s after %s", s.guard.lockout, detail))
+	}
+}
+
+func (s *Server) authSucceeded(c *gin.Context) {
+	s.guard.succeed(c.ClientIP(), time.Now())
+}
+
+func (s *Server) audit(kind, ip, detail string) {
+	log.Printf("Warning: Security %s from %s: %s", kind, ip, detail)
+	err := s.index.AddAudit(index.AuditEntry{
+		At:     time.Now(),
+		Kind:   kind,
+		IP:     ip,
+		Detail: detail,
+	})
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+func (s *Server) handleAudit(c *gin.Context) {
+	now := time.Now()
+	from, err := parseTimeParam(c, "from", now.Add(-7*24*time.Hour))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to", now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil {
+		limit = 1000
+	}
+
+	entries, err := s.index.FindAudit(c.Query("kind"), c.Query("camera"), from, to, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "count": len(entries)})
+}
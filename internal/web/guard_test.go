@@ -0,0 +1,51 @@
+package web
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+)
+
+func TestGuardSucceedForgetsFailures(t *testing.T) {
+	const ip = "192.0.2.1"
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		failures int
+		// after is how long after the failures the address signs in.
+		after      time.Duration
+		wantLocked bool
+		wantKept   bool
+	}{
+		{"failures below the limit", 2, time.Second, false, false},
+		{"during a lockout", 3, time.Minute, true, true},
+		{"after a lockout", 3, 10 * time.Minute, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGuard(config.SecurityConfig{
+				MaxAuthFailures: 3,
+				FailureWindow:   time.Minute,
+				LockoutDuration: 5 * time.Minute,
+			})
+			for i := range tt.failures {
+				g.fail(ip, start.Add(time.Duration(i)*time.Second))
+			}
+
+			now := start.Add(tt.after)
+			g.succeed(ip, now)
+			if _, locked := g.lockedUntil(ip, now); locked != tt.wantLocked {
+				t.Errorf("locked = %v, want %v", locked, tt.wantLocked)
+			}
+			if _, kept := g.failures[ip]; kept != tt.wantKept {
+				t.Errorf("failures kept = %v, want %v", kept, tt.wantKept)
+			}
+			// A single failure after signing in must not lock the address
+			// out again.
+			if !tt.wantLocked && g.fail(ip, now.Add(time.Second)) {
+				t.Error("one failure after signing in locked the address out")
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"html/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+
+	"github.com/lets-vibe/cam-recorder/internal/i18n"
+)
+
+const (
+	ctxLanguage  = "language"
+	dataLanguage = "lang"
+)
+
+// localizedRender keeps one set of templates per language, each with a "t"
+// function bound to that language, and picks the set by the "lang" entry the
+// handler's data carries.
+type localizedRender struct {
+	templates map[string]*template.Template
+}
+
+func (s *Server) loadTemplates(pattern string) {
+	r := localizedRender{templates: make(map[string]*template.Template)}
+	for _, lang := range i18n.Supported() {
+		r.templates[lang.Code] = template.Must(template.New("").Funcs(template.FuncMap{
+			"basePath": func() string { return s.basePath },
+			"lang":     func() string { return lang.Code },
+			"t":        lang.T,
+			"messages": lang.Messages,
+		}).ParseGlob(pattern))
+	}
+	s.Router.HTMLRender = r
+}
+
+func (r localizedRender) Instance(name string, data any) render.Render {
+	code := i18n.Default
+	if h, ok := data.(gin.H); ok {
+		if lang, ok := h[dataLanguage].(string); ok {
+			code = lang
+		}
+	}
+	tmpl, ok := r.templates[code]
+	if !ok {
+		tmpl = r.templates[i18n.Default]
+	}
+	return render.HTML{Template: tmpl, Name: name, Data: data}
+}
+
+// language returns the language to answer the request in: the user's
+// preference, then server.language, then what the browser asks for.
+func (s *Server) language(c *gin.Context) *i18n.Language {
+	if code, ok := c.Get(ctxLanguage); ok {
+		return i18n.Get(code.(string))
+	}
+
+	code := s.preferences(c).Language
+	if code == "" {
+		s.cfgMu.RLock()
+		code = s.config.Server.Language
+		s.cfgMu.RUnlock()
+	}
+	if code == "" {
+		code = i18n.Match(c.GetHeader("Accept-Language"))
+	}
+
+	lang := i18n.Get(code)
+	c.Set(ctxLanguage, lang.Code)
+	return lang
+}
+
+// tr translates a message for the request.
+func (s *Server) tr(c *gin.Context, key string, args ...any) string {
+	return s.language(c).T(key, args...)
+}
+
+// html renders a template in the request's language.
+func (s *Server) html(c *gin.Context, code int, name string, data gin.H) {
+	data[dataLanguage] = s.language(c).Code
+	data[dataUser] = c.GetString(ctxUser)
+	c.HTML(code, name, data)
+}
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/importer"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+type ingestRequest struct {
+	Camera string `json:"camera" binding:"required"`
+	Dir    string `json:"dir" binding:"required"`
+	Move   bool   `json:"move"`
+}
+
+// importJob is the import of a server directory running in the background,
+// or the last one to finish.
+type importJob struct {
+	Camera     string           `json:"camera"`
+	Dir        string           `json:"dir"`
+	Move       bool             `json:"move"`
+	Running    bool             `json:"running"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at,omitzero"`
+	Result     *importer.Result `json:"result,omitempty"`
+	// Expiring counts the imported files the next cleanup removes.
+	Expiring int    `json:"expiring"`
+	Error    string `json:"error,omitempty"`
+}
+
+// handleRecordingsIngest starts importing the video files in a directory on
+// the server as recordings of a camera. A large import takes long, so it
+// runs in the background, independent of the request; poll
+// GET /api/recordings/ingest for its outcome.
+func (s *Server) handleRecordingsIngest(c *gin.Context) {
+	var req ingestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cam, ok := s.findCamera(req.Camera)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
+		return
+	}
+
+	s.cfgMu.RLock()
+	opts := importer.Options{
+		Camera:    cam.Name,
+		Dir:       req.Dir,
+		OutputDir: s.config.Recording.OutputDir,
+		Format:    s.config.Recording.Format,
+		Move:      req.Move,
+	}
+	s.cfgMu.RUnlock()
+	if err := importer.Check(opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.importMu.Lock()
+	if s.importJob != nil && s.importJob.Running {
+		s.importMu.Unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": s.tr(c, "An import is already running")})
+		return
+	}
+	job := &importJob{Camera: cam.Name, Dir: req.Dir, Move: req.Move, Running: true, StartedAt: time.Now()}
+	s.importJob = job
+	started := *job
+	s.importMu.Unlock()
+
+	go s.runImport(job, opts)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": s.tr(c, "Import started"), "import": started})
+}
+
+func (s *Server) runImport(job *importJob, opts importer.Options) {
+	result, err := importer.Run(s.appContext(), s.index, opts)
+
+	s.importMu.Lock()
+	defer s.importMu.Unlock()
+	job.Running = false
+	job.FinishedAt = time.Now()
+	job.Result = result
+	if result != nil {
+		job.Expiring = result.Expiring(s.storage.RetentionCutoff(storage.CameraDirName(opts.Camera), job.FinishedAt))
+	}
+	if err != nil {
+		job.Error = err.Error()
+	}
+}
+
+// handleRecordingsIngestStatus reports the running import, or the last one.
+func (s *Server) handleRecordingsIngestStatus(c *gin.Context) {
+	s.importMu.Lock()
+	defer s.importMu.Unlock()
+
+	if s.importJob == nil {
+		c.JSON(http.StatusOK, gin.H{"running": false})
+		return
+	}
+	c.JSON(http.StatusOK, *s.importJob)
+}
@@ -0,0 +1,45 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/integrity"
+)
+
+// SetIntegrity gives the server the checksum manager, to report on and run
+// integrity checks.
+func (s *Server) SetIntegrity(m *integrity.Manager) {
+	s.integrity = m
+}
+
+// handleIntegrity returns the checksum settings and the last check's report.
+func (s *Server) handleIntegrity(c *gin.Context) {
+	if s.integrity == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Integrity checks are not available")})
+		return
+	}
+	cfg := s.integrity.Config()
+	c.JSON(http.StatusOK, gin.H{
+		"checksums": cfg.Checksums,
+		"check_at":  cfg.CheckAt,
+		"running":   s.integrity.Running(),
+		"last":      s.integrity.LastReport(),
+	})
+}
+
+// handleIntegrityCheck starts a check now. Reading every recording takes a
+// while, so it runs in the background; poll /api/integrity for the report.
+func (s *Server) handleIntegrityCheck(c *gin.Context) {
+	if s.integrity == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Integrity checks are not available")})
+		return
+	}
+	if s.integrity.Running() {
+		c.JSON(http.StatusConflict, gin.H{"error": s.tr(c, "An integrity check is already running")})
+		return
+	}
+	go s.integrity.Check(s.appContext())
+	c.JSON(http.StatusAccepted, gin.H{"message": s.tr(c, "Integrity check started")})
+}
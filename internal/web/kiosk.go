@@ -0,0 +1,139 @@
+package web
+
+import (
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/internal/tags"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+)
+
+const kioskUser = "kiosk"
+
+// kiosk returns the kiosk settings if the kiosk is enabled and the request
+// carries its token. Otherwise it returns the status to answer with.
+func (s *Server) kiosk(c *gin.Context) (config.KioskConfig, int) {
+	s.cfgMu.RLock()
+	kiosk := s.config.Kiosk
+	kiosk.Cameras = slices.Clone(kiosk.Cameras)
+	s.cfgMu.RUnlock()
+
+	if !kiosk.Enabled {
+		return kiosk, http.StatusNotFound
+	}
+	if kiosk.Token != "" {
+		if subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(kiosk.Token)) != 1 {
+			s.authFailed(c, "invalid kiosk token")
+			return kiosk, http.StatusUnauthorized
+		}
+		s.authSucceeded(c)
+	}
+	return kiosk, http.StatusOK
+}
+
+// kioskCameras lists the enabled cameras with the tags that the kiosk
+// shows, in the order of kiosk.cameras when it is set.
+func (s *Server) kioskCameras(kiosk config.KioskConfig, sel tags.Selector) []config.CameraConfig {
+	var cameras []config.CameraConfig
+	if len(kiosk.Cameras) == 0 {
+		for _, cam := range s.cameras() {
+			if cam.Enabled && sel.Match(cam.Tags) {
+				cameras = append(cameras, cam)
+			}
+		}
+		return cameras
+	}
+	for _, name := range kiosk.Cameras {
+		if cam, ok := s.findCamera(name); ok && cam.Enabled && sel.Match(cam.Tags) {
+			cameras = append(cameras, cam)
+		}
+	}
+	return cameras
+}
+
+func (s *Server) handleKioskPage(c *gin.Context) {
+	kiosk, status := s.kiosk(c)
+	if status != http.StatusOK {
+		msg := s.tr(c, "Not found")
+		if status == http.StatusUnauthorized {
+			msg = s.tr(c, "invalid kiosk token")
+		}
+		s.html(c, status, "error.html", gin.H{"error": msg})
+		return
+	}
+	sel, err := tagSelector(c)
+	if err != nil {
+		s.html(c, http.StatusBadRequest, "error.html", gin.H{"error": err.Error()})
+		return
+	}
+
+	type tile struct {
+		Name string
+		URL  string
+	}
+	query := url.Values{}
+	for _, key := range []string{"token", "res", "fps"} {
+		if v := c.Query(key); v != "" {
+			query.Set(key, v)
+		}
+	}
+	if len(sel) > 0 {
+		query.Set("tag", sel.String())
+	}
+	var tiles []tile
+	for _, cam := range s.kioskCameras(kiosk, sel) {
+		tiles = append(tiles, tile{
+			Name: cam.Name,
+			URL:  s.url("/kiosk/live/" + url.PathEscape(cam.Name) + "?" + query.Encode()),
+		})
+	}
+
+	columns := kiosk.Columns
+	if columns == 0 {
+		columns = max(1, int(math.Ceil(math.Sqrt(float64(len(tiles))))))
+	}
+
+	s.html(c, http.StatusOK, "kiosk.html", gin.H{
+		"pageTitle": s.tr(c, "Live View"),
+		"tiles":     tiles,
+		"columns":   columns,
+	})
+}
+
+func (s *Server) handleKioskStream(c *gin.Context) {
+	kiosk, status := s.kiosk(c)
+	if status != http.StatusOK {
+		if status == http.StatusUnauthorized {
+			c.String(status, s.tr(c, "invalid kiosk token"))
+		} else {
+			c.String(status, s.tr(c, "Not found"))
+		}
+		return
+	}
+
+	sel, err := tagSelector(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cameraName := c.Param("name")
+	if !slices.ContainsFunc(s.kioskCameras(kiosk, sel), func(cam config.CameraConfig) bool { return cam.Name == cameraName }) {
+		c.String(http.StatusNotFound, s.tr(c, "Camera not found"))
+		return
+	}
+
+	quality, err := recorder.ParseQuality(c.Query("res"), c.Query("fps"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.streamMJPEG(c, cameraName, quality, kioskUser)
+}
@@ -0,0 +1,66 @@
+package web
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+)
+
+func (s *Server) handleLiveHLS(c *gin.Context) {
+	file := c.Param("file")
+	if !recorder.IsHLSFile(file) {
+		c.String(http.StatusNotFound, s.tr(c, "Not found"))
+		return
+	}
+
+	cam, ok := s.findCamera(c.Param("name"))
+	if !ok || !cam.Enabled {
+		c.String(http.StatusNotFound, s.tr(c, "Camera not found"))
+		return
+	}
+
+	var dir string
+	if file == recorder.HLSMaster {
+		sess := s.newViewer(c, cam.Name, s.viewerUser(c), viewerHLS)
+		if refused := s.viewers.refusesHLS(sess, s.viewerLimits(cam)); refused != "" {
+			s.refuseViewer(c, sess, refused)
+			return
+		}
+		var err error
+		dir, err = s.hls.Open(c.Request.Context(), cam.Name, s.streamURL(cam), !cam.DisableLiveAudio)
+		if err != nil {
+			c.String(http.StatusServiceUnavailable, err.Error())
+			return
+		}
+	} else if dir, ok = s.hls.Dir(cam.Name); !ok {
+		c.String(http.StatusNotFound, s.tr(c, "Live stream not running"))
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(file, ".m3u8"):
+		c.Header("Content-Type", "application/vnd.apple.mpegurl")
+		c.Header("Cache-Control", "no-cache")
+	case strings.HasSuffix(file, ".m4s"):
+		c.Header("Content-Type", "video/iso.segment")
+	default:
+		c.Header("Content-Type", "video/mp4")
+	}
+	// A stalled player cannot hold the handler; the deadline is cleared
+	// again for the connection's next request.
+	writeTimeout, _ := s.liveTimeouts()
+	rc := http.NewResponseController(c.Writer)
+	rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	c.File(filepath.Join(dir, file))
+	rc.SetWriteDeadline(time.Time{})
+
+	if written := c.Writer.Size(); written > 0 {
+		viewer := s.viewers.touch(s.newViewer(c, cam.Name, s.viewerUser(c), viewerHLS), time.Now())
+		viewer.bytes.Add(int64(written))
+	}
+}
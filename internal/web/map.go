@@ -0,0 +1,200 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	maxFloorPlanSize = 10 << 20
+	// siteAspect is the width over the height of the site plot.
+	siteAspect = 1.6
+)
+
+var floorPlanExtensions = map[string]string{"png": ".png", "jpeg": ".jpg"}
+
+// mapMarker is a camera drawn on the map, Left and Top being percentages of
+// the plot or floor plan.
+type mapMarker struct {
+	Name      string
+	Enabled   bool
+	Left, Top float64
+	Lat, Lon  float64
+	OSM       string
+}
+
+func (s *Server) mapDir() string {
+	return filepath.Join(s.config.Recording.OutputDir, storage.MapDir)
+}
+
+// floorPlan returns the path of the uploaded floor plan, or "".
+func (s *Server) floorPlan() string {
+	for _, ext := range floorPlanExtensions {
+		p := filepath.Join(s.mapDir(), "floorplan"+ext)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+func (s *Server) handleMapPage(c *gin.Context) {
+	sel, err := tagSelector(c)
+	if err != nil {
+		s.html(c, http.StatusBadRequest, "error.html", gin.H{"error": err.Error()})
+		return
+	}
+	all := s.cameras()
+	cameras := camerasTagged(all, sel)
+
+	var plan, unplaced []mapMarker
+	var geo []config.CameraConfig
+	for _, cam := range cameras {
+		if cam.Position.OnPlan() {
+			plan = append(plan, mapMarker{
+				Name:    cam.Name,
+				Enabled: cam.Enabled,
+				Left:    cam.Position.X * 100,
+				Top:     cam.Position.Y * 100,
+			})
+		}
+		if cam.Position.Geo() {
+			geo = append(geo, cam)
+		}
+		if !cam.Position.OnPlan() && !cam.Position.Geo() {
+			unplaced = append(unplaced, mapMarker{Name: cam.Name, Enabled: cam.Enabled})
+		}
+	}
+
+	s.html(c, http.StatusOK, "map.html", gin.H{
+		"pageTitle": s.tr(c, "Map"),
+		"cameras":   cameras,
+		"plan":      plan,
+		"site":      plotSite(geo),
+		"unplaced":  unplaced,
+		"floorPlan": s.floorPlan() != "",
+		"tags":      cameraTagList(all),
+		"tagFilter": sel.String(),
+	})
+}
+
+// plotSite fits the cameras' coordinates into the site plot, keeping
+// distances true in both directions.
+func plotSite(cameras []config.CameraConfig) []mapMarker {
+	if len(cameras) == 0 {
+		return nil
+	}
+	minLat, maxLat := math.Inf(1), math.Inf(-1)
+	minLon, maxLon := math.Inf(1), math.Inf(-1)
+	for _, cam := range cameras {
+		minLat, maxLat = min(minLat, cam.Position.Lat), max(maxLat, cam.Position.Lat)
+		minLon, maxLon = min(minLon, cam.Position.Lon), max(maxLon, cam.Position.Lon)
+	}
+	midLat, midLon := (minLat+maxLat)/2, (minLon+maxLon)/2
+	// A degree of longitude shrinks away from the equator.
+	squeeze := math.Cos(midLat * math.Pi / 180)
+	spanX, spanY := (maxLon-minLon)*squeeze, maxLat-minLat
+
+	// Scale to plot heights, leaving a tenth of the plot free on every side.
+	scale := 0.0
+	if spanX > 0 || spanY > 0 {
+		scale = math.Inf(1)
+		if spanX > 0 {
+			scale = 0.8 * siteAspect / spanX
+		}
+		if spanY > 0 {
+			scale = min(scale, 0.8/spanY)
+		}
+	}
+
+	markers := make([]mapMarker, len(cameras))
+	for i, cam := range cameras {
+		p := cam.Position
+		markers[i] = mapMarker{
+			Name:    cam.Name,
+			Enabled: cam.Enabled,
+			Left:    100 * (0.5 + (p.Lon-midLon)*squeeze*scale/siteAspect),
+			Top:     100 * (0.5 - (p.Lat-midLat)*scale),
+			Lat:     p.Lat,
+			Lon:     p.Lon,
+			OSM:     fmt.Sprintf("https://www.openstreetmap.org/?mlat=%f&mlon=%f#map=19/%f/%f", p.Lat, p.Lon, p.Lat, p.Lon),
+		}
+	}
+	return markers
+}
+
+func (s *Server) handleFloorPlan(c *gin.Context) {
+	plan := s.floorPlan()
+	if plan == "" {
+		c.String(http.StatusNotFound, s.tr(c, "No floor plan uploaded"))
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.File(plan)
+}
+
+// handleFloorPlanUpload stores a PNG or JPEG sent as the request body as the
+// floor plan of the camera map.
+func (s *Server) handleFloorPlanUpload(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxFloorPlanSize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": s.tr(c, "floor plan must be at most %d MB", maxFloorPlanSize>>20)})
+		return
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	ext, ok := floorPlanExtensions[format]
+	if err != nil || !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "floor plan must be a PNG or JPEG image")})
+		return
+	}
+
+	dir := s.mapDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	dst := filepath.Join(dir, "floorplan"+ext)
+	tmp := dst + ".part"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, other := range floorPlanExtensions {
+		if other != ext {
+			os.Remove(filepath.Join(dir, "floorplan"+other))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Floor plan uploaded")})
+}
+
+func (s *Server) handleFloorPlanDelete(c *gin.Context) {
+	removed := false
+	for _, ext := range floorPlanExtensions {
+		if os.Remove(filepath.Join(s.mapDir(), "floorplan"+ext)) == nil {
+			removed = true
+		}
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "No floor plan uploaded")})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Floor plan removed")})
+}
@@ -0,0 +1,137 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+)
+
+var metricStates = []recorder.State{
+	recorder.StateStopped,
+	recorder.StateIdle,
+	recorder.StatePaused,
+	recorder.StateQueued,
+	recorder.StateConnecting,
+	recorder.StateRecording,
+	recorder.StateRetrying,
+	recorder.StateFailed,
+	recorder.StateCircuitOpen,
+	recorder.StateStandby,
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (s *Server) handleMetrics(c *gin.Context) {
+	status := s.recorder.GetStatus()
+	names := make([]string, 0, len(status))
+	for name := range status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := c.Writer
+
+	writeMetricHeader(w, "cam_recorder_camera_state", "gauge", "Current recorder state (1 for the active state).")
+	for _, name := range names {
+		for _, state := range metricStates {
+			value := 0
+			if status[name].State == state {
+				value = 1
+			}
+			fmt.Fprintf(w, "cam_recorder_camera_state{camera=\"%s\",state=\"%s\"} %d\n", labelEscaper.Replace(name), state, value)
+		}
+	}
+
+	writeMetricHeader(w, "cam_recorder_camera_transcoding", "gauge", "Whether the camera's recorder is re-encoding video (0 means stream copy).")
+	for _, name := range names {
+		fmt.Fprintf(w, "cam_recorder_camera_transcoding{camera=\"%s\"} %d\n", labelEscaper.Replace(name), boolMetric(status[name].Transcoding))
+	}
+
+	writeMetricHeader(w, "cam_recorder_ffmpeg_cpu_percent", "gauge", "CPU usage of the camera's recording ffmpeg process.")
+	for _, name := range names {
+		if usage := status[name].Usage; usage != nil {
+			fmt.Fprintf(w, "cam_recorder_ffmpeg_cpu_percent{camera=\"%s\"} %g\n", labelEscaper.Replace(name), usage.CPUPercent)
+		}
+	}
+
+	writeMetricHeader(w, "cam_recorder_ffmpeg_rss_bytes", "gauge", "Resident memory of the camera's recording ffmpeg process.")
+	for _, name := range names {
+		if usage := status[name].Usage; usage != nil {
+			fmt.Fprintf(w, "cam_recorder_ffmpeg_rss_bytes{camera=\"%s\"} %d\n", labelEscaper.Replace(name), usage.RSSBytes)
+		}
+	}
+
+	writeMetricHeader(w, "cam_recorder_ffmpeg_resource_restarts_total", "counter", "ffmpeg processes restarted for exceeding resource limits.")
+	for _, name := range names {
+		fmt.Fprintf(w, "cam_recorder_ffmpeg_resource_restarts_total{camera=\"%s\"} %d\n", labelEscaper.Replace(name), status[name].Restarts)
+	}
+
+	writeMetricHeader(w, "cam_recorder_camera_device_info", "gauge", "Vendor, model and firmware the camera reported (always 1).")
+	for _, name := range names {
+		if info, ok := s.devices.Info(name); ok && info.Source != "" {
+			fmt.Fprintf(w, "cam_recorder_camera_device_info{camera=\"%s\",manufacturer=\"%s\",model=\"%s\",firmware=\"%s\"} 1\n",
+				labelEscaper.Replace(name), labelEscaper.Replace(info.Manufacturer), labelEscaper.Replace(info.Model), labelEscaper.Replace(info.Firmware))
+		}
+	}
+
+	streams := make(map[string]map[string]int)
+	for _, sess := range s.viewers.list() {
+		if streams[sess.camera] == nil {
+			streams[sess.camera] = make(map[string]int)
+		}
+		streams[sess.camera][sess.mode]++
+	}
+	writeMetricHeader(w, "cam_recorder_live_streams", "gauge", "Open live views of the camera, by kind.")
+	for _, name := range names {
+		for _, mode := range []string{viewerMJPEG, viewerHLS} {
+			fmt.Fprintf(w, "cam_recorder_live_streams{camera=\"%s\",mode=\"%s\"} %d\n", labelEscaper.Replace(name), mode, streams[name][mode])
+		}
+	}
+	writeMetricHeader(w, "cam_recorder_http_connections", "gauge", "Open client connections to the web server.")
+	fmt.Fprintf(w, "cam_recorder_http_connections %d\n", s.conns.Load())
+
+	if s.restream != nil {
+		writeMetricHeader(w, "cam_recorder_restream_readers", "gauge", "RTSP clients reading the camera from the restream server.")
+		for _, name := range names {
+			fmt.Fprintf(w, "cam_recorder_restream_readers{camera=\"%s\"} %d\n", labelEscaper.Replace(name), s.restream.Readers(name))
+		}
+	}
+
+	if limiter := s.recorder.Limiter(); limiter != nil {
+		writeMetricHeader(w, "cam_recorder_transcodes_active", "gauge", "Transcoding ffmpeg processes currently running.")
+		fmt.Fprintf(w, "cam_recorder_transcodes_active %d\n", limiter.InUse())
+		writeMetricHeader(w, "cam_recorder_transcodes_max", "gauge", "Configured cap on transcoding ffmpeg processes.")
+		fmt.Fprintf(w, "cam_recorder_transcodes_max %d\n", limiter.Max())
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	writeMetricHeader(w, "cam_recorder_go_heap_bytes", "gauge", "Heap memory in use by the recorder itself.")
+	fmt.Fprintf(w, "cam_recorder_go_heap_bytes %d\n", mem.HeapInuse)
+	writeMetricHeader(w, "cam_recorder_goroutines", "gauge", "Goroutines in the recorder itself.")
+	fmt.Fprintf(w, "cam_recorder_goroutines %d\n", runtime.NumGoroutine())
+	if s.leaks != nil {
+		writeMetricHeader(w, "cam_recorder_goroutine_leaks_suspected", "gauge", "Goroutine groups that kept growing over the last leak checks.")
+		fmt.Fprintf(w, "cam_recorder_goroutine_leaks_suspected %d\n", s.leaks.Suspected())
+	}
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func boolMetric(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
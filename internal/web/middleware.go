@@ -0,0 +1,267 @@
+package web
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+)
+
+// Request IDs accepted from a trusted proxy.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Response types worth compressing; media is compressed already, and streams
+// must reach the client as they are written.
+var gzipTypes = map[string]bool{
+	"application/json": true,
+	"text/html":        true,
+	"text/plain":       true,
+	"text/css":         true,
+	"text/javascript":  true,
+	"text/calendar":    true,
+}
+
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// middleware returns the router's middleware stack, with the optional parts
+// server.* turns on. Requests are given their ID and logged before the
+// access rules, guard and sign-in can turn them away, so refusals are
+// logged too.
+func (s *Server) middleware(cfg config.ServerConfig) []gin.HandlerFunc {
+	handlers := []gin.HandlerFunc{gin.Recovery()}
+	if cfg.RequestIDs {
+		handlers = append(handlers, s.requestIDMiddleware())
+	}
+	if cfg.AccessLog != "" {
+		handlers = append(handlers, s.accessLogMiddleware(cfg.AccessLog))
+	}
+	handlers = append(handlers, s.accessMiddleware(), s.corsMiddleware(), s.guardMiddleware())
+	if cfg.SecurityHeaders {
+		handlers = append(handlers, securityHeadersMiddleware())
+	}
+	if cfg.Gzip {
+		handlers = append(handlers, gzipMiddleware())
+	}
+	return append(handlers, s.signInMiddleware())
+}
+
+// requestIDMiddleware gives every request an ID, sent back as X-Request-ID
+// and written to the access log. An ID set by a trusted proxy is kept, so
+// its logs and the recorder's line up.
+func (s *Server) requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || !requestIDPattern.MatchString(id) || !s.fromTrustedProxy(c) {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// requestDetail describes a request for the audit log, with its ID when it
+// has one so the entry can be found in the access log.
+func requestDetail(c *gin.Context) string {
+	detail := c.Request.Method + " " + c.Request.URL.Path
+	if id := c.GetString(requestIDKey); id != "" {
+		detail += " (request " + id + ")"
+	}
+	return detail
+}
+
+// fromTrustedProxy reports whether the request came through one of
+// security.trusted_proxies, whose headers can be believed.
+func (s *Server) fromTrustedProxy(c *gin.Context) bool {
+	remote, err := netip.ParseAddr(c.RemoteIP())
+	if err != nil {
+		return false
+	}
+	for _, prefix := range s.trusted {
+		if prefix.Contains(remote.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessLogEntry is one line of the access log.
+type accessLogEntry struct {
+	RequestID string  `json:"request_id,omitempty"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Status    int     `json:"status"`
+	Bytes     int     `json:"bytes"`
+	Duration  float64 `json:"duration_ms"`
+	IP        string  `json:"ip"`
+	User      string  `json:"user,omitempty"`
+}
+
+// accessLogMiddleware logs every request once it is answered, to the same
+// log as the recorder, as key=value pairs or, with format "json", as one
+// JSON object per line. Query strings are left out, as share and kiosk
+// tokens travel in them.
+func (s *Server) accessLogMiddleware(format string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		c.Next()
+
+		entry := accessLogEntry{
+			RequestID: c.GetString(requestIDKey),
+			Method:    c.Request.Method,
+			Path:      path,
+			Status:    c.Writer.Status(),
+			Bytes:     max(c.Writer.Size(), 0),
+			Duration:  float64(time.Since(start).Microseconds()) / 1000,
+			IP:        c.ClientIP(),
+			User:      s.viewerUser(c),
+		}
+		if format == config.AccessLogJSON {
+			line, _ := json.Marshal(entry)
+			log.Printf("access %s", line)
+			return
+		}
+		line := fmt.Sprintf("access method=%s path=%q status=%d bytes=%d duration=%.3fms ip=%s",
+			entry.Method, entry.Path, entry.Status, entry.Bytes, entry.Duration, entry.IP)
+		if entry.RequestID != "" {
+			line += " request_id=" + entry.RequestID
+		}
+		if entry.User != "" {
+			line += fmt.Sprintf(" user=%q", entry.User)
+		}
+		log.Print(line)
+	}
+}
+
+// securityHeadersMiddleware stops browsers from guessing content types,
+// leaking share links in the Referer header, and framing the dashboard on
+// other sites. Live streams, share links and the kiosk stay embeddable.
+func securityHeadersMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "same-origin")
+		if pathArea(c.Request.URL.Path) != areaLive {
+			h.Set("X-Frame-Options", "SAMEORIGIN")
+		}
+		c.Next()
+	}
+}
+
+// gzipMiddleware compresses JSON, HTML and other text responses for clients
+// that accept gzip.
+func gzipMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !acceptsGzip(c.Request) {
+			c.Next()
+			return
+		}
+
+		w := &gzipWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Header("Vary", "Accept-Encoding")
+		c.Next()
+		w.close()
+		// Gin writes its own 404 and 405 bodies after the handlers return.
+		c.Writer = w.ResponseWriter
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	if r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+		return false
+	}
+	for _, coding := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(coding, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			if strings.TrimSpace(name) == "gzip" && strings.ReplaceAll(params, " ", "") != "q=0" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gzipWriter compresses the response once its first write shows it is of a
+// compressible type.
+type gzipWriter struct {
+	gin.ResponseWriter
+	gz      *gzip.Writer
+	decided bool
+}
+
+func (w *gzipWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+
+	h := w.Header()
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	status := w.Status()
+	if w.Written() || !gzipTypes[mediaType] || h.Get("Content-Encoding") != "" ||
+		status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return
+	}
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", "gzip")
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.gz == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.gz.Write(data)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap lets http.ResponseController reach the connection, for the write
+// deadlines of live streams.
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *gzipWriter) close() {
+	if w.gz == nil {
+		return
+	}
+	w.gz.Close()
+	gzipWriters.Put(w.gz)
+	w.gz = nil
+}
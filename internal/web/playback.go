@@ -0,0 +1,99 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+)
+
+// playbackPoll is how often a copy being converted is checked for more data.
+const playbackPoll = 250 * time.Millisecond
+
+// handleVideo serves a recording for playing in the browser. Recordings in a
+// format browsers cannot play are converted first, and sent as they convert.
+func (s *Server) handleVideo(c *gin.Context) {
+	filePath, err := s.storage.GetFilePath(c.Param("camera"), c.Param("filename"))
+	if err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "File not found"))
+		return
+	}
+
+	playable, job, err := s.recorder.Playback().Playable(c.Request.Context(), filePath)
+	switch {
+	case err != nil:
+		c.String(http.StatusServiceUnavailable, s.tr(c, "Recording cannot be played: %v", err))
+	case job != nil:
+		s.followPlayback(c, job)
+	case playable == filePath:
+		s.serveRecording(c, filePath)
+	default:
+		c.Header("Accept-Ranges", "bytes")
+		c.File(playable)
+	}
+}
+
+// followPlayback sends the copy a job is writing as it grows, so playback
+// starts before the conversion finishes. Without a length the browser cannot
+// seek past what it has received; once the copy is done it is served whole.
+func (s *Server) followPlayback(c *gin.Context, job *recorder.PlaybackJob) {
+	ctx := c.Request.Context()
+
+	var f *os.File
+	for {
+		var err error
+		if f, err = job.Open(); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-job.Done():
+			if f, err = job.Open(); err != nil {
+				c.String(http.StatusServiceUnavailable, s.tr(c, "Recording cannot be played: %v", err))
+				return
+			}
+		case <-time.After(playbackPoll):
+			continue
+		}
+		break
+	}
+	defer f.Close()
+
+	c.Header("Content-Type", "video/mp4")
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	buf := make([]byte, 256<<10)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if _, err := c.Writer.Write(buf[:n]); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err == nil {
+			continue
+		}
+		if err != io.EOF {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-job.Done():
+			// The copy is complete, or failed and is cut short.
+			if job.Err() == nil {
+				io.CopyBuffer(c.Writer, f, buf)
+			}
+			return
+		case <-time.After(playbackPoll):
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/camera"
+	"github.com/lets-vibe/cam-recorder/pkg/plugin"
+)
+
+// How long a detector plugin that failed waits before it is run again.
+const detectorRestartDelay = 30 * time.Second
+
+type detectorPlugin struct {
+	detector plugin.Detector
+	cameras  []string
+}
+
+// AddDetector runs a detector plugin on the given cameras, or on all enabled
+// cameras if none are given, once the server starts.
+func (s *Server) AddDetector(d plugin.Detector, cameras []string) {
+	s.detectors = append(s.detectors, detectorPlugin{detector: d, cameras: cameras})
+}
+
+func (s *Server) runDetector(ctx context.Context, dp detectorPlugin) {
+	name := dp.detector.Name()
+	for {
+		s.cfgMu.RLock()
+		hwaccel := s.config.Decode.Detection
+		s.cfgMu.RUnlock()
+
+		var cameras []plugin.Camera
+		for _, cam := range s.cameras() {
+			if cam.Enabled && (len(dp.cameras) == 0 || slices.Contains(dp.cameras, cam.Name)) {
+				cameras = append(cameras, plugin.Camera{
+					Name:          cam.Name,
+					URL:           s.streamURL(cam),
+					HWAccel:       hwaccel.Type,
+					HWAccelDevice: hwaccel.Device,
+				})
+			}
+		}
+
+		err := dp.detector.Run(ctx, cameras, func(ev plugin.Event) {
+			s.detectorEvent(name, ev)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Warning: Detector plugin %s failed: %v", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(detectorRestartDelay):
+		}
+	}
+}
+
+func (s *Server) detectorEvent(name string, ev plugin.Event) {
+	if _, ok := s.findCamera(ev.Camera); !ok {
+		log.Printf("Warning: Detector plugin %s reported an event for unknown camera %q", name, ev.Camera)
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	_, err := s.ingestEvent(camera.Event{
+		Camera:   ev.Camera,
+		Kind:     camera.NormalizeEventKind(ev.Kind),
+		Label:    ev.Label,
+		Source:   "plugin:" + name,
+		Time:     ev.Time,
+		Duration: ev.Duration,
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to record event from detector plugin %s: %v", name, err)
+	}
+}
@@ -0,0 +1,108 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/internal/i18n"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+)
+
+const maxGridColumns = 6
+
+// preferences returns the preferences of the user making the request. Users
+// are told apart as for live-view sessions; without a login, everyone shares
+// one set of preferences.
+func (s *Server) preferences(c *gin.Context) index.Preferences {
+	prefs, err := s.index.Preferences(s.viewerUser(c))
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return prefs
+}
+
+// orderCameras sorts cameras by the user's preferred order. Cameras missing
+// from it keep their config order after the ordered ones.
+func orderCameras(cameras []config.CameraConfig, order []string) []config.CameraConfig {
+	if len(order) == 0 {
+		return cameras
+	}
+	rank := func(name string) int {
+		if i := slices.Index(order, name); i != -1 {
+			return i
+		}
+		return len(order)
+	}
+	slices.SortStableFunc(cameras, func(a, b config.CameraConfig) int {
+		return rank(a.Name) - rank(b.Name)
+	})
+	return cameras
+}
+
+func (s *Server) handlePreferencesGet(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"user":        s.viewerUser(c),
+		"preferences": s.preferences(c),
+		"languages":   i18n.Supported(),
+	})
+}
+
+// handlePreferencesUpdate changes the fields given in the body, leaving the
+// others as they were.
+func (s *Server) handlePreferencesUpdate(c *gin.Context) {
+	user := s.viewerUser(c)
+	prefs, err := s.index.Preferences(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<10))
+	if err == nil {
+		err = json.Unmarshal(body, &prefs)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch prefs.Theme {
+	case index.ThemeDark, index.ThemeLight, index.ThemeSystem:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "theme must be dark, light or system")})
+		return
+	}
+	if prefs.GridColumns < 0 || prefs.GridColumns > maxGridColumns {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "grid_columns must be between 0 (automatic) and %d", maxGridColumns)})
+		return
+	}
+	if prefs.Language != "" {
+		if _, ok := i18n.Lookup(prefs.Language); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "unsupported language %q", prefs.Language)})
+			return
+		}
+	}
+	if prefs.CameraOrder == nil {
+		prefs.CameraOrder = []string{}
+	}
+	if prefs.RecordingsCamera != "" {
+		if _, ok := s.findCamera(prefs.RecordingsCamera); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "Camera not found")})
+			return
+		}
+	}
+
+	if err := s.index.SetPreferences(user, prefs, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user, "preferences": prefs})
+}
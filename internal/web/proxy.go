@@ -0,0 +1,91 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	corsAllowMethods  = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowHeaders  = "Content-Type, Authorization, X-API-Key, X-Event-Token, Range, If-Range, If-None-Match"
+	corsExposeHeaders = "Content-Disposition, Content-Range, ETag, X-Checksum-SHA256, X-Request-ID"
+)
+
+// url prefixes an absolute path with server.base_path for links handed to
+// browsers and API clients.
+func (s *Server) url(path string) string {
+	return s.basePath + path
+}
+
+// Handler serves the router under server.base_path. Requests are accepted
+// both with the prefix (proxies that forward the full path) and without it
+// (proxies that strip it), while every generated URL carries the prefix.
+func (s *Server) Handler() http.Handler {
+	if s.basePath == "" {
+		return s.Router
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == s.basePath {
+			http.Redirect(w, r, s.basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+		if rest, ok := strings.CutPrefix(r.URL.Path, s.basePath+"/"); ok {
+			r.URL.Path = "/" + rest
+			if r.URL.RawPath != "" {
+				r.URL.RawPath = "/" + strings.TrimPrefix(r.URL.RawPath, s.basePath+"/")
+			}
+		}
+		// gin prepends this to its trailing-slash redirects.
+		r.Header.Set("X-Forwarded-Prefix", s.basePath)
+		s.Router.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) corsMiddleware() gin.HandlerFunc {
+	cfg := s.config.Server.CORS
+	allowAll := false
+	allowed := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || (!allowAll && !allowed[origin]) {
+			c.Next()
+			return
+		}
+
+		// A wildcard cannot be combined with credentials, so the origin is
+		// echoed back instead.
+		if allowAll && !cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		c.Header("Access-Control-Expose-Headers", corsExposeHeaders)
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", corsAllowMethods)
+			c.Header("Access-Control-Allow-Headers", corsAllowHeaders)
+			if cfg.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
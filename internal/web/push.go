@@ -0,0 +1,100 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/internal/notify"
+)
+
+type pushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+func (s *Server) webPush() (*notify.WebPush, bool) {
+	n, ok := s.notifier.Notifier("webpush")
+	if !ok {
+		return nil, false
+	}
+	push, ok := n.(*notify.WebPush)
+	return push, ok
+}
+
+func (s *Server) handlePushKey(c *gin.Context) {
+	push, ok := s.webPush()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Push notifications are disabled")})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"public_key": push.PublicKey()})
+}
+
+func (s *Server) handlePushSubscribe(c *gin.Context) {
+	push, ok := s.webPush()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Push notifications are disabled")})
+		return
+	}
+
+	var req pushSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := push.Subscribe(index.PushSubscription{
+		Endpoint: req.Endpoint,
+		P256dh:   req.Keys.P256dh,
+		Auth:     req.Keys.Auth,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Subscribed")})
+}
+
+func (s *Server) handlePushUnsubscribe(c *gin.Context) {
+	push, ok := s.webPush()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Push notifications are disabled")})
+		return
+	}
+
+	var req pushSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := push.Unsubscribe(req.Endpoint); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Unsubscribed")})
+}
+
+func (s *Server) handlePushTest(c *gin.Context) {
+	if _, ok := s.webPush(); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Push notifications are disabled")})
+		return
+	}
+
+	s.notifier.Send(notify.Notification{
+		Kind:  notify.KindTest,
+		Title: "Camera Recorder",
+		Body:  "Notifications are working",
+		URL:   "/",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Test notification sent")})
+}
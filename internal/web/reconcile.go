@@ -0,0 +1,52 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/reconcile"
+)
+
+// SetReconciler gives the server the reconciler, to report on and start
+// reconciliations of the index with the disk.
+func (s *Server) SetReconciler(m *reconcile.Manager) {
+	s.reconciler = m
+}
+
+// handleReconcile returns the reconciliation settings, the last run's report
+// and the removals waiting to be retried.
+func (s *Server) handleReconcile(c *gin.Context) {
+	if s.reconciler == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Reconciliation is not available")})
+		return
+	}
+	deletes, err := s.index.FailedDeletes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	cfg := s.reconciler.Config()
+	c.JSON(http.StatusOK, gin.H{
+		"interval":       cfg.Interval.String(),
+		"orphans":        cfg.Orphans,
+		"running":        s.reconciler.Running(),
+		"last":           s.reconciler.LastReport(),
+		"failed_deletes": deletes,
+	})
+}
+
+// handleReconcileRun starts a reconciliation now in the background; poll
+// /api/reconcile for the report.
+func (s *Server) handleReconcileRun(c *gin.Context) {
+	if s.reconciler == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Reconciliation is not available")})
+		return
+	}
+	if s.reconciler.Running() {
+		c.JSON(http.StatusConflict, gin.H{"error": s.tr(c, "A reconciliation is already running")})
+		return
+	}
+	go s.reconciler.Run(s.appContext())
+	c.JSON(http.StatusAccepted, gin.H{"message": s.tr(c, "Reconciliation started")})
+}
@@ -0,0 +1,125 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+)
+
+const (
+	// Comments sent this often keep proxies from closing an idle stream.
+	recordingFeedKeepalive = 30 * time.Second
+	// Segments a slow subscriber may fall behind by before missing some.
+	recordingFeedBuffer = 32
+)
+
+// recordingFeed fans finished segments out to the clients of
+// /api/recordings/stream.
+type recordingFeed struct {
+	mu   sync.Mutex
+	subs map[chan index.Segment]struct{}
+}
+
+func newRecordingFeed() *recordingFeed {
+	return &recordingFeed{subs: make(map[chan index.Segment]struct{})}
+}
+
+func (f *recordingFeed) subscribe() chan index.Segment {
+	ch := make(chan index.Segment, recordingFeedBuffer)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+	return ch
+}
+
+func (f *recordingFeed) unsubscribe(ch chan index.Segment) {
+	f.mu.Lock()
+	delete(f.subs, ch)
+	f.mu.Unlock()
+}
+
+func (f *recordingFeed) publish(seg index.Segment) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case ch <- seg:
+		default:
+		}
+	}
+}
+
+// SegmentFinished tells the clients of /api/recordings/stream about a
+// segment that was just written and indexed.
+func (s *Server) SegmentFinished(seg index.Segment) {
+	s.feed.publish(seg)
+}
+
+func (s *Server) recordingEvent(seg index.Segment) gin.H {
+	camera, filename := url.PathEscape(seg.Camera), url.PathEscape(seg.Filename)
+	return gin.H{
+		"camera":           seg.Camera,
+		"filename":         seg.Filename,
+		"started_at":       seg.StartedAt,
+		"ended_at":         seg.EndedAt,
+		"duration_seconds": seg.Duration().Seconds(),
+		"size":             seg.Size,
+		"quality":          seg.Quality,
+		"instance":         seg.Instance,
+		"site":             seg.Site,
+		"download_url":     s.url("/dl/" + camera + "/" + filename),
+		"play_url":         s.url("/play/" + camera + "/" + filename),
+		"thumbnail_url":    s.thumbnailURL(seg, 0),
+	}
+}
+
+// handleRecordingsStream sends a "recording" Server-Sent Event for every
+// segment that finishes from now on, optionally for one camera only.
+func (s *Server) handleRecordingsStream(c *gin.Context) {
+	cameraName := c.Query("camera")
+	if cameraName != "" {
+		if _, ok := s.findCamera(cameraName); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
+			return
+		}
+	}
+
+	serverCtx := s.appContext()
+
+	ch := s.feed.subscribe()
+	defer s.feed.unsubscribe(ch)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(recordingFeedKeepalive)
+	defer keepalive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-serverCtx.Done():
+			return false
+		case <-keepalive.C:
+			_, err := fmt.Fprint(w, ": keepalive\n\n")
+			return err == nil
+		case seg := <-ch:
+			if cameraName == "" || seg.Camera == cameraName {
+				c.SSEvent("recording", s.recordingEvent(seg))
+			}
+			return true
+		}
+	})
+}
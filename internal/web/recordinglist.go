@@ -0,0 +1,97 @@
+package web
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// recordingsPageSize is how many recordings the recordings page shows at
+// first, and loads each time it is scrolled to the end.
+const recordingsPageSize = 50
+
+// recordingItem is a recording in the recordings list and API, with its
+// thumbnail and, for indexed segments, its length.
+type recordingItem struct {
+	storage.FileInfo
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	ThumbnailURL    string  `json:"thumbnail_url"`
+}
+
+// DurationText formats the length as m:ss, or h:mm:ss for an hour or more.
+func (r recordingItem) DurationText() string {
+	d := time.Duration(r.DurationSeconds * float64(time.Second)).Round(time.Second)
+	h, m, sec := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, sec)
+	}
+	return fmt.Sprintf("%d:%02d", m, sec)
+}
+
+func (s *Server) recordingItems(files []storage.FileInfo) []recordingItem {
+	s.applySegmentTimes(files)
+
+	items := make([]recordingItem, len(files))
+	for i, f := range files {
+		items[i] = recordingItem{
+			FileInfo:     f,
+			ThumbnailURL: s.thumbnailURL(index.Segment{Camera: f.CameraName, Filename: f.Name}, 0),
+		}
+		if !f.StartedAt.IsZero() && f.EndedAt.After(f.StartedAt) {
+			items[i].DurationSeconds = f.EndedAt.Sub(f.StartedAt).Seconds()
+		}
+	}
+	return items
+}
+
+// fileCursor marks where a page of recordings ended: the time and path of
+// its last file, in the newest-first order storage lists them in.
+type fileCursor struct {
+	at   time.Time
+	path string
+}
+
+func (c fileCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.at.UnixNano(), 10) + "/" + c.path))
+}
+
+// parseCursor reads the cursor query parameter; nil means the first page.
+func parseCursor(value string) (*fileCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	nanos, path, ok := strings.Cut(string(raw), "/")
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if !ok || err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &fileCursor{at: time.Unix(0, n), path: path}, nil
+}
+
+// pageFiles returns up to limit files after the cursor, and the cursor of
+// the next page, empty after the last. A limit of 0 returns all of them.
+func pageFiles(files []storage.FileInfo, after *fileCursor, limit int) ([]storage.FileInfo, string) {
+	if after != nil {
+		files = files[sort.Search(len(files), func(i int) bool {
+			if c := files[i].CreatedAt.Compare(after.at); c != 0 {
+				return c < 0
+			}
+			return files[i].Path > after.path
+		}):]
+	}
+	if limit <= 0 || len(files) <= limit {
+		return files, ""
+	}
+	last := files[limit-1]
+	return files[:limit], fileCursor{at: last.CreatedAt, path: last.Path}.String()
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const defaultReplaySeconds = 60
+
+func (s *Server) replayTargets() []recorder.ReplayTarget {
+	var targets []recorder.ReplayTarget
+	for _, cam := range s.cameras() {
+		if cam.Enabled {
+			targets = append(targets, recorder.ReplayTarget{Name: cam.Name, URL: s.streamURL(cam)})
+		}
+	}
+	return targets
+}
+
+// handleReplay returns the camera's last ?seconds= of footage as an MP4, cut
+// from the replay buffer.
+func (s *Server) handleReplay(c *gin.Context) {
+	if s.replay == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "The replay buffer is disabled")})
+		return
+	}
+
+	cam, ok := s.findCamera(c.Param("camera"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
+		return
+	}
+
+	maxSeconds := int(s.replay.Length().Seconds())
+	seconds := defaultReplaySeconds
+	if value := c.Query("seconds"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSeconds {
+			c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "seconds must be between 1 and %d", maxSeconds)})
+			return
+		}
+		seconds = n
+	}
+	seconds = min(seconds, maxSeconds)
+
+	dir, err := os.MkdirTemp("", "cam-replay-")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	filename := fmt.Sprintf("%s_replay_%s.mp4", storage.CameraDirName(cam.Name), now.Format("20060102_150405"))
+	clip := filepath.Join(dir, filename)
+	if err := s.replay.Clip(c.Request.Context(), cam.Name, time.Duration(seconds)*time.Second, clip); err != nil {
+		log.Printf("Warning: [%s] Replay failed: %v", cam.Name, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": s.tr(c, "Replay unavailable: %v", err)})
+		return
+	}
+
+	c.FileAttachment(clip, filename)
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/report"
+)
+
+// SetReports gives the server the report manager, to preview reports and
+// send one on demand.
+func (s *Server) SetReports(m *report.Manager) {
+	s.reports = m
+}
+
+// reportPeriod reads the period query parameter, defaulting to the
+// configured one.
+func (s *Server) reportPeriod(c *gin.Context) (string, bool) {
+	s.cfgMu.RLock()
+	period := s.config.Notifications.Reports.Period
+	s.cfgMu.RUnlock()
+
+	switch p := c.DefaultQuery("period", period); p {
+	case "", report.PeriodDaily:
+		return report.PeriodDaily, true
+	case report.PeriodWeekly:
+		return p, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "period must be daily or weekly")})
+	return "", false
+}
+
+// handleReport builds the report the schedule would send now, without
+// sending it.
+func (s *Server) handleReport(c *gin.Context) {
+	if s.reports == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Reports are not available")})
+		return
+	}
+	period, ok := s.reportPeriod(c)
+	if !ok {
+		return
+	}
+	r, err := s.reports.Build(period, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"report": r,
+		"title":  r.Title(),
+		"text":   r.Text(),
+	})
+}
+
+// handleReportSend sends the report to the report channels now.
+func (s *Server) handleReportSend(c *gin.Context) {
+	if s.reports == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Reports are not available")})
+		return
+	}
+	period, ok := s.reportPeriod(c)
+	if !ok {
+		return
+	}
+	if err := s.reports.Send(period, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": s.tr(c, "Report sent")})
+}
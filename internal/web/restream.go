@@ -0,0 +1,17 @@
+package web
+
+import (
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+)
+
+// restreamTargets lists the enabled cameras, read through the shared ingest
+// when it is on, for the RTSP restream server.
+func (s *Server) restreamTargets() []recorder.RestreamTarget {
+	var targets []recorder.RestreamTarget
+	for _, cam := range s.cameras() {
+		if cam.Enabled {
+			targets = append(targets, recorder.RestreamTarget{Name: cam.Name, URL: s.streamURL(cam)})
+		}
+	}
+	return targets
+}
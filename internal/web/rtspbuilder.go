@@ -0,0 +1,255 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/pkg/camera"
+)
+
+const (
+	// How long a path is given to deliver its first frame.
+	rtspTestTimeout = 10 * time.Second
+	// Paths tested at once, so a camera is not flooded with connections.
+	rtspTestParallel = 4
+	maxRTSPTestPaths = 24
+	// How long a camera is given to say what it is.
+	rtspDetectTimeout = 5 * time.Second
+)
+
+func (s *Server) handleCameraBuilderPage(c *gin.Context) {
+	s.html(c, http.StatusOK, "addcamera.html", gin.H{
+		"pageTitle": s.tr(c, "Add Camera"),
+		"vendors":   s.rtspPaths.Paths(),
+	})
+}
+
+// handleRTSPPaths lists the known vendor path templates, or with manufacturer
+// and model those of one camera, model-specific first.
+func (s *Server) handleRTSPPaths(c *gin.Context) {
+	manufacturer := c.Query("manufacturer")
+	if manufacturer == "" {
+		c.JSON(http.StatusOK, gin.H{"paths": s.rtspPaths.Paths()})
+		return
+	}
+	paths := s.rtspPaths.Lookup(manufacturer, c.Query("model"))
+	if paths == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "unknown camera vendor %s", manufacturer)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"paths": paths})
+}
+
+type rtspTestRequest struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Paths    []string `json:"paths"`
+	// Channel fills in the {channel} of path templates; 1 when unset.
+	Channel int `json:"channel"`
+}
+
+type rtspTestResult struct {
+	Path   string   `json:"path"`
+	URL    string   `json:"url"`
+	OK     bool     `json:"ok"`
+	Error  string   `json:"error,omitempty"`
+	Codecs []string `json:"codecs,omitempty"`
+}
+
+// handleRTSPTest builds the RTSP URL of each path on the camera and tries to
+// read a frame from it, a few paths at a time.
+func (s *Server) handleRTSPTest(c *gin.Context) {
+	var req rtspTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.checkRTSPAddress(c, &req.Host, &req.Port) {
+		return
+	}
+	if req.Channel < 0 || req.Channel > 256 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "channel must be between 1 and 256")})
+		return
+	}
+	if len(req.Paths) == 0 || len(req.Paths) > maxRTSPTestPaths {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "give between 1 and %d paths", maxRTSPTestPaths)})
+		return
+	}
+
+	results := make([]rtspTestResult, len(req.Paths))
+	sem := make(chan struct{}, rtspTestParallel)
+	var wg sync.WaitGroup
+	for i, path := range req.Paths {
+		path = camera.ExpandPath(strings.TrimSpace(path), req.Channel)
+		results[i] = rtspTestResult{
+			Path: path,
+			URL:  camera.BuildRTSPURL(req.Host, req.Port, req.Username, req.Password, path),
+		}
+		wg.Add(1)
+		go func(r *rtspTestResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := camera.New("", r.URL).TestConnection(rtspTestTimeout); err != nil {
+				r.Error = rtspProblem(err)
+				return
+			}
+			r.OK = true
+			if info, err := camera.GetStreamInfo(r.URL, rtspTestTimeout); err == nil {
+				r.Codecs = info.Codecs
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	for i := range results {
+		if results[i].Error != "" {
+			results[i].Error = s.tr(c, results[i].Error)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// checkRTSPAddress checks the camera address of a builder request, defaulting
+// the port to 554, and answers 400 when it is not usable.
+func (s *Server) checkRTSPAddress(c *gin.Context, host *string, port *int) bool {
+	*host = strings.TrimSpace(*host)
+	if *host == "" || strings.ContainsAny(*host, "/@?#[] ") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "host must be an IP address or host name")})
+		return false
+	}
+	if *port == 0 {
+		*port = 554
+	}
+	if *port < 1 || *port > 65535 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "port must be between 1 and 65535")})
+		return false
+	}
+	return true
+}
+
+type rtspDetectRequest struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	ONVIFURL string `json:"onvif_url"`
+}
+
+// handleRTSPDetect asks a camera what it is, over ONVIF or from its web
+// interface, and returns the paths its vendor and model serve streams on.
+func (s *Server) handleRTSPDetect(c *gin.Context) {
+	var req rtspDetectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.checkRTSPAddress(c, &req.Host, &req.Port) {
+		return
+	}
+
+	info, err := camera.IdentifyDevice(c.Request.Context(), camera.ClockTarget{
+		Name:     req.Host,
+		RTSPURL:  camera.BuildRTSPURL(req.Host, req.Port, req.Username, req.Password, "/"),
+		ONVIFURL: strings.TrimSpace(req.ONVIFURL),
+	}, rtspDetectTimeout)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": s.tr(c, "camera could not be identified: %v", err)})
+		return
+	}
+
+	vendor, _ := s.rtspPaths.Match(info.Manufacturer)
+	c.JSON(http.StatusOK, gin.H{
+		"manufacturer": info.Manufacturer,
+		"model":        info.Model,
+		"firmware":     info.Firmware,
+		"source":       info.Source,
+		"vendor":       vendor,
+		"paths":        s.rtspPaths.Lookup(info.Manufacturer, info.Model),
+	})
+}
+
+// rtspProblem sums up why FFmpeg could not read a stream, from its output.
+func rtspProblem(err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "timeout"):
+		return "no answer from the camera"
+	case strings.Contains(msg, "401") || strings.Contains(msg, "unauthorized"):
+		return "wrong username or password"
+	case strings.Contains(msg, "404") || strings.Contains(msg, "not found"):
+		return "no stream on this path"
+	case strings.Contains(msg, "connection refused"):
+		return "connection refused"
+	case strings.Contains(msg, "no route to host") || strings.Contains(msg, "network is unreachable"):
+		return "camera unreachable"
+	default:
+		return "stream could not be read"
+	}
+}
+
+type cameraAddRequest struct {
+	Name        string            `json:"name"`
+	RTSPURL     string            `json:"rtsp_url"`
+	FailoverURL string            `json:"failover_url"`
+	Enabled     *bool             `json:"enabled"`
+	Tags        map[string]string `json:"tags"`
+}
+
+// handleCameraAdd adds one camera, starts it unless enabled is false and
+// saves it to the config file.
+func (s *Server) handleCameraAdd(c *gin.Context) {
+	var req cameraAddRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cam := config.CameraConfig{
+		Name:        strings.TrimSpace(req.Name),
+		RTSPURL:     strings.TrimSpace(req.RTSPURL),
+		FailoverURL: strings.TrimSpace(req.FailoverURL),
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		Tags:        req.Tags,
+	}
+
+	s.cfgMu.Lock()
+	previous := s.config.Cameras
+	if slices.ContainsFunc(previous, func(existing config.CameraConfig) bool { return existing.Name == cam.Name }) {
+		s.cfgMu.Unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": s.tr(c, "a camera named %s already exists", cam.Name)})
+		return
+	}
+	cameras := append(slices.Clone(previous), cam)
+	if err := config.ValidateCameras(cameras); err != nil {
+		s.cfgMu.Unlock()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.config.Cameras = cameras
+	saveErr := s.config.Save()
+	s.cfgMu.Unlock()
+
+	s.reconcileCameras(previous, cameras)
+
+	if saveErr != nil {
+		log.Printf("Warning: Failed to persist added camera %s: %v", cam.Name, saveErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s.tr(c, "camera added but not saved: %v", saveErr)})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": s.tr(c, "Camera added"),
+		"name":    cam.Name,
+	})
+}
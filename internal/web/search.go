@@ -0,0 +1,214 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	thumbnailWidth   = 320
+	thumbnailTimeout = 20 * time.Second
+	maxSearchClips   = 20
+)
+
+var searchAnd = regexp.MustCompile(`(?i)\s+and\s+`)
+
+type searchQuery struct {
+	Camera string `json:"camera,omitempty"`
+	Label  string `json:"label,omitempty"`
+	Kind   string `json:"kind,omitempty"`
+}
+
+// parseSearchQuery reads "camera=front AND label=person" style expressions.
+// Terms are field=value (or field:value) pairs joined by AND.
+func parseSearchQuery(expr string) (searchQuery, error) {
+	var q searchQuery
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return q, nil
+	}
+
+	for _, term := range searchAnd.Split(expr, -1) {
+		field, value, ok := strings.Cut(term, "=")
+		if !ok {
+			field, value, ok = strings.Cut(term, ":")
+		}
+		if !ok {
+			return q, fmt.Errorf("invalid search term %q: expected field=value", term)
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "camera":
+			q.Camera = value
+		case "label":
+			q.Label = value
+		case "kind":
+			q.Kind = value
+		default:
+			return q, fmt.Errorf("unknown search field %q (use camera, label or kind)", field)
+		}
+	}
+	return q, nil
+}
+
+// matchCameras resolves a search term to camera names: an exact name wins,
+// otherwise every camera containing the term, ignoring case.
+func (s *Server) matchCameras(term string) []string {
+	var matches []string
+	for _, cam := range s.cameras() {
+		if strings.EqualFold(cam.Name, term) {
+			return []string{cam.Name}
+		}
+		if strings.Contains(strings.ToLower(cam.Name), strings.ToLower(term)) {
+			matches = append(matches, cam.Name)
+		}
+	}
+	return matches
+}
+
+func (s *Server) handleSearch(c *gin.Context) {
+	q, err := parseSearchQuery(c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if v := c.Query("camera"); v != "" {
+		q.Camera = v
+	}
+	if v := c.Query("label"); v != "" {
+		q.Label = v
+	}
+	if v := c.Query("kind"); v != "" {
+		q.Kind = v
+	}
+
+	now := time.Now()
+	from, err := parseTimeParam(c, "from", now.Add(-7*24*time.Hour))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to", now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	results := []gin.H{}
+	response := gin.H{"query": q, "from": from, "to": to}
+
+	eventQuery := index.EventQuery{
+		Kind:  q.Kind,
+		Label: q.Label,
+		From:  from,
+		To:    to,
+		Limit: limit,
+	}
+	if q.Camera != "" {
+		eventQuery.Cameras = s.matchCameras(q.Camera)
+		if len(eventQuery.Cameras) == 0 {
+			response["results"] = results
+			response["count"] = 0
+			c.JSON(http.StatusOK, response)
+			return
+		}
+	}
+
+	events, err := s.index.FindEvents(eventQuery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, ev := range events {
+		segments, err := s.index.FindSegments(ev.Camera, ev.StartedAt, ev.EndedAt, maxSearchClips)
+		if err != nil {
+			log.Printf("Warning: Failed to find clips for event %d: %v", ev.ID, err)
+		}
+
+		clips := make([]gin.H, 0, len(segments))
+		for _, seg := range segments {
+			offset := max(ev.StartedAt.Sub(seg.StartedAt), 0).Seconds()
+			clip := s.segmentJSON(seg)
+			clip["offset_seconds"] = offset
+			clip["play_url"] = s.url(fmt.Sprintf("/play/%s/%s?t=%.1f", url.PathEscape(seg.Camera), url.PathEscape(seg.Filename), offset))
+			clip["thumbnail_url"] = s.thumbnailURL(seg, offset)
+			clips = append(clips, clip)
+		}
+
+		result := gin.H{
+			"event": ev,
+			"clips": clips,
+		}
+		if len(clips) > 0 {
+			result["thumbnail_url"] = clips[0]["thumbnail_url"]
+		}
+		results = append(results, result)
+	}
+
+	response["results"] = results
+	response["count"] = len(results)
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *Server) thumbnailURL(seg index.Segment, offset float64) string {
+	return s.url(fmt.Sprintf("/thumb/%s/%s?t=%.1f", url.PathEscape(seg.Camera), url.PathEscape(seg.Filename), offset))
+}
+
+func (s *Server) handleThumbnail(c *gin.Context) {
+	filePath, err := s.storage.GetFilePath(c.Param("camera"), c.Param("filename"))
+	if err != nil {
+		// The segment may have been removed as a static scene, keeping a still.
+		still := storage.StaticThumbnailPath(s.config.Recording.OutputDir, c.Param("camera"), c.Param("filename"))
+		if _, err := os.Stat(still); err == nil {
+			c.Header("Cache-Control", "private, max-age=86400")
+			c.File(still)
+			return
+		}
+		c.String(http.StatusNotFound, s.tr(c, "File not found"))
+		return
+	}
+
+	offset, err := strconv.ParseFloat(c.DefaultQuery("t", "0"), 64)
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), thumbnailTimeout)
+	defer cancel()
+
+	if !s.thumbnails.Acquire(ctx, nil) {
+		c.String(http.StatusServiceUnavailable, s.tr(c, "Thumbnail generation is busy"))
+		return
+	}
+	defer s.thumbnails.Release()
+
+	frame, err := recorder.Thumbnail(ctx, filePath, time.Duration(offset*float64(time.Second)), thumbnailWidth)
+	if err != nil {
+		c.String(http.StatusInternalServerError, s.tr(c, "Failed to generate thumbnail: %v", err))
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Data(http.StatusOK, "image/jpeg", frame)
+}
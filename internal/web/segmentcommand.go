@@ -0,0 +1,57 @@
+package web
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shellSafe matches arguments that need no quoting in a POSIX shell.
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// handleSegmentCommand returns the ffmpeg command line a recording was made
+// with, credentials redacted, and how ffmpeg exited, so a problem reported
+// with a recording can be reproduced.
+func (s *Server) handleSegmentCommand(c *gin.Context) {
+	cameraName := c.Param("camera")
+	filename := c.Param("filename")
+
+	filePath, err := s.storage.GetFilePath(cameraName, filename)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "File not found")})
+		return
+	}
+	command, ok, err := s.index.SegmentCommand(filePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "no ffmpeg command was recorded for this recording")})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"camera":       cameraName,
+		"filename":     filename,
+		"args":         command.Args,
+		"exit_code":    command.ExitCode,
+		"status":       command.Status,
+		"command_line": shellCommand("ffmpeg", command.Args),
+	})
+}
+
+// shellCommand joins a program and its arguments into a line that can be
+// pasted into a shell.
+func shellCommand(name string, args []string) string {
+	quoted := []string{name}
+	for _, arg := range args {
+		if !shellSafe.MatchString(arg) {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
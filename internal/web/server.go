@@ -3,37 +3,153 @@ package web
 import (
 	"context"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"path/filepath"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/lets-vibe/cam-recorder/internal/auth"
+	"github.com/lets-vibe/cam-recorder/internal/capture"
 	"github.com/lets-vibe/cam-recorder/internal/config"
-	"github.com/lets-vibe/cam-recorder/internal/recorder"
-	"github.com/lets-vibe/cam-recorder/internal/storage"
+	"github.com/lets-vibe/cam-recorder/internal/failover"
+	"github.com/lets-vibe/cam-recorder/internal/i18n"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/internal/integrity"
+	"github.com/lets-vibe/cam-recorder/internal/leakcheck"
+	"github.com/lets-vibe/cam-recorder/internal/notify"
+	"github.com/lets-vibe/cam-recorder/internal/reconcile"
+	"github.com/lets-vibe/cam-recorder/internal/report"
+	"github.com/lets-vibe/cam-recorder/internal/tags"
+	"github.com/lets-vibe/cam-recorder/internal/tiering"
+	"github.com/lets-vibe/cam-recorder/internal/timelapse"
+	"github.com/lets-vibe/cam-recorder/pkg/camera"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
 )
 
 type Server struct {
 	config     *config.Config
+	cfgMu      sync.RWMutex
+	ctx        context.Context
 	recorder   *recorder.RecorderManager
 	storage    *storage.Manager
+	index      *index.Index
+	notifier   *notify.Dispatcher
 	mjpeg      *recorder.MJPEGManager
-	Router     *gin.Engine
-	httpServer *http.Server
+	hls        *recorder.HLSManager
+	replay     *recorder.ReplayBuffer
+	restream   *recorder.RestreamServer
+	forwarder  *recorder.Forwarder
+	leaks      *leakcheck.Detector
+	timelapse  *timelapse.Manager
+	thumbnails *recorder.Limiter
+	guard      *guard
+	access     accessRules
+	viewers    *viewerTracker
+	feed       *recordingFeed
+	detectors  []detectorPlugin
+	ingest     *recorder.IngestManager
+	failover   *failover.Manager
+	oidc       *auth.Provider
+	trusted    []netip.Prefix
+	clock      *camera.ClockMonitor
+	devices    *camera.DeviceMonitor
+	events     *camera.EventSubscriber
+	audio      *camera.AudioMonitor
+	motion     *camera.MotionMonitor
+	rtspPaths  *camera.PathDB
+	syncer     *storage.Syncer
+	reports    *report.Manager
+	integrity  *integrity.Manager
+	reconciler *reconcile.Manager
+	tiers      *tiering.Manager
+	capture    *capture.Manager
+	openEvents map[string]openEvent
+	eventsMu   sync.Mutex
+	// frigateObjects maps the Frigate objects being tracked to their events.
+	frigateObjects map[string]frigateObject
+	frigateMu      sync.Mutex
+	Router         *gin.Engine
+	httpServer     *http.Server
+	conns          atomic.Int64
+	version        string
+	basePath       string
+
+	shareMu       sync.Mutex
+	shareSecret   []byte
+	sessionMu     sync.Mutex
+	sessionSecret []byte
+	stampMu       sync.Mutex
+	stampJobs     map[string]*stampJob
+	benchmarkMu   sync.Mutex
+	importMu      sync.Mutex
+	importJob     *importJob
 }
 
-func NewServer(cfg *config.Config, rec *recorder.RecorderManager, store *storage.Manager) *Server {
+func NewServer(cfg *config.Config, rec *recorder.RecorderManager, store *storage.Manager, idx *index.Index, notifier *notify.Dispatcher) *Server {
 	s := &Server{
-		config:   cfg,
-		recorder: rec,
-		storage:  store,
-		mjpeg:    recorder.NewMJPEGManager(),
+		config:         cfg,
+		recorder:       rec,
+		storage:        store,
+		index:          idx,
+		notifier:       notifier,
+		mjpeg:          recorder.NewMJPEGManager(),
+		hls:            recorder.NewHLSManager(),
+		thumbnails:     recorder.NewLimiter(2),
+		guard:          newGuard(cfg.Security),
+		access:         newAccessRules(cfg.Server),
+		viewers:        newViewerTracker(),
+		feed:           newRecordingFeed(),
+		openEvents:     make(map[string]openEvent),
+		frigateObjects: make(map[string]frigateObject),
+		stampJobs:      make(map[string]*stampJob),
+		ctx:            context.Background(),
+		basePath:       cfg.Server.BasePath,
+	}
+	s.mjpeg.SetLimits(rec.Limiter(), cfg.Limits.MaxPreviewsPerCamera)
+	s.mjpeg.SetHWAccel(cfg.Decode.Preview)
+	s.timelapse = timelapse.NewManager(&cfg.Timelapse, s.timelapseTargets)
+	if cfg.Replay.Buffer > 0 {
+		s.replay = recorder.NewReplayBuffer(cfg.Replay.Buffer, s.replayTargets)
+	}
+	if cfg.Debug.LeakCheckInterval > 0 {
+		s.leaks = leakcheck.NewDetector(cfg.Debug.LeakCheckInterval)
+	}
+	if cfg.Auth.OIDC.Enabled() {
+		s.oidc = auth.NewProvider(cfg.Auth.OIDC)
+	}
+	if cfg.Restream.Enabled {
+		s.restream = recorder.NewRestreamServer(cfg.Restream.Listen, cfg.Restream.Username, cfg.Restream.Password, s.restreamTargets)
+	}
+	s.forwarder = recorder.NewForwarder(filepath.Join(cfg.Recording.OutputDir, storage.ForwardDir), s.forwardTargets)
+	s.clock = camera.NewClockMonitor(cfg.Clock.CheckInterval, cfg.Clock.MaxDrift, cfg.Clock.Timeout, s.clockTargets)
+	s.devices = s.newDeviceMonitor()
+	s.events = camera.NewEventSubscriber(s.eventTargets, s.cameraEvent)
+	s.audio = camera.NewAudioMonitor(s.audioTargets, s.cameraEvent)
+	s.motion = camera.NewMotionMonitor(s.motionTargets, s.cameraEvent)
+	s.rtspPaths = camera.BuiltinPathDB()
+	if db, err := camera.LoadPathDB(cfg.Discovery.RTSPPaths); err != nil {
+		log.Printf("Warning: %v", err)
+	} else {
+		s.rtspPaths = db
 	}
 
 	gin.SetMode(gin.ReleaseMode)
 	s.Router = gin.New()
-	s.Router.Use(gin.Recovery())
+	if err := s.Router.SetTrustedProxies(cfg.Security.TrustedProxies); err != nil {
+		log.Printf("Warning: Invalid security.trusted_proxies: %v", err)
+	}
+	s.trusted, _ = config.ParseCIDRs(cfg.Security.TrustedProxies)
+	s.Router.Use(s.middleware(cfg.Server)...)
 
 	s.setupRoutes()
 
@@ -42,34 +158,185 @@ func NewServer(cfg *config.Config, rec *recorder.RecorderManager, store *storage
 
 func (s *Server) setupRoutes() {
 	s.Router.Static("/static", "./web/static")
-	s.Router.LoadHTMLGlob("./web/templates/*")
+	s.Router.StaticFile("/sw.js", "./web/static/sw.js")
+	s.loadTemplates("./web/templates/*")
 
 	s.Router.GET("/", s.handleIndex)
+	s.Router.GET("/login", s.handleLoginPage)
+	s.Router.GET("/auth/oidc", s.handleOIDCLogin)
+	s.Router.GET("/auth/oidc/callback", s.handleOIDCCallback)
+	s.Router.POST("/auth/login", s.handleLDAPLogin)
+	s.Router.POST("/auth/logout", s.handleLogout)
+	s.Router.GET("/api/auth/me", s.handleWhoAmI)
 	s.Router.GET("/camera/:name", s.handleCameraDetail)
 	s.Router.GET("/live/:name", s.handleLiveStream)
+	s.Router.GET("/live/:name/hls/:file", s.handleLiveHLS)
+	s.Router.GET("/snapshot/:name", s.handleSnapshot)
 	s.Router.GET("/recordings", s.handleRecordingsAPI)
 	s.Router.GET("/recordings/list", s.handleRecordingsPage)
 	s.Router.GET("/dl/:camera/:filename", s.handleDownload)
+	s.Router.HEAD("/dl/:camera/:filename", s.handleDownload)
 	s.Router.GET("/play/:camera/:filename", s.handlePlay)
+	s.Router.GET("/video/:camera/:filename", s.handleVideo)
+	s.Router.GET("/scrub/:camera/:filename", s.handleScrub)
+	s.Router.GET("/thumb/:camera/:filename", s.handleThumbnail)
+	s.Router.GET("/captures/:camera/:filename", s.handleCaptureFile)
+	s.Router.GET("/timelapse", s.handleTimelapsePage)
+	s.Router.GET("/timelapse/:camera/:filename", s.handleTimelapseDownload)
+	s.Router.GET("/api/timelapse", s.handleTimelapseAPI)
+	s.Router.GET("/events", s.handleEventsPage)
+	s.Router.GET("/stats", s.handleStatsPage)
+	s.Router.GET("/map", s.handleMapPage)
+	s.Router.GET("/map/floorplan", s.handleFloorPlan)
+	s.Router.PUT("/api/map/floorplan", s.handleFloorPlanUpload)
+	s.Router.DELETE("/api/map/floorplan", s.handleFloorPlanDelete)
+	s.Router.GET("/api/stats/:camera", s.handleCameraStats)
+	s.Router.GET("/api/preferences", s.handlePreferencesGet)
+	s.Router.PUT("/api/preferences", s.handlePreferencesUpdate)
 	s.Router.DELETE("/recordings/:camera/:filename", s.handleDelete)
 	s.Router.GET("/api/status", s.handleStatus)
+	s.Router.GET("/metrics", s.handleMetrics)
 	s.Router.GET("/api/status/:name", s.handleCameraStatus)
+	s.Router.GET("/api/status/:name/history", s.handleCameraHistory)
+	s.Router.GET("/api/devices", s.handleDevices)
 	s.Router.GET("/api/storage", s.handleStorageStats)
+	s.Router.GET("/api/failover", s.handleFailover)
+	s.Router.POST("/api/storage/benchmark", s.handleStorageBenchmark)
+	s.Router.GET("/api/recordings/timeline", s.handleTimeline)
+	s.Router.GET("/api/recordings/stream", s.handleRecordingsStream)
+	s.Router.GET("/api/recordings/stills", s.handleStills)
+	s.Router.GET("/api/recordings/:camera/:filename/command", s.handleSegmentCommand)
+	// Imports read, and with move remove, files anywhere the server can.
+	s.Router.GET("/api/recordings/ingest", s.requireAPIKey(), s.handleRecordingsIngestStatus)
+	s.Router.POST("/api/recordings/ingest", s.requireAPIKey(), s.handleRecordingsIngest)
+	s.Router.GET("/api/playback", s.handlePlayback)
+	s.Router.GET("/api/replay/:camera", s.handleReplay)
+	s.Router.GET("/api/events", s.handleEvents)
+	s.Router.GET("/api/search", s.handleSearch)
+	s.Router.GET("/api/audit", s.handleAudit)
+	s.Router.GET("/api/viewers", s.handleViewers)
+	s.Router.GET("/api/export", s.handleExport)
+	s.Router.GET("/api/export/key", s.handleExportKey)
+	s.Router.POST("/api/share", s.handleShareCreate)
+	s.Router.GET("/api/share", s.handleShareList)
+	s.Router.DELETE("/api/share/:id", s.handleShareRevoke)
+	s.Router.GET("/api/watermark", s.handleWatermarkGet)
+	s.Router.PUT("/api/watermark/logo", s.handleWatermarkLogoUpload)
+	s.Router.DELETE("/api/watermark/logo", s.handleWatermarkLogoDelete)
+	s.Router.GET("/s/:id", s.handleSharePage)
+	s.Router.GET("/s/:id/media", s.handleShareMedia)
+	s.Router.GET("/kiosk", s.handleKioskPage)
+	s.Router.GET("/kiosk/live/:name", s.handleKioskStream)
+	s.Router.POST("/api/cameras/:name/events", s.handleCameraEventPush)
+	s.Router.GET("/api/cameras/:name/events", s.handleCameraEventPush)
+	s.Router.POST("/api/integrations/frigate", s.handleFrigateWebhook)
+	s.Router.POST("/api/trigger", s.requireAPIKey(), s.handleTrigger)
+	s.Router.GET("/api/debug/runtime", s.requireAPIKey(), s.handleDebugRuntime)
+	s.Router.GET("/api/events.ics", s.handleEventsICS)
+	s.Router.GET("/api/schedule.ics", s.handleScheduleICS)
 	s.Router.POST("/api/camera/:name/start", s.handleCameraStart)
 	s.Router.POST("/api/camera/:name/stop", s.handleCameraStop)
+	s.Router.POST("/api/camera/:name/pause", s.handleCameraPause)
+	s.Router.POST("/api/camera/:name/resume", s.handleCameraResume)
+	s.Router.POST("/api/camera/:name/power-cycle", s.handleCameraPowerCycle)
+	s.Router.POST("/api/camera/:name/capture", s.handleCameraCapture)
+	s.Router.GET("/api/push/key", s.handlePushKey)
+	s.Router.POST("/api/push/subscribe", s.handlePushSubscribe)
+	s.Router.DELETE("/api/push/subscribe", s.handlePushUnsubscribe)
+	s.Router.POST("/api/push/test", s.handlePushTest)
+	s.Router.GET("/api/config/export", s.handleConfigExport)
+	s.Router.POST("/api/config/import", s.handleConfigImport)
+	s.Router.GET("/api/system", s.handleSystem)
+	s.Router.GET("/api/system/backup", s.handleBackup)
+	s.Router.POST("/api/system/restore", s.handleRestore)
+	s.Router.GET("/api/report", s.handleReport)
+	s.Router.POST("/api/report/send", s.handleReportSend)
+	s.Router.GET("/api/integrity", s.handleIntegrity)
+	s.Router.POST("/api/integrity/check", s.handleIntegrityCheck)
+	s.Router.GET("/api/reconcile", s.handleReconcile)
+	s.Router.POST("/api/reconcile/run", s.handleReconcileRun)
+	s.Router.POST("/api/cameras/import", s.handleCamerasImport)
+	s.Router.PATCH("/api/cameras/:name", s.handleCameraUpdate)
+	s.Router.POST("/api/cameras", s.handleCameraAdd)
+	s.Router.GET("/cameras/new", s.handleCameraBuilderPage)
+	s.Router.GET("/api/rtsp/paths", s.handleRTSPPaths)
+	s.Router.POST("/api/rtsp/test", s.handleRTSPTest)
+	s.Router.POST("/api/rtsp/detect", s.handleRTSPDetect)
+
+	if s.config.Debug.Pprof {
+		s.setupDebugRoutes()
+	}
+}
+
+// SetIngest makes video consumers read cameras through the shared ingest.
+func (s *Server) SetIngest(ingest *recorder.IngestManager) {
+	s.ingest = ingest
+}
+
+// SetTiering gives the server the tiering manager, to apply changes to the
+// cameras keeping keyframes.
+func (s *Server) SetTiering(tiers *tiering.Manager) {
+	s.tiers = tiers
+}
+
+// streamURL returns the URL to read cam's video from.
+func (s *Server) streamURL(cam config.CameraConfig) string {
+	return s.ingest.InputURL(cam.Name, cam.RTSPURL)
+}
+
+// appContext returns the context the server was started with. Recorders,
+// streamers and anything else outliving a request must derive from it, never
+// from the request's context, which ends with the response.
+func (s *Server) appContext() context.Context {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
 }
 
 func (s *Server) Start(ctx context.Context) error {
-	for _, cam := range s.config.Cameras {
+	s.cfgMu.Lock()
+	s.ctx = ctx
+	s.cfgMu.Unlock()
+
+	for _, cam := range s.cameras() {
 		if cam.Enabled {
-			go s.mjpeg.Start(ctx, cam.Name, cam.RTSPURL)
+			go s.mjpeg.Start(ctx, cam.Name, s.streamURL(cam))
+		}
+	}
+	s.hls.Start(ctx)
+	if s.replay != nil {
+		s.replay.Start(ctx)
+	}
+	if s.leaks != nil {
+		s.leaks.Start(ctx)
+	}
+	if s.restream != nil {
+		if err := s.restream.Start(ctx); err != nil {
+			return err
 		}
 	}
+	s.forwarder.Start(ctx)
+	s.timelapse.Start(ctx)
+	s.clock.Start(ctx)
+	s.devices.Start(ctx)
+	s.events.Start(ctx)
+	s.audio.Start(ctx)
+	s.motion.Start(ctx)
+	go s.pruneGuard(ctx)
+	go s.sweepViewers(ctx)
+	go s.sweepShareStamps(ctx)
+	for _, dp := range s.detectors {
+		go s.runDetector(ctx, dp)
+	}
 
 	addr := fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port)
 	s.httpServer = &http.Server{
-		Addr:    addr,
-		Handler: s.Router,
+		Addr:      addr,
+		Handler:   s.Handler(),
+		ConnState: s.trackConn,
 	}
 
 	errCh := make(chan error, 1)
@@ -85,12 +352,23 @@ func (s *Server) Start(ctx context.Context) error {
 		defer cancel()
 		s.httpServer.Shutdown(shutdownCtx)
 		s.mjpeg.StopAll()
+		s.hls.StopAll()
 		return nil
 	case err := <-errCh:
 		return err
 	}
 }
 
+// trackConn counts the open client connections for /metrics.
+func (s *Server) trackConn(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		s.conns.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		s.conns.Add(-1)
+	}
+}
+
 func (s *Server) Stop() {
 	if s.httpServer != nil {
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -98,90 +376,240 @@ func (s *Server) Stop() {
 		s.httpServer.Shutdown(shutdownCtx)
 	}
 	s.mjpeg.StopAll()
+	s.hls.StopAll()
 }
 
 func (s *Server) handleIndex(c *gin.Context) {
-	c.HTML(http.StatusOK, "index.html", gin.H{
-		"pageTitle": "Camera Recorder",
-		"cameras":   s.config.Cameras,
+	prefs := s.preferences(c)
+	sel, err := tagSelector(c)
+	if err != nil {
+		s.html(c, http.StatusBadRequest, "error.html", gin.H{"error": err.Error()})
+		return
+	}
+
+	cameras := s.cameras()
+	s.html(c, http.StatusOK, "index.html", gin.H{
+		"pageTitle": s.tr(c, "Camera Recorder"),
+		"cameras":   orderCameras(camerasTagged(cameras, sel), prefs.CameraOrder),
+		"languages": i18n.Supported(),
+		"tags":      cameraTagList(cameras),
+		"tagFilter": sel.String(),
 	})
 }
 
 func (s *Server) handleCameraDetail(c *gin.Context) {
 	cameraName := c.Param("name")
 
-	var camera *config.CameraConfig
-	for i := range s.config.Cameras {
-		if s.config.Cameras[i].Name == cameraName {
-			camera = &s.config.Cameras[i]
-			break
-		}
+	camera, ok := s.findCamera(cameraName)
+	if !ok {
+		s.html(c, http.StatusNotFound, "error.html", gin.H{"error": s.tr(c, "Camera not found")})
+		return
 	}
 
-	if camera == nil {
-		c.HTML(http.StatusNotFound, "error.html", gin.H{"error": "Camera not found"})
+	rec, _ := s.recorder.GetRecorder(cameraName)
+
+	files, err := s.storage.ListFiles(cameraName, "", 0)
+	if err != nil {
+		s.html(c, http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
 		return
 	}
+	s.applySegmentTimes(files)
+
+	// Days with recordings, newest first, for the date picker.
+	var days []recordingDay
+	dayIndex := make(map[string]int)
+	dayFiles := files[:0:0]
+	date := c.Query("date")
+	for _, f := range files {
+		day := recordingTime(f).Format(time.DateOnly)
+		i, ok := dayIndex[day]
+		if !ok {
+			i = len(days)
+			dayIndex[day] = i
+			days = append(days, recordingDay{Date: day})
+		}
+		days[i].Count++
+		if date == "" || day == date {
+			dayFiles = append(dayFiles, f)
+		}
+	}
 
-	rec, _ := s.recorder.GetRecorder(cameraName)
+	pages := max(1, (len(dayFiles)+cameraRecordingsPerPage-1)/cameraRecordingsPerPage)
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	page = min(page, pages)
+	start := (page - 1) * cameraRecordingsPerPage
+	end := min(start+cameraRecordingsPerPage, len(dayFiles))
+	nextPage := page + 1
+	if nextPage > pages {
+		nextPage = 0
+	}
 
-	c.HTML(http.StatusOK, "camera.html", gin.H{
-		"pageTitle": cameraName + " - Camera Recorder",
-		"camera":    camera,
-		"recorder":  rec,
+	device, _ := s.devices.Info(cameraName)
+
+	s.html(c, http.StatusOK, "camera.html", gin.H{
+		"pageTitle":  s.tr(c, "%s - Camera Recorder", cameraName),
+		"camera":     camera,
+		"recorder":   rec,
+		"recordings": dayFiles[start:end],
+		"days":       days,
+		"date":       date,
+		"page":       page,
+		"pages":      pages,
+		"prevPage":   page - 1,
+		"nextPage":   nextPage,
+		"replay":     s.replay != nil,
+		"device":     device,
 	})
 }
 
+const cameraRecordingsPerPage = 20
+
+type recordingDay struct {
+	Date  string
+	Count int
+}
+
+// recordingTime is when a recording started, falling back to the file's
+// modification time for files the index does not know.
+func recordingTime(f storage.FileInfo) time.Time {
+	if !f.StartedAt.IsZero() {
+		return f.StartedAt.Local()
+	}
+	return f.CreatedAt.Local()
+}
+
 func (s *Server) handleLiveStream(c *gin.Context) {
 	cameraName := c.Param("name")
 
-	c.Header("Content-Type", "multipart/x-mixed-replace; boundary=frame")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
+	quality, err := recorder.ParseQuality(c.Query("res"), c.Query("fps"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
 
-	flusher, ok := c.Writer.(http.Flusher)
-	if !ok {
-		c.String(http.StatusInternalServerError, "Streaming not supported")
+	s.streamMJPEG(c, cameraName, quality, s.viewerUser(c))
+}
+
+func (s *Server) streamMJPEG(c *gin.Context, cameraName string, quality recorder.Quality, user string) {
+	if _, ok := c.Writer.(http.Flusher); !ok {
+		c.String(http.StatusInternalServerError, s.tr(c, "Streaming not supported"))
+		return
+	}
+
+	cam, _ := s.findCamera(cameraName)
+	sess := s.newViewer(c, cameraName, user, viewerMJPEG)
+	viewer, refused := s.viewers.admit(sess, s.viewerLimits(cam), time.Now())
+	if viewer == nil {
+		s.refuseViewer(c, sess, refused)
+		return
+	}
+
+	streamKey, err := s.mjpeg.Acquire(cameraName, quality)
+	if err != nil {
+		s.viewers.end(viewer)
+		c.String(http.StatusNotFound, s.tr(c, "Camera not found"))
 		return
 	}
+	defer s.mjpeg.Release(streamKey)
 
-	cond, ok := s.mjpeg.GetCond(cameraName)
+	cond, ok := s.mjpeg.GetCond(streamKey)
 	if !ok {
-		c.String(http.StatusNotFound, "Camera not found")
+		s.viewers.end(viewer)
+		c.String(http.StatusNotFound, s.tr(c, "Camera not found"))
 		return
 	}
 
+	c.Header("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	defer func() {
+		s.viewers.end(viewer)
+		s.endViewing(viewer, time.Now())
+	}()
+
+	// The wait for a frame also wakes when the client leaves or the camera
+	// has been silent for idleTimeout, so neither pins this handler.
+	ctx := c.Request.Context()
+	writeTimeout, idleTimeout := s.liveTimeouts()
+	wake := func() {
+		cond.L.Lock()
+		cond.Broadcast()
+		cond.L.Unlock()
+	}
+	defer context.AfterFunc(ctx, wake)()
+	var idle *time.Timer
+	if idleTimeout > 0 {
+		idle = time.AfterFunc(idleTimeout, wake)
+		defer idle.Stop()
+	}
+	lastFrame := time.Now()
+	rc := http.NewResponseController(c.Writer)
+	// Deadlines outlive the request on a kept-alive connection.
+	defer rc.SetWriteDeadline(time.Time{})
+
+	done := func() bool {
+		return ctx.Err() != nil || (idle != nil && time.Since(lastFrame) >= idleTimeout)
+	}
+
 	for {
-		select {
-		case <-c.Request.Context().Done():
-			return
-		default:
-			cond.L.Lock()
-			cond.Wait()
-			frame, ok := s.mjpeg.GetFrame(cameraName)
+		cond.L.Lock()
+		if done() {
 			cond.L.Unlock()
+			return
+		}
+		cond.Wait()
+		frame, ok := s.mjpeg.GetFrame(streamKey)
+		cond.L.Unlock()
 
-			if !ok || len(frame) == 0 {
-				continue
-			}
+		if done() {
+			return
+		}
+		if !ok || len(frame) == 0 {
+			continue
+		}
 
-			_, err := fmt.Fprintf(c.Writer, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame))
-			if err != nil {
-				return
-			}
+		// A client that stopped reading fails the write instead of
+		// holding the frame forever.
+		rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+		_, err := fmt.Fprintf(c.Writer, "--frame\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", len(frame))
+		if err != nil {
+			return
+		}
 
-			if _, err := c.Writer.Write(frame); err != nil {
-				return
-			}
+		if _, err := c.Writer.Write(frame); err != nil {
+			return
+		}
 
-			_, err = fmt.Fprint(c.Writer, "\r\n")
-			if err != nil {
-				return
-			}
+		_, err = fmt.Fprint(c.Writer, "\r\n")
+		if err != nil {
+			return
+		}
 
-			flusher.Flush()
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		lastFrame = time.Now()
+		if idle != nil {
+			idle.Reset(idleTimeout)
 		}
+		viewer.bytes.Store(int64(c.Writer.Size()))
+		viewer.lastSeen.Store(lastFrame.UnixMilli())
+	}
+}
+
+func (s *Server) handleSnapshot(c *gin.Context) {
+	frame, ok := s.mjpeg.LatestFrame(c.Param("name"))
+	if !ok || len(frame) == 0 {
+		c.String(http.StatusNotFound, s.tr(c, "No snapshot available"))
+		return
 	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "image/jpeg", frame)
 }
 
 func (s *Server) handleRecordingsAPI(c *gin.Context) {
@@ -193,55 +621,98 @@ func (s *Server) handleRecordingsAPI(c *gin.Context) {
 	if err != nil {
 		limit = 100
 	}
+	sel, err := tagSelector(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	after, err := parseCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	files, err := s.storage.ListFiles(cameraName, filter, limit)
+	files, next, err := s.listFiles(cameraName, filter, sel, after, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"recordings": files,
+	resp := gin.H{
+		"recordings": s.recordingItems(files),
 		"count":      len(files),
-	})
+	}
+	if next != "" {
+		resp["next_cursor"] = next
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 func (s *Server) handleRecordingsPage(c *gin.Context) {
-	cameraName := c.Query("camera")
-	filter := c.Query("filter")
-	limitStr := c.DefaultQuery("limit", "100")
-
-	limit, err := strconv.Atoi(limitStr)
+	cameraName, hasCamera := c.GetQuery("camera")
+	filter, hasFilter := c.GetQuery("filter")
+	if !hasCamera && !hasFilter {
+		prefs := s.preferences(c)
+		cameraName, filter = prefs.RecordingsCamera, prefs.RecordingsFilter
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = recordingsPageSize
+	}
+	sel, err := tagSelector(c)
 	if err != nil {
-		limit = 100
+		s.html(c, http.StatusBadRequest, "error.html", gin.H{"error": err.Error()})
+		return
 	}
 
-	files, err := s.storage.ListFiles(cameraName, filter, limit)
+	// Only the first page is rendered; the page loads the rest from
+	// /recordings as it is scrolled.
+	files, next, err := s.listFiles(cameraName, filter, sel, nil, limit)
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
+		s.html(c, http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
 		return
 	}
 
-	c.HTML(http.StatusOK, "recordings.html", gin.H{
-		"pageTitle":   "Recordings",
-		"cameras":     s.config.Cameras,
-		"recordings":  files,
+	cameras := s.cameras()
+	s.html(c, http.StatusOK, "recordings.html", gin.H{
+		"pageTitle":   s.tr(c, "Recordings"),
+		"cameras":     camerasTagged(cameras, sel),
+		"recordings":  s.recordingItems(files),
+		"nextCursor":  next,
+		"pageSize":    limit,
 		"selectedCam": cameraName,
+		"filter":      filter,
+		"tags":        cameraTagList(cameras),
+		"tagFilter":   sel.String(),
 	})
 }
 
+// listFiles lists a page of the recordings of the camera, or of every camera
+// with the tags when cameraName is empty, and the cursor of the next page.
+func (s *Server) listFiles(cameraName, filter string, sel tags.Selector, after *fileCursor, limit int) ([]storage.FileInfo, string, error) {
+	files, err := s.storage.ListFiles(cameraName, filter, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(sel) > 0 {
+		files = filesOfCameras(files, camerasTagged(s.cameras(), sel), 0)
+	}
+	files, next := pageFiles(files, after, limit)
+	return files, next, nil
+}
+
 func (s *Server) handleDownload(c *gin.Context) {
 	cameraName := c.Param("camera")
 	filename := c.Param("filename")
 
 	filePath, err := s.storage.GetFilePath(cameraName, filename)
 	if err != nil {
-		c.String(http.StatusNotFound, "File not found")
+		c.String(http.StatusNotFound, s.tr(c, "File not found"))
 		return
 	}
 
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	c.File(filePath)
+	s.serveRecording(c, filePath)
 }
 
 func (s *Server) handlePlay(c *gin.Context) {
@@ -250,18 +721,41 @@ func (s *Server) handlePlay(c *gin.Context) {
 
 	_, err := s.storage.GetFilePath(cameraName, filename)
 	if err != nil {
-		c.String(http.StatusNotFound, "File not found")
+		c.String(http.StatusNotFound, s.tr(c, "File not found"))
 		return
 	}
 
-	c.HTML(http.StatusOK, "player.html", gin.H{
-		"pageTitle":  "Play Recording",
+	videoURL := s.url(fmt.Sprintf("/video/%s/%s", url.PathEscape(cameraName), url.PathEscape(filename)))
+	if offset, err := strconv.ParseFloat(c.Query("t"), 64); err == nil && offset > 0 {
+		videoURL += fmt.Sprintf("#t=%.1f", offset)
+	}
+
+	s.html(c, http.StatusOK, "player.html", gin.H{
+		"pageTitle":  s.tr(c, "Play Recording"),
 		"cameraName": cameraName,
 		"filename":   filename,
-		"videoUrl":   fmt.Sprintf("/dl/%s/%s", cameraName, filename),
+		"videoUrl":   videoURL,
+		"scrubUrl":   s.url(fmt.Sprintf("/scrub/%s/%s", url.PathEscape(cameraName), url.PathEscape(filename))),
+		"watermark":  s.watermark("").Enabled(),
 	})
 }
 
+func (s *Server) handleScrub(c *gin.Context) {
+	filePath, err := s.storage.GetFilePath(c.Param("camera"), c.Param("filename"))
+	if err != nil {
+		c.String(http.StatusNotFound, s.tr(c, "File not found"))
+		return
+	}
+
+	proxy, err := s.recorder.Scrub().Proxy(c.Request.Context(), filePath)
+	if err != nil {
+		c.String(http.StatusServiceUnavailable, s.tr(c, "Scrub proxy unavailable: %v", err))
+		return
+	}
+
+	c.File(proxy)
+}
+
 func (s *Server) handleDelete(c *gin.Context) {
 	cameraName := c.Param("camera")
 	filename := c.Param("filename")
@@ -271,7 +765,7 @@ func (s *Server) handleDelete(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "File deleted", "filename": filename})
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "File deleted"), "filename": filename})
 }
 
 func (s *Server) handleStatus(c *gin.Context) {
@@ -280,31 +774,87 @@ func (s *Server) handleStatus(c *gin.Context) {
 		"server_time": time.Now().Format(time.RFC3339),
 	}
 
+	sel, err := tagSelector(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	recorderStatus := s.recorder.GetStatus()
+	viewers := s.viewers.counts()
 	cameras := []gin.H{}
 
-	for _, cam := range s.config.Cameras {
+	for _, cam := range camerasTagged(s.cameras(), sel) {
 		recStatus, exists := recorderStatus[cam.Name]
 		camStatus := gin.H{
 			"name":      cam.Name,
 			"enabled":   cam.Enabled,
 			"connected": false,
 			"streaming": s.mjpeg.IsRunning(cam.Name),
+			"viewers":   viewers[cam.Name],
+		}
+		if s.restream != nil {
+			camStatus["restream_readers"] = s.restream.Readers(cam.Name)
+		}
+		if forwards := s.forwarder.Status(cam.Name); len(forwards) > 0 {
+			camStatus["forwards"] = forwards
+		}
+		if len(cam.Tags) > 0 {
+			camStatus["tags"] = cam.Tags
 		}
 
 		if exists {
 			camStatus["connected"] = recStatus.Running
 			camStatus["running"] = recStatus.Running
+			camStatus["paused"] = recStatus.Paused
+			camStatus["transcoding"] = recStatus.Transcoding
+			camStatus["state"] = recStatus.State
+			camStatus["state_since"] = recStatus.StateSince
 			camStatus["uptime"] = recStatus.Uptime
+			camStatus["uptime_seconds"] = recStatus.UptimeSeconds
+			if !recStatus.StartedAt.IsZero() {
+				camStatus["started_at"] = recStatus.StartedAt
+			}
+			if !recStatus.LastSegmentAt.IsZero() {
+				camStatus["last_segment_at"] = recStatus.LastSegmentAt
+			}
+			camStatus["resource_restarts"] = recStatus.Restarts
+			if recStatus.Usage != nil {
+				camStatus["cpu_percent"] = recStatus.Usage.CPUPercent
+				camStatus["rss_bytes"] = recStatus.Usage.RSSBytes
+			}
 			if recStatus.LastError != "" {
 				camStatus["last_error"] = recStatus.LastError
 			}
+			if recStatus.SharesStreamOf != "" {
+				camStatus["shares_stream_of"] = recStatus.SharesStreamOf
+			}
+			if recStatus.Retry != nil {
+				camStatus["retry"] = recStatus.Retry
+			}
+			if recStatus.Failover != nil {
+				camStatus["failover"] = recStatus.Failover
+			}
+			if recStatus.SegmentLength != "" {
+				camStatus["segment_duration"] = recStatus.SegmentLength
+			}
+		}
+
+		if reading, ok := s.clock.Reading(cam.Name); ok && reading.Error == "" {
+			camStatus["clock_drift_seconds"] = reading.DriftSeconds
+			camStatus["clock_drift_exceeded"] = reading.Exceeded
+		}
+		if info, ok := s.devices.Info(cam.Name); ok && info.Source != "" {
+			camStatus["device"] = info
 		}
 
 		cameras = append(cameras, camStatus)
 	}
 
 	status["cameras"] = cameras
+	if limiter := s.recorder.Limiter(); limiter != nil {
+		status["transcodes"] = gin.H{"active": limiter.InUse(), "max": limiter.Max()}
+	}
 
 	c.JSON(http.StatusOK, status)
 }
@@ -314,7 +864,7 @@ func (s *Server) handleCameraStatus(c *gin.Context) {
 
 	rec, exists := s.recorder.GetRecorder(cameraName)
 	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Camera not found"})
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
 		return
 	}
 
@@ -323,12 +873,101 @@ func (s *Server) handleCameraStatus(c *gin.Context) {
 		lastErr = err.Error()
 	}
 
+	uptime := rec.Uptime()
+	status := gin.H{
+		"name":           cameraName,
+		"running":        rec.IsRunning(),
+		"paused":         rec.IsPaused(),
+		"state":          rec.State(),
+		"state_since":    rec.StateSince(),
+		"transitions":    rec.Transitions(),
+		"uptime":         uptime.String(),
+		"uptime_seconds": int64(uptime.Seconds()),
+		"last_error":     lastErr,
+		"streaming":      s.mjpeg.IsRunning(cameraName),
+	}
+	if startedAt := rec.StartedAt(); !startedAt.IsZero() {
+		status["started_at"] = startedAt
+	}
+	if lastSegment := rec.LastSegmentAt(); !lastSegment.IsZero() {
+		status["last_segment_at"] = lastSegment
+	}
+
+	if cam, ok := s.findCamera(cameraName); ok {
+		status["live_audio"] = !cam.DisableLiveAudio
+		if len(cam.Tags) > 0 {
+			status["tags"] = cam.Tags
+		}
+	}
+
+	if usage, ok := rec.Usage(); ok {
+		status["usage"] = usage
+	}
+	status["resource_restarts"] = rec.ResourceRestarts()
+	if owner := rec.IngestOwner(); owner != "" {
+		status["shares_stream_of"] = owner
+	}
+	if retry := rec.RetryStatus(); retry != nil {
+		status["retry"] = retry
+	}
+	if failover := rec.FailoverStatus(); failover != nil {
+		status["failover"] = failover
+	}
+
+	if reading, ok := s.clock.Reading(cameraName); ok {
+		status["clock"] = reading
+	}
+	if info, ok := s.devices.Info(cameraName); ok {
+		status["device"] = info
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func (s *Server) handleCameraHistory(c *gin.Context) {
+	cameraName := c.Param("name")
+
+	if _, ok := s.findCamera(cameraName); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
+		return
+	}
+
+	since, err := time.ParseDuration(c.DefaultQuery("since", "24h"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "invalid since duration")})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil {
+		limit = 100
+	}
+
+	now := time.Now()
+	history, err := s.index.StatusHistory(cameraName, now.Add(-since), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	uptime := gin.H{}
+	for label, window := range map[string]time.Duration{"24h": 24 * time.Hour, "7d": 7 * 24 * time.Hour} {
+		pct, ok, err := s.index.Uptime(cameraName, window, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if ok {
+			uptime[label] = pct
+		} else {
+			uptime[label] = nil
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"name":       cameraName,
-		"running":    rec.IsRunning(),
-		"uptime":     rec.Uptime().String(),
-		"last_error": lastErr,
-		"streaming":  s.mjpeg.IsRunning(cameraName),
+		"name":    cameraName,
+		"history": history,
+		"uptime":  uptime,
 	})
 }
 
@@ -338,31 +977,56 @@ func (s *Server) handleStorageStats(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if usage, err := s.index.TierUsage(); err != nil {
+		log.Printf("Warning: %v", err)
+	} else {
+		stats.Tiers = make(map[string]storage.TierUsage, len(usage))
+		for tier, u := range usage {
+			stats.Tiers[tier] = storage.NewTierUsage(u.Segments, u.Bytes)
+		}
+	}
+	stats.Retranscodes = s.recorder.Retranscode().Pending()
 
 	c.JSON(http.StatusOK, stats)
 }
 
-func (s *Server) handleCameraStart(c *gin.Context) {
-	cameraName := c.Param("name")
+func (s *Server) handleStorageBenchmark(c *gin.Context) {
+	sizeMB, err := strconv.Atoi(c.DefaultQuery("size_mb", "128"))
+	if err != nil || sizeMB <= 0 || sizeMB > 1024 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "size_mb must be between 1 and 1024")})
+		return
+	}
 
-	if err := s.recorder.StartCamera(c.Request.Context(), cameraName); err != nil {
+	if !s.benchmarkMu.TryLock() {
+		c.JSON(http.StatusConflict, gin.H{"error": s.tr(c, "a benchmark is already running")})
+		return
+	}
+	defer s.benchmarkMu.Unlock()
+
+	result, err := storage.Benchmark(c.Request.Context(), s.config.Recording.OutputDir, int64(sizeMB)<<20, s.config.Disk.StallThreshold)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var rtspURL string
-	for _, cam := range s.config.Cameras {
-		if cam.Name == cameraName {
-			rtspURL = cam.RTSPURL
-			break
-		}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) handleCameraStart(c *gin.Context) {
+	cameraName := c.Param("name")
+
+	ctx := s.appContext()
+	if err := s.recorder.StartCamera(ctx, cameraName); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	if rtspURL != "" {
-		go s.mjpeg.Start(c.Request.Context(), cameraName, rtspURL)
+	if cam, ok := s.findCamera(cameraName); ok {
+		go s.mjpeg.Start(ctx, cameraName, s.streamURL(cam))
 	}
+	s.rememberRunState(cameraName, index.RunRunning)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Camera started", "camera": cameraName})
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Camera started"), "camera": cameraName})
 }
 
 func (s *Server) handleCameraStop(c *gin.Context) {
@@ -370,8 +1034,110 @@ func (s *Server) handleCameraStop(c *gin.Context) {
 
 	s.recorder.StopCamera(cameraName)
 	s.mjpeg.Stop(cameraName)
+	s.hls.Stop(cameraName)
+	s.rememberRunState(cameraName, index.RunStopped)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Camera stopped", "camera": cameraName})
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Camera stopped"), "camera": cameraName})
+}
+
+func (s *Server) handleCameraPause(c *gin.Context) {
+	cameraName := c.Param("name")
+
+	if _, exists := s.recorder.GetRecorder(cameraName); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
+		return
+	}
+
+	if err := s.recorder.PauseCamera(cameraName); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	s.rememberRunState(cameraName, index.RunPaused)
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Recording paused"), "camera": cameraName})
+}
+
+func (s *Server) handleCameraResume(c *gin.Context) {
+	cameraName := c.Param("name")
+
+	if err := s.recorder.ResumeCamera(cameraName); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	s.rememberRunState(cameraName, index.RunRunning)
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Recording resumed"), "camera": cameraName})
+}
+
+// handleCameraPowerCycle switches the camera off and on with its power
+// control, answering once it is back on.
+func (s *Server) handleCameraPowerCycle(c *gin.Context) {
+	cameraName := c.Param("name")
+
+	cam, ok := s.findCamera(cameraName)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
+		return
+	}
+	if !cam.Power.Enabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": s.tr(c, "The camera has no power control")})
+		return
+	}
+
+	log.Printf("[%s] Power-cycling the camera", cameraName)
+	if err := s.recorder.PowerCycleCamera(c.Request.Context(), cameraName); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": s.tr(c, "Failed to power-cycle the camera: %s", err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Camera power-cycled"), "camera": cameraName})
+}
+
+// rememberRunState records a manual change so recording.startup: resume can
+// restore it after a restart.
+func (s *Server) rememberRunState(cameraName, state string) {
+	if _, ok := s.findCamera(cameraName); !ok {
+		return
+	}
+	if err := s.index.SetRunState(cameraName, state, time.Now()); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+func (s *Server) cameras() []config.CameraConfig {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+
+	cameras := make([]config.CameraConfig, len(s.config.Cameras))
+	copy(cameras, s.config.Cameras)
+	return cameras
+}
+
+func (s *Server) clockTargets() []camera.ClockTarget {
+	var targets []camera.ClockTarget
+	for _, cam := range s.cameras() {
+		if !cam.Enabled || source.IsLocal(cam.RTSPURL) {
+			continue
+		}
+		targets = append(targets, camera.ClockTarget{
+			Name:     cam.Name,
+			RTSPURL:  cam.RTSPURL,
+			ONVIFURL: cam.ONVIFURL,
+		})
+	}
+	return targets
+}
+
+func (s *Server) findCamera(name string) (config.CameraConfig, bool) {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+
+	for _, cam := range s.config.Cameras {
+		if cam.Name == name {
+			return cam, true
+		}
+	}
+	return config.CameraConfig{}, false
 }
 
 type TemplateData struct {
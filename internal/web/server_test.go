@@ -0,0 +1,97 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/internal/notify"
+	"github.com/lets-vibe/cam-recorder/pkg/command"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+func TestMain(m *testing.M) {
+	command.RunFake()
+	os.Exit(m.Run())
+}
+
+// newTestServer returns a server for one stopped camera, recording with a
+// fake ffmpeg into a temporary directory.
+func newTestServer(t *testing.T) (*Server, *recorder.RecorderManager) {
+	t.Helper()
+	command.Set(&command.Fake{Speed: 60})
+	t.Cleanup(func() { command.Set(command.Exec{}) })
+	// The templates are loaded relative to the repository root.
+	t.Chdir("../..")
+
+	cfg, err := config.Parse(strings.NewReader(`
+cameras:
+  - name: Front Door
+    rtsp_url: rtsp://camera.local/stream
+    enabled: false
+recording:
+  segment_duration: 1m
+  output_dir: `+t.TempDir()+`
+`), "yaml")
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	idx, err := index.Open(cfg.IndexPath())
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	t.Cleanup(func() { idx.Close() })
+
+	rec := recorder.NewRecorderManager(&cfg.Recording.Options)
+	for _, cam := range cfg.Cameras {
+		if err := rec.AddCamera(context.Background(), cam.Recorder()); err != nil {
+			t.Fatalf("AddCamera: %v", err)
+		}
+	}
+	s := NewServer(cfg, rec, storage.NewManager(&cfg.Recording.Options), idx, notify.NewDispatcher())
+	t.Cleanup(func() {
+		s.mjpeg.StopAll()
+		rec.StopAll()
+	})
+	return s, rec
+}
+
+// A camera started through the API must keep running once the request that
+// started it is over and its context is cancelled.
+func TestCameraStartOutlivesRequest(t *testing.T) {
+	s, rec := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/camera/Front%20Door/start", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	r, _ := rec.GetRecorder("Front Door")
+	// The streamer is started in the background; wait for it, then make sure
+	// both outlive the request.
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.mjpeg.IsRunning("Front Door") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	if !r.IsRunning() {
+		t.Error("recorder stopped after the request ended")
+	}
+	if !s.mjpeg.IsRunning("Front Door") {
+		t.Error("preview stream stopped after the request ended")
+	}
+}
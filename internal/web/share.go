@@ -0,0 +1,375 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+)
+
+const (
+	shareKeySetting      = "share.hmac_key"
+	defaultShareDuration = 24 * time.Hour
+	maxShareDuration     = 30 * 24 * time.Hour
+	// shareViewDuration is how long one view of a share may keep fetching
+	// its media.
+	shareViewDuration = 4 * time.Hour
+)
+
+type shareRequest struct {
+	Camera    string `json:"camera"`
+	Filename  string `json:"filename"`
+	ExpiresIn string `json:"expires_in"`
+	MaxViews  int    `json:"max_views"`
+	Note      string `json:"note"`
+	// Watermark stamps a shared recording; WatermarkText is added below
+	// the configured text, e.g. a case number.
+	Watermark     bool   `json:"watermark"`
+	WatermarkText string `json:"watermark_text"`
+}
+
+// shareKey returns the HMAC key for share links, generating and storing it
+// in the index on first use.
+func (s *Server) shareKey() ([]byte, error) {
+	s.shareMu.Lock()
+	defer s.shareMu.Unlock()
+
+	if s.shareSecret != nil {
+		return s.shareSecret, nil
+	}
+
+	stored, ok, err := s.index.Setting(shareKeySetting)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		key, err := base64.StdEncoding.DecodeString(stored)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored share key: %w", err)
+		}
+		s.shareSecret = key
+		return key, nil
+	}
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	if err := s.index.SetSetting(shareKeySetting, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, err
+	}
+	s.shareSecret = key
+	return key, nil
+}
+
+func (s *Server) shareSignature(id string, expires int64) (string, error) {
+	key, err := s.shareKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%d", id, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// shareViewToken starts a viewing session of the share: it returns a token
+// for the media URL that lets a player fetch the media as often as it needs
+// until the session ends, without counting another view.
+func (s *Server) shareViewToken(share index.Share) (string, error) {
+	expires := time.Now().Add(shareViewDuration)
+	if share.ExpiresAt.Before(expires) {
+		expires = share.ExpiresAt
+	}
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	view := fmt.Sprintf("%d.%s", expires.Unix(), hex.EncodeToString(nonce))
+	sig, err := s.shareSignature(share.ID+"\n"+view, expires.Unix())
+	if err != nil {
+		return "", err
+	}
+	return view + "." + sig, nil
+}
+
+// validShareView reports whether token is a view token of the share whose
+// session has not ended.
+func (s *Server) validShareView(share index.Share, token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+	want, err := s.shareSignature(share.ID+"\n"+parts[0]+"."+parts[1], expires)
+	return err == nil && hmac.Equal([]byte(parts[2]), []byte(want))
+}
+
+func (s *Server) shareURL(c *gin.Context, share index.Share) (string, error) {
+	expires := share.ExpiresAt.Unix()
+	sig, err := s.shareSignature(share.ID, expires)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%s/s/%s?exp=%d&sig=%s", baseURL(c), s.basePath, share.ID, expires, sig), nil
+}
+
+func (s *Server) handleShareCreate(c *gin.Context) {
+	var req shareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cam, ok := s.findCamera(req.Camera)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
+		return
+	}
+
+	kind := index.ShareLive
+	if req.Filename != "" {
+		if _, err := s.storage.GetFilePath(cam.Name, req.Filename); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "File not found")})
+			return
+		}
+		kind = index.ShareRecording
+	}
+	if req.Watermark {
+		if kind != index.ShareRecording {
+			c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "Only recordings can be watermarked")})
+			return
+		}
+		if !s.watermark(req.WatermarkText).Enabled() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "No watermark text or logo is configured")})
+			return
+		}
+	}
+
+	duration := defaultShareDuration
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "invalid expires_in %q", req.ExpiresIn)})
+			return
+		}
+		duration = min(d, maxShareDuration)
+	}
+	if req.MaxViews < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "max_views must not be negative")})
+		return
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	now := time.Now()
+	share := index.Share{
+		ID:        hex.EncodeToString(id),
+		Kind:      kind,
+		Camera:    cam.Name,
+		Filename:  req.Filename,
+		Note:      req.Note,
+		CreatedAt: now,
+		ExpiresAt: now.Add(duration).Truncate(time.Second),
+		MaxViews:  req.MaxViews,
+
+		Watermark:     req.Watermark,
+		WatermarkText: req.WatermarkText,
+	}
+	if err := s.index.AddShare(share); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	shareURL, err := s.shareURL(c, share)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"share": share,
+		"url":   shareURL,
+	})
+}
+
+func (s *Server) handleShareList(c *gin.Context) {
+	shares, err := s.index.Shares()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	result := make([]gin.H, 0, len(shares))
+	for _, share := range shares {
+		result = append(result, gin.H{
+			"share":  share,
+			"active": share.Active(now),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shares": result, "count": len(result)})
+}
+
+func (s *Server) handleShareRevoke(c *gin.Context) {
+	revoked, err := s.index.RevokeShare(c.Param("id"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Share not found or already revoked")})
+		return
+	}
+	if share, ok, _ := s.index.Share(c.Param("id")); ok && share.Watermark {
+		os.Remove(s.shareStampPath(share))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Share revoked"), "id": c.Param("id")})
+}
+
+// sharedItem checks the link signature and that the share is neither revoked
+// nor expired. Views are counted separately, once per viewing session.
+func (s *Server) sharedItem(c *gin.Context) (index.Share, bool) {
+	id := c.Param("id")
+	expires, err := strconv.ParseInt(c.Query("exp"), 10, 64)
+	if err != nil {
+		s.authFailed(c, "malformed share link")
+		s.shareUnavailable(c, http.StatusForbidden)
+		return index.Share{}, false
+	}
+
+	want, err := s.shareSignature(id, expires)
+	if err != nil {
+		s.shareUnavailable(c, http.StatusInternalServerError)
+		return index.Share{}, false
+	}
+	if !hmac.Equal([]byte(c.Query("sig")), []byte(want)) {
+		s.authFailed(c, "invalid share signature")
+		s.shareUnavailable(c, http.StatusForbidden)
+		return index.Share{}, false
+	}
+
+	share, ok, err := s.index.Share(id)
+	if err != nil {
+		s.shareUnavailable(c, http.StatusInternalServerError)
+		return index.Share{}, false
+	}
+	now := time.Now()
+	if !ok || share.ExpiresAt.Unix() != expires || !share.RevokedAt.IsZero() || !now.Before(share.ExpiresAt) {
+		s.shareUnavailable(c, http.StatusGone)
+		return index.Share{}, false
+	}
+
+	return share, true
+}
+
+func (s *Server) shareUnavailable(c *gin.Context, status int) {
+	s.html(c, status, "error.html", gin.H{"error": s.tr(c, "This link is invalid, expired or has been revoked.")})
+}
+
+func (s *Server) handleSharePage(c *gin.Context) {
+	share, ok := s.sharedItem(c)
+	if !ok {
+		return
+	}
+	counted, err := s.index.CountShareView(share.ID, time.Now())
+	if err != nil {
+		s.shareUnavailable(c, http.StatusInternalServerError)
+		return
+	}
+	if !counted {
+		s.shareUnavailable(c, http.StatusGone)
+		return
+	}
+	view, err := s.shareViewToken(share)
+	if err != nil {
+		s.shareUnavailable(c, http.StatusInternalServerError)
+		return
+	}
+
+	query := c.Request.URL.Query()
+	query.Set("view", view)
+	s.html(c, http.StatusOK, "share.html", gin.H{
+		"pageTitle": s.tr(c, "Shared %s", share.Camera),
+		"share":     share,
+		"mediaUrl":  s.url("/s/" + url.PathEscape(share.ID) + "/media?" + query.Encode()),
+	})
+}
+
+func (s *Server) handleShareMedia(c *gin.Context) {
+	share, ok := s.sharedItem(c)
+	if !ok {
+		return
+	}
+	// Media fetched without the share page, for example by a download
+	// manager, starts a viewing session of its own.
+	if !s.validShareView(share, c.Query("view")) {
+		if !s.countShareView(c, share) {
+			return
+		}
+		view, err := s.shareViewToken(share)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		query := c.Request.URL.Query()
+		query.Set("view", view)
+		c.Redirect(http.StatusFound, s.url("/s/"+url.PathEscape(share.ID)+"/media?"+query.Encode()))
+		return
+	}
+
+	switch share.Kind {
+	case index.ShareLive:
+		quality, err := recorder.ParseQuality(c.Query("res"), c.Query("fps"))
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		s.streamMJPEG(c, share.Camera, quality, "share:"+share.ID)
+
+	case index.ShareRecording:
+		filePath, err := s.storage.GetFilePath(share.Camera, share.Filename)
+		if err != nil {
+			c.String(http.StatusNotFound, s.tr(c, "File not found"))
+			return
+		}
+		if share.Watermark {
+			if filePath, err = s.stampedShare(c.Request.Context(), share, filePath); err != nil {
+				log.Printf("Warning: Failed to watermark share %s: %v", share.ID, err)
+				c.String(http.StatusServiceUnavailable, s.tr(c, "Watermarked copy unavailable"))
+				return
+			}
+		}
+		s.serveRecording(c, filePath)
+
+	default:
+		c.String(http.StatusNotFound, s.tr(c, "Unknown share"))
+	}
+}
+
+func (s *Server) countShareView(c *gin.Context, share index.Share) bool {
+	counted, err := s.index.CountShareView(share.ID, time.Now())
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if !counted {
+		c.String(http.StatusGone, s.tr(c, "View limit reached"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,386 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/auth"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+)
+
+const (
+	sessionKeySetting = "auth.session_key"
+	sessionCookie     = "cam_session"
+	loginCookie       = "cam_login"
+
+	auditLogin = "login"
+
+	ctxUser  = "session_user"
+	ctxRole  = "session_role"
+	dataUser = "signedIn"
+)
+
+// sessionKey returns the HMAC key for session cookies, generating and
+// storing it in the index on first use.
+func (s *Server) sessionKey() ([]byte, error) {
+	s.sessionMu.Lock()
+	defer s.sessionMu.Unlock()
+
+	if s.sessionSecret != nil {
+		return s.sessionSecret, nil
+	}
+
+	stored, ok, err := s.index.Setting(sessionKeySetting)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		key, err := base64.StdEncoding.DecodeString(stored)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored session key: %w", err)
+		}
+		s.sessionSecret = key
+		return key, nil
+	}
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	if err := s.index.SetSetting(sessionKeySetting, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, err
+	}
+	s.sessionSecret = key
+	return key, nil
+}
+
+func (s *Server) authConfig() auth.Config {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.config.Auth
+}
+
+// signInExempt reports whether a path is reachable without signing in: the
+// sign-in pages and their assets, what has credentials of its own (share
+// links and the kiosk), and the failover status the standby polls.
+func signInExempt(path string) bool {
+	switch {
+	case path == "/login", strings.HasPrefix(path, "/auth/"),
+		strings.HasPrefix(path, "/static/"), path == "/sw.js",
+		strings.HasPrefix(path, "/s/"), path == "/kiosk", strings.HasPrefix(path, "/kiosk/"),
+		path == "/api/failover":
+		return true
+	default:
+		return false
+	}
+}
+
+// eventPushPath reports whether a path takes camera or Frigate event pushes,
+// which may use events.token instead of signing in.
+func eventPushPath(path string) bool {
+	return path == "/api/integrations/frigate" ||
+		strings.HasPrefix(path, "/api/cameras/") && strings.HasSuffix(path, "/events")
+}
+
+// adminOnly reports whether a request needs the admin role. Viewers may
+// read everything but the config, backups and who is watching, and change
+// nothing but their own preferences and alert subscriptions.
+func adminOnly(method, path string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return strings.HasPrefix(path, "/api/config/") || path == "/api/system/backup" ||
+			path == "/api/audit" || path == "/api/viewers" || path == "/api/share" ||
+			strings.HasPrefix(path, "/debug/") || strings.HasPrefix(path, "/api/debug/") ||
+			path == "/cameras/new"
+	default:
+		return path != "/api/preferences" && path != "/api/push/subscribe"
+	}
+}
+
+// signInMiddleware requires a session, or an API key, once auth.oidc or
+// auth.ldap is set up. Browsers are sent to the sign-in page; API clients
+// get 401. An API key has the admin role.
+func (s *Server) signInMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		// Event pushes skip sign-in only when events.token guards them.
+		if !s.authConfig().Enabled() || signInExempt(path) || eventPushPath(path) && s.eventToken() != "" {
+			c.Next()
+			return
+		}
+
+		provided := c.GetHeader("X-API-Key")
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && provided == "" {
+			provided = bearer
+		}
+		if provided != "" {
+			if !s.validAPIKey(provided) {
+				s.authFailed(c, "invalid API key")
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": s.tr(c, "invalid API key")})
+				return
+			}
+			s.authSucceeded(c)
+			c.Set(ctxRole, string(auth.RoleAdmin))
+			c.Next()
+			return
+		}
+
+		sess, ok := s.session(c)
+		if !ok {
+			if wantsHTML(c) {
+				c.Redirect(http.StatusFound, s.url("/login?next="+url.QueryEscape(s.url(c.Request.URL.RequestURI()))))
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": s.tr(c, "sign in required")})
+			return
+		}
+		c.Set(ctxUser, sess.User)
+		c.Set(ctxRole, string(sess.Role))
+
+		if sess.Role != auth.RoleAdmin && adminOnly(c.Request.Method, path) {
+			if wantsHTML(c) {
+				c.Abort()
+				s.html(c, http.StatusForbidden, "error.html", gin.H{"error": s.tr(c, "Only admins can do this")})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": s.tr(c, "Only admins can do this")})
+			return
+		}
+		c.Next()
+	}
+}
+
+// session returns the request's signed-in session, if it has a valid one.
+func (s *Server) session(c *gin.Context) (auth.Session, bool) {
+	token, err := c.Cookie(sessionCookie)
+	if err != nil || token == "" {
+		return auth.Session{}, false
+	}
+	key, err := s.sessionKey()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return auth.Session{}, false
+	}
+	sess, err := auth.OpenSession(key, token, time.Now())
+	if err != nil {
+		return auth.Session{}, false
+	}
+	return sess, true
+}
+
+func wantsHTML(c *gin.Context) bool {
+	return c.Request.Method == http.MethodGet && strings.Contains(c.GetHeader("Accept"), "text/html")
+}
+
+// localNext returns where to go after signing in: next if it is a path on
+// this server, else the dashboard.
+func (s *Server) localNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, `/\`) {
+		return s.url("/")
+	}
+	return next
+}
+
+func (s *Server) setCookie(c *gin.Context, name, value string, maxAge time.Duration) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   strings.HasPrefix(baseURL(c), "https:"),
+		HttpOnly: true,
+		// Lax, so the cookies come back from the provider's redirect.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *Server) clearCookie(c *gin.Context, name string) {
+	http.SetCookie(c.Writer, &http.Cookie{Name: name, Path: "/", MaxAge: -1, HttpOnly: true})
+}
+
+func (s *Server) loginPage(c *gin.Context, status int, next, errMsg string) {
+	data := gin.H{
+		"ldap":  s.authConfig().LDAP.Enabled(),
+		"next":  s.localNext(next),
+		"error": errMsg,
+	}
+	if s.oidc != nil {
+		data["oidc"] = s.oidc.Name()
+	}
+	s.html(c, status, "login.html", data)
+}
+
+func (s *Server) handleLoginPage(c *gin.Context) {
+	if !s.authConfig().Enabled() {
+		c.Redirect(http.StatusFound, s.url("/"))
+		return
+	}
+	if _, ok := s.session(c); ok {
+		c.Redirect(http.StatusFound, s.localNext(c.Query("next")))
+		return
+	}
+	s.loginPage(c, http.StatusOK, c.Query("next"), "")
+}
+
+// handleOIDCLogin sends the browser to the provider, keeping the sign-in's
+// state in a short-lived cookie.
+func (s *Server) handleOIDCLogin(c *gin.Context) {
+	if s.oidc == nil {
+		s.html(c, http.StatusNotFound, "error.html", gin.H{"error": s.tr(c, "Not found")})
+		return
+	}
+	key, err := s.sessionKey()
+	if err != nil {
+		s.html(c, http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
+		return
+	}
+	login := auth.NewLogin(s.localNext(c.Query("next")), time.Now())
+	target, err := s.oidc.AuthURL(c.Request.Context(), login, s.oidcRedirectURL(c))
+	if err != nil {
+		log.Printf("Warning: OIDC sign-in failed: %v", err)
+		s.loginPage(c, http.StatusBadGateway, login.Next, s.tr(c, "The identity provider cannot be reached"))
+		return
+	}
+	sealed, err := auth.Seal(key, login)
+	if err != nil {
+		s.html(c, http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
+		return
+	}
+	s.setCookie(c, loginCookie, sealed, time.Until(login.Expires))
+	c.Redirect(http.StatusFound, target)
+}
+
+func (s *Server) oidcRedirectURL(c *gin.Context) string {
+	return s.oidc.RedirectURL(baseURL(c) + s.url("/auth/oidc/callback"))
+}
+
+// handleOIDCCallback finishes an OIDC sign-in when the provider sends the
+// browser back with a code.
+func (s *Server) handleOIDCCallback(c *gin.Context) {
+	if s.oidc == nil {
+		s.html(c, http.StatusNotFound, "error.html", gin.H{"error": s.tr(c, "Not found")})
+		return
+	}
+	key, err := s.sessionKey()
+	if err != nil {
+		s.html(c, http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
+		return
+	}
+	var login auth.Login
+	sealed, _ := c.Cookie(loginCookie)
+	s.clearCookie(c, loginCookie)
+	if auth.Open(key, sealed, &login) != nil || time.Now().After(login.Expires) ||
+		subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(login.State)) != 1 {
+		s.loginPage(c, http.StatusBadRequest, "", s.tr(c, "The sign-in expired, please try again"))
+		return
+	}
+	if msg := c.Query("error"); msg != "" {
+		if desc := c.Query("error_description"); desc != "" {
+			msg += ": " + desc
+		}
+		s.loginPage(c, http.StatusUnauthorized, login.Next, s.tr(c, "The identity provider refused the sign-in: %s", msg))
+		return
+	}
+
+	id, err := s.oidc.Exchange(c.Request.Context(), login, c.Query("code"), s.oidcRedirectURL(c))
+	if err != nil {
+		log.Printf("Warning: OIDC sign-in failed: %v", err)
+		s.authFailed(c, "failed OIDC sign-in")
+		s.loginPage(c, http.StatusBadGateway, login.Next, s.tr(c, "Sign-in failed, see the server log"))
+		return
+	}
+	s.startSession(c, id, "oidc", login.Next)
+}
+
+// handleLDAPLogin signs in with a user name and password from the sign-in
+// form, checked against the directory.
+func (s *Server) handleLDAPLogin(c *gin.Context) {
+	cfg := s.authConfig().LDAP
+	next := c.PostForm("next")
+	if !cfg.Enabled() {
+		s.html(c, http.StatusNotFound, "error.html", gin.H{"error": s.tr(c, "Not found")})
+		return
+	}
+
+	id, err := cfg.Authenticate(c.Request.Context(), strings.TrimSpace(c.PostForm("username")), c.PostForm("password"))
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		s.authFailed(c, "invalid LDAP credentials")
+		s.loginPage(c, http.StatusUnauthorized, next, s.tr(c, "Invalid user name or password"))
+		return
+	}
+	if err != nil {
+		log.Printf("Warning: LDAP sign-in failed: %v", err)
+		s.loginPage(c, http.StatusBadGateway, next, s.tr(c, "Sign-in failed, see the server log"))
+		return
+	}
+	s.startSession(c, id, "ldap", next)
+}
+
+// startSession signs in a user the provider vouched for, with the role their
+// groups give them.
+func (s *Server) startSession(c *gin.Context, id auth.Identity, method, next string) {
+	cfg := s.authConfig()
+	role, ok := cfg.Role(id.Groups)
+	if !ok {
+		s.authFailed(c, fmt.Sprintf("%s sign-in of %s, who is in no admin or viewer group", method, id.User))
+		s.loginPage(c, http.StatusForbidden, next, s.tr(c, "%s is not allowed to use the recorder", id.User))
+		return
+	}
+	key, err := s.sessionKey()
+	if err != nil {
+		s.html(c, http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
+		return
+	}
+	duration := cfg.SessionDuration
+	if duration <= 0 {
+		duration = auth.DefaultSessionDuration
+	}
+	sess := auth.Session{User: id.User, Role: role, Expires: time.Now().Add(duration)}
+	token, err := auth.Seal(key, sess)
+	if err != nil {
+		s.html(c, http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
+		return
+	}
+	s.authSucceeded(c)
+	s.setCookie(c, sessionCookie, token, duration)
+
+	err = s.index.AddAudit(index.AuditEntry{
+		At:     time.Now(),
+		Kind:   auditLogin,
+		IP:     c.ClientIP(),
+		User:   id.User,
+		Detail: fmt.Sprintf("%s as %s", method, role),
+	})
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	c.Redirect(http.StatusSeeOther, s.localNext(next))
+}
+
+func (s *Server) handleLogout(c *gin.Context) {
+	s.clearCookie(c, sessionCookie)
+	c.Redirect(http.StatusSeeOther, s.url("/login"))
+}
+
+// handleWhoAmI reports the signed-in user and their role.
+func (s *Server) handleWhoAmI(c *gin.Context) {
+	role := c.GetString(ctxRole)
+	if role == "" {
+		// Without sign-in, everyone who gets through can do everything.
+		role = string(auth.RoleAdmin)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user":    s.viewerUser(c),
+		"role":    role,
+		"sign_in": s.authConfig().Enabled(),
+	})
+}
@@ -0,0 +1,111 @@
+package web
+
+import (
+	"log"
+	"maps"
+	"slices"
+
+	"github.com/lets-vibe/cam-recorder/internal/snmp"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// SNMP objects under the agent's base OID: recorder-wide scalars under 1,
+// and a table of cameras under 2.1, indexed by camera name order.
+const (
+	snmpScalars = 1
+	snmpCameras = 2
+)
+
+// Columns of the camera table.
+const (
+	snmpCamIndex = iota + 1
+	snmpCamName
+	snmpCamState
+	snmpCamUp
+	snmpCamUptime
+	snmpCamLastError
+	snmpCamFailedAttempts
+	snmpCamRestarts
+	snmpCamStorageMB
+	snmpCamOnFailover
+)
+
+// SNMPValues returns the recorder's health for the SNMP agent, with OIDs
+// relative to its base OID.
+func (s *Server) SNMPValues() []snmp.Varbind {
+	status := s.recorder.GetStatus()
+	names := slices.Sorted(maps.Keys(status))
+
+	var recording, down int
+	for _, st := range status {
+		if st.State.IsDown() {
+			down++
+		}
+		if st.Running && !st.State.IsDown() {
+			recording++
+		}
+	}
+	scalar := func(n uint32, value any) snmp.Varbind {
+		return snmp.Varbind{OID: snmp.OID{snmpScalars, n, 0}, Value: value}
+	}
+	values := []snmp.Varbind{
+		scalar(1, s.version),
+		scalar(2, snmp.Gauge32(len(names))),
+		scalar(3, snmp.Gauge32(recording)),
+		scalar(4, snmp.Gauge32(down)),
+	}
+
+	sizes := make(map[string]int64)
+	stats, err := s.storage.GetStats()
+	if err != nil {
+		log.Printf("Warning: SNMP: %v", err)
+	} else {
+		stalled := stats.WriteLatency != nil && stats.WriteLatency.Stalled
+		var warnings int
+		for _, disk := range stats.DiskHealth {
+			warnings += len(disk.Warnings)
+		}
+		values = append(values,
+			scalar(5, snmp.Gauge32(stats.TotalSize>>20)),
+			scalar(6, snmp.Gauge32(stats.FileCount)),
+			scalar(7, stats.RetentionDays),
+			scalar(8, truthValue(stalled)),
+			scalar(9, snmp.Gauge32(warnings)),
+		)
+		for _, cam := range stats.Cameras {
+			sizes[cam.Name] = cam.Size
+		}
+	}
+
+	for i, name := range names {
+		st := status[name]
+		column := func(n uint32, value any) snmp.Varbind {
+			return snmp.Varbind{OID: snmp.OID{snmpCameras, 1, n, uint32(i + 1)}, Value: value}
+		}
+		var attempts int
+		if st.Retry != nil {
+			attempts = st.Retry.Attempts
+		}
+		values = append(values,
+			column(snmpCamIndex, i+1),
+			column(snmpCamName, name),
+			column(snmpCamState, string(st.State)),
+			column(snmpCamUp, truthValue(!st.State.IsDown())),
+			column(snmpCamUptime, snmp.TimeTicks(st.UptimeSeconds*100)),
+			column(snmpCamLastError, st.LastError),
+			column(snmpCamFailedAttempts, snmp.Gauge32(attempts)),
+			column(snmpCamRestarts, snmp.Counter32(st.Restarts)),
+			column(snmpCamStorageMB, snmp.Gauge32(sizes[storage.CameraDirName(name)]>>20)),
+			column(snmpCamOnFailover, truthValue(st.Failover != nil)),
+		)
+	}
+	return values
+}
+
+// truthValue is SNMPv2-TC's TruthValue: 1 for true, 2 for false.
+func truthValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 2
+}
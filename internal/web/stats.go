@@ -0,0 +1,122 @@
+package web
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/i18n"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/camera"
+)
+
+const maxStatsDays = 366
+
+type cameraDayStats struct {
+	index.DayStats
+	MotionEvents int `json:"motion_events"`
+}
+
+type statsAnomaly struct {
+	Day    string `json:"day"`
+	Reason string `json:"reason"`
+}
+
+func (s *Server) handleStatsPage(c *gin.Context) {
+	cameras := s.cameras()
+	selected := c.Query("camera")
+	if selected == "" && len(cameras) > 0 {
+		selected = cameras[0].Name
+	}
+
+	s.html(c, http.StatusOK, "stats.html", gin.H{
+		"pageTitle":   s.tr(c, "Statistics"),
+		"cameras":     cameras,
+		"selectedCam": selected,
+	})
+}
+
+func (s *Server) handleCameraStats(c *gin.Context) {
+	cameraName := c.Param("camera")
+	if _, ok := s.findCamera(cameraName); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "Camera not found")})
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > maxStatsDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "days must be between 1 and %d", maxStatsDays)})
+		return
+	}
+
+	daily, err := s.index.DailyStats(cameraName, days, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var totals cameraDayStats
+	totals.Events = map[string]int{}
+	result := make([]cameraDayStats, len(daily))
+	for i, day := range daily {
+		result[i] = cameraDayStats{DayStats: day, MotionEvents: day.Events[camera.EventMotion]}
+
+		totals.Segments += day.Segments
+		totals.RecordedHours += day.RecordedHours
+		totals.Bytes += day.Bytes
+		totals.DowntimeHours += day.DowntimeHours
+		totals.MotionEvents += result[i].MotionEvents
+		for kind, n := range day.Events {
+			totals.Events[kind] += n
+		}
+	}
+	if totals.RecordedHours > 0 {
+		totals.AvgBitrate = float64(totals.Bytes) * 8 / 1000 / (totals.RecordedHours * 3600)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"camera":    cameraName,
+		"days":      result,
+		"totals":    totals,
+		"anomalies": statsAnomalies(daily, s.language(c)),
+	})
+}
+
+// statsAnomalies flags the finished days whose recorded hours or bytes are
+// far from the median of the period, and days with over an hour of downtime.
+// Today is left out since it is still being recorded.
+func statsAnomalies(days []index.DayStats, lang *i18n.Language) []statsAnomaly {
+	anomalies := []statsAnomaly{}
+	if len(days) < 2 {
+		return anomalies
+	}
+	done := days[:len(days)-1]
+
+	median := func(value func(index.DayStats) float64) float64 {
+		values := make([]float64, len(done))
+		for i, day := range done {
+			values[i] = value(day)
+		}
+		slices.Sort(values)
+		return values[len(values)/2]
+	}
+	hours := func(d index.DayStats) float64 { return d.RecordedHours }
+	bytes := func(d index.DayStats) float64 { return float64(d.Bytes) }
+	medianHours, medianBytes := median(hours), median(bytes)
+
+	for _, day := range done {
+		switch {
+		case medianHours > 0 && day.RecordedHours < medianHours/2:
+			anomalies = append(anomalies, statsAnomaly{day.Day, lang.T("recorded %.1fh, median is %.1fh", day.RecordedHours, medianHours)})
+		case medianBytes > 0 && (float64(day.Bytes) > medianBytes*2 || float64(day.Bytes) < medianBytes/2):
+			anomalies = append(anomalies, statsAnomaly{day.Day, lang.T("used %.1fx the median storage", float64(day.Bytes)/medianBytes)})
+		}
+		if day.DowntimeHours > 1 {
+			anomalies = append(anomalies, statsAnomaly{day.Day, lang.T("down for %.1fh", day.DowntimeHours)})
+		}
+	}
+	return anomalies
+}
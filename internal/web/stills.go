@@ -0,0 +1,70 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// handleStills lists the stills kept of static segments removed early,
+// newest first, between ?from= and ?to= (RFC3339, the last 24 hours by
+// default), optionally for one ?camera=.
+func (s *Server) handleStills(c *gin.Context) {
+	now := time.Now()
+	from, err := parseTimeParam(c, "from", now.Add(-24*time.Hour))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to", now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stills := []gin.H{}
+	for _, cam := range s.cameras() {
+		if name := c.Query("camera"); name != "" && name != cam.Name {
+			continue
+		}
+		dir := filepath.Dir(storage.StaticThumbnailPath(s.config.Recording.OutputDir, cam.Name, "x.jpg"))
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || !strings.HasSuffix(entry.Name(), ".jpg") {
+				continue
+			}
+			// Stills carry the end time of their segment.
+			if info.ModTime().Before(from) || info.ModTime().After(to) {
+				continue
+			}
+			stills = append(stills, gin.H{
+				"camera":        cam.Name,
+				"segment":       strings.TrimSuffix(entry.Name(), ".jpg"),
+				"ended_at":      info.ModTime(),
+				"thumbnail_url": s.url("/thumb/" + url.PathEscape(cam.Name) + "/" + url.PathEscape(entry.Name())),
+			})
+		}
+	}
+	sort.Slice(stills, func(i, j int) bool {
+		return stills[i]["ended_at"].(time.Time).After(stills[j]["ended_at"].(time.Time))
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":   from,
+		"to":     to,
+		"stills": stills,
+		"count":  len(stills),
+	})
+}
@@ -0,0 +1,85 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/backup"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const maxRestoreSize = 4 << 30
+
+// SetSyncer gives the server the syncer of finished segments, to report its
+// policy.
+func (s *Server) SetSyncer(syncer *storage.Syncer) {
+	s.syncer = syncer
+}
+
+// handleSystem reports the version the recorder runs and how it writes to
+// disk.
+func (s *Server) handleSystem(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":    s.version,
+		"go_version": runtime.Version(),
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+		"fsync":      s.syncer.Stats(),
+	})
+}
+
+// handleBackup streams a backup of the config, index and uploaded images.
+// The config is included with its secrets so a restore is complete.
+func (s *Server) handleBackup(c *gin.Context) {
+	s.cfgMu.RLock()
+	src := backup.Source{
+		ConfigPath: s.config.Path(),
+		Index:      s.index,
+		OutputDir:  s.config.Recording.OutputDir,
+		Version:    s.version,
+	}
+	s.cfgMu.RUnlock()
+
+	if src.ConfigPath == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s.tr(c, "config has no file path")})
+		return
+	}
+
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=cam-recorder-backup-%s.tar.gz", time.Now().Format("20060102-150405")))
+	if err := backup.Write(c.Writer, src); err != nil {
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Error(err)
+	}
+}
+
+// handleRestore stages the backup sent as the request body, to be applied
+// the next time the recorder starts.
+func (s *Server) handleRestore(c *gin.Context) {
+	s.cfgMu.RLock()
+	configPath := s.config.Path()
+	s.cfgMu.RUnlock()
+
+	if configPath == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s.tr(c, "config has no file path")})
+		return
+	}
+
+	manifest, err := backup.Stage(http.MaxBytesReader(c.Writer, c.Request.Body, maxRestoreSize), configPath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  s.tr(c, "Backup staged; restart the recorder to restore it"),
+		"manifest": manifest,
+	})
+}
@@ -0,0 +1,58 @@
+package web
+
+import (
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/internal/tags"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// tagSelector reads the "tag" query parameters, e.g.
+// ?tag=location=garage&tag=priority=high.
+func tagSelector(c *gin.Context) (tags.Selector, error) {
+	return tags.Parse(c.QueryArray("tag"))
+}
+
+func camerasTagged(cameras []config.CameraConfig, sel tags.Selector) []config.CameraConfig {
+	if len(sel) == 0 {
+		return cameras
+	}
+	var tagged []config.CameraConfig
+	for _, cam := range cameras {
+		if sel.Match(cam.Tags) {
+			tagged = append(tagged, cam)
+		}
+	}
+	return tagged
+}
+
+// cameraTagList lists the distinct tags of the cameras for filter menus.
+func cameraTagList(cameras []config.CameraConfig) []string {
+	all := make([]map[string]string, len(cameras))
+	for i, cam := range cameras {
+		all[i] = cam.Tags
+	}
+	return tags.Collect(all...)
+}
+
+// filesOfCameras keeps the recordings of the cameras, at most limit of them
+// when limit is positive.
+func filesOfCameras(files []storage.FileInfo, cameras []config.CameraConfig, limit int) []storage.FileInfo {
+	dirs := make(map[string]bool, len(cameras))
+	for _, cam := range cameras {
+		dirs[storage.CameraDirName(cam.Name)] = true
+	}
+	kept := files[:0]
+	for _, f := range files {
+		if dirs[filepath.Base(filepath.Dir(f.Path))] {
+			kept = append(kept, f)
+			if limit > 0 && len(kept) == limit {
+				break
+			}
+		}
+	}
+	return kept
+}
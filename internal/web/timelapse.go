@@ -0,0 +1,67 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/timelapse"
+)
+
+func (s *Server) timelapseTargets() []timelapse.Target {
+	var targets []timelapse.Target
+	for _, cam := range s.cameras() {
+		if cam.Enabled && cam.Timelapse > 0 {
+			targets = append(targets, timelapse.Target{
+				Name:     cam.Name,
+				RTSPURL:  s.streamURL(cam),
+				Interval: cam.Timelapse,
+			})
+		}
+	}
+	return targets
+}
+
+func (s *Server) handleTimelapsePage(c *gin.Context) {
+	cameraName := c.Query("camera")
+	videos, err := s.timelapse.List(cameraName)
+	if err != nil {
+		s.html(c, http.StatusInternalServerError, "error.html", gin.H{"error": err.Error()})
+		return
+	}
+
+	s.html(c, http.StatusOK, "timelapse.html", gin.H{
+		"pageTitle":   s.tr(c, "Time-lapse"),
+		"cameras":     s.cameras(),
+		"videos":      videos,
+		"selectedCam": cameraName,
+	})
+}
+
+func (s *Server) handleTimelapseAPI(c *gin.Context) {
+	videos, err := s.timelapse.List(c.Query("camera"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if videos == nil {
+		videos = []timelapse.Video{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"videos": videos, "count": len(videos)})
+}
+
+func (s *Server) handleTimelapseDownload(c *gin.Context) {
+	filename := c.Param("filename")
+	path, err := s.timelapse.FilePath(c.Param("camera"), filename)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "File not found")})
+		return
+	}
+
+	if c.Query("download") != "" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	}
+	c.File(path)
+}
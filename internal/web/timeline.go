@@ -0,0 +1,143 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+func (s *Server) applySegmentTimes(files []storage.FileInfo) {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+
+	segments, err := s.index.SegmentsByPath(paths)
+	if err != nil {
+		log.Printf("Warning: Failed to load segment times: %v", err)
+		return
+	}
+
+	for i := range files {
+		if seg, ok := segments[files[i].Path]; ok {
+			files[i].StartedAt = seg.StartedAt
+			files[i].EndedAt = seg.EndedAt
+			files[i].Quality = seg.Quality
+			files[i].Tier = seg.Tier
+			files[i].Static = seg.Static
+		}
+	}
+}
+
+func parseTimeParam(c *gin.Context, name string, fallback time.Time) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: expected RFC3339 time", name)
+	}
+	return t, nil
+}
+
+func (s *Server) segmentJSON(seg index.Segment) gin.H {
+	return gin.H{
+		"camera":           seg.Camera,
+		"filename":         seg.Filename,
+		"started_at":       seg.StartedAt,
+		"ended_at":         seg.EndedAt,
+		"duration_seconds": seg.Duration().Seconds(),
+		"size":             seg.Size,
+		"quality":          seg.Quality,
+		"tier":             seg.Tier,
+		"activity":         seg.Activity,
+		"static":           seg.Static,
+		"instance":         seg.Instance,
+		"site":             seg.Site,
+		"missing":          !seg.MissingSince.IsZero(),
+		"play_url":         s.url(fmt.Sprintf("/play/%s/%s", url.PathEscape(seg.Camera), url.PathEscape(seg.Filename))),
+		"video_url":        s.url(fmt.Sprintf("/video/%s/%s", url.PathEscape(seg.Camera), url.PathEscape(seg.Filename))),
+		"download_url":     s.url(fmt.Sprintf("/dl/%s/%s", url.PathEscape(seg.Camera), url.PathEscape(seg.Filename))),
+	}
+}
+
+func (s *Server) handleTimeline(c *gin.Context) {
+	now := time.Now()
+
+	from, err := parseTimeParam(c, "from", now.Add(-24*time.Hour))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c, "to", now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil {
+		limit = 1000
+	}
+
+	segments, err := s.index.FindSegments(c.Query("camera"), from, to, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]gin.H, 0, len(segments))
+	for _, seg := range segments {
+		result = append(result, s.segmentJSON(seg))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":     from,
+		"to":       to,
+		"segments": result,
+		"count":    len(result),
+	})
+}
+
+func (s *Server) handlePlayback(c *gin.Context) {
+	cameraName := c.Query("camera")
+	if cameraName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "camera is required")})
+		return
+	}
+
+	at, err := parseTimeParam(c, "at", time.Time{})
+	if err != nil || at.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "at is required as an RFC3339 time")})
+		return
+	}
+
+	segments, err := s.index.FindSegments(cameraName, at, at, 1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(segments) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "No recording covers that time")})
+		return
+	}
+
+	seg := segments[0]
+	offset := at.Sub(seg.StartedAt).Seconds()
+
+	result := s.segmentJSON(seg)
+	result["offset_seconds"] = offset
+	result["play_url"] = s.url(fmt.Sprintf("/play/%s/%s?t=%.1f", url.PathEscape(seg.Camera), url.PathEscape(seg.Filename), offset))
+	result["scrub_url"] = s.url(fmt.Sprintf("/scrub/%s/%s", url.PathEscape(seg.Camera), url.PathEscape(seg.Filename)))
+
+	c.JSON(http.StatusOK, result)
+}
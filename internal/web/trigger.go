@@ -0,0 +1,133 @@
+package web
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/pkg/camera"
+)
+
+const maxTriggerDuration = time.Hour
+
+type triggerRequest struct {
+	Camera   string   `json:"camera"`
+	Cameras  []string `json:"cameras"`
+	Duration string   `json:"duration"`
+	Label    string   `json:"label"`
+	Kind     string   `json:"kind"`
+}
+
+func (s *Server) requireAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.cfgMu.RLock()
+		keys := s.config.API.Keys
+		s.cfgMu.RUnlock()
+
+		if len(keys) == 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": s.tr(c, "no API keys configured")})
+			return
+		}
+
+		provided := c.GetHeader("X-API-Key")
+		if provided == "" {
+			provided = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+
+		if s.validAPIKey(provided) {
+			s.authSucceeded(c)
+			c.Next()
+			return
+		}
+
+		s.authFailed(c, "invalid API key")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": s.tr(c, "invalid API key")})
+	}
+}
+
+// validAPIKey reports whether provided is one of api.keys.
+func (s *Server) validAPIKey(provided string) bool {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+
+	for _, key := range s.config.API.Keys {
+		if key != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleTrigger(c *gin.Context) {
+	var req triggerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	names := req.Cameras
+	if req.Camera != "" {
+		names = append(names, req.Camera)
+	}
+	if len(names) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "camera or cameras is required")})
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "invalid duration %q", req.Duration)})
+			return
+		}
+		duration = min(d, maxTriggerDuration)
+	}
+
+	kind := camera.EventTrigger
+	if req.Kind != "" {
+		kind = camera.NormalizeEventKind(req.Kind)
+	}
+
+	for _, name := range names {
+		if _, ok := s.findCamera(name); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "camera %s not found", name)})
+			return
+		}
+	}
+
+	now := time.Now()
+	results := []gin.H{}
+	for _, name := range names {
+		id, err := s.ingestEvent(camera.Event{
+			Camera:   name,
+			Kind:     kind,
+			Label:    req.Label,
+			Source:   "api",
+			Time:     now,
+			Duration: duration,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		recording := false
+		if rec, ok := s.recorder.GetRecorder(name); ok {
+			recording = rec.IsRunning()
+		}
+		results = append(results, gin.H{
+			"camera":    name,
+			"event_id":  id,
+			"recording": recording,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  s.tr(c, "Recording triggered"),
+		"triggers": results,
+	})
+}
@@ -0,0 +1,350 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/config"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+)
+
+const (
+	auditLiveView        = "live_view"
+	auditLiveViewRefused = "live_view_refused"
+
+	viewerMJPEG = "mjpeg"
+	viewerHLS   = "hls"
+
+	// HLS players fetch a segment every few seconds, so a viewer that has
+	// not asked for anything in this long has left.
+	hlsViewerIdle = 30 * time.Second
+
+	// Which cap a refused live view hit.
+	refusedCamera = "camera"
+	refusedUser   = "user"
+)
+
+type viewerSession struct {
+	id        int64
+	camera    string
+	user      string
+	ip        string
+	userAgent string
+	mode      string
+	startedAt time.Time
+	lastSeen  atomic.Int64
+	bytes     atomic.Int64
+}
+
+func (v *viewerSession) json() gin.H {
+	return gin.H{
+		"id":         v.id,
+		"camera":     v.camera,
+		"user":       v.user,
+		"ip":         v.ip,
+		"mode":       v.mode,
+		"started_at": v.startedAt,
+		"last_seen":  time.UnixMilli(v.lastSeen.Load()),
+		"bytes":      v.bytes.Load(),
+	}
+}
+
+// viewer identifies the person behind a session, so several streams opened
+// by one browser count as one viewer of a camera.
+func (v *viewerSession) viewer() string {
+	return v.ip + "\x00" + v.user
+}
+
+// owner is who the session's streams count against for the per-user cap:
+// the signed-in user, or else the address, as kiosk screens and shared links
+// each have one user name for everyone.
+func (v *viewerSession) owner() string {
+	if v.user == "" || v.user == kioskUser || strings.HasPrefix(v.user, "share:") {
+		return v.viewer()
+	}
+	return v.user
+}
+
+// viewerLimits caps live viewing. Zero means no cap.
+type viewerLimits struct {
+	perCamera int
+	perUser   int
+}
+
+// viewerTracker keeps the live-view sessions in progress. An MJPEG session
+// lasts as long as its request; HLS sessions are stitched together from the
+// playlist and segment requests of one client and end when those stop.
+type viewerTracker struct {
+	mu       sync.Mutex
+	nextID   int64
+	sessions map[int64]*viewerSession
+	hls      map[string]*viewerSession
+}
+
+func newViewerTracker() *viewerTracker {
+	return &viewerTracker{
+		sessions: make(map[int64]*viewerSession),
+		hls:      make(map[string]*viewerSession),
+	}
+}
+
+func (t *viewerTracker) add(sess *viewerSession, now time.Time) {
+	t.nextID++
+	sess.id = t.nextID
+	sess.startedAt = now
+	sess.lastSeen.Store(now.UnixMilli())
+	t.sessions[sess.id] = sess
+}
+
+// admit starts sess unless that takes its camera or owner over limits, in
+// which case it returns nil and the cap hit.
+func (t *viewerTracker) admit(sess *viewerSession, limits viewerLimits, now time.Time) (*viewerSession, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if refused := t.refusal(sess, limits); refused != "" {
+		return nil, refused
+	}
+	t.add(sess, now)
+	return sess, ""
+}
+
+// refusesHLS returns the cap a new HLS session would hit, or "". Clients
+// already watching are let through.
+func (t *viewerTracker) refusesHLS(sess *viewerSession, limits viewerLimits) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.hls[hlsKey(sess)]; ok {
+		return ""
+	}
+	return t.refusal(sess, limits)
+}
+
+func (t *viewerTracker) refusal(sess *viewerSession, limits viewerLimits) string {
+	viewers := make(map[string]bool)
+	streams := 0
+	for _, other := range t.sessions {
+		if other.camera == sess.camera {
+			viewers[other.viewer()] = true
+		}
+		if other.owner() == sess.owner() {
+			streams++
+		}
+	}
+	if limits.perCamera > 0 && !viewers[sess.viewer()] && len(viewers) >= limits.perCamera {
+		return refusedCamera
+	}
+	if limits.perUser > 0 && streams >= limits.perUser {
+		return refusedUser
+	}
+	return ""
+}
+
+func hlsKey(sess *viewerSession) string {
+	return sess.camera + "\x00" + sess.viewer() + "\x00" + sess.userAgent
+}
+
+// touch returns the HLS session for the client, starting one if needed.
+func (t *viewerTracker) touch(sess *viewerSession, now time.Time) *viewerSession {
+	key := hlsKey(sess)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if existing, ok := t.hls[key]; ok {
+		existing.lastSeen.Store(now.UnixMilli())
+		return existing
+	}
+	t.add(sess, now)
+	t.hls[key] = sess
+	return sess
+}
+
+func (t *viewerTracker) end(sess *viewerSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.sessions, sess.id)
+}
+
+// expire removes the HLS sessions idle since before cutoff, or all of them
+// with a zero cutoff.
+func (t *viewerTracker) expire(cutoff time.Time) []*viewerSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var expired []*viewerSession
+	for key, sess := range t.hls {
+		if cutoff.IsZero() || sess.lastSeen.Load() < cutoff.UnixMilli() {
+			delete(t.hls, key)
+			delete(t.sessions, sess.id)
+			expired = append(expired, sess)
+		}
+	}
+	return expired
+}
+
+func (t *viewerTracker) list() []*viewerSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]*viewerSession, 0, len(t.sessions))
+	for _, sess := range t.sessions {
+		list = append(list, sess)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
+
+// counts returns the number of distinct viewers (address and user) per
+// camera, so several streams opened by one browser count once.
+func (t *viewerTracker) counts() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seen := make(map[string]bool)
+	counts := make(map[string]int)
+	for _, sess := range t.sessions {
+		key := sess.camera + "\x00" + sess.viewer()
+		if !seen[key] {
+			seen[key] = true
+			counts[sess.camera]++
+		}
+	}
+	return counts
+}
+
+// viewerUser identifies who is watching: HTTP basic auth from a protecting
+// proxy or browser, or the user header set by a trusted authenticating proxy.
+func (s *Server) viewerUser(c *gin.Context) string {
+	if user := c.GetString(ctxUser); user != "" {
+		return user
+	}
+	if user, _, ok := c.Request.BasicAuth(); ok {
+		return user
+	}
+	if !s.fromTrustedProxy(c) {
+		return ""
+	}
+	for _, header := range []string{"Remote-User", "X-Forwarded-User"} {
+		if user := c.GetHeader(header); user != "" {
+			return user
+		}
+	}
+	return ""
+}
+
+func (s *Server) newViewer(c *gin.Context, camera, user, mode string) *viewerSession {
+	return &viewerSession{
+		camera:    camera,
+		user:      user,
+		ip:        c.ClientIP(),
+		userAgent: c.Request.UserAgent(),
+		mode:      mode,
+	}
+}
+
+// viewerLimits returns the live-view caps for a camera.
+func (s *Server) viewerLimits(cam config.CameraConfig) viewerLimits {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+
+	limits := viewerLimits{
+		perCamera: s.config.Limits.MaxViewersPerCamera,
+		perUser:   s.config.Limits.MaxStreamsPerUser,
+	}
+	if cam.MaxViewers > 0 {
+		limits.perCamera = cam.MaxViewers
+	}
+	return limits
+}
+
+// liveTimeouts returns how long a live view may wait for its client to take
+// a frame, and for a frame to send.
+func (s *Server) liveTimeouts() (write, idle time.Duration) {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.config.Limits.LiveWriteTimeout, s.config.Limits.LiveIdleTimeout
+}
+
+// refuseViewer answers a live view over a cap with a page saying so, and
+// records it in the audit log.
+func (s *Server) refuseViewer(c *gin.Context, sess *viewerSession, refused string) {
+	err := s.index.AddAudit(index.AuditEntry{
+		At:     time.Now(),
+		Kind:   auditLiveViewRefused,
+		IP:     sess.ip,
+		User:   sess.user,
+		Camera: sess.camera,
+		Detail: fmt.Sprintf("%s stream, %s limit reached", sess.mode, refused),
+	})
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	msg := s.tr(c, "%s has too many viewers, try again later", sess.camera)
+	if refused == refusedUser {
+		msg = s.tr(c, "Too many live streams open, close some first")
+	}
+	c.Header("Retry-After", "30")
+	s.html(c, http.StatusTooManyRequests, "error.html", gin.H{"error": msg})
+}
+
+func (s *Server) endViewing(sess *viewerSession, endedAt time.Time) {
+	err := s.index.AddAudit(index.AuditEntry{
+		At:      sess.startedAt,
+		Kind:    auditLiveView,
+		IP:      sess.ip,
+		User:    sess.user,
+		Camera:  sess.camera,
+		EndedAt: endedAt,
+		Bytes:   sess.bytes.Load(),
+		Detail:  fmt.Sprintf("%s stream, %s", sess.mode, sess.userAgent),
+	})
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+func (s *Server) sweepViewers(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			now := time.Now()
+			for _, sess := range s.viewers.expire(time.Time{}) {
+				s.endViewing(sess, now)
+			}
+			return
+		case now := <-ticker.C:
+			for _, sess := range s.viewers.expire(now.Add(-hlsViewerIdle)) {
+				s.endViewing(sess, time.UnixMilli(sess.lastSeen.Load()))
+			}
+		}
+	}
+}
+
+func (s *Server) handleViewers(c *gin.Context) {
+	camera := c.Query("camera")
+
+	viewers := []gin.H{}
+	for _, sess := range s.viewers.list() {
+		if camera == "" || sess.camera == camera {
+			viewers = append(viewers, sess.json())
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"viewers": viewers, "count": len(viewers)})
+}
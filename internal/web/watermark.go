@@ -0,0 +1,257 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/lets-vibe/cam-recorder/internal/export"
+	"github.com/lets-vibe/cam-recorder/internal/index"
+	"github.com/lets-vibe/cam-recorder/pkg/recorder"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const maxLogoSize = 2 << 20
+
+// Uploaded logos are kept as logo.png or logo.jpg, as ffmpeg picks the image
+// decoder by extension.
+var logoExtensions = map[string]string{"png": ".png", "jpeg": ".jpg"}
+
+type stampJob struct {
+	done chan struct{}
+	err  error
+}
+
+func (s *Server) watermarkDir() string {
+	return filepath.Join(s.config.Recording.OutputDir, storage.WatermarkDir)
+}
+
+// uploadedLogo returns the path of the logo uploaded through the API, or "".
+func (s *Server) uploadedLogo() string {
+	for _, ext := range logoExtensions {
+		p := filepath.Join(s.watermarkDir(), "logo"+ext)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// watermark returns the configured watermark with extra text, such as a case
+// number, on a line below the configured text.
+func (s *Server) watermark(extra string) recorder.Watermark {
+	s.cfgMu.RLock()
+	cfg := s.config.Watermark
+	s.cfgMu.RUnlock()
+
+	var lines []string
+	for _, line := range []string{cfg.Text, extra} {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	wm := recorder.Watermark{
+		Text:     strings.Join(lines, "\n"),
+		Logo:     cfg.Logo,
+		Position: cfg.Position,
+		FontSize: cfg.FontSize,
+	}
+	if wm.Logo == "" {
+		wm.Logo = s.uploadedLogo()
+	}
+	return wm
+}
+
+// exportStamper renders a watermarked copy of each exported segment into a
+// temporary file, sharing the transcode limit with previews and recording.
+func (s *Server) exportStamper(ctx context.Context, wm recorder.Watermark) export.Stamper {
+	return func(seg index.Segment) (string, func(), error) {
+		dir, err := os.MkdirTemp("", "cam-export-")
+		if err != nil {
+			return "", nil, err
+		}
+		cleanup := func() { os.RemoveAll(dir) }
+
+		limiter := s.recorder.Limiter()
+		if !limiter.Acquire(ctx, nil) {
+			cleanup()
+			return "", nil, ctx.Err()
+		}
+		defer limiter.Release()
+
+		out := filepath.Join(dir, seg.Filename)
+		if err := wm.Render(ctx, seg.Path, out); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+		return out, cleanup, nil
+	}
+}
+
+func (s *Server) shareStampPath(share index.Share) string {
+	return filepath.Join(s.watermarkDir(), "shares", share.ID+filepath.Ext(share.Filename))
+}
+
+// stampedShare returns the watermarked copy of a shared recording, rendering
+// it on first request. Concurrent viewers wait for the same render.
+func (s *Server) stampedShare(ctx context.Context, share index.Share, src string) (string, error) {
+	out := s.shareStampPath(share)
+	if _, err := os.Stat(out); err == nil {
+		return out, nil
+	}
+
+	s.stampMu.Lock()
+	job, running := s.stampJobs[out]
+	if !running {
+		job = &stampJob{done: make(chan struct{})}
+		s.stampJobs[out] = job
+		go func() {
+			job.err = s.renderStamp(s.appContext(), s.watermark(share.WatermarkText), src, out)
+			s.stampMu.Lock()
+			delete(s.stampJobs, out)
+			s.stampMu.Unlock()
+			close(job.done)
+		}()
+	}
+	s.stampMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-job.done:
+	}
+	if job.err != nil {
+		return "", job.err
+	}
+	return out, nil
+}
+
+func (s *Server) renderStamp(ctx context.Context, wm recorder.Watermark, src, out string) error {
+	limiter := s.recorder.Limiter()
+	if !limiter.Acquire(ctx, nil) {
+		return ctx.Err()
+	}
+	defer limiter.Release()
+
+	tmp := strings.TrimSuffix(out, filepath.Ext(out)) + ".part" + filepath.Ext(out)
+	if err := wm.Render(ctx, src, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to finalize watermarked copy: %w", err)
+	}
+	return nil
+}
+
+// sweepShareStamps removes watermarked copies of shares that can no longer
+// be viewed.
+func (s *Server) sweepShareStamps(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			shares, err := s.index.Shares()
+			if err != nil {
+				log.Printf("Warning: Failed to sweep watermarked shares: %v", err)
+				continue
+			}
+			for _, share := range shares {
+				if share.Watermark && !share.Active(now) {
+					os.Remove(s.shareStampPath(share))
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) handleWatermarkGet(c *gin.Context) {
+	s.cfgMu.RLock()
+	cfg := s.config.Watermark
+	s.cfgMu.RUnlock()
+
+	logo := "none"
+	if cfg.Logo != "" {
+		logo = "config"
+	} else if s.uploadedLogo() != "" {
+		logo = "uploaded"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"text":      cfg.Text,
+		"position":  cfg.Position,
+		"font_size": cfg.FontSize,
+		"logo":      logo,
+	})
+}
+
+// handleWatermarkLogoUpload stores a PNG or JPEG sent as the request body as
+// the watermark logo.
+func (s *Server) handleWatermarkLogoUpload(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxLogoSize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": s.tr(c, "logo must be at most %d MB", maxLogoSize>>20)})
+		return
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	ext, ok := logoExtensions[format]
+	if err != nil || !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": s.tr(c, "logo must be a PNG or JPEG image")})
+		return
+	}
+
+	dir := s.watermarkDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	dst := filepath.Join(dir, "logo"+ext)
+	tmp := dst + ".part"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, other := range logoExtensions {
+		if other != ext {
+			os.Remove(filepath.Join(dir, "logo"+other))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Logo uploaded")})
+}
+
+func (s *Server) handleWatermarkLogoDelete(c *gin.Context) {
+	removed := false
+	for _, ext := range logoExtensions {
+		if os.Remove(filepath.Join(s.watermarkDir(), "logo"+ext)) == nil {
+			removed = true
+		}
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": s.tr(c, "No logo uploaded")})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": s.tr(c, "Logo removed")})
+}
@@ -0,0 +1,186 @@
+package camera
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/command"
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+)
+
+// EventAudio is raised when a camera's microphone picks up a loud noise.
+const EventAudio = "audio"
+
+// The audio is measured in windows of this length.
+const audioWindow = 100 * time.Millisecond
+
+var rmsLevelPattern = regexp.MustCompile(`RMS_level=(-?[0-9.]+|-inf)`)
+
+// AudioTarget is a camera whose audio is watched for noises louder than
+// Threshold (in dBFS, so below 0) lasting at least MinDuration.
+type AudioTarget struct {
+	Name        string
+	URL         string
+	Threshold   float64
+	MinDuration time.Duration
+}
+
+// AudioMonitor measures the loudness of cameras' audio with ffmpeg and raises
+// an EventAudio when it goes above a target's threshold. A noise raises one
+// event however long it lasts; the next needs the level to drop below the
+// threshold first.
+type AudioMonitor struct {
+	targets func() []AudioTarget
+	handler func(Event)
+	loops   map[AudioTarget]context.CancelFunc
+	mu      sync.Mutex
+}
+
+func NewAudioMonitor(targets func() []AudioTarget, handler func(Event)) *AudioMonitor {
+	return &AudioMonitor{
+		targets: targets,
+		handler: handler,
+		loops:   make(map[AudioTarget]context.CancelFunc),
+	}
+}
+
+func (m *AudioMonitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		m.sync(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.sync(ctx)
+			}
+		}
+	}()
+}
+
+func (m *AudioMonitor) sync(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[AudioTarget]bool)
+	for _, target := range m.targets() {
+		wanted[target] = true
+	}
+
+	for target, cancel := range m.loops {
+		if !wanted[target] {
+			cancel()
+			delete(m.loops, target)
+		}
+	}
+
+	for target := range wanted {
+		if _, ok := m.loops[target]; ok {
+			continue
+		}
+		loopCtx, cancel := context.WithCancel(ctx)
+		m.loops[target] = cancel
+		go m.run(loopCtx, target)
+	}
+}
+
+func (m *AudioMonitor) run(ctx context.Context, target AudioTarget) {
+	retryDelay := 10 * time.Second
+
+	for {
+		started := time.Now()
+		err := m.listen(ctx, target)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > 5*time.Minute {
+			retryDelay = 10 * time.Second
+		}
+		log.Printf("[%s] Audio monitoring stopped: %v. Retrying in %v...", target.Name, err, retryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+		retryDelay = min(retryDelay*2, 5*time.Minute)
+	}
+}
+
+// listen runs ffmpeg on the camera's audio, printing the RMS level of each
+// window, until the stream ends.
+func (m *AudioMonitor) listen(ctx context.Context, target AudioTarget) error {
+	args := []string{"-hide_banner", "-nostats"}
+	args = append(args, source.InputArgs(target.URL)...)
+	args = append(args,
+		"-vn",
+		"-af", fmt.Sprintf("aresample=8000,asetnsamples=n=%d,astats=metadata=1:reset=1,ametadata=mode=print:key=lavfi.astats.Overall.RMS_level",
+			int(audioWindow.Seconds()*8000)),
+		"-f", "null", "-",
+	)
+	cmd := command.Context(ctx, "ffmpeg", args...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	var (
+		loudFor  time.Duration
+		peak     float64
+		reported bool
+		lastLine string
+	)
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		match := rmsLevelPattern.FindStringSubmatch(line)
+		if match == nil {
+			if strings.TrimSpace(line) != "" && !strings.Contains(line, "pts_time:") {
+				lastLine = line
+			}
+			continue
+		}
+
+		level, err := strconv.ParseFloat(match[1], 64)
+		if err != nil || level < target.Threshold {
+			loudFor, peak, reported = 0, 0, false
+			continue
+		}
+		if loudFor == 0 || level > peak {
+			peak = level
+		}
+		loudFor += audioWindow
+		if !reported && loudFor >= max(target.MinDuration, audioWindow) {
+			reported = true
+			m.handler(Event{
+				Camera: target.Name,
+				Kind:   EventAudio,
+				Label:  fmt.Sprintf("Loud noise (%.0f dBFS)", peak),
+				Source: "audio",
+				Time:   time.Now().Add(-loudFor),
+			})
+		}
+	}
+
+	err = cmd.Wait()
+	if err == nil {
+		err = fmt.Errorf("audio stream ended")
+	} else if lastLine != "" {
+		err = fmt.Errorf("ffmpeg: %w: %s", err, lastLine)
+	}
+	return err
+}
@@ -1,12 +1,18 @@
+// Package camera probes and discovers IP cameras, measures their clock drift
+// and receives their motion and alarm events.
 package camera
 
 import (
 	"context"
 	"fmt"
 	"net"
-	"os/exec"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/command"
+	"github.com/lets-vibe/cam-recorder/pkg/source"
 )
 
 type Camera struct {
@@ -33,13 +39,9 @@ func (c *Camera) TestConnection(timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "ffmpeg",
-		"-rtsp_transport", "tcp",
-		"-i", c.RTSPURL,
-		"-frames:v", "1",
-		"-f", "null",
-		"-",
-	)
+	args := source.InputArgs(c.RTSPURL)
+	args = append(args, "-frames:v", "1", "-f", "null", "-")
+	cmd := command.Context(ctx, "ffmpeg", args...)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -57,12 +59,24 @@ func (c *Camera) Disconnect() {
 }
 
 type DiscoveryResult struct {
-	IP       string
-	Port     int
+	IP   string
+	Port int
+	// Vendor is the brand fingerprinted from the camera's web interface,
+	// empty when it was not recognised.
+	Vendor   string
 	RTSPURLs []string
 }
 
+// DiscoverCameras probes network for cameras using the built-in RTSP path
+// database.
 func DiscoverCameras(network string, timeout time.Duration) ([]DiscoveryResult, error) {
+	return BuiltinPathDB().Discover(network, timeout)
+}
+
+// Discover probes every host of network on the RTSP ports. Hosts with a port
+// open are fingerprinted and probed on their vendor's paths, falling back to
+// the discovery paths when the vendor is not recognised or none answer.
+func (db *PathDB) Discover(network string, timeout time.Duration) ([]DiscoveryResult, error) {
 	var results []DiscoveryResult
 
 	if network == "" {
@@ -74,17 +88,6 @@ func DiscoverCameras(network string, timeout time.Duration) ([]DiscoveryResult,
 		return nil, fmt.Errorf("invalid network CIDR: %w", err)
 	}
 
-	commonPaths := []string{
-		"/udp/av0_0",
-		"/tcp/av0_0",
-		"/live/ch0",
-		"/live/ch00_0",
-		"/stream1",
-		"/h264",
-		"/video1",
-		"/cam/realmonitor?channel=1&subtype=0",
-	}
-
 	baseIP := ipnet.IP.Mask(ipnet.Mask)
 	ones, _ := ipnet.Mask.Size()
 	numHosts := 1 << (32 - ones)
@@ -102,12 +105,32 @@ func DiscoverCameras(network string, timeout time.Duration) ([]DiscoveryResult,
 		}
 
 		ipStr := ip.String()
+		vendor, identified := "", false
 		for _, port := range []int{554, 8554} {
-			rtspURLs := probeRTSP(ipStr, port, commonPaths, timeout)
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(ipStr, strconv.Itoa(port)), timeout)
+			if err != nil {
+				continue
+			}
+			conn.Close()
+
+			if !identified {
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				_, vendor, _ = fingerprintHTTP(ctx, "rtsp://"+ipStr+"/", timeout)
+				cancel()
+				identified = true
+			}
+			var rtspURLs []string
+			if known := db.Lookup(vendor, ""); len(known) > 0 {
+				rtspURLs = probeRTSP(ipStr, port, ExpandPaths(known, 1), timeout)
+			}
+			if len(rtspURLs) == 0 {
+				rtspURLs = probeRTSP(ipStr, port, db.DiscoveryPaths(1), timeout)
+			}
 			if len(rtspURLs) > 0 {
 				results = append(results, DiscoveryResult{
 					IP:       ipStr,
 					Port:     port,
+					Vendor:   vendor,
 					RTSPURLs: rtspURLs,
 				})
 			}
@@ -125,7 +148,7 @@ func probeRTSP(ip string, port int, paths []string, timeout time.Duration) []str
 
 		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 
-		cmd := exec.CommandContext(ctx, "ffprobe",
+		cmd := command.Context(ctx, "ffprobe",
 			"-rtsp_transport", "tcp",
 			"-i", rtspURL,
 			"-show_entries", "stream=codec_name",
@@ -144,11 +167,24 @@ func probeRTSP(ip string, port int, paths []string, timeout time.Duration) []str
 	return validURLs
 }
 
+// BuildRTSPURL joins a camera's address, credentials and stream path into
+// an RTSP URL. Credentials are escaped and left out when username is empty,
+// and the default port 554 is left out too.
 func BuildRTSPURL(ip string, port int, username, password, path string) string {
-	if port == 554 {
-		return fmt.Sprintf("rtsp://%s:%s@%s%s", username, password, ip, path)
+	u := url.URL{Scheme: "rtsp", Host: ip}
+	if strings.Contains(ip, ":") {
+		u.Host = "[" + ip + "]"
+	}
+	if port != 554 && port != 0 {
+		u.Host = net.JoinHostPort(ip, strconv.Itoa(port))
+	}
+	if username != "" {
+		u.User = url.UserPassword(username, password)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
 	}
-	return fmt.Sprintf("rtsp://%s:%s@%s:%d%s", username, password, ip, port, path)
+	return u.String() + path
 }
 
 func ExtractCredentials(rtspURL string) (username, password, host, port, path string, err error) {
@@ -189,29 +225,27 @@ func ExtractCredentials(rtspURL string) (username, password, host, port, path st
 	return
 }
 
+// DefaultRTSPPaths returns the generic paths of the built-in path database,
+// tried on cameras of an unknown vendor.
 func DefaultRTSPPaths() []string {
-	return []string{
-		"/udp/av0_0",
-		"/tcp/av0_0",
-		"/live/ch0",
-		"/stream1",
-		"/h264",
-		"/video1",
+	var paths []string
+	for _, p := range BuiltinPathDB().Lookup(genericVendor, "") {
+		paths = append(paths, p.Path)
 	}
+	return paths
 }
 
 func GetStreamInfo(rtspURL string, timeout time.Duration) (*StreamInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "ffprobe",
-		"-rtsp_transport", "tcp",
-		"-i", rtspURL,
+	args := source.InputArgs(rtspURL)
+	args = append(args,
 		"-show_entries", "stream=codec_name",
-		"-show_entries", "format=format_name",
 		"-v", "quiet",
 		"-of", "csv=p=0",
 	)
+	cmd := command.Context(ctx, "ffprobe", args...)
 
 	output, err := cmd.Output()
 	if err != nil {
@@ -222,7 +256,7 @@ func GetStreamInfo(rtspURL string, timeout time.Duration) (*StreamInfo, error) {
 	var codecs []string
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
-		if line != "" && !strings.Contains(line, "format") {
+		if line != "" {
 			codecs = append(codecs, line)
 		}
 	}
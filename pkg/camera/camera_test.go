@@ -0,0 +1,121 @@
+package camera
+
+import (
+	"net"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/command"
+)
+
+func TestMain(m *testing.M) {
+	command.RunFake()
+	os.Exit(m.Run())
+}
+
+// useFake installs a fake ffmpeg and ffprobe, failing with fail when set,
+// for the rest of the test.
+func useFake(t *testing.T, fail string) *command.Fake {
+	t.Helper()
+	f := &command.Fake{Fail: fail}
+	command.Set(f)
+	t.Cleanup(func() { command.Set(command.Exec{}) })
+	return f
+}
+
+func TestDiscoverWithFakeFFprobe(t *testing.T) {
+	// A host of 127.0.0.0/30 with the alternative RTSP port open.
+	ln, err := net.Listen("tcp", "127.0.0.1:8554")
+	if err != nil {
+		t.Skipf("cannot listen on the RTSP port: %v", err)
+	}
+	defer ln.Close()
+
+	db := BuiltinPathDB()
+	tests := []struct {
+		name string
+		fail string
+		want []string
+	}{
+		{"stream answers", "", db.DiscoveryPaths(1)},
+		{"stream refused", "Connection refused", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFake(t, tt.fail)
+			results, err := db.Discover("127.0.0.0/30", 2*time.Second)
+			if err != nil {
+				t.Fatalf("Discover: %v", err)
+			}
+
+			var probed []string
+			for _, call := range fake.Calls() {
+				if call.Name == "ffprobe" {
+					probed = append(probed, call.Args[slices.Index(call.Args, "-i")+1])
+				}
+			}
+			if len(probed) == 0 {
+				t.Fatal("no stream was probed")
+			}
+
+			if tt.want == nil {
+				if len(results) != 0 {
+					t.Errorf("found %v, want nothing", results)
+				}
+				return
+			}
+			if len(results) != 1 || results[0].IP != "127.0.0.1" || results[0].Port != 8554 {
+				t.Fatalf("found %v, want 127.0.0.1:8554", results)
+			}
+			if got := results[0].RTSPURLs; len(got) != len(tt.want) {
+				t.Errorf("found %d stream URLs, want %d", len(got), len(tt.want))
+			}
+			for _, url := range results[0].RTSPURLs {
+				if !slices.Contains(probed, url) {
+					t.Errorf("%s was found without being probed", url)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamInfoWithFakeFFprobe(t *testing.T) {
+	tests := []struct {
+		name   string
+		fail   string
+		codecs []string
+	}{
+		{"h264 with aac", "", []string{"h264", "aac"}},
+		{"unreachable", "Connection refused", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFake(t, tt.fail)
+			info, err := GetStreamInfo("rtsp://camera.local/stream", 5*time.Second)
+			if tt.codecs == nil {
+				if err == nil {
+					t.Errorf("got %v, want an error", info)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetStreamInfo: %v", err)
+			}
+			if !slices.Equal(info.Codecs, tt.codecs) {
+				t.Errorf("codecs %v, want %v", info.Codecs, tt.codecs)
+			}
+		})
+	}
+}
+
+func TestConnectionWithFakeFFmpeg(t *testing.T) {
+	for _, fail := range []string{"", "Connection refused"} {
+		useFake(t, fail)
+		err := New("Front Door", "rtsp://camera.local/stream").TestConnection(5 * time.Second)
+		if (err != nil) != (fail != "") {
+			t.Errorf("fail %q: TestConnection returned %v", fail, err)
+		}
+	}
+}
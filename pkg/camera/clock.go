@@ -0,0 +1,219 @@
+package camera
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/onvif"
+)
+
+type ClockTarget struct {
+	Name     string
+	RTSPURL  string
+	ONVIFURL string
+}
+
+type ClockReading struct {
+	Camera       string    `json:"camera"`
+	Source       string    `json:"source,omitempty"`
+	CameraTime   time.Time `json:"camera_time,omitzero"`
+	ServerTime   time.Time `json:"server_time"`
+	DriftSeconds float64   `json:"drift_seconds"`
+	Exceeded     bool      `json:"exceeded"`
+	Error        string    `json:"error,omitempty"`
+}
+
+func MeasureClockDrift(ctx context.Context, target ClockTarget, timeout time.Duration) (ClockReading, error) {
+	reading := ClockReading{Camera: target.Name}
+
+	username, password, _, _, _, _ := ExtractCredentials(target.RTSPURL)
+
+	deviceURL := target.ONVIFURL
+	if deviceURL == "" {
+		if derived, err := onvif.DeviceURL(target.RTSPURL); err == nil {
+			deviceURL = derived
+		}
+	}
+
+	var onvifErr error
+	if deviceURL != "" {
+		client := onvif.NewClient(deviceURL, username, password, timeout)
+		sent := time.Now()
+		cameraTime, err := client.GetSystemDateAndTime(ctx)
+		onvifErr = err
+		if err == nil {
+			reading.Source = "onvif"
+			reading.CameraTime = cameraTime
+			reading.ServerTime = midpoint(sent, time.Now())
+			reading.DriftSeconds = cameraTime.Sub(reading.ServerTime).Seconds()
+			return reading, nil
+		}
+	}
+
+	sent := time.Now()
+	cameraTime, err := rtspDate(ctx, target.RTSPURL, timeout)
+	if err != nil {
+		reading.ServerTime = time.Now()
+		if onvifErr != nil {
+			return reading, fmt.Errorf("no camera clock source available: onvif: %v; rtsp: %w", onvifErr, err)
+		}
+		return reading, fmt.Errorf("no camera clock source available: %w", err)
+	}
+
+	reading.Source = "rtsp"
+	reading.CameraTime = cameraTime
+	reading.ServerTime = midpoint(sent, time.Now())
+	reading.DriftSeconds = cameraTime.Sub(reading.ServerTime).Seconds()
+	return reading, nil
+}
+
+func midpoint(a, b time.Time) time.Time {
+	return a.Add(b.Sub(a) / 2)
+}
+
+func rtspDate(ctx context.Context, rtspURL string, timeout time.Duration) (time.Time, error) {
+	u, err := url.Parse(rtspURL)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid RTSP URL: %w", err)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "554"
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return time.Time{}, fmt.Errorf("failed to set deadline: %w", err)
+	}
+
+	u.User = nil
+	request := fmt.Sprintf("OPTIONS %s RTSP/1.0\r\nCSeq: 1\r\nUser-Agent: cam-recorder\r\n\r\n", u.String())
+	if _, err := conn.Write([]byte(request)); err != nil {
+		return time.Time{}, fmt.Errorf("failed to send OPTIONS: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read response: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "Date") {
+			continue
+		}
+
+		date, err := http.ParseTime(strings.TrimSpace(value))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid Date header %q", value)
+		}
+		return date, nil
+	}
+
+	return time.Time{}, fmt.Errorf("camera did not send a Date header")
+}
+
+type ClockMonitor struct {
+	interval time.Duration
+	maxDrift time.Duration
+	timeout  time.Duration
+	targets  func() []ClockTarget
+	readings map[string]ClockReading
+	mu       sync.RWMutex
+}
+
+// NewClockMonitor returns a monitor reading the clock of every target each
+// interval; timeout bounds each of the ONVIF and RTSP attempts.
+func NewClockMonitor(interval, maxDrift, timeout time.Duration, targets func() []ClockTarget) *ClockMonitor {
+	return &ClockMonitor{
+		interval: interval,
+		maxDrift: maxDrift,
+		timeout:  timeout,
+		targets:  targets,
+		readings: make(map[string]ClockReading),
+	}
+}
+
+func (m *ClockMonitor) Start(ctx context.Context) {
+	if m.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		m.check(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.check(ctx)
+			}
+		}
+	}()
+}
+
+// check reads every camera's clock at once, so cameras that do not answer
+// hold up no one else's reading.
+func (m *ClockMonitor) check(ctx context.Context) {
+	var mu sync.Mutex
+	readings := make(map[string]ClockReading)
+
+	var wg sync.WaitGroup
+	for _, target := range m.targets() {
+		wg.Go(func() {
+			reading, err := MeasureClockDrift(ctx, target, m.timeout)
+			if err != nil {
+				reading.Error = err.Error()
+			} else if m.maxDrift > 0 && absDuration(time.Duration(reading.DriftSeconds*float64(time.Second))) > m.maxDrift {
+				reading.Exceeded = true
+				log.Printf("[%s] Camera clock drifts %.1fs from server time (%s)",
+					target.Name, reading.DriftSeconds, reading.Source)
+			}
+			mu.Lock()
+			readings[target.Name] = reading
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	m.readings = readings
+	m.mu.Unlock()
+}
+
+func (m *ClockMonitor) Reading(name string) (ClockReading, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	reading, ok := m.readings[name]
+	return reading, ok
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,244 @@
+package camera
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/onvif"
+)
+
+const (
+	deviceCheckInterval = time.Hour
+	// deviceRefreshAfter is how long identified cameras go before being
+	// asked again, so firmware updates show up within a day.
+	deviceRefreshAfter = 24 * time.Hour
+)
+
+// DeviceInfo identifies the hardware behind a camera. Cameras without ONVIF
+// are fingerprinted from their web interface, which usually gives only the
+// vendor.
+type DeviceInfo struct {
+	Camera       string    `json:"camera"`
+	Source       string    `json:"source,omitempty"`
+	Manufacturer string    `json:"manufacturer,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	Firmware     string    `json:"firmware,omitempty"`
+	Serial       string    `json:"serial,omitempty"`
+	HardwareID   string    `json:"hardware_id,omitempty"`
+	HTTPServer   string    `json:"http_server,omitempty"`
+	CheckedAt    time.Time `json:"checked_at,omitzero"`
+	// Error is why the last check failed. The fields above are then from
+	// the last check that succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// httpVendors are substrings of the Server header or login realm of camera
+// web interfaces, and the vendor they give away.
+var httpVendors = []struct{ Match, Vendor string }{
+	{"hikvision", "Hikvision"},
+	{"app-webs", "Hikvision"},
+	{"dnvrs-webs", "Hikvision"},
+	{"dahua", "Dahua"},
+	{"amcrest", "Amcrest"},
+	{"axis", "Axis"},
+	{"reolink", "Reolink"},
+	{"uniview", "Uniview"},
+	{"hanwha", "Hanwha"},
+	{"samsung", "Hanwha"},
+	{"vivotek", "Vivotek"},
+	{"foscam", "Foscam"},
+	{"ubiquiti", "Ubiquiti"},
+	{"unifi", "Ubiquiti"},
+	{"mobotix", "Mobotix"},
+	{"tp-link", "TP-Link"},
+}
+
+// IdentifyDevice asks a camera for its vendor, model, firmware and serial
+// over ONVIF, falling back to fingerprinting its web interface.
+func IdentifyDevice(ctx context.Context, target ClockTarget, timeout time.Duration) (DeviceInfo, error) {
+	info := DeviceInfo{Camera: target.Name, CheckedAt: time.Now()}
+
+	username, password, _, _, _, _ := ExtractCredentials(target.RTSPURL)
+
+	deviceURL := target.ONVIFURL
+	if deviceURL == "" {
+		if derived, err := onvif.DeviceURL(target.RTSPURL); err == nil {
+			deviceURL = derived
+		}
+	}
+
+	var onvifErr error
+	if deviceURL != "" {
+		client := onvif.NewClient(deviceURL, username, password, timeout)
+		device, err := client.GetDeviceInformation(ctx)
+		if err == nil {
+			info.Source = "onvif"
+			info.Manufacturer = strings.TrimSpace(device.Manufacturer)
+			info.Model = strings.TrimSpace(device.Model)
+			info.Firmware = strings.TrimSpace(device.FirmwareVersion)
+			info.Serial = strings.TrimSpace(device.SerialNumber)
+			info.HardwareID = strings.TrimSpace(device.HardwareID)
+			return info, nil
+		}
+		onvifErr = err
+	}
+
+	server, vendor, err := fingerprintHTTP(ctx, target.RTSPURL, timeout)
+	if err != nil {
+		if onvifErr != nil {
+			return info, fmt.Errorf("failed to identify camera: %v; %w", onvifErr, err)
+		}
+		return info, fmt.Errorf("failed to identify camera: %w", err)
+	}
+	info.Source = "http"
+	info.Manufacturer = vendor
+	info.HTTPServer = server
+	return info, nil
+}
+
+// fingerprintHTTP fetches the camera's web interface and returns its Server
+// header and, when recognised, its vendor.
+func fingerprintHTTP(ctx context.Context, rtspURL string, timeout time.Duration) (string, string, error) {
+	u, err := url.Parse(rtspURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid RTSP URL: %w", err)
+	}
+	if u.Hostname() == "" {
+		return "", "", fmt.Errorf("RTSP URL has no host")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+net.JoinHostPort(u.Hostname(), "80")+"/", nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("User-Agent", "cam-recorder")
+
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("web interface not reachable: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	server := resp.Header.Get("Server")
+	clues := strings.ToLower(server + " " + resp.Header.Get("WWW-Authenticate") + " " + string(body))
+	for _, v := range httpVendors {
+		if strings.Contains(clues, v.Match) {
+			return server, v.Vendor, nil
+		}
+	}
+	if server == "" {
+		return "", "", fmt.Errorf("web interface did not identify itself")
+	}
+	return server, "", nil
+}
+
+// DeviceMonitor identifies cameras in the background, asking each again once
+// a day.
+type DeviceMonitor struct {
+	targets func() []ClockTarget
+	hook    func(DeviceInfo)
+	devices map[string]DeviceInfo
+	mu      sync.RWMutex
+}
+
+func NewDeviceMonitor(targets func() []ClockTarget) *DeviceMonitor {
+	return &DeviceMonitor{
+		targets: targets,
+		devices: make(map[string]DeviceInfo),
+	}
+}
+
+// SetHook sets the function called with every camera identified, to save it.
+func (m *DeviceMonitor) SetHook(hook func(DeviceInfo)) {
+	m.hook = hook
+}
+
+// Load seeds the monitor with saved device information, so it shows before
+// the cameras are asked again.
+func (m *DeviceMonitor) Load(devices []DeviceInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, info := range devices {
+		m.devices[info.Camera] = info
+	}
+}
+
+func (m *DeviceMonitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(deviceCheckInterval)
+		defer ticker.Stop()
+
+		m.check(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.check(ctx)
+			}
+		}
+	}()
+}
+
+// check identifies the cameras never identified, or not for a day. Cameras
+// that fail are tried again at the next check.
+func (m *DeviceMonitor) check(ctx context.Context) {
+	for _, target := range m.targets() {
+		prev, ok := m.Info(target.Name)
+		if ok && prev.Error == "" && time.Since(prev.CheckedAt) < deviceRefreshAfter {
+			continue
+		}
+
+		info, err := IdentifyDevice(ctx, target, 10*time.Second)
+		if ctx.Err() != nil {
+			return
+		}
+		// A fingerprint says less than ONVIF did, so one ONVIF failure does
+		// not lose the model and firmware.
+		if err == nil && info.Source == "http" && prev.Source == "onvif" {
+			err = fmt.Errorf("camera did not answer over ONVIF")
+		}
+		if err != nil {
+			if prev.Error == "" {
+				log.Printf("Warning: [%s] %v", target.Name, err)
+			}
+			prev.Camera = target.Name
+			prev.Error = err.Error()
+			info = prev
+		} else {
+			if ok && prev.Firmware != "" && info.Firmware != prev.Firmware {
+				log.Printf("[%s] Camera firmware changed from %s to %s", target.Name, prev.Firmware, info.Firmware)
+			}
+			if m.hook != nil {
+				m.hook(info)
+			}
+		}
+
+		m.mu.Lock()
+		m.devices[target.Name] = info
+		m.mu.Unlock()
+	}
+}
+
+func (m *DeviceMonitor) Info(name string) (DeviceInfo, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	info, ok := m.devices[name]
+	return info, ok
+}
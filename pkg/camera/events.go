@@ -0,0 +1,286 @@
+package camera
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/onvif"
+)
+
+const (
+	EventMotion       = "motion"
+	EventLineCrossing = "line_crossing"
+	EventIntrusion    = "intrusion"
+	EventTamper       = "tamper"
+	EventAlarm        = "alarm"
+	EventTrigger      = "trigger"
+)
+
+const maxEventBody = 1 << 20
+
+type Event struct {
+	Camera   string
+	Kind     string
+	Label    string
+	Source   string
+	Time     time.Time
+	Duration time.Duration
+}
+
+func NormalizeEventKind(raw string) string {
+	kind := strings.ToLower(strings.TrimSpace(raw))
+	switch {
+	case kind == "":
+		return EventMotion
+	case strings.Contains(kind, "motion"), kind == "vmd":
+		return EventMotion
+	case strings.Contains(kind, "linedetect"), strings.Contains(kind, "linecross"),
+		strings.Contains(kind, "crossed"), strings.Contains(kind, "tripwire"):
+		return EventLineCrossing
+	case strings.Contains(kind, "field"), strings.Contains(kind, "intrusion"), strings.Contains(kind, "region"):
+		return EventIntrusion
+	case strings.Contains(kind, "tamper"), strings.Contains(kind, "shelter"):
+		return EventTamper
+	case strings.Contains(kind, "alarm"), strings.Contains(kind, "digitalinput"), kind == "io":
+		return EventAlarm
+	}
+
+	if i := strings.LastIndexAny(kind, "/:"); i != -1 {
+		kind = kind[i+1:]
+	}
+	return strings.ReplaceAll(kind, " ", "_")
+}
+
+type pushPayload struct {
+	Kind  string    `json:"kind"`
+	Label string    `json:"label"`
+	Time  time.Time `json:"time"`
+}
+
+type hikvisionAlert struct {
+	XMLName     xml.Name `xml:"EventNotificationAlert"`
+	DateTime    string   `xml:"dateTime"`
+	EventType   string   `xml:"eventType"`
+	EventState  string   `xml:"eventState"`
+	Description string   `xml:"eventDescription"`
+}
+
+// ParseEventPush accepts JSON, Hikvision EventNotificationAlert XML (optionally
+// inside multipart/form-data) or an empty body; it reports false for "inactive" alerts.
+func ParseEventPush(contentType string, body io.Reader) (Event, bool, error) {
+	ev := Event{Source: "http", Time: time.Now()}
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case mediaType == "application/json":
+		var p pushPayload
+		if err := json.NewDecoder(io.LimitReader(body, maxEventBody)).Decode(&p); err != nil && err != io.EOF {
+			return ev, false, fmt.Errorf("invalid event JSON: %w", err)
+		}
+		ev.Kind = NormalizeEventKind(p.Kind)
+		ev.Label = p.Label
+		if !p.Time.IsZero() {
+			ev.Time = p.Time
+		}
+		return ev, true, nil
+
+	case strings.HasSuffix(mediaType, "xml"):
+		return parseHikvisionAlert(ev, io.LimitReader(body, maxEventBody))
+
+	case strings.HasPrefix(mediaType, "multipart/"):
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return ev, false, fmt.Errorf("invalid multipart event: %w", err)
+			}
+			if strings.HasSuffix(part.Header.Get("Content-Type"), "xml") || strings.HasSuffix(part.FileName(), ".xml") {
+				return parseHikvisionAlert(ev, io.LimitReader(part, maxEventBody))
+			}
+		}
+	}
+
+	ev.Kind = EventMotion
+	return ev, true, nil
+}
+
+func parseHikvisionAlert(ev Event, r io.Reader) (Event, bool, error) {
+	var alert hikvisionAlert
+	if err := xml.NewDecoder(r).Decode(&alert); err != nil {
+		return ev, false, fmt.Errorf("invalid event XML: %w", err)
+	}
+
+	ev.Kind = NormalizeEventKind(alert.EventType)
+	ev.Label = alert.Description
+	if t, err := time.Parse(time.RFC3339, alert.DateTime); err == nil {
+		ev.Time = t
+	}
+
+	return ev, !strings.EqualFold(alert.EventState, "inactive"), nil
+}
+
+type EventTarget struct {
+	Name     string
+	RTSPURL  string
+	ONVIFURL string
+}
+
+type EventSubscriber struct {
+	targets func() []EventTarget
+	handler func(Event)
+	loops   map[string]context.CancelFunc
+	mu      sync.Mutex
+}
+
+func NewEventSubscriber(targets func() []EventTarget, handler func(Event)) *EventSubscriber {
+	return &EventSubscriber{
+		targets: targets,
+		handler: handler,
+		loops:   make(map[string]context.CancelFunc),
+	}
+}
+
+func (s *EventSubscriber) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		s.sync(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sync(ctx)
+			}
+		}
+	}()
+}
+
+func (s *EventSubscriber) sync(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]EventTarget)
+	for _, target := range s.targets() {
+		wanted[target.Name+"\x00"+target.RTSPURL+"\x00"+target.ONVIFURL] = target
+	}
+
+	for key, cancel := range s.loops {
+		if _, ok := wanted[key]; !ok {
+			cancel()
+			delete(s.loops, key)
+		}
+	}
+
+	for key, target := range wanted {
+		if _, ok := s.loops[key]; ok {
+			continue
+		}
+		loopCtx, cancel := context.WithCancel(ctx)
+		s.loops[key] = cancel
+		go s.run(loopCtx, target)
+	}
+}
+
+func (s *EventSubscriber) run(ctx context.Context, target EventTarget) {
+	username, password, _, _, _, _ := ExtractCredentials(target.RTSPURL)
+
+	deviceURL := target.ONVIFURL
+	if deviceURL == "" {
+		derived, err := onvif.DeviceURL(target.RTSPURL)
+		if err != nil {
+			log.Printf("[%s] ONVIF events disabled: %v", target.Name, err)
+			return
+		}
+		deviceURL = derived
+	}
+
+	client := onvif.NewClient(deviceURL, username, password, 30*time.Second)
+	retryDelay := 10 * time.Second
+
+	for {
+		err := s.subscribe(ctx, client, target.Name)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			retryDelay = 10 * time.Second
+			continue
+		}
+		log.Printf("[%s] ONVIF event subscription failed: %v. Retrying in %v...", target.Name, err, retryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+		retryDelay = min(retryDelay*2, 5*time.Minute)
+	}
+}
+
+func (s *EventSubscriber) subscribe(ctx context.Context, client *onvif.Client, name string) error {
+	eventsURL, err := client.EventsURL(ctx)
+	if err != nil {
+		return err
+	}
+
+	subscription, err := client.CreatePullPointSubscription(ctx, eventsURL, 10*time.Minute)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		unsubscribeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client.Unsubscribe(unsubscribeCtx, subscription)
+	}()
+
+	renewAt := time.Now().Add(5 * time.Minute)
+	for time.Now().Before(renewAt) {
+		events, err := client.PullMessages(ctx, subscription, 20*time.Second, 32)
+		if err != nil {
+			return err
+		}
+
+		for _, ev := range events {
+			if !eventActive(ev) {
+				continue
+			}
+			s.handler(Event{
+				Camera: name,
+				Kind:   NormalizeEventKind(ev.Topic),
+				Label:  ev.Topic,
+				Source: "onvif",
+				Time:   ev.Time,
+			})
+		}
+	}
+
+	return nil
+}
+
+func eventActive(ev onvif.Event) bool {
+	if ev.Operation == "Initialized" {
+		return false
+	}
+	for _, value := range ev.Data {
+		if strings.EqualFold(value, "true") || value == "1" {
+			return true
+		}
+	}
+	return false
+}
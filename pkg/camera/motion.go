@@ -0,0 +1,449 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/command"
+	"github.com/lets-vibe/cam-recorder/pkg/schedule"
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+)
+
+// DefaultMotionSensitivity is used when a camera's sensitivity is not set.
+const DefaultMotionSensitivity = 50
+
+// Motion is looked for in grey frames this small, this many times a second.
+const (
+	motionWidth  = 160
+	motionHeight = 90
+	motionFPS    = 5
+)
+
+const (
+	// motionFrames is how many frames in a row must show motion before an
+	// event is raised, so noise in a single frame does not.
+	motionFrames = 2
+	// motionQuietFrames is how many frames without motion end it, so the
+	// next motion raises a new event.
+	motionQuietFrames = 2 * motionFPS
+	// motionLightingChange is the share of the whole picture that, when it
+	// changes at once, is taken for lights or the camera's IR switching
+	// rather than motion.
+	motionLightingChange = 0.5
+	// motionLearnRate is how fast the background takes in what stays still.
+	motionLearnRate = 0.1
+)
+
+// Point is a spot on the picture, as fractions of its width and height from
+// the top left.
+type Point struct {
+	X float64 `mapstructure:"x" yaml:"x" json:"x"`
+	Y float64 `mapstructure:"y" yaml:"y" json:"y"`
+}
+
+// MotionZone is a polygon drawn on the picture. A camera with zones raises
+// motion events only for motion inside them.
+type MotionZone struct {
+	Name   string  `mapstructure:"name" yaml:"name" json:"name"`
+	Points []Point `mapstructure:"points" yaml:"points" json:"points"`
+}
+
+// Validate checks that the zone is a polygon on the picture.
+func (z MotionZone) Validate() error {
+	if len(z.Points) < 3 {
+		return fmt.Errorf("zone %q needs at least 3 points", z.Name)
+	}
+	for _, p := range z.Points {
+		if p.X < 0 || p.X > 1 || p.Y < 0 || p.Y > 1 {
+			return fmt.Errorf("zone %q: x and y must be between 0 and 1", z.Name)
+		}
+	}
+	return nil
+}
+
+// contains reports whether p is inside the zone.
+func (z MotionZone) contains(p Point) bool {
+	inside := false
+	for i, j := 0, len(z.Points)-1; i < len(z.Points); j, i = i, i+1 {
+		a, b := z.Points[i], z.Points[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// MotionSchedule changes a camera's motion detection during a weekly
+// window, such as stricter during business hours when people walk past all
+// day. A zero Sensitivity or no Zones keep the camera's own.
+type MotionSchedule struct {
+	schedule.Spec `mapstructure:",squash" yaml:",inline"`
+	Sensitivity   int          `mapstructure:"sensitivity" yaml:"sensitivity,omitempty" json:"sensitivity,omitempty"`
+	Zones         []MotionZone `mapstructure:"zones" yaml:"zones,omitempty" json:"zones,omitempty"`
+}
+
+// Validate checks the window, sensitivity and zones.
+func (s MotionSchedule) Validate() error {
+	if _, err := schedule.Parse([]schedule.Spec{s.Spec}); err != nil {
+		return err
+	}
+	if s.Sensitivity < 0 || s.Sensitivity > 100 {
+		return fmt.Errorf("sensitivity must be between 1 and 100")
+	}
+	if s.Sensitivity == 0 && len(s.Zones) == 0 {
+		return fmt.Errorf("set a sensitivity or zones")
+	}
+	for _, zone := range s.Zones {
+		if err := zone.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MotionTarget is a camera whose picture is watched for motion.
+// Sensitivity, from 1 to 100, sets both how much a pixel must change and
+// how much of a zone must change to count. Without Zones the whole picture
+// is one zone. The first of the Schedules whose window is on overrides
+// both.
+type MotionTarget struct {
+	Name          string
+	URL           string
+	HWAccel       string
+	HWAccelDevice string
+	Sensitivity   int
+	Zones         []MotionZone
+	Schedules     []MotionSchedule
+}
+
+// stream is what the ffmpeg reading the target's frames depends on; the
+// sensitivity and zones change without restarting it.
+func (t MotionTarget) stream() motionStream {
+	return motionStream{t.Name, t.URL, t.HWAccel, t.HWAccelDevice}
+}
+
+type motionStream struct {
+	name, url, hwaccel, device string
+}
+
+type motionLoop struct {
+	cancel context.CancelFunc
+	target atomic.Pointer[MotionTarget]
+}
+
+// MotionMonitor looks for motion in cameras' pictures with ffmpeg and raises
+// an EventMotion when some appears in one of a target's zones. Motion raises
+// one event however long it lasts; the next needs the picture to settle
+// first.
+type MotionMonitor struct {
+	targets func() []MotionTarget
+	handler func(Event)
+	loops   map[motionStream]*motionLoop
+	ctx     context.Context
+	mu      sync.Mutex
+}
+
+func NewMotionMonitor(targets func() []MotionTarget, handler func(Event)) *MotionMonitor {
+	return &MotionMonitor{
+		targets: targets,
+		handler: handler,
+		loops:   make(map[motionStream]*motionLoop),
+	}
+}
+
+func (m *MotionMonitor) Start(ctx context.Context) {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		m.sync(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.sync(ctx)
+			}
+		}
+	}()
+}
+
+// Refresh applies changed targets now instead of at the next minute.
+func (m *MotionMonitor) Refresh() {
+	m.mu.Lock()
+	ctx := m.ctx
+	m.mu.Unlock()
+	if ctx != nil {
+		m.sync(ctx)
+	}
+}
+
+func (m *MotionMonitor) sync(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[motionStream]MotionTarget)
+	for _, target := range m.targets() {
+		wanted[target.stream()] = target
+	}
+
+	for stream, loop := range m.loops {
+		if _, ok := wanted[stream]; !ok {
+			loop.cancel()
+			delete(m.loops, stream)
+		}
+	}
+
+	for stream, target := range wanted {
+		if loop, ok := m.loops[stream]; ok {
+			if !reflect.DeepEqual(*loop.target.Load(), target) {
+				loop.target.Store(&target)
+			}
+			continue
+		}
+		loopCtx, cancel := context.WithCancel(ctx)
+		loop := &motionLoop{cancel: cancel}
+		loop.target.Store(&target)
+		m.loops[stream] = loop
+		go m.run(loopCtx, loop)
+	}
+}
+
+func (m *MotionMonitor) run(ctx context.Context, loop *motionLoop) {
+	retryDelay := 10 * time.Second
+
+	for {
+		started := time.Now()
+		err := m.watch(ctx, loop)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > 5*time.Minute {
+			retryDelay = 10 * time.Second
+		}
+		log.Printf("[%s] Motion detection stopped: %v. Retrying in %v...", loop.target.Load().Name, err, retryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+		}
+		retryDelay = min(retryDelay*2, 5*time.Minute)
+	}
+}
+
+// watch runs ffmpeg on the camera's video, reading small grey frames, until
+// the stream ends.
+func (m *MotionMonitor) watch(ctx context.Context, loop *motionLoop) error {
+	target := loop.target.Load()
+	args := []string{"-hide_banner", "-nostats", "-loglevel", "error"}
+	if target.HWAccel != "" {
+		args = append(args, "-hwaccel", target.HWAccel)
+		if target.HWAccelDevice != "" {
+			args = append(args, "-hwaccel_device", target.HWAccelDevice)
+		}
+	}
+	args = append(args, source.InputArgs(target.URL)...)
+	args = append(args,
+		"-an",
+		"-vf", fmt.Sprintf("fps=%d,scale=%d:%d,format=gray", motionFPS, motionWidth, motionHeight),
+		"-f", "rawvideo", "-",
+	)
+	cmd := command.Context(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	var (
+		detector motionDetector
+		moving   int
+		quiet    int
+		reported bool
+	)
+	frame := make([]byte, motionWidth*motionHeight)
+	for {
+		if _, err := io.ReadFull(stdout, frame); err != nil {
+			break
+		}
+		target := loop.target.Load()
+		zone, ok := detector.feed(frame, target, time.Now())
+		if !ok {
+			moving = 0
+			if quiet++; quiet >= motionQuietFrames {
+				reported = false
+			}
+			continue
+		}
+		quiet = 0
+		moving++
+		if !reported && moving >= motionFrames {
+			reported = true
+			m.handler(Event{
+				Camera: target.Name,
+				Kind:   EventMotion,
+				Label:  zone,
+				Source: "motion",
+				Time:   time.Now().Add(-time.Duration(moving) * time.Second / motionFPS),
+			})
+		}
+	}
+
+	err = cmd.Wait()
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	switch last := lines[len(lines)-1]; {
+	case err == nil:
+		err = fmt.Errorf("video stream ended")
+	case last != "":
+		err = fmt.Errorf("ffmpeg: %w: %s", err, last)
+	}
+	return err
+}
+
+// motionDetector compares each frame with a background that slowly takes in
+// what stays still, so a swaying tree or dusk does not count as motion.
+type motionDetector struct {
+	background []float32
+	target     *MotionTarget
+	// schedules are the parsed windows of target's schedules, and masks
+	// the pixels of each zone of target's own zones, then of each schedule.
+	schedules []*schedule.Schedule
+	masks     [][][]int
+	// active is the schedule in force, or -1 for none.
+	active int
+}
+
+// settings returns the sensitivity and zones in force at t, with the masks
+// of the zones.
+func (d *motionDetector) settings(target *MotionTarget, t time.Time) (int, []MotionZone, [][]int) {
+	if d.target != target {
+		d.target = target
+		d.active = -1
+		d.schedules = make([]*schedule.Schedule, len(target.Schedules))
+		d.masks = [][][]int{zoneMasks(target.Zones)}
+		for i, s := range target.Schedules {
+			d.schedules[i], _ = schedule.Parse([]schedule.Spec{s.Spec})
+			d.masks = append(d.masks, zoneMasks(s.Zones))
+		}
+	}
+
+	sensitivity, zones, masks := target.Sensitivity, target.Zones, d.masks[0]
+	active := -1
+	for i, sched := range d.schedules {
+		if sched == nil || !sched.Active(t) {
+			continue
+		}
+		active = i
+		s := target.Schedules[i]
+		if s.Sensitivity > 0 {
+			sensitivity = s.Sensitivity
+		}
+		if len(s.Zones) > 0 {
+			zones, masks = s.Zones, d.masks[i+1]
+		}
+		break
+	}
+	if active != d.active {
+		d.active = active
+		if active == -1 {
+			log.Printf("[%s] Motion detection back to its own settings", target.Name)
+		} else {
+			log.Printf("[%s] Motion detection following schedule %d", target.Name, active+1)
+		}
+	}
+	return sensitivity, zones, masks
+}
+
+// feed looks for motion in frame, with the settings in force at t, and
+// returns the name of the zone with the most of it.
+func (d *motionDetector) feed(frame []byte, target *MotionTarget, t time.Time) (string, bool) {
+	if d.background == nil {
+		d.background = make([]float32, len(frame))
+		for i, v := range frame {
+			d.background[i] = float32(v)
+		}
+		return "", false
+	}
+	sensitivity, zones, masks := d.settings(target, t)
+
+	if sensitivity <= 0 {
+		sensitivity = DefaultMotionSensitivity
+	}
+	sensitivity = min(sensitivity, 100)
+	// At the default sensitivity a pixel must change by 30 of 255 and 2% of
+	// a zone must change.
+	pixelThreshold := float32(10 + float64(100-sensitivity)*0.4)
+	minArea := float64(101-sensitivity) / 100 * 0.04
+
+	changed := make([]bool, len(frame))
+	total := 0
+	for i, v := range frame {
+		diff := float32(v) - d.background[i]
+		if diff > pixelThreshold || -diff > pixelThreshold {
+			changed[i] = true
+			total++
+		}
+		d.background[i] += diff * motionLearnRate
+	}
+	if float64(total) > motionLightingChange*float64(len(frame)) {
+		for i, v := range frame {
+			d.background[i] = float32(v)
+		}
+		return "", false
+	}
+
+	if len(masks) == 0 {
+		return "", float64(total) >= minArea*float64(len(frame))
+	}
+	best, bestShare := "", 0.0
+	for z, mask := range masks {
+		if len(mask) == 0 {
+			continue
+		}
+		count := 0
+		for _, i := range mask {
+			if changed[i] {
+				count++
+			}
+		}
+		if share := float64(count) / float64(len(mask)); share >= minArea && share > bestShare {
+			best, bestShare = zones[z].Name, share
+		}
+	}
+	return best, bestShare > 0
+}
+
+// zoneMasks lists the pixels of a motion frame whose centre is inside each
+// zone.
+func zoneMasks(zones []MotionZone) [][]int {
+	masks := make([][]int, len(zones))
+	for z, zone := range zones {
+		for y := range motionHeight {
+			for x := range motionWidth {
+				p := Point{(float64(x) + 0.5) / motionWidth, (float64(y) + 0.5) / motionHeight}
+				if zone.contains(p) {
+					masks[z] = append(masks[z], y*motionWidth+x)
+				}
+			}
+		}
+	}
+	return masks
+}
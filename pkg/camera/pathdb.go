@@ -0,0 +1,284 @@
+package camera
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// builtinPaths is the vendor path database shipped with the recorder. Paths
+// are templates: {channel} is the channel number and {channel:02} the same
+// padded to two digits.
+//
+//go:embed rtsp_paths.json
+var builtinPaths []byte
+
+// genericVendor holds the paths tried when the vendor is not known. It is
+// always listed last.
+const genericVendor = "Generic"
+
+// VendorPath is the RTSP path one camera brand, or one of its models, serves
+// a stream on.
+type VendorPath struct {
+	Vendor string `json:"vendor"`
+	// Model is the model pattern the path is for; empty for every model.
+	Model string `json:"model,omitempty"`
+	// Stream is "main" for the full-resolution stream, "sub" for the
+	// low-resolution one.
+	Stream string `json:"stream"`
+	Path   string `json:"path"`
+}
+
+// PathTemplate is a stream path in the database.
+type PathTemplate struct {
+	Stream string `json:"stream"`
+	Path   string `json:"path"`
+}
+
+// ModelPaths are the paths of the models matching Model, a case-insensitive
+// pattern such as "RLC-8*", tried before their vendor's paths.
+type ModelPaths struct {
+	Model string         `json:"model"`
+	Paths []PathTemplate `json:"paths"`
+}
+
+// VendorPaths is one vendor's entry in the database. Aliases are lowercase
+// substrings of the manufacturer names its cameras report.
+type VendorPaths struct {
+	Vendor  string         `json:"vendor"`
+	Aliases []string       `json:"aliases,omitempty"`
+	Paths   []PathTemplate `json:"paths"`
+	Models  []ModelPaths   `json:"models,omitempty"`
+}
+
+type pathFile struct {
+	Vendors []VendorPaths `json:"vendors"`
+}
+
+// PathDB maps camera vendors and models to the RTSP paths they serve.
+type PathDB struct {
+	vendors []VendorPaths
+}
+
+var builtinPathDB = sync.OnceValue(func() *PathDB {
+	db, err := parsePathDB(builtinPaths)
+	if err != nil {
+		panic(fmt.Sprintf("camera: invalid built-in RTSP path database: %v", err))
+	}
+	return db
+})
+
+// BuiltinPathDB returns the path database shipped with the recorder.
+func BuiltinPathDB() *PathDB {
+	return builtinPathDB()
+}
+
+// LoadPathDB returns the built-in database extended with the vendors in the
+// JSON file at overrides, which has the same layout as the built-in one. A
+// vendor already known gets the file's aliases, models and paths ahead of its
+// own; other vendors are added. An empty overrides returns the built-in
+// database.
+func LoadPathDB(overrides string) (*PathDB, error) {
+	db := BuiltinPathDB()
+	if overrides == "" {
+		return db, nil
+	}
+	data, err := os.ReadFile(overrides)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RTSP path file: %w", err)
+	}
+	extra, err := parsePathDB(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RTSP path file %s: %w", overrides, err)
+	}
+	return db.merge(extra), nil
+}
+
+func parsePathDB(data []byte) (*PathDB, error) {
+	var file pathFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	for i, v := range file.Vendors {
+		if strings.TrimSpace(v.Vendor) == "" {
+			return nil, fmt.Errorf("vendors[%d]: vendor is required", i)
+		}
+		if len(v.Paths) == 0 && len(v.Models) == 0 {
+			return nil, fmt.Errorf("vendor %s: no paths", v.Vendor)
+		}
+		if err := validateTemplates(v.Vendor, v.Paths); err != nil {
+			return nil, err
+		}
+		for j, m := range v.Models {
+			if _, err := path.Match(m.Model, ""); err != nil || m.Model == "" {
+				return nil, fmt.Errorf("vendor %s: invalid model pattern %q", v.Vendor, m.Model)
+			}
+			if err := validateTemplates(v.Vendor, m.Paths); err != nil {
+				return nil, err
+			}
+			file.Vendors[i].Models[j].Model = strings.ToUpper(m.Model)
+		}
+		for j, alias := range v.Aliases {
+			file.Vendors[i].Aliases[j] = strings.ToLower(alias)
+		}
+	}
+	return &PathDB{vendors: file.Vendors}, nil
+}
+
+func validateTemplates(vendor string, paths []PathTemplate) error {
+	for _, p := range paths {
+		if !strings.HasPrefix(p.Path, "/") {
+			return fmt.Errorf("vendor %s: path %q must start with /", vendor, p.Path)
+		}
+		if p.Stream != "main" && p.Stream != "sub" {
+			return fmt.Errorf("vendor %s: stream of %s must be main or sub", vendor, p.Path)
+		}
+	}
+	return nil
+}
+
+func (db *PathDB) merge(extra *PathDB) *PathDB {
+	vendors := slices.Clone(db.vendors)
+	for _, v := range extra.vendors {
+		i := slices.IndexFunc(vendors, func(known VendorPaths) bool { return strings.EqualFold(known.Vendor, v.Vendor) })
+		if i < 0 {
+			vendors = append(vendors, v)
+			continue
+		}
+		known := vendors[i]
+		vendors[i] = VendorPaths{
+			Vendor:  known.Vendor,
+			Aliases: append(slices.Clone(v.Aliases), known.Aliases...),
+			Paths:   append(slices.Clone(v.Paths), known.Paths...),
+			Models:  append(slices.Clone(v.Models), known.Models...),
+		}
+	}
+	slices.SortStableFunc(vendors, func(a, b VendorPaths) int {
+		return boolInt(a.Vendor == genericVendor) - boolInt(b.Vendor == genericVendor)
+	})
+	return &PathDB{vendors: vendors}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Vendors lists the vendor names, Generic last.
+func (db *PathDB) Vendors() []string {
+	names := make([]string, len(db.vendors))
+	for i, v := range db.vendors {
+		names[i] = v.Vendor
+	}
+	return names
+}
+
+// Paths lists every path template, vendor by vendor, with each vendor's
+// model paths ahead of the paths for all its models.
+func (db *PathDB) Paths() []VendorPath {
+	var paths []VendorPath
+	for _, v := range db.vendors {
+		for _, m := range v.Models {
+			for _, p := range m.Paths {
+				paths = append(paths, VendorPath{Vendor: v.Vendor, Model: m.Model, Stream: p.Stream, Path: p.Path})
+			}
+		}
+		for _, p := range v.Paths {
+			paths = append(paths, VendorPath{Vendor: v.Vendor, Stream: p.Stream, Path: p.Path})
+		}
+	}
+	return paths
+}
+
+// Match returns the vendor a manufacturer name, as reported over ONVIF or
+// fingerprinted from the web interface, belongs to.
+func (db *PathDB) Match(manufacturer string) (string, bool) {
+	name := strings.ToLower(strings.TrimSpace(manufacturer))
+	if name == "" {
+		return "", false
+	}
+	for _, v := range db.vendors {
+		if strings.EqualFold(v.Vendor, name) || slices.ContainsFunc(v.Aliases, func(alias string) bool { return strings.Contains(name, alias) }) {
+			return v.Vendor, true
+		}
+	}
+	return "", false
+}
+
+// Lookup returns the path templates for a manufacturer and model: the
+// model's own first, then the vendor's, without repeats. It returns nil when
+// the manufacturer is not known.
+func (db *PathDB) Lookup(manufacturer, model string) []VendorPath {
+	name, ok := db.Match(manufacturer)
+	if !ok {
+		return nil
+	}
+	i := slices.IndexFunc(db.vendors, func(v VendorPaths) bool { return v.Vendor == name })
+	v := db.vendors[i]
+
+	var paths []VendorPath
+	add := func(modelPattern string, templates []PathTemplate) {
+		for _, p := range templates {
+			if !slices.ContainsFunc(paths, func(known VendorPath) bool { return known.Path == p.Path }) {
+				paths = append(paths, VendorPath{Vendor: v.Vendor, Model: modelPattern, Stream: p.Stream, Path: p.Path})
+			}
+		}
+	}
+	if model = strings.ToUpper(strings.TrimSpace(model)); model != "" {
+		for _, m := range v.Models {
+			if ok, _ := path.Match(m.Model, model); ok {
+				add(m.Model, m.Paths)
+			}
+		}
+	}
+	add("", v.Paths)
+	return paths
+}
+
+// DiscoveryPaths returns the paths probed on cameras of an unknown vendor:
+// the generic paths, then the first main stream path of each vendor.
+func (db *PathDB) DiscoveryPaths(channel int) []string {
+	var paths []string
+	add := func(template string) {
+		if p := ExpandPath(template, channel); !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	for _, p := range db.Lookup(genericVendor, "") {
+		add(p.Path)
+	}
+	for _, v := range db.vendors {
+		if i := slices.IndexFunc(v.Paths, func(p PathTemplate) bool { return p.Stream == "main" }); i >= 0 {
+			add(v.Paths[i].Path)
+		}
+	}
+	return paths
+}
+
+// ExpandPaths fills paths in for a channel.
+func ExpandPaths(paths []VendorPath, channel int) []string {
+	expanded := make([]string, len(paths))
+	for i, p := range paths {
+		expanded[i] = ExpandPath(p.Path, channel)
+	}
+	return expanded
+}
+
+// ExpandPath fills a path template in for a channel, counted from 1.
+func ExpandPath(template string, channel int) string {
+	if channel < 1 {
+		channel = 1
+	}
+	return strings.NewReplacer(
+		"{channel}", strconv.Itoa(channel),
+		"{channel:02}", fmt.Sprintf("%02d", channel),
+	).Replace(template)
+}
@@ -0,0 +1,269 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Recorder states reported in CameraStatus.State.
+const (
+	StateStopped    = "stopped"
+	StateIdle       = "idle"
+	StatePaused     = "paused"
+	StateQueued     = "queued"
+	StateConnecting = "connecting"
+	StateRecording  = "recording"
+	StateRetrying   = "retrying"
+	StateFailed     = "failed"
+	// StateCircuitOpen means the camera kept failing and is no longer
+	// retried until it accepts a connection again.
+	StateCircuitOpen = "circuit_open"
+	// StateStandby means the other instance of a failover pair records the
+	// camera.
+	StateStandby = "standby"
+)
+
+type Status struct {
+	Cameras    []CameraStatus `json:"cameras"`
+	ServerTime time.Time      `json:"server_time"`
+	Transcodes *Transcodes    `json:"transcodes,omitempty"`
+}
+
+type Transcodes struct {
+	Active int `json:"active"`
+	Max    int `json:"max"`
+}
+
+type CameraStatus struct {
+	Name               string    `json:"name"`
+	Enabled            bool      `json:"enabled"`
+	Connected          bool      `json:"connected"`
+	Streaming          bool      `json:"streaming"`
+	Viewers            int       `json:"viewers"`
+	Running            bool      `json:"running"`
+	Paused             bool      `json:"paused"`
+	Transcoding        bool      `json:"transcoding"`
+	State              string    `json:"state"`
+	StateSince         time.Time `json:"state_since"`
+	Uptime             string    `json:"uptime"`
+	UptimeSeconds      int64     `json:"uptime_seconds"`
+	StartedAt          time.Time `json:"started_at,omitzero"`
+	LastSegmentAt      time.Time `json:"last_segment_at,omitzero"`
+	ResourceRestarts   int       `json:"resource_restarts"`
+	CPUPercent         float64   `json:"cpu_percent,omitempty"`
+	RSSBytes           uint64    `json:"rss_bytes,omitempty"`
+	LastError          string    `json:"last_error,omitempty"`
+	ClockDriftSeconds  float64   `json:"clock_drift_seconds,omitempty"`
+	ClockDriftExceeded bool      `json:"clock_drift_exceeded,omitempty"`
+	SharesStreamOf     string    `json:"shares_stream_of,omitempty"`
+	Retry              *Retry    `json:"retry,omitempty"`
+	// Tags are the camera's key=value labels.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// Retry describes a camera that is failing.
+type Retry struct {
+	Attempts       int       `json:"attempts"`
+	FailingSince   time.Time `json:"failing_since"`
+	NextRetryAt    time.Time `json:"next_retry_at"`
+	CircuitOpen    bool      `json:"circuit_open"`
+	LastProbeAt    time.Time `json:"last_probe_at,omitzero"`
+	LastProbeError string    `json:"last_probe_error,omitempty"`
+}
+
+type Recording struct {
+	Name      string    `json:"name"`
+	Camera    string    `json:"camera_name"`
+	Size      int64     `json:"size"`
+	SizeHuman string    `json:"size_human"`
+	CreatedAt time.Time `json:"created_at"`
+	StartedAt time.Time `json:"started_at,omitzero"`
+	EndedAt   time.Time `json:"ended_at,omitzero"`
+	// DurationSeconds is 0 for files the server has not indexed.
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	ThumbnailURL    string  `json:"thumbnail_url,omitempty"`
+}
+
+type RecordingsQuery struct {
+	Camera string // empty for all cameras
+	Filter string // case-insensitive substring of the file name
+	Limit  int    // 0 for the server default of 100
+	// Cursor continues after the page RecordingsPage returned it with.
+	Cursor string
+	// Tags keep the cameras with all of these tags, each "key=value" or
+	// just "key".
+	Tags []string
+}
+
+type TriggerRequest struct {
+	Cameras  []string      `json:"cameras"`
+	Duration time.Duration `json:"-"`
+	Label    string        `json:"label,omitempty"`
+	Kind     string        `json:"kind,omitempty"`
+}
+
+type Trigger struct {
+	Camera    string `json:"camera"`
+	EventID   int64  `json:"event_id"`
+	Recording bool   `json:"recording"`
+}
+
+type ExportRequest struct {
+	Cameras  []string
+	From, To time.Time
+	Exporter string // name recorded in the chain-of-custody manifest
+	Sign     bool   // sign the manifest with the recorder's export key
+	// Watermark stamps the exported files with the configured watermark,
+	// plus WatermarkText (e.g. a case number) below it.
+	Watermark     bool
+	WatermarkText string
+	// Metadata embeds the start time, camera, site and location into the
+	// exported files, for other surveillance software to read.
+	Metadata bool
+	// Sidecars adds a metadata file per clip in these formats: "json",
+	// "xml". Nil keeps the server's export.sidecars.
+	Sidecars []string
+}
+
+// Status returns the state of every configured camera.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.doJSON(ctx, http.MethodGet, "/api/status", nil, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Recordings lists recording files, newest first.
+func (c *Client) Recordings(ctx context.Context, q RecordingsQuery) ([]Recording, error) {
+	recordings, _, err := c.RecordingsPage(ctx, q)
+	return recordings, err
+}
+
+// RecordingsPage lists a page of recording files, newest first, and the
+// cursor of the next page, empty after the last.
+func (c *Client) RecordingsPage(ctx context.Context, q RecordingsQuery) ([]Recording, string, error) {
+	query := url.Values{}
+	if q.Camera != "" {
+		query.Set("camera", q.Camera)
+	}
+	if q.Filter != "" {
+		query.Set("filter", q.Filter)
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	for _, tag := range q.Tags {
+		query.Add("tag", tag)
+	}
+	if q.Cursor != "" {
+		query.Set("cursor", q.Cursor)
+	}
+
+	var resp struct {
+		Recordings []Recording `json:"recordings"`
+		NextCursor string      `json:"next_cursor"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/recordings", query, nil, &resp); err != nil {
+		return nil, "", err
+	}
+	return resp.Recordings, resp.NextCursor, nil
+}
+
+// Download writes a recording file to w.
+func (c *Client) Download(ctx context.Context, camera, filename string, w io.Writer) error {
+	return c.download(ctx, "/dl/"+url.PathEscape(camera)+"/"+url.PathEscape(filename), nil, w)
+}
+
+// Snapshot writes the camera's latest preview frame, a JPEG, to w.
+func (c *Client) Snapshot(ctx context.Context, camera string, w io.Writer) error {
+	return c.download(ctx, "/snapshot/"+url.PathEscape(camera), nil, w)
+}
+
+// Replay writes the camera's last d of footage to w as an MP4. The server
+// must have replay.buffer set.
+func (c *Client) Replay(ctx context.Context, camera string, d time.Duration, w io.Writer) error {
+	query := url.Values{"seconds": {strconv.Itoa(int(d.Seconds()))}}
+	return c.download(ctx, "/api/replay/"+url.PathEscape(camera), query, w)
+}
+
+// DeleteRecording removes a recording file.
+func (c *Client) DeleteRecording(ctx context.Context, camera, filename string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/recordings/"+url.PathEscape(camera)+"/"+url.PathEscape(filename), nil, nil, nil)
+}
+
+func (c *Client) StartCamera(ctx context.Context, camera string) error {
+	return c.cameraAction(ctx, camera, "start")
+}
+
+func (c *Client) StopCamera(ctx context.Context, camera string) error {
+	return c.cameraAction(ctx, camera, "stop")
+}
+
+func (c *Client) PauseCamera(ctx context.Context, camera string) error {
+	return c.cameraAction(ctx, camera, "pause")
+}
+
+func (c *Client) ResumeCamera(ctx context.Context, camera string) error {
+	return c.cameraAction(ctx, camera, "resume")
+}
+
+func (c *Client) cameraAction(ctx context.Context, camera, action string) error {
+	return c.doJSON(ctx, http.MethodPost, "/api/camera/"+url.PathEscape(camera)+"/"+action, nil, nil, nil)
+}
+
+// Trigger records an event on cameras and makes sure they record around it.
+// The client needs WithAPIKey.
+func (c *Client) Trigger(ctx context.Context, req TriggerRequest) ([]Trigger, error) {
+	body := struct {
+		TriggerRequest
+		Duration string `json:"duration,omitempty"`
+	}{TriggerRequest: req}
+	if req.Duration > 0 {
+		body.Duration = req.Duration.String()
+	}
+
+	var resp struct {
+		Triggers []Trigger `json:"triggers"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/api/trigger", nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Triggers, nil
+}
+
+// Export writes a ZIP of the recordings overlapping req.From to req.To, with
+// a chain-of-custody manifest, to w. An archive cut short by a server error
+// lacks its manifest.
+func (c *Client) Export(ctx context.Context, req ExportRequest, w io.Writer) error {
+	query := url.Values{
+		"camera": req.Cameras,
+		"from":   {req.From.Format(time.RFC3339)},
+		"to":     {req.To.Format(time.RFC3339)},
+	}
+	if req.Exporter != "" {
+		query.Set("exporter", req.Exporter)
+	}
+	if req.Sign {
+		query.Set("sign", "true")
+	}
+	if req.Watermark {
+		query.Set("watermark", "true")
+		if req.WatermarkText != "" {
+			query.Set("watermark_text", req.WatermarkText)
+		}
+	}
+	if req.Metadata {
+		query.Set("metadata", "true")
+	}
+	if req.Sidecars != nil {
+		// The empty value keeps an empty list from falling back to the
+		// server's default.
+		query["sidecar"] = append([]string{""}, req.Sidecars...)
+	}
+	return c.download(ctx, "/api/export", query, w)
+}
@@ -0,0 +1,129 @@
+// Package mobile is the part of pkg/client a companion phone app needs —
+// status polling, the recording stream and snapshots — with an API that
+// gomobile can bind:
+//
+//	gomobile bind -target=android github.com/lets-vibe/cam-recorder/pkg/client/mobile
+//
+// It only uses types gomobile supports: times are Unix seconds, lists are
+// read by index and streams report to handler interfaces the app
+// implements.
+package mobile
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/client"
+)
+
+const (
+	// DefaultTimeout bounds Status and Snapshot unless SetTimeout changes it.
+	DefaultTimeout = 15 * time.Second
+	// Wait this long before reconnecting a recording stream that failed.
+	reconnectDelay = 5 * time.Second
+	// minPollInterval keeps a wrong interval from flooding the server.
+	minPollInterval = time.Second
+)
+
+// Client talks to one recorder. It is safe for concurrent use.
+type Client struct {
+	c    *client.Client
+	base *url.URL
+
+	mu      sync.Mutex
+	timeout time.Duration
+}
+
+// NewClient returns a client for the recorder at baseURL, including any
+// server.base_path. Leave username and password empty without basic auth in
+// front of the recorder, and apiKey empty without api.keys.
+func NewClient(baseURL, username, password, apiKey string) (*Client, error) {
+	var opts []client.Option
+	if username != "" {
+		opts = append(opts, client.WithBasicAuth(username, password))
+	}
+	if apiKey != "" {
+		opts = append(opts, client.WithAPIKey(apiKey))
+	}
+	c, err := client.New(baseURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// client.New has already checked the URL.
+	base, _ := url.Parse(baseURL)
+	return &Client{c: c, base: base, timeout: DefaultTimeout}, nil
+}
+
+// SetTimeout changes how long Status and Snapshot may take, in
+// milliseconds. The recording stream is not affected.
+func (c *Client) SetTimeout(millis int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if millis > 0 {
+		c.timeout = time.Duration(millis) * time.Millisecond
+	} else {
+		c.timeout = DefaultTimeout
+	}
+}
+
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return context.WithTimeout(context.Background(), c.timeout)
+}
+
+// absURL turns a path the server returned into a URL the app can load.
+func (c *Client) absURL(path string) string {
+	if path == "" {
+		return ""
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	return c.base.ResolveReference(ref).String()
+}
+
+// Snapshot returns the camera's latest preview frame as a JPEG.
+func (c *Client) Snapshot(camera string) ([]byte, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	var buf bytes.Buffer
+	if err := c.c.Snapshot(ctx, camera, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Watch is a running PollStatus or WatchRecordings.
+type Watch struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newWatch() (*Watch, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Watch{cancel: cancel, done: make(chan struct{})}, ctx
+}
+
+// Stop ends the watch. It may be called from a handler, and more than once.
+// A handler call already running can still finish after Stop returns.
+func (w *Watch) Stop() {
+	w.cancel()
+}
+
+// Wait blocks until the watch has stopped.
+func (w *Watch) Wait() {
+	<-w.done
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,79 @@
+package mobile
+
+import (
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/client"
+)
+
+// Recording is a segment the recorder just finished writing. Times are Unix
+// seconds and the URLs are absolute.
+type Recording struct {
+	Camera          string
+	Filename        string
+	StartedAt       int64
+	EndedAt         int64
+	DurationSeconds float64
+	Size            int64
+	// Quality is "good", "degraded", "poor", or empty if unknown.
+	Quality      string
+	DownloadURL  string
+	PlayURL      string
+	ThumbnailURL string
+}
+
+// RecordingHandler receives the results of WatchRecordings.
+type RecordingHandler interface {
+	OnRecording(rec *Recording)
+	// OnError reports a broken stream, which is reconnected a few seconds
+	// later.
+	OnError(message string)
+}
+
+// WatchRecordings reports every segment finished from now on, for one
+// camera or all if camera is empty, until the returned watch is stopped.
+// Segments finished while the stream was reconnecting are missed.
+func (c *Client) WatchRecordings(camera string, h RecordingHandler) *Watch {
+	w, ctx := newWatch()
+
+	go func() {
+		defer close(w.done)
+
+		for {
+			err := c.c.StreamRecordings(ctx, camera, func(ev client.RecordingEvent) error {
+				if ctx.Err() == nil {
+					h.OnRecording(c.newRecording(ev))
+				}
+				return nil
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				h.OnError(err.Error())
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}()
+	return w
+}
+
+func (c *Client) newRecording(ev client.RecordingEvent) *Recording {
+	return &Recording{
+		Camera:          ev.Camera,
+		Filename:        ev.Filename,
+		StartedAt:       unix(ev.StartedAt),
+		EndedAt:         unix(ev.EndedAt),
+		DurationSeconds: ev.DurationSeconds,
+		Size:            ev.Size,
+		Quality:         ev.Quality,
+		DownloadURL:     c.absURL(ev.DownloadURL),
+		PlayURL:         c.absURL(ev.PlayURL),
+		ThumbnailURL:    c.absURL(ev.ThumbnailURL),
+	}
+}
@@ -0,0 +1,142 @@
+package mobile
+
+import (
+	"context"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/client"
+)
+
+// CameraStatus is one camera of a Status. Times are Unix seconds, 0 if
+// unknown.
+type CameraStatus struct {
+	Name      string
+	Enabled   bool
+	Connected bool
+	Running   bool
+	Paused    bool
+	// State is one of the client.State constants, e.g. "recording".
+	State         string
+	StateSince    int64
+	UptimeSeconds int64
+	LastSegmentAt int64
+	Viewers       int
+	LastError     string
+	// RetryAttempts counts the failed connections of a failing camera, and
+	// NextRetryAt is when it is tried again.
+	RetryAttempts int
+	NextRetryAt   int64
+}
+
+// Status is the state of every configured camera.
+type Status struct {
+	ServerTime int64
+	cameras    []*CameraStatus
+}
+
+// CameraCount returns the number of cameras, for Camera.
+func (s *Status) CameraCount() int {
+	return len(s.cameras)
+}
+
+// Camera returns the i-th camera, or nil if i is out of range.
+func (s *Status) Camera(i int) *CameraStatus {
+	if i < 0 || i >= len(s.cameras) {
+		return nil
+	}
+	return s.cameras[i]
+}
+
+// Find returns the camera with the given name, or nil.
+func (s *Status) Find(name string) *CameraStatus {
+	for _, cam := range s.cameras {
+		if cam.Name == name {
+			return cam
+		}
+	}
+	return nil
+}
+
+func newStatus(status *client.Status) *Status {
+	s := &Status{ServerTime: unix(status.ServerTime)}
+	for _, cam := range status.Cameras {
+		cs := &CameraStatus{
+			Name:          cam.Name,
+			Enabled:       cam.Enabled,
+			Connected:     cam.Connected,
+			Running:       cam.Running,
+			Paused:        cam.Paused,
+			State:         cam.State,
+			StateSince:    unix(cam.StateSince),
+			UptimeSeconds: cam.UptimeSeconds,
+			LastSegmentAt: unix(cam.LastSegmentAt),
+			Viewers:       cam.Viewers,
+			LastError:     cam.LastError,
+		}
+		if cam.Retry != nil {
+			cs.RetryAttempts = cam.Retry.Attempts
+			cs.NextRetryAt = unix(cam.Retry.NextRetryAt)
+		}
+		s.cameras = append(s.cameras, cs)
+	}
+	return s
+}
+
+// Status returns the state of every configured camera.
+func (c *Client) Status() (*Status, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	status, err := c.c.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newStatus(status), nil
+}
+
+// StatusHandler receives the results of PollStatus.
+type StatusHandler interface {
+	OnStatus(status *Status)
+	// OnError reports a failed poll; polling goes on.
+	OnError(message string)
+}
+
+// PollStatus fetches the status now and then every intervalMillis
+// milliseconds, at least a second apart, until the returned watch is stopped.
+func (c *Client) PollStatus(intervalMillis int64, h StatusHandler) *Watch {
+	interval := max(time.Duration(intervalMillis)*time.Millisecond, minPollInterval)
+	w, ctx := newWatch()
+
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			c.poll(ctx, h)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return w
+}
+
+func (c *Client) poll(ctx context.Context, h StatusHandler) {
+	reqCtx, cancel := c.context()
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	status, err := c.c.Status(reqCtx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		h.OnError(err.Error())
+		return
+	}
+	h.OnStatus(newStatus(status))
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxEventLine bounds one line of the recording stream.
+const maxEventLine = 1 << 20
+
+// RecordingEvent is a segment the recorder just finished writing.
+type RecordingEvent struct {
+	Camera          string    `json:"camera"`
+	Filename        string    `json:"filename"`
+	StartedAt       time.Time `json:"started_at"`
+	EndedAt         time.Time `json:"ended_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Size            int64     `json:"size"`
+	// Quality is "good", "degraded", "poor", or empty if unknown.
+	Quality string `json:"quality,omitempty"`
+	// The URLs are paths on the server, including any server.base_path.
+	DownloadURL  string `json:"download_url"`
+	PlayURL      string `json:"play_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// StreamRecordings calls fn for every segment finished from now on, for one
+// camera or all if camera is empty, until ctx is done, fn returns an error or
+// the server closes the stream. It returns nil only when ctx is done. Use an
+// http.Client without a Timeout, which would cut the stream short.
+func (c *Client) StreamRecordings(ctx context.Context, camera string, fn func(RecordingEvent) error) error {
+	query := url.Values{}
+	if camera != "" {
+		query.Set("camera", camera)
+	}
+	resp, err := c.do(ctx, http.MethodGet, "/api/recordings/stream", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 4096), maxEventLine)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// A blank line ends the event.
+			if event == "recording" && len(data) > 0 {
+				var rec RecordingEvent
+				if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &rec); err != nil {
+					return fmt.Errorf("failed to decode recording event: %w", err)
+				}
+				if err := fn(rec); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// Keepalive comment.
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read recording stream: %w", err)
+	}
+	return fmt.Errorf("recording stream closed by the server")
+}
@@ -0,0 +1,44 @@
+// Package command starts the external programs the recorder relies on,
+// ffmpeg and ffprobe, through a Commander that can be swapped for a fake so
+// the recorder runs where they are not installed.
+package command
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+)
+
+// Commander creates the command running program name with args. The
+// command is killed, or interrupted if the caller sets Cancel, once ctx is
+// done.
+type Commander interface {
+	Command(ctx context.Context, name string, args ...string) *exec.Cmd
+}
+
+// Exec runs the real programs found in PATH.
+type Exec struct{}
+
+func (Exec) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, name, args...)
+}
+
+var (
+	current Commander = Exec{}
+	mu      sync.RWMutex
+)
+
+// Set makes every later Context call go through c.
+func Set(c Commander) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = c
+}
+
+// Context creates a command through the current Commander.
+func Context(ctx context.Context, name string, args ...string) *exec.Cmd {
+	mu.RLock()
+	c := current
+	mu.RUnlock()
+	return c.Command(ctx, name, args...)
+}
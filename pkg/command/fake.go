@@ -0,0 +1,507 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fakeProgramEnv = "CAM_RECORDER_FAKE_PROGRAM"
+	fakeSpeedEnv   = "CAM_RECORDER_FAKE_SPEED"
+	fakeFailEnv    = "CAM_RECORDER_FAKE_FAIL"
+
+	fakeFrameRate  = 5
+	fakeChunkSize  = 64 << 10
+	fakeSegmentHLS = 2 * time.Second
+)
+
+// Fake runs every program as a copy of the current executable posing as a
+// minimal ffmpeg or ffprobe, and remembers the calls. The executable must
+// call RunFake before anything else in main (or TestMain).
+//
+// The fake ffmpeg writes placeholders of what it is asked for: small JPEGs
+// for images, padding for video, placeholder RTP when publishing to an RTSP
+// server. Reading a live source (a network URL or a
+// capture device) it runs until interrupted, or for its -t duration; reading
+// a file it finishes at once. The fake ffprobe reports H.264 video with AAC
+// audio lasting a minute, in MP4 or, for .mkv files, Matroska.
+type Fake struct {
+	// Speed divides how long a live run takes, e.g. 60 turns a five-minute
+	// segment into five seconds. Zero means real time.
+	Speed float64
+	// Fail, when set, makes every run fail with this message, the way ffmpeg
+	// does when it cannot reach a camera.
+	Fail string
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Call is a program a Fake was asked to run.
+type Call struct {
+	Name string
+	Args []string
+}
+
+func (f *Fake) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Name: name, Args: slices.Clone(args)})
+	speed, fail := f.Speed, f.Fail
+	f.mu.Unlock()
+
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Env = append(os.Environ(),
+		fakeProgramEnv+"="+name,
+		fakeSpeedEnv+"="+strconv.FormatFloat(speed, 'f', -1, 64),
+		fakeFailEnv+"="+fail,
+	)
+	return cmd
+}
+
+// Calls returns the programs run so far, oldest first.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// SetFail changes the failure of later runs; see Fail.
+func (f *Fake) SetFail(message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Fail = message
+}
+
+// RunFake turns the process into the program a Fake started it as, and
+// exits. In any other process it returns at once.
+func RunFake() {
+	name := os.Getenv(fakeProgramEnv)
+	if name == "" {
+		return
+	}
+	if message := os.Getenv(fakeFailEnv); message != "" {
+		fmt.Fprintln(os.Stderr, message)
+		os.Exit(1)
+	}
+
+	switch strings.TrimSuffix(filepath.Base(name), ".exe") {
+	case "ffmpeg":
+		speed, _ := strconv.ParseFloat(os.Getenv(fakeSpeedEnv), 64)
+		os.Exit(fakeFFmpeg(os.Args[1:], speed))
+	case "ffprobe":
+		os.Exit(fakeFFprobe(os.Args[1:]))
+	}
+	fmt.Fprintf(os.Stderr, "%s is not faked\n", name)
+	os.Exit(127)
+}
+
+func fakeFFprobe(args []string) int {
+	if slices.Contains(args, "json") {
+		format := "mov,mp4,m4a,3gp,3g2,mj2"
+		if len(args) > 0 && strings.EqualFold(filepath.Ext(args[len(args)-1]), ".mkv") {
+			format = "matroska,webm"
+		}
+		fmt.Printf(`{"format": {"format_name": %q, "duration": "60.000000"}, "streams": [{"codec_type": "video", "codec_name": "h264"}, {"codec_type": "audio", "codec_name": "aac"}]}`+"\n", format)
+		return 0
+	}
+	if slices.Contains(args, "format=duration") {
+		fmt.Println("60.000000")
+		return 0
+	}
+	fmt.Println("h264")
+	fmt.Println("aac")
+	if slices.Contains(args, "format=format_name") {
+		fmt.Println("mov,mp4,m4a,3gp,3g2,mj2")
+	}
+	return 0
+}
+
+// fakeRun is what a fake ffmpeg was asked to do.
+type fakeRun struct {
+	live     bool
+	output   string
+	format   string
+	duration time.Duration
+	frames   int
+	args     []string
+}
+
+func parseFakeRun(args []string) fakeRun {
+	run := fakeRun{args: args}
+	if len(args) > 0 {
+		run.output = args[len(args)-1]
+	}
+
+	var format string
+	inputs := 0
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "-f":
+			format = args[i+1]
+		case "-i":
+			if inputs == 0 {
+				input := args[i+1]
+				run.live = strings.Contains(input, "://") || format == "lavfi" || format == "avfoundation"
+			}
+			inputs++
+			format = ""
+		case "-t":
+			if seconds, err := strconv.ParseFloat(args[i+1], 64); err == nil {
+				run.duration = time.Duration(seconds * float64(time.Second))
+			}
+		case "-frames:v":
+			run.frames, _ = strconv.Atoi(args[i+1])
+		}
+	}
+	run.format = format
+	return run
+}
+
+// option returns the value of the last occurrence of flag.
+func (r fakeRun) option(flag string) string {
+	for i := len(r.args) - 2; i >= 0; i-- {
+		if r.args[i] == flag {
+			return r.args[i+1]
+		}
+	}
+	return ""
+}
+
+func fakeFFmpeg(args []string, speed float64) int {
+	run := parseFakeRun(args)
+
+	// Run until the -t duration, or until interrupted by a signal or, as on
+	// Windows, a "q" on stdin.
+	stop := make(chan struct{})
+	var once sync.Once
+	quit := func() { once.Do(func() { close(stop) }) }
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		quit()
+	}()
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := os.Stdin.Read(buf); err != nil {
+				return
+			}
+			if buf[0] == 'q' {
+				quit()
+				return
+			}
+		}
+	}()
+	if !run.live || run.frames > 0 {
+		quit()
+	} else if run.duration > 0 {
+		if speed > 0 {
+			run.duration = time.Duration(float64(run.duration) / speed)
+		}
+		time.AfterFunc(run.duration, quit)
+	}
+
+	var err error
+	switch {
+	case run.output == "-":
+		err = fakeStream(run, stop)
+	case run.format == "hls":
+		err = fakeHLS(run, stop)
+	case run.format == "rtsp":
+		err = fakeRTSP(run, stop)
+	case strings.HasPrefix(run.output, "udp://") || strings.HasPrefix(run.output, "rtp://"):
+		err = fakeUDP(run, stop)
+	case run.format == "flv" && strings.Contains(run.output, "://"):
+		err = fakeRTMP(run, stop)
+	default:
+		err = fakeFile(run, stop)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// fakeStream writes JPEG frames for image pipes, padding packets for
+// MPEG-TS, grey raw video and nothing for anything else to stdout.
+func fakeStream(run fakeRun, stop <-chan struct{}) error {
+	var write func(frame int) error
+	switch run.format {
+	case "image2pipe", "mjpeg":
+		write = func(frame int) error {
+			_, err := os.Stdout.Write(fakeJPEG(frame))
+			return err
+		}
+	case "rawvideo":
+		// Grey frames, sized by the scale filter, with a square crossing
+		// the picture for motion detection to find.
+		width, height := 160, 90
+		if _, scale, ok := strings.Cut(run.option("-vf"), "scale="); ok {
+			fmt.Sscanf(scale, "%d:%d", &width, &height)
+		}
+		write = func(frame int) error {
+			picture := bytes.Repeat([]byte{0x60}, width*height)
+			size := max(height/4, 1)
+			left := frame * 2 % max(width-size, 1)
+			for y := height/2 - size/2; y < height/2+size/2; y++ {
+				for x := left; x < left+size; x++ {
+					picture[y*width+x] = 0xf0
+				}
+			}
+			_, err := os.Stdout.Write(picture)
+			return err
+		}
+	case "mpegts":
+		packet := make([]byte, 188)
+		packet[0], packet[1], packet[2], packet[3] = 0x47, 0x1f, 0xff, 0x10
+		write = func(int) error {
+			_, err := os.Stdout.Write(bytes.Repeat(packet, 64))
+			return err
+		}
+	default:
+		write = func(int) error { return nil }
+	}
+	return fakeFrames(run, stop, write)
+}
+
+// fakeFrames calls write for every frame at fakeFrameRate until stop,
+// printing ffmpeg's progress lines.
+func fakeFrames(run fakeRun, stop <-chan struct{}, write func(frame int) error) error {
+	ticker := time.NewTicker(time.Second / fakeFrameRate)
+	defer ticker.Stop()
+
+	for frame := 1; ; frame++ {
+		if err := write(frame); err != nil {
+			return err
+		}
+		if frame%fakeFrameRate == 0 {
+			fmt.Fprintf(os.Stderr, "frame=%5d fps=%d q=-1.0 size=N/A time=N/A bitrate=N/A drop=0 speed=1x\r", frame, fakeFrameRate)
+		}
+		if run.frames > 0 && frame >= run.frames {
+			return nil
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// fakeFile writes the output file, growing it while the run lasts.
+func fakeFile(run fakeRun, stop <-chan struct{}) error {
+	output := run.output
+	if run.format == "segment" && strings.Contains(output, "%") {
+		output = fmt.Sprintf(output, 0)
+	}
+
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".jpg", ".jpeg":
+		return os.WriteFile(output, fakeJPEG(0), 0644)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	chunk := make([]byte, fakeChunkSize)
+	err = fakeFrames(run, stop, func(frame int) error {
+		if frame%fakeFrameRate != 1 {
+			return nil
+		}
+		_, err := f.Write(chunk)
+		return err
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// fakeHLS writes a playlist with a new segment every fakeSegmentHLS.
+func fakeHLS(run fakeRun, stop <-chan struct{}) error {
+	dir := filepath.Dir(run.output)
+	pattern := run.option("-hls_segment_filename")
+	if pattern == "" {
+		pattern = filepath.Join(dir, "seg_%05d.ts")
+	}
+	if init := run.option("-hls_fmp4_init_filename"); init != "" {
+		if err := os.WriteFile(filepath.Join(dir, init), make([]byte, 1024), 0644); err != nil {
+			return err
+		}
+	}
+	if master := run.option("-master_pl_name"); master != "" {
+		content := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000000\n" + filepath.Base(run.output) + "\n"
+		if err := os.WriteFile(filepath.Join(dir, master), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	perSegment := int(fakeSegmentHLS.Seconds()) * fakeFrameRate
+	var playlist strings.Builder
+	return fakeFrames(run, stop, func(frame int) error {
+		if frame%perSegment != 1 {
+			return nil
+		}
+		segment := fmt.Sprintf(pattern, frame/perSegment)
+		if err := os.WriteFile(segment, make([]byte, fakeChunkSize), 0644); err != nil {
+			return err
+		}
+		if playlist.Len() == 0 {
+			fmt.Fprintf(&playlist, "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n", int(fakeSegmentHLS.Seconds()))
+		}
+		fmt.Fprintf(&playlist, "#EXTINF:%.3f,\n%s\n", fakeSegmentHLS.Seconds(), filepath.Base(segment))
+		return writeFileAtomic(run.output, []byte(playlist.String()))
+	})
+}
+
+// fakeRTSP publishes to an RTSP server the way ffmpeg does: it announces an
+// H.264 and an AAC track, sets both up interleaved and records, sending a
+// placeholder RTP packet per track and frame.
+func fakeRTSP(run fakeRun, stop <-chan struct{}) error {
+	u, err := url.Parse(run.output)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	target := u.String()
+	sdp := "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=No Name\r\nc=IN IP4 127.0.0.1\r\nt=0 0\r\n" +
+		"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\na=control:streamid=0\r\n" +
+		"m=audio 0 RTP/AVP 97\r\na=rtpmap:97 MPEG4-GENERIC/48000/2\r\na=control:streamid=1\r\n"
+	requests := []string{
+		fmt.Sprintf("OPTIONS %s RTSP/1.0\r\nCSeq: 1\r\n\r\n", target),
+		fmt.Sprintf("ANNOUNCE %s RTSP/1.0\r\nCSeq: 2\r\nContent-Type: application/sdp\r\nContent-Length: %d\r\n\r\n%s", target, len(sdp), sdp),
+		fmt.Sprintf("SETUP %s/streamid=0 RTSP/1.0\r\nCSeq: 3\r\nTransport: RTP/AVP/TCP;unicast;interleaved=0-1;mode=record\r\n\r\n", target),
+		fmt.Sprintf("SETUP %s/streamid=1 RTSP/1.0\r\nCSeq: 4\r\nTransport: RTP/AVP/TCP;unicast;interleaved=2-3;mode=record\r\n\r\n", target),
+		fmt.Sprintf("RECORD %s RTSP/1.0\r\nCSeq: 5\r\n\r\n", target),
+	}
+	for _, req := range requests {
+		if _, err := conn.Write([]byte(req)); err != nil {
+			return err
+		}
+		tp := textproto.NewReader(r)
+		status, err := tp.ReadLine()
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(status, "RTSP/1.0 200") {
+			return fmt.Errorf("rtsp: %s", status)
+		}
+		if _, err := tp.ReadMIMEHeader(); err != nil {
+			return err
+		}
+	}
+	go io.Copy(io.Discard, r)
+
+	return fakeFrames(run, stop, func(frame int) error {
+		for channel := 0; channel <= 2; channel += 2 {
+			packet := make([]byte, 4+12+64)
+			packet[0], packet[1], packet[3] = '$', byte(channel), 12+64
+			packet[4], packet[5] = 0x80, 96+byte(channel/2)
+			packet[6], packet[7] = byte(frame>>8), byte(frame)
+			if _, err := conn.Write(packet); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// fakeUDP sends a placeholder datagram per frame to a udp:// or rtp://
+// output, writing the -sdp_file of an RTP one first.
+func fakeUDP(run fakeRun, stop <-chan struct{}) error {
+	u, err := url.Parse(run.output)
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("udp", u.Host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if path := run.option("-sdp_file"); path != "" {
+		sdp := fmt.Sprintf("v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=No Name\r\nc=IN IP4 %s\r\nt=0 0\r\n"+
+			"m=video %s RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n", u.Hostname(), u.Port())
+		if err := os.WriteFile(path, []byte(sdp), 0644); err != nil {
+			return err
+		}
+	}
+	return fakeFrames(run, stop, func(int) error {
+		// Like ffmpeg, carry on while nothing is listening.
+		conn.Write(make([]byte, 188))
+		return nil
+	})
+}
+
+// fakeRTMP connects to an rtmp:// output and sends placeholder bytes per
+// frame, without the RTMP handshake.
+func fakeRTMP(run fakeRun, stop <-chan struct{}) error {
+	u, err := url.Parse(run.output)
+	if err != nil {
+		return err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "1935")
+	}
+	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return fakeFrames(run, stop, func(int) error {
+		_, err := conn.Write(make([]byte, 188))
+		return err
+	})
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// fakeJPEG draws a frame whose shade changes with its number, so successive
+// previews visibly differ.
+func fakeJPEG(frame int) []byte {
+	img := image.NewGray(image.Rect(0, 0, 320, 180))
+	shade := uint8(64 + frame*8%128)
+	for i := range img.Pix {
+		img.Pix[i] = shade
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, &jpeg.Options{Quality: 50})
+	return buf.Bytes()
+}
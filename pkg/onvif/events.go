@@ -0,0 +1,123 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	pullMessagesAction = "http://www.onvif.org/ver10/events/wsdl/PullPointSubscription/PullMessagesRequest"
+	unsubscribeAction  = "http://docs.oasis-open.org/wsn/bw-2/SubscriptionManager/UnsubscribeRequest"
+)
+
+type Event struct {
+	Topic     string
+	Time      time.Time
+	Operation string
+	Source    map[string]string
+	Data      map[string]string
+}
+
+type simpleItem struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:"Value,attr"`
+}
+
+type capabilitiesResponse struct {
+	EventsXAddr string `xml:"Body>GetCapabilitiesResponse>Capabilities>Events>XAddr"`
+}
+
+type createPullPointResponse struct {
+	Address string `xml:"Body>CreatePullPointSubscriptionResponse>SubscriptionReference>Address"`
+}
+
+type pullMessagesResponse struct {
+	Messages []struct {
+		Topic   string `xml:"Topic"`
+		Message struct {
+			UtcTime           string       `xml:"UtcTime,attr"`
+			PropertyOperation string       `xml:"PropertyOperation,attr"`
+			Source            []simpleItem `xml:"Source>SimpleItem"`
+			Data              []simpleItem `xml:"Data>SimpleItem"`
+		} `xml:"Message>Message"`
+	} `xml:"Body>PullMessagesResponse>NotificationMessage"`
+}
+
+type emptyResponse struct{}
+
+func (c *Client) EventsURL(ctx context.Context) (string, error) {
+	var resp capabilitiesResponse
+	body := `<GetCapabilities xmlns="http://www.onvif.org/ver10/device/wsdl"><Category>Events</Category></GetCapabilities>`
+	if err := c.callSecure(ctx, c.URL, "", body, &resp); err != nil {
+		return "", err
+	}
+
+	if addr := strings.TrimSpace(resp.EventsXAddr); addr != "" {
+		return addr, nil
+	}
+	return "", fmt.Errorf("camera does not advertise an ONVIF event service")
+}
+
+func (c *Client) CreatePullPointSubscription(ctx context.Context, eventsURL string, termination time.Duration) (string, error) {
+	var resp createPullPointResponse
+	body := fmt.Sprintf(`<CreatePullPointSubscription xmlns="http://www.onvif.org/ver10/events/wsdl">`+
+		`<InitialTerminationTime>PT%dS</InitialTerminationTime></CreatePullPointSubscription>`,
+		int(termination.Seconds()))
+	if err := c.callSecure(ctx, eventsURL, "", body, &resp); err != nil {
+		return "", err
+	}
+
+	if addr := strings.TrimSpace(resp.Address); addr != "" {
+		return addr, nil
+	}
+	return "", fmt.Errorf("camera returned no subscription address")
+}
+
+func (c *Client) PullMessages(ctx context.Context, subscriptionURL string, timeout time.Duration, limit int) ([]Event, error) {
+	header := addressing(pullMessagesAction, subscriptionURL)
+	body := fmt.Sprintf(`<PullMessages xmlns="http://www.onvif.org/ver10/events/wsdl">`+
+		`<Timeout>PT%dS</Timeout><MessageLimit>%d</MessageLimit></PullMessages>`,
+		int(timeout.Seconds()), limit)
+
+	var resp pullMessagesResponse
+	if err := c.callSecure(ctx, subscriptionURL, header, body, &resp); err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(resp.Messages))
+	for _, msg := range resp.Messages {
+		ev := Event{
+			Topic:     strings.TrimSpace(msg.Topic),
+			Operation: msg.Message.PropertyOperation,
+			Source:    make(map[string]string),
+			Data:      make(map[string]string),
+		}
+		if t, err := time.Parse(time.RFC3339, msg.Message.UtcTime); err == nil {
+			ev.Time = t
+		} else {
+			ev.Time = time.Now()
+		}
+		for _, item := range msg.Message.Source {
+			ev.Source[item.Name] = item.Value
+		}
+		for _, item := range msg.Message.Data {
+			ev.Data[item.Name] = item.Value
+		}
+		events = append(events, ev)
+	}
+
+	return events, nil
+}
+
+func (c *Client) Unsubscribe(ctx context.Context, subscriptionURL string) error {
+	header := addressing(unsubscribeAction, subscriptionURL)
+	body := `<Unsubscribe xmlns="http://docs.oasis-open.org/wsn/b-2"/>`
+	return c.callSecure(ctx, subscriptionURL, header, body, &emptyResponse{})
+}
+
+func addressing(action, to string) string {
+	return fmt.Sprintf(`<a:Action s:mustUnderstand="1">%s</a:Action><a:To s:mustUnderstand="1">%s</a:To>`,
+		action, xmlEscape(to))
+}
@@ -0,0 +1,192 @@
+// Package onvif is a minimal ONVIF client reading a camera's clock and device
+// information and pulling its events.
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const soapEnvelope = `<?xml version="1.0" encoding="UTF-8"?>` +
+	`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://www.w3.org/2005/08/addressing">` +
+	`<s:Header>%s</s:Header><s:Body>%s</s:Body></s:Envelope>`
+
+const usernameToken = `<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">` +
+	`<UsernameToken><Username>%s</Username>` +
+	`<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">%s</Password>` +
+	`<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">%s</Nonce>` +
+	`<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">%s</Created>` +
+	`</UsernameToken></Security>`
+
+type Client struct {
+	URL        string
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+}
+
+func NewClient(deviceURL, username, password string, timeout time.Duration) *Client {
+	return &Client{
+		URL:        deviceURL,
+		Username:   username,
+		Password:   password,
+		HTTPClient: &http.Client{Timeout: timeout},
+	}
+}
+
+func DeviceURL(rtspURL string) (string, error) {
+	u, err := url.Parse(rtspURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid RTSP URL: %w", err)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("RTSP URL has no host")
+	}
+	return "http://" + net.JoinHostPort(u.Hostname(), "80") + "/onvif/device_service", nil
+}
+
+func (c *Client) call(ctx context.Context, body string, out interface{}) error {
+	return c.send(ctx, c.URL, "", body, out)
+}
+
+func (c *Client) callSecure(ctx context.Context, endpoint, header, body string, out interface{}) error {
+	security, err := c.security(time.Now())
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, endpoint, security+header, body, out)
+}
+
+func (c *Client) security(now time.Time) (string, error) {
+	if c.Username == "" {
+		return "", nil
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	created := now.UTC().Format("2006-01-02T15:04:05.000Z")
+
+	digest := sha1.New()
+	digest.Write(nonce)
+	digest.Write([]byte(created))
+	digest.Write([]byte(c.Password))
+
+	return fmt.Sprintf(usernameToken,
+		xmlEscape(c.Username),
+		base64.StdEncoding.EncodeToString(digest.Sum(nil)),
+		base64.StdEncoding.EncodeToString(nonce),
+		created,
+	), nil
+}
+
+func xmlEscape(value string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
+
+func (c *Client) send(ctx context.Context, endpoint, header, body string, out interface{}) error {
+	payload := fmt.Sprintf(soapEnvelope, header, body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBufferString(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create ONVIF request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ONVIF request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read ONVIF response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var fault soapFault
+		if xml.Unmarshal(data, &fault) == nil && fault.Reason != "" {
+			return fmt.Errorf("ONVIF request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(fault.Reason))
+		}
+		return fmt.Errorf("ONVIF request failed with status %d", resp.StatusCode)
+	}
+
+	if err := xml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode ONVIF response: %w", err)
+	}
+
+	return nil
+}
+
+type soapFault struct {
+	Reason string `xml:"Body>Fault>Reason>Text"`
+}
+
+type dateTime struct {
+	Date struct {
+		Year  int `xml:"Year"`
+		Month int `xml:"Month"`
+		Day   int `xml:"Day"`
+	} `xml:"Date"`
+	Time struct {
+		Hour   int `xml:"Hour"`
+		Minute int `xml:"Minute"`
+		Second int `xml:"Second"`
+	} `xml:"Time"`
+}
+
+type systemDateAndTimeResponse struct {
+	UTCDateTime dateTime `xml:"Body>GetSystemDateAndTimeResponse>SystemDateAndTime>UTCDateTime"`
+}
+
+func (c *Client) GetSystemDateAndTime(ctx context.Context) (time.Time, error) {
+	var resp systemDateAndTimeResponse
+	body := `<GetSystemDateAndTime xmlns="http://www.onvif.org/ver10/device/wsdl"/>`
+	if err := c.call(ctx, body, &resp); err != nil {
+		return time.Time{}, err
+	}
+
+	dt := resp.UTCDateTime
+	if dt.Date.Year == 0 {
+		return time.Time{}, fmt.Errorf("ONVIF response has no UTC date")
+	}
+
+	return time.Date(dt.Date.Year, time.Month(dt.Date.Month), dt.Date.Day,
+		dt.Time.Hour, dt.Time.Minute, dt.Time.Second, 0, time.UTC), nil
+}
+
+// DeviceInformation is what a camera reports about itself.
+type DeviceInformation struct {
+	Manufacturer    string `xml:"Body>GetDeviceInformationResponse>Manufacturer"`
+	Model           string `xml:"Body>GetDeviceInformationResponse>Model"`
+	FirmwareVersion string `xml:"Body>GetDeviceInformationResponse>FirmwareVersion"`
+	SerialNumber    string `xml:"Body>GetDeviceInformationResponse>SerialNumber"`
+	HardwareID      string `xml:"Body>GetDeviceInformationResponse>HardwareId"`
+}
+
+func (c *Client) GetDeviceInformation(ctx context.Context) (DeviceInformation, error) {
+	var info DeviceInformation
+	body := `<GetDeviceInformation xmlns="http://www.onvif.org/ver10/device/wsdl"/>`
+	if err := c.callSecure(ctx, c.URL, "", body, &info); err != nil {
+		return info, err
+	}
+	if info.Manufacturer == "" && info.Model == "" {
+		return info, fmt.Errorf("ONVIF response has no device information")
+	}
+	return info, nil
+}
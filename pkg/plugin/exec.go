@@ -0,0 +1,335 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// External plugins are programs that read JSON-RPC 2.0 messages from stdin
+// and write them to stdout, one per line. The recorder starts the program,
+// calls "initialize" with {"name", "kind", "config"}, and then:
+//
+//   - for a notifier, calls "notify" with a Notification for every alert;
+//   - for a detector, calls "start" with {"cameras": [{"name", "url"}]},
+//     after which the program sends "event" notifications (requests without
+//     an id) with {"camera", "kind", "label", "time", "duration_seconds"}.
+//
+// Anything the program writes to stderr is logged.
+
+const (
+	rpcVersion     = "2.0"
+	initTimeout    = 10 * time.Second
+	stopGrace      = 5 * time.Second
+	maxMessageSize = 1 << 20
+)
+
+var errPluginExited = errors.New("plugin exited")
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  any             `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcIncoming struct {
+	ID     *int64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+type eventParams struct {
+	Camera          string    `json:"camera"`
+	Kind            string    `json:"kind"`
+	Label           string    `json:"label"`
+	Time            time.Time `json:"time"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+// ExecOptions describes an external plugin program.
+type ExecOptions struct {
+	Name    string
+	Command string
+	Args    []string
+	Config  Config
+}
+
+// process is one run of an external plugin.
+type process struct {
+	opts     ExecOptions
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	onNotify func(method string, params json.RawMessage)
+
+	writeMu    sync.Mutex
+	mu         sync.Mutex
+	nextID     int64
+	pending    map[int64]chan rpcIncoming
+	stderrDone chan struct{}
+	done       chan struct{}
+	err        error
+}
+
+func startProcess(opts ExecOptions, kind string, onNotify func(string, json.RawMessage)) (*process, error) {
+	cmd := exec.Command(opts.Command, opts.Args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", opts.Name, err)
+	}
+
+	p := &process{
+		opts:       opts,
+		cmd:        cmd,
+		stdin:      stdin,
+		onNotify:   onNotify,
+		pending:    make(map[int64]chan rpcIncoming),
+		stderrDone: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go p.logStderr(stderr)
+	go p.read(stdout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), initTimeout)
+	defer cancel()
+	_, err = p.call(ctx, "initialize", map[string]any{
+		"name":   opts.Name,
+		"kind":   kind,
+		"config": opts.Config,
+	})
+	if err != nil {
+		p.stop()
+		return nil, fmt.Errorf("failed to initialize plugin %s: %w", opts.Name, err)
+	}
+	return p, nil
+}
+
+func (p *process) logStderr(r io.Reader) {
+	defer close(p.stderrDone)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		log.Printf("Plugin %s: %s", p.opts.Name, scanner.Text())
+	}
+}
+
+func (p *process) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxMessageSize)
+	for scanner.Scan() {
+		var msg rpcIncoming
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("Warning: Plugin %s sent an invalid message: %v", p.opts.Name, err)
+			continue
+		}
+
+		if msg.Method != "" {
+			if p.onNotify != nil {
+				p.onNotify(msg.Method, msg.Params)
+			}
+			continue
+		}
+		if msg.ID == nil {
+			continue
+		}
+		p.mu.Lock()
+		ch, ok := p.pending[*msg.ID]
+		delete(p.pending, *msg.ID)
+		p.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+
+	// Wait closes the pipes, so let the stderr logger finish first.
+	<-p.stderrDone
+	err := p.cmd.Wait()
+	if err == nil {
+		err = errPluginExited
+	} else {
+		err = fmt.Errorf("%w: %v", errPluginExited, err)
+	}
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+	close(p.done)
+}
+
+func (p *process) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	p.mu.Lock()
+	p.nextID++
+	id := p.nextID
+	ch := make(chan rpcIncoming, 1)
+	p.pending[id] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	data, err := json.Marshal(rpcMessage{JSONRPC: rpcVersion, ID: &id, Method: method, Params: params})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", method, err)
+	}
+	p.writeMu.Lock()
+	_, err = p.stdin.Write(append(data, '\n'))
+	p.writeMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to send %s: %w", method, err)
+	}
+
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-p.done:
+		return nil, p.exitErr()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *process) exitErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *process) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop closes the program's stdin, which should make it exit, and kills it
+// if it does not.
+func (p *process) stop() {
+	p.stdin.Close()
+	select {
+	case <-p.done:
+	case <-time.After(stopGrace):
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+}
+
+type execNotifier struct {
+	opts ExecOptions
+	mu   sync.Mutex
+	proc *process
+}
+
+// NewExecNotifier returns a notifier backed by an external program. The
+// program is started on the first notification and restarted if it exits.
+func NewExecNotifier(opts ExecOptions) Notifier {
+	return &execNotifier{opts: opts}
+}
+
+func (n *execNotifier) Name() string {
+	return n.opts.Name
+}
+
+func (n *execNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.mu.Lock()
+	if n.proc == nil || n.proc.exited() {
+		proc, err := startProcess(n.opts, "notifier", nil)
+		if err != nil {
+			n.mu.Unlock()
+			return err
+		}
+		n.proc = proc
+	}
+	proc := n.proc
+	n.mu.Unlock()
+
+	_, err := proc.call(ctx, "notify", notification)
+	return err
+}
+
+type execDetector struct {
+	opts ExecOptions
+}
+
+// NewExecDetector returns a detector backed by an external program, which
+// runs for as long as the detector does.
+func NewExecDetector(opts ExecOptions) Detector {
+	return &execDetector{opts: opts}
+}
+
+func (d *execDetector) Name() string {
+	return d.opts.Name
+}
+
+func (d *execDetector) Run(ctx context.Context, cameras []Camera, emit func(Event)) error {
+	proc, err := startProcess(d.opts, "detector", func(method string, params json.RawMessage) {
+		if method != "event" {
+			return
+		}
+		var ev eventParams
+		if err := json.Unmarshal(params, &ev); err != nil {
+			log.Printf("Warning: Plugin %s sent an invalid event: %v", d.opts.Name, err)
+			return
+		}
+		emit(Event{
+			Camera:   ev.Camera,
+			Kind:     ev.Kind,
+			Label:    ev.Label,
+			Time:     ev.Time,
+			Duration: time.Duration(ev.DurationSeconds * float64(time.Second)),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	defer proc.stop()
+
+	startCtx, cancel := context.WithTimeout(ctx, initTimeout)
+	_, err = proc.call(startCtx, "start", map[string]any{"cameras": cameras})
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to start detector %s: %w", d.opts.Name, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-proc.done:
+		return proc.exitErr()
+	}
+}
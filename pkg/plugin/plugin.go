@@ -0,0 +1,156 @@
+// Package plugin lets third parties add notifiers and detectors without
+// changing the recorder. A plugin is either compiled in, by registering a
+// factory from an init function, or a separate program that speaks JSON-RPC
+// over its stdin and stdout (see NewExecNotifier). Either way it is enabled
+// by name in the plugins section of the config.
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Notification is an alert for the user, such as a camera going offline.
+type Notification struct {
+	Kind   string    `json:"kind"`
+	Camera string    `json:"camera,omitempty"`
+	Title  string    `json:"title"`
+	Body   string    `json:"body"`
+	URL    string    `json:"url,omitempty"`
+	Image  string    `json:"image,omitempty"`
+	Time   time.Time `json:"time"`
+	// Tags are the tags of the camera, if it has any.
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// Notifier delivers notifications, e.g. to a chat service or a pager.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Camera is a camera a detector watches. URL is the camera's own stream, or
+// a local tcp:// URL serving MPEG-TS when the recorder shares one ingest.
+// HWAccel and HWAccelDevice, when set, are the ffmpeg -hwaccel method and
+// -hwaccel_device the user wants detectors to decode with.
+type Camera struct {
+	Name          string `json:"name"`
+	URL           string `json:"url"`
+	HWAccel       string `json:"hwaccel,omitempty"`
+	HWAccelDevice string `json:"hwaccel_device,omitempty"`
+}
+
+// Event is something a detector saw. The recorder records around it and
+// notifies like for camera events. A zero Time means now, and a zero
+// Duration the configured events.record_duration.
+type Event struct {
+	Camera   string
+	Kind     string
+	Label    string
+	Time     time.Time
+	Duration time.Duration
+}
+
+// Detector watches cameras and reports events until ctx is done. An error
+// return is logged and the detector run again after a pause.
+type Detector interface {
+	Name() string
+	Run(ctx context.Context, cameras []Camera, emit func(Event)) error
+}
+
+// Config holds a plugin's settings from the config file.
+type Config map[string]any
+
+// Decode copies the settings into out, a pointer to a struct with json tags.
+func (c Config) Decode(out any) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("invalid plugin config: %w", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid plugin config: %w", err)
+	}
+	return nil
+}
+
+type (
+	NotifierFactory func(name string, cfg Config) (Notifier, error)
+	DetectorFactory func(name string, cfg Config) (Detector, error)
+)
+
+var (
+	registryMu sync.RWMutex
+	notifiers  = make(map[string]NotifierFactory)
+	detectors  = make(map[string]DetectorFactory)
+)
+
+// RegisterNotifier makes a compiled-in notifier available under kind. It is
+// meant to be called from an init function and panics on a duplicate.
+func RegisterNotifier(kind string, factory NotifierFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := notifiers[kind]; dup {
+		panic("plugin: notifier " + kind + " registered twice")
+	}
+	notifiers[kind] = factory
+}
+
+// RegisterDetector makes a compiled-in detector available under kind. It is
+// meant to be called from an init function and panics on a duplicate.
+func RegisterDetector(kind string, factory DetectorFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := detectors[kind]; dup {
+		panic("plugin: detector " + kind + " registered twice")
+	}
+	detectors[kind] = factory
+}
+
+// NewNotifier creates a compiled-in notifier of the given kind.
+func NewNotifier(kind, name string, cfg Config) (Notifier, error) {
+	registryMu.RLock()
+	factory, ok := notifiers[kind]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown notifier plugin %q", kind)
+	}
+	return factory(name, cfg)
+}
+
+// NewDetector creates a compiled-in detector of the given kind.
+func NewDetector(kind, name string, cfg Config) (Detector, error) {
+	registryMu.RLock()
+	factory, ok := detectors[kind]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown detector plugin %q", kind)
+	}
+	return factory(name, cfg)
+}
+
+// Notifiers lists the kinds of compiled-in notifiers.
+func Notifiers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return sortedKeys(notifiers)
+}
+
+// Detectors lists the kinds of compiled-in detectors.
+func Detectors() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return sortedKeys(detectors)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
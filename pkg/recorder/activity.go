@@ -0,0 +1,46 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sceneScorePattern = regexp.MustCompile(`lavfi\.scene_score=([0-9.]+)`)
+
+// SceneActivity samples one small frame per second of the recording and
+// returns the largest scene change between two samples, from 0 for a still
+// picture to 1 for a cut to a different scene. Sensor noise at night usually
+// stays below 0.01. The recording is decoded with hwaccel.
+func SceneActivity(ctx context.Context, path string, hwaccel HWAccel) (float64, error) {
+	args := append([]string{"-hide_banner", "-nostats"}, hwaccel.InputArgs()...)
+	args = append(args,
+		"-i", path,
+		"-an",
+		"-vf", "fps=1,scale=160:-2,select='gte(scene,0)',metadata=print:key=lavfi.scene_score",
+		"-f", "null",
+		"-",
+	)
+	output, err := ffmpegCommand(ctx, args...).CombinedOutput()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return 0, fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+	}
+
+	var activity float64
+	var samples int
+	for _, match := range sceneScorePattern.FindAllStringSubmatch(string(output), -1) {
+		score, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+		samples++
+		activity = max(activity, score)
+	}
+	if samples < 2 {
+		return 0, fmt.Errorf("recording too short to analyze")
+	}
+	return activity, nil
+}
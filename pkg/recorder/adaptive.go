@@ -0,0 +1,67 @@
+package recorder
+
+import "time"
+
+// AdaptiveSegments varies the length of segments with how many events a
+// camera had in the last Window. Once it had BusyEvents, segments shrink to
+// MinDuration so retention and review work on finer pieces; after a Window
+// without any, they grow to MaxDuration so quiet hours make fewer files. In
+// between, the configured segment duration applies. A new length takes effect
+// from the next segment, so no footage is lost to cutting one short.
+type AdaptiveSegments struct {
+	Enabled     bool          `mapstructure:"enabled" yaml:"enabled"`
+	MinDuration time.Duration `mapstructure:"min_duration" yaml:"min_duration"`
+	MaxDuration time.Duration `mapstructure:"max_duration" yaml:"max_duration"`
+	Window      time.Duration `mapstructure:"window" yaml:"window"`
+	BusyEvents  int           `mapstructure:"busy_events" yaml:"busy_events"`
+}
+
+var DefaultAdaptiveSegments = AdaptiveSegments{
+	MinDuration: time.Minute,
+	MaxDuration: 30 * time.Minute,
+	Window:      30 * time.Minute,
+	BusyEvents:  5,
+}
+
+// length returns the segment length for a camera that had events in the
+// last Window, base being the configured segment duration.
+func (a AdaptiveSegments) length(base time.Duration, events int) time.Duration {
+	switch {
+	case !a.Enabled:
+		return base
+	case events >= a.BusyEvents:
+		return a.MinDuration
+	case events == 0:
+		return a.MaxDuration
+	}
+	return base
+}
+
+// noteEvent counts an event for adaptive segments. The caller holds r.mu.
+func (r *Recorder) noteEvent(at time.Time) {
+	if !r.adaptive.Enabled {
+		r.events = nil
+		return
+	}
+	r.events = append(r.recentEvents(at), at)
+}
+
+// recentEvents drops the events older than the adaptive window and returns
+// the rest. The caller holds r.mu.
+func (r *Recorder) recentEvents(now time.Time) []time.Time {
+	cutoff := now.Add(-r.adaptive.Window)
+	i := 0
+	for i < len(r.events) && !r.events[i].After(cutoff) {
+		i++
+	}
+	r.events = r.events[i:]
+	return r.events
+}
+
+// adaptiveLength returns the length adaptive segments pick at now, or the
+// configured segment duration while they are off.
+func (r *Recorder) adaptiveLength(now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.adaptive.length(r.opts.SegmentDuration, len(r.recentEvents(now)))
+}
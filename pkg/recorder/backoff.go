@@ -0,0 +1,87 @@
+package recorder
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+)
+
+const probeTimeout = 5 * time.Second
+
+// RetryPolicy says how a recorder retries a camera that fails. The delay
+// starts at InitialDelay and grows by Multiplier up to MaxDelay, each varied by
+// up to ±Jitter so cameras behind the same switch do not retry in step.
+// Permanent errors such as bad credentials wait MaxDelay straight away. After
+// MaxRetryWindow of failing without recording, the circuit opens: the
+// recorder stops running ffmpeg and only checks every ProbeInterval whether
+// the camera accepts connections. Zero MaxRetryWindow retries forever.
+type RetryPolicy struct {
+	InitialDelay   time.Duration `mapstructure:"initial_delay" yaml:"initial_delay"`
+	MaxDelay       time.Duration `mapstructure:"max_delay" yaml:"max_delay"`
+	Multiplier     float64       `mapstructure:"multiplier" yaml:"multiplier"`
+	Jitter         float64       `mapstructure:"jitter" yaml:"jitter"`
+	MaxRetryWindow time.Duration `mapstructure:"max_retry_window" yaml:"max_retry_window"`
+	ProbeInterval  time.Duration `mapstructure:"probe_interval" yaml:"probe_interval"`
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	InitialDelay:   5 * time.Second,
+	MaxDelay:       5 * time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+	MaxRetryWindow: 30 * time.Minute,
+	ProbeInterval:  time.Minute,
+}
+
+func (p RetryPolicy) delay(attempt int, permanent bool) time.Duration {
+	d := p.MaxDelay
+	if !permanent {
+		d = p.InitialDelay
+		for i := 1; i < attempt && d < p.MaxDelay; i++ {
+			d = time.Duration(float64(d) * p.Multiplier)
+		}
+		d = min(d, p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+	return max(d, time.Second)
+}
+
+// RetryStatus describes a recorder that is failing. It is nil in the status
+// of a recorder that is not.
+type RetryStatus struct {
+	Attempts       int       `json:"attempts"`
+	FailingSince   time.Time `json:"failing_since"`
+	NextRetryAt    time.Time `json:"next_retry_at"`
+	CircuitOpen    bool      `json:"circuit_open"`
+	LastProbeAt    time.Time `json:"last_probe_at,omitzero"`
+	LastProbeError string    `json:"last_probe_error,omitempty"`
+	// PowerCycles counts the times the camera was power-cycled while
+	// failing, last at PowerCycledAt.
+	PowerCycles   int       `json:"power_cycles,omitempty"`
+	PowerCycledAt time.Time `json:"power_cycled_at,omitzero"`
+}
+
+// probeCamera checks whether the camera accepts a TCP connection, which is
+// far cheaper than starting ffmpeg against it. Local devices always pass.
+func probeCamera(ctx context.Context, rawURL string) error {
+	src, err := source.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	addr, ok := src.Address()
+	if !ok {
+		return nil
+	}
+
+	dialer := net.Dialer{Timeout: probeTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,115 @@
+package recorder
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// NewBuffer returns a spool for a directory on a RAM disk, which takes every
+// new segment until it holds limit bytes. Segments started while it is full
+// go straight to the recordings directory, and a flush is asked for.
+func NewBuffer(dir string, limit int64) *Spool {
+	s := NewSpool(dir)
+	s.limit = limit
+	s.full = make(chan struct{}, 1)
+	s.active.Store(true)
+	return s
+}
+
+// accepting reports whether a new segment should be recorded to the buffer.
+func (s *Spool) accepting() bool {
+	if !s.Active() {
+		return false
+	}
+	if s.limit <= 0 || dirSize(s.dir) < s.limit {
+		return true
+	}
+	select {
+	case s.full <- struct{}{}:
+	default:
+	}
+	return false
+}
+
+// dirSize adds up the files under dir, including segments being recorded.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// SetBuffer makes recorders record to a RAM buffer, whose finished segments
+// FlushBuffer moves to the recordings directory.
+func (rm *RecorderManager) SetBuffer(buffer *Spool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.buffer = buffer
+	for _, rec := range rm.recorders {
+		rec.mu.Lock()
+		rec.buffer = buffer
+		rec.mu.Unlock()
+	}
+}
+
+// FlushBuffer moves the finished segments in the RAM buffer to the
+// recordings directory and indexes them.
+func (rm *RecorderManager) FlushBuffer() (int, error) {
+	rm.mu.RLock()
+	buffer, hook := rm.buffer, rm.segmentHook
+	rm.mu.RUnlock()
+
+	if buffer == nil {
+		return 0, nil
+	}
+	return buffer.drain(rm.opts.OutputDir, hook)
+}
+
+// StartBufferFlush flushes the RAM buffer every interval, and as soon as it
+// fills up, until ctx is done. Flushes wait while the recordings disk is
+// stalled and segments go to the spool.
+func (rm *RecorderManager) StartBufferFlush(ctx context.Context, interval time.Duration) {
+	rm.mu.RLock()
+	buffer := rm.buffer
+	rm.mu.RUnlock()
+	if buffer == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-buffer.full:
+				log.Printf("RAM buffer is full, flushing early")
+			}
+
+			rm.mu.RLock()
+			stalled := rm.spool.Active()
+			rm.mu.RUnlock()
+			if stalled {
+				continue
+			}
+			if moved, err := rm.FlushBuffer(); err != nil {
+				log.Printf("Warning: %v", err)
+			} else if moved > 0 {
+				log.Printf("Flushed %d segments from the RAM buffer", moved)
+			}
+		}
+	}()
+}
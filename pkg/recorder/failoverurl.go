@@ -0,0 +1,150 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// failoverAfter is how many times in a row the main URL must fail before
+	// a camera switches to its failover URL.
+	failoverAfter = 2
+	// failbackInterval is how often a camera on its failover URL checks
+	// whether the main URL answers again.
+	failbackInterval = time.Minute
+)
+
+// FailoverHook is called when a camera switches to its failover URL, with
+// failover true and why, and when it switches back to its main URL.
+type FailoverHook func(camera string, failover bool, err error)
+
+// FailoverStatus is set in the status of a camera recording from its
+// failover URL.
+type FailoverStatus struct {
+	Since     time.Time `json:"since"`
+	Reason    string    `json:"reason,omitempty"`
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+}
+
+// inputURL returns the URL the next segment is recorded from.
+func (r *Recorder) inputURL() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failover != nil {
+		return r.failoverURL
+	}
+	return r.rtspURL
+}
+
+// FailoverStatus returns a copy of the failover state, or nil while the
+// camera records from its main URL.
+func (r *Recorder) FailoverStatus() *FailoverStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failover == nil {
+		return nil
+	}
+	status := *r.failover
+	return &status
+}
+
+// switchOnFailure is called when a segment failed with err. A camera with a
+// failover URL switches to it once the main URL failed failoverAfter times in
+// a row, or once after failing back, and reports true to retry at once. On
+// the failover URL, a failure switches back to the main URL, retried as
+// usual.
+func (r *Recorder) switchOnFailure(err error) bool {
+	r.mu.Lock()
+	if r.failoverURL == "" {
+		r.mu.Unlock()
+		return false
+	}
+	if r.failover != nil {
+		r.failover = nil
+		r.mainFailures = 0
+		hook := r.failoverHook
+		r.mu.Unlock()
+		log.Printf("[%s] Failover URL failed too, switching back to the main URL", r.cameraName)
+		if hook != nil {
+			hook(r.cameraName, false, fmt.Errorf("failover URL failed: %w", err))
+		}
+		return false
+	}
+	r.mainFailures++
+	if r.mainFailures < failoverAfter && !r.failedBack {
+		r.mu.Unlock()
+		return false
+	}
+	r.failover = &FailoverStatus{Since: time.Now(), Reason: err.Error()}
+	r.failedBack = false
+	r.mainUp = false
+	hook := r.failoverHook
+	r.mu.Unlock()
+
+	log.Printf("[%s] Main URL failed, switching to the failover URL", r.cameraName)
+	if hook != nil {
+		hook(r.cameraName, true, err)
+	}
+	return true
+}
+
+// recorded is called when a segment was recorded. The main URL then counts
+// as working again.
+func (r *Recorder) recorded() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failover == nil {
+		r.mainFailures = 0
+		r.failedBack = false
+	}
+}
+
+// checkFailback is called before each segment on the failover URL. It
+// switches back to the main URL once a check found it answering, and
+// otherwise starts a check in the background when one is due, so the check
+// never holds up recording.
+func (r *Recorder) checkFailback(ctx context.Context) {
+	r.mu.Lock()
+	status := r.failover
+	if status == nil {
+		r.mu.Unlock()
+		return
+	}
+	if r.mainUp {
+		r.failover = nil
+		r.mainUp = false
+		r.mainFailures = 0
+		r.failedBack = true
+		hook := r.failoverHook
+		r.mu.Unlock()
+		log.Printf("[%s] Main URL answers again, switching back to it", r.cameraName)
+		if hook != nil {
+			hook(r.cameraName, false, nil)
+		}
+		return
+	}
+	last := status.Since
+	if status.CheckedAt.After(last) {
+		last = status.CheckedAt
+	}
+	if time.Since(last) < failbackInterval || r.checkingMain {
+		r.mu.Unlock()
+		return
+	}
+	r.checkingMain = true
+	mainURL := r.rtspURL
+	r.mu.Unlock()
+
+	go func() {
+		err := probeCamera(ctx, mainURL)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.checkingMain = false
+		if r.failover == status {
+			status.CheckedAt = time.Now()
+			r.mainUp = err == nil
+		}
+	}()
+}
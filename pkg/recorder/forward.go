@@ -0,0 +1,348 @@
+package recorder
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	forwardSyncInterval = 5 * time.Second
+	// A forward that ran this long before failing retries from the initial
+	// delay again.
+	forwardStableRun = time.Minute
+)
+
+// ForwardTarget is a camera stream pushed to an external system: Input is
+// the URL to read it from, Output one of the camera's forward URLs. NoAudio
+// leaves the camera's audio out, as for its live view.
+type ForwardTarget struct {
+	Camera  string
+	Input   string
+	Output  string
+	NoAudio bool
+}
+
+// ForwardStatus describes a stream being forwarded.
+type ForwardStatus struct {
+	URL       string    `json:"url"`
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	Restarts  int       `json:"restarts,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	// SDP describes an RTP stream, for the receiver to open.
+	SDP string `json:"sdp,omitempty"`
+}
+
+// ValidForwardURL checks that rawURL is somewhere a stream can be pushed:
+// an RTSP server (rtsp:// or rtsps://), an RTP receiver (rtp://), an
+// MPEG-TS listener (udp://) or a live streaming service (rtmp:// or
+// rtmps://).
+func ValidForwardURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "rtsp", "rtsps", "rtmp", "rtmps":
+		if u.Host == "" {
+			return fmt.Errorf("%s has no host", source.Redact(rawURL))
+		}
+	case "rtp", "udp":
+		if u.Hostname() == "" || u.Port() == "" {
+			return fmt.Errorf("%s needs a host and port", source.Redact(rawURL))
+		}
+	default:
+		return fmt.Errorf("%s must be an rtsp://, rtsps://, rtp://, udp://, rtmp:// or rtmps:// URL", source.Redact(rawURL))
+	}
+	return nil
+}
+
+// Forwarder pushes the live streams of cameras to external systems, such as
+// an object detector or a live streaming service, with an ffmpeg per target. The targets are checked
+// every forwardSyncInterval: forwards start as cameras come up and stop when
+// they go away or are changed. A failing forward is retried with backoff and
+// never affects recording.
+type Forwarder struct {
+	sdpDir  string
+	targets func() []ForwardTarget
+
+	mu       sync.Mutex
+	forwards map[ForwardTarget]*forward
+}
+
+func NewForwarder(sdpDir string, targets func() []ForwardTarget) *Forwarder {
+	return &Forwarder{
+		sdpDir:   sdpDir,
+		targets:  targets,
+		forwards: make(map[ForwardTarget]*forward),
+	}
+}
+
+// Start keeps the forwards in step with the targets until ctx is done.
+func (f *Forwarder) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(forwardSyncInterval)
+		defer ticker.Stop()
+		for {
+			f.sync(ctx)
+			select {
+			case <-ctx.Done():
+				f.mu.Lock()
+				defer f.mu.Unlock()
+				for target, fw := range f.forwards {
+					fw.cancel()
+					delete(f.forwards, target)
+				}
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (f *Forwarder) sync(ctx context.Context) {
+	want := make(map[ForwardTarget]bool)
+	for _, target := range f.targets() {
+		want[target] = true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for target, fw := range f.forwards {
+		if !want[target] {
+			fw.cancel()
+			delete(f.forwards, target)
+		}
+	}
+	for target := range want {
+		if _, ok := f.forwards[target]; ok || ctx.Err() != nil {
+			continue
+		}
+		fwCtx, cancel := context.WithCancel(ctx)
+		fw := &forward{
+			target: target,
+			cancel: cancel,
+			status: ForwardStatus{URL: source.Redact(target.Output), State: "starting", Since: time.Now()},
+		}
+		if strings.HasPrefix(target.Output, "rtp:") {
+			sum := sha256.Sum256([]byte(target.Output))
+			fw.sdpPath = filepath.Join(f.sdpDir, fmt.Sprintf("%s_%x.sdp", storage.CameraDirName(target.Camera), sum[:4]))
+		}
+		f.forwards[target] = fw
+		go fw.run(fwCtx)
+	}
+}
+
+// Status returns the forwards of a camera.
+func (f *Forwarder) Status(camera string) []ForwardStatus {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	var statuses []ForwardStatus
+	for target, fw := range f.forwards {
+		if target.Camera == camera {
+			statuses = append(statuses, fw.getStatus())
+		}
+	}
+	f.mu.Unlock()
+
+	slices.SortFunc(statuses, func(a, b ForwardStatus) int { return strings.Compare(a.URL, b.URL) })
+	return statuses
+}
+
+type forward struct {
+	target  ForwardTarget
+	sdpPath string
+	cancel  context.CancelFunc
+
+	mu     sync.Mutex
+	status ForwardStatus
+}
+
+func (fw *forward) getStatus() ForwardStatus {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	status := fw.status
+	if fw.sdpPath != "" && status.State == "running" {
+		if sdp, err := os.ReadFile(fw.sdpPath); err == nil {
+			status.SDP = string(sdp)
+		}
+	}
+	return status
+}
+
+func (fw *forward) setState(state string, err error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.status.State = state
+	fw.status.Since = time.Now()
+	if err != nil {
+		fw.status.LastError = err.Error()
+		fw.status.Restarts++
+	}
+}
+
+func (fw *forward) run(ctx context.Context) {
+	name, output := fw.target.Camera, source.Redact(fw.target.Output)
+	if fw.sdpPath != "" {
+		defer os.Remove(fw.sdpPath)
+	}
+	log.Printf("[%s] Forwarding stream to %s", name, output)
+
+	attempt := 0
+	for {
+		started := time.Now()
+		fw.setState("running", nil)
+		err := fw.runOnce(ctx)
+		if ctx.Err() != nil {
+			log.Printf("[%s] Stopped forwarding stream to %s", name, output)
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("ffmpeg exited")
+		}
+		if time.Since(started) > forwardStableRun {
+			attempt = 0
+		}
+		attempt++
+		delay := DefaultRetryPolicy.delay(attempt, false)
+		log.Printf("Warning: [%s] Forward to %s failed: %v, retrying in %s", name, output, err, delay.Round(time.Second))
+		fw.setState("retrying", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (fw *forward) runOnce(ctx context.Context) error {
+	args, err := fw.args()
+	if err != nil {
+		return err
+	}
+	if fw.sdpPath != "" {
+		if err := os.MkdirAll(filepath.Dir(fw.sdpPath), 0755); err != nil {
+			return fmt.Errorf("failed to create SDP directory: %w", err)
+		}
+	}
+
+	cmd := ffmpegCommand(ctx, args...)
+	stderr := &tailWriter{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if line := stderr.lastLine(); line != "" {
+			return fmt.Errorf("%w: %s", err, fw.redact(line))
+		}
+		return err
+	}
+	return nil
+}
+
+// redact hides the output's secrets in what ffmpeg printed.
+func (fw *forward) redact(line string) string {
+	line = strings.ReplaceAll(line, fw.target.Output, source.Redact(fw.target.Output))
+	if u, err := url.Parse(fw.target.Output); err == nil {
+		if _, key, ok := source.CutStreamKey(u); ok {
+			line = strings.ReplaceAll(line, key, "xxxxx")
+		}
+		if password, ok := u.User.Password(); ok && password != "" {
+			line = strings.ReplaceAll(line, password, "xxxxx")
+		}
+	}
+	return line
+}
+
+// args builds the ffmpeg command line. Network sources are passed through
+// unchanged; local devices are encoded to H.264 as for restreaming.
+func (fw *forward) args() ([]string, error) {
+	src, err := source.Parse(fw.target.Input)
+	if err != nil {
+		return nil, err
+	}
+	out, err := url.Parse(fw.target.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"-v", "error"}
+	args = append(args, src.InputArgs()...)
+	args = append(args, src.NetworkArgs()...)
+	args = append(args, "-fflags", "+genpts")
+	if src.IsLocal() {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-g", "60")
+	} else {
+		args = append(args, "-c:v", "copy")
+	}
+
+	if fw.target.NoAudio {
+		args = append(args, "-an")
+	}
+
+	switch out.Scheme {
+	case "rtsp", "rtsps":
+		if src.IsLocal() {
+			args = append(args, "-c:a", "aac")
+		} else {
+			args = append(args, "-c:a", "copy")
+		}
+		args = append(args, "-f", "rtsp", "-rtsp_transport", "tcp", fw.target.Output)
+	case "rtp":
+		// An RTP session carries one stream, so audio is left out.
+		args = append(args, "-an", "-f", "rtp", "-sdp_file", fw.sdpPath, fw.target.Output)
+	case "udp":
+		if !out.Query().Has("pkt_size") {
+			q := out.Query()
+			q.Set("pkt_size", "1316")
+			out.RawQuery = q.Encode()
+		}
+		args = append(args, "-c:a", "aac", "-f", "mpegts", out.String())
+	case "rtmp", "rtmps":
+		// Streaming services take AAC audio at 44.1 kHz in FLV.
+		args = append(args, "-c:a", "aac", "-ar", "44100", "-b:a", "128k",
+			"-f", "flv", "-flvflags", "no_duration_filesize", fw.target.Output)
+	default:
+		return nil, fmt.Errorf("unsupported forward URL %s", source.Redact(fw.target.Output))
+	}
+	return args, nil
+}
+
+// tailWriter keeps the end of what is written to it, so a long-running
+// ffmpeg's errors can be reported without holding all of its output.
+type tailWriter struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+const tailSize = 4096
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > tailSize {
+		w.buf = w.buf[len(w.buf)-tailSize:]
+	}
+	return len(p), nil
+}
+
+func (w *tailWriter) lastLine() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	lines := strings.Split(strings.TrimSpace(string(w.buf)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
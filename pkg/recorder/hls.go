@@ -0,0 +1,239 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	hlsReadyTimeout = 15 * time.Second
+	hlsPlaylist     = "index.m3u8"
+	HLSMaster       = "master.m3u8"
+)
+
+var hlsFilePattern = regexp.MustCompile(`^(master\.m3u8|index\.m3u8|init\.mp4|seg_\d+\.m4s)$`)
+
+func IsHLSFile(name string) bool {
+	return hlsFilePattern.MatchString(name)
+}
+
+type hlsStream struct {
+	dir        string
+	rtspURL    string
+	audio      bool
+	cmd        *exec.Cmd
+	lastAccess time.Time
+	done       chan struct{}
+}
+
+// HLSManager runs an on-demand HLS preview per camera. Unlike the MJPEG
+// preview it carries the camera's audio track, and video is passed through
+// without re-encoding. Streams stop after previewIdleTimeout without requests.
+type HLSManager struct {
+	baseDir string
+	ctx     context.Context
+	streams map[string]*hlsStream
+	mu      sync.Mutex
+}
+
+func NewHLSManager() *HLSManager {
+	return &HLSManager{
+		baseDir: filepath.Join(os.TempDir(), fmt.Sprintf("cam-recorder-hls-%d", os.Getpid())),
+		ctx:     context.Background(),
+		streams: make(map[string]*hlsStream),
+	}
+}
+
+func (m *HLSManager) Start(ctx context.Context) {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(previewIdleTimeout / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				m.StopAll()
+				return
+			case <-ticker.C:
+				m.stopIdle()
+			}
+		}
+	}()
+}
+
+// Open returns the directory holding the camera's playlists and segments,
+// starting ffmpeg when needed and waiting until the master playlist exists.
+func (m *HLSManager) Open(ctx context.Context, name, rtspURL string, audio bool) (string, error) {
+	m.mu.Lock()
+	st := m.streams[name]
+	if st != nil && (st.rtspURL != rtspURL || st.audio != audio) {
+		m.stopLocked(name, st)
+		st = nil
+	}
+	if st == nil {
+		var err error
+		if st, err = m.startLocked(name, rtspURL, audio); err != nil {
+			m.mu.Unlock()
+			return "", err
+		}
+	}
+	st.lastAccess = time.Now()
+	m.mu.Unlock()
+
+	master := filepath.Join(st.dir, HLSMaster)
+	deadline := time.NewTimer(hlsReadyTimeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(200 * time.Millisecond)
+	defer poll.Stop()
+
+	for {
+		if _, err := os.Stat(master); err == nil {
+			return st.dir, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-st.done:
+			return "", fmt.Errorf("live stream for %s exited", name)
+		case <-deadline.C:
+			return "", fmt.Errorf("timed out waiting for live stream of %s", name)
+		case <-poll.C:
+		}
+	}
+}
+
+// Dir returns the directory of a running stream and marks it as in use.
+func (m *HLSManager) Dir(name string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.streams[name]
+	if !ok {
+		return "", false
+	}
+	st.lastAccess = time.Now()
+	return st.dir, true
+}
+
+func (m *HLSManager) Stop(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if st, ok := m.streams[name]; ok {
+		m.stopLocked(name, st)
+	}
+}
+
+func (m *HLSManager) StopAll() {
+	m.mu.Lock()
+	streams := make([]*hlsStream, 0, len(m.streams))
+	for name, st := range m.streams {
+		streams = append(streams, st)
+		m.stopLocked(name, st)
+	}
+	m.mu.Unlock()
+
+	for _, st := range streams {
+		<-st.done
+	}
+	os.RemoveAll(m.baseDir)
+}
+
+func (m *HLSManager) stopIdle() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, st := range m.streams {
+		if time.Since(st.lastAccess) > previewIdleTimeout {
+			m.stopLocked(name, st)
+		}
+	}
+}
+
+func (m *HLSManager) startLocked(name, rtspURL string, audio bool) (*hlsStream, error) {
+	src, err := source.Parse(rtspURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each run gets its own directory so cleanup of a stopped stream can
+	// never remove files of its replacement.
+	dir := filepath.Join(m.baseDir, storage.CameraDirName(name)+"-"+strconv.FormatInt(time.Now().UnixNano(), 36))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create live stream directory: %w", err)
+	}
+
+	args := src.InputArgs()
+	args = append(args, src.NetworkArgs()...)
+	args = append(args, "-fflags", "+genpts")
+	if src.IsLocal() {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-g", "60")
+	} else {
+		args = append(args, "-c:v", "copy")
+	}
+	if audio {
+		args = append(args, "-c:a", "aac", "-b:a", "96k")
+	} else {
+		args = append(args, "-an")
+	}
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", "2",
+		"-hls_list_size", "6",
+		"-hls_flags", "delete_segments+independent_segments+omit_endlist",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", "init.mp4",
+		"-hls_segment_filename", filepath.Join(dir, "seg_%05d.m4s"),
+		"-master_pl_name", HLSMaster,
+		filepath.Join(dir, hlsPlaylist),
+	)
+
+	cmd := ffmpegCommand(m.ctx, args...)
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	st := &hlsStream{
+		dir:     dir,
+		rtspURL: rtspURL,
+		audio:   audio,
+		cmd:     cmd,
+		done:    make(chan struct{}),
+	}
+	m.streams[name] = st
+
+	go func() {
+		cmd.Wait()
+		m.mu.Lock()
+		if m.streams[name] == st {
+			delete(m.streams, name)
+		}
+		m.mu.Unlock()
+		os.RemoveAll(dir)
+		close(st.done)
+	}()
+
+	return st, nil
+}
+
+func (m *HLSManager) stopLocked(name string, st *hlsStream) {
+	if m.streams[name] == st {
+		delete(m.streams, name)
+	}
+	interrupt(st.cmd)
+}
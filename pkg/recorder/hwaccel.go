@@ -0,0 +1,33 @@
+package recorder
+
+import "slices"
+
+// hwaccelTypes are the ffmpeg -hwaccel methods that can be configured.
+var hwaccelTypes = []string{"auto", "vaapi", "cuda", "qsv", "videotoolbox", "d3d11va", "dxva2"}
+
+// HWAccel offloads decoding of camera streams to a GPU. Only decoding moves;
+// decoded frames are copied back to memory, so filters and encoders stay the
+// same. An empty Type decodes in software. Device picks the GPU, e.g.
+// /dev/dri/renderD128 for vaapi or 0 for cuda.
+type HWAccel struct {
+	Type   string `mapstructure:"hwaccel" yaml:"hwaccel,omitempty"`
+	Device string `mapstructure:"device" yaml:"device,omitempty"`
+}
+
+// ValidHWAccel reports whether t is empty or a supported -hwaccel method.
+func ValidHWAccel(t string) bool {
+	return t == "" || slices.Contains(hwaccelTypes, t)
+}
+
+// InputArgs returns the ffmpeg options that go before the -i of the stream to
+// decode.
+func (h HWAccel) InputArgs() []string {
+	if h.Type == "" {
+		return nil
+	}
+	args := []string{"-hwaccel", h.Type}
+	if h.Device != "" {
+		args = append(args, "-hwaccel_device", h.Device)
+	}
+	return args
+}
@@ -0,0 +1,467 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+)
+
+const (
+	// How long the camera connection stays open after the last client
+	// leaves, so the gap between two recording segments does not drop it.
+	ingestLinger = 10 * time.Second
+	// Chunks a slow client may fall behind by before it is disconnected.
+	ingestClientBuffer = 256
+	ingestWriteTimeout = 10 * time.Second
+
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+)
+
+// IngestManager keeps one connection per camera and relays it to any number
+// of local clients, so recording, previews and detectors do not each open
+// their own. Every camera gets a tcp://127.0.0.1 URL serving MPEG-TS; the
+// camera is connected while at least one client is, and every client starts
+// at a keyframe. Video is passed through; audio is converted to AAC, which
+// every container the recorder writes can hold.
+type IngestManager struct {
+	ctx     context.Context
+	ingests map[string]*ingest
+	mu      sync.Mutex
+}
+
+func NewIngestManager() *IngestManager {
+	return &IngestManager{
+		ctx:     context.Background(),
+		ingests: make(map[string]*ingest),
+	}
+}
+
+// Start ties the camera connections to ctx and closes everything once it is
+// done.
+func (m *IngestManager) Start(ctx context.Context) {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.StopAll()
+	}()
+}
+
+// URL returns the local URL relaying the camera at rtspURL.
+func (m *IngestManager) URL(name, rtspURL string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if in, ok := m.ingests[name]; ok {
+		if in.rtspURL == rtspURL {
+			return in.url, nil
+		}
+		in.close()
+		delete(m.ingests, name)
+	}
+
+	in, err := newIngest(m.ctx, name, rtspURL)
+	if err != nil {
+		return "", err
+	}
+	m.ingests[name] = in
+	return in.url, nil
+}
+
+// InputURL is URL, falling back to rtspURL if the relay cannot be set up or
+// m is nil.
+func (m *IngestManager) InputURL(name, rtspURL string) string {
+	if m == nil {
+		return rtspURL
+	}
+	u, err := m.URL(name, rtspURL)
+	if err != nil {
+		log.Printf("Warning: [%s] %v, connecting to the camera directly", name, err)
+		return rtspURL
+	}
+	return u
+}
+
+// Remove closes the relay of a camera and disconnects its clients.
+func (m *IngestManager) Remove(name string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if in, ok := m.ingests[name]; ok {
+		in.close()
+		delete(m.ingests, name)
+	}
+}
+
+func (m *IngestManager) StopAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, in := range m.ingests {
+		in.close()
+		delete(m.ingests, name)
+	}
+}
+
+// Clients returns how many local clients read the camera's relay.
+func (m *IngestManager) Clients(name string) int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	in, ok := m.ingests[name]
+	m.mu.Unlock()
+	if !ok {
+		return 0
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return len(in.clients)
+}
+
+type ingestClient struct {
+	conn    net.Conn
+	ch      chan []byte
+	started bool
+}
+
+// ingest relays one camera. pat and pmt are the latest program tables,
+// which a client needs before its first keyframe.
+type ingest struct {
+	ctx      context.Context
+	name     string
+	rtspURL  string
+	url      string
+	listener net.Listener
+
+	mu       sync.Mutex
+	clients  map[*ingestClient]struct{}
+	cmd      *exec.Cmd
+	linger   *time.Timer
+	closed   bool
+	pat, pmt []byte
+	pmtPID   int
+	videoPID int
+	hasVideo bool
+}
+
+// ServeIngest relays rawURL as MPEG-TS to every client of listener, the way
+// the shared ingest relays a camera, until ctx is done.
+func ServeIngest(ctx context.Context, name, rawURL string, listener net.Listener) {
+	in := newIngestOn(ctx, name, rawURL, listener)
+	<-ctx.Done()
+	in.close()
+}
+
+func newIngest(ctx context.Context, name, rtspURL string) (*ingest, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ingest relay: %w", err)
+	}
+	return newIngestOn(ctx, name, rtspURL, listener), nil
+}
+
+func newIngestOn(ctx context.Context, name, rtspURL string, listener net.Listener) *ingest {
+	in := &ingest{
+		ctx:      ctx,
+		name:     name,
+		rtspURL:  rtspURL,
+		url:      "tcp://" + listener.Addr().String(),
+		listener: listener,
+		clients:  make(map[*ingestClient]struct{}),
+	}
+	go in.accept()
+	return in
+}
+
+func (in *ingest) accept() {
+	for {
+		conn, err := in.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		client := &ingestClient{conn: conn, ch: make(chan []byte, ingestClientBuffer)}
+		in.mu.Lock()
+		if in.closed {
+			in.mu.Unlock()
+			conn.Close()
+			return
+		}
+		in.clients[client] = struct{}{}
+		if in.linger != nil {
+			in.linger.Stop()
+			in.linger = nil
+		}
+		if in.cmd == nil {
+			in.startLocked()
+		}
+		in.mu.Unlock()
+
+		go in.serve(client)
+	}
+}
+
+func (in *ingest) serve(client *ingestClient) {
+	// Clients never send anything; a read returning means they are gone.
+	go func() {
+		io.Copy(io.Discard, client.conn)
+		in.mu.Lock()
+		in.dropLocked(client)
+		in.mu.Unlock()
+	}()
+
+	for chunk := range client.ch {
+		client.conn.SetWriteDeadline(time.Now().Add(ingestWriteTimeout))
+		if _, err := client.conn.Write(chunk); err != nil {
+			break
+		}
+	}
+	client.conn.Close()
+
+	in.mu.Lock()
+	in.dropLocked(client)
+	in.mu.Unlock()
+}
+
+func (in *ingest) dropLocked(client *ingestClient) {
+	if _, ok := in.clients[client]; !ok {
+		return
+	}
+	delete(in.clients, client)
+	close(client.ch)
+
+	if len(in.clients) == 0 && in.cmd != nil && in.linger == nil {
+		cmd := in.cmd
+		in.linger = time.AfterFunc(ingestLinger, func() {
+			in.mu.Lock()
+			defer in.mu.Unlock()
+			if len(in.clients) == 0 && in.cmd == cmd {
+				interrupt(cmd)
+			}
+		})
+	}
+}
+
+func (in *ingest) startLocked() {
+	src, err := source.Parse(in.rtspURL)
+	if err != nil {
+		log.Printf("[%s] Ingest failed: %v", in.name, err)
+		in.dropAllLocked()
+		return
+	}
+
+	args := src.InputArgs()
+	args = append(args, src.NetworkArgs()...)
+	args = append(args, "-fflags", "+genpts")
+	if src.IsLocal() {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-g", "60")
+	} else {
+		args = append(args, "-c:v", "copy")
+	}
+	args = append(args, "-c:a", "aac", "-b:a", "128k", "-f", "mpegts", "-")
+
+	cmd := ffmpegCommand(in.ctx, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		log.Printf("[%s] Ingest failed to start ffmpeg: %v", in.name, err)
+		in.dropAllLocked()
+		return
+	}
+	in.cmd = cmd
+
+	go func() {
+		in.pump(stdout)
+		err := cmd.Wait()
+
+		in.mu.Lock()
+		defer in.mu.Unlock()
+		if in.cmd != cmd {
+			return
+		}
+		if err != nil && len(in.clients) > 0 && in.ctx.Err() == nil {
+			log.Printf("[%s] Ingest ffmpeg exited: %v", in.name, err)
+		}
+		in.cmd = nil
+		if in.linger != nil {
+			in.linger.Stop()
+			in.linger = nil
+		}
+		in.pat, in.pmt, in.pmtPID, in.hasVideo = nil, nil, 0, false
+		in.dropAllLocked()
+	}()
+}
+
+func (in *ingest) dropAllLocked() {
+	for client := range in.clients {
+		delete(in.clients, client)
+		close(client.ch)
+	}
+}
+
+func (in *ingest) close() {
+	in.listener.Close()
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.closed = true
+	if in.linger != nil {
+		in.linger.Stop()
+		in.linger = nil
+	}
+	interrupt(in.cmd)
+	in.dropAllLocked()
+}
+
+// pump reads MPEG-TS from ffmpeg and hands it on in whole packets.
+func (in *ingest) pump(r io.Reader) {
+	buf := make([]byte, 0, 64*tsPacketSize)
+	read := make([]byte, 32*tsPacketSize)
+	for {
+		n, err := r.Read(read)
+		buf = append(buf, read[:n]...)
+
+		skip := 0
+		for skip < len(buf) && buf[skip] != tsSyncByte {
+			skip++
+		}
+		buf = buf[skip:]
+
+		if whole := len(buf) / tsPacketSize * tsPacketSize; whole > 0 {
+			in.publish(slices.Clone(buf[:whole]))
+			buf = append(buf[:0], buf[whole:]...)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (in *ingest) publish(chunk []byte) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	keyframe := -1
+	for off := 0; off < len(chunk); off += tsPacketSize {
+		pkt := chunk[off : off+tsPacketSize]
+		in.inspect(pkt)
+		if keyframe < 0 && in.startsKeyframe(pkt) {
+			keyframe = off
+		}
+	}
+
+	for client := range in.clients {
+		data := chunk
+		if !client.started {
+			if keyframe < 0 {
+				continue
+			}
+			data = slices.Concat(in.pat, in.pmt, chunk[keyframe:])
+			client.started = true
+		}
+		select {
+		case client.ch <- data:
+		default:
+			log.Printf("Warning: [%s] Ingest client fell behind, disconnecting it", in.name)
+			delete(in.clients, client)
+			close(client.ch)
+		}
+	}
+}
+
+// inspect remembers the PAT and PMT and finds the video stream's PID.
+func (in *ingest) inspect(pkt []byte) {
+	pid := tsPID(pkt)
+	if pkt[1]&0x40 == 0 || (pid != 0 && (in.pmtPID == 0 || pid != in.pmtPID)) {
+		return
+	}
+	payload, ok := tsPayload(pkt)
+	if !ok || int(payload[0])+1 >= len(payload) {
+		return
+	}
+	section := payload[1+int(payload[0]):]
+	if len(section) < 12 {
+		return
+	}
+	end := min(3+(int(section[1]&0x0f)<<8|int(section[2]))-4, len(section))
+
+	if pid == 0 {
+		in.pat = slices.Clone(pkt)
+		for i := 8; i+4 <= end; i += 4 {
+			if program := int(section[i])<<8 | int(section[i+1]); program != 0 {
+				in.pmtPID = int(section[i+2]&0x1f)<<8 | int(section[i+3])
+				break
+			}
+		}
+		return
+	}
+
+	in.pmt = slices.Clone(pkt)
+	in.hasVideo = false
+	for i := 12 + (int(section[10]&0x0f)<<8 | int(section[11])); i+5 <= end; {
+		if isVideoStreamType(section[i]) {
+			in.videoPID = int(section[i+1]&0x1f)<<8 | int(section[i+2])
+			in.hasVideo = true
+			return
+		}
+		i += 5 + (int(section[i+3]&0x0f)<<8 | int(section[i+4]))
+	}
+}
+
+// startsKeyframe reports whether pkt begins a video keyframe, which the
+// muxer marks with the random access indicator. Without video any packet
+// starting a frame will do.
+func (in *ingest) startsKeyframe(pkt []byte) bool {
+	if in.pat == nil || in.pmt == nil || pkt[1]&0x40 == 0 {
+		return false
+	}
+	if !in.hasVideo {
+		return tsPID(pkt) != 0 && tsPID(pkt) != in.pmtPID
+	}
+	hasAdaptation := pkt[3]&0x20 != 0
+	return tsPID(pkt) == in.videoPID && hasAdaptation && pkt[4] > 0 && pkt[5]&0x40 != 0
+}
+
+func tsPID(pkt []byte) int {
+	return int(pkt[1]&0x1f)<<8 | int(pkt[2])
+}
+
+func tsPayload(pkt []byte) ([]byte, bool) {
+	if pkt[3]&0x10 == 0 {
+		return nil, false
+	}
+	off := 4
+	if pkt[3]&0x20 != 0 {
+		off += 1 + int(pkt[4])
+	}
+	if off >= len(pkt) {
+		return nil, false
+	}
+	return pkt[off:], true
+}
+
+func isVideoStreamType(t byte) bool {
+	switch t {
+	case 0x01, 0x02, 0x10, 0x1b, 0x24: // MPEG-1/2, MPEG-4 part 2, H.264, H.265
+		return true
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package recorder
+
+import (
+	"os"
+	"os/exec"
+)
+
+func interruptFunc(cmd *exec.Cmd) func() error {
+	return func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package recorder
+
+import (
+	"io"
+	"os/exec"
+)
+
+// Windows cannot deliver SIGINT to a child process, so ffmpeg is asked to
+// quit through its interactive "q" command on stdin, which still lets it
+// finalize the output file.
+func interruptFunc(cmd *exec.Cmd) func() error {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return func() error {
+			return cmd.Process.Kill()
+		}
+	}
+	return func() error {
+		if _, err := io.WriteString(stdin, "q"); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+}
@@ -0,0 +1,216 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// journalEntry marks a segment ffmpeg is writing. It is removed once the
+// segment is finished, or for a segment in the spool or RAM buffer once it is
+// moved to the recordings directory, so entries left on startup belong to
+// segments that were cut off or left behind by a crash or power loss.
+type journalEntry struct {
+	Camera    string    `json:"camera"`
+	Filename  string    `json:"filename"`
+	Path      string    `json:"path"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+func journalDir(outputDir string) string {
+	return filepath.Join(outputDir, storage.JournalDir)
+}
+
+func openJournal(outputDir string, entry journalEntry) (string, error) {
+	dir := journalDir(outputDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+
+	path := journalPath(outputDir, entry.Camera, entry.Filename)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return "", fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	// The entry has to survive the crash it is meant to detect.
+	if err := f.Sync(); err != nil {
+		return "", fmt.Errorf("failed to sync journal entry: %w", err)
+	}
+	return path, nil
+}
+
+func journalPath(outputDir, camera, filename string) string {
+	return filepath.Join(journalDir(outputDir), storage.CameraDirName(camera)+"_"+filename+".json")
+}
+
+func closeJournal(path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: Failed to remove journal entry %s: %v", path, err)
+	}
+}
+
+// RecoverSegments repairs the segments left unfinished by the previous run.
+// Each one is remuxed into a new container, which rebuilds the index a killed
+// ffmpeg never wrote; files that cannot be read are left in place and
+// reported as failed. Segments found in the spool or RAM buffer are moved to
+// outputDir. Recovered segments are returned for indexing.
+func RecoverSegments(ctx context.Context, outputDir string) ([]RecordingSegment, *storage.RecoveryReport) {
+	report := &storage.RecoveryReport{
+		CheckedAt: time.Now(),
+		Recovered: []storage.RecoveredFile{},
+		Failed:    []storage.RecoveredFile{},
+	}
+
+	dir := journalDir(outputDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Failed to read recording journal: %v", err)
+		}
+		return nil, report
+	}
+
+	var segments []RecordingSegment
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		journalPath := filepath.Join(dir, e.Name())
+
+		data, err := os.ReadFile(journalPath)
+		var entry journalEntry
+		if err == nil {
+			err = json.Unmarshal(data, &entry)
+		}
+		if err != nil || entry.Path == "" {
+			log.Printf("Warning: Ignoring unreadable journal entry %s", e.Name())
+			closeJournal(journalPath)
+			continue
+		}
+
+		file := storage.RecoveredFile{Camera: entry.Camera, Filename: entry.Filename, Path: entry.Path}
+		seg, err := recoverSegment(ctx, entry)
+		if err == nil && !within(outputDir, seg.Path) {
+			seg, err = moveRecovered(outputDir, seg)
+		}
+		if err != nil {
+			file.Error = err.Error()
+			report.Failed = append(report.Failed, file)
+			log.Printf("Warning: Could not recover %s: %v", entry.Path, err)
+		} else {
+			file.Size = seg.Size
+			report.Recovered = append(report.Recovered, file)
+			segments = append(segments, seg)
+			log.Printf("Recovered unfinished segment %s (%s)", entry.Path, seg.Duration)
+		}
+		closeJournal(journalPath)
+	}
+
+	return segments, report
+}
+
+func recoverSegment(ctx context.Context, entry journalEntry) (RecordingSegment, error) {
+	info, err := os.Stat(entry.Path)
+	if os.IsNotExist(err) {
+		return RecordingSegment{}, fmt.Errorf("file was never created")
+	}
+	if err != nil {
+		return RecordingSegment{}, err
+	}
+	if info.Size() == 0 {
+		os.Remove(entry.Path)
+		return RecordingSegment{}, fmt.Errorf("no data was written, removed empty file")
+	}
+	// The last write before the crash is the best estimate of the end.
+	endedAt := info.ModTime()
+
+	ext := filepath.Ext(entry.Path)
+	tmpPath := strings.TrimSuffix(entry.Path, ext) + ".recovering" + ext
+	cmd := ffmpegCommand(ctx,
+		"-v", "error",
+		"-err_detect", "ignore_err",
+		"-i", entry.Path,
+		"-map", "0",
+		"-c", "copy",
+		"-movflags", "+faststart",
+		"-y",
+		tmpPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmpPath)
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		return RecordingSegment{}, fmt.Errorf("remux failed: %w: %s", err, lines[len(lines)-1])
+	}
+
+	tmpInfo, err := os.Stat(tmpPath)
+	if err != nil || tmpInfo.Size() == 0 {
+		os.Remove(tmpPath)
+		return RecordingSegment{}, fmt.Errorf("remux produced no output")
+	}
+	if err := os.Rename(tmpPath, entry.Path); err != nil {
+		os.Remove(tmpPath)
+		return RecordingSegment{}, fmt.Errorf("failed to replace segment: %w", err)
+	}
+	os.Chtimes(entry.Path, endedAt, endedAt)
+
+	return RecordingSegment{
+		Filename:   entry.Filename,
+		CameraName: entry.Camera,
+		Path:       entry.Path,
+		Size:       tmpInfo.Size(),
+		CreatedAt:  endedAt,
+		Duration:   endedAt.Sub(entry.StartedAt).Round(time.Second).String(),
+		StartedAt:  entry.StartedAt,
+		EndedAt:    endedAt,
+	}, nil
+}
+
+// moveRecovered moves a segment recovered outside outputDir into its
+// camera's directory there.
+func moveRecovered(outputDir string, seg RecordingSegment) (RecordingSegment, error) {
+	dir := filepath.Join(outputDir, storage.CameraDirName(seg.CameraName))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return seg, fmt.Errorf("failed to move to the recordings directory: %w", err)
+	}
+	name, err := storage.ClaimName(dir, seg.Filename)
+	if err != nil {
+		return seg, fmt.Errorf("failed to move to the recordings directory: %w", err)
+	}
+	dest := filepath.Join(dir, name)
+	if err := moveFile(seg.Path, dest); err != nil {
+		os.Remove(dest)
+		return seg, fmt.Errorf("failed to move to the recordings directory: %w", err)
+	}
+	os.Chtimes(dest, seg.EndedAt, seg.EndedAt)
+	seg.Filename, seg.Path = name, dest
+	return seg, nil
+}
+
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,127 @@
+package recorder
+
+import (
+	"bytes"
+	"slices"
+)
+
+// Largest JPEG a preview frame may be; anything longer is treated as garbage.
+const maxJPEGFrame = 8 << 20
+
+var jpegSOI = []byte{0xFF, 0xD8}
+
+// jpegSplitter cuts a stream of concatenated JPEGs, as ffmpeg's image2pipe
+// writes them, into frames. Rather than searching for the next end-of-image
+// bytes, which also occur inside thumbnails and other segments, it walks each
+// frame's marker segments by their lengths and only looks for markers in the
+// entropy-coded data, where 0xFF is always escaped. A frame that turns out
+// not to be a JPEG is skipped up to the next start-of-image.
+type jpegSplitter struct {
+	buf []byte
+	// pos is where walking the frame at buf[0] resumes; 0 until a
+	// start-of-image was found.
+	pos int
+	// scan is set while pos is in entropy-coded data.
+	scan bool
+}
+
+func (s *jpegSplitter) write(p []byte) {
+	s.buf = append(s.buf, p...)
+}
+
+// next returns the next complete frame, or nil until more has been written.
+func (s *jpegSplitter) next() []byte {
+	for {
+		if s.pos == 0 {
+			i := bytes.Index(s.buf, jpegSOI)
+			if i < 0 {
+				// A trailing 0xFF may be the first half of a start-of-image.
+				keep := 0
+				if len(s.buf) > 0 && s.buf[len(s.buf)-1] == 0xFF {
+					keep = 1
+				}
+				s.buf = append(s.buf[:0], s.buf[len(s.buf)-keep:]...)
+				return nil
+			}
+			s.buf = s.buf[i:]
+			s.pos, s.scan = len(jpegSOI), false
+		}
+
+		end, ok := s.walk()
+		switch {
+		case end > 0:
+			frame := slices.Clone(s.buf[:end])
+			s.buf = s.buf[end:]
+			s.pos = 0
+			return frame
+		case !ok || len(s.buf) > maxJPEGFrame:
+			s.buf = s.buf[len(jpegSOI):]
+			s.pos = 0
+		default:
+			return nil
+		}
+	}
+}
+
+// walk follows the frame at buf[0] from pos. It returns the frame's length
+// once its end-of-image is reached, 0 and true while more data is needed, and
+// false if the data is not a JPEG.
+func (s *jpegSplitter) walk() (int, bool) {
+	b := s.buf
+	for {
+		if s.scan {
+			// Entropy-coded data runs to the first marker that is neither
+			// a stuffed 0xFF (FF 00) nor a restart (FF D0-D7).
+			for {
+				if s.pos >= len(b) {
+					return 0, true
+				}
+				i := bytes.IndexByte(b[s.pos:], 0xFF)
+				if i < 0 {
+					s.pos = len(b)
+					return 0, true
+				}
+				s.pos += i
+				if s.pos+1 >= len(b) {
+					return 0, true
+				}
+				if next := b[s.pos+1]; next != 0x00 && next != 0xFF && (next < 0xD0 || next > 0xD7) {
+					break
+				}
+				s.pos++
+			}
+			s.scan = false
+		}
+
+		if s.pos+1 >= len(b) {
+			return 0, true
+		}
+		if b[s.pos] != 0xFF {
+			return 0, false
+		}
+		switch marker := b[s.pos+1]; {
+		case marker == 0xFF:
+			// Fill byte before a marker.
+			s.pos++
+			continue
+		case marker == 0xD9:
+			return s.pos + 2, true
+		case marker == 0x01 || marker >= 0xD0 && marker <= 0xD7:
+			// Markers without a length.
+			s.pos += 2
+			continue
+		case marker == 0x00 || marker == 0xD8:
+			return 0, false
+		}
+
+		if s.pos+3 >= len(b) {
+			return 0, true
+		}
+		length := int(b[s.pos+2])<<8 | int(b[s.pos+3])
+		if length < 2 {
+			return 0, false
+		}
+		s.scan = b[s.pos+1] == 0xDA
+		s.pos += 2 + length
+	}
+}
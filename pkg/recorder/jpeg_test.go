@@ -0,0 +1,98 @@
+package recorder
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testJPEG builds a small JPEG whose APP1 segment carries a thumbnail with
+// its own end-of-image, and whose entropy-coded data holds a stuffed 0xFF
+// and a restart marker.
+func testJPEG(fill byte) []byte {
+	thumbnail := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	app1 := append([]byte{'E', 'x', 'i', 'f', 0, 0}, thumbnail...)
+
+	var b bytes.Buffer
+	b.Write([]byte{0xFF, 0xD8})
+	b.Write([]byte{0xFF, 0xE1, 0, byte(2 + len(app1))})
+	b.Write(app1)
+	b.Write([]byte{0xFF, 0xDB, 0, 4, fill, fill})
+	b.Write([]byte{0xFF, 0xDA, 0, 3, 1})
+	b.Write([]byte{fill, 0xFF, 0x00, fill, 0xFF, 0xD0, fill})
+	b.Write([]byte{0xFF, 0xD9})
+	return b.Bytes()
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// splitJPEGs feeds data to a splitter chunk bytes at a time and returns the
+// frames it emits.
+func splitJPEGs(data []byte, chunk int) [][]byte {
+	var s jpegSplitter
+	var frames [][]byte
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		s.write(data[:n])
+		data = data[n:]
+		for frame := s.next(); frame != nil; frame = s.next() {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+func TestJPEGSplitter(t *testing.T) {
+	a, b := testJPEG(0x11), testJPEG(0x22)
+	tests := []struct {
+		name string
+		data []byte
+		want [][]byte
+	}{
+		{"one frame", a, [][]byte{a}},
+		{"two frames", join(a, b), [][]byte{a, b}},
+		{"garbage between frames", join([]byte{0, 0xFF, 0x12}, a, []byte("junk\xFF"), b), [][]byte{a, b}},
+		{"truncated frame", join(a[:12], b), [][]byte{b}},
+		{"truncated at the end", join(a, b[:len(b)-1]), [][]byte{a}},
+		{"not a jpeg", join([]byte{0xFF, 0xD8, 0x12, 0x34}, a), [][]byte{a}},
+	}
+	for _, tt := range tests {
+		for _, chunk := range []int{1, 3, len(tt.data)} {
+			got := splitJPEGs(tt.data, chunk)
+			if len(got) != len(tt.want) {
+				t.Errorf("%s, chunks of %d: got %d frames, want %d", tt.name, chunk, len(got), len(tt.want))
+				continue
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Errorf("%s, chunks of %d: frame %d = % x, want % x", tt.name, chunk, i, got[i], tt.want[i])
+				}
+			}
+		}
+	}
+}
+
+func FuzzJPEGSplitter(f *testing.F) {
+	a, b := testJPEG(0x11), testJPEG(0x22)
+	f.Add(a, 1)
+	f.Add(join(a, b), 7)
+	f.Add(join([]byte("garbage"), a, []byte{0xFF, 0xFF, 0x00}, b), 5)
+	f.Add(join(a[:len(a)-3], b), 2)
+	f.Add(join(a[:9], a[:20], b), 64)
+	f.Add([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x00, 0xFF, 0xD9}, 1)
+
+	f.Fuzz(func(t *testing.T, data []byte, chunk int) {
+		if chunk < 1 {
+			chunk = 1
+		}
+		for _, frame := range splitJPEGs(data, chunk) {
+			if !bytes.HasPrefix(frame, jpegSOI) || !bytes.HasSuffix(frame, []byte{0xFF, 0xD9}) {
+				t.Fatalf("frame % x is not SOI...EOI", frame)
+			}
+			if !bytes.Contains(data, frame) {
+				t.Fatalf("frame % x is not part of the input", frame)
+			}
+		}
+	})
+}
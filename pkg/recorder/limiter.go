@@ -0,0 +1,69 @@
+package recorder
+
+import "context"
+
+const (
+	OverflowCopy  = "copy"
+	OverflowQueue = "queue"
+)
+
+type Limiter struct {
+	slots chan struct{}
+}
+
+func NewLimiter(max int) *Limiter {
+	if max <= 0 {
+		return nil
+	}
+	return &Limiter{slots: make(chan struct{}, max)}
+}
+
+func (l *Limiter) TryAcquire() bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *Limiter) Acquire(ctx context.Context, stopCh <-chan struct{}) bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-stopCh:
+		return false
+	}
+}
+
+func (l *Limiter) Release() {
+	if l == nil {
+		return
+	}
+	select {
+	case <-l.slots:
+	default:
+	}
+}
+
+func (l *Limiter) InUse() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
+
+func (l *Limiter) Max() int {
+	if l == nil {
+		return 0
+	}
+	return cap(l.slots)
+}
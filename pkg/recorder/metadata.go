@@ -0,0 +1,64 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ClipMetadata is written into the container of a copy of a recording, for
+// software that reads clips by their metadata rather than by file name.
+type ClipMetadata struct {
+	// CreationTime becomes the movie header's creation time, which players
+	// and surveillance software take as the start of the clip.
+	CreationTime time.Time
+	// Title is usually the camera name, and Comment the site.
+	Title   string
+	Comment string
+	// Lat and Lon are written as an ISO 6709 location (the ©xyz atom in
+	// MP4) when Geo is set.
+	Lat, Lon float64
+	Geo      bool
+}
+
+// args returns the ffmpeg output options that write the metadata.
+func (m ClipMetadata) args() []string {
+	var args []string
+	add := func(key, value string) {
+		if value != "" {
+			args = append(args, "-metadata", key+"="+value)
+		}
+	}
+	if !m.CreationTime.IsZero() {
+		add("creation_time", m.CreationTime.UTC().Format("2006-01-02T15:04:05.000000Z"))
+	}
+	add("title", m.Title)
+	add("comment", m.Comment)
+	if m.Geo {
+		add("location", fmt.Sprintf("%+08.4f%+09.4f/", m.Lat, m.Lon))
+	}
+	return args
+}
+
+// WriteMetadata writes a copy of src with the metadata to dst. The streams
+// are copied, not re-encoded, so this takes about as long as copying the
+// file. The container follows dst's extension.
+func (m ClipMetadata) WriteMetadata(ctx context.Context, src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+
+	args := []string{"-i", src, "-map", "0", "-c", "copy", "-map_metadata", "0"}
+	args = append(args, m.args()...)
+	args = append(args, "-y", dst)
+
+	if output, err := ffmpegCommand(ctx, args...).CombinedOutput(); err != nil {
+		os.Remove(dst)
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package recorder
+
+// Origin identifies the recorder a segment came from, so footage gathered
+// from a fleet of recorders can be traced back to where it was recorded.
+type Origin struct {
+	Instance string `json:"instance,omitempty"`
+	Site     string `json:"site,omitempty"`
+}
+
+// metadataArgs tags an output with the origin. MP4 keeps tags it has no
+// atom for only with use_metadata_tags, which the caller adds to -movflags.
+func (o Origin) metadataArgs() []string {
+	var args []string
+	if o.Instance != "" {
+		args = append(args, "-metadata", "instance_id="+o.Instance)
+	}
+	if o.Site != "" {
+		args = append(args, "-metadata", "site="+o.Site)
+	}
+	return args
+}
+
+// movflags returns the -movflags of a segment with the origin.
+func (o Origin) movflags() string {
+	if o == (Origin{}) {
+		return "+faststart"
+	}
+	return "+faststart+use_metadata_tags"
+}
+
+// SetOrigin tags every recorder's segments with origin from its next
+// segment on.
+func (rm *RecorderManager) SetOrigin(origin Origin) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.origin = origin
+	for _, rec := range rm.recorders {
+		rec.mu.Lock()
+		rec.origin = origin
+		rec.mu.Unlock()
+	}
+}
@@ -0,0 +1,199 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// Codecs every browser plays in MP4.
+var (
+	browserVideoCodecs = []string{"h264"}
+	browserAudioCodecs = []string{"aac", "mp3"}
+)
+
+// PlaybackJob converts one segment. Its copy can be read while it is being
+// written.
+type PlaybackJob struct {
+	path string
+	out  string
+	done chan struct{}
+	err  error
+}
+
+func (j *PlaybackJob) Done() <-chan struct{} {
+	return j.done
+}
+
+// Err returns why the conversion failed, once Done is closed.
+func (j *PlaybackJob) Err() error {
+	return j.err
+}
+
+// Open opens the copy being written, or the finished copy once the job is
+// done.
+func (j *PlaybackJob) Open() (*os.File, error) {
+	f, err := os.Open(j.path)
+	if err == nil {
+		return f, nil
+	}
+	select {
+	case <-j.done:
+		if j.err != nil {
+			return nil, j.err
+		}
+		return os.Open(j.out)
+	default:
+		return nil, err
+	}
+}
+
+// PlaybackConverter makes segments browsers cannot play, such as HEVC video
+// or MKV files, playable by remuxing them, or transcoding what has to be, to
+// fragmented MP4. Copies are kept under storage.PlaybackDir for later plays.
+type PlaybackConverter struct {
+	opts    *storage.Options
+	limiter *Limiter
+	ctx     context.Context
+	jobs    map[string]*PlaybackJob
+	mu      sync.Mutex
+}
+
+func NewPlaybackConverter(opts *storage.Options) *PlaybackConverter {
+	return &PlaybackConverter{
+		opts: opts,
+		ctx:  context.Background(),
+		jobs: make(map[string]*PlaybackJob),
+	}
+}
+
+func (p *PlaybackConverter) SetLimiter(limiter *Limiter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limiter = limiter
+}
+
+// Start sets the context conversions run under, so they outlive the request
+// that started them and stop on shutdown.
+func (p *PlaybackConverter) Start(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ctx = ctx
+}
+
+// Playable returns a file browsers can play for the segment: the segment
+// itself, or its converted copy. While the copy is still being made it
+// returns the job making it instead. Concurrent callers share one job.
+func (p *PlaybackConverter) Playable(ctx context.Context, segmentPath string) (string, *PlaybackJob, error) {
+	out, err := storage.PlaybackPath(p.opts.OutputDir, segmentPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if fresh(out, segmentPath) {
+		return out, nil, nil
+	}
+
+	p.mu.Lock()
+	job, running := p.jobs[out]
+	p.mu.Unlock()
+	if running {
+		return "", job, nil
+	}
+
+	probe, err := Probe(ctx, segmentPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if browserPlayable(probe) {
+		return segmentPath, nil, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if job, running := p.jobs[out]; running {
+		return "", job, nil
+	}
+	job = &PlaybackJob{
+		path: strings.TrimSuffix(out, ".mp4") + ".part.mp4",
+		out:  out,
+		done: make(chan struct{}),
+	}
+	p.jobs[out] = job
+	go p.convert(p.ctx, p.limiter, job, probe, segmentPath, out)
+	return "", job, nil
+}
+
+// fresh reports whether the copy at out exists and was made after the
+// segment last changed, as it does when the cold tier re-encodes it.
+func fresh(out, segmentPath string) bool {
+	copied, err := os.Stat(out)
+	if err != nil {
+		return false
+	}
+	segment, err := os.Stat(segmentPath)
+	return err == nil && !copied.ModTime().Before(segment.ModTime())
+}
+
+func browserPlayable(probe FileProbe) bool {
+	return strings.Contains(probe.Format, "mp4") &&
+		slices.Contains(browserVideoCodecs, probe.VideoCodec) &&
+		(probe.AudioCodec == "" || slices.Contains(browserAudioCodecs, probe.AudioCodec))
+}
+
+func (p *PlaybackConverter) convert(ctx context.Context, limiter *Limiter, job *PlaybackJob, probe FileProbe, segmentPath, out string) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.jobs, out)
+		p.mu.Unlock()
+		close(job.done)
+	}()
+
+	args := []string{"-v", "error", "-i", segmentPath, "-map", "0:v:0", "-map", "0:a:0?"}
+	if slices.Contains(browserVideoCodecs, probe.VideoCodec) {
+		args = append(args, "-c:v", "copy")
+	} else {
+		if !limiter.Acquire(ctx, nil) {
+			job.err = ctx.Err()
+			return
+		}
+		defer limiter.Release()
+		args = append(args,
+			"-c:v", "libx264",
+			"-preset", "veryfast",
+			"-crf", "23",
+			"-pix_fmt", "yuv420p",
+		)
+	}
+	if probe.AudioCodec == "" || slices.Contains(browserAudioCodecs, probe.AudioCodec) {
+		args = append(args, "-c:a", "copy")
+	} else {
+		args = append(args, "-c:a", "aac")
+	}
+	// Fragments let the copy play while it is still being written.
+	args = append(args,
+		"-movflags", "+frag_keyframe+empty_moov+default_base_moof",
+		"-f", "mp4",
+		"-y", job.path,
+	)
+
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		job.err = fmt.Errorf("failed to create playback directory: %w", err)
+		return
+	}
+	if output, err := ffmpegCommand(ctx, args...).CombinedOutput(); err != nil {
+		os.Remove(job.path)
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		job.err = fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+		return
+	}
+	if err := os.Rename(job.path, out); err != nil {
+		os.Remove(job.path)
+		job.err = fmt.Errorf("failed to finalize playback copy: %w", err)
+	}
+}
@@ -0,0 +1,76 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// PowerCycleFunc switches a camera off and on again.
+type PowerCycleFunc func(ctx context.Context) error
+
+// SetPowerCycle sets how the camera is power-cycled, and after how long of
+// failing; zero recoverAfter never does it on its own.
+func (r *Recorder) SetPowerCycle(cycle PowerCycleFunc, recoverAfter time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.powerCycle = cycle
+	r.recoverAfter = recoverAfter
+}
+
+// PowerCycle switches the camera off and on and retries it right away.
+func (r *Recorder) PowerCycle(ctx context.Context) error {
+	r.mu.Lock()
+	cycle := r.powerCycle
+	r.mu.Unlock()
+	if cycle == nil {
+		return fmt.Errorf("camera %s has no power control", r.cameraName)
+	}
+	if err := cycle(ctx); err != nil {
+		return err
+	}
+	r.signalWake()
+	return nil
+}
+
+// PowerCycleCamera power-cycles the named camera. It does not hold the
+// manager lock while the camera is off.
+func (rm *RecorderManager) PowerCycleCamera(ctx context.Context, name string) error {
+	rm.mu.RLock()
+	rec, exists := rm.recorders[name]
+	rm.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("camera %s not found", name)
+	}
+	return rec.PowerCycle(ctx)
+}
+
+// recoverPower power-cycles a camera that has been failing for recoverAfter
+// since it started failing or was last power-cycled, for cameras that hang
+// until they are rebooted. The next retry waits until it is back on.
+func (r *Recorder) recoverPower(ctx context.Context) {
+	r.mu.Lock()
+	cycle, status := r.powerCycle, r.retryStatus
+	if cycle == nil || r.recoverAfter <= 0 || status == nil {
+		r.mu.Unlock()
+		return
+	}
+	since := status.FailingSince
+	if !status.PowerCycledAt.IsZero() {
+		since = status.PowerCycledAt
+	}
+	if time.Since(since) < r.recoverAfter {
+		r.mu.Unlock()
+		return
+	}
+	status.PowerCycles++
+	status.PowerCycledAt = time.Now()
+	failingSince := status.FailingSince
+	r.mu.Unlock()
+
+	log.Printf("[%s] Failing since %s, power-cycling the camera", r.cameraName, failingSince.Format(time.RFC3339))
+	if err := cycle(ctx); err != nil {
+		log.Printf("Warning: [%s] Failed to power-cycle the camera: %v", r.cameraName, err)
+	}
+}
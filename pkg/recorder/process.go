@@ -0,0 +1,21 @@
+package recorder
+
+import (
+	"context"
+	"os/exec"
+
+	"github.com/lets-vibe/cam-recorder/pkg/command"
+)
+
+func ffmpegCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := command.Context(ctx, "ffmpeg", args...)
+	cmd.Cancel = interruptFunc(cmd)
+	cmd.WaitDelay = stopGracePeriod
+	return cmd
+}
+
+func interrupt(cmd *exec.Cmd) {
+	if cmd != nil && cmd.Process != nil {
+		cmd.Cancel()
+	}
+}
@@ -0,0 +1,1917 @@
+// Package recorder runs ffmpeg to record cameras into segment files, and
+// serves live MJPEG and HLS previews. Create a RecorderManager with the
+// storage.Options to record with and add cameras to it; it needs ffmpeg on
+// the PATH.
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/schedule"
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	healthyAfter    = 10 * time.Second
+	stopGracePeriod = 10 * time.Second
+)
+
+type StatusHook func(camera string, prevState, state State, err error)
+
+type SegmentHook func(seg RecordingSegment)
+
+type Recorder struct {
+	opts        *storage.Options
+	rtspURL     string
+	failoverURL string
+	cameraName  string
+	outputDir   string
+	cmd         *exec.Cmd
+	stopCh      chan struct{}
+	runDone     chan struct{}
+	lifecycle   sync.Mutex
+	limiter     *Limiter
+	overflow    string
+	transcoding bool
+	limits      ResourceLimits
+	usage       ProcessUsage
+	retry       RetryPolicy
+	retryStatus *RetryStatus
+	adaptive    AdaptiveSegments
+	origin      Origin
+	retranscode *RetranscodeQueue
+	events      []time.Time
+	changed     chan<- struct{}
+	standby     *atomic.Bool
+	mu          sync.Mutex
+	lastError   error
+	startTime   time.Time
+	lastSegment time.Time
+	statusHook  StatusHook
+	segmentHook SegmentHook
+	spool       *Spool
+	buffer      *Spool
+	state       State
+	stateErr    string
+	stateSince  time.Time
+	transitions []Transition
+	schedule    *schedule.Schedule
+	eventsOnly  bool
+	paused      bool
+	triggered   time.Time
+	wake        chan struct{}
+	owner       *Recorder
+	sharers     []*Recorder
+
+	resourceRestarts int
+
+	failoverHook FailoverHook
+	failover     *FailoverStatus
+	mainFailures int
+	failedBack   bool
+	mainUp       bool
+	checkingMain bool
+
+	powerCycle   PowerCycleFunc
+	recoverAfter time.Duration
+}
+
+type RecordingSegment struct {
+	Filename   string    `json:"filename"`
+	CameraName string    `json:"camera_name"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	CreatedAt  time.Time `json:"created_at"`
+	Duration   string    `json:"duration"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	EndedAt    time.Time `json:"ended_at,omitzero"`
+	// Stats is nil for segments not recorded by this run, e.g. recovered ones.
+	Stats *StreamStats `json:"stats,omitempty"`
+	// Command is nil for segments not recorded by this run too.
+	Command *FFmpegRun `json:"command,omitempty"`
+	// Origin is the recorder the segment was tagged with, empty for
+	// segments not recorded by this run.
+	Origin Origin `json:"origin,omitzero"`
+}
+
+// FFmpegRun is the ffmpeg command line a segment was recorded with, with
+// credentials redacted, and how ffmpeg exited.
+type FFmpegRun struct {
+	Args []string `json:"args"`
+	// ExitCode is -1 when ffmpeg was killed by a signal.
+	ExitCode int    `json:"exit_code"`
+	Status   string `json:"status"`
+}
+
+func newFFmpegRun(cmd *exec.Cmd, args []string) *FFmpegRun {
+	run := &FFmpegRun{Args: make([]string, len(args)), ExitCode: -1}
+	for i, arg := range args {
+		run.Args[i] = source.Redact(arg)
+	}
+	if state := cmd.ProcessState; state != nil {
+		run.ExitCode = state.ExitCode()
+		run.Status = state.String()
+	}
+	return run
+}
+
+func New(rtspURL, cameraName string, opts *storage.Options) *Recorder {
+	outputDir := filepath.Join(opts.OutputDir, storage.CameraDirName(cameraName))
+
+	return &Recorder{
+		opts:        opts,
+		rtspURL:     rtspURL,
+		cameraName:  cameraName,
+		outputDir:   outputDir,
+		wake:        make(chan struct{}, 1),
+		retry:       DefaultRetryPolicy,
+		state:       StateStopped,
+		transcoding: true,
+		stateSince:  time.Now(),
+	}
+}
+
+func (r *Recorder) Start(ctx context.Context) error {
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+
+	r.mu.Lock()
+
+	if r.state != StateStopped {
+		r.mu.Unlock()
+		return fmt.Errorf("recorder already running")
+	}
+
+	if err := os.MkdirAll(r.outputDir, 0755); err != nil {
+		r.mu.Unlock()
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	stopCh := make(chan struct{})
+	runDone := make(chan struct{})
+	r.stopCh = stopCh
+	r.runDone = runDone
+	r.paused = false
+	r.retryStatus = nil
+	r.startTime = time.Now()
+	hook, prev, _ := r.transition(StateConnecting, nil)
+	go func() {
+		defer close(runDone)
+		r.runRecorder(ctx, stopCh)
+		r.runExited(stopCh)
+	}()
+	r.mu.Unlock()
+
+	if hook != nil {
+		hook(r.cameraName, prev, StateConnecting, nil)
+	}
+
+	return nil
+}
+
+func (r *Recorder) runRecorder(ctx context.Context, stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-stopCh:
+			return
+		default:
+		}
+
+		if r.inStandby() {
+			r.setState(StateStandby, nil)
+			select {
+			case <-ctx.Done():
+				return
+			case <-stopCh:
+				return
+			case <-r.wake:
+			}
+			continue
+		}
+
+		if r.ingestOwner() != nil {
+			r.followOwner()
+			select {
+			case <-ctx.Done():
+				return
+			case <-stopCh:
+				return
+			case <-r.wake:
+			case <-time.After(followInterval):
+			}
+			continue
+		}
+
+		if idle := r.idleFor(time.Now()); idle > 0 {
+			if r.IsPaused() {
+				r.setState(StatePaused, nil)
+			} else {
+				r.setState(StateIdle, nil)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-stopCh:
+				return
+			case <-r.wake:
+			case <-time.After(idle):
+			}
+			continue
+		}
+
+		if status := r.RetryStatus(); status != nil && status.CircuitOpen {
+			// Wait for the next probe instead of running ffmpeg.
+			select {
+			case <-ctx.Done():
+				return
+			case <-stopCh:
+				return
+			case <-r.wake:
+			case <-time.After(time.Until(status.NextRetryAt)):
+			}
+			if !r.probe(ctx) {
+				r.recoverPower(ctx)
+				continue
+			}
+		}
+
+		r.checkFailback(ctx)
+		_, isPermanent, err := r.recordSegment(ctx, stopCh)
+		if err == nil {
+			r.recorded()
+			r.mu.Lock()
+			r.retryStatus = nil
+			r.mu.Unlock()
+			continue
+		}
+
+		r.mu.Lock()
+		r.lastError = err
+		r.mu.Unlock()
+		if r.switchOnFailure(err) {
+			continue
+		}
+		retryDelay, circuitOpen := r.failed(isPermanent)
+		if circuitOpen {
+			r.setState(StateCircuitOpen, err)
+			log.Printf("[%s] Recording failed: %v. Failing since %s, so no more retries until the camera accepts a connection (checked every %v)",
+				r.cameraName, err, r.RetryStatus().FailingSince.Format(time.RFC3339), retryDelay)
+		} else {
+			errType := "transient"
+			if isPermanent {
+				errType = "permanent"
+				r.setState(StateFailed, err)
+			} else {
+				r.setState(StateRetrying, err)
+			}
+			log.Printf("[%s] Recording failed (%s): %v. Retrying in %v...",
+				r.cameraName, errType, err, retryDelay.Round(time.Second))
+		}
+		r.recoverPower(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-stopCh:
+			return
+		case <-r.wake:
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// failed counts a failed attempt and returns how long to wait before the
+// next, and whether the circuit is now open. The count starts over once the
+// recorder gets back to recording.
+func (r *Recorder) failed(permanent bool) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.retryStatus == nil {
+		r.retryStatus = &RetryStatus{FailingSince: now}
+	}
+	status := r.retryStatus
+	status.Attempts++
+
+	policy := r.retry
+	if policy.MaxRetryWindow > 0 && now.Sub(status.FailingSince) >= policy.MaxRetryWindow {
+		status.CircuitOpen = true
+		status.NextRetryAt = now.Add(policy.ProbeInterval)
+		return policy.ProbeInterval, true
+	}
+
+	delay := policy.delay(status.Attempts, permanent)
+	status.NextRetryAt = now.Add(delay)
+	return delay, false
+}
+
+// probe checks whether a camera behind an open circuit answers again. If it
+// does, the circuit closes for one attempt; if that fails too, it opens
+// again at once.
+func (r *Recorder) probe(ctx context.Context) bool {
+	err := probeCamera(ctx, r.inputURL())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.retryStatus == nil {
+		return true
+	}
+	r.retryStatus.LastProbeAt = time.Now()
+	if err != nil {
+		r.retryStatus.LastProbeError = err.Error()
+		r.retryStatus.NextRetryAt = time.Now().Add(r.retry.ProbeInterval)
+		return false
+	}
+	r.retryStatus.LastProbeError = ""
+	r.retryStatus.CircuitOpen = false
+	log.Printf("[%s] Camera accepts connections again, reconnecting", r.cameraName)
+	return true
+}
+
+// RetryStatus returns a copy of the retry state, or nil while the recorder
+// is not failing.
+func (r *Recorder) RetryStatus() *RetryStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.retryStatus == nil {
+		return nil
+	}
+	status := *r.retryStatus
+	return &status
+}
+
+func (r *Recorder) recordSegment(ctx context.Context, stopCh <-chan struct{}) (time.Duration, bool, error) {
+	startedAt := time.Now()
+	outputDir := r.outputDir
+	r.mu.Lock()
+	spool, buffer, origin := r.spool, r.buffer, r.origin
+	r.mu.Unlock()
+	if spool.Active() {
+		if err := os.MkdirAll(spool.cameraDir(r.cameraName), 0755); err != nil {
+			log.Printf("Warning: [%s] Failed to create spool directory: %v", r.cameraName, err)
+		} else {
+			outputDir = spool.cameraDir(r.cameraName)
+		}
+	} else if buffer.accepting() {
+		if err := os.MkdirAll(buffer.cameraDir(r.cameraName), 0755); err != nil {
+			log.Printf("Warning: [%s] Failed to create RAM buffer directory: %v", r.cameraName, err)
+		} else {
+			outputDir = buffer.cameraDir(r.cameraName)
+		}
+	}
+
+	transcode, release, acquired := r.acquireTranscode(ctx, stopCh)
+	if !acquired {
+		return 0, false, nil
+	}
+	defer release()
+
+	filename, err := storage.ClaimName(outputDir, r.segmentFilename(startedAt))
+	if err != nil {
+		return time.Second * 5, false, err
+	}
+	if want := r.segmentFilename(startedAt); filename != want {
+		log.Printf("[%s] %s already exists, recording to %s", r.cameraName, want, filename)
+	}
+	outputPath := filepath.Join(outputDir, filename)
+
+	segmentDuration := int(r.segmentLength(startedAt).Seconds())
+
+	videoArgs := []string{"-c:v", "libx264", "-preset", "veryfast", "-crf", "23"}
+	if !transcode {
+		videoArgs = []string{"-c:v", "copy"}
+	}
+
+	src, err := source.Parse(r.inputURL())
+	if err != nil {
+		os.Remove(outputPath)
+		retryDelay, _ := classifyFFmpegError(err)
+		return retryDelay, true, err
+	}
+
+	// In dual mode a stream copy is recorded first, as a second output, so
+	// the segment can be re-encoded from it if the transcode fails.
+	var rawPath string
+	if transcode && outputDir == r.outputDir && r.retranscode.Enabled() {
+		rawPath, err = storage.RawPath(r.opts.OutputDir, outputPath)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(rawPath), 0755)
+		}
+		if err != nil {
+			log.Printf("Warning: [%s] Recording without a stream copy: %v", r.cameraName, err)
+			rawPath = ""
+		}
+	}
+
+	args := src.InputArgs()
+	args = append(args, src.NetworkArgs()...)
+	if rawPath != "" {
+		args = append(args,
+			"-map", "0:v",
+			"-map", "0:a?",
+			"-c", "copy",
+			"-t", fmt.Sprintf("%d", segmentDuration),
+			"-metadata", "creation_time="+startedAt.UTC().Format(time.RFC3339Nano),
+		)
+		args = append(args, origin.metadataArgs()...)
+		args = append(args, "-f", "matroska", "-y", rawPath)
+	}
+	args = append(args, "-fflags", "+genpts")
+	args = append(args, videoArgs...)
+	args = append(args,
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-t", fmt.Sprintf("%d", segmentDuration),
+		"-metadata", "creation_time="+startedAt.UTC().Format(time.RFC3339Nano),
+	)
+	args = append(args, origin.metadataArgs()...)
+	args = append(args, "-movflags", origin.movflags(), "-y", outputPath)
+
+	journal, err := openJournal(r.opts.OutputDir, journalEntry{
+		Camera:    r.cameraName,
+		Filename:  filename,
+		Path:      outputPath,
+		StartedAt: startedAt,
+	})
+	if err != nil {
+		log.Printf("Warning: [%s] %v", r.cameraName, err)
+	}
+	// A segment held in the spool or buffer keeps its entry until it is
+	// moved, so it is recovered if the recorder dies before then.
+	defer func() {
+		if !spool.holds(outputPath) && !buffer.holds(outputPath) {
+			closeJournal(journal)
+		}
+	}()
+
+	stats := &statsWriter{}
+	cmd := ffmpegCommand(ctx, args...)
+	cmd.Stderr = stats
+	r.mu.Lock()
+	r.cmd = cmd
+	r.mu.Unlock()
+
+	if state := r.State(); state == StateIdle || state == StatePaused || state == StateStandby {
+		r.setState(StateConnecting, nil)
+	}
+
+	if err := cmd.Start(); err != nil {
+		os.Remove(outputPath)
+		if rawPath != "" {
+			os.Remove(rawPath)
+		}
+		retryDelay, isPermanent := classifyFFmpegError(err)
+		return retryDelay, isPermanent, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	healthy := time.NewTimer(healthyAfter)
+	defer healthy.Stop()
+
+	sampler := &procSampler{pid: cmd.Process.Pid}
+	sampleTicker := time.NewTicker(usageInterval)
+	defer sampleTicker.Stop()
+	r.mu.Lock()
+	limits := r.limits
+	r.usage = ProcessUsage{PID: cmd.Process.Pid, SampledAt: time.Now()}
+	r.mu.Unlock()
+	defer r.setUsage(ProcessUsage{})
+
+	var runErr, limitErr error
+	stopping := false
+	overLimit := 0
+	for waiting := true; waiting; {
+		select {
+		case runErr = <-done:
+			waiting = false
+		case <-healthy.C:
+			r.setState(StateRecording, nil)
+		case <-stopCh:
+			stopping = true
+			stopCh = nil
+			interrupt(cmd)
+		case <-sampleTicker.C:
+			usage, err := sampler.sample()
+			if err != nil {
+				continue
+			}
+			r.setUsage(usage)
+
+			reason := limits.exceeded(usage)
+			if reason == "" {
+				overLimit = 0
+				continue
+			}
+			if overLimit++; overLimit == overLimitSamples && limitErr == nil {
+				limitErr = fmt.Errorf("ffmpeg exceeded resource limit (%s), restarting", reason)
+				log.Printf("[%s] %v", r.cameraName, limitErr)
+				r.mu.Lock()
+				r.resourceRestarts++
+				r.mu.Unlock()
+				interrupt(cmd)
+			}
+		}
+	}
+
+	endedAt, run := time.Now(), newFFmpegRun(cmd, args)
+	interrupted := stopping || ctx.Err() != nil || r.IsPaused() || r.inStandby()
+	if rawPath == "" || !r.rescueSegment(ctx, rawPath, filename, outputPath, startedAt, endedAt, stats.Stats(), run, origin, limitErr != nil || (runErr != nil && !interrupted)) {
+		r.finishSegment(filename, outputPath, startedAt, endedAt, stats.Stats(), run, origin)
+	}
+
+	if limitErr != nil && !stopping && ctx.Err() == nil {
+		return limitRetryDelay, false, limitErr
+	}
+
+	if runErr != nil {
+		if interrupted {
+			return 0, false, nil
+		}
+		retryDelay, isPermanent := classifyFFmpegError(runErr)
+		return retryDelay, isPermanent, fmt.Errorf("ffmpeg error: %w", runErr)
+	}
+
+	r.setState(StateRecording, nil)
+	return 0, false, nil
+}
+
+func (r *Recorder) acquireTranscode(ctx context.Context, stopCh <-chan struct{}) (transcode bool, release func(), ok bool) {
+	r.mu.Lock()
+	limiter, overflow, wasTranscoding := r.limiter, r.overflow, r.transcoding
+	r.mu.Unlock()
+
+	transcode = limiter.TryAcquire()
+	if !transcode && overflow == OverflowQueue {
+		prev := r.State()
+		r.setState(StateQueued, nil)
+		if !limiter.Acquire(ctx, stopCh) {
+			return false, nil, false
+		}
+		r.setState(prev, nil)
+		transcode = true
+	}
+
+	release = func() {}
+	if transcode {
+		release = limiter.Release
+	}
+
+	if transcode != wasTranscoding {
+		r.mu.Lock()
+		r.transcoding = transcode
+		r.mu.Unlock()
+		if !transcode {
+			log.Printf("[%s] Transcode limit reached, recording with stream copy", r.cameraName)
+		}
+	}
+
+	return transcode, release, true
+}
+
+func (r *Recorder) IsTranscoding() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.transcoding
+}
+
+func (r *Recorder) SetSchedule(sched *schedule.Schedule, eventsOnly bool) {
+	r.mu.Lock()
+	r.schedule = sched
+	r.eventsOnly = eventsOnly
+	r.mu.Unlock()
+
+	r.signalWake()
+}
+
+func (r *Recorder) Schedule() *schedule.Schedule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.schedule
+}
+
+func (r *Recorder) Trigger(until time.Time) {
+	if owner := r.ingestOwner(); owner != nil {
+		owner.Trigger(until)
+	}
+
+	r.mu.Lock()
+	if until.After(r.triggered) {
+		r.triggered = until
+	}
+	r.noteEvent(time.Now())
+	r.mu.Unlock()
+
+	r.signalWake()
+}
+
+func (r *Recorder) signalWake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Recorder) Pause() error {
+	r.mu.Lock()
+	if r.state == StateStopped {
+		r.mu.Unlock()
+		return fmt.Errorf("recorder not running")
+	}
+	r.paused = true
+	cmd := r.cmd
+	r.mu.Unlock()
+
+	interrupt(cmd)
+	r.signalWake()
+	return nil
+}
+
+func (r *Recorder) Resume() {
+	r.mu.Lock()
+	r.paused = false
+	r.mu.Unlock()
+
+	r.signalWake()
+}
+
+func (r *Recorder) IsPaused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.paused
+}
+
+func (r *Recorder) recordUntil(now time.Time) (time.Time, bool) {
+	r.mu.Lock()
+	sched, eventsOnly, triggered, paused := r.schedule, r.eventsOnly, r.triggered, r.paused
+	r.mu.Unlock()
+
+	if paused {
+		return time.Time{}, false
+	}
+
+	var until time.Time
+	active := false
+	if !eventsOnly {
+		until, active = sched.ActiveUntil(now)
+		if active && until.IsZero() {
+			return until, true
+		}
+	}
+
+	if now.Before(triggered) {
+		active = true
+		if triggered.After(until) {
+			until = triggered
+		}
+	}
+
+	return until, active
+}
+
+func (r *Recorder) idleFor(now time.Time) time.Duration {
+	if _, active := r.recordUntil(now); active {
+		return 0
+	}
+
+	idle := time.Minute
+	r.mu.Lock()
+	sched, eventsOnly := r.schedule, r.eventsOnly
+	r.mu.Unlock()
+	if !eventsOnly {
+		if next, ok := sched.NextStart(now); ok && next.Sub(now) < idle {
+			idle = next.Sub(now)
+		}
+	}
+	return max(idle, time.Second)
+}
+
+func (r *Recorder) segmentLength(startedAt time.Time) time.Duration {
+	length := r.adaptiveLength(startedAt)
+	if r.opts.AlignToClock && length > 0 {
+		length = untilBoundary(startedAt, length)
+	}
+
+	until, active := r.recordUntil(startedAt)
+	if active && !until.IsZero() && until.Sub(startedAt) < length {
+		length = until.Sub(startedAt).Round(time.Second)
+	}
+	return max(length, time.Second)
+}
+
+// Remainders shorter than this before a clock boundary are added to the
+// next segment rather than recorded on their own.
+const minAlignedSegment = 10 * time.Second
+
+// untilBoundary returns the time from t to the next multiple of d counted
+// from local midnight, rounded up to whole seconds.
+func untilBoundary(t time.Time, d time.Duration) time.Duration {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	elapsed := t.Sub(midnight)
+	left := (elapsed/d+1)*d - elapsed
+	if left < minAlignedSegment {
+		left += d
+	}
+	return (left + time.Second - 1).Truncate(time.Second)
+}
+
+func (r *Recorder) finishSegment(filename, outputPath string, startedAt, endedAt time.Time, stats StreamStats, run *FFmpegRun, origin Origin) {
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		return
+	}
+	if info.Size() == 0 {
+		os.Remove(outputPath)
+		return
+	}
+
+	seg := RecordingSegment{
+		Filename:   filename,
+		CameraName: r.cameraName,
+		Path:       outputPath,
+		Size:       info.Size(),
+		CreatedAt:  info.ModTime(),
+		Duration:   endedAt.Sub(startedAt).String(),
+		StartedAt:  startedAt,
+		EndedAt:    endedAt,
+		Stats:      &stats,
+		Command:    run,
+		Origin:     origin,
+	}
+	r.deliver(seg)
+	r.shareSegment(seg)
+}
+
+// rescueSegment queues the stream copy of a segment for re-encoding when
+// its transcode is missing, empty or, when ffmpeg failed, unreadable, and
+// reports whether it did. Otherwise the copy is no longer needed.
+func (r *Recorder) rescueSegment(ctx context.Context, rawPath, filename, outputPath string, startedAt, endedAt time.Time, stats StreamStats, run *FFmpegRun, origin Origin, failed bool) bool {
+	broken := true
+	if info, err := os.Stat(outputPath); err == nil && info.Size() > 0 {
+		broken = failed && ctx.Err() == nil
+		if broken {
+			_, err := Probe(ctx, outputPath)
+			broken = err != nil
+		}
+	}
+	if info, err := os.Stat(rawPath); !broken || err != nil || info.Size() == 0 {
+		os.Remove(rawPath)
+		return false
+	}
+
+	seg := RecordingSegment{
+		Filename:   filename,
+		CameraName: r.cameraName,
+		Path:       outputPath,
+		Duration:   endedAt.Sub(startedAt).String(),
+		StartedAt:  startedAt,
+		EndedAt:    endedAt,
+		Stats:      &stats,
+		Command:    run,
+		Origin:     origin,
+	}
+	if err := r.retranscode.queue(rawPath, seg); err != nil {
+		log.Printf("Warning: [%s] %v", r.cameraName, err)
+		os.Remove(rawPath)
+		return false
+	}
+	os.Remove(outputPath)
+	log.Printf("[%s] Transcode of %s failed, re-encoding its stream copy in the background", r.cameraName, filename)
+
+	r.mu.Lock()
+	if endedAt.After(r.lastSegment) {
+		r.lastSegment = endedAt
+	}
+	r.mu.Unlock()
+	return true
+}
+
+func (r *Recorder) segmentFilename(startedAt time.Time) string {
+	return storage.SegmentFilename(r.cameraName, startedAt, r.opts.Format)
+}
+
+// deliver passes a finished segment to the segment hook, or holds it back
+// while it is in the spool or RAM buffer.
+func (r *Recorder) deliver(seg RecordingSegment) {
+	ended := seg.EndedAt
+	if ended.IsZero() {
+		ended = seg.CreatedAt
+	}
+	r.mu.Lock()
+	hook := r.segmentHook
+	spool, buffer := r.spool, r.buffer
+	if ended.After(r.lastSegment) {
+		r.lastSegment = ended
+	}
+	r.mu.Unlock()
+
+	if spool.owns(seg.Path) {
+		spool.hold(seg)
+		return
+	}
+	if buffer.owns(seg.Path) {
+		buffer.hold(seg)
+		return
+	}
+	if hook != nil {
+		hook(seg)
+	}
+}
+
+func classifyFFmpegError(err error) (retryDelay time.Duration, isPermanent bool) {
+	errStr := err.Error()
+
+	permanentErrors := []string{
+		"404",
+		"not found",
+		"invalid",
+		"unauthorized",
+		"authentication failed",
+		"forbidden",
+		"protocol not supported",
+		"no such file",
+		"incorrect password",
+		"credential",
+		"login",
+	}
+
+	errLower := strings.ToLower(errStr)
+	for _, p := range permanentErrors {
+		if strings.Contains(errLower, p) {
+			return time.Minute * 5, true
+		}
+	}
+
+	return time.Second * 5, false
+}
+
+func (r *Recorder) runExited(stopCh chan struct{}) {
+	r.mu.Lock()
+	if r.stopCh != stopCh || r.state == StateStopped {
+		r.mu.Unlock()
+		return
+	}
+	hook, prev, _ := r.transition(StateStopped, nil)
+	r.mu.Unlock()
+
+	if hook != nil {
+		hook(r.cameraName, prev, StateStopped, nil)
+	}
+}
+
+func (r *Recorder) Stop() {
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+
+	r.mu.Lock()
+	if r.state == StateStopped {
+		r.mu.Unlock()
+		return
+	}
+
+	close(r.stopCh)
+	runDone := r.runDone
+	hook, prev, _ := r.transition(StateStopped, nil)
+	r.mu.Unlock()
+
+	<-runDone
+
+	if hook != nil {
+		hook(r.cameraName, prev, StateStopped, nil)
+	}
+}
+
+func (r *Recorder) IsRunning() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state != StateStopped
+}
+
+func (r *Recorder) GetLastError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastError
+}
+
+func (r *Recorder) Uptime() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == StateStopped {
+		return 0
+	}
+	return time.Since(r.startTime)
+}
+
+// StartedAt returns when the recorder was started, or the zero time while it
+// is stopped.
+func (r *Recorder) StartedAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state == StateStopped {
+		return time.Time{}
+	}
+	return r.startTime
+}
+
+// LastSegmentAt returns when the newest segment the recorder finished ended,
+// or the zero time before its first.
+func (r *Recorder) LastSegmentAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastSegment
+}
+
+func (r *Recorder) CameraName() string {
+	return r.cameraName
+}
+
+func (r *Recorder) OutputDir() string {
+	return r.outputDir
+}
+
+func (r *Recorder) ListSegments() ([]RecordingSegment, error) {
+	var segments []RecordingSegment
+
+	entries, err := os.ReadDir(r.outputDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return segments, nil
+		}
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		if !strings.HasSuffix(name, "."+r.opts.Format) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, RecordingSegment{
+			Filename:   name,
+			CameraName: r.cameraName,
+			Path:       filepath.Join(r.outputDir, name),
+			Size:       info.Size(),
+			CreatedAt:  info.ModTime(),
+			Duration:   r.opts.SegmentDuration.String(),
+		})
+	}
+
+	return segments, nil
+}
+
+// CameraOptions describes a camera to a RecorderManager.
+type CameraOptions struct {
+	Name string
+	URL  string // RTSP URL, or another input ffmpeg understands
+	// FailoverURL is recorded from while URL fails, such as the camera's
+	// second network interface or a relay.
+	FailoverURL string
+	Enabled     bool // start recording as soon as the camera is added
+	// Schedule limits recording to these windows; empty records all day.
+	Schedule []schedule.Spec
+	// EventsOnly records only around triggered events.
+	EventsOnly bool
+	// PowerCycle switches the camera off and on. With RecoverAfter set, it
+	// is called when the camera has been failing that long.
+	PowerCycle   PowerCycleFunc
+	RecoverAfter time.Duration
+	// ShareWith names a camera with the same stream whose recordings are
+	// also filed under this camera, instead of opening a second connection.
+	// The camera's own schedule is then ignored.
+	ShareWith string
+}
+
+type RecorderManager struct {
+	opts         *storage.Options
+	recorders    map[string]*Recorder
+	statusHook   StatusHook
+	segmentHook  SegmentHook
+	failoverHook FailoverHook
+	limiter      *Limiter
+	overflow     string
+	limits       ResourceLimits
+	retry        RetryPolicy
+	adaptive     AdaptiveSegments
+	origin       Origin
+	scrub        *ScrubGenerator
+	retranscode  *RetranscodeQueue
+	playback     *PlaybackConverter
+	spool        *Spool
+	buffer       *Spool
+	mu           sync.RWMutex
+	status       atomic.Pointer[map[string]RecorderStatus]
+	changed      chan struct{}
+	standby      atomic.Bool
+}
+
+func NewRecorderManager(opts *storage.Options) *RecorderManager {
+	return &RecorderManager{
+		opts:        opts,
+		recorders:   make(map[string]*Recorder),
+		retry:       DefaultRetryPolicy,
+		scrub:       NewScrubGenerator(opts),
+		retranscode: NewRetranscodeQueue(opts),
+		playback:    NewPlaybackConverter(opts),
+		changed:     make(chan struct{}, 1),
+	}
+}
+
+func (rm *RecorderManager) AddCamera(ctx context.Context, cam CameraOptions) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if _, exists := rm.recorders[cam.Name]; exists {
+		return fmt.Errorf("camera %s already exists", cam.Name)
+	}
+
+	sched, err := schedule.Parse(cam.Schedule)
+	if err != nil {
+		return err
+	}
+
+	rec := New(cam.URL, cam.Name, rm.opts)
+	rec.failoverURL = cam.FailoverURL
+	rec.statusHook = rm.statusHook
+	rec.failoverHook = rm.failoverHook
+	rec.segmentHook = rm.segmentHook
+	rec.spool = rm.spool
+	rec.buffer = rm.buffer
+	rec.limiter = rm.limiter
+	rec.overflow = rm.overflow
+	rec.limits = rm.limits
+	rec.retry = rm.retry
+	rec.adaptive = rm.adaptive
+	rec.origin = rm.origin
+	rec.retranscode = rm.retranscode
+	rec.changed = rm.changed
+	rec.standby = &rm.standby
+	rec.schedule = sched
+	rec.eventsOnly = cam.EventsOnly
+	rec.powerCycle = cam.PowerCycle
+	rec.recoverAfter = cam.RecoverAfter
+	if cam.ShareWith != "" {
+		if owner, ok := rm.recorders[cam.ShareWith]; ok {
+			rec.shareIngest(owner)
+		} else {
+			log.Printf("Warning: [%s] Cannot share the stream of unknown camera %s, connecting separately", cam.Name, cam.ShareWith)
+		}
+	}
+	rm.recorders[cam.Name] = rec
+	rm.statusChanged()
+
+	if cam.Enabled {
+		if err := rec.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start recorder for %s: %w", cam.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (rm *RecorderManager) SetStatusHook(hook StatusHook) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.statusHook = hook
+	for _, rec := range rm.recorders {
+		rec.mu.Lock()
+		rec.statusHook = hook
+		rec.mu.Unlock()
+	}
+}
+
+func (rm *RecorderManager) SetFailoverHook(hook FailoverHook) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.failoverHook = hook
+	for _, rec := range rm.recorders {
+		rec.mu.Lock()
+		rec.failoverHook = hook
+		rec.mu.Unlock()
+	}
+}
+
+func (rm *RecorderManager) SetTranscodeLimit(limiter *Limiter, overflow string) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.limiter = limiter
+	rm.overflow = overflow
+	rm.scrub.SetLimiter(limiter)
+	rm.retranscode.SetLimiter(limiter)
+	rm.playback.SetLimiter(limiter)
+	for _, rec := range rm.recorders {
+		rec.mu.Lock()
+		rec.limiter = limiter
+		rec.overflow = overflow
+		rec.mu.Unlock()
+	}
+}
+
+func (rm *RecorderManager) SetResourceLimits(limits ResourceLimits) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.limits = limits
+	for _, rec := range rm.recorders {
+		rec.mu.Lock()
+		rec.limits = limits
+		rec.mu.Unlock()
+	}
+}
+
+// SetRetryPolicy applies policy to every recorder from its next failure on.
+func (rm *RecorderManager) SetRetryPolicy(policy RetryPolicy) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.retry = policy
+	for _, rec := range rm.recorders {
+		rec.mu.Lock()
+		rec.retry = policy
+		rec.mu.Unlock()
+	}
+}
+
+// SetAdaptiveSegments applies adaptive to every recorder from its next
+// segment on.
+func (rm *RecorderManager) SetAdaptiveSegments(adaptive AdaptiveSegments) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.adaptive = adaptive
+	for _, rec := range rm.recorders {
+		rec.mu.Lock()
+		rec.adaptive = adaptive
+		rec.mu.Unlock()
+	}
+}
+
+func (rm *RecorderManager) Limiter() *Limiter {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.limiter
+}
+
+func (rm *RecorderManager) Scrub() *ScrubGenerator {
+	return rm.scrub
+}
+
+// SetDualMode turns dual mode on or off for every recorder from its next
+// segment on.
+func (rm *RecorderManager) SetDualMode(mode DualMode) {
+	rm.retranscode.SetMode(mode)
+}
+
+func (rm *RecorderManager) Retranscode() *RetranscodeQueue {
+	return rm.retranscode
+}
+
+func (rm *RecorderManager) Playback() *PlaybackConverter {
+	return rm.playback
+}
+
+func (rm *RecorderManager) SetSpool(spool *Spool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.spool = spool
+	for _, rec := range rm.recorders {
+		rec.mu.Lock()
+		rec.spool = spool
+		rec.mu.Unlock()
+	}
+}
+
+// DrainSpool moves segments recorded into the spool back to the recordings
+// directory and indexes them.
+func (rm *RecorderManager) DrainSpool() (int, error) {
+	rm.mu.RLock()
+	spool, hook := rm.spool, rm.segmentHook
+	rm.mu.RUnlock()
+
+	if spool == nil {
+		return 0, nil
+	}
+	return spool.drain(rm.opts.OutputDir, hook)
+}
+
+func (rm *RecorderManager) SetSegmentHook(hook SegmentHook) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.segmentHook = hook
+	rm.retranscode.SetHook(hook)
+	for _, rec := range rm.recorders {
+		rec.mu.Lock()
+		rec.segmentHook = hook
+		rec.mu.Unlock()
+	}
+}
+
+func (rm *RecorderManager) ConfigureCamera(cam CameraOptions) error {
+	sched, err := schedule.Parse(cam.Schedule)
+	if err != nil {
+		return err
+	}
+
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	rec, exists := rm.recorders[cam.Name]
+	if !exists {
+		return fmt.Errorf("camera %s not found", cam.Name)
+	}
+
+	rec.SetSchedule(sched, cam.EventsOnly)
+	rec.SetPowerCycle(cam.PowerCycle, cam.RecoverAfter)
+	return nil
+}
+
+func (rm *RecorderManager) Trigger(name string, until time.Time) error {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	rec, exists := rm.recorders[name]
+	if !exists {
+		return fmt.Errorf("camera %s not found", name)
+	}
+
+	rec.Trigger(until)
+	return nil
+}
+
+// RemoveCamera stops the camera and forgets it. Like StopCamera, it waits for
+// ffmpeg to exit without holding the manager lock, so other calls go on.
+func (rm *RecorderManager) RemoveCamera(name string) {
+	rm.mu.Lock()
+	rec, exists := rm.recorders[name]
+	delete(rm.recorders, name)
+	rm.mu.Unlock()
+
+	if exists {
+		rec.Stop()
+		rec.unshareIngest()
+		rm.statusChanged()
+	}
+}
+
+func (rm *RecorderManager) StartCamera(ctx context.Context, name string) error {
+	rec, exists := rm.GetRecorder(name)
+	if !exists {
+		return fmt.Errorf("camera %s not found", name)
+	}
+
+	return rec.Start(ctx)
+}
+
+func (rm *RecorderManager) PauseCamera(name string) error {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	rec, exists := rm.recorders[name]
+	if !exists {
+		return fmt.Errorf("camera %s not found", name)
+	}
+
+	defer rm.statusChanged()
+	return rec.Pause()
+}
+
+func (rm *RecorderManager) ResumeCamera(name string) error {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	rec, exists := rm.recorders[name]
+	if !exists {
+		return fmt.Errorf("camera %s not found", name)
+	}
+
+	rec.Resume()
+	rm.statusChanged()
+	return nil
+}
+
+func (rm *RecorderManager) StopCamera(name string) {
+	if rec, exists := rm.GetRecorder(name); exists {
+		rec.Stop()
+	}
+}
+
+func (rm *RecorderManager) GetRecorder(name string) (*Recorder, bool) {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	rec, ok := rm.recorders[name]
+	return rec, ok
+}
+
+func (rm *RecorderManager) GetAllRecorders() map[string]*Recorder {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	result := make(map[string]*Recorder)
+	for k, v := range rm.recorders {
+		result[k] = v
+	}
+	return result
+}
+
+func (rm *RecorderManager) StopAll() {
+	for _, rec := range rm.GetAllRecorders() {
+		rec.Stop()
+	}
+}
+
+func (rm *RecorderManager) ListAllSegments() ([]RecordingSegment, error) {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	var allSegments []RecordingSegment
+
+	for _, rec := range rm.recorders {
+		segments, err := rec.ListSegments()
+		if err != nil {
+			continue
+		}
+		allSegments = append(allSegments, segments...)
+	}
+
+	sortSegmentsByDateDesc(allSegments)
+
+	return allSegments, nil
+}
+
+func (rm *RecorderManager) collectStatus() map[string]RecorderStatus {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	status := make(map[string]RecorderStatus)
+	for name, rec := range rm.recorders {
+		var lastErr string
+		if err := rec.GetLastError(); err != nil {
+			lastErr = err.Error()
+		}
+		var usage *ProcessUsage
+		if u, ok := rec.Usage(); ok {
+			usage = &u
+		}
+		var segmentDuration string
+		if rm.adaptive.Enabled {
+			segmentDuration = rec.adaptiveLength(time.Now()).String()
+		}
+		uptime := rec.Uptime()
+		status[name] = RecorderStatus{
+			Running:        rec.IsRunning(),
+			Paused:         rec.IsPaused(),
+			Transcoding:    rec.IsTranscoding(),
+			State:          rec.State(),
+			StateSince:     rec.StateSince(),
+			Uptime:         uptime.String(),
+			UptimeSeconds:  int64(uptime.Seconds()),
+			StartedAt:      rec.StartedAt(),
+			LastSegmentAt:  rec.LastSegmentAt(),
+			LastError:      lastErr,
+			OutputDir:      rec.OutputDir(),
+			Usage:          usage,
+			Restarts:       rec.ResourceRestarts(),
+			SharesStreamOf: rec.IngestOwner(),
+			Retry:          rec.RetryStatus(),
+			Failover:       rec.FailoverStatus(),
+			SegmentLength:  segmentDuration,
+		}
+	}
+	return status
+}
+
+type RecorderStatus struct {
+	Running     bool      `json:"running"`
+	Paused      bool      `json:"paused"`
+	Transcoding bool      `json:"transcoding"`
+	State       State     `json:"state"`
+	StateSince  time.Time `json:"state_since"`
+	// Uptime is kept for older clients; UptimeSeconds is the same as a
+	// number.
+	Uptime         string        `json:"uptime"`
+	UptimeSeconds  int64         `json:"uptime_seconds"`
+	StartedAt      time.Time     `json:"started_at,omitzero"`
+	LastSegmentAt  time.Time     `json:"last_segment_at,omitzero"`
+	LastError      string        `json:"last_error,omitempty"`
+	OutputDir      string        `json:"output_dir"`
+	Usage          *ProcessUsage `json:"usage,omitempty"`
+	Restarts       int           `json:"resource_restarts"`
+	SharesStreamOf string        `json:"shares_stream_of,omitempty"`
+	Retry          *RetryStatus  `json:"retry,omitempty"`
+	// Failover is set while the camera records from its failover URL.
+	Failover *FailoverStatus `json:"failover,omitempty"`
+	// SegmentLength is the length adaptive segments pick for the next
+	// segment; empty while they are off.
+	SegmentLength string `json:"segment_duration,omitempty"`
+}
+
+func sortSegmentsByDateDesc(segments []RecordingSegment) {
+	for i := 0; i < len(segments)-1; i++ {
+		for j := i + 1; j < len(segments); j++ {
+			if segments[i].CreatedAt.Before(segments[j].CreatedAt) {
+				segments[i], segments[j] = segments[j], segments[i]
+			}
+		}
+	}
+}
+
+type MJPEGStreamer struct {
+	rtspURL       string
+	quality       Quality
+	hwaccel       HWAccel
+	cmd           *exec.Cmd
+	cancel        context.CancelFunc
+	done          chan struct{}
+	running       bool
+	mu            sync.Mutex
+	frameCallback func([]byte)
+	lastError     error
+}
+
+func NewMJPEGStreamer(rtspURL string, q Quality) *MJPEGStreamer {
+	return &MJPEGStreamer{
+		rtspURL: rtspURL,
+		quality: q,
+	}
+}
+
+func (m *MJPEGStreamer) Start(ctx context.Context, frameCallback func([]byte)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return fmt.Errorf("streamer already running")
+	}
+
+	// Stop cancels the run's context, which also ends an ffmpeg started
+	// after Stop was called.
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	m.cancel = cancel
+	m.done = done
+	m.frameCallback = frameCallback
+	m.running = true
+
+	go m.runStreamer(ctx, done)
+
+	return nil
+}
+
+func (m *MJPEGStreamer) runStreamer(ctx context.Context, done chan struct{}) {
+	defer func() {
+		m.mu.Lock()
+		if m.done == done {
+			m.running = false
+		}
+		m.mu.Unlock()
+		close(done)
+	}()
+
+	for ctx.Err() == nil {
+		err := m.streamFrame(ctx)
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+		m.mu.Lock()
+		m.lastError = err
+		m.mu.Unlock()
+
+		retryDelay, isPermanent := classifyFFmpegError(err)
+		errType := "transient"
+		if isPermanent {
+			errType = "permanent"
+		}
+		log.Printf("[MJPEG] Stream failed (%s): %v. Retrying in %v...", errType, err, retryDelay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+func (m *MJPEGStreamer) streamFrame(ctx context.Context) error {
+	m.mu.Lock()
+	rtspURL := m.rtspURL
+	q := m.quality
+	hwaccel := m.hwaccel
+	m.mu.Unlock()
+
+	src, err := source.Parse(rtspURL)
+	if err != nil {
+		return err
+	}
+
+	var args []string
+	if !src.IsLocal() {
+		args = hwaccel.InputArgs()
+	}
+	args = append(args, src.InputArgs()...)
+	args = append(args, src.NetworkArgs()...)
+	args = append(args,
+		"-fflags", "+genpts",
+		"-vf", fmt.Sprintf("fps=%d,scale=%d:-1", q.FPS, q.Width),
+		"-c:v", "mjpeg",
+		"-q:v", "5",
+		// One JPEG per encoded frame, never duplicated or dropped by the muxer.
+		"-fps_mode", "passthrough",
+		"-f", "image2pipe",
+		"-",
+	)
+
+	m.mu.Lock()
+	m.cmd = ffmpegCommand(ctx, args...)
+	m.mu.Unlock()
+
+	stdout, err := m.cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	if err := m.cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	m.mu.Lock()
+	callback := m.frameCallback
+	m.mu.Unlock()
+
+	m.readFrames(ctx, stdout, callback)
+
+	if err := m.cmd.Wait(); err != nil {
+		if ctx.Err() == context.Canceled {
+			return nil
+		}
+		return fmt.Errorf("ffmpeg error: %w", err)
+	}
+
+	return nil
+}
+
+func (m *MJPEGStreamer) readFrames(ctx context.Context, stdout io.Reader, callback func([]byte)) {
+	buffer := make([]byte, 256*1024)
+	var frames jpegSplitter
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			n, err := stdout.Read(buffer)
+			frames.write(buffer[:n])
+			for frame := frames.next(); frame != nil; frame = frames.next() {
+				if callback != nil {
+					callback(frame)
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Stop ends the stream and returns a channel closed once its ffmpeg has
+// exited and it will not be restarted. Cancelling only asks ffmpeg to exit;
+// streamFrame owns the Wait, which kills it after stopGracePeriod.
+func (m *MJPEGStreamer) Stop() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.done == nil {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	m.cancel()
+	m.running = false
+	return m.done
+}
+
+func (m *MJPEGStreamer) IsRunning() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.running
+}
+
+type Quality struct {
+	Width int `json:"width"`
+	FPS   int `json:"fps"`
+}
+
+var DefaultQuality = Quality{Width: 640, FPS: 10}
+
+var (
+	allowedWidths = []int{320, 640, 1280}
+	allowedFPS    = []int{5, 10, 15}
+)
+
+const previewIdleTimeout = 30 * time.Second
+
+func ParseQuality(res, fps string) (Quality, error) {
+	q := DefaultQuality
+
+	if res != "" {
+		width, err := strconv.Atoi(res)
+		if err != nil || !containsInt(allowedWidths, width) {
+			return q, fmt.Errorf("res must be one of %v", allowedWidths)
+		}
+		q.Width = width
+	}
+
+	if fps != "" {
+		rate, err := strconv.Atoi(fps)
+		if err != nil || !containsInt(allowedFPS, rate) {
+			return q, fmt.Errorf("fps must be one of %v", allowedFPS)
+		}
+		q.FPS = rate
+	}
+
+	return q, nil
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func streamKey(name string, q Quality) string {
+	return fmt.Sprintf("%s|%d|%d", name, q.Width, q.FPS)
+}
+
+type mjpegStream struct {
+	camera     string
+	rtspURL    string
+	ctx        context.Context
+	streamer   *MJPEGStreamer
+	frame      []byte
+	cond       *sync.Cond
+	viewers    int
+	persistent bool
+	slot       bool
+	idleTimer  *time.Timer
+}
+
+// stopIdleTimer cancels a pending removal of the stream for having no
+// viewers. The caller holds the manager's lock.
+func (s *mjpegStream) stopIdleTimer() {
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+}
+
+type MJPEGManager struct {
+	streams     map[string]*mjpegStream
+	limiter     *Limiter
+	maxVariants int
+	hwaccel     HWAccel
+	mu          sync.RWMutex
+}
+
+func NewMJPEGManager() *MJPEGManager {
+	return &MJPEGManager{
+		streams: make(map[string]*mjpegStream),
+	}
+}
+
+func (m *MJPEGManager) SetLimits(limiter *Limiter, maxVariants int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limiter = limiter
+	m.maxVariants = maxVariants
+}
+
+// SetHWAccel decodes streams started from now on with hwaccel.
+func (m *MJPEGManager) SetHWAccel(hwaccel HWAccel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hwaccel = hwaccel
+}
+
+func (m *MJPEGManager) variantsLocked(name string) int {
+	count := 0
+	for _, stream := range m.streams {
+		if stream.camera == name && !stream.persistent {
+			count++
+		}
+	}
+	return count
+}
+
+// removeLocked stops the stream and returns a channel closed once it has
+// exited. Its transcode slot is given back only then, so the ffmpeg still
+// counts against the limit while it winds down.
+func (m *MJPEGManager) removeLocked(key string, stream *mjpegStream) <-chan struct{} {
+	stream.stopIdleTimer()
+	done := stream.streamer.Stop()
+	if stream.slot {
+		limiter := m.limiter
+		go func() {
+			<-done
+			limiter.Release()
+		}()
+	}
+	delete(m.streams, key)
+	return done
+}
+
+func (m *MJPEGManager) Start(ctx context.Context, name, rtspURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := streamKey(name, DefaultQuality)
+	if stream, exists := m.streams[key]; exists {
+		if stream.ctx.Err() == nil {
+			return nil
+		}
+		// Its context ended, so the streamer is gone for good.
+		m.removeLocked(key, stream)
+	}
+
+	m.startStreamLocked(ctx, key, name, rtspURL, DefaultQuality, true)
+	return nil
+}
+
+func (m *MJPEGManager) startStreamLocked(ctx context.Context, key, name, rtspURL string, q Quality, persistent bool) *mjpegStream {
+	stream := &mjpegStream{
+		camera:     name,
+		rtspURL:    rtspURL,
+		ctx:        ctx,
+		streamer:   NewMJPEGStreamer(rtspURL, q),
+		cond:       sync.NewCond(&sync.Mutex{}),
+		persistent: persistent,
+	}
+	m.streams[key] = stream
+	stream.streamer.hwaccel = m.hwaccel
+
+	stream.streamer.Start(ctx, func(frame []byte) {
+		buf := make([]byte, len(frame))
+		copy(buf, frame)
+
+		stream.cond.L.Lock()
+		m.mu.Lock()
+		stream.frame = buf
+		m.mu.Unlock()
+		stream.cond.Broadcast()
+		stream.cond.L.Unlock()
+	})
+
+	return stream
+}
+
+func (m *MJPEGManager) Acquire(name string, q Quality) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := streamKey(name, q)
+	if stream, exists := m.streams[key]; exists {
+		stream.viewers++
+		stream.stopIdleTimer()
+		return key, nil
+	}
+
+	baseKey := streamKey(name, DefaultQuality)
+	base, exists := m.streams[baseKey]
+	if !exists {
+		return "", fmt.Errorf("camera %s is not streaming", name)
+	}
+
+	if (m.maxVariants > 0 && m.variantsLocked(name) >= m.maxVariants) || !m.limiter.TryAcquire() {
+		base.viewers++
+		base.stopIdleTimer()
+		return baseKey, nil
+	}
+
+	stream := m.startStreamLocked(base.ctx, key, name, base.rtspURL, q, false)
+	stream.slot = m.limiter != nil
+	stream.viewers = 1
+	return key, nil
+}
+
+func (m *MJPEGManager) Release(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream, exists := m.streams[key]
+	if !exists {
+		return
+	}
+
+	if stream.viewers > 0 {
+		stream.viewers--
+	}
+	if stream.persistent || stream.viewers > 0 {
+		return
+	}
+
+	stream.stopIdleTimer()
+	// A timer that fired while being stopped finds itself replaced.
+	var timer *time.Timer
+	timer = time.AfterFunc(previewIdleTimeout, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if current, ok := m.streams[key]; ok && current == stream && stream.idleTimer == timer && stream.viewers == 0 {
+			m.removeLocked(key, stream)
+		}
+	})
+	stream.idleTimer = timer
+}
+
+// Stop ends the camera's streams and waits for their ffmpeg to exit.
+func (m *MJPEGManager) Stop(name string) {
+	m.mu.Lock()
+	var stopped []<-chan struct{}
+	for key, stream := range m.streams {
+		if stream.camera == name {
+			stopped = append(stopped, m.removeLocked(key, stream))
+		}
+	}
+	m.mu.Unlock()
+
+	// Streams take the lock to hand over frames, so wait without it.
+	for _, done := range stopped {
+		<-done
+	}
+}
+
+// StopAll ends every stream and waits for their ffmpeg to exit.
+func (m *MJPEGManager) StopAll() {
+	m.mu.Lock()
+	var stopped []<-chan struct{}
+	for key, stream := range m.streams {
+		stopped = append(stopped, m.removeLocked(key, stream))
+	}
+	m.mu.Unlock()
+
+	for _, done := range stopped {
+		<-done
+	}
+}
+
+func (m *MJPEGManager) GetFrame(key string) ([]byte, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stream, ok := m.streams[key]
+	if !ok {
+		return nil, false
+	}
+	return stream.frame, true
+}
+
+func (m *MJPEGManager) LatestFrame(name string) ([]byte, bool) {
+	return m.GetFrame(streamKey(name, DefaultQuality))
+}
+
+func (m *MJPEGManager) GetCond(key string) (*sync.Cond, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stream, ok := m.streams[key]
+	if !ok {
+		return nil, false
+	}
+	return stream.cond, true
+}
+
+func (m *MJPEGManager) IsRunning(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if stream, ok := m.streams[streamKey(name, DefaultQuality)]; ok {
+		return stream.streamer.IsRunning()
+	}
+	return false
+}
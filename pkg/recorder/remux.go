@@ -0,0 +1,111 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/command"
+)
+
+// FileProbe is what ffprobe reports about a video file.
+type FileProbe struct {
+	Duration time.Duration
+	// CreationTime is the creation_time tag of the container, or zero.
+	CreationTime time.Time
+	// Format is the container as ffprobe names it, such as
+	// "mov,mp4,m4a,3gp,3g2,mj2" or "matroska,webm", and VideoCodec and
+	// AudioCodec the codecs of the first streams, or "" when there are none.
+	Format     string
+	VideoCodec string
+	AudioCodec string
+	// Origin is the recorder that tagged the file, if one did.
+	Origin Origin
+}
+
+// Probe reads the duration, creation time, codecs and origin of a video
+// file.
+func Probe(ctx context.Context, path string) (FileProbe, error) {
+	output, err := command.Context(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "format=format_name,duration:format_tags=creation_time,instance_id,site:stream=codec_type,codec_name",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return FileProbe{}, fmt.Errorf("ffprobe: %w", err)
+	}
+
+	var result struct {
+		Format struct {
+			Name     string            `json:"format_name"`
+			Duration string            `json:"duration"`
+			Tags     map[string]string `json:"tags"`
+		} `json:"format"`
+		Streams []struct {
+			Type  string `json:"codec_type"`
+			Codec string `json:"codec_name"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return FileProbe{}, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	var probe FileProbe
+	seconds, err := strconv.ParseFloat(result.Format.Duration, 64)
+	if err != nil || seconds <= 0 {
+		return FileProbe{}, fmt.Errorf("file has no duration")
+	}
+	probe.Duration = time.Duration(seconds * float64(time.Second))
+	if t, err := time.Parse(time.RFC3339Nano, result.Format.Tags["creation_time"]); err == nil {
+		probe.CreationTime = t
+	}
+	// Matroska stores tag names in upper case.
+	for key, value := range result.Format.Tags {
+		switch strings.ToLower(key) {
+		case "instance_id":
+			probe.Origin.Instance = value
+		case "site":
+			probe.Origin.Site = value
+		}
+	}
+	probe.Format = result.Format.Name
+	for _, stream := range result.Streams {
+		switch {
+		case stream.Type == "video" && probe.VideoCodec == "":
+			probe.VideoCodec = stream.Codec
+		case stream.Type == "audio" && probe.AudioCodec == "":
+			probe.AudioCodec = stream.Codec
+		}
+	}
+	return probe, nil
+}
+
+// Remux copies the streams of src into dst without re-encoding, with the
+// container following dst's extension and startedAt as its creation_time.
+// Other tags, such as the origin, are kept.
+func Remux(ctx context.Context, src, dst string, startedAt time.Time) error {
+	args := []string{
+		"-v", "error",
+		"-i", src,
+		"-map", "0",
+		"-c", "copy",
+		"-metadata", "creation_time=" + startedAt.UTC().Format(time.RFC3339Nano),
+	}
+	if strings.EqualFold(filepath.Ext(dst), ".mp4") {
+		args = append(args, "-movflags", "+faststart+use_metadata_tags")
+	}
+	args = append(args, "-y", dst)
+
+	if output, err := ffmpegCommand(ctx, args...).CombinedOutput(); err != nil {
+		os.Remove(dst)
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
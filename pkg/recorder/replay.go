@@ -0,0 +1,254 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	replayChunk      = 2 * time.Second
+	replayRetryDelay = 10 * time.Second
+)
+
+// ReplayTarget is a camera kept in the replay buffer.
+type ReplayTarget struct {
+	Name string
+	URL  string
+}
+
+// ReplayBuffer keeps the last few minutes of every target camera as short
+// MPEG-TS chunks in a temporary directory, so the latest footage can be cut
+// into a clip at once instead of waiting for the segment being recorded to
+// finish. Chunks survive a reconnect, so a clip may span a gap.
+type ReplayBuffer struct {
+	baseDir string
+	length  time.Duration
+	targets func() []ReplayTarget
+	loops   map[ReplayTarget]context.CancelFunc
+	mu      sync.Mutex
+}
+
+func NewReplayBuffer(length time.Duration, targets func() []ReplayTarget) *ReplayBuffer {
+	return &ReplayBuffer{
+		baseDir: filepath.Join(os.TempDir(), fmt.Sprintf("cam-recorder-replay-%d", os.Getpid())),
+		length:  length,
+		targets: targets,
+		loops:   make(map[ReplayTarget]context.CancelFunc),
+	}
+}
+
+// Length is how far back the buffer reaches.
+func (b *ReplayBuffer) Length() time.Duration {
+	return b.length
+}
+
+func (b *ReplayBuffer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(replayRetryDelay)
+		defer ticker.Stop()
+
+		b.sync(ctx)
+
+		for {
+			select {
+			case <-ctx.Done():
+				b.mu.Lock()
+				for target, cancel := range b.loops {
+					cancel()
+					delete(b.loops, target)
+				}
+				b.mu.Unlock()
+				os.RemoveAll(b.baseDir)
+				return
+			case <-ticker.C:
+				b.sync(ctx)
+				b.prune()
+			}
+		}
+	}()
+}
+
+func (b *ReplayBuffer) sync(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wanted := make(map[ReplayTarget]bool)
+	names := make(map[string]bool)
+	for _, target := range b.targets() {
+		wanted[target] = true
+		names[target.Name] = true
+	}
+
+	for target, cancel := range b.loops {
+		if !wanted[target] {
+			cancel()
+			delete(b.loops, target)
+			if !names[target.Name] {
+				os.RemoveAll(b.cameraDir(target.Name))
+			}
+		}
+	}
+
+	for target := range wanted {
+		if _, ok := b.loops[target]; ok {
+			continue
+		}
+		loopCtx, cancel := context.WithCancel(ctx)
+		b.loops[target] = cancel
+		go b.run(loopCtx, target)
+	}
+}
+
+func (b *ReplayBuffer) cameraDir(name string) string {
+	return filepath.Join(b.baseDir, storage.CameraDirName(name))
+}
+
+func (b *ReplayBuffer) run(ctx context.Context, target ReplayTarget) {
+	for {
+		err := b.capture(ctx, target)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[%s] Replay buffer stopped: %v. Retrying in %v...", target.Name, err, replayRetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(replayRetryDelay):
+		}
+	}
+}
+
+// capture writes the camera's stream into chunks until it ends. Chunk names
+// start with the run's start time, so they sort in recording order across
+// reconnects.
+func (b *ReplayBuffer) capture(ctx context.Context, target ReplayTarget) error {
+	src, err := source.Parse(target.URL)
+	if err != nil {
+		return err
+	}
+	dir := b.cameraDir(target.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create replay directory: %w", err)
+	}
+
+	args := src.InputArgs()
+	args = append(args, src.NetworkArgs()...)
+	args = append(args, "-fflags", "+genpts")
+	if src.IsLocal() {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-g", "30")
+	} else {
+		args = append(args, "-c:v", "copy")
+	}
+	args = append(args,
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-f", "segment",
+		"-segment_time", strconv.Itoa(int(replayChunk.Seconds())),
+		"-segment_format", "mpegts",
+		"-reset_timestamps", "1",
+		filepath.Join(dir, fmt.Sprintf("%013d_%%06d.ts", time.Now().UnixMilli())),
+	)
+
+	output, err := ffmpegCommand(ctx, args...).CombinedOutput()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+	}
+	return fmt.Errorf("stream ended")
+}
+
+// chunks lists a camera's chunks, oldest first.
+func (b *ReplayBuffer) chunks(name string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(b.cameraDir(name))
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []os.FileInfo
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".ts") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.Size() > 0 {
+			chunks = append(chunks, info)
+		}
+	}
+	return chunks, nil
+}
+
+func (b *ReplayBuffer) prune() {
+	cutoff := time.Now().Add(-b.length - replayChunk)
+
+	b.mu.Lock()
+	names := make(map[string]bool)
+	for target := range b.loops {
+		names[target.Name] = true
+	}
+	b.mu.Unlock()
+
+	for name := range names {
+		chunks, _ := b.chunks(name)
+		for _, chunk := range chunks {
+			if chunk.ModTime().Before(cutoff) {
+				os.Remove(filepath.Join(b.cameraDir(name), chunk.Name()))
+			}
+		}
+	}
+}
+
+// Clip joins the chunks covering the last d of the camera into an MP4 at
+// dst. The clip starts at the first keyframe of the oldest chunk, so it may
+// run up to one chunk longer than asked for.
+func (b *ReplayBuffer) Clip(ctx context.Context, name string, d time.Duration, dst string) error {
+	chunks, err := b.chunks(name)
+	if err != nil || len(chunks) == 0 {
+		return fmt.Errorf("no footage buffered for %s", name)
+	}
+
+	// A chunk's modification time is when its last frame was written.
+	since := time.Now().Add(-d)
+	first := len(chunks) - 1
+	for first > 0 && chunks[first-1].ModTime().After(since) {
+		first--
+	}
+
+	list, err := os.CreateTemp("", "replay-*.txt")
+	if err != nil {
+		return fmt.Errorf("failed to write chunk list: %w", err)
+	}
+	defer os.Remove(list.Name())
+	for _, chunk := range chunks[first:] {
+		path := filepath.ToSlash(filepath.Join(b.cameraDir(name), chunk.Name()))
+		fmt.Fprintf(list, "file '%s'\n", strings.ReplaceAll(path, "'", `'\''`))
+	}
+	if err := list.Close(); err != nil {
+		return fmt.Errorf("failed to write chunk list: %w", err)
+	}
+
+	cmd := ffmpegCommand(ctx,
+		"-f", "concat",
+		"-safe", "0",
+		"-i", list.Name(),
+		"-c", "copy",
+		"-movflags", "+faststart",
+		"-y",
+		dst,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(dst)
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
@@ -0,0 +1,642 @@
+package recorder
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/source"
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const (
+	restreamReadyTimeout = 15 * time.Second
+	// Packets a reader may fall behind by before it is disconnected.
+	restreamClientBuffer = 1024
+	restreamWriteTimeout = 10 * time.Second
+	restreamMethods      = "OPTIONS, DESCRIBE, SETUP, PLAY, TEARDOWN, GET_PARAMETER, SET_PARAMETER"
+)
+
+// RestreamTarget is a camera the restream server republishes.
+type RestreamTarget struct {
+	Name string
+	URL  string
+}
+
+// RestreamServer is a small RTSP server republishing cameras at
+// rtsp://host/<camera>, for NVRs and analytics that would otherwise need a
+// connection of their own to cameras allowing only one client. A camera is
+// published by an ffmpeg pushing its stream, unchanged, to a loopback
+// listener while at least one reader is connected, and for ingestLinger
+// after. Readers get RTP interleaved on the RTSP connection; UDP is not
+// offered.
+type RestreamServer struct {
+	listen   string
+	username string
+	password string
+	targets  func() []RestreamTarget
+	// token is the first path element ffmpeg publishes to, so nothing else
+	// on the host can publish a camera.
+	token string
+
+	ctx         context.Context
+	publishAddr string
+	mu          sync.Mutex
+	streams     map[string]*restream
+}
+
+func NewRestreamServer(listen, username, password string, targets func() []RestreamTarget) *RestreamServer {
+	return &RestreamServer{
+		listen:   listen,
+		username: username,
+		password: password,
+		targets:  targets,
+		token:    randomHex(16),
+		ctx:      context.Background(),
+		streams:  make(map[string]*restream),
+	}
+}
+
+// Start listens for readers on the configured address and for the
+// publishing ffmpegs on loopback, until ctx is done.
+func (s *RestreamServer) Start(ctx context.Context) error {
+	readers, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen for RTSP on %s: %w", s.listen, err)
+	}
+	publishers, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		readers.Close()
+		return fmt.Errorf("failed to open restream publish listener: %w", err)
+	}
+
+	s.mu.Lock()
+	s.ctx = ctx
+	s.publishAddr = publishers.Addr().String()
+	s.mu.Unlock()
+
+	go s.accept(readers, false)
+	go s.accept(publishers, true)
+	go func() {
+		<-ctx.Done()
+		readers.Close()
+		publishers.Close()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for name, st := range s.streams {
+			st.close()
+			delete(s.streams, name)
+		}
+	}()
+	return nil
+}
+
+// Readers returns how many RTSP clients read the camera.
+func (s *RestreamServer) Readers(name string) int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	st, ok := s.streams[name]
+	s.mu.Unlock()
+	if !ok {
+		return 0
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.readers)
+}
+
+func (s *RestreamServer) accept(listener net.Listener, publish bool) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(conn, publish)
+	}
+}
+
+// target finds the camera a reader's path names, by name or by the name of
+// its recordings directory.
+func (s *RestreamServer) target(path string) (RestreamTarget, bool) {
+	path = strings.Trim(path, "/")
+	for _, t := range s.targets() {
+		if path == t.Name || path == storage.CameraDirName(t.Name) {
+			return t, true
+		}
+	}
+	return RestreamTarget{}, false
+}
+
+// rtspConn is one RTSP connection, either a reader or a publishing ffmpeg.
+type rtspConn struct {
+	srv     *RestreamServer
+	conn    net.Conn
+	publish bool
+	session string
+	stream  *restream
+	wmu     sync.Mutex
+
+	// Reader state, guarded by stream.mu once the reader is attached.
+	// channels maps track*2 (RTP) and track*2+1 (RTCP) to the interleaved
+	// channels the reader asked for.
+	channels map[int]int
+	playing  bool
+	out      chan []byte
+}
+
+func (s *RestreamServer) serve(conn net.Conn, publish bool) {
+	c := &rtspConn{
+		srv:      s,
+		conn:     conn,
+		publish:  publish,
+		session:  randomHex(8),
+		channels: make(map[int]int),
+	}
+	defer c.close()
+
+	r := bufio.NewReader(conn)
+	for {
+		req, packet, err := readRTSP(r)
+		if err != nil {
+			return
+		}
+		if packet != nil {
+			// Readers only send RTCP receiver reports, which are dropped.
+			if c.publish && c.stream != nil {
+				c.stream.relay(c, packet)
+			}
+			continue
+		}
+
+		var resp *rtspResponse
+		if c.publish {
+			resp = c.handlePublisher(req)
+		} else {
+			resp = c.handleReader(req)
+		}
+		if err := c.write(resp.encode(req.header.Get("CSeq"))); err != nil || req.method == "TEARDOWN" {
+			return
+		}
+	}
+}
+
+func (c *rtspConn) write(data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(restreamWriteTimeout))
+	_, err := c.conn.Write(data)
+	return err
+}
+
+func (c *rtspConn) close() {
+	if st := c.stream; st != nil {
+		st.mu.Lock()
+		if c.publish {
+			if st.publisher == c {
+				// ffmpeg exits on its own once its connection is gone.
+				st.publisher = nil
+			}
+		} else if _, ok := st.readers[c]; ok {
+			st.dropLocked(c)
+		}
+		st.mu.Unlock()
+	}
+	c.conn.Close()
+}
+
+func (c *rtspConn) handleReader(req *rtspRequest) *rtspResponse {
+	if req.method == "OPTIONS" {
+		resp := &rtspResponse{status: 200}
+		resp.set("Public", restreamMethods)
+		return resp
+	}
+	if !c.authorized(req) {
+		resp := &rtspResponse{status: 401}
+		resp.set("WWW-Authenticate", `Basic realm="cam-recorder"`)
+		return resp
+	}
+
+	switch req.method {
+	case "DESCRIBE":
+		target, ok := c.srv.target(req.url.Path)
+		if !ok {
+			return &rtspResponse{status: 404}
+		}
+		st, err := c.attach(target)
+		if err != nil {
+			log.Printf("Warning: [%s] Restream failed: %v", target.Name, err)
+			return &rtspResponse{status: 503}
+		}
+
+		st.mu.Lock()
+		sdp := st.sdp
+		st.mu.Unlock()
+		base := req.url.String()
+		if !strings.HasSuffix(base, "/") {
+			base += "/"
+		}
+		resp := &rtspResponse{status: 200, body: sdp}
+		resp.set("Content-Base", base)
+		resp.set("Content-Type", "application/sdp")
+		return resp
+
+	case "SETUP":
+		path, control, _ := strings.Cut(req.url.Path[strings.LastIndex(req.url.Path, "/")+1:], "=")
+		track, err := strconv.Atoi(control)
+		if path != "trackID" || err != nil {
+			return &rtspResponse{status: 404}
+		}
+		target, ok := c.srv.target(strings.TrimSuffix(req.url.Path, "/trackID="+control))
+		if !ok {
+			return &rtspResponse{status: 404}
+		}
+		channel, ok := interleavedChannels(req.header.Get("Transport"))
+		if !ok {
+			return &rtspResponse{status: 461}
+		}
+		st, err := c.attach(target)
+		if err != nil {
+			log.Printf("Warning: [%s] Restream failed: %v", target.Name, err)
+			return &rtspResponse{status: 503}
+		}
+
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		if track < 0 || track >= len(st.controls) {
+			return &rtspResponse{status: 404}
+		}
+		c.channels[track*2] = channel
+		c.channels[track*2+1] = channel + 1
+		resp := &rtspResponse{status: 200}
+		resp.set("Transport", fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", channel, channel+1))
+		resp.set("Session", c.session+";timeout=60")
+		return resp
+
+	case "PLAY":
+		if !c.ownsSession(req) {
+			return &rtspResponse{status: 454}
+		}
+		st := c.stream
+		if st == nil || len(c.channels) == 0 {
+			return &rtspResponse{status: 455}
+		}
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		if _, ok := st.readers[c]; !ok {
+			// The publisher stopped since SETUP.
+			return &rtspResponse{status: 503}
+		}
+		if !c.playing {
+			c.playing = true
+			go c.drain()
+		}
+		resp := &rtspResponse{status: 200}
+		resp.set("Session", c.session+";timeout=60")
+		resp.set("Range", "npt=0.000-")
+		return resp
+
+	case "TEARDOWN", "GET_PARAMETER", "SET_PARAMETER":
+		// GET_PARAMETER is the keep-alive most clients send.
+		resp := &rtspResponse{status: 200}
+		if c.stream != nil {
+			resp.set("Session", c.session+";timeout=60")
+		}
+		return resp
+	}
+
+	resp := &rtspResponse{status: 405}
+	resp.set("Allow", restreamMethods)
+	return resp
+}
+
+// handlePublisher takes the stream of a publishing ffmpeg, which announces
+// it at /<token>/<camera>, sets up every track interleaved and records.
+func (c *rtspConn) handlePublisher(req *rtspRequest) *rtspResponse {
+	token, name, _ := strings.Cut(strings.TrimPrefix(req.url.Path, "/"), "/")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.srv.token)) != 1 {
+		return &rtspResponse{status: 401}
+	}
+
+	switch req.method {
+	case "OPTIONS":
+		resp := &rtspResponse{status: 200}
+		resp.set("Public", "OPTIONS, ANNOUNCE, SETUP, RECORD, TEARDOWN")
+		return resp
+
+	case "ANNOUNCE":
+		c.srv.mu.Lock()
+		st, ok := c.srv.streams[name]
+		c.srv.mu.Unlock()
+		if !ok {
+			return &rtspResponse{status: 404}
+		}
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		if st.cmd == nil || st.publisher != nil {
+			return &rtspResponse{status: 455}
+		}
+		st.publisher = c
+		st.sdp, st.controls = sdpTracks(req.body)
+		st.pubChannels = make(map[int]int)
+		c.stream = st
+		return &rtspResponse{status: 200}
+
+	case "SETUP":
+		st := c.stream
+		if st == nil {
+			return &rtspResponse{status: 455}
+		}
+		channel, ok := interleavedChannels(req.header.Get("Transport"))
+		if !ok {
+			return &rtspResponse{status: 461}
+		}
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		for track, control := range st.controls {
+			if control != "" && (req.url.String() == control || strings.HasSuffix(req.url.Path, "/"+control)) {
+				st.pubChannels[channel] = track * 2
+				st.pubChannels[channel+1] = track*2 + 1
+				resp := &rtspResponse{status: 200}
+				resp.set("Transport", fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d;mode=record", channel, channel+1))
+				resp.set("Session", c.session)
+				return resp
+			}
+		}
+		return &rtspResponse{status: 404}
+
+	case "RECORD":
+		st := c.stream
+		if st == nil {
+			return &rtspResponse{status: 455}
+		}
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		if st.publisher == c {
+			st.markReady()
+		}
+		resp := &rtspResponse{status: 200}
+		resp.set("Session", c.session)
+		return resp
+
+	case "TEARDOWN":
+		return &rtspResponse{status: 200}
+	}
+
+	return &rtspResponse{status: 405}
+}
+
+func (c *rtspConn) authorized(req *rtspRequest) bool {
+	if c.srv.username == "" {
+		return true
+	}
+	user, password, ok := basicCredentials(req.header.Get("Authorization"))
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(c.srv.username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(c.srv.password)) == 1
+}
+
+func (c *rtspConn) ownsSession(req *rtspRequest) bool {
+	session, _, _ := strings.Cut(req.header.Get("Session"), ";")
+	return session == "" || strings.TrimSpace(session) == c.session
+}
+
+// attach makes c a reader of the target's stream, starting its publisher
+// when needed, and waits until the stream can be described.
+func (c *rtspConn) attach(target RestreamTarget) (*restream, error) {
+	s := c.srv
+	if c.stream != nil && c.stream.name != target.Name {
+		return nil, fmt.Errorf("one connection cannot read two cameras")
+	}
+
+	s.mu.Lock()
+	st := s.streams[target.Name]
+	if st != nil && st.url != target.URL {
+		st.close()
+		st = nil
+	}
+	if st == nil {
+		st = &restream{
+			srv:     s,
+			name:    target.Name,
+			url:     target.URL,
+			readers: make(map[*rtspConn]struct{}),
+		}
+		s.streams[target.Name] = st
+	}
+	s.mu.Unlock()
+
+	st.mu.Lock()
+	if st.closed {
+		st.mu.Unlock()
+		return nil, fmt.Errorf("restream of %s was stopped", target.Name)
+	}
+	if _, ok := st.readers[c]; !ok {
+		c.stream = st
+		c.out = make(chan []byte, restreamClientBuffer)
+		st.readers[c] = struct{}{}
+	}
+	if st.linger != nil {
+		st.linger.Stop()
+		st.linger = nil
+	}
+	if st.cmd == nil {
+		if err := st.startLocked(); err != nil {
+			st.dropLocked(c)
+			st.mu.Unlock()
+			return nil, err
+		}
+	}
+	ready, exited := st.ready, st.exited
+	st.mu.Unlock()
+
+	deadline := time.NewTimer(restreamReadyTimeout)
+	defer deadline.Stop()
+	select {
+	case <-ready:
+		return st, nil
+	case <-exited:
+		return nil, fmt.Errorf("publishing ffmpeg for %s exited", target.Name)
+	case <-deadline.C:
+		return nil, fmt.Errorf("timed out waiting for the stream of %s", target.Name)
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+// drain writes the packets relayed to a playing reader, closing the
+// connection once the reader is dropped.
+func (c *rtspConn) drain() {
+	for frame := range c.out {
+		if err := c.write(frame); err != nil {
+			break
+		}
+	}
+	c.conn.Close()
+}
+
+// restream is one camera's published stream. sdp and controls come from the
+// publisher's ANNOUNCE; pubChannels maps its interleaved channels to
+// track*2 (RTP) and track*2+1 (RTCP).
+type restream struct {
+	srv  *RestreamServer
+	name string
+	url  string
+
+	mu          sync.Mutex
+	cmd         *exec.Cmd
+	ready       chan struct{}
+	exited      chan struct{}
+	isReady     bool
+	publisher   *rtspConn
+	sdp         []byte
+	controls    []string
+	pubChannels map[int]int
+	readers     map[*rtspConn]struct{}
+	linger      *time.Timer
+	closed      bool
+}
+
+func (st *restream) startLocked() error {
+	src, err := source.Parse(st.url)
+	if err != nil {
+		return err
+	}
+
+	st.srv.mu.Lock()
+	ctx, publishAddr := st.srv.ctx, st.srv.publishAddr
+	st.srv.mu.Unlock()
+
+	args := src.InputArgs()
+	args = append(args, src.NetworkArgs()...)
+	args = append(args, "-fflags", "+genpts")
+	if src.IsLocal() {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-tune", "zerolatency", "-g", "60", "-c:a", "aac")
+	} else {
+		args = append(args, "-c:v", "copy", "-c:a", "copy")
+	}
+	args = append(args,
+		"-f", "rtsp",
+		"-rtsp_transport", "tcp",
+		fmt.Sprintf("rtsp://%s/%s/%s", publishAddr, st.srv.token, url.PathEscape(st.name)),
+	)
+
+	cmd := ffmpegCommand(ctx, args...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	st.cmd = cmd
+	st.ready = make(chan struct{})
+	st.exited = make(chan struct{})
+	st.isReady = false
+
+	go func() {
+		err := cmd.Wait()
+
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		if err != nil && len(st.readers) > 0 && ctx.Err() == nil {
+			log.Printf("[%s] Restream ffmpeg exited: %v", st.name, err)
+		}
+		close(st.exited)
+		st.cmd = nil
+		st.publisher = nil
+		st.sdp, st.controls, st.pubChannels = nil, nil, nil
+		if st.linger != nil {
+			st.linger.Stop()
+			st.linger = nil
+		}
+		for c := range st.readers {
+			st.dropLocked(c)
+		}
+	}()
+	return nil
+}
+
+func (st *restream) markReady() {
+	if !st.isReady {
+		st.isReady = true
+		close(st.ready)
+	}
+}
+
+// relay hands a packet from the publisher to every playing reader of its
+// track.
+func (st *restream) relay(pub *rtspConn, packet *rtspInterleaved) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.publisher != pub {
+		return
+	}
+	key, ok := st.pubChannels[packet.channel]
+	if !ok {
+		return
+	}
+
+	for c := range st.readers {
+		channel, ok := c.channels[key]
+		if !c.playing || !ok {
+			continue
+		}
+		select {
+		case c.out <- interleavedFrame(channel, packet.payload):
+		default:
+			log.Printf("Warning: [%s] Restream reader %s fell behind, disconnecting it", st.name, c.conn.RemoteAddr())
+			st.dropLocked(c)
+		}
+	}
+}
+
+// dropLocked stops relaying to a reader. A playing reader is disconnected;
+// one still setting up finds out at PLAY.
+func (st *restream) dropLocked(c *rtspConn) {
+	delete(st.readers, c)
+	if c.playing {
+		close(c.out)
+	}
+
+	if len(st.readers) == 0 && st.cmd != nil && st.linger == nil {
+		cmd := st.cmd
+		st.linger = time.AfterFunc(ingestLinger, func() {
+			st.mu.Lock()
+			defer st.mu.Unlock()
+			if len(st.readers) == 0 && st.cmd == cmd {
+				interrupt(cmd)
+			}
+		})
+	}
+}
+
+func (st *restream) close() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.closed = true
+	for c := range st.readers {
+		st.dropLocked(c)
+	}
+	if st.linger != nil {
+		st.linger.Stop()
+		st.linger = nil
+	}
+	interrupt(st.cmd)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,322 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// retranscodeCheckInterval is how often waiting jobs are looked at, besides
+// right after one is queued.
+const retranscodeCheckInterval = 30 * time.Second
+
+// DualMode records a stream copy of every transcoded segment alongside it, in
+// storage.RawDir, until the transcode is known good. When ffmpeg fails and
+// leaves a transcode that cannot be read while the copy has data, the copy is
+// re-encoded in the background instead of the segment being lost. After
+// MaxAttempts failed re-encodes, RetryDelay apart, the copy itself is kept as
+// the segment, in Matroska.
+type DualMode struct {
+	Enabled     bool          `mapstructure:"enabled" yaml:"enabled"`
+	MaxAttempts int           `mapstructure:"max_attempts" yaml:"max_attempts"`
+	RetryDelay  time.Duration `mapstructure:"retry_delay" yaml:"retry_delay"`
+}
+
+var DefaultDualMode = DualMode{
+	MaxAttempts: 3,
+	RetryDelay:  time.Minute,
+}
+
+// retranscodeJob is saved as JSON next to its stream copy, so jobs still
+// waiting when the recorder stops are picked up on the next start.
+type retranscodeJob struct {
+	Segment     RecordingSegment `json:"segment"`
+	Attempts    int              `json:"attempts"`
+	NextAttempt time.Time        `json:"next_attempt"`
+	LastError   string           `json:"last_error,omitempty"`
+
+	raw string
+}
+
+// RetranscodeQueue re-encodes the stream copies of segments whose transcode
+// failed, one at a time, and passes the repaired segments to the segment
+// hook.
+type RetranscodeQueue struct {
+	opts    *storage.Options
+	limiter *Limiter
+	hook    SegmentHook
+	mode    DualMode
+	wake    chan struct{}
+	mu      sync.Mutex
+}
+
+func NewRetranscodeQueue(opts *storage.Options) *RetranscodeQueue {
+	return &RetranscodeQueue{
+		opts: opts,
+		mode: DefaultDualMode,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+func (q *RetranscodeQueue) SetLimiter(limiter *Limiter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.limiter = limiter
+}
+
+func (q *RetranscodeQueue) SetHook(hook SegmentHook) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.hook = hook
+}
+
+func (q *RetranscodeQueue) SetMode(mode DualMode) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.mode = mode
+}
+
+// Enabled reports whether segments are recorded in dual mode.
+func (q *RetranscodeQueue) Enabled() bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.mode.Enabled
+}
+
+// Start removes the stream copies a previous run left behind whose segment
+// was written, then re-encodes queued copies in the background. Call it
+// before the recorders start, so copies being recorded are not mistaken for
+// leftovers.
+func (q *RetranscodeQueue) Start(ctx context.Context) {
+	q.removeLeftovers()
+
+	go func() {
+		for {
+			wait := retranscodeCheckInterval
+			if next := q.runDue(ctx); !next.IsZero() {
+				wait = min(wait, time.Until(next))
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-q.wake:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// Pending counts the segments waiting to be re-encoded.
+func (q *RetranscodeQueue) Pending() int {
+	return len(q.jobFiles())
+}
+
+func (q *RetranscodeQueue) jobFiles() []string {
+	files, _ := filepath.Glob(filepath.Join(q.opts.OutputDir, storage.RawDir, "*", "*.mkv.json"))
+	return files
+}
+
+// removeLeftovers deletes stream copies without a job whose segment exists,
+// left by a recorder that stopped before it could decide on them. Copies of
+// segments that are gone are kept, to be rescued by hand.
+func (q *RetranscodeQueue) removeLeftovers() {
+	copies, _ := filepath.Glob(filepath.Join(q.opts.OutputDir, storage.RawDir, "*", "*.mkv"))
+	for _, raw := range copies {
+		if _, err := os.Stat(raw + ".json"); err == nil {
+			continue
+		}
+		segment := filepath.Join(q.opts.OutputDir, strings.TrimSuffix(strings.TrimPrefix(raw, filepath.Join(q.opts.OutputDir, storage.RawDir)), ".mkv"))
+		if info, err := os.Stat(segment); err == nil && info.Size() > 0 {
+			os.Remove(raw)
+			continue
+		}
+		log.Printf("Warning: Stream copy %s was left behind without its segment; keeping it", raw)
+	}
+}
+
+// queue saves a job for the stream copy at raw and wakes the worker.
+func (q *RetranscodeQueue) queue(raw string, seg RecordingSegment) error {
+	job := &retranscodeJob{Segment: seg, NextAttempt: time.Now(), raw: raw}
+	if err := job.save(); err != nil {
+		return err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (j *retranscodeJob) save() error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(j.raw+".json", data, 0644); err != nil {
+		return fmt.Errorf("failed to save re-encode job: %w", err)
+	}
+	return nil
+}
+
+func (j *retranscodeJob) remove() {
+	os.Remove(j.raw)
+	os.Remove(j.raw + ".json")
+}
+
+// runDue re-encodes every job whose next attempt is due, oldest first, and
+// returns when the next waiting one is, or zero when none are.
+func (q *RetranscodeQueue) runDue(ctx context.Context) (next time.Time) {
+	for _, file := range q.jobFiles() {
+		if ctx.Err() != nil {
+			return time.Time{}
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		job := &retranscodeJob{raw: strings.TrimSuffix(file, ".json")}
+		if err := json.Unmarshal(data, job); err != nil {
+			log.Printf("Warning: Dropping unreadable re-encode job %s: %v", file, err)
+			os.Remove(file)
+			continue
+		}
+		if time.Now().Before(job.NextAttempt) {
+			if next.IsZero() || job.NextAttempt.Before(next) {
+				next = job.NextAttempt
+			}
+			continue
+		}
+		if q.run(ctx, job) && (next.IsZero() || job.NextAttempt.Before(next)) {
+			next = job.NextAttempt
+		}
+	}
+	return next
+}
+
+// run makes one attempt at a job and reports whether it is to be retried.
+func (q *RetranscodeQueue) run(ctx context.Context, job *retranscodeJob) bool {
+	q.mu.Lock()
+	limiter, hook, mode := q.limiter, q.hook, q.mode
+	q.mu.Unlock()
+
+	seg := job.Segment
+	if _, err := os.Stat(job.raw); err != nil {
+		log.Printf("Warning: [%s] Stream copy of %s is gone, dropping its re-encode", seg.CameraName, seg.Filename)
+		job.remove()
+		return false
+	}
+
+	if !limiter.Acquire(ctx, nil) {
+		return false
+	}
+	tmp := filepath.Join(filepath.Dir(job.raw), "part_"+seg.Filename)
+	err := encodeSegment(ctx, job.raw, tmp, seg.StartedAt, seg.Origin)
+	limiter.Release()
+	if ctx.Err() != nil {
+		os.Remove(tmp)
+		return false
+	}
+
+	if err != nil {
+		job.Attempts++
+		job.LastError = err.Error()
+		if job.Attempts < mode.MaxAttempts {
+			job.NextAttempt = time.Now().Add(mode.RetryDelay)
+			log.Printf("Warning: [%s] Re-encoding %s failed (attempt %d of %d), retrying in %v: %v",
+				seg.CameraName, seg.Filename, job.Attempts, mode.MaxAttempts, mode.RetryDelay, err)
+			if err := job.save(); err != nil {
+				log.Printf("Warning: [%s] %v", seg.CameraName, err)
+			}
+			return true
+		}
+		if err := q.keepCopy(job); err != nil {
+			log.Printf("Warning: [%s] Re-encoding %s failed and its stream copy could not be kept: %v", seg.CameraName, seg.Filename, err)
+			return false
+		}
+		log.Printf("Warning: [%s] Re-encoding failed %d times, kept the stream copy as %s", seg.CameraName, job.Attempts, job.Segment.Filename)
+	} else {
+		if err := os.Rename(tmp, seg.Path); err != nil {
+			os.Remove(tmp)
+			log.Printf("Warning: [%s] Failed to replace %s with its re-encode: %v", seg.CameraName, seg.Filename, err)
+			return false
+		}
+		log.Printf("[%s] Re-encoded %s from its stream copy", seg.CameraName, seg.Filename)
+	}
+
+	seg = job.Segment
+	os.Chtimes(seg.Path, seg.EndedAt, seg.EndedAt)
+	info, err := os.Stat(seg.Path)
+	if err != nil {
+		return false
+	}
+	seg.Size = info.Size()
+	seg.CreatedAt = info.ModTime()
+	job.remove()
+	if hook != nil {
+		hook(seg)
+	}
+	return false
+}
+
+// keepCopy moves the stream copy into the camera's directory as the
+// segment, named like it but in Matroska.
+func (q *RetranscodeQueue) keepCopy(job *retranscodeJob) error {
+	seg := &job.Segment
+	dir := filepath.Dir(seg.Path)
+	name, err := storage.ClaimName(dir, strings.TrimSuffix(seg.Filename, filepath.Ext(seg.Filename))+".mkv")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name)
+	if err := os.Rename(job.raw, path); err != nil {
+		os.Remove(path)
+		return err
+	}
+	seg.Filename, seg.Path = name, path
+	return nil
+}
+
+// encodeSegment re-encodes a stream copy the way segments are recorded, with
+// the container following dst's extension.
+func encodeSegment(ctx context.Context, src, dst string, startedAt time.Time, origin Origin) error {
+	args := []string{
+		"-i", src,
+		"-map", "0:v",
+		"-map", "0:a?",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "23",
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-metadata", "creation_time=" + startedAt.UTC().Format(time.RFC3339Nano),
+	}
+	args = append(args, origin.metadataArgs()...)
+	if strings.EqualFold(filepath.Ext(dst), ".mp4") {
+		args = append(args, "-movflags", origin.movflags())
+	}
+	args = append(args, "-y", dst)
+
+	if output, err := ffmpegCommand(ctx, args...).CombinedOutput(); err != nil {
+		os.Remove(dst)
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		if last := lines[len(lines)-1]; last != "" {
+			return fmt.Errorf("ffmpeg: %w: %s", err, last)
+		}
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Largest RTSP message body accepted; an SDP is a few hundred bytes.
+const rtspMaxBody = 64 << 10
+
+// rtspRequest is an RTSP request as the restream server needs it.
+type rtspRequest struct {
+	method string
+	url    *url.URL
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// rtspInterleaved is an RTP or RTCP packet sent on the RTSP connection.
+type rtspInterleaved struct {
+	channel int
+	payload []byte
+}
+
+// readRTSP reads the next request or interleaved packet from r; exactly one
+// of the two results is set.
+func readRTSP(r *bufio.Reader) (*rtspRequest, *rtspInterleaved, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+	if first[0] == '$' {
+		var head [4]byte
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return nil, nil, err
+		}
+		packet := &rtspInterleaved{
+			channel: int(head[1]),
+			payload: make([]byte, int(head[2])<<8|int(head[3])),
+		}
+		if _, err := io.ReadFull(r, packet.payload); err != nil {
+			return nil, nil, err
+		}
+		return nil, packet, nil
+	}
+
+	tp := textproto.NewReader(r)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	method, rest, ok := strings.Cut(line, " ")
+	target, proto, ok2 := strings.Cut(rest, " ")
+	if !ok || !ok2 || !strings.HasPrefix(proto, "RTSP/1.") {
+		return nil, nil, fmt.Errorf("malformed RTSP request line %q", line)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("malformed RTSP URL %q: %w", target, err)
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := &rtspRequest{method: method, url: u, header: header}
+	if length := header.Get("Content-Length"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 || n > rtspMaxBody {
+			return nil, nil, fmt.Errorf("invalid RTSP Content-Length %q", length)
+		}
+		req.body = make([]byte, n)
+		if _, err := io.ReadFull(r, req.body); err != nil {
+			return nil, nil, err
+		}
+	}
+	return req, nil, nil
+}
+
+// rtspResponse is written back to the client of req.
+type rtspResponse struct {
+	status int
+	header [][2]string
+	body   []byte
+}
+
+func (r *rtspResponse) set(key, value string) {
+	r.header = append(r.header, [2]string{key, value})
+}
+
+func (r *rtspResponse) encode(cseq string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "RTSP/1.0 %d %s\r\nCSeq: %s\r\nServer: cam-recorder\r\n", r.status, rtspStatusText(r.status), cseq)
+	for _, h := range r.header {
+		fmt.Fprintf(&b, "%s: %s\r\n", h[0], h[1])
+	}
+	if len(r.body) > 0 {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n", len(r.body))
+	}
+	b.WriteString("\r\n")
+	b.Write(r.body)
+	return []byte(b.String())
+}
+
+func rtspStatusText(status int) string {
+	switch status {
+	case 200:
+		return "OK"
+	case 400:
+		return "Bad Request"
+	case 401:
+		return "Unauthorized"
+	case 404:
+		return "Not Found"
+	case 405:
+		return "Method Not Allowed"
+	case 454:
+		return "Session Not Found"
+	case 455:
+		return "Method Not Valid in This State"
+	case 461:
+		return "Unsupported Transport"
+	case 503:
+		return "Service Unavailable"
+	default:
+		return "Error"
+	}
+}
+
+// interleavedFrame frames an RTP or RTCP packet for an RTSP connection.
+func interleavedFrame(channel int, payload []byte) []byte {
+	frame := make([]byte, 4+len(payload))
+	frame[0], frame[1] = '$', byte(channel)
+	frame[2], frame[3] = byte(len(payload)>>8), byte(len(payload))
+	copy(frame[4:], payload)
+	return frame
+}
+
+// interleavedChannels returns the RTP channel a Transport header asks for
+// over TCP. The RTCP channel is the one after it.
+func interleavedChannels(transport string) (int, bool) {
+	for _, spec := range strings.Split(transport, ",") {
+		params := strings.Split(strings.TrimSpace(spec), ";")
+		if !strings.HasPrefix(params[0], "RTP/AVP/TCP") {
+			continue
+		}
+		for _, p := range params[1:] {
+			if value, ok := strings.CutPrefix(p, "interleaved="); ok {
+				rtp, _, _ := strings.Cut(value, "-")
+				if n, err := strconv.Atoi(rtp); err == nil && n >= 0 && n < 254 {
+					return n, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// basicCredentials returns the user and password of a Basic Authorization
+// header.
+func basicCredentials(header string) (string, string, bool) {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// sdpTracks rewrites a publisher's SDP for readers: the session control
+// becomes "*" and every media section gets a trackID=N control. It returns
+// the new SDP and the controls the publisher used, in media order.
+func sdpTracks(sdp []byte) ([]byte, []string) {
+	var out strings.Builder
+	var controls []string
+	media := -1
+	for _, line := range strings.Split(strings.ReplaceAll(string(sdp), "\r\n", "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "m=") {
+			media++
+			controls = append(controls, "")
+			out.WriteString(line + "\r\n")
+			fmt.Fprintf(&out, "a=control:trackID=%d\r\n", media)
+			continue
+		}
+		if control, ok := strings.CutPrefix(line, "a=control:"); ok {
+			if media >= 0 {
+				controls[media] = control
+			}
+			continue
+		}
+		out.WriteString(line + "\r\n")
+		if media < 0 && strings.HasPrefix(line, "t=") {
+			out.WriteString("a=control:*\r\n")
+		}
+	}
+	return []byte(out.String()), controls
+}
@@ -0,0 +1,154 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+const scrubQueueSize = 64
+
+type scrubJob struct {
+	done chan struct{}
+	err  error
+}
+
+// ScrubGenerator builds keyframe-only proxies of finished segments for fast
+// review. Proxies keep the original timestamps, so a position in the proxy is
+// the same position in the full recording and the browser can play them at
+// 8x or 16x without decoding every frame.
+type ScrubGenerator struct {
+	opts    *storage.Options
+	limiter *Limiter
+	ctx     context.Context
+	queue   chan string
+	jobs    map[string]*scrubJob
+	mu      sync.Mutex
+}
+
+func NewScrubGenerator(opts *storage.Options) *ScrubGenerator {
+	return &ScrubGenerator{
+		opts:  opts,
+		ctx:   context.Background(),
+		queue: make(chan string, scrubQueueSize),
+		jobs:  make(map[string]*scrubJob),
+	}
+}
+
+func (g *ScrubGenerator) SetLimiter(limiter *Limiter) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.limiter = limiter
+}
+
+func (g *ScrubGenerator) Start(ctx context.Context) {
+	g.mu.Lock()
+	g.ctx = ctx
+	g.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case path := <-g.queue:
+				if _, err := g.Proxy(ctx, path); err != nil && ctx.Err() == nil {
+					log.Printf("Warning: Failed to build scrub proxy for %s: %v", filepath.Base(path), err)
+				}
+			}
+		}
+	}()
+}
+
+// Enqueue schedules a proxy build in the background. When the queue is full
+// the segment is skipped; its proxy is then built on first request.
+func (g *ScrubGenerator) Enqueue(segmentPath string) {
+	select {
+	case g.queue <- segmentPath:
+	default:
+	}
+}
+
+// Proxy returns the path of the segment's proxy, building it first if needed.
+// Concurrent callers for the same segment share one build.
+func (g *ScrubGenerator) Proxy(ctx context.Context, segmentPath string) (string, error) {
+	out, err := storage.ScrubPath(g.opts.OutputDir, segmentPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(out); err == nil {
+		return out, nil
+	}
+
+	g.mu.Lock()
+	job, running := g.jobs[out]
+	if !running {
+		job = &scrubJob{done: make(chan struct{})}
+		g.jobs[out] = job
+		go g.build(g.ctx, g.limiter, job, segmentPath, out)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-job.done:
+	}
+	if job.err != nil {
+		return "", job.err
+	}
+	return out, nil
+}
+
+func (g *ScrubGenerator) build(ctx context.Context, limiter *Limiter, job *scrubJob, segmentPath, out string) {
+	defer func() {
+		g.mu.Lock()
+		delete(g.jobs, out)
+		g.mu.Unlock()
+		close(job.done)
+	}()
+
+	if !limiter.Acquire(ctx, nil) {
+		job.err = ctx.Err()
+		return
+	}
+	defer limiter.Release()
+
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		job.err = fmt.Errorf("failed to create scrub directory: %w", err)
+		return
+	}
+
+	tmp := strings.TrimSuffix(out, ".mp4") + ".part.mp4"
+	cmd := ffmpegCommand(ctx,
+		"-skip_frame", "nokey",
+		"-i", segmentPath,
+		"-an",
+		"-fps_mode", "passthrough",
+		"-vf", "scale=-2:360",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "30",
+		"-g", "1",
+		"-pix_fmt", "yuv420p",
+		"-movflags", "+faststart",
+		"-y",
+		tmp,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		job.err = fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+		return
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		os.Remove(tmp)
+		job.err = fmt.Errorf("failed to finalize scrub proxy: %w", err)
+	}
+}
@@ -0,0 +1,145 @@
+package recorder
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// How often a recorder sharing another's stream picks up its state.
+const followInterval = time.Second
+
+// A recorder that shares the stream of its owner runs no ffmpeg of its own.
+// It follows the owner's state and gets a copy of every segment the owner
+// finishes, named after itself; on filesystems that support it the copy is a
+// hard link and takes no extra space.
+
+func (r *Recorder) shareIngest(owner *Recorder) {
+	r.mu.Lock()
+	r.owner = owner
+	r.mu.Unlock()
+
+	owner.mu.Lock()
+	owner.sharers = append(owner.sharers, r)
+	owner.mu.Unlock()
+}
+
+// unshareIngest detaches r from its owner and from the recorders sharing its
+// stream, which then connect on their own.
+func (r *Recorder) unshareIngest() {
+	r.mu.Lock()
+	owner, sharers := r.owner, r.sharers
+	r.owner, r.sharers = nil, nil
+	r.mu.Unlock()
+
+	if owner != nil {
+		owner.mu.Lock()
+		owner.sharers = slices.DeleteFunc(owner.sharers, func(s *Recorder) bool { return s == r })
+		owner.mu.Unlock()
+	}
+	for _, s := range sharers {
+		s.mu.Lock()
+		s.owner = nil
+		s.mu.Unlock()
+		s.signalWake()
+	}
+}
+
+func (r *Recorder) ingestOwner() *Recorder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.owner
+}
+
+// IngestOwner returns the camera whose stream r records from, or "" if it
+// has its own connection.
+func (r *Recorder) IngestOwner() string {
+	if owner := r.ingestOwner(); owner != nil {
+		return owner.cameraName
+	}
+	return ""
+}
+
+func (r *Recorder) followOwner() {
+	owner := r.ingestOwner()
+	if owner == nil {
+		return
+	}
+
+	state := owner.State()
+	var err error
+	switch {
+	case r.IsPaused():
+		state = StatePaused
+	case state == StateStopped:
+		state = StateIdle
+	case state.IsDown():
+		err = owner.GetLastError()
+	}
+	r.setState(state, err)
+}
+
+// shareSegment files a copy of a finished segment under every running
+// recorder that shares r's stream.
+func (r *Recorder) shareSegment(seg RecordingSegment) {
+	r.mu.Lock()
+	sharers := slices.Clone(r.sharers)
+	spool := r.spool
+	r.mu.Unlock()
+
+	for _, s := range sharers {
+		if !s.IsRunning() || s.IsPaused() {
+			continue
+		}
+
+		dir := s.outputDir
+		if spool.owns(seg.Path) {
+			dir = spool.cameraDir(s.cameraName)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Warning: [%s] Failed to share segment %s: %v", s.cameraName, seg.Filename, err)
+			continue
+		}
+		name, err := storage.ClaimName(dir, s.segmentFilename(seg.StartedAt))
+		if err != nil {
+			log.Printf("Warning: [%s] Failed to share segment %s: %v", s.cameraName, seg.Filename, err)
+			continue
+		}
+		shared := seg
+		shared.CameraName = s.cameraName
+		shared.Filename = name
+		shared.Path = filepath.Join(dir, name)
+		if err := linkFile(seg.Path, shared.Path); err != nil {
+			os.Remove(shared.Path)
+			log.Printf("Warning: [%s] Failed to share segment %s: %v", s.cameraName, seg.Filename, err)
+			continue
+		}
+		s.deliver(shared)
+	}
+}
+
+// linkFile hard-links src to dst, copying it where links are not supported.
+// dst is replaced, as it is the placeholder made by storage.ClaimName.
+func linkFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp := dst + ".part"
+	os.Remove(tmp)
+	if err := os.Link(src, tmp); err == nil {
+		if err := os.Rename(tmp, dst); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return nil
+	}
+	if err := copyFile(src, dst); err != nil {
+		return fmt.Errorf("failed to copy: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package recorder
+
+import (
+	"context"
+	"maps"
+	"time"
+)
+
+// statusInterval is how often the status snapshot is refreshed besides on
+// every state change, for what changes without one, like uptime and usage.
+const statusInterval = time.Second
+
+// Start keeps a snapshot of every recorder's status up to date until ctx
+// ends, so GetStatus returns at once instead of waiting for the locks that
+// starting and stopping cameras hold.
+func (rm *RecorderManager) Start(ctx context.Context) {
+	go rm.snapshotStatus(ctx)
+}
+
+func (rm *RecorderManager) snapshotStatus(ctx context.Context) {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	for {
+		status := rm.collectStatus()
+		rm.status.Store(&status)
+
+		select {
+		case <-ctx.Done():
+			rm.status.Store(nil)
+			return
+		case <-ticker.C:
+		case <-rm.changed:
+		}
+	}
+}
+
+// statusChanged asks for a fresh status snapshot.
+func (rm *RecorderManager) statusChanged() {
+	select {
+	case rm.changed <- struct{}{}:
+	default:
+	}
+}
+
+// GetStatus returns the status of every recorder from the snapshot, or
+// collects it when the manager is not started.
+func (rm *RecorderManager) GetStatus() map[string]RecorderStatus {
+	if status := rm.status.Load(); status != nil {
+		return maps.Clone(*status)
+	}
+	return rm.collectStatus()
+}
@@ -0,0 +1,169 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lets-vibe/cam-recorder/pkg/storage"
+)
+
+// Spool takes new segments while the recordings disk is stalled. Finished
+// segments are held back from the segment hook and moved to the recordings
+// directory, then indexed, once the disk recovers. A spool made by NewBuffer
+// is a RAM buffer instead, which takes segments all the time.
+type Spool struct {
+	dir     string
+	active  atomic.Bool
+	mu      sync.Mutex
+	pending []RecordingSegment
+	drainMu sync.Mutex
+	// limit and full are only set on a RAM buffer.
+	limit int64
+	full  chan struct{}
+}
+
+func NewSpool(dir string) *Spool {
+	return &Spool{dir: filepath.Clean(dir)}
+}
+
+func (s *Spool) Active() bool {
+	return s != nil && s.active.Load()
+}
+
+func (s *Spool) SetActive(active bool) {
+	if s != nil {
+		s.active.Store(active)
+	}
+}
+
+func (s *Spool) cameraDir(cameraName string) string {
+	return filepath.Join(s.dir, storage.CameraDirName(cameraName))
+}
+
+func (s *Spool) owns(path string) bool {
+	return s != nil && strings.HasPrefix(path, s.dir+string(filepath.Separator))
+}
+
+func (s *Spool) hold(seg RecordingSegment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, seg)
+}
+
+// holds reports whether the segment at path is waiting to be moved.
+func (s *Spool) holds(path string) bool {
+	if !s.owns(path) {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.ContainsFunc(s.pending, func(seg RecordingSegment) bool {
+		return seg.Path == path
+	})
+}
+
+// drain moves held segments into outputDir and passes them to hook. It stops
+// at the first failure, leaving the rest for the next attempt.
+func (s *Spool) drain(outputDir string, hook SegmentHook) (int, error) {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	moved := 0
+	for {
+		// Moving a segment takes a while on a slow disk, and recorders
+		// holding new segments must not wait for it.
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.mu.Unlock()
+			return moved, nil
+		}
+		seg := s.pending[0]
+		s.mu.Unlock()
+
+		dir := filepath.Join(outputDir, storage.CameraDirName(seg.CameraName))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return moved, fmt.Errorf("failed to move spooled segment %s: %w", seg.Filename, err)
+		}
+		// A segment recorded while the disk was stalled may share its
+		// name with one that reached the disk.
+		name, err := storage.ClaimName(dir, seg.Filename)
+		if err != nil {
+			return moved, fmt.Errorf("failed to move spooled segment %s: %w", seg.Filename, err)
+		}
+		dest := filepath.Join(dir, name)
+		if err := moveFile(seg.Path, dest); err != nil {
+			os.Remove(dest)
+			return moved, fmt.Errorf("failed to move spooled segment %s: %w", seg.Filename, err)
+		}
+		closeJournal(journalPath(outputDir, seg.CameraName, seg.Filename))
+		seg.Filename, seg.Path = name, dest
+		s.mu.Lock()
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+		moved++
+
+		if hook != nil {
+			hook(seg)
+		}
+	}
+}
+
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	// The spool is usually on another filesystem, where rename fails.
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		log.Printf("Warning: Failed to remove spooled segment %s: %v", src, err)
+	}
+	return nil
+}
+
+// copyFile copies src to dst through a temporary file, so dst never exists
+// half-written.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
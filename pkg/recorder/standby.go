@@ -0,0 +1,29 @@
+package recorder
+
+// SetStandby holds every recorder off recording, as the standby of a failover
+// pair does while the other instance records the same cameras, or lets them
+// record again. Segments being written are finished early. Recorders stay
+// running, so their state and controls work as usual.
+func (rm *RecorderManager) SetStandby(standby bool) {
+	if rm.standby.Swap(standby) == standby {
+		return
+	}
+	for _, rec := range rm.GetAllRecorders() {
+		if standby {
+			rec.mu.Lock()
+			cmd := rec.cmd
+			rec.mu.Unlock()
+			interrupt(cmd)
+		}
+		rec.signalWake()
+	}
+}
+
+// Standby reports whether SetStandby holds the recorders off.
+func (rm *RecorderManager) Standby() bool {
+	return rm.standby.Load()
+}
+
+func (r *Recorder) inStandby() bool {
+	return r.standby != nil && r.standby.Load()
+}
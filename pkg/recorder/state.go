@@ -0,0 +1,104 @@
+package recorder
+
+import "time"
+
+type State string
+
+const (
+	StateStopped    State = "stopped"
+	StateIdle       State = "idle"
+	StatePaused     State = "paused"
+	StateQueued     State = "queued"
+	StateConnecting State = "connecting"
+	StateRecording  State = "recording"
+	StateRetrying   State = "retrying"
+	StateFailed     State = "failed"
+	// StateCircuitOpen stops retrying a camera that kept failing until it
+	// accepts a connection again.
+	StateCircuitOpen State = "circuit_open"
+	// StateStandby holds a recorder off while the other instance of a
+	// failover pair records.
+	StateStandby State = "standby"
+)
+
+const maxTransitions = 20
+
+func (s State) IsDown() bool {
+	return s == StateRetrying || s == StateFailed || s == StateCircuitOpen
+}
+
+type Transition struct {
+	From  State     `json:"from"`
+	To    State     `json:"to"`
+	At    time.Time `json:"at"`
+	Error string    `json:"error,omitempty"`
+}
+
+func (r *Recorder) setState(state State, err error) {
+	r.mu.Lock()
+	if r.state == StateStopped {
+		r.mu.Unlock()
+		return
+	}
+	hook, prev, changed := r.transition(state, err)
+	r.mu.Unlock()
+
+	if changed && hook != nil {
+		hook(r.cameraName, prev, state, err)
+	}
+}
+
+func (r *Recorder) transition(state State, err error) (StatusHook, State, bool) {
+	var errMsg string
+	if err != nil {
+		errMsg = err.Error()
+	}
+
+	if r.state == state && r.stateErr == errMsg {
+		return nil, r.state, false
+	}
+
+	prev := r.state
+	now := time.Now()
+	r.state = state
+	r.stateErr = errMsg
+	r.stateSince = now
+	if state == StateRecording {
+		r.retryStatus = nil
+	}
+
+	r.transitions = append(r.transitions, Transition{From: prev, To: state, At: now, Error: errMsg})
+	if len(r.transitions) > maxTransitions {
+		r.transitions = r.transitions[len(r.transitions)-maxTransitions:]
+	}
+
+	if r.changed != nil {
+		select {
+		case r.changed <- struct{}{}:
+		default:
+		}
+	}
+
+	return r.statusHook, prev, true
+}
+
+func (r *Recorder) State() State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state
+}
+
+func (r *Recorder) StateSince() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stateSince
+}
+
+func (r *Recorder) Transitions() []Transition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	transitions := make([]Transition, len(r.transitions))
+	copy(transitions, r.transitions)
+	return transitions
+}
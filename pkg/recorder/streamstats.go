@@ -0,0 +1,126 @@
+package recorder
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Stream quality ratings of a segment.
+const (
+	RatingGood     = "good"
+	RatingDegraded = "degraded"
+	RatingPoor     = "poor"
+)
+
+// A segment that lost at least this much is rated poor; any loss below it
+// makes it degraded.
+const (
+	poorMissedPackets   = 100
+	poorDiscontinuities = 5
+	poorDroppedPercent  = 2
+)
+
+// StreamStats counts what went missing while a segment was recorded, as
+// reported by ffmpeg.
+type StreamStats struct {
+	Frames          int `json:"frames"`
+	DroppedFrames   int `json:"dropped_frames"`
+	MissedPackets   int `json:"missed_packets"`
+	Discontinuities int `json:"discontinuities"`
+}
+
+// Rating sums the stats up as RatingGood, RatingDegraded or RatingPoor.
+func (s StreamStats) Rating() string {
+	switch {
+	case s.MissedPackets >= poorMissedPackets,
+		s.Discontinuities >= poorDiscontinuities,
+		s.Frames > 0 && s.DroppedFrames*100 >= s.Frames*poorDroppedPercent:
+		return RatingPoor
+	case s.MissedPackets > 0, s.Discontinuities > 0, s.DroppedFrames > 0:
+		return RatingDegraded
+	}
+	return RatingGood
+}
+
+var (
+	missedPacketsPattern = regexp.MustCompile(`missed (\d+) packets`)
+	progressFramePattern = regexp.MustCompile(`frame=\s*(\d+)`)
+	progressDropPattern  = regexp.MustCompile(`drop=\s*(\d+)`)
+
+	// Log messages meaning the stream skipped or jumped.
+	discontinuityMessages = []string{
+		"non-monotonous dts",
+		"non monotonically increasing dts",
+		"discontinuity",
+		"max delay reached",
+		"packet corrupt",
+		"corrupt decoded frame",
+	}
+)
+
+// statsWriter collects StreamStats from ffmpeg's stderr. Progress lines
+// end in a carriage return, log messages in a newline.
+type statsWriter struct {
+	mu    sync.Mutex
+	line  []byte
+	stats StreamStats
+}
+
+const maxStatsLine = 4096
+
+func (w *statsWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	rest := p
+	for len(rest) > 0 {
+		end := bytes.IndexAny(rest, "\r\n")
+		if end < 0 {
+			if len(w.line)+len(rest) <= maxStatsLine {
+				w.line = append(w.line, rest...)
+			}
+			break
+		}
+		w.line = append(w.line, rest[:end]...)
+		w.parse(string(w.line))
+		w.line = w.line[:0]
+		rest = rest[end+1:]
+	}
+	return len(p), nil
+}
+
+func (w *statsWriter) parse(line string) {
+	if m := missedPacketsPattern.FindStringSubmatch(line); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		w.stats.MissedPackets += n
+		return
+	}
+	if m := progressFramePattern.FindStringSubmatch(line); m != nil {
+		w.stats.Frames, _ = strconv.Atoi(m[1])
+		if m := progressDropPattern.FindStringSubmatch(line); m != nil {
+			w.stats.DroppedFrames, _ = strconv.Atoi(m[1])
+		}
+		return
+	}
+
+	lower := strings.ToLower(line)
+	for _, msg := range discontinuityMessages {
+		if strings.Contains(lower, msg) {
+			w.stats.Discontinuities++
+			return
+		}
+	}
+}
+
+func (w *statsWriter) Stats() StreamStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.line) > 0 {
+		w.parse(string(w.line))
+		w.line = w.line[:0]
+	}
+	return w.stats
+}
@@ -0,0 +1,35 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Thumbnail decodes the frame at offset into a JPEG scaled to width.
+func Thumbnail(ctx context.Context, path string, offset time.Duration, width int) ([]byte, error) {
+	cmd := ffmpegCommand(ctx,
+		"-ss", fmt.Sprintf("%.3f", max(offset, 0).Seconds()),
+		"-i", path,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", width),
+		"-c:v", "mjpeg",
+		"-q:v", "5",
+		"-f", "image2",
+		"-",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	frame, err := cmd.Output()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+	}
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("no frame at %s", offset)
+	}
+	return frame, nil
+}
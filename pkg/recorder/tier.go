@@ -0,0 +1,74 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Downscale re-encodes src into dst at most height pixels tall with the given
+// x264 CRF, for keeping old recordings at a fraction of their size. The
+// container follows dst's extension.
+func Downscale(ctx context.Context, src, dst string, height, crf int) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create cold tier directory: %w", err)
+	}
+
+	args := []string{
+		"-i", src,
+		"-map", "0:v",
+		"-map", "0:a?",
+		"-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", height),
+		"-c:v", "libx264",
+		"-preset", "medium",
+		"-crf", fmt.Sprint(crf),
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", "64k",
+	}
+	if strings.EqualFold(filepath.Ext(dst), ".mp4") {
+		// use_metadata_tags keeps the origin tags the segment was recorded with.
+		args = append(args, "-movflags", "+faststart+use_metadata_tags")
+	}
+	args = append(args, "-y", dst)
+
+	if output, err := ffmpegCommand(ctx, args...).CombinedOutput(); err != nil {
+		os.Remove(dst)
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
+
+// Keyframes re-encodes src into dst keeping only its keyframes, at their
+// original times, for archiving years of recordings as a sequence of stills.
+// Audio is dropped. The container follows dst's extension.
+func Keyframes(ctx context.Context, src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create keyframes directory: %w", err)
+	}
+
+	args := []string{
+		"-skip_frame", "nokey",
+		"-i", src,
+		"-map", "0:v",
+		"-fps_mode", "passthrough",
+		"-c:v", "libx264",
+		"-preset", "medium",
+		"-crf", "28",
+		"-pix_fmt", "yuv420p",
+	}
+	if strings.EqualFold(filepath.Ext(dst), ".mp4") {
+		args = append(args, "-movflags", "+faststart+use_metadata_tags")
+	}
+	args = append(args, "-y", dst)
+
+	if output, err := ffmpegCommand(ctx, args...).CombinedOutput(); err != nil {
+		os.Remove(dst)
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	usageInterval    = 5 * time.Second
+	overLimitSamples = 3
+	limitRetryDelay  = 5 * time.Second
+	// Linux reports process times in USER_HZ, which is 100 on every
+	// architecture Go supports.
+	clockTicks = 100
+)
+
+type ProcessUsage struct {
+	PID        int       `json:"pid"`
+	CPUPercent float64   `json:"cpu_percent"`
+	RSSBytes   uint64    `json:"rss_bytes"`
+	SampledAt  time.Time `json:"sampled_at"`
+}
+
+type ResourceLimits struct {
+	MaxCPUPercent float64
+	MaxRSSBytes   uint64
+}
+
+func (l ResourceLimits) exceeded(u ProcessUsage) string {
+	if l.MaxCPUPercent > 0 && u.CPUPercent > l.MaxCPUPercent {
+		return fmt.Sprintf("CPU %.0f%% > %.0f%%", u.CPUPercent, l.MaxCPUPercent)
+	}
+	if l.MaxRSSBytes > 0 && u.RSSBytes > l.MaxRSSBytes {
+		return fmt.Sprintf("RSS %.1f MB > %d MB", float64(u.RSSBytes)/(1<<20), l.MaxRSSBytes>>20)
+	}
+	return ""
+}
+
+type procSampler struct {
+	pid       int
+	lastTicks uint64
+	lastAt    time.Time
+}
+
+func (p *procSampler) sample() (ProcessUsage, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", p.pid))
+	if err != nil {
+		return ProcessUsage{}, err
+	}
+
+	// The command name may contain spaces, so fields are counted from the
+	// closing parenthesis: utime and stime are fields 14 and 15, rss is 24.
+	stat := string(data)
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return ProcessUsage{}, fmt.Errorf("malformed /proc/%d/stat", p.pid)
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return ProcessUsage{}, fmt.Errorf("malformed /proc/%d/stat", p.pid)
+	}
+
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	rssPages, _ := strconv.ParseUint(fields[21], 10, 64)
+
+	now := time.Now()
+	ticks := utime + stime
+	usage := ProcessUsage{
+		PID:       p.pid,
+		RSSBytes:  rssPages * uint64(os.Getpagesize()),
+		SampledAt: now,
+	}
+	if !p.lastAt.IsZero() && ticks >= p.lastTicks {
+		elapsed := now.Sub(p.lastAt).Seconds()
+		if elapsed > 0 {
+			usage.CPUPercent = float64(ticks-p.lastTicks) / clockTicks / elapsed * 100
+		}
+	}
+	p.lastTicks = ticks
+	p.lastAt = now
+
+	return usage, nil
+}
+
+func (r *Recorder) Usage() (ProcessUsage, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.usage, r.usage.PID != 0
+}
+
+func (r *Recorder) ResourceRestarts() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resourceRestarts
+}
+
+func (r *Recorder) setUsage(usage ProcessUsage) {
+	r.mu.Lock()
+	r.usage = usage
+	r.mu.Unlock()
+}
@@ -0,0 +1,140 @@
+package recorder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Watermark corners.
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right"
+)
+
+const watermarkMargin = 16
+
+// Watermark is text and a logo image stamped onto copies of recordings. The
+// text goes in Position and the logo in the other corner of the same edge.
+type Watermark struct {
+	Text     string
+	Logo     string
+	Position string
+	FontSize int
+}
+
+func (w Watermark) Enabled() bool {
+	return w.Text != "" || w.Logo != ""
+}
+
+// ValidWatermarkPosition reports whether p names a corner.
+func ValidWatermarkPosition(p string) bool {
+	switch p {
+	case WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight:
+		return true
+	}
+	return false
+}
+
+// Render writes a stamped copy of src to dst, re-encoding the video and
+// copying the audio. The container follows dst's extension.
+func (w Watermark) Render(ctx context.Context, src, dst string) error {
+	args := []string{"-i", src}
+	filters, label := []string{}, "[0:v]"
+
+	top := strings.HasPrefix(w.Position, "top")
+	left := strings.HasSuffix(w.Position, "left")
+
+	if w.Text != "" {
+		// drawtext reads the text from a file so it needs no escaping.
+		textFile, err := os.CreateTemp("", "watermark-*.txt")
+		if err != nil {
+			return fmt.Errorf("failed to write watermark text: %w", err)
+		}
+		defer os.Remove(textFile.Name())
+		_, err = textFile.WriteString(w.Text)
+		if cerr := textFile.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write watermark text: %w", err)
+		}
+
+		x, y := fmt.Sprint(watermarkMargin), fmt.Sprint(watermarkMargin)
+		if !left {
+			x = fmt.Sprintf("w-tw-%d", watermarkMargin)
+		}
+		if !top {
+			y = fmt.Sprintf("h-th-%d", watermarkMargin)
+		}
+		filters = append(filters, fmt.Sprintf(
+			"%sdrawtext=textfile=%s:expansion=none:fontsize=%d:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=8:x=%s:y=%s[text]",
+			label, filterPath(textFile.Name()), w.FontSize, x, y))
+		label = "[text]"
+	}
+
+	if w.Logo != "" {
+		args = append(args, "-i", w.Logo)
+		// The logo sits opposite the text and is scaled to a fifth of the
+		// video's width.
+		x, y := fmt.Sprint(watermarkMargin), fmt.Sprint(watermarkMargin)
+		if left {
+			x = fmt.Sprintf("main_w-overlay_w-%d", watermarkMargin)
+		}
+		if !top {
+			y = fmt.Sprintf("main_h-overlay_h-%d", watermarkMargin)
+		}
+		filters = append(filters,
+			fmt.Sprintf("[1:v]%sscale2ref=w=main_w/5:h=ow/a[logo][base]", label),
+			fmt.Sprintf("[base][logo]overlay=%s:%s[stamped]", x, y))
+		label = "[stamped]"
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create watermark directory: %w", err)
+	}
+
+	args = append(args,
+		"-filter_complex", strings.Join(filters, ";"),
+		"-map", label,
+		"-map", "0:a?",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "23",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "copy",
+	)
+	if strings.EqualFold(filepath.Ext(dst), ".mp4") {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args, "-y", dst)
+
+	if output, err := ffmpegCommand(ctx, args...).CombinedOutput(); err != nil {
+		os.Remove(dst)
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return fmt.Errorf("ffmpeg: %w: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
+
+// filterPath escapes a path for use as a filter option inside a filtergraph,
+// which takes one level of escaping for the option and one for the graph.
+func filterPath(p string) string {
+	option := escapeChars(filepath.ToSlash(p), `\':`)
+	return escapeChars(option, `\'[],;`)
+}
+
+func escapeChars(s, chars string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,180 @@
+// Package schedule parses weekly recording windows such as weekdays from
+// 22:00 to 06:00.
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+type Spec struct {
+	Days  []string `mapstructure:"days" yaml:"days,omitempty" json:"days,omitempty"`
+	Start string   `mapstructure:"start" yaml:"start" json:"start"`
+	End   string   `mapstructure:"end" yaml:"end" json:"end"`
+}
+
+type Window struct {
+	Days  []time.Weekday
+	Start time.Duration
+	End   time.Duration
+}
+
+type Schedule struct {
+	Windows []Window
+}
+
+func Parse(windows []Spec) (*Schedule, error) {
+	if len(windows) == 0 {
+		return nil, nil
+	}
+
+	s := &Schedule{}
+	for i, w := range windows {
+		window, err := parseWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("schedule window %d: %w", i+1, err)
+		}
+		s.Windows = append(s.Windows, window)
+	}
+	return s, nil
+}
+
+func parseWindow(w Spec) (Window, error) {
+	var window Window
+
+	if len(w.Days) == 0 {
+		window.Days = []time.Weekday{
+			time.Sunday, time.Monday, time.Tuesday, time.Wednesday,
+			time.Thursday, time.Friday, time.Saturday,
+		}
+	}
+	for _, d := range w.Days {
+		name := strings.ToLower(strings.TrimSpace(d))
+		if len(name) > 3 {
+			name = name[:3]
+		}
+		day, ok := weekdays[name]
+		if !ok {
+			return window, fmt.Errorf("invalid day %q", d)
+		}
+		window.Days = append(window.Days, day)
+	}
+
+	var err error
+	if window.Start, err = parseClock(w.Start); err != nil {
+		return window, fmt.Errorf("invalid start: %w", err)
+	}
+	if window.End, err = parseClock(w.End); err != nil {
+		return window, fmt.Errorf("invalid end: %w", err)
+	}
+	if window.Start == window.End {
+		return window, fmt.Errorf("start and end are equal")
+	}
+
+	return window, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w Window) hasDay(day time.Weekday) bool {
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Window) Overnight() bool {
+	return w.End < w.Start
+}
+
+func (w Window) Occurrence(day time.Time) (time.Time, time.Time) {
+	start := day.Add(w.Start)
+	end := day.Add(w.End)
+	if w.Overnight() {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func (s *Schedule) ActiveUntil(t time.Time) (time.Time, bool) {
+	if s == nil {
+		return time.Time{}, true
+	}
+
+	var until time.Time
+	active := false
+	today := midnight(t)
+
+	for _, w := range s.Windows {
+		for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+			if !w.hasDay(day.Weekday()) {
+				continue
+			}
+			start, end := w.Occurrence(day)
+			if !t.Before(start) && t.Before(end) {
+				active = true
+				if end.After(until) {
+					until = end
+				}
+			}
+		}
+	}
+
+	return until, active
+}
+
+func (s *Schedule) Active(t time.Time) bool {
+	_, active := s.ActiveUntil(t)
+	return active
+}
+
+func (s *Schedule) NextStart(t time.Time) (time.Time, bool) {
+	if s == nil {
+		return t, true
+	}
+
+	var next time.Time
+	today := midnight(t)
+
+	for offset := 0; offset <= 7; offset++ {
+		day := today.AddDate(0, 0, offset)
+		for _, w := range s.Windows {
+			if !w.hasDay(day.Weekday()) {
+				continue
+			}
+			start, _ := w.Occurrence(day)
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+
+	return next, !next.IsZero()
+}
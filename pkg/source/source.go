@@ -0,0 +1,250 @@
+// Package source parses the URLs of camera streams, local capture devices and
+// demo sources into the ffmpeg input arguments that read them, and redacts
+// their credentials.
+package source
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	KindRTSP         = "rtsp"
+	KindAVFoundation = "avfoundation"
+	// KindMPEGTS is an MPEG-TS stream over TCP, as served by the shared
+	// ingest relay.
+	KindMPEGTS = "mpegts"
+	// KindDemo is a synthetic test picture and tone generated by ffmpeg.
+	KindDemo = "demo"
+)
+
+const (
+	avfoundationPrefix = "avfoundation:"
+	mpegtsPrefix       = "tcp://"
+	demoPrefix         = "demo:"
+)
+
+const (
+	defaultFramerate = "30"
+
+	defaultDemoPattern   = "testsrc2"
+	defaultDemoFramerate = "15"
+	defaultDemoSize      = "1280x720"
+)
+
+// demoPatterns are the ffmpeg test sources a demo camera can show.
+var demoPatterns = []string{"testsrc", "testsrc2", "smptebars", "smptehdbars", "rgbtestsrc", "mandelbrot"}
+
+type Source struct {
+	Kind string
+	URL  string
+
+	// Device is the avfoundation device spec, "<video>[:<audio>]", where
+	// each side is an index or device name (see ffmpeg -f avfoundation
+	// -list_devices true -i "").
+	Device    string
+	Framerate string
+	VideoSize string
+	// Pattern is the ffmpeg test source of a demo camera.
+	Pattern string
+}
+
+// Parse recognises "avfoundation:<device>[?framerate=30&video_size=1280x720]"
+// for cameras attached to the Mac running the recorder, and
+// "demo:[?pattern=testsrc2&framerate=15&video_size=1280x720]" for a camera
+// that needs no hardware. It reads tcp:// URLs as MPEG-TS. Everything else is
+// handed to ffmpeg as a network URL.
+func Parse(rawURL string) (Source, error) {
+	if strings.HasPrefix(rawURL, mpegtsPrefix) {
+		return Source{Kind: KindMPEGTS, URL: rawURL}, nil
+	}
+	if strings.HasPrefix(rawURL, demoPrefix) {
+		return parseDemo(rawURL)
+	}
+	if !strings.HasPrefix(rawURL, avfoundationPrefix) {
+		return Source{Kind: KindRTSP, URL: rawURL}, nil
+	}
+
+	spec, rawQuery, _ := strings.Cut(strings.TrimPrefix(rawURL, avfoundationPrefix), "?")
+	spec = strings.TrimPrefix(spec, "//")
+	if spec == "" {
+		return Source{}, fmt.Errorf("avfoundation source needs a device, e.g. avfoundation:0")
+	}
+	device, err := url.PathUnescape(spec)
+	if err != nil {
+		return Source{}, fmt.Errorf("invalid avfoundation device %q: %w", spec, err)
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Source{}, fmt.Errorf("invalid avfoundation options: %w", err)
+	}
+
+	src := Source{
+		Kind:      KindAVFoundation,
+		URL:       rawURL,
+		Device:    device,
+		Framerate: query.Get("framerate"),
+		VideoSize: query.Get("video_size"),
+	}
+	if src.Framerate == "" {
+		src.Framerate = defaultFramerate
+	}
+	return src, nil
+}
+
+func parseDemo(rawURL string) (Source, error) {
+	_, rawQuery, _ := strings.Cut(strings.TrimPrefix(rawURL, demoPrefix), "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Source{}, fmt.Errorf("invalid demo options: %w", err)
+	}
+
+	src := Source{
+		Kind:      KindDemo,
+		URL:       rawURL,
+		Pattern:   cmp.Or(query.Get("pattern"), defaultDemoPattern),
+		Framerate: cmp.Or(query.Get("framerate"), defaultDemoFramerate),
+		VideoSize: cmp.Or(query.Get("video_size"), defaultDemoSize),
+	}
+	if !slices.Contains(demoPatterns, src.Pattern) {
+		return Source{}, fmt.Errorf("unknown demo pattern %q, expected one of %s", src.Pattern, strings.Join(demoPatterns, ", "))
+	}
+	if _, err := strconv.ParseFloat(src.Framerate, 64); err != nil {
+		return Source{}, fmt.Errorf("invalid demo framerate %q", src.Framerate)
+	}
+	if w, h, ok := strings.Cut(src.VideoSize, "x"); !ok || !isNumber(w) || !isNumber(h) {
+		return Source{}, fmt.Errorf("invalid demo video_size %q, expected WIDTHxHEIGHT", src.VideoSize)
+	}
+	return src, nil
+}
+
+func isNumber(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0
+}
+
+// IsLocal reports whether the video is produced on this machine rather than
+// received from a camera, so it must be encoded and has no clock to check.
+func (s Source) IsLocal() bool {
+	return s.Kind == KindAVFoundation || s.Kind == KindDemo
+}
+
+// defaultPorts are the ports of URL schemes cameras are reached by.
+var defaultPorts = map[string]string{"rtsp": "554", "rtsps": "322", "http": "80", "https": "443", "rtmp": "1935"}
+
+// Address returns the host:port a network source connects to, or false for
+// local devices and URLs it cannot tell the port of.
+func (s Source) Address() (string, bool) {
+	if s.IsLocal() {
+		return "", false
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+	port := u.Port()
+	if port == "" {
+		if port = defaultPorts[strings.ToLower(u.Scheme)]; port == "" {
+			return "", false
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), true
+}
+
+// InputArgs returns the ffmpeg arguments that open the source, ending with
+// the -i flag and its value.
+func (s Source) InputArgs() []string {
+	switch s.Kind {
+	case KindAVFoundation:
+		args := []string{"-f", "avfoundation", "-framerate", s.Framerate}
+		if s.VideoSize != "" {
+			args = append(args, "-video_size", s.VideoSize)
+		}
+		return append(args, "-i", s.Device)
+	case KindDemo:
+		// -re paces the generated frames like a live camera.
+		return []string{
+			"-re", "-f", "lavfi", "-i", fmt.Sprintf("%s=size=%s:rate=%s", s.Pattern, s.VideoSize, s.Framerate),
+			"-re", "-f", "lavfi", "-i", "sine=frequency=1000:beep_factor=4:sample_rate=48000",
+		}
+	case KindMPEGTS:
+		return []string{"-f", "mpegts", "-i", s.URL}
+	default:
+		return []string{"-rtsp_transport", "tcp", "-i", s.URL}
+	}
+}
+
+// NetworkArgs returns the socket timeout options that only apply to network
+// sources.
+func (s Source) NetworkArgs() []string {
+	if s.IsLocal() {
+		return nil
+	}
+	return []string{"-timeout", "30000000", "-rw_timeout", "10000000"}
+}
+
+func InputArgs(rawURL string) []string {
+	src, err := Parse(rawURL)
+	if err != nil {
+		return []string{"-rtsp_transport", "tcp", "-i", rawURL}
+	}
+	return src.InputArgs()
+}
+
+func IsLocal(rawURL string) bool {
+	src, err := Parse(rawURL)
+	return err == nil && src.IsLocal()
+}
+
+// secretParams are query parameters some cameras take credentials in.
+var secretParams = []string{"password", "passwd", "pass", "pwd", "token", "key", "auth"}
+
+// Redact hides the password of a source URL, the values of query
+// parameters that carry credentials and the stream key ending an RTMP URL,
+// so it can be logged or stored. Anything that is not a URL is returned as
+// is.
+func Redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Opaque != "" {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	if app, _, ok := CutStreamKey(u); ok {
+		u.Path, u.RawPath = app+"xxxxx", ""
+	}
+	if query := u.Query(); u.RawQuery != "" {
+		changed := false
+		for name := range query {
+			if slices.Contains(secretParams, strings.ToLower(name)) {
+				query.Set(name, "xxxxx")
+				changed = true
+			}
+		}
+		if changed {
+			u.RawQuery = query.Encode()
+		}
+	}
+	return u.String()
+}
+
+// CutStreamKey splits an rtmp:// or rtmps:// URL, like YouTube's
+// rtmp://a.rtmp.youtube.com/live2/<key>, into the application path, ending
+// in a slash, and the stream key after it.
+func CutStreamKey(u *url.URL) (string, string, bool) {
+	if u.Scheme != "rtmp" && u.Scheme != "rtmps" {
+		return "", "", false
+	}
+	i := strings.LastIndexByte(u.Path, '/')
+	if i <= 0 || i == len(u.Path)-1 {
+		return "", "", false
+	}
+	return u.Path[:i+1], u.Path[i+1:], true
+}
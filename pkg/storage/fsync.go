@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Fsync policies. ffmpeg never syncs what it writes, so without one a
+// finished segment can sit in the page cache for a while and be lost, or
+// left truncated, on a power cut.
+const (
+	// SyncOff leaves writing segments out to the operating system.
+	SyncOff = "off"
+	// SyncSegment syncs each segment as soon as it is finished.
+	SyncSegment = "segment"
+	// SyncPeriodic syncs the segments finished since the last pass every
+	// Interval, in one batch.
+	SyncPeriodic = "periodic"
+	// SyncClose syncs the segments finished since the start once, when the
+	// recorder shuts down.
+	SyncClose = "close"
+)
+
+// SyncOptions says when finished segments are synced to disk. Syncing less
+// often means fewer small writes, which wear flash storage such as SD cards,
+// at the cost of losing more on a power cut. With Dirs, the directory of each
+// synced segment is synced too, so the file's name, or the rename that moved
+// it there, is not lost either.
+type SyncOptions struct {
+	Policy   string        `mapstructure:"policy" yaml:"policy"`
+	Interval time.Duration `mapstructure:"interval" yaml:"interval"`
+	Dirs     bool          `mapstructure:"dirs" yaml:"dirs"`
+}
+
+// ValidSyncPolicy reports whether policy is one of the fsync policies.
+func ValidSyncPolicy(policy string) bool {
+	switch policy {
+	case SyncOff, SyncSegment, SyncPeriodic, SyncClose:
+		return true
+	}
+	return false
+}
+
+type SyncStats struct {
+	Policy    string    `json:"policy"`
+	Interval  string    `json:"interval,omitempty"`
+	Dirs      bool      `json:"dirs"`
+	Pending   int       `json:"pending"`
+	Synced    int64     `json:"synced"`
+	Errors    int64     `json:"errors"`
+	LastSync  time.Time `json:"last_sync,omitzero"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Syncer syncs finished segments to disk following a SyncOptions.
+type Syncer struct {
+	opts    SyncOptions
+	mu      sync.Mutex
+	pending map[string]struct{}
+	stats   SyncStats
+}
+
+func NewSyncer(opts SyncOptions) *Syncer {
+	if opts.Policy == "" {
+		opts.Policy = SyncOff
+	}
+	stats := SyncStats{Policy: opts.Policy, Dirs: opts.Dirs}
+	if opts.Policy == SyncPeriodic {
+		stats.Interval = opts.Interval.String()
+	}
+	return &Syncer{
+		opts:    opts,
+		pending: make(map[string]struct{}),
+		stats:   stats,
+	}
+}
+
+// Start syncs the pending segments every Interval under the periodic policy.
+func (s *Syncer) Start(ctx context.Context) {
+	if s == nil || s.opts.Policy != SyncPeriodic || s.opts.Interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Flush()
+			}
+		}
+	}()
+}
+
+// Add is called with each finished segment. It is synced at once or kept for
+// the next pass, depending on the policy.
+func (s *Syncer) Add(path string) {
+	if s == nil {
+		return
+	}
+	switch s.opts.Policy {
+	case SyncSegment:
+		s.sync([]string{path})
+	case SyncPeriodic, SyncClose:
+		s.mu.Lock()
+		s.pending[path] = struct{}{}
+		s.stats.Pending = len(s.pending)
+		s.mu.Unlock()
+	}
+}
+
+// Flush syncs every pending segment now. Call it on shutdown, after the
+// recorders have stopped.
+func (s *Syncer) Flush() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	paths := make([]string, 0, len(s.pending))
+	for path := range s.pending {
+		paths = append(paths, path)
+	}
+	clear(s.pending)
+	s.stats.Pending = 0
+	s.mu.Unlock()
+
+	if len(paths) > 0 {
+		s.sync(paths)
+	}
+}
+
+func (s *Syncer) Stats() SyncStats {
+	if s == nil {
+		return SyncStats{Policy: SyncOff}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// sync syncs each file, then each of their directories once. Files removed
+// meanwhile, e.g. by retention, are skipped.
+func (s *Syncer) sync(paths []string) {
+	var synced, failed int64
+	var lastErr error
+	dirs := make(map[string]struct{})
+	for _, path := range paths {
+		if err := syncPath(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			failed++
+			lastErr = err
+			continue
+		}
+		synced++
+		dirs[filepath.Dir(path)] = struct{}{}
+	}
+	if s.opts.Dirs && runtime.GOOS != "windows" {
+		for dir := range dirs {
+			if err := syncPath(dir); err != nil && !os.IsNotExist(err) {
+				failed++
+				lastErr = err
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.stats.Synced += synced
+	s.stats.Errors += failed
+	s.stats.LastSync = time.Now()
+	if lastErr != nil {
+		s.stats.LastError = lastErr.Error()
+	}
+	s.mu.Unlock()
+
+	if lastErr != nil {
+		log.Printf("Warning: %v", lastErr)
+	}
+}
+
+func syncPath(path string) error {
+	// Windows only flushes files opened for writing, and cannot sync
+	// directories at all.
+	flag := os.O_RDONLY
+	if runtime.GOOS == "windows" {
+		flag = os.O_RDWR
+	}
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	probeFile     = ".write-probe"
+	benchmarkFile = ".benchmark"
+	probeSize     = 256 << 10
+	benchmarkSync = 64 << 10
+)
+
+// StallHook is called when the disk starts or stops stalling.
+type StallHook func(stalled bool, latency time.Duration, err error)
+
+type WriteLatencyStats struct {
+	Samples     int       `json:"samples"`
+	LastMs      float64   `json:"last_ms"`
+	AvgMs       float64   `json:"avg_ms"`
+	MaxMs       float64   `json:"max_ms"`
+	Stalls      int       `json:"stalls"`
+	Stalled     bool      `json:"stalled"`
+	StalledAt   time.Time `json:"stalled_at,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+	ThresholdMs float64   `json:"threshold_ms"`
+}
+
+// DiskMonitor periodically writes and syncs a small file in the recordings
+// directory. A card or disk that takes seconds to accept a write drops or
+// corrupts segments long before it fails outright.
+type DiskMonitor struct {
+	cfg  DiskOptions
+	dir  string
+	mu   sync.Mutex
+	hook StallHook
+
+	stats   WriteLatencyStats
+	slow    int
+	healthy int
+}
+
+func NewDiskMonitor(cfg DiskOptions, dir string) *DiskMonitor {
+	return &DiskMonitor{
+		cfg:   cfg,
+		dir:   dir,
+		stats: WriteLatencyStats{ThresholdMs: ms(cfg.StallThreshold)},
+	}
+}
+
+func (d *DiskMonitor) SetStallHook(hook StallHook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hook = hook
+}
+
+func (d *DiskMonitor) Stats() WriteLatencyStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+func (d *DiskMonitor) Start(ctx context.Context) {
+	if d == nil || d.cfg.SampleInterval <= 0 {
+		return
+	}
+	go d.run(ctx)
+}
+
+func (d *DiskMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.SampleInterval)
+	defer ticker.Stop()
+
+	for {
+		d.sample(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample runs one probe. A probe that hangs counts as a stall after the
+// threshold and again every interval it stays blocked, so a disk that stops
+// accepting writes altogether is still reported.
+func (d *DiskMonitor) sample(ctx context.Context) {
+	type result struct {
+		latency time.Duration
+		err     error
+	}
+	done := make(chan result, 1)
+	start := time.Now()
+	go func() {
+		err := writeProbe(filepath.Join(d.dir, probeFile), probeSize)
+		done <- result{time.Since(start), err}
+	}()
+
+	wait := d.cfg.StallThreshold
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case r := <-done:
+			timer.Stop()
+			d.record(r.latency, r.err)
+			return
+		case <-timer.C:
+			d.record(time.Since(start), fmt.Errorf("write blocked for %s", time.Since(start).Round(time.Second)))
+			wait = d.cfg.SampleInterval
+		}
+	}
+}
+
+func (d *DiskMonitor) record(latency time.Duration, err error) {
+	stall := err != nil || latency > d.cfg.StallThreshold
+
+	d.mu.Lock()
+	s := &d.stats
+	s.Samples++
+	s.LastMs = ms(latency)
+	s.MaxMs = max(s.MaxMs, s.LastMs)
+	if s.Samples == 1 {
+		s.AvgMs = s.LastMs
+	} else {
+		s.AvgMs = 0.9*s.AvgMs + 0.1*s.LastMs
+	}
+	s.LastError = ""
+	if err != nil {
+		s.LastError = err.Error()
+	}
+
+	changed := false
+	if stall {
+		s.Stalls++
+		d.slow++
+		d.healthy = 0
+		if !s.Stalled && d.slow >= max(d.cfg.StallCount, 1) {
+			s.Stalled = true
+			s.StalledAt = time.Now()
+			changed = true
+		}
+	} else {
+		d.healthy++
+		d.slow = 0
+		if s.Stalled && d.healthy >= max(d.cfg.StallCount, 1) {
+			s.Stalled = false
+			s.StalledAt = time.Time{}
+			changed = true
+		}
+	}
+	stalled := s.Stalled
+	hook := d.hook
+	d.mu.Unlock()
+
+	if changed && hook != nil {
+		hook(stalled, latency, err)
+	}
+}
+
+func writeProbe(path string, size int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create probe file: %w", err)
+	}
+	defer os.Remove(path)
+	defer f.Close()
+
+	buf := make([]byte, size)
+	rand.Read(buf)
+	if _, err := f.Write(buf); err != nil {
+		return fmt.Errorf("failed to write probe file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync probe file: %w", err)
+	}
+	return nil
+}
+
+type BenchmarkResult struct {
+	Dir            string  `json:"dir"`
+	Bytes          int64   `json:"bytes"`
+	Seconds        float64 `json:"seconds"`
+	WriteMBps      float64 `json:"write_mb_per_sec"`
+	SyncSamples    int     `json:"sync_samples"`
+	SyncAvgMs      float64 `json:"sync_avg_ms"`
+	SyncMaxMs      float64 `json:"sync_max_ms"`
+	StallThreshold float64 `json:"stall_threshold_ms"`
+}
+
+// Benchmark measures sequential write throughput with size bytes of random
+// data, then the latency of small synced writes like those of a recording.
+func Benchmark(ctx context.Context, dir string, size int64, threshold time.Duration) (*BenchmarkResult, error) {
+	path := filepath.Join(dir, benchmarkFile)
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create benchmark file: %w", err)
+	}
+	defer os.Remove(path)
+	defer f.Close()
+
+	buf := make([]byte, 1<<20)
+	rand.Read(buf)
+
+	start := time.Now()
+	var written int64
+	for written < size {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		chunk := buf[:min(int64(len(buf)), size-written)]
+		n, err := f.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write benchmark file: %w", err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync benchmark file: %w", err)
+	}
+	elapsed := time.Since(start)
+
+	result := &BenchmarkResult{
+		Dir:            dir,
+		Bytes:          written,
+		Seconds:        elapsed.Seconds(),
+		WriteMBps:      float64(written) / (1 << 20) / elapsed.Seconds(),
+		StallThreshold: ms(threshold),
+	}
+
+	const syncSamples = 20
+	var total time.Duration
+	for i := 0; i < syncSamples; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		t := time.Now()
+		if _, err := f.Write(buf[:benchmarkSync]); err != nil {
+			return nil, fmt.Errorf("failed to write benchmark file: %w", err)
+		}
+		if err := f.Sync(); err != nil {
+			return nil, fmt.Errorf("failed to sync benchmark file: %w", err)
+		}
+		d := time.Since(t)
+		total += d
+		result.SyncMaxMs = max(result.SyncMaxMs, ms(d))
+	}
+	result.SyncSamples = syncSamples
+	result.SyncAvgMs = ms(total / syncSamples)
+
+	return result, nil
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,25 @@
+package storage
+
+import "time"
+
+// Options says where and how recordings are kept. Managers and recorders
+// keep the pointer they are given and read it on every use, so changing the
+// fields applies to them without a restart.
+type Options struct {
+	SegmentDuration time.Duration `mapstructure:"segment_duration" yaml:"segment_duration"`
+	RetentionDays   int           `mapstructure:"retention_days" yaml:"retention_days"`
+	OutputDir       string        `mapstructure:"output_dir" yaml:"output_dir"`
+	Format          string        `mapstructure:"format" yaml:"format"`
+	// AlignToClock starts segments on multiples of SegmentDuration counted
+	// from local midnight, e.g. :00, :05 and :10 for 5 minutes, by cutting
+	// the first segment short.
+	AlignToClock bool `mapstructure:"align_to_clock" yaml:"align_to_clock"`
+}
+
+// DiskOptions controls the write-latency probe of a DiskMonitor. A zero
+// SampleInterval disables it.
+type DiskOptions struct {
+	SampleInterval time.Duration `mapstructure:"sample_interval" yaml:"sample_interval"`
+	StallThreshold time.Duration `mapstructure:"stall_threshold" yaml:"stall_threshold"`
+	StallCount     int           `mapstructure:"stall_count" yaml:"stall_count"`
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// quotaInterval is how often quotas are enforced. It is shorter than the
+// retention cleanup, as a busy camera can outgrow its quota within an hour.
+const quotaInterval = 5 * time.Minute
+
+// SetQuotas caps the bytes of recordings kept per camera name. Cameras
+// missing from quotas are not capped.
+func (m *Manager) SetQuotas(quotas map[string]int64) {
+	byDir := make(map[string]int64, len(quotas))
+	for name, quota := range quotas {
+		if quota > 0 {
+			byDir[CameraDirName(name)] = quota
+		}
+	}
+	m.quotas.Store(&byDir)
+}
+
+func (m *Manager) enforceQuotas() {
+	quotas := m.quotas.Load()
+	if quotas == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for dir, quota := range *quotas {
+		m.enforceQuota(dir, quota)
+	}
+}
+
+// enforceQuota removes the oldest recordings in the camera directory dir
+// until the rest fit in quota. The newest is kept, as it may still be
+// written to.
+func (m *Manager) enforceQuota(dir string, quota int64) {
+	cameraPath := filepath.Join(m.opts.OutputDir, dir)
+	entries, err := os.ReadDir(cameraPath)
+	if err != nil {
+		return
+	}
+
+	var files []os.FileInfo
+	var total int64
+	for _, entry := range entries {
+		if entry.IsDir() || !m.isSegment(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+	if total <= quota {
+		return
+	}
+
+	slices.SortFunc(files, func(a, b os.FileInfo) int {
+		return a.ModTime().Compare(b.ModTime())
+	})
+
+	var deletedCount int
+	var deletedSize int64
+	for _, info := range files[:len(files)-1] {
+		if total <= quota {
+			break
+		}
+		filePath := filepath.Join(cameraPath, info.Name())
+		if err := m.removeFile(filePath); err != nil {
+			log.Printf("Warning: Failed to delete %s: %v", filePath, err)
+			continue
+		}
+		total -= info.Size()
+		deletedCount++
+		deletedSize += info.Size()
+	}
+
+	if deletedCount > 0 {
+		log.Printf("Quota: deleted %d files (%s) of %s to keep it under %s", deletedCount, FormatBytes(deletedSize), dir, FormatBytes(quota))
+	}
+}
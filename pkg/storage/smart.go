@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMART attributes that count damaged sectors; any non-zero raw value means
+// the disk is already losing data.
+var smartSectorAttributes = map[int]string{
+	5:   "reallocated sectors",
+	197: "pending sectors",
+	198: "uncorrectable sectors",
+}
+
+const (
+	smartMaxTemperature = 60
+	smartMaxWearPercent = 90
+)
+
+type DiskHealth struct {
+	Device       string    `json:"device"`
+	Dirs         []string  `json:"dirs"`
+	Model        string    `json:"model,omitempty"`
+	Serial       string    `json:"serial,omitempty"`
+	Passed       bool      `json:"passed"`
+	Temperature  int       `json:"temperature_c,omitempty"`
+	PowerOnHours int       `json:"power_on_hours,omitempty"`
+	Warnings     []string  `json:"warnings"`
+	Error        string    `json:"error,omitempty"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+// SMARTHook is called with a disk whose warnings changed since the last check.
+type SMARTHook func(health DiskHealth)
+
+// SMARTMonitor periodically reads SMART data with smartctl for the disks
+// holding the given directories.
+type SMARTMonitor struct {
+	dirs     []string
+	interval time.Duration
+	mu       sync.Mutex
+	hook     SMARTHook
+	health   map[string]DiskHealth
+}
+
+func NewSMARTMonitor(interval time.Duration, dirs ...string) *SMARTMonitor {
+	return &SMARTMonitor{
+		dirs:     dirs,
+		interval: interval,
+		health:   make(map[string]DiskHealth),
+	}
+}
+
+func (m *SMARTMonitor) SetHook(hook SMARTHook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hook = hook
+}
+
+func (m *SMARTMonitor) Health() []DiskHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	health := make([]DiskHealth, 0, len(m.health))
+	for _, h := range m.health {
+		health = append(health, h)
+	}
+	slices.SortFunc(health, func(a, b DiskHealth) int { return strings.Compare(a.Device, b.Device) })
+	return health
+}
+
+func (m *SMARTMonitor) Start(ctx context.Context) {
+	if m == nil || m.interval <= 0 {
+		return
+	}
+	if _, err := exec.LookPath("smartctl"); err != nil {
+		log.Printf("Warning: Disk health checks disabled: smartctl not found")
+		return
+	}
+	go m.run(ctx)
+}
+
+func (m *SMARTMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *SMARTMonitor) check(ctx context.Context) {
+	devices := make(map[string][]string)
+	var order []string
+	for _, dir := range m.dirs {
+		device, err := deviceFor(ctx, dir)
+		if err != nil {
+			log.Printf("Warning: Failed to find the disk holding %s: %v", dir, err)
+			continue
+		}
+		if _, ok := devices[device]; !ok {
+			order = append(order, device)
+		}
+		if !slices.Contains(devices[device], dir) {
+			devices[device] = append(devices[device], dir)
+		}
+	}
+
+	for _, device := range order {
+		health := readSMART(ctx, device)
+		health.Dirs = devices[device]
+
+		m.mu.Lock()
+		prev, seen := m.health[device]
+		m.health[device] = health
+		hook := m.hook
+		m.mu.Unlock()
+
+		changed := !slices.Equal(prev.Warnings, health.Warnings)
+		if hook != nil && len(health.Warnings) > 0 && (!seen || changed) {
+			hook(health)
+		}
+	}
+}
+
+type smartctlOutput struct {
+	Device struct {
+		Name string `json:"name"`
+	} `json:"device"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours int `json:"hours"`
+	} `json:"power_on_time"`
+	ATAAttributes struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value int64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeLog *struct {
+		CriticalWarning int   `json:"critical_warning"`
+		PercentageUsed  int   `json:"percentage_used"`
+		MediaErrors     int64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+	Smartctl struct {
+		Messages []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+}
+
+func readSMART(ctx context.Context, device string) DiskHealth {
+	health := DiskHealth{Device: device, Warnings: []string{}, CheckedAt: time.Now()}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	out, runErr := exec.CommandContext(ctx, "smartctl", "--json", "-H", "-A", "-i", device).Output()
+
+	// smartctl reports disk problems in its exit status bits while still
+	// printing the data, so only the first two bits (bad arguments, device
+	// open failed) make the output unusable.
+	var exitErr *exec.ExitError
+	if runErr != nil && (!errors.As(runErr, &exitErr) || exitErr.ExitCode()&0b11 != 0) {
+		health.Error = fmt.Sprintf("smartctl failed: %v", runErr)
+		var parsed smartctlOutput
+		if json.Unmarshal(out, &parsed) == nil {
+			for _, msg := range parsed.Smartctl.Messages {
+				if msg.Severity == "error" {
+					health.Error = msg.String
+					break
+				}
+			}
+		}
+		return health
+	}
+
+	var parsed smartctlOutput
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		health.Error = fmt.Sprintf("failed to parse smartctl output: %v", err)
+		return health
+	}
+
+	health.Model = parsed.ModelName
+	health.Serial = parsed.SerialNumber
+	health.Temperature = parsed.Temperature.Current
+	health.PowerOnHours = parsed.PowerOnTime.Hours
+
+	if parsed.SmartStatus == nil {
+		health.Error = "SMART is not supported by this device"
+		return health
+	}
+	health.Passed = parsed.SmartStatus.Passed
+	if !health.Passed {
+		health.Warnings = append(health.Warnings, "SMART overall health check failed")
+	}
+
+	for _, attr := range parsed.ATAAttributes.Table {
+		if name, ok := smartSectorAttributes[attr.ID]; ok && attr.Raw.Value > 0 {
+			health.Warnings = append(health.Warnings, fmt.Sprintf("%d %s", attr.Raw.Value, name))
+		}
+	}
+	if nvme := parsed.NVMeLog; nvme != nil {
+		if nvme.CriticalWarning != 0 {
+			health.Warnings = append(health.Warnings, fmt.Sprintf("NVMe critical warning 0x%02x", nvme.CriticalWarning))
+		}
+		if nvme.MediaErrors > 0 {
+			health.Warnings = append(health.Warnings, fmt.Sprintf("%d media errors", nvme.MediaErrors))
+		}
+		if nvme.PercentageUsed >= smartMaxWearPercent {
+			health.Warnings = append(health.Warnings, fmt.Sprintf("%d%% of rated endurance used", nvme.PercentageUsed))
+		}
+	}
+	if health.Temperature > smartMaxTemperature {
+		health.Warnings = append(health.Warnings, fmt.Sprintf("running hot at %d°C", health.Temperature))
+	}
+
+	return health
+}
+
+// deviceFor returns the whole disk holding dir, in the form smartctl expects.
+func deviceFor(ctx context.Context, dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if runtime.GOOS == "windows" {
+		volume := filepath.VolumeName(abs)
+		if volume == "" {
+			return "", fmt.Errorf("no drive letter")
+		}
+		return volume, nil
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "df", "-P", abs)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("df failed: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(lines) < 2 || len(fields) == 0 || !strings.HasPrefix(fields[0], "/dev/") {
+		return "", fmt.Errorf("not on a local disk")
+	}
+	device := fields[0]
+
+	// SMART data belongs to the disk, not the partition: on Linux, sysfs
+	// links /sys/class/block/sda1 into the directory of its parent sda.
+	if runtime.GOOS == "linux" {
+		name := filepath.Base(device)
+		if _, err := os.Stat(filepath.Join("/sys/class/block", name, "partition")); err == nil {
+			if target, err := filepath.EvalSymlinks(filepath.Join("/sys/class/block", name)); err == nil {
+				device = "/dev/" + filepath.Base(filepath.Dir(target))
+			}
+		}
+	}
+	return device, nil
+}
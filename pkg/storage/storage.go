@@ -0,0 +1,736 @@
+// Package storage lists, resolves and expires the recordings below
+// Options.OutputDir, and watches the health of the disk they are on.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ScrubDir holds keyframe-only proxies of segments, mirroring the camera
+// directories. JournalDir lists the segments being written so a crash can be
+// repaired on the next start. WatermarkDir keeps the uploaded watermark logo
+// and stamped copies of shared clips. TierDir holds segments being re-encoded
+// for the cold tier, and StaticDir the stills kept of removed static segments.
+// MapDir keeps the floor plan uploaded for the camera map, and PlaybackDir
+// browser-playable copies of segments browsers cannot play. RawDir holds the
+// stream copies recorded alongside transcoded segments in dual mode, and
+// ForwardDir the SDP files of streams forwarded over RTP. CaptureDir keeps the
+// bursts captured on demand. All are hidden so listings and retention skip
+// them.
+const (
+	ScrubDir     = ".scrub"
+	JournalDir   = ".journal"
+	WatermarkDir = ".watermark"
+	TierDir      = ".tier"
+	StaticDir    = ".static"
+	MapDir       = ".map"
+	FailoverDir  = ".failover"
+	PlaybackDir  = ".playback"
+	RawDir       = ".raw"
+	ForwardDir   = ".forward"
+	CaptureDir   = ".captures"
+)
+
+// ChecksumExt is the extension of a segment's checksum sidecar, kept next to
+// it as e.g. Front_Door_20260220_100000.mp4.sha256 and removed with it.
+const ChecksumExt = ".sha256"
+
+type DeleteHook func(path string)
+
+// DeleteFailedHook is told about a recording that could not be removed, so
+// the removal can be retried later.
+type DeleteFailedHook func(path string, err error)
+
+// statsInterval is how often the stats snapshot GetStats returns is
+// refreshed, besides after every cleanup.
+const statsInterval = 30 * time.Second
+
+// Manager's mu serializes cleanups, which can take long on a slow disk; what
+// readers need is kept in atomics so they never wait for one.
+type Manager struct {
+	opts        *Options
+	stopCh      chan struct{}
+	mu          sync.Mutex
+	lastCleanup time.Time
+	quotas      atomic.Pointer[map[string]int64]
+	retention   atomic.Pointer[map[string]int]
+	deleteHook  DeleteHook
+	failedHook  DeleteFailedHook
+	recovery    atomic.Pointer[RecoveryReport]
+	disk        atomic.Pointer[DiskMonitor]
+	smart       atomic.Pointer[SMARTMonitor]
+	stats       atomic.Pointer[StorageStats]
+}
+
+type StorageStats struct {
+	TotalSize     int64                `json:"total_size_bytes"`
+	TotalSizeHR   string               `json:"total_size_human"`
+	FileCount     int                  `json:"file_count"`
+	OldestFile    time.Time            `json:"oldest_file,omitempty"`
+	NewestFile    time.Time            `json:"newest_file,omitempty"`
+	LastCleanup   time.Time            `json:"last_cleanup"`
+	RetentionDays int                  `json:"retention_days"`
+	Cameras       []CameraStorageStats `json:"cameras"`
+	Recovery      *RecoveryReport      `json:"recovery,omitempty"`
+	WriteLatency  *WriteLatencyStats   `json:"write_latency,omitempty"`
+	DiskHealth    []DiskHealth         `json:"disk_health,omitempty"`
+	// Tiers holds the indexed segment count and size per storage tier. Like
+	// FileInfo.Quality, the server fills it in from its index.
+	Tiers map[string]TierUsage `json:"tiers,omitempty"`
+	// Retranscodes counts the segments waiting to be re-encoded from their
+	// stream copy; the server fills it in too.
+	Retranscodes int `json:"retranscodes,omitempty"`
+}
+
+type TierUsage struct {
+	Segments int    `json:"segments"`
+	Size     int64  `json:"size"`
+	SizeHR   string `json:"size_human"`
+}
+
+func NewTierUsage(segments int, size int64) TierUsage {
+	return TierUsage{Segments: segments, Size: size, SizeHR: FormatBytes(size)}
+}
+
+// RecoveryReport lists the segments found unfinished after a crash and
+// whether remuxing made them playable again.
+type RecoveryReport struct {
+	CheckedAt time.Time       `json:"checked_at"`
+	Recovered []RecoveredFile `json:"recovered"`
+	Failed    []RecoveredFile `json:"failed"`
+}
+
+type RecoveredFile struct {
+	Camera   string `json:"camera"`
+	Filename string `json:"filename"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Error    string `json:"error,omitempty"`
+}
+
+type CameraStorageStats struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	SizeHR    string    `json:"size_human"`
+	FileCount int       `json:"file_count"`
+	Oldest    time.Time `json:"oldest,omitempty"`
+	Newest    time.Time `json:"newest,omitempty"`
+	// Quota is the most the camera's recordings may take, 0 for no cap.
+	Quota   int64  `json:"quota,omitempty"`
+	QuotaHR string `json:"quota_human,omitempty"`
+}
+
+func NewManager(opts *Options) *Manager {
+	return &Manager{
+		opts:   opts,
+		stopCh: make(chan struct{}),
+	}
+}
+
+func (m *Manager) SetRecoveryReport(report *RecoveryReport) {
+	m.recovery.Store(report)
+}
+
+func (m *Manager) SetDiskMonitor(disk *DiskMonitor) {
+	m.disk.Store(disk)
+}
+
+func (m *Manager) SetSMARTMonitor(smart *SMARTMonitor) {
+	m.smart.Store(smart)
+}
+
+func hiddenDir(name string) bool {
+	return name == ScrubDir || name == JournalDir || name == WatermarkDir || name == TierDir || name == StaticDir || name == MapDir || name == FailoverDir || name == PlaybackDir || name == RawDir || name == ForwardDir || name == CaptureDir
+}
+
+func (m *Manager) SetDeleteHook(hook DeleteHook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteHook = hook
+}
+
+func (m *Manager) SetDeleteFailedHook(hook DeleteFailedHook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failedHook = hook
+}
+
+// isSegment reports whether name is a recording segment rather than a file
+// kept alongside one, such as its checksum.
+func (m *Manager) isSegment(name string) bool {
+	return strings.HasSuffix(name, "."+m.opts.Format)
+}
+
+func (m *Manager) removeFile(path string) error {
+	if err := os.Remove(path); err != nil {
+		if !os.IsNotExist(err) && m.failedHook != nil {
+			m.failedHook(path, err)
+		}
+		return err
+	}
+	m.removeCompanions(path)
+	return nil
+}
+
+// RemoveSegment retries removing the segment at path, found by a failed
+// delete. A segment already gone is not an error, and what is left of it,
+// such as its checksum and index entry, is removed too.
+func (m *Manager) RemoveSegment(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	m.removeCompanions(path)
+	return nil
+}
+
+// removeCompanions removes the files kept alongside a removed segment and
+// reports its removal.
+func (m *Manager) removeCompanions(path string) {
+	os.Remove(path + ChecksumExt)
+	if proxy, err := ScrubPath(m.opts.OutputDir, path); err == nil {
+		os.Remove(proxy)
+	}
+	if playable, err := PlaybackPath(m.opts.OutputDir, path); err == nil {
+		os.Remove(playable)
+	}
+	if m.deleteHook != nil {
+		m.deleteHook(path)
+	}
+}
+
+func (m *Manager) Start(ctx context.Context) error {
+	if err := os.MkdirAll(m.opts.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	go m.cleanupLoop(ctx)
+
+	return nil
+}
+
+func (m *Manager) cleanupLoop(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+	quotaTicker := time.NewTicker(quotaInterval)
+	defer quotaTicker.Stop()
+	statsTicker := time.NewTicker(statsInterval)
+	defer statsTicker.Stop()
+
+	m.cleanup()
+	m.enforceQuotas()
+	m.refreshStats()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			m.cleanup()
+			m.refreshStats()
+		case <-quotaTicker.C:
+			m.enforceQuotas()
+			m.refreshStats()
+		case <-statsTicker.C:
+			m.refreshStats()
+		}
+	}
+}
+
+func (m *Manager) cleanup() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastCleanup = time.Now()
+
+	cameraDirs, err := os.ReadDir(m.opts.OutputDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var deletedCount int
+	var deletedSize int64
+
+	for _, cameraDir := range cameraDirs {
+		if !cameraDir.IsDir() || hiddenDir(cameraDir.Name()) {
+			continue
+		}
+
+		cameraPath := filepath.Join(m.opts.OutputDir, cameraDir.Name())
+		entries, err := os.ReadDir(cameraPath)
+		if err != nil {
+			continue
+		}
+		cutoff := m.RetentionCutoff(cameraDir.Name(), m.lastCleanup)
+
+		for _, entry := range entries {
+			// Companions such as checksums go with their segment.
+			if entry.IsDir() || !m.isSegment(entry.Name()) {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			if info.ModTime().Before(cutoff) {
+				filePath := filepath.Join(cameraPath, entry.Name())
+				if err := m.removeFile(filePath); err != nil {
+					log.Printf("Warning: Failed to delete %s: %v", filePath, err)
+					continue
+				}
+				deletedCount++
+				deletedSize += info.Size()
+			}
+		}
+	}
+
+	if deletedCount > 0 {
+		log.Printf("Cleanup: deleted %d files (%s)", deletedCount, FormatBytes(deletedSize))
+	}
+
+	return nil
+}
+
+// SetRetention keeps the recordings of the cameras in retention, by camera
+// name, for that many days instead of RetentionDays.
+func (m *Manager) SetRetention(retention map[string]int) {
+	byDir := make(map[string]int, len(retention))
+	for name, days := range retention {
+		if days > 0 {
+			byDir[CameraDirName(name)] = days
+		}
+	}
+	m.retention.Store(&byDir)
+}
+
+// RetentionCutoff returns the time before which recordings in the camera
+// directory dir expire at now.
+func (m *Manager) RetentionCutoff(dir string, now time.Time) time.Time {
+	days := m.opts.RetentionDays
+	if retention := m.retention.Load(); retention != nil {
+		if d, ok := (*retention)[dir]; ok {
+			days = d
+		}
+	}
+	return now.AddDate(0, 0, -days)
+}
+
+func (m *Manager) Stop() {
+	close(m.stopCh)
+}
+
+// GetStats returns the stats of the last refresh, which is at most
+// statsInterval old once the manager is started, without waiting for a
+// cleanup in progress. Write latency and disk health are always current.
+func (m *Manager) GetStats() (*StorageStats, error) {
+	snapshot := m.stats.Load()
+	if snapshot == nil {
+		var err error
+		if snapshot, err = m.collectStats(); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := *snapshot
+	stats.Cameras = slices.Clone(snapshot.Cameras)
+	stats.RetentionDays = m.opts.RetentionDays
+	stats.Recovery = m.recovery.Load()
+	if disk := m.disk.Load(); disk != nil {
+		latency := disk.Stats()
+		stats.WriteLatency = &latency
+	}
+	if smart := m.smart.Load(); smart != nil {
+		stats.DiskHealth = smart.Health()
+	}
+	return &stats, nil
+}
+
+func (m *Manager) refreshStats() {
+	stats, err := m.collectStats()
+	if err != nil {
+		log.Printf("Warning: Failed to collect storage stats: %v", err)
+		return
+	}
+	m.stats.Store(stats)
+}
+
+// collectStats walks the output directory for the size of every camera's
+// recordings.
+func (m *Manager) collectStats() (*StorageStats, error) {
+	m.mu.Lock()
+	lastCleanup := m.lastCleanup
+	m.mu.Unlock()
+
+	stats := &StorageStats{
+		LastCleanup: lastCleanup,
+		Cameras:     []CameraStorageStats{},
+	}
+	var quotas map[string]int64
+	if q := m.quotas.Load(); q != nil {
+		quotas = *q
+	}
+
+	cameraDirs, err := os.ReadDir(m.opts.OutputDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return nil, err
+	}
+
+	var totalSize int64
+	var totalFileCount int
+	var oldestTime, newestTime time.Time
+
+	for _, cameraDir := range cameraDirs {
+		if !cameraDir.IsDir() || hiddenDir(cameraDir.Name()) {
+			continue
+		}
+
+		cameraName := cameraDir.Name()
+		cameraPath := filepath.Join(m.opts.OutputDir, cameraName)
+
+		cameraStats := m.getCameraStats(cameraName, cameraPath)
+		if quota := quotas[cameraName]; quota > 0 {
+			cameraStats.Quota = quota
+			cameraStats.QuotaHR = FormatBytes(quota)
+		}
+		stats.Cameras = append(stats.Cameras, cameraStats)
+
+		totalSize += cameraStats.Size
+		totalFileCount += cameraStats.FileCount
+
+		if !cameraStats.Oldest.IsZero() {
+			if oldestTime.IsZero() || cameraStats.Oldest.Before(oldestTime) {
+				oldestTime = cameraStats.Oldest
+			}
+		}
+		if !cameraStats.Newest.IsZero() {
+			if newestTime.IsZero() || cameraStats.Newest.After(newestTime) {
+				newestTime = cameraStats.Newest
+			}
+		}
+	}
+
+	stats.TotalSize = totalSize
+	stats.TotalSizeHR = FormatBytes(totalSize)
+	stats.FileCount = totalFileCount
+	stats.OldestFile = oldestTime
+	stats.NewestFile = newestTime
+
+	return stats, nil
+}
+
+func (m *Manager) getCameraStats(name, path string) CameraStorageStats {
+	stats := CameraStorageStats{
+		Name: name,
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return stats
+	}
+
+	var totalSize int64
+	var oldestTime, newestTime time.Time
+	fileCount := 0
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		if !m.isSegment(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		totalSize += info.Size()
+		fileCount++
+
+		modTime := info.ModTime()
+		if oldestTime.IsZero() || modTime.Before(oldestTime) {
+			oldestTime = modTime
+		}
+		if newestTime.IsZero() || modTime.After(newestTime) {
+			newestTime = modTime
+		}
+	}
+
+	stats.Size = totalSize
+	stats.SizeHR = FormatBytes(totalSize)
+	stats.FileCount = fileCount
+	stats.Oldest = oldestTime
+	stats.Newest = newestTime
+
+	return stats
+}
+
+// ListFiles reads the directories without waiting for a cleanup; a segment
+// it removes meanwhile is skipped or listed one last time.
+func (m *Manager) ListFiles(cameraName, filter string, limit int) ([]FileInfo, error) {
+	var searchDir string
+	if cameraName != "" {
+		searchDir = filepath.Join(m.opts.OutputDir, CameraDirName(cameraName))
+	} else {
+		searchDir = m.opts.OutputDir
+	}
+
+	var files []FileInfo
+
+	err := filepath.Walk(searchDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() {
+			if hiddenDir(info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !m.isSegment(info.Name()) {
+			return nil
+		}
+
+		name := info.Name()
+		if filter != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(filter)) {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(m.opts.OutputDir, path)
+		cameraFromPath := ""
+		if parts := strings.Split(filepath.ToSlash(relPath), "/"); len(parts) > 1 {
+			cameraFromPath = strings.ReplaceAll(parts[0], "_", " ")
+		}
+
+		files = append(files, FileInfo{
+			Name:       name,
+			CameraName: cameraFromPath,
+			Path:       path,
+			Size:       info.Size(),
+			SizeHR:     FormatBytes(info.Size()),
+			CreatedAt:  info.ModTime(),
+		})
+
+		return nil
+	})
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	sortFilesByDateDesc(files)
+
+	if limit > 0 && len(files) > limit {
+		files = files[:limit]
+	}
+
+	return files, nil
+}
+
+func (m *Manager) DeleteFile(cameraName, filename string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	filePath, err := m.resolve(cameraName, filename)
+	if err != nil {
+		return err
+	}
+
+	return m.removeFile(filePath)
+}
+
+func (m *Manager) GetFilePath(cameraName, filename string) (string, error) {
+	filePath, err := m.resolve(cameraName, filename)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(filePath); err != nil {
+		return "", err
+	}
+
+	return filePath, nil
+}
+
+func (m *Manager) GetCameraDir(cameraName string) string {
+	return filepath.Join(m.opts.OutputDir, CameraDirName(cameraName))
+}
+
+func (m *Manager) resolve(cameraName, filename string) (string, error) {
+	// Reject both separators regardless of platform so a name that is
+	// harmless on Linux cannot escape the camera directory on Windows.
+	if filename == "" || filename == "." || filename == ".." || strings.ContainsAny(filename, `/\`) {
+		return "", fmt.Errorf("invalid file path")
+	}
+
+	dir := m.opts.OutputDir
+	if cameraName != "" {
+		dir = m.GetCameraDir(cameraName)
+	}
+	filePath := filepath.Join(dir, filename)
+
+	rel, err := filepath.Rel(m.opts.OutputDir, filePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file path")
+	}
+
+	return filePath, nil
+}
+
+// CameraDirName maps a camera name to the directory (and file name prefix)
+// its recordings are stored under. Characters that are separators or
+// reserved on any supported platform become underscores.
+func CameraDirName(cameraName string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(` <>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimRight(cameraName, "."))
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// SegmentFilename returns the name of a segment of the camera started at
+// startedAt, in the given container format.
+func SegmentFilename(cameraName string, startedAt time.Time, format string) string {
+	return fmt.Sprintf("%s_%s.%s", CameraDirName(cameraName), startedAt.Format("20060102_150405"), format)
+}
+
+// maxNameSequence bounds the numbered names tried for files started within
+// the same second.
+const maxNameSequence = 99
+
+// ClaimName creates an empty file named filename in dir, or the first free
+// numbered variant such as Cam_20250101_120000_1.mp4, and returns its name.
+// The file is created exclusively, so an existing recording is never taken
+// over; the caller writes it by replacing the placeholder.
+func ClaimName(dir, filename string) (string, error) {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	for seq := 0; seq <= maxNameSequence; seq++ {
+		name := filename
+		if seq > 0 {
+			name = fmt.Sprintf("%s_%d%s", base, seq, ext)
+		}
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to create %s: %w", name, err)
+		}
+		f.Close()
+		return name, nil
+	}
+	return "", fmt.Errorf("file name collision: %s and %d numbered variants already exist", filename, maxNameSequence)
+}
+
+// ScrubPath returns where the scrub proxy of a segment under outputDir is
+// kept. Proxies are always MP4 so browsers can play them.
+func ScrubPath(outputDir, segmentPath string) (string, error) {
+	rel, err := filepath.Rel(outputDir, segmentPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("segment is outside the recordings directory")
+	}
+	return filepath.Join(outputDir, ScrubDir, strings.TrimSuffix(rel, filepath.Ext(rel))+".mp4"), nil
+}
+
+// PlaybackPath returns where the browser-playable copy of a segment under
+// outputDir is kept.
+func PlaybackPath(outputDir, segmentPath string) (string, error) {
+	rel, err := filepath.Rel(outputDir, segmentPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("segment is outside the recordings directory")
+	}
+	return filepath.Join(outputDir, PlaybackDir, strings.TrimSuffix(rel, filepath.Ext(rel))+".mp4"), nil
+}
+
+// RawPath returns where the stream copy of a segment under outputDir is
+// recorded in dual mode. It keeps the segment's name, extension included, and
+// adds .mkv.
+func RawPath(outputDir, segmentPath string) (string, error) {
+	rel, err := filepath.Rel(outputDir, segmentPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("segment is outside the recordings directory")
+	}
+	return filepath.Join(outputDir, RawDir, rel+".mkv"), nil
+}
+
+// StaticThumbnailPath returns where the still of a removed static segment is
+// kept.
+func StaticThumbnailPath(outputDir, cameraName, filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)) + ".jpg"
+	return filepath.Join(outputDir, StaticDir, CameraDirName(cameraName), name)
+}
+
+type FileInfo struct {
+	Name       string    `json:"name"`
+	CameraName string    `json:"camera_name"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	SizeHR     string    `json:"size_human"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	EndedAt    time.Time `json:"ended_at,omitzero"`
+	// Quality rates the stream loss while recording: "good", "degraded" or
+	// "poor". Storage leaves it empty; the server fills it in from its index.
+	Quality string `json:"quality,omitempty"`
+	// Tier is "cold" once the segment was re-encoded to save space, or
+	// "keyframes" once only its keyframes were kept.
+	Tier string `json:"tier,omitempty"`
+	// Static is set when the picture barely changed during the segment.
+	Static bool `json:"static,omitempty"`
+}
+
+// FormatBytes formats a size for people, such as "1.5 GB".
+func FormatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// sortFilesByDateDesc sorts newest first, and files of the same time by
+// path, so the order is stable enough to page through.
+func sortFilesByDateDesc(files []FileInfo) {
+	slices.SortFunc(files, func(a, b FileInfo) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+}
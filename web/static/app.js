@@ -1,7 +1,17 @@
+const basePath = window.BASE_PATH || '';
+
+// t translates a message with the language pack of the page, filling in
+// %s and %d placeholders in order.
+function t(key, ...args) {
+    const messages = window.I18N || {};
+    let i = 0;
+    return (messages[key] || key).replace(/%[sd]/g, () => String(args[i++]));
+}
+
 let statusData = {};
 
 function updateStatus() {
-    fetch('/api/status')
+    fetch(basePath + '/api/status')
         .then(response => response.json())
         .then(data => {
             statusData = data;
@@ -10,22 +20,27 @@ function updateStatus() {
                 data.cameras.forEach(cam => {
                     const statusEl = document.querySelector('[data-status="' + cam.name + '"]');
                     const toggleEl = document.querySelector('[data-toggle="' + cam.name + '"]');
+                    const viewersEl = document.querySelector('[data-viewers="' + cam.name + '"]');
                     
                     if (statusEl) {
                         if (cam.connected && cam.streaming) {
-                            statusEl.textContent = 'Online';
+                            statusEl.textContent = t('Online');
                             statusEl.className = 'status-badge online';
                         } else if (cam.enabled) {
-                            statusEl.textContent = 'Connecting';
+                            statusEl.textContent = t('Connecting');
                             statusEl.className = 'status-badge connecting';
                         } else {
-                            statusEl.textContent = 'Disabled';
+                            statusEl.textContent = t('Disabled');
                             statusEl.className = 'status-badge offline';
                         }
                     }
                     
                     if (toggleEl) {
-                        toggleEl.textContent = cam.running ? 'Stop' : 'Start';
+                        toggleEl.textContent = cam.running ? t('Stop') : t('Start');
+                    }
+
+                    if (viewersEl) {
+                        viewersEl.textContent = cam.viewers ? t('%d watching', cam.viewers) : '';
                     }
                 });
             }
@@ -35,21 +50,38 @@ function updateStatus() {
         });
 }
 
+const STATE_LABELS = {
+    connecting: ['Connecting', '#ffb020'],
+    recording: ['Recording', '#00ff88'],
+    retrying: ['Retrying', '#ffb020'],
+    failed: ['Failed', '#e94560'],
+    circuit_open: ['Waiting for camera', '#e94560'],
+    idle: ['Idle (outside schedule)', '#8888aa'],
+    paused: ['Paused', '#ffb020'],
+    queued: ['Queued (transcode limit)', '#ffb020'],
+    standby: ['Standby', '#8888aa'],
+    stopped: ['Stopped', '#e94560']
+};
+
 function updateCameraStatus(cameraName) {
-    fetch('/api/status/' + encodeURIComponent(cameraName))
+    fetch(basePath + '/api/status/' + encodeURIComponent(cameraName))
         .then(response => response.json())
         .then(data => {
             const statusEl = document.getElementById('rec-status');
             const uptimeEl = document.getElementById('uptime');
             
+            const pauseBtn = document.getElementById('btn-pause');
+            if (pauseBtn) {
+                pauseBtn.textContent = data.paused ? t('Resume') : t('Pause');
+                pauseBtn.dataset.paused = data.paused ? 'true' : '';
+                pauseBtn.disabled = !data.running;
+            }
+
             if (statusEl) {
-                if (data.running) {
-                    statusEl.textContent = 'Recording';
-                    statusEl.style.color = '#00ff88';
-                } else {
-                    statusEl.textContent = 'Stopped';
-                    statusEl.style.color = '#e94560';
-                }
+                const label = STATE_LABELS[data.state] || STATE_LABELS.stopped;
+                statusEl.textContent = t(label[0]);
+                statusEl.style.color = label[1];
+                statusEl.title = data.last_error || '';
             }
             
             if (uptimeEl) {
@@ -62,7 +94,7 @@ function updateCameraStatus(cameraName) {
 }
 
 function loadStorageStats() {
-    fetch('/api/storage')
+    fetch(basePath + '/api/storage')
         .then(response => response.json())
         .then(data => {
             const totalSize = document.getElementById('total-size');
@@ -72,8 +104,8 @@ function loadStorageStats() {
             
             if (totalSize) totalSize.textContent = data.total_size_human;
             if (fileCount) fileCount.textContent = data.file_count;
-            if (retention) retention.textContent = data.retention_days + ' days';
-            if (storageInfo) storageInfo.textContent = data.total_size_human + ' (' + data.file_count + ' files)';
+            if (retention) retention.textContent = t('%d days', data.retention_days);
+            if (storageInfo) storageInfo.textContent = t('%s (%d files)', data.total_size_human, data.file_count);
             
             const cameraStorageEl = document.getElementById('camera-storage');
             if (cameraStorageEl && data.cameras) {
@@ -81,10 +113,12 @@ function loadStorageStats() {
                 data.cameras.forEach(cam => {
                     html += '<div class="stat-row">';
                     html += '<span class="stat-label">' + cam.name + '</span>';
-                    html += '<span>' + cam.size_human + ' (' + cam.file_count + ' files)</span>';
+                    html += '<span>' + (cam.quota_human ?
+                        t('%s of %s (%d files)', cam.size_human, cam.quota_human, cam.file_count) :
+                        t('%s (%d files)', cam.size_human, cam.file_count)) + '</span>';
                     html += '</div>';
                 });
-                cameraStorageEl.innerHTML = html || '<p>No camera data</p>';
+                cameraStorageEl.innerHTML = html || '<p>' + t('No camera data') + '</p>';
             }
         })
         .catch(err => {
@@ -93,7 +127,7 @@ function loadStorageStats() {
 }
 
 function startCamera(cameraName) {
-    fetch('/api/camera/' + encodeURIComponent(cameraName) + '/start', {
+    fetch(basePath + '/api/camera/' + encodeURIComponent(cameraName) + '/start', {
         method: 'POST'
     })
     .then(response => response.json())
@@ -102,16 +136,36 @@ function startCamera(cameraName) {
             updateCameraStatus(cameraName);
             updateStatus();
         } else {
-            alert('Error: ' + data.error);
+            alert(t('Error: %s', data.error));
+        }
+    })
+    .catch(err => {
+        alert(t('Failed to start camera: %s', err.message));
+    });
+}
+
+function togglePause(cameraName) {
+    const pauseBtn = document.getElementById('btn-pause');
+    const action = pauseBtn && pauseBtn.dataset.paused ? 'resume' : 'pause';
+
+    fetch(basePath + '/api/camera/' + encodeURIComponent(cameraName) + '/' + action, {
+        method: 'POST'
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.message) {
+            updateCameraStatus(cameraName);
+        } else {
+            alert(t('Error: %s', data.error));
         }
     })
     .catch(err => {
-        alert('Failed to start camera: ' + err.message);
+        alert(t(action === 'resume' ? 'Failed to resume camera: %s' : 'Failed to pause camera: %s', err.message));
     });
 }
 
 function stopCamera(cameraName) {
-    fetch('/api/camera/' + encodeURIComponent(cameraName) + '/stop', {
+    fetch(basePath + '/api/camera/' + encodeURIComponent(cameraName) + '/stop', {
         method: 'POST'
     })
     .then(response => response.json())
@@ -120,11 +174,58 @@ function stopCamera(cameraName) {
             updateCameraStatus(cameraName);
             updateStatus();
         } else {
-            alert('Error: ' + data.error);
+            alert(t('Error: %s', data.error));
+        }
+    })
+    .catch(err => {
+        alert(t('Failed to stop camera: %s', err.message));
+    });
+}
+
+function powerCycleCamera(cameraName) {
+    if (!confirm(t('Switch %s off and on again?', cameraName))) return;
+    const btn = document.getElementById('btn-power');
+    if (btn) btn.disabled = true;
+
+    fetch(basePath + '/api/camera/' + encodeURIComponent(cameraName) + '/power-cycle', {
+        method: 'POST'
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.message) {
+            updateCameraStatus(cameraName);
+        } else {
+            alert(t('Error: %s', data.error));
         }
     })
     .catch(err => {
-        alert('Failed to stop camera: ' + err.message);
+        alert(t('Failed to power-cycle camera: %s', err.message));
+    })
+    .finally(() => {
+        if (btn) btn.disabled = false;
+    });
+}
+
+function captureBurst(cameraName) {
+    const btn = document.getElementById('btn-capture');
+    if (btn) btn.disabled = true;
+
+    fetch(basePath + '/api/camera/' + encodeURIComponent(cameraName) + '/capture', {
+        method: 'POST'
+    })
+    .then(response => response.json())
+    .then(data => {
+        if (data.clip_url) {
+            window.open(data.clip_url, '_blank');
+        } else {
+            alert(t('Error: %s', data.error));
+        }
+    })
+    .catch(err => {
+        alert(t('Failed to capture a burst: %s', err.message));
+    })
+    .finally(() => {
+        if (btn) btn.disabled = false;
     });
 }
 
@@ -141,14 +242,151 @@ function refreshRecordings() {
     window.location.reload();
 }
 
+// watchNewRecordings shows the #new-recordings banner once segments of the
+// camera (or of any camera) finish after the page was loaded.
+function watchNewRecordings(cameraName) {
+    const banner = document.getElementById('new-recordings');
+    if (!banner || !window.EventSource) {
+        return;
+    }
+
+    let url = basePath + '/api/recordings/stream';
+    if (cameraName) {
+        url += '?camera=' + encodeURIComponent(cameraName);
+    }
+    let count = 0;
+    new EventSource(url).addEventListener('recording', () => {
+        count++;
+        banner.textContent = t('%d new recordings, click to refresh', count);
+        banner.hidden = false;
+    });
+    banner.addEventListener('click', refreshRecordings);
+}
+
+// loadRecordingsOnScroll appends the next page of /recordings to the list
+// each time the #recordings-more marker at its end scrolls into view, until
+// the last page.
+function loadRecordingsOnScroll(more, query) {
+    if (!more || !window.IntersectionObserver) {
+        return;
+    }
+
+    let loading = false;
+    const observer = new IntersectionObserver(entries => {
+        if (loading || !entries.some(entry => entry.isIntersecting)) {
+            return;
+        }
+        loading = true;
+        query.set('cursor', more.dataset.cursor);
+        query.set('limit', more.dataset.limit);
+        fetch(basePath + '/recordings?' + query)
+            .then(response => response.json().then(data => {
+                if (!response.ok) {
+                    throw new Error(data.error);
+                }
+                return data;
+            }))
+            .then(data => {
+                data.recordings.forEach(rec => more.before(recordingElement(rec)));
+                if (data.next_cursor) {
+                    more.dataset.cursor = data.next_cursor;
+                } else {
+                    observer.disconnect();
+                    more.remove();
+                }
+                loading = false;
+            })
+            .catch(err => {
+                observer.disconnect();
+                more.textContent = t('Failed to load recordings: %s', err.message);
+            });
+    }, {root: more.parentElement, rootMargin: '400px'});
+    observer.observe(more);
+}
+
+// recordingElement builds a recordings list row like the page's own.
+function recordingElement(rec) {
+    const path = encodeURIComponent(rec.camera_name) + '/' + encodeURIComponent(rec.name);
+    const el = (tag, className, text) => {
+        const node = document.createElement(tag);
+        if (className) node.className = className;
+        if (text !== undefined) node.textContent = text;
+        return node;
+    };
+
+    const item = el('div', 'recording-item thumb-item');
+    const thumb = el('img', 'event-thumb');
+    thumb.alt = '';
+    thumb.loading = 'lazy';
+    thumb.onerror = () => thumb.removeAttribute('src');
+    thumb.src = rec.thumbnail_url;
+    item.appendChild(thumb);
+
+    const info = el('div', 'recording-info');
+    info.appendChild(el('span', 'camera-tag', rec.camera_name));
+    info.appendChild(el('span', 'filename', rec.name));
+    const badge = (className, text, title) => {
+        const node = el('span', 'quality-badge ' + className, text);
+        node.title = title;
+        info.appendChild(node);
+    };
+    if (rec.quality && rec.quality !== 'good') {
+        badge('quality-' + rec.quality, t(rec.quality === 'poor' ? 'Poor' : 'Degraded'), t('Frames or packets were lost while recording'));
+    }
+    if (rec.tier === 'cold') {
+        badge('tier-cold', t('Archived'), t('Re-encoded to save space'));
+    } else if (rec.tier === 'keyframes') {
+        badge('tier-keyframes', t('Keyframes'), t('Only the keyframes were kept'));
+    }
+    if (rec.static) {
+        badge('scene-static', t('Static'), t('The picture barely changed'));
+    }
+    const meta = [rec.size_human];
+    if (rec.duration_seconds) {
+        meta.push(formatClock(rec.duration_seconds));
+    }
+    meta.push(formatDateTime(new Date(rec.created_at)));
+    info.appendChild(el('span', 'meta', meta.join(' | ')));
+    item.appendChild(info);
+
+    const actions = el('div', 'recording-actions');
+    const play = el('a', 'btn', t('Play'));
+    play.href = basePath + '/play/' + path;
+    const download = el('a', 'btn', t('Download'));
+    download.href = basePath + '/dl/' + path;
+    download.download = '';
+    const del = el('button', 'btn btn-danger', t('Delete'));
+    del.addEventListener('click', () => deleteRecording(rec.camera_name, rec.name));
+    actions.append(play, download, del);
+    item.appendChild(actions);
+    return item;
+}
+
+// formatClock formats seconds as m:ss, or h:mm:ss for an hour or more.
+function formatClock(seconds) {
+    seconds = Math.round(seconds);
+    const h = Math.floor(seconds / 3600);
+    const m = Math.floor(seconds / 60) % 60;
+    const s = String(seconds % 60).padStart(2, '0');
+    return h > 0 ? h + ':' + String(m).padStart(2, '0') + ':' + s : m + ':' + s;
+}
+
+// formatDateTime formats a local time as the server renders it,
+// 2006-01-02 15:04:05.
+function formatDateTime(d) {
+    const pad = n => String(n).padStart(2, '0');
+    return d.getFullYear() + '-' + pad(d.getMonth() + 1) + '-' + pad(d.getDate()) + ' ' +
+        pad(d.getHours()) + ':' + pad(d.getMinutes()) + ':' + pad(d.getSeconds());
+}
+
 function deleteRecording(cameraName, filename) {
-    if (!confirm('Are you sure you want to delete ' + filename + '?')) {
+    if (!confirm(t('Are you sure you want to delete %s?', filename))) {
         return;
     }
     
-    let url = '/recordings/' + encodeURIComponent(filename);
+    let url = basePath + '/recordings/' + encodeURIComponent(filename);
     if (cameraName) {
-        url = '/recordings/' + encodeURIComponent(cameraName) + '/' + encodeURIComponent(filename);
+        url = basePath + '/recordings/' + encodeURIComponent(cameraName) + '/' + encodeURIComponent(filename);
     }
     
     fetch(url, {
@@ -157,13 +395,328 @@ function deleteRecording(cameraName, filename) {
     .then(response => response.json())
     .then(data => {
         if (data.message) {
-            alert('Recording deleted');
+            alert(t('Recording deleted'));
             refreshRecordings();
         } else {
-            alert('Error: ' + data.error);
+            alert(t('Error: %s', data.error));
         }
     })
     .catch(err => {
-        alert('Failed to delete recording: ' + err.message);
+        alert(t('Failed to delete recording: %s', err.message));
+    });
+}
+
+function setStreamQuality(img, value) {
+    if (!img) return;
+    const parts = value.split('x');
+    img.src = basePath + '/live/' + encodeURIComponent(img.dataset.camera) + '?res=' + parts[0] + '&fps=' + parts[1];
+}
+
+function playHLS(video, url) {
+    video.dataset.hlsUrl = url;
+    if (video.canPlayType('application/vnd.apple.mpegurl')) {
+        video.src = url;
+        return Promise.resolve();
+    }
+    if (!('MediaSource' in window)) {
+        return Promise.reject(new Error('live video is not supported in this browser'));
+    }
+
+    // Minimal HLS loader for browsers without native support: the server
+    // produces fMP4 segments, so they can be appended to a SourceBuffer as-is.
+    const base = url.substring(0, url.lastIndexOf('/') + 1);
+    return fetch(url)
+        .then(response => {
+            if (!response.ok) {
+                return response.text().then(text => { throw new Error(text); });
+            }
+            return response.text();
+        })
+        .then(master => {
+            const codecs = (master.match(/CODECS="([^"]+)"/) || [])[1] || 'avc1.42E01E,mp4a.40.2';
+            const playlist = master.split('\n').map(l => l.trim()).find(l => l && !l.startsWith('#'));
+            const mediaSource = new MediaSource();
+            video.src = URL.createObjectURL(mediaSource);
+
+            mediaSource.addEventListener('sourceopen', () => {
+                const buffer = mediaSource.addSourceBuffer('video/mp4; codecs="' + codecs + '"');
+                const queue = [];
+                const seen = new Set();
+
+                const append = () => {
+                    if (!buffer.updating && queue.length) buffer.appendBuffer(queue.shift());
+                };
+                buffer.addEventListener('updateend', () => {
+                    append();
+                    if (buffer.buffered.length) {
+                        const end = buffer.buffered.end(buffer.buffered.length - 1);
+                        if (end - video.currentTime > 6) video.currentTime = end - 1;
+                    }
+                });
+
+                const poll = () => {
+                    if (video.dataset.hlsUrl !== url) return;
+                    fetch(base + playlist)
+                        .then(response => response.text())
+                        .then(text => {
+                            const files = [];
+                            const init = text.match(/#EXT-X-MAP:URI="([^"]+)"/);
+                            if (init && !seen.has(init[1])) files.push(init[1]);
+                            text.split('\n').map(l => l.trim())
+                                .filter(l => l && !l.startsWith('#'))
+                                .forEach(l => { if (!seen.has(l)) files.push(l); });
+
+                            return files.reduce((chain, file) => chain
+                                .then(() => fetch(base + file))
+                                .then(response => response.arrayBuffer())
+                                .then(data => {
+                                    seen.add(file);
+                                    queue.push(data);
+                                    append();
+                                }), Promise.resolve());
+                        })
+                        .catch(err => console.error('Live video failed:', err))
+                        .finally(() => setTimeout(poll, 2000));
+                };
+                poll();
+            });
+        });
+}
+
+function stopHLS(video) {
+    video.dataset.hlsUrl = '';
+    video.removeAttribute('src');
+    video.load();
+}
+
+function toggleLiveMode() {
+    const img = document.getElementById('live-stream');
+    const video = document.getElementById('live-video');
+    const modeBtn = document.getElementById('btn-live-mode');
+    const muteBtn = document.getElementById('btn-mute');
+    const quality = document.getElementById('stream-quality');
+    if (!img || !video) return;
+
+    if (video.hidden) {
+        if (!modeBtn.dataset.label) modeBtn.dataset.label = modeBtn.textContent;
+        playHLS(video, basePath + '/live/' + encodeURIComponent(video.dataset.camera) + '/hls/master.m3u8')
+            .then(() => {
+                img.hidden = true;
+                img.dataset.src = img.src;
+                img.removeAttribute('src');
+                video.hidden = false;
+                if (quality) quality.disabled = true;
+                if (muteBtn) muteBtn.hidden = false;
+                modeBtn.textContent = t('Low latency');
+            })
+            .catch(err => {
+                stopHLS(video);
+                alert(t('Failed to start live video: %s', err.message));
+            });
+        return;
+    }
+
+    stopHLS(video);
+    video.hidden = true;
+    video.muted = true;
+    img.src = img.dataset.src || basePath + '/live/' + encodeURIComponent(img.dataset.camera);
+    img.hidden = false;
+    if (quality) quality.disabled = false;
+    if (muteBtn) {
+        muteBtn.hidden = true;
+        muteBtn.textContent = t('Unmute');
+    }
+    modeBtn.textContent = modeBtn.dataset.label;
+}
+
+function toggleMute() {
+    const video = document.getElementById('live-video');
+    const muteBtn = document.getElementById('btn-mute');
+    if (!video || !muteBtn) return;
+
+    video.muted = !video.muted;
+    muteBtn.textContent = video.muted ? t('Unmute') : t('Mute');
+    if (!video.muted) video.play();
+}
+
+function applyMobileQuality() {
+    if (window.innerWidth > 600) return;
+    document.querySelectorAll('.stream-img').forEach(img => setStreamQuality(img, '320x5'));
+}
+
+function urlBase64ToUint8Array(base64String) {
+    const padding = '='.repeat((4 - base64String.length % 4) % 4);
+    const base64 = (base64String + padding).replace(/-/g, '+').replace(/_/g, '/');
+    const raw = atob(base64);
+    return Uint8Array.from(raw, c => c.charCodeAt(0));
+}
+
+function enableNotifications() {
+    if (!('serviceWorker' in navigator) || !('PushManager' in window)) {
+        alert(t('Push notifications are not supported in this browser'));
+        return;
+    }
+
+    Notification.requestPermission()
+        .then(permission => {
+            if (permission !== 'granted') {
+                throw new Error('permission denied');
+            }
+            return Promise.all([
+                navigator.serviceWorker.ready,
+                fetch(basePath + '/api/push/key').then(response => response.json())
+            ]);
+        })
+        .then(([registration, data]) => {
+            if (!data.public_key) {
+                throw new Error(data.error || 'push is disabled on the server');
+            }
+            return registration.pushManager.subscribe({
+                userVisibleOnly: true,
+                applicationServerKey: urlBase64ToUint8Array(data.public_key)
+            });
+        })
+        .then(subscription => fetch(basePath + '/api/push/subscribe', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(subscription)
+        }))
+        .then(response => response.json())
+        .then(data => {
+            if (data.error) {
+                throw new Error(data.error);
+            }
+            const toggle = document.getElementById('notify-toggle');
+            if (toggle) toggle.hidden = true;
+        })
+        .catch(err => {
+            alert(t('Failed to enable alerts: %s', err.message));
+        });
+}
+
+// Preferences are kept on the server so they follow the user across devices;
+// the local copy only applies them before the server answers.
+let preferences = JSON.parse(localStorage.getItem('preferences') || '{}');
+
+function applyPreferences() {
+    let theme = preferences.theme || 'dark';
+    if (theme === 'system') {
+        theme = window.matchMedia('(prefers-color-scheme: light)').matches ? 'light' : 'dark';
+    }
+    document.documentElement.dataset.theme = theme;
+
+    const grid = document.querySelector('.cameras-grid');
+    if (grid) {
+        grid.style.gridTemplateColumns = preferences.grid_columns ? 'repeat(' + preferences.grid_columns + ', 1fr)' : '';
+    }
+
+    const themeSelect = document.getElementById('pref-theme');
+    if (themeSelect) themeSelect.value = preferences.theme || 'dark';
+    const columnsSelect = document.getElementById('pref-columns');
+    if (columnsSelect) columnsSelect.value = String(preferences.grid_columns || 0);
+    const languageSelect = document.getElementById('pref-language');
+    if (languageSelect) languageSelect.value = preferences.language || '';
+}
+
+function loadPreferences() {
+    fetch(basePath + '/api/preferences')
+        .then(response => response.json())
+        .then(data => {
+            if (!data.preferences) return;
+            preferences = data.preferences;
+            localStorage.setItem('preferences', JSON.stringify(preferences));
+            applyPreferences();
+        })
+        .catch(err => {
+            console.error('Failed to fetch preferences:', err);
+        });
+}
+
+function savePreferences(changes) {
+    Object.assign(preferences, changes);
+    applyPreferences();
+
+    return fetch(basePath + '/api/preferences', {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(changes)
+    })
+        .then(response => response.json())
+        .then(data => {
+            if (data.error) {
+                throw new Error(data.error);
+            }
+            preferences = data.preferences;
+            localStorage.setItem('preferences', JSON.stringify(preferences));
+        })
+        .catch(err => {
+            alert(t('Failed to save preferences: %s', err.message));
+        });
+}
+
+function setLanguage(language) {
+    // Pages are translated on the server, so reload once the choice is saved.
+    savePreferences({ language: language }).then(() => window.location.reload());
+}
+
+// filterByTag reloads the page with only the cameras having the tag.
+function filterByTag(tag) {
+    const url = new URL(window.location.href);
+    if (tag) {
+        url.searchParams.set('tag', tag);
+    } else {
+        url.searchParams.delete('tag');
+    }
+    window.location.href = url.toString();
+}
+
+function enableCameraReordering() {
+    const grid = document.querySelector('.cameras-grid');
+    if (!grid) return;
+
+    const currentOrder = () => Array.from(grid.querySelectorAll('.camera-card')).map(card => card.dataset.camera);
+    let dragged = null;
+    let before = [];
+
+    grid.querySelectorAll('.camera-card').forEach(card => {
+        card.draggable = true;
+        card.addEventListener('dragstart', () => {
+            dragged = card;
+            before = currentOrder();
+            card.classList.add('dragging');
+        });
+        card.addEventListener('dragover', e => {
+            e.preventDefault();
+            if (!dragged || dragged === card) return;
+            const rect = card.getBoundingClientRect();
+            const after = e.clientX > rect.left + rect.width / 2;
+            grid.insertBefore(dragged, after ? card.nextSibling : card);
+        });
+        card.addEventListener('dragend', () => {
+            card.classList.remove('dragging');
+            dragged = null;
+            const order = currentOrder();
+            if (order.join('\n') !== before.join('\n')) {
+                savePreferences({ camera_order: order });
+            }
+        });
+    });
+}
+
+applyPreferences();
+document.addEventListener('DOMContentLoaded', loadPreferences);
+
+if ('serviceWorker' in navigator) {
+    navigator.serviceWorker.register(basePath + '/sw.js').then(registration => {
+        const toggle = document.getElementById('notify-toggle');
+        if (!toggle || !('PushManager' in window)) return;
+
+        fetch(basePath + '/api/push/key')
+            .then(response => response.ok ? registration.pushManager.getSubscription() : true)
+            .then(subscription => {
+                toggle.hidden = !!subscription;
+            });
+    }).catch(err => {
+        console.error('Service worker registration failed:', err);
     });
 }
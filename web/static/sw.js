@@ -0,0 +1,73 @@
+const CACHE_NAME = 'cam-recorder-v1';
+// Paths are relative to this script so the app also works under a base path.
+const STATIC_PREFIX = new URL('static/', self.location).pathname;
+const STATIC_ASSETS = [
+    'static/style.css',
+    'static/app.js',
+    'static/icon.svg',
+    'static/manifest.json'
+];
+
+self.addEventListener('install', event => {
+    event.waitUntil(
+        caches.open(CACHE_NAME).then(cache => cache.addAll(STATIC_ASSETS))
+    );
+    self.skipWaiting();
+});
+
+self.addEventListener('activate', event => {
+    event.waitUntil(
+        caches.keys()
+            .then(keys => Promise.all(keys.filter(key => key !== CACHE_NAME).map(key => caches.delete(key))))
+            .then(() => self.clients.claim())
+    );
+});
+
+self.addEventListener('fetch', event => {
+    const url = new URL(event.request.url);
+    if (event.request.method !== 'GET' || !url.pathname.startsWith(STATIC_PREFIX)) {
+        return;
+    }
+
+    event.respondWith(
+        fetch(event.request)
+            .then(response => {
+                const copy = response.clone();
+                caches.open(CACHE_NAME).then(cache => cache.put(event.request, copy));
+                return response;
+            })
+            .catch(() => caches.match(event.request))
+    );
+});
+
+self.addEventListener('push', event => {
+    const data = event.data ? event.data.json() : {};
+    const options = {
+        body: data.body || '',
+        icon: STATIC_PREFIX + 'icon.svg',
+        badge: STATIC_PREFIX + 'icon.svg',
+        tag: data.camera ? data.kind + ':' + data.camera : data.kind,
+        data: { url: data.url || self.registration.scope }
+    };
+    if (data.image) {
+        options.image = data.image + '?t=' + Date.now();
+    }
+
+    event.waitUntil(self.registration.showNotification(data.title || 'Camera Recorder', options));
+});
+
+self.addEventListener('notificationclick', event => {
+    event.notification.close();
+    const target = new URL(event.notification.data.url, self.location).href;
+
+    event.waitUntil(
+        self.clients.matchAll({ type: 'window' }).then(windows => {
+            for (const win of windows) {
+                if (win.url === target && 'focus' in win) {
+                    return win.focus();
+                }
+            }
+            return self.clients.openWindow(target);
+        })
+    );
+});